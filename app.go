@@ -2,18 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sort"
 	"sync/atomic"
 	"time"
 
 	"waddle/pkg/capture"
+	"waddle/pkg/exporter"
+	"waddle/pkg/importer"
 	"waddle/pkg/infra/config"
 	"waddle/pkg/pipeline"
 	"waddle/pkg/platform"
+	"waddle/pkg/scheduler"
 	"waddle/pkg/server"
 	"waddle/pkg/storage"
 	"waddle/pkg/synthesis"
+	"waddle/pkg/types"
 )
 
 // App struct
@@ -24,6 +29,8 @@ type App struct {
 	plat        platform.Platform
 	pipeline    *pipeline.Pipeline
 	synthWorker *synthesis.Worker
+	localWorker *importer.LocalSourcesWorker
+	scheduler   *scheduler.Scheduler
 	isPaused    *atomic.Bool
 }
 
@@ -41,6 +48,23 @@ func (a *App) startup(ctx context.Context) {
 
 	// 1. Initialize Storage Engine
 	storageConfig := storage.DefaultStorageConfig(a.cfg.DataDir)
+	if a.cfg.SessionIdleGap > 0 {
+		storageConfig.SessionIdleGap = a.cfg.SessionIdleGap
+	}
+	if a.cfg.RetentionDays > 0 {
+		storageConfig.RetentionDays = a.cfg.RetentionDays
+	}
+	storageConfig.RetentionRules = a.cfg.RetentionRules
+	if a.cfg.BackupTime != "" {
+		storageConfig.BackupTime = a.cfg.BackupTime
+	}
+	if len(a.cfg.ScreenshotTiers) > 0 {
+		storageConfig.ScreenshotTiers = a.cfg.ScreenshotTiers
+	}
+	storageConfig.TimeZone = a.cfg.TimeZone
+	storageConfig.DayRolloverHour = a.cfg.DayRolloverHour
+	storageConfig.RevisionRetentionDays = a.cfg.RevisionRetentionDays
+	storageConfig.MaxRevisionsPerEntity = a.cfg.MaxRevisionsPerEntity
 	a.storage = storage.NewStorageEngine(storageConfig)
 	if err := a.storage.Initialize(); err != nil {
 		log.Printf("Error initializing storage engine: %v\n", err)
@@ -83,6 +107,40 @@ func (a *App) startup(ctx context.Context) {
 		}
 	}
 
+	// 4b. Start terminal and git activity sources (requires storage)
+	if a.storage != nil {
+		a.localWorker = importer.NewLocalSourcesWorker(a.storage, importer.LocalSourcesConfig{
+			ShellHistoryFiles: a.cfg.ShellHistoryFiles,
+			GitRepos:          a.cfg.GitRepos,
+			GitAuthors:        a.cfg.GitAuthors,
+			CalendarPaths:     a.cfg.CalendarPaths,
+			Interval:          a.cfg.LocalSourcesInterval,
+		})
+		if err := a.localWorker.Start(); err != nil {
+			log.Printf("Error starting local activity sources: %v\n", err)
+		}
+	}
+
+	// 4c. Schedule backups, retention and other maintenance (requires storage)
+	if a.storage != nil {
+		a.scheduler = scheduler.New(a.storage)
+		jobs, err := scheduler.MaintenanceJobs(a.storage, scheduler.MaintenanceConfig{
+			Schedules: a.cfg.JobSchedules,
+		})
+		if err != nil {
+			log.Printf("Error configuring maintenance jobs: %v\n", err)
+		}
+		for _, job := range jobs {
+			if err := a.scheduler.Register(job); err != nil {
+				log.Printf("Error registering job %s: %v\n", job.Name, err)
+			}
+		}
+		if err := a.scheduler.Start(); err != nil {
+			log.Printf("Error starting job scheduler: %v\n", err)
+			a.scheduler = nil
+		}
+	}
+
 	// 5. Start Pipeline
 	if a.pipeline != nil {
 		if err := a.pipeline.Start(); err != nil {
@@ -93,6 +151,8 @@ func (a *App) startup(ctx context.Context) {
 	// 6. Start API Server to serve frontend requests
 	if a.storage != nil {
 		apiServer := server.NewServer(a.cfg.DataDir, a.cfg.Port, a.isPaused, a.storage)
+		apiServer.SetScheduler(a.scheduler)
+		apiServer.SetActiveStorage(a.activeStorage)
 		apiServer.Start()
 		log.Printf("API Server started on port %s\n", a.cfg.Port)
 	}
@@ -111,6 +171,12 @@ func (a *App) shutdown(ctx context.Context) {
 	if a.synthWorker != nil {
 		a.synthWorker.Close()
 	}
+	if a.localWorker != nil {
+		a.localWorker.Close()
+	}
+	if a.scheduler != nil {
+		a.scheduler.Close()
+	}
 	if a.storage != nil {
 		a.storage.Close()
 	}
@@ -118,12 +184,30 @@ func (a *App) shutdown(ctx context.Context) {
 
 // ── Wails-bound methods (auto-generates JS bindings) ────────────────
 
-// GetSessions returns all sessions for the Memory view.
+// activeStorage returns the store capture is writing to, which is the
+// in-memory one in incognito mode. Everything that reads or changes
+// captured items goes through it or through persistentStorage.
+func (a *App) activeStorage() storage.StorageEngineInterface {
+	if a.pipeline != nil {
+		return a.pipeline.Storage()
+	}
+	return a.storage
+}
+
+// persistentStorage returns the persistent store for the operations the
+// in-memory one doesn't support: meetings, work sessions, block notes, tags
+// and imports. While incognito mode is on it returns a conflict error.
+func (a *App) persistentStorage() (*storage.StorageEngine, error) {
+	return storage.PersistentStore(a.activeStorage())
+}
+
+// GetSessions returns all sessions for the Memory view. In incognito mode
+// only the sessions captured since it was turned on are returned.
 func (a *App) GetSessions() ([]storage.Session, error) {
 	if a.storage == nil {
 		return []storage.Session{}, nil
 	}
-	sessions, _, err := a.storage.ListSessions(1, 100)
+	sessions, _, err := a.activeStorage().ListSessions(1, 100)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +225,7 @@ func (a *App) GetAppDetails(date string) ([]AppDetail, error) {
 	if a.storage == nil {
 		return []AppDetail{}, nil
 	}
-	_, err := a.storage.GetSession(date)
+	session, err := a.activeStorage().GetSessionWithActivities(date)
 	if err != nil {
 		if storage.IsNotFound(err) {
 			return []AppDetail{}, nil
@@ -149,21 +233,11 @@ func (a *App) GetAppDetails(date string) ([]AppDetail, error) {
 		return nil, err
 	}
 
-	activities, err := a.storage.GetSessionAppActivities(date)
-	if err != nil {
-		return nil, err
-	}
-
-	appDetails := make([]AppDetail, 0, len(activities))
-	for _, activity := range activities {
-		blocks, err := a.storage.GetActivityBlocks(date, activity.AppName)
-		if err != nil {
-			return nil, err
-		}
-
+	appDetails := make([]AppDetail, 0, len(session.Activities))
+	for _, activity := range session.Activities {
 		appDetails = append(appDetails, AppDetail{
 			AppName:    activity.AppName,
-			BlockCount: len(blocks),
+			BlockCount: len(activity.Blocks),
 		})
 	}
 
@@ -207,6 +281,474 @@ func (a *App) GetHealthStatus() HealthStatusResponse {
 	}
 }
 
+// ImportBrowserHistory imports new visits from a Chromium "History" or Firefox
+// "places.sqlite" database. The browser is detected from the file name.
+func (a *App) ImportBrowserHistory(historyPath string) (*importer.BrowserImportResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	kind, err := importer.DetectBrowserKind(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	return importer.NewBrowserHistoryImporter(a.storage).Import(kind, historyPath)
+}
+
+// ImportActivityWatch imports an ActivityWatch bucket export. With dryRun set,
+// only the stats of what would be imported are returned.
+func (a *App) ImportActivityWatch(exportPath string, dryRun bool) (*importer.ImportStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	src := importer.NewActivityWatchSource(exportPath)
+	return importer.NewActivityImporter(a.storage).Run(src, importer.ImportOptions{DryRun: dryRun})
+}
+
+// ImportActivityFile imports a generic CSV or NDJSON activity export using
+// the given field mapping. The format is detected from the file extension.
+func (a *App) ImportActivityFile(exportPath string, mapping importer.FieldMapping, dryRun bool) (*importer.ImportStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	format, err := importer.DetectTabularFormat(exportPath)
+	if err != nil {
+		return nil, err
+	}
+	src := importer.NewTabularSource(exportPath, format, mapping)
+	return importer.NewActivityImporter(a.storage).Run(src, importer.ImportOptions{DryRun: dryRun})
+}
+
+// ImportShellHistory imports commands added to a bash, zsh or fish history
+// file since it was last read.
+func (a *App) ImportShellHistory(historyPath string) (*importer.ImportStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	kind, err := importer.DetectShellKind(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	return importer.NewShellHistoryImporter(a.storage).Import(kind, historyPath)
+}
+
+// ImportGitCommits imports the user's commits from a local git repository.
+func (a *App) ImportGitCommits(repoPath string) (*importer.ImportStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return importer.NewGitCommitImporter(a.storage, a.cfg.GitAuthors).Import(repoPath)
+}
+
+// ImportCalendar imports meetings from an .ics file or a directory of them.
+func (a *App) ImportCalendar(path string) ([]*importer.CalendarImportResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return importer.NewCalendarImporter(a.storage).Import(path)
+}
+
+// ExportMarkdown exports sessions, notes and knowledge cards to a Markdown
+// (Obsidian) vault. Re-exporting into the same directory only rewrites changed files.
+func (a *App) ExportMarkdown(opts exporter.MarkdownOptions) (*exporter.MarkdownStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return exporter.NewMarkdownExporter(a.storage).Export(opts)
+}
+
+// ExportBundle writes a portable export bundle for moving to another machine.
+func (a *App) ExportBundle(path string, opts storage.BundleExportOptions) (*storage.BundleExportResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return a.storage.ExportBundle(path, opts)
+}
+
+// ImportBundle imports an export bundle into the local store.
+func (a *App) ImportBundle(path string, opts storage.BundleImportOptions) (*storage.BundleImportResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return a.storage.ImportBundle(path, opts)
+}
+
+// GetJobs returns the state of the scheduled maintenance jobs.
+func (a *App) GetJobs() ([]scheduler.JobStatus, error) {
+	if a.scheduler == nil {
+		return []scheduler.JobStatus{}, nil
+	}
+	return a.scheduler.Status()
+}
+
+// GetJobRuns returns the most recent runs of a maintenance job.
+func (a *App) GetJobRuns(name string, limit int) ([]storage.JobRun, error) {
+	if a.scheduler == nil {
+		return []storage.JobRun{}, nil
+	}
+	return a.scheduler.History(name, limit)
+}
+
+// RunJob starts a maintenance job now, outside its schedule.
+func (a *App) RunJob(name string) (*storage.JobRun, error) {
+	if a.scheduler == nil {
+		return nil, fmt.Errorf("job scheduler is not available")
+	}
+	return a.scheduler.RunNow(name)
+}
+
+// PreviewRetention returns what applying the retention policy would
+// delete, archive and compress.
+func (a *App) PreviewRetention() (*storage.RetentionPlan, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return a.storage.PreviewRetentionPolicy()
+}
+
+// ApplyRetention applies the retention policy now.
+func (a *App) ApplyRetention() (*storage.RetentionResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return a.storage.ApplyRetentionPolicy()
+}
+
+// GetStorageStats returns file storage statistics, including screenshot
+// bytes per storage tier.
+func (a *App) GetStorageStats() (*storage.StorageStats, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	return a.storage.GetFileStats()
+}
+
+// GetMeetings returns the meetings of the session for a given date.
+func (a *App) GetMeetings(date string) ([]storage.Meeting, error) {
+	if a.storage == nil {
+		return []storage.Meeting{}, nil
+	}
+	// Meetings are only imported into the persistent store
+	store, err := a.persistentStorage()
+	if err != nil {
+		return []storage.Meeting{}, nil
+	}
+	meetings, err := store.GetMeetings(date)
+	if storage.IsNotFound(err) {
+		return []storage.Meeting{}, nil
+	}
+	return meetings, err
+}
+
+// FindMeetings returns meetings whose title contains query, newest first.
+func (a *App) FindMeetings(query string) ([]storage.Meeting, error) {
+	if a.storage == nil {
+		return []storage.Meeting{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.FindMeetings(query, 20)
+}
+
+// GetMeetingActivity returns what happened during a meeting: the activity
+// blocks recorded within its time span.
+func (a *App) GetMeetingActivity(meetingID int64) (*storage.MeetingActivity, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetMeetingActivity(meetingID)
+}
+
+// GetWorkSessions splits a day into work sessions at idle gaps and returns them.
+func (a *App) GetWorkSessions(date string) ([]storage.WorkSession, error) {
+	if a.storage == nil {
+		return []storage.WorkSession{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.SegmentSession(date)
+}
+
+// GetWorkSessionActivity returns a work session with its blocks, meetings and knowledge cards.
+func (a *App) GetWorkSessionActivity(workSessionID int64) (*storage.WorkSessionActivity, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetWorkSessionActivity(workSessionID)
+}
+
+// SplitWorkSession splits a work session at an RFC 3339 time.
+func (a *App) SplitWorkSession(workSessionID int64, at string) (*storage.WorkSession, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return nil, fmt.Errorf("invalid split time: %w", err)
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.SplitWorkSession(workSessionID, t)
+}
+
+// MergeWorkSessions merges adjacent work sessions of one day.
+func (a *App) MergeWorkSessions(workSessionIDs []int64) (*storage.WorkSession, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.MergeWorkSessions(workSessionIDs)
+}
+
+// GetNotes returns the Markdown notes of the session for a given date.
+func (a *App) GetNotes(date string) ([]storage.ManualNote, error) {
+	if a.storage == nil {
+		return []storage.ManualNote{}, nil
+	}
+	notes, err := a.activeStorage().GetNotes(date)
+	if storage.IsNotFound(err) {
+		return []storage.ManualNote{}, nil
+	}
+	return notes, err
+}
+
+// AddNote adds a Markdown note to the session for a given date, linked to
+// the given blocks and time ranges.
+func (a *App) AddNote(date, content string, links []storage.NoteLink) (*storage.ManualNote, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store := a.activeStorage()
+	if _, err := store.GetSession(date); storage.IsNotFound(err) {
+		if _, err := store.CreateSession(date); err != nil && !storage.IsConflict(err) {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	note := &storage.ManualNote{Content: content, Links: links}
+	if err := store.AddNote(date, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// UpdateNote replaces a note's content and links. The previous content is
+// kept in the note's history.
+func (a *App) UpdateNote(noteID int64, content string, links []storage.NoteLink) (*storage.ManualNote, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	note := &storage.ManualNote{ID: types.ElementID(noteID), Content: content, Links: links}
+	if err := a.activeStorage().UpdateNote(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// DeleteNote deletes a note and its history.
+func (a *App) DeleteNote(noteID int64) error {
+	if a.storage == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	return a.activeStorage().DeleteNote(noteID)
+}
+
+// GetNoteRevisions returns the earlier versions of a note, newest first.
+func (a *App) GetNoteRevisions(noteID int64) ([]storage.NoteRevision, error) {
+	if a.storage == nil {
+		return []storage.NoteRevision{}, nil
+	}
+	return a.activeStorage().GetNoteRevisions(noteID)
+}
+
+// GetBlockNotes returns the notes that refer to an activity block.
+func (a *App) GetBlockNotes(blockID int64) ([]storage.ManualNote, error) {
+	if a.storage == nil {
+		return []storage.ManualNote{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetBlockNotes(blockID)
+}
+
+// GetRevisions returns the edit history of a session or knowledge card
+// ("session" or "card"), newest first.
+func (a *App) GetRevisions(entity string, id int64) ([]storage.Revision, error) {
+	if a.storage == nil {
+		return []storage.Revision{}, nil
+	}
+	return a.activeStorage().GetRevisions(storage.RevisionEntity(entity), id)
+}
+
+// RestoreRevision undoes a revision and every later revision of its item.
+func (a *App) RestoreRevision(revisionID int64) error {
+	if a.storage == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	return a.activeStorage().RestoreRevision(revisionID)
+}
+
+// ListTags returns all tags ordered by name.
+func (a *App) ListTags() ([]storage.Tag, error) {
+	if a.storage == nil {
+		return []storage.Tag{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListTags()
+}
+
+// CreateTag creates a tag with an optional hex color.
+func (a *App) CreateTag(name, color string) (*storage.Tag, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	tag := &storage.Tag{Name: name, Color: color}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CreateTag(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag deletes a tag and removes it from every item.
+func (a *App) DeleteTag(tagID int64) error {
+	if a.storage == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return err
+	}
+	return store.DeleteTag(tagID)
+}
+
+// TagItem tags a session, activity block or knowledge card ("session",
+// "block" or "card"), creating the tag if needed.
+func (a *App) TagItem(target string, itemID int64, name string) (*storage.Tag, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.TagItem(storage.TagTarget(target), itemID, name)
+}
+
+// UntagItem removes a tag from an item.
+func (a *App) UntagItem(target string, itemID, tagID int64) error {
+	if a.storage == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return err
+	}
+	return store.UntagItem(storage.TagTarget(target), itemID, tagID)
+}
+
+// GetItemTags returns the tags attached to an item.
+func (a *App) GetItemTags(target string, itemID int64) ([]storage.Tag, error) {
+	if a.storage == nil {
+		return []storage.Tag{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetItemTags(storage.TagTarget(target), itemID)
+}
+
+// ListTagRules returns the auto-tag rules.
+func (a *App) ListTagRules() ([]storage.TagRule, error) {
+	if a.storage == nil {
+		return []storage.TagRule{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListTagRules()
+}
+
+// CreateTagRule adds a rule tagging items whose entities of entityType (any
+// type when empty) match pattern, e.g. "jira_ticket", `^(ACME)-\d+$`, "client:$1".
+func (a *App) CreateTagRule(entityType, pattern, tag string) (*storage.TagRule, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	rule := &storage.TagRule{EntityType: storage.EntityType(entityType), Pattern: pattern, Tag: tag}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CreateTagRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// DeleteTagRule deletes an auto-tag rule.
+func (a *App) DeleteTagRule(ruleID int64) error {
+	if a.storage == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return err
+	}
+	return store.DeleteTagRule(ruleID)
+}
+
+// ListImports returns recent import runs, newest first.
+func (a *App) ListImports() ([]storage.ImportRun, error) {
+	if a.storage == nil {
+		return []storage.ImportRun{}, nil
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListImports(100)
+}
+
+// UndoImport removes everything created by an import run.
+func (a *App) UndoImport(importID int64) (*storage.ImportUndoResult, error) {
+	if a.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	store, err := a.persistentStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.UndoImport(importID)
+}
+
 // ToggleCapture pauses or resumes the capture pipeline.
 func (a *App) ToggleCapture(paused bool) error {
 	a.isPaused.Store(paused)
@@ -214,6 +756,48 @@ func (a *App) ToggleCapture(paused bool) error {
 	return nil
 }
 
+// SetIncognito turns incognito capture on or off. While it is on nothing
+// captured touches disk, background imports, synthesis and scheduled jobs
+// are paused, and turning it off discards what was captured.
+func (a *App) SetIncognito(on bool) error {
+	if a.pipeline == nil {
+		return fmt.Errorf("capture pipeline is not available")
+	}
+
+	// Pause before capture switches stores and resume after, so nothing
+	// runs against the persistent store while incognito is on
+	if on {
+		if err := a.pauseBackground(true); err != nil {
+			return err
+		}
+	}
+	if err := a.pipeline.SetIncognito(on); err != nil {
+		if on {
+			a.pauseBackground(false)
+		}
+		return err
+	}
+	if !on {
+		return a.pauseBackground(false)
+	}
+	return nil
+}
+
+// pauseBackground pauses or resumes the workers that write to the
+// persistent store on their own.
+func (a *App) pauseBackground(paused bool) error {
+	if a.synthWorker != nil {
+		a.synthWorker.SetPaused(paused)
+	}
+	if a.scheduler != nil {
+		a.scheduler.SetPaused(paused)
+	}
+	if a.localWorker != nil {
+		return a.localWorker.SetPaused(paused)
+	}
+	return nil
+}
+
 // Greet returns a greeting for the given name (kept for backward compat).
 func (a *App) Greet(name string) string {
 	return "Hello " + name + ", Waddle v2 is active!"
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"waddle/pkg/exporter"
+	"waddle/pkg/storage"
+)
+
+func main() {
+	var (
+		outDir      = flag.String("out", "", "Vault directory to write Markdown files to")
+		dataDir     = flag.String("data-dir", "", "Data directory (default: ~/.waddle)")
+		from        = flag.String("from", "", "First session date to export, YYYY-MM-DD (default: all)")
+		to          = flag.String("to", "", "Last session date to export, YYYY-MM-DD (default: all)")
+		screenshots = flag.String("screenshots", exporter.ScreenshotsLatest, "Screenshots to copy: none, latest or all")
+	)
+	flag.Parse()
+
+	if *outDir == "" {
+		fmt.Println("Usage: export --out=DIR [--from=YYYY-MM-DD] [--to=YYYY-MM-DD] [--screenshots=none|latest|all]")
+		fmt.Println("  --out: Vault directory to write Markdown files to")
+		fmt.Println("  --data-dir: Data directory (default: ~/.waddle)")
+		fmt.Println("  Re-running into the same directory only rewrites changed files.")
+		os.Exit(1)
+	}
+
+	// Determine data directory
+	storageDataDir := *dataDir
+	if storageDataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			fmt.Printf("Error getting home directory: %v\n", err)
+			os.Exit(1)
+		}
+		storageDataDir = filepath.Join(homeDir, ".waddle")
+	}
+
+	storageEngine := storage.NewStorageEngine(storage.DefaultStorageConfig(storageDataDir))
+	if err := storageEngine.Initialize(); err != nil {
+		fmt.Printf("Error initializing storage engine: %v\n", err)
+		os.Exit(1)
+	}
+	defer storageEngine.Close()
+
+	stats, err := exporter.NewMarkdownExporter(storageEngine).Export(exporter.MarkdownOptions{
+		Dir:         *outDir,
+		From:        *from,
+		To:          *to,
+		Screenshots: *screenshots,
+	})
+	if err != nil {
+		fmt.Printf("Error exporting: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %d sessions and %d knowledge cards to %s\n", stats.Sessions, stats.Cards, stats.Dir)
+	fmt.Printf("  %d files written, %d unchanged, %d removed, %d screenshots copied\n",
+		stats.FilesWritten, stats.FilesUnchanged, stats.FilesRemoved, stats.ScreenshotsCopied)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"waddle/pkg/storage"
+)
+
+func usage() {
+	fmt.Println("Usage: migrate [--data-dir=DIR] [--dry-run] status|up [VERSION]|down [VERSION]")
+	fmt.Println("  status: Show the applied and pending schema migrations")
+	fmt.Println("  up: Apply migrations up to VERSION (default: latest)")
+	fmt.Println("  down: Revert migrations down to VERSION (default: one migration)")
+	fmt.Println("  --data-dir: Data directory (default: ~/.waddle)")
+	fmt.Println("  --dry-run: Run the migrations in a transaction that is rolled back")
+	fmt.Println("  The database is copied to migration_backups/ before it is changed.")
+	os.Exit(1)
+}
+
+func main() {
+	var (
+		dataDir = flag.String("data-dir", "", "Data directory (default: ~/.waddle)")
+		dryRun  = flag.Bool("dry-run", false, "Run the migrations in a transaction that is rolled back")
+	)
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || len(args) > 2 {
+		usage()
+	}
+	command := args[0]
+	if command != "status" && command != "up" && command != "down" {
+		usage()
+	}
+	target := -1
+	if len(args) == 2 {
+		if command == "status" {
+			usage()
+		}
+		v, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("Invalid version %q\n", args[1])
+			os.Exit(1)
+		}
+		target = v
+	}
+
+	// Determine data directory
+	storageDataDir := *dataDir
+	if storageDataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			fmt.Printf("Error getting home directory: %v\n", err)
+			os.Exit(1)
+		}
+		storageDataDir = filepath.Join(homeDir, ".waddle")
+	}
+	if _, err := os.Stat(filepath.Join(storageDataDir, "waddle.db")); err != nil {
+		fmt.Printf("No database found in %s\n", storageDataDir)
+		os.Exit(1)
+	}
+
+	// Reverting note encryption needs the key
+	em := storage.NewEncryptionManager(storageDataDir)
+	if err := em.InitializeKey(); err != nil {
+		fmt.Printf("Error initializing encryption: %v\n", err)
+		os.Exit(1)
+	}
+
+	sm := storage.NewSessionManager(storageDataDir, em)
+	if err := sm.Open(); err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer sm.Close()
+
+	status, err := sm.GetSchemaStatus()
+	if err != nil {
+		fmt.Printf("Error reading schema status: %v\n", err)
+		os.Exit(1)
+	}
+
+	if command == "status" {
+		printStatus(status)
+		return
+	}
+
+	if target < 0 {
+		target = status.Latest
+		if command == "down" {
+			target = 0
+			if n := len(status.Applied); n > 1 {
+				target = status.Applied[n-2].Version
+			}
+		}
+	}
+	if command == "up" && target < status.Version {
+		fmt.Printf("Schema is at version %d; use down to reach version %d\n", status.Version, target)
+		os.Exit(1)
+	}
+	if command == "down" && target > status.Version {
+		fmt.Printf("Schema is at version %d; use up to reach version %d\n", status.Version, target)
+		os.Exit(1)
+	}
+
+	result, err := sm.MigrateTo(target, storage.MigrationOptions{DryRun: *dryRun})
+	if err != nil {
+		fmt.Printf("Error migrating: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(result.Steps) == 0 {
+		fmt.Printf("Schema is already at version %d\n", result.From)
+		return
+	}
+	verb := "Applied"
+	if result.Steps[0].Down {
+		verb = "Reverted"
+	}
+	if result.DryRun {
+		verb = "Would have " + strings.ToLower(verb)
+	}
+	for _, step := range result.Steps {
+		fmt.Printf("%s %d: %s\n", verb, step.Version, step.Description)
+	}
+	if result.Backup != "" {
+		fmt.Printf("Backed up the database to %s first\n", result.Backup)
+	}
+	if result.DryRun {
+		fmt.Printf("Dry run: schema left at version %d\n", result.From)
+	} else {
+		fmt.Printf("Schema migrated from version %d to %d\n", result.From, result.To)
+	}
+}
+
+// printStatus prints the applied and pending migrations.
+func printStatus(status *storage.SchemaStatus) {
+	fmt.Printf("Schema version %d (this build: %d)\n", status.Version, status.Latest)
+	if status.Version > status.Latest {
+		fmt.Println("  The database was migrated by a newer build, which this one can't open.")
+	}
+
+	for _, m := range status.Applied {
+		note := ""
+		switch {
+		case m.Unknown:
+			note = " [unknown to this build]"
+		case m.Modified:
+			note = " [changed since applied]"
+		case m.Irreversible != "":
+			note = " [irreversible]"
+		}
+		fmt.Printf("  %3d  applied %s  %s%s\n", m.Version, m.AppliedAt.Format("2006-01-02 15:04"), m.Description, note)
+	}
+	for _, m := range status.Pending {
+		fmt.Printf("  %3d  pending           %s\n", m.Version, m.Description)
+	}
+}
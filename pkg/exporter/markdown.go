@@ -0,0 +1,507 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// Screenshot selections for MarkdownOptions.Screenshots.
+const (
+	ScreenshotsNone   = "none"
+	ScreenshotsLatest = "latest" // The latest screenshot of each app
+	ScreenshotsAll    = "all"
+)
+
+// manifestName is the file in the vault listing what the last export wrote,
+// so files that are no longer produced can be removed.
+const manifestName = ".waddle-export.json"
+
+// MarkdownOptions controls a Markdown export.
+type MarkdownOptions struct {
+	Dir         string `json:"dir"`            // Vault directory the files are written to
+	From        string `json:"from,omitempty"` // First session date, inclusive; empty for no lower bound
+	To          string `json:"to,omitempty"`   // Last session date, inclusive; empty for no upper bound
+	Screenshots string `json:"screenshots"`    // "none", "latest" (default) or "all"
+}
+
+// MarkdownStats summarizes a Markdown export.
+type MarkdownStats struct {
+	Dir               string `json:"dir"`
+	Sessions          int    `json:"sessions"`
+	Cards             int    `json:"cards"`
+	FilesWritten      int    `json:"filesWritten"`
+	FilesUnchanged    int    `json:"filesUnchanged"`
+	FilesRemoved      int    `json:"filesRemoved"` // Files from an earlier export that are no longer produced
+	ScreenshotsCopied int    `json:"screenshotsCopied"`
+}
+
+// MarkdownExporter writes sessions, notes, chats and knowledge cards as an
+// Obsidian-compatible vault: one note per session under Sessions/, one per
+// knowledge card under Cards/ and screenshots under Attachments/. Entities
+// become [[wikilinks]] and tags become front matter tags.
+//
+// Re-exporting into the same directory only rewrites files whose content
+// changed, so sync tools and editors see just the real changes.
+type MarkdownExporter struct {
+	storage *storage.StorageEngine
+}
+
+// NewMarkdownExporter creates a new MarkdownExporter.
+func NewMarkdownExporter(storageEngine *storage.StorageEngine) *MarkdownExporter {
+	return &MarkdownExporter{storage: storageEngine}
+}
+
+// exportManifest maps each file written by an export, relative to the vault,
+// to the session date it belongs to.
+type exportManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// Export writes the sessions in the options' date range to the vault.
+func (me *MarkdownExporter) Export(opts MarkdownOptions) (*MarkdownStats, error) {
+	if opts.Dir == "" {
+		return nil, storage.NewStorageError(storage.ErrValidation, "export directory is required", nil)
+	}
+	switch opts.Screenshots {
+	case "":
+		opts.Screenshots = ScreenshotsLatest
+	case ScreenshotsNone, ScreenshotsLatest, ScreenshotsAll:
+	default:
+		return nil, storage.NewStorageError(storage.ErrValidation, "unknown screenshot selection "+opts.Screenshots, nil)
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, storage.NewStorageError(storage.ErrFileSystem, "failed to create export directory", err)
+	}
+
+	previous := me.readManifest(opts.Dir)
+	manifest := exportManifest{Files: make(map[string]string)}
+	stats := &MarkdownStats{Dir: opts.Dir}
+
+	sessions, err := me.listSessions(opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		files, err := me.exportSession(opts, session, stats)
+		if err != nil {
+			return stats, err
+		}
+		for _, file := range files {
+			manifest.Files[file] = session.Date
+		}
+		stats.Sessions++
+	}
+
+	// Files from sessions outside the range are kept as they were
+	for file, date := range previous.Files {
+		if _, ok := manifest.Files[file]; ok {
+			continue
+		}
+		if !inRange(date, opts.From, opts.To) {
+			manifest.Files[file] = date
+			continue
+		}
+		if err := os.Remove(filepath.Join(opts.Dir, filepath.FromSlash(file))); err == nil {
+			stats.FilesRemoved++
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return stats, storage.NewStorageError(storage.ErrFileSystem, "failed to encode export manifest", err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, manifestName), data, 0644); err != nil {
+		return stats, storage.NewStorageError(storage.ErrFileSystem, "failed to write export manifest", err)
+	}
+
+	return stats, nil
+}
+
+// listSessions returns the sessions between from and to, oldest first.
+func (me *MarkdownExporter) listSessions(from, to string) ([]storage.Session, error) {
+	var sessions []storage.Session
+	err := me.storage.IterateSessions(storage.SessionQuery{From: from, To: to}, func(session storage.Session) error {
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// inRange reports whether date lies between from and to; empty bounds are open.
+func inRange(date, from, to string) bool {
+	return (from == "" || date >= from) && (to == "" || date <= to)
+}
+
+func (me *MarkdownExporter) readManifest(dir string) exportManifest {
+	var manifest exportManifest
+	if data, err := os.ReadFile(filepath.Join(dir, manifestName)); err == nil {
+		json.Unmarshal(data, &manifest)
+	}
+	return manifest
+}
+
+// exportSession writes a session's note, its knowledge cards and
+// screenshots, returning the files produced relative to the vault.
+func (me *MarkdownExporter) exportSession(opts MarkdownOptions, session storage.Session, stats *MarkdownStats) ([]string, error) {
+	loc := time.Local
+	if session.TimeZone != "" {
+		if zone, err := time.LoadLocation(session.TimeZone); err == nil {
+			loc = zone
+		}
+	}
+
+	apps, err := me.storage.GetSessionAppActivities(session.Date)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := me.storage.GetItemTags(storage.TagTargetSession, int64(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	notes, err := me.storage.GetNotes(session.Date)
+	if err != nil {
+		return nil, err
+	}
+	chats, err := me.storage.GetChats(session.Date)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := me.storage.GetKnowledgeCardsBySession(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].ID < cards[j].ID })
+
+	var files []string
+
+	// Cards first, so the session note can link to their file names
+	var cardNames []string
+	used := make(map[string]bool)
+	for _, card := range cards {
+		name := cardFileName(session.Date, card.Title, used)
+		cardTags, err := me.storage.GetItemTags(storage.TagTargetCard, int64(card.ID))
+		if err != nil {
+			return nil, err
+		}
+		file := "Cards/" + name + ".md"
+		if err := me.writeFile(opts.Dir, file, renderCard(session.Date, card, cardTags), stats); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		cardNames = append(cardNames, name)
+		stats.Cards++
+	}
+
+	var screenshots []string
+	if opts.Screenshots != ScreenshotsNone {
+		paths, err := me.storage.ListScreenshots(session.Date)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if opts.Screenshots == ScreenshotsLatest && !strings.HasPrefix(filepath.Base(path), "latest.") {
+				continue
+			}
+			// Name attachments after the app folder they come from
+			app := filepath.Base(filepath.Dir(path))
+			if app == "screenshots" {
+				app = filepath.Base(filepath.Dir(filepath.Dir(path)))
+			}
+			file := "Attachments/" + session.Date + "/" + app + "-" + filepath.Base(path)
+			if err := me.copyFile(path, opts.Dir, file, stats); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+			screenshots = append(screenshots, file)
+		}
+	}
+
+	file := "Sessions/" + session.Date + ".md"
+	content := renderSession(session, loc, apps, tags, notes, chats, cardNames, screenshots)
+	if err := me.writeFile(opts.Dir, file, content, stats); err != nil {
+		return nil, err
+	}
+	return append(files, file), nil
+}
+
+// writeFile writes content to file in the vault unless it already holds it.
+func (me *MarkdownExporter) writeFile(dir, file string, content []byte, stats *MarkdownStats) error {
+	path := filepath.Join(dir, filepath.FromSlash(file))
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+		stats.FilesUnchanged++
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to create export directory", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to write "+file, err)
+	}
+	stats.FilesWritten++
+	return nil
+}
+
+// copyFile decrypts src to file in the vault unless a copy with the same
+// modification time is already there.
+func (me *MarkdownExporter) copyFile(src, dir, file string, stats *MarkdownStats) error {
+	info, err := me.storage.StatScreenshot(src)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, filepath.FromSlash(file))
+	if existing, err := os.Stat(path); err == nil && existing.ModTime().Equal(info.ModTime) {
+		stats.FilesUnchanged++
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to create export directory", err)
+	}
+	in, err := me.storage.OpenScreenshot(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path)
+	if err != nil {
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to create "+file, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to copy screenshot", err)
+	}
+	if err := out.Close(); err != nil {
+		return storage.NewStorageError(storage.ErrFileSystem, "failed to copy screenshot", err)
+	}
+	os.Chtimes(path, info.ModTime, info.ModTime)
+
+	stats.ScreenshotsCopied++
+	return nil
+}
+
+// renderSession renders a session note.
+func renderSession(session storage.Session, loc *time.Location, apps []storage.AppActivity, tags []storage.Tag,
+	notes []storage.ManualNote, chats []storage.ChatMessage, cardNames, screenshots []string) []byte {
+	var b strings.Builder
+
+	var appNames []string
+	for _, app := range apps {
+		appNames = append(appNames, app.AppName)
+	}
+	entities := entityValues(session.EntitiesJSON)
+
+	b.WriteString("---\n")
+	writeYAMLField(&b, "date", session.Date)
+	if session.CustomTitle != "" {
+		writeYAMLField(&b, "title", session.CustomTitle)
+	}
+	writeYAMLList(&b, "apps", appNames)
+	writeYAMLList(&b, "entities", entities)
+	writeYAMLList(&b, "tags", tagNames(tags))
+	b.WriteString("---\n\n")
+
+	title := session.CustomTitle
+	if title == "" {
+		title = session.Date
+	}
+	fmt.Fprintf(&b, "# %s\n", title)
+
+	summary := session.CustomSummary
+	if summary == "" {
+		summary = session.AISummary
+	}
+	if summary != "" {
+		fmt.Fprintf(&b, "\n## Summary\n\n%s\n", strings.TrimSpace(summary))
+	}
+
+	if bullets := stringList(session.AIBullets); len(bullets) > 0 {
+		b.WriteString("\n## Highlights\n\n")
+		for _, bullet := range bullets {
+			fmt.Fprintf(&b, "- %s\n", bullet)
+		}
+	}
+
+	if len(entities) > 0 {
+		fmt.Fprintf(&b, "\n## Entities\n\n%s\n", wikilinks(entities))
+	}
+
+	if len(cardNames) > 0 {
+		b.WriteString("\n## Knowledge Cards\n\n")
+		for _, name := range cardNames {
+			fmt.Fprintf(&b, "- [[%s]]\n", name)
+		}
+	}
+
+	if len(notes) > 0 {
+		b.WriteString("\n## Notes\n")
+		for _, note := range notes {
+			fmt.Fprintf(&b, "\n### %s\n\n%s\n", note.CreatedAt.In(loc).Format("15:04"), strings.TrimSpace(note.Content))
+		}
+	}
+
+	if len(chats) > 0 {
+		b.WriteString("\n## Chat\n\n")
+		for _, chat := range chats {
+			speaker := "You"
+			if chat.Role == storage.ChatRoleAssistant {
+				speaker = "Assistant"
+			}
+			fmt.Fprintf(&b, "**%s** (%s): %s\n\n", speaker, chat.Timestamp.In(loc).Format("15:04"), strings.TrimSpace(chat.Content))
+		}
+	}
+
+	if len(screenshots) > 0 {
+		b.WriteString("\n## Screenshots\n\n")
+		for _, file := range screenshots {
+			fmt.Fprintf(&b, "![[%s]]\n", file)
+		}
+	}
+
+	return []byte(strings.TrimRight(b.String(), "\n") + "\n")
+}
+
+// renderCard renders a knowledge card note linking back to its session.
+func renderCard(date string, card storage.KnowledgeCard, tags []storage.Tag) []byte {
+	var b strings.Builder
+
+	entities := entityValues(card.Entities)
+
+	b.WriteString("---\n")
+	writeYAMLField(&b, "date", date)
+	writeYAMLField(&b, "session", "[["+date+"]]")
+	writeYAMLField(&b, "status", card.Status)
+	writeYAMLList(&b, "entities", entities)
+	writeYAMLList(&b, "tags", tagNames(tags))
+	b.WriteString("---\n\n")
+
+	fmt.Fprintf(&b, "# %s\n\n", card.Title)
+	for _, bullet := range stringList(card.Bullets) {
+		fmt.Fprintf(&b, "- %s\n", bullet)
+	}
+	if len(entities) > 0 {
+		fmt.Fprintf(&b, "\nRelated: %s\n", wikilinks(entities))
+	}
+	fmt.Fprintf(&b, "\nFrom [[%s]]\n", date)
+
+	return []byte(b.String())
+}
+
+// cardFileName names a card's note after its date and title, numbering
+// cards of the same day that share a title.
+func cardFileName(date, title string, used map[string]bool) string {
+	base := date + " " + safeFileName(title)
+	if strings.TrimSpace(title) == "" {
+		base = date + " Card"
+	}
+	name := base
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d)", base, n)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// safeFileName replaces characters that are invalid in file names or that
+// Obsidian treats specially in links.
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '#', '^', '[', ']':
+			return '-'
+		}
+		if r < 32 {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if len(name) > 100 {
+		name = strings.TrimSpace(name[:100])
+	}
+	return name
+}
+
+// entityValues reads entity values from a JSON array of entities or strings.
+func entityValues(entitiesJSON string) []string {
+	if entitiesJSON == "" {
+		return nil
+	}
+
+	var values []string
+	var entities []storage.Entity
+	if err := json.Unmarshal([]byte(entitiesJSON), &entities); err == nil {
+		for _, entity := range entities {
+			values = append(values, entity.Value)
+		}
+	} else {
+		values = stringList(entitiesJSON)
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// stringList reads a JSON array of strings, ignoring anything else.
+func stringList(listJSON string) []string {
+	var list []string
+	json.Unmarshal([]byte(listJSON), &list)
+	return list
+}
+
+// tagNames converts tag names to Obsidian tags, which can't contain spaces
+// or colons; "client:acme" becomes "client/acme".
+func tagNames(tags []storage.Tag) []string {
+	var names []string
+	for _, tag := range tags {
+		name := strings.ReplaceAll(tag.Name, ":", "/")
+		names = append(names, strings.Join(strings.Fields(name), "-"))
+	}
+	return names
+}
+
+func wikilinks(values []string) string {
+	links := make([]string, len(values))
+	for i, value := range values {
+		links[i] = "[[" + safeFileName(value) + "]]"
+	}
+	return strings.Join(links, ", ")
+}
+
+// writeYAMLField writes a front matter field. JSON strings are valid YAML
+// double-quoted scalars, which keeps values with colons or quotes intact.
+func writeYAMLField(b *strings.Builder, key, value string) {
+	quoted, _ := json.Marshal(value)
+	fmt.Fprintf(b, "%s: %s\n", key, quoted)
+}
+
+func writeYAMLList(b *strings.Builder, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", key)
+	for _, value := range values {
+		quoted, _ := json.Marshal(value)
+		fmt.Fprintf(b, "  - %s\n", quoted)
+	}
+}
@@ -0,0 +1,139 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+func setupTestStorage(t *testing.T) *storage.StorageEngine {
+	t.Helper()
+
+	se := storage.NewStorageEngine(storage.DefaultStorageConfig(t.TempDir()))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	t.Cleanup(func() { se.Close() })
+
+	return se
+}
+
+func TestMarkdownExport(t *testing.T) {
+	se := setupTestStorage(t)
+
+	session, err := se.CreateSession("2025-06-02")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	session.CustomTitle = "Release: v2"
+	if err := se.UpdateSession(session); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	entities := `[{"value":"ACME-12","type":"jira_ticket","count":2}]`
+	if err := se.UpdateSessionSynthesis(session.ID, entities, "completed", "Shipped it", `["Tagged v2","Wrote notes"]`); err != nil {
+		t.Fatalf("Failed to update synthesis: %v", err)
+	}
+	if _, err := se.TagItem(storage.TagTargetSession, int64(session.ID), "client:acme"); err != nil {
+		t.Fatalf("Failed to tag session: %v", err)
+	}
+	if err := se.AddNote(session.Date, &storage.ManualNote{Content: "Remember the changelog"}); err != nil {
+		t.Fatalf("Failed to add note: %v", err)
+	}
+	chat := &storage.ChatMessage{Role: storage.ChatRoleUser, Content: "What did I ship?", Timestamp: time.Now()}
+	if err := se.AddChat(session.Date, chat); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	card := &storage.KnowledgeCard{SessionID: session.ID, Title: "Release / rollout", Bullets: `["Rolled out"]`, Entities: entities, Status: "completed"}
+	if err := se.CreateKnowledgeCard(card); err != nil {
+		t.Fatalf("Failed to create card: %v", err)
+	}
+	if _, err := se.SaveScreenshot(session.Date, "Code", "shot.png", []byte("png")); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+
+	dir := t.TempDir()
+	exp := NewMarkdownExporter(se)
+
+	t.Run("Writes sessions, cards and screenshots", func(t *testing.T) {
+		stats, err := exp.Export(MarkdownOptions{Dir: dir, Screenshots: ScreenshotsAll})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if stats.Sessions != 1 || stats.Cards != 1 || stats.ScreenshotsCopied != 1 || stats.FilesWritten != 2 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "Sessions", "2025-06-02.md"))
+		if err != nil {
+			t.Fatalf("Failed to read session note: %v", err)
+		}
+		note := string(data)
+		for _, want := range []string{
+			"title: \"Release: v2\"",
+			"  - \"client/acme\"",
+			"- Tagged v2",
+			"[[ACME-12]]",
+			"[[2025-06-02 Release - rollout]]",
+			"Remember the changelog",
+			"**You**",
+			"![[Attachments/2025-06-02/Code-shot.png]]",
+		} {
+			if !strings.Contains(note, want) {
+				t.Errorf("Expected session note to contain %q:\n%s", want, note)
+			}
+		}
+
+		data, err = os.ReadFile(filepath.Join(dir, "Cards", "2025-06-02 Release - rollout.md"))
+		if err != nil || !strings.Contains(string(data), "From [[2025-06-02]]") {
+			t.Errorf("Expected card note linking its session, got %q (%v)", data, err)
+		}
+	})
+
+	t.Run("Re-export only touches changed files", func(t *testing.T) {
+		stats, err := exp.Export(MarkdownOptions{Dir: dir, Screenshots: ScreenshotsAll})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if stats.FilesWritten != 0 || stats.ScreenshotsCopied != 0 || stats.FilesUnchanged != 3 {
+			t.Errorf("Expected nothing rewritten, got %+v", stats)
+		}
+
+		card.Title = "Rollout"
+		if err := se.UpdateKnowledgeCard(card); err != nil {
+			t.Fatalf("Failed to rename card: %v", err)
+		}
+		stats, err = exp.Export(MarkdownOptions{Dir: dir, Screenshots: ScreenshotsNone})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		// The renamed card and the session note linking it are rewritten;
+		// the old card file and the screenshot are removed
+		if stats.FilesWritten != 2 || stats.FilesRemoved != 2 {
+			t.Errorf("Unexpected stats after rename: %+v", stats)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Cards", "2025-06-02 Release - rollout.md")); !os.IsNotExist(err) {
+			t.Errorf("Expected the old card file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("Sessions outside the range are left alone", func(t *testing.T) {
+		stats, err := exp.Export(MarkdownOptions{Dir: dir, From: "2025-07-01"})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if stats.Sessions != 0 || stats.FilesRemoved != 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Sessions", "2025-06-02.md")); err != nil {
+			t.Errorf("Expected the session note to stay, got %v", err)
+		}
+
+		if _, err := exp.Export(MarkdownOptions{Dir: dir, Screenshots: "some"}); !storage.IsValidation(err) {
+			t.Errorf("Expected validation error for unknown screenshot selection, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+	"waddle/pkg/synthesis"
+)
+
+// ActivityRecord is one span of activity read from an external tracker,
+// normalized before it is turned into an activity block.
+type ActivityRecord struct {
+	ExternalKey string                 // Stable identifier used to skip records on re-import
+	AppName     string                 // Application the activity belongs to
+	Title       string                 // Window title or description, stored as the micro summary
+	Start       time.Time              // Start of the span
+	End         time.Time              // End of the span
+	Metadata    map[string]interface{} // Source-specific fields kept in structured_metadata
+	Text        string                 // Optional text appended to the session's extracted text for synthesis
+}
+
+// ActivitySource reads normalized records from an external export.
+type ActivitySource interface {
+	// Importer returns the importer name recorded in provenance (e.g. "activitywatch").
+	Importer() string
+	// Source describes where the records come from, usually a file path.
+	Source() string
+	// Records returns every record in the export.
+	Records() ([]ActivityRecord, error)
+}
+
+// ImportOptions controls an activity import run.
+type ImportOptions struct {
+	DryRun  bool         `json:"dryRun"`            // Compute stats without writing anything
+	Exclude []TimeWindow `json:"exclude,omitempty"` // Records overlapping these windows are skipped
+}
+
+// TimeWindow is the span of time [Start, End).
+type TimeWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// overlaps reports whether the window overlaps [start, end]. A record
+// without a span overlaps it if it starts inside it.
+func (tw TimeWindow) overlaps(start, end time.Time) bool {
+	return start.Before(tw.End) && !end.Before(tw.Start)
+}
+
+// ImportStats summarizes an activity import run.
+type ImportStats struct {
+	ImportID        int64          `json:"importId,omitempty"` // 0 for dry runs
+	Importer        string         `json:"importer"`
+	Source          string         `json:"source"`
+	DryRun          bool           `json:"dryRun"`
+	RecordsRead     int            `json:"recordsRead"`
+	BlocksCreated   int            `json:"blocksCreated"`
+	SessionsCreated int            `json:"sessionsCreated"`
+	Duplicates      int            `json:"duplicates"`
+	Skipped         int            `json:"skipped"` // Records missing an app name, with an empty span or in an excluded window
+	BlocksByApp     map[string]int `json:"blocksByApp"`
+	FirstActivity   *time.Time     `json:"firstActivity,omitempty"`
+	LastActivity    *time.Time     `json:"lastActivity,omitempty"`
+}
+
+// ActivityImporter turns records from an ActivitySource into sessions, app
+// activities and blocks, recording provenance so the run can be undone.
+type ActivityImporter struct {
+	storage   *storage.StorageEngine
+	extractor *synthesis.Extractor
+}
+
+// NewActivityImporter creates a new ActivityImporter.
+func NewActivityImporter(storageEngine *storage.StorageEngine) *ActivityImporter {
+	return &ActivityImporter{
+		storage:   storageEngine,
+		extractor: synthesis.NewExtractor(),
+	}
+}
+
+// Run imports all records from src. Records whose external key was already
+// imported are counted as duplicates and skipped.
+func (ai *ActivityImporter) Run(src ActivitySource, opts ImportOptions) (*ImportStats, error) {
+	records, err := src.Records()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s export: %w", src.Importer(), err)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+
+	stats := &ImportStats{
+		Importer:    src.Importer(),
+		Source:      src.Source(),
+		DryRun:      opts.DryRun,
+		RecordsRead: len(records),
+		BlocksByApp: make(map[string]int),
+	}
+
+	if len(opts.Exclude) > 0 {
+		kept := records[:0]
+		for _, rec := range records {
+			if excluded(opts.Exclude, rec) {
+				stats.Skipped++
+				continue
+			}
+			kept = append(kept, rec)
+		}
+		records = kept
+	}
+
+	// Polled sources often have nothing new; don't record an empty run
+	if len(records) == 0 {
+		return stats, nil
+	}
+
+	if !opts.DryRun {
+		stats.ImportID, err = ai.storage.BeginImport(stats.Importer, stats.Source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ai.importRecords(records, stats)
+
+	if !opts.DryRun {
+		status := storage.ImportStatusCompleted
+		if err != nil {
+			status = storage.ImportStatusFailed
+		}
+		statsJSON, _ := json.Marshal(stats)
+		if finishErr := ai.storage.FinishImport(stats.ImportID, status, string(statsJSON)); finishErr != nil && err == nil {
+			err = finishErr
+		}
+	}
+
+	return stats, err
+}
+
+// excluded reports whether rec overlaps one of windows.
+func excluded(windows []TimeWindow, rec ActivityRecord) bool {
+	for _, window := range windows {
+		if window.overlaps(rec.Start, rec.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// importRecords writes (or, for dry runs, counts) each record.
+func (ai *ActivityImporter) importRecords(records []ActivityRecord, stats *ImportStats) error {
+	// Sessions that exist or would exist, so dry runs count each new day once
+	knownSessions := make(map[string]bool)
+	// Record text per session date, handed to synthesis once all blocks are stored
+	sessionText := make(map[string][]string)
+
+	for _, rec := range records {
+		if rec.AppName == "" || !rec.End.After(rec.Start) {
+			stats.Skipped++
+			continue
+		}
+
+		key := rec.ExternalKey
+		if key == "" {
+			key = recordKey(rec)
+		}
+
+		imported, err := ai.storage.HasImportedKey(stats.Importer, key)
+		if err != nil {
+			return err
+		}
+		if imported {
+			stats.Duplicates++
+			continue
+		}
+
+		date := ai.storage.SessionDate(rec.Start)
+		if !knownSessions[date] {
+			created, err := ai.ensureSession(date, stats)
+			if err != nil {
+				return err
+			}
+			if created {
+				stats.SessionsCreated++
+			}
+			knownSessions[date] = true
+		}
+
+		if !stats.DryRun {
+			block, err := ai.recordBlock(stats.Importer, key, rec)
+			if err != nil {
+				return err
+			}
+			if err := ai.storage.AddActivityBlock(date, rec.AppName, block); err != nil {
+				return err
+			}
+			if err := ai.storage.AddImportRecord(stats.ImportID, stats.Importer, storage.ImportEntityActivityBlock, int64(block.ID), key); err != nil {
+				return err
+			}
+			if rec.Text != "" {
+				sessionText[date] = append(sessionText[date], rec.Text)
+			}
+		}
+
+		stats.BlocksCreated++
+		stats.BlocksByApp[rec.AppName]++
+		if stats.FirstActivity == nil || rec.Start.Before(*stats.FirstActivity) {
+			start := rec.Start
+			stats.FirstActivity = &start
+		}
+		if stats.LastActivity == nil || rec.End.After(*stats.LastActivity) {
+			end := rec.End
+			stats.LastActivity = &end
+		}
+	}
+
+	for date, lines := range sessionText {
+		if err := ai.appendSessionText(date, lines); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendSessionText adds imported text to a session's extracted text and
+// queues the session for synthesis again.
+func (ai *ActivityImporter) appendSessionText(date string, lines []string) error {
+	session, err := ai.storage.GetSession(date)
+	if err != nil {
+		return err
+	}
+
+	text := strings.Join(lines, "\n")
+	if session.ExtractedText != "" {
+		text = session.ExtractedText + "\n" + text
+	}
+	session.ExtractedText = text
+	session.SynthesisStatus = "pending"
+
+	return ai.storage.UpdateSessionAs(session, storage.RevisionActorImport)
+}
+
+// ensureSession makes sure a session exists for date and reports whether it
+// had to be created. Dry runs only check for existence.
+func (ai *ActivityImporter) ensureSession(date string, stats *ImportStats) (bool, error) {
+	_, err := ai.storage.GetSession(date)
+	if err == nil {
+		return false, nil
+	}
+	if !storage.IsNotFound(err) {
+		return false, err
+	}
+	if stats.DryRun {
+		return true, nil
+	}
+
+	session, err := ai.storage.CreateSession(date)
+	if err != nil {
+		return false, err
+	}
+	if err := ai.storage.AddImportRecord(stats.ImportID, stats.Importer, storage.ImportEntitySession, int64(session.ID), ""); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Undo removes everything created by an import run.
+func (ai *ActivityImporter) Undo(importID int64) (*storage.ImportUndoResult, error) {
+	return ai.storage.UndoImport(importID)
+}
+
+// recordBlock converts a record into an activity block. Block IDs are derived
+// from the external key so imported blocks never overwrite captured ones.
+// Entities found in the record text are kept in the block metadata.
+func (ai *ActivityImporter) recordBlock(importer, key string, rec ActivityRecord) (*storage.ActivityBlock, error) {
+	metadata := map[string]interface{}{
+		"importer":    importer,
+		"externalKey": key,
+		"title":       rec.Title,
+	}
+	for k, v := range rec.Metadata {
+		metadata[k] = v
+	}
+	if rec.Text != "" {
+		if entities := ai.extractor.Extract(rec.Text); len(entities) > 0 {
+			metadata["entities"] = entities
+		}
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal block metadata: %w", err)
+	}
+
+	hash := sha256.Sum256([]byte(importer + "\x00" + key))
+
+	return &storage.ActivityBlock{
+		BlockID:            ai.storage.BlockID(rec.Start) + "-" + hex.EncodeToString(hash[:4]),
+		StartTime:          rec.Start,
+		EndTime:            rec.End,
+		MicroSummary:       rec.Title,
+		CaptureSource:      "import_" + importer,
+		StructuredMetadata: string(metadataJSON),
+	}, nil
+}
+
+// recordKey derives a dedup key for records whose source has no stable ID.
+func recordKey(rec ActivityRecord) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d",
+		rec.AppName, rec.Title, rec.Start.UnixNano(), rec.End.UnixNano())))
+	return hex.EncodeToString(hash[:])
+}
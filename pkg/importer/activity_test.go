@@ -0,0 +1,191 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+const awExport = `{
+  "buckets": {
+    "aw-watcher-window_laptop": {
+      "id": "aw-watcher-window_laptop",
+      "type": "currentwindow",
+      "client": "aw-watcher-window",
+      "hostname": "laptop",
+      "events": [
+        {"timestamp": "2025-04-01T09:00:00Z", "duration": 600, "data": {"app": "Code.exe", "title": "main.go"}},
+        {"timestamp": "2025-04-01T09:10:00Z", "duration": 300, "data": {"app": "Slack.exe", "title": "#general"}}
+      ]
+    },
+    "aw-watcher-afk_laptop": {
+      "id": "aw-watcher-afk_laptop",
+      "type": "afkstatus",
+      "client": "aw-watcher-afk",
+      "hostname": "laptop",
+      "events": [
+        {"timestamp": "2025-04-01T09:04:00Z", "duration": 120, "data": {"status": "afk"}}
+      ]
+    }
+  }
+}`
+
+func TestActivityWatchRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aw-buckets-export.json")
+	if err := os.WriteFile(path, []byte(awExport), 0644); err != nil {
+		t.Fatalf("Failed to write export: %v", err)
+	}
+
+	records, err := NewActivityWatchSource(path).Records()
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+
+	// The Code.exe event is split around the AFK period
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+
+	var codeTime time.Duration
+	for _, rec := range records {
+		if rec.AppName == "Code.exe" {
+			codeTime += rec.End.Sub(rec.Start)
+		}
+	}
+	if codeTime != 8*time.Minute {
+		t.Errorf("Expected 8m of Code.exe time after AFK removal, got %v", codeTime)
+	}
+}
+
+func TestActivityImportDryRunDedupAndUndo(t *testing.T) {
+	se := setupTestStorage(t)
+
+	path := filepath.Join(t.TempDir(), "aw-buckets-export.json")
+	if err := os.WriteFile(path, []byte(awExport), 0644); err != nil {
+		t.Fatalf("Failed to write export: %v", err)
+	}
+	src := NewActivityWatchSource(path)
+	ai := NewActivityImporter(se)
+	date := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC).Local().Format("2006-01-02")
+
+	t.Run("Dry run writes nothing", func(t *testing.T) {
+		stats, err := ai.Run(src, ImportOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("Dry run failed: %v", err)
+		}
+		if stats.BlocksCreated != 3 || stats.SessionsCreated != 1 {
+			t.Errorf("Unexpected dry-run stats: %+v", stats)
+		}
+		if _, err := se.GetSession(date); !storage.IsNotFound(err) {
+			t.Errorf("Dry run should not create a session, got %v", err)
+		}
+	})
+
+	var importID int64
+	t.Run("Import creates sessions and blocks", func(t *testing.T) {
+		stats, err := ai.Run(src, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if stats.BlocksCreated != 3 || stats.SessionsCreated != 1 || stats.ImportID == 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		importID = stats.ImportID
+
+		blocks, err := se.GetActivityBlocks(date, "Code.exe")
+		if err != nil {
+			t.Fatalf("Failed to get blocks: %v", err)
+		}
+		if len(blocks) != 2 {
+			t.Errorf("Expected 2 Code.exe blocks, got %d", len(blocks))
+		}
+		if blocks[0].CaptureSource != "import_activitywatch" || blocks[0].MicroSummary != "main.go" {
+			t.Errorf("Unexpected block: %+v", blocks[0])
+		}
+	})
+
+	t.Run("Re-import skips duplicates", func(t *testing.T) {
+		stats, err := ai.Run(src, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Re-import failed: %v", err)
+		}
+		if stats.BlocksCreated != 0 || stats.Duplicates != 3 {
+			t.Errorf("Expected all duplicates, got %+v", stats)
+		}
+	})
+
+	t.Run("Undo removes the import", func(t *testing.T) {
+		result, err := ai.Undo(importID)
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if result.BlocksDeleted != 3 || len(result.SessionsDeleted) != 1 {
+			t.Errorf("Unexpected undo result: %+v", result)
+		}
+		if _, err := se.GetSession(date); !storage.IsNotFound(err) {
+			t.Errorf("Expected imported session to be removed, got %v", err)
+		}
+
+		runs, err := se.ListImports(10)
+		if err != nil {
+			t.Fatalf("Failed to list imports: %v", err)
+		}
+		for _, run := range runs {
+			if run.ID == importID && run.Status != storage.ImportStatusUndone {
+				t.Errorf("Expected import marked undone, got %q", run.Status)
+			}
+		}
+
+		if _, err := ai.Undo(importID); !storage.IsConflict(err) {
+			t.Errorf("Expected conflict undoing twice, got %v", err)
+		}
+	})
+}
+
+func TestTabularSources(t *testing.T) {
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "export.csv")
+	csvData := "app,title,start,end,project\n" +
+		"Terminal,make test,2025-04-02T10:00:00Z,2025-04-02T10:05:00Z,waddle\n"
+	if err := os.WriteFile(csvPath, []byte(csvData), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	format, err := DetectTabularFormat(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to detect format: %v", err)
+	}
+	records, err := NewTabularSource(csvPath, format, DefaultFieldMapping()).Records()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 1 || records[0].AppName != "Terminal" || records[0].End.Sub(records[0].Start) != 5*time.Minute {
+		t.Errorf("Unexpected CSV records: %+v", records)
+	}
+	if records[0].Metadata["project"] != "waddle" {
+		t.Errorf("Expected unmapped column in metadata, got %v", records[0].Metadata)
+	}
+
+	ndjsonPath := filepath.Join(dir, "export.ndjson")
+	ndjsonData := `{"id": 7, "program": "Figma", "ts": 1743588000, "secs": 90}` + "\n"
+	if err := os.WriteFile(ndjsonPath, []byte(ndjsonData), 0644); err != nil {
+		t.Fatalf("Failed to write NDJSON: %v", err)
+	}
+
+	mapping := FieldMapping{App: "program", Start: "ts", Duration: "secs", Key: "id", TimeLayout: TimeLayoutUnix}
+	records, err = NewTabularSource(ndjsonPath, FormatNDJSON, mapping).Records()
+	if err != nil {
+		t.Fatalf("Failed to read NDJSON: %v", err)
+	}
+	if len(records) != 1 || records[0].ExternalKey != "7" || records[0].End.Sub(records[0].Start) != 90*time.Second {
+		t.Errorf("Unexpected NDJSON records: %+v", records)
+	}
+
+	if err := (FieldMapping{App: "a", Start: "s"}).Validate(); err == nil {
+		t.Error("Expected validation error without end or duration")
+	}
+}
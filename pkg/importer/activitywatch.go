@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ActivityWatch bucket types handled by the importer.
+const (
+	awTypeWindow = "currentwindow"
+	awTypeAFK    = "afkstatus"
+)
+
+// awBucket is a bucket in an ActivityWatch JSON export.
+type awBucket struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Client   string    `json:"client"`
+	Hostname string    `json:"hostname"`
+	Events   []awEvent `json:"events"`
+}
+
+// awEvent is a single ActivityWatch event.
+type awEvent struct {
+	ID        int64                  `json:"id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Duration  float64                `json:"duration"` // Seconds
+	Data      map[string]interface{} `json:"data"`
+}
+
+// span is a half-open time interval.
+type span struct {
+	start, end time.Time
+}
+
+// ActivityWatchSource reads window activity from an ActivityWatch bucket
+// export. Window events are trimmed to the time the AFK watcher on the same
+// host reported the user as present.
+type ActivityWatchSource struct {
+	path string
+}
+
+// NewActivityWatchSource creates a source for an ActivityWatch export file,
+// either the "export all buckets" format or a single-bucket export.
+func NewActivityWatchSource(path string) *ActivityWatchSource {
+	return &ActivityWatchSource{path: path}
+}
+
+// Importer returns the importer name.
+func (s *ActivityWatchSource) Importer() string { return "activitywatch" }
+
+// Source returns the export file path.
+func (s *ActivityWatchSource) Source() string { return s.path }
+
+// Records parses the export and returns window records with AFK time removed.
+func (s *ActivityWatchSource) Records() ([]ActivityRecord, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets, err := parseAWBuckets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect AFK periods per host
+	afkByHost := make(map[string][]span)
+	for _, b := range buckets {
+		if !isAWBucket(b, awTypeAFK, "aw-watcher-afk") {
+			continue
+		}
+		for _, ev := range b.Events {
+			if status, _ := ev.Data["status"].(string); status == "afk" {
+				afkByHost[b.Hostname] = append(afkByHost[b.Hostname], eventSpan(ev))
+			}
+		}
+	}
+	for host := range afkByHost {
+		sort.Slice(afkByHost[host], func(i, j int) bool {
+			return afkByHost[host][i].start.Before(afkByHost[host][j].start)
+		})
+	}
+
+	var records []ActivityRecord
+	for _, b := range buckets {
+		if !isAWBucket(b, awTypeWindow, "aw-watcher-window") {
+			continue
+		}
+		for _, ev := range b.Events {
+			app, _ := ev.Data["app"].(string)
+			title, _ := ev.Data["title"].(string)
+
+			pieces := subtractSpans(eventSpan(ev), afkByHost[b.Hostname])
+			for i, piece := range pieces {
+				records = append(records, ActivityRecord{
+					ExternalKey: fmt.Sprintf("%s/%s/%d", b.ID, ev.Timestamp.UTC().Format(time.RFC3339Nano), i),
+					AppName:     app,
+					Title:       title,
+					Start:       piece.start,
+					End:         piece.end,
+					Metadata: map[string]interface{}{
+						"bucket":   b.ID,
+						"hostname": b.Hostname,
+					},
+				})
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// parseAWBuckets accepts both {"buckets": {...}} and a bare map of buckets.
+func parseAWBuckets(data []byte) (map[string]awBucket, error) {
+	var wrapped struct {
+		Buckets map[string]awBucket `json:"buckets"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("invalid ActivityWatch export: %w", err)
+	}
+	if len(wrapped.Buckets) > 0 {
+		return fillAWBucketIDs(wrapped.Buckets), nil
+	}
+
+	var bare map[string]awBucket
+	if err := json.Unmarshal(data, &bare); err != nil {
+		return nil, fmt.Errorf("invalid ActivityWatch export: %w", err)
+	}
+	return fillAWBucketIDs(bare), nil
+}
+
+// fillAWBucketIDs defaults each bucket's ID to its map key.
+func fillAWBucketIDs(buckets map[string]awBucket) map[string]awBucket {
+	for key, b := range buckets {
+		if b.ID == "" {
+			b.ID = key
+			buckets[key] = b
+		}
+	}
+	return buckets
+}
+
+// isAWBucket matches a bucket by type, falling back to the watcher client name.
+func isAWBucket(b awBucket, bucketType, client string) bool {
+	return b.Type == bucketType || b.Client == client
+}
+
+// eventSpan returns the time interval covered by an event.
+func eventSpan(ev awEvent) span {
+	return span{
+		start: ev.Timestamp,
+		end:   ev.Timestamp.Add(time.Duration(ev.Duration * float64(time.Second))),
+	}
+}
+
+// subtractSpans removes the sorted holes from s and returns what remains.
+func subtractSpans(s span, holes []span) []span {
+	var pieces []span
+	cur := s.start
+	for _, h := range holes {
+		if !h.end.After(cur) {
+			continue
+		}
+		if !h.start.Before(s.end) {
+			break
+		}
+		if h.start.After(cur) {
+			pieces = append(pieces, span{start: cur, end: h.start})
+		}
+		cur = h.end
+	}
+	if s.end.After(cur) {
+		pieces = append(pieces, span{start: cur, end: s.end})
+	}
+	return pieces
+}
@@ -0,0 +1,285 @@
+// Package importer brings activity recorded by other local tools into Waddle's storage.
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// BrowserKind identifies the on-disk history format of a browser.
+type BrowserKind string
+
+const (
+	// BrowserChromium covers Chrome, Edge, Brave and other Chromium-family "History" databases.
+	BrowserChromium BrowserKind = "chromium"
+	// BrowserFirefox covers Firefox "places.sqlite" databases.
+	BrowserFirefox BrowserKind = "firefox"
+)
+
+// chromiumEpochOffset is the number of microseconds between 1601-01-01 (the
+// WebKit epoch used by Chromium) and the Unix epoch.
+const chromiumEpochOffset = 11644473600 * 1000 * 1000
+
+// BrowserImportResult summarizes a single browser history import run.
+type BrowserImportResult struct {
+	Browser        BrowserKind `json:"browser"`
+	Source         string      `json:"source"`
+	VisitsRead     int         `json:"visitsRead"`
+	VisitsImported int         `json:"visitsImported"`
+	Duplicates     int         `json:"duplicates"`
+	Skipped        int         `json:"skipped"` // Non-web URLs (chrome://, about:, file://)
+	LinkedToBlocks int         `json:"linkedToBlocks"`
+	HighWaterMark  int64       `json:"highWaterMark"` // Native browser timestamp of the newest imported visit
+}
+
+// BrowserHistoryImporter imports page visits from local browser history databases.
+// The database is copied before reading so a running browser's lock is never contended.
+type BrowserHistoryImporter struct {
+	storage *storage.StorageEngine
+}
+
+// NewBrowserHistoryImporter creates a new BrowserHistoryImporter.
+func NewBrowserHistoryImporter(storageEngine *storage.StorageEngine) *BrowserHistoryImporter {
+	return &BrowserHistoryImporter{
+		storage: storageEngine,
+	}
+}
+
+// DetectBrowserKind guesses the history format from the database file name.
+func DetectBrowserKind(historyPath string) (BrowserKind, error) {
+	switch strings.ToLower(filepath.Base(historyPath)) {
+	case "history":
+		return BrowserChromium, nil
+	case "places.sqlite":
+		return BrowserFirefox, nil
+	default:
+		return "", fmt.Errorf("cannot detect browser from file name %q", filepath.Base(historyPath))
+	}
+}
+
+// Import reads visits newer than the saved high-water mark for historyPath and
+// stores them in the sessions they fall on, creating sessions as needed.
+func (bi *BrowserHistoryImporter) Import(kind BrowserKind, historyPath string) (*BrowserImportResult, error) {
+	absPath, err := filepath.Abs(historyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve history path: %w", err)
+	}
+
+	source := fmt.Sprintf("browser:%s:%s", kind, absPath)
+	result := &BrowserImportResult{
+		Browser: kind,
+		Source:  source,
+	}
+
+	mark, err := bi.storage.GetImportWatermark(source)
+	if err != nil {
+		return nil, err
+	}
+	if mark != "" {
+		result.HighWaterMark, err = strconv.ParseInt(mark, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid high-water mark %q: %w", mark, err)
+		}
+	}
+
+	visits, err := readBrowserHistory(kind, absPath, result.HighWaterMark)
+	if err != nil {
+		return nil, err
+	}
+	result.VisitsRead = len(visits)
+
+	// Visits come in time order, so each session's visits are consecutive
+	// and are stored together
+	for len(visits) > 0 {
+		sessionDate := bi.storage.SessionDate(visits[0].visitedAt)
+		n := 1
+		for n < len(visits) && bi.storage.SessionDate(visits[n].visitedAt) == sessionDate {
+			n++
+		}
+		day := visits[:n]
+		visits = visits[n:]
+
+		batch := make([]*storage.BrowserVisit, 0, len(day))
+		marks := make([]int64, 0, len(day))
+		for _, v := range day {
+			if !isWebURL(v.url) {
+				result.Skipped++
+				continue
+			}
+			batch = append(batch, &storage.BrowserVisit{
+				Browser:   string(kind),
+				URL:       v.url,
+				Title:     v.title,
+				VisitedAt: v.visitedAt,
+			})
+			marks = append(marks, v.raw)
+		}
+
+		if err := bi.storeVisits(result, sessionDate, batch, marks); err != nil {
+			return result, bi.saveProgress(result, err)
+		}
+		result.HighWaterMark = day[len(day)-1].raw
+	}
+
+	return result, bi.saveProgress(result, nil)
+}
+
+// storeVisits stores one session's visits and counts them in result. On
+// error the high-water mark moves to the last visit stored.
+func (bi *BrowserHistoryImporter) storeVisits(result *BrowserImportResult, sessionDate string, batch []*storage.BrowserVisit, marks []int64) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if _, err := bi.storage.GetOrCreateSession(sessionDate); err != nil {
+		return err
+	}
+
+	handled, err := bi.storage.AddBrowserVisits(sessionDate, batch)
+	for _, visit := range batch[:handled] {
+		if visit.ID != 0 {
+			result.VisitsImported++
+			if visit.ActivityBlockID != 0 {
+				result.LinkedToBlocks++
+			}
+		} else {
+			result.Duplicates++
+		}
+	}
+	if err != nil && handled > 0 {
+		result.HighWaterMark = marks[handled-1]
+	}
+	return err
+}
+
+// saveProgress persists the high-water mark reached so far, so a failed run
+// resumes after the last visit that was stored. cause is returned unchanged
+// unless saving itself fails.
+func (bi *BrowserHistoryImporter) saveProgress(result *BrowserImportResult, cause error) error {
+	if result.HighWaterMark > 0 {
+		mark := strconv.FormatInt(result.HighWaterMark, 10)
+		if err := bi.storage.SetImportWatermark(result.Source, mark); err != nil && cause == nil {
+			return err
+		}
+	}
+	return cause
+}
+
+// browserVisitRow is a visit as read from a browser database.
+type browserVisitRow struct {
+	raw       int64 // Native timestamp, used as the high-water mark
+	url       string
+	title     string
+	visitedAt time.Time
+}
+
+// readBrowserHistory copies the history database to a temporary directory and
+// returns all visits with a native timestamp greater than since, oldest first.
+func readBrowserHistory(kind BrowserKind, historyPath string, since int64) ([]browserVisitRow, error) {
+	var query string
+	var toTime func(int64) time.Time
+
+	switch kind {
+	case BrowserChromium:
+		query = `
+			SELECT v.visit_time, u.url, COALESCE(u.title, '')
+			FROM visits v
+			JOIN urls u ON u.id = v.url
+			WHERE v.visit_time > ?
+			ORDER BY v.visit_time ASC`
+		toTime = func(us int64) time.Time { return time.UnixMicro(us - chromiumEpochOffset) }
+	case BrowserFirefox:
+		query = `
+			SELECT v.visit_date, p.url, COALESCE(p.title, '')
+			FROM moz_historyvisits v
+			JOIN moz_places p ON p.id = v.place_id
+			WHERE v.visit_date > ?
+			ORDER BY v.visit_date ASC`
+		toTime = time.UnixMicro
+	default:
+		return nil, fmt.Errorf("unsupported browser kind %q", kind)
+	}
+
+	tempDir, err := os.MkdirTemp("", "waddle_browser_import_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	copyPath := filepath.Join(tempDir, filepath.Base(historyPath))
+	if err := copyFile(historyPath, copyPath); err != nil {
+		return nil, fmt.Errorf("failed to copy history database: %w", err)
+	}
+	// Recent visits may still live in the write-ahead log
+	for _, suffix := range []string{"-wal", "-journal"} {
+		if _, err := os.Stat(historyPath + suffix); err == nil {
+			if err := copyFile(historyPath+suffix, copyPath+suffix); err != nil {
+				return nil, fmt.Errorf("failed to copy history %s: %w", suffix, err)
+			}
+		}
+	}
+
+	db, err := sql.Open("sqlite", copyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history database: %w", err)
+	}
+	defer rows.Close()
+
+	var visits []browserVisitRow
+	for rows.Next() {
+		var v browserVisitRow
+		if err := rows.Scan(&v.raw, &v.url, &v.title); err != nil {
+			return nil, fmt.Errorf("failed to scan history row: %w", err)
+		}
+		v.visitedAt = toTime(v.raw)
+		visits = append(visits, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating history rows: %w", err)
+	}
+
+	return visits, nil
+}
+
+// isWebURL reports whether a visited URL is an http(s) page worth keeping.
+func isWebURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// copyFile copies src to dst.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+
+	return dstFile.Sync()
+}
@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// setupTestStorage creates an initialized StorageEngine in a temp directory.
+func setupTestStorage(t *testing.T) *storage.StorageEngine {
+	t.Helper()
+
+	tempDir, err := os.MkdirTemp("", "importer_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	se := storage.NewStorageEngine(storage.DefaultStorageConfig(tempDir))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	t.Cleanup(func() { se.Close() })
+
+	return se
+}
+
+// createTestDB creates a SQLite database at path and runs the given statements.
+func createTestDB(t *testing.T, path string, stmts ...string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to execute %q: %v", stmt, err)
+		}
+	}
+}
+
+// chromiumTime converts a time to Chromium's microseconds-since-1601 format.
+func chromiumTime(t time.Time) int64 {
+	return t.UnixMicro() + chromiumEpochOffset
+}
+
+func TestChromiumHistoryImport(t *testing.T) {
+	se := setupTestStorage(t)
+
+	visitTime := time.Date(2025, 3, 10, 14, 30, 0, 0, time.Local)
+	date := visitTime.Format("2006-01-02")
+
+	// Pre-existing browser block covering the first visit
+	if _, err := se.CreateSession(date); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	block := &storage.ActivityBlock{
+		BlockID:   "14-30",
+		StartTime: visitTime.Add(-time.Minute),
+		EndTime:   visitTime.Add(time.Minute),
+	}
+	if err := se.AddActivityBlock(date, "chrome.exe", block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	historyPath := filepath.Join(t.TempDir(), "History")
+	createTestDB(t, historyPath,
+		`CREATE TABLE urls (id INTEGER PRIMARY KEY, url TEXT, title TEXT)`,
+		`CREATE TABLE visits (id INTEGER PRIMARY KEY, url INTEGER, visit_time INTEGER)`,
+		`INSERT INTO urls VALUES (1, 'https://go.dev/doc', 'Go Docs'), (2, 'chrome://settings', 'Settings')`,
+	)
+	db, _ := sql.Open("sqlite", historyPath)
+	db.Exec(`INSERT INTO visits (url, visit_time) VALUES (1, ?), (2, ?)`,
+		chromiumTime(visitTime), chromiumTime(visitTime.Add(10*time.Second)))
+	db.Close()
+
+	kind, err := DetectBrowserKind(historyPath)
+	if err != nil || kind != BrowserChromium {
+		t.Fatalf("Expected chromium kind, got %q (%v)", kind, err)
+	}
+
+	bi := NewBrowserHistoryImporter(se)
+
+	t.Run("First import stores web visits and links blocks", func(t *testing.T) {
+		result, err := bi.Import(kind, historyPath)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.VisitsRead != 2 || result.VisitsImported != 1 || result.Skipped != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if result.LinkedToBlocks != 1 {
+			t.Errorf("Expected visit linked to block, got %d", result.LinkedToBlocks)
+		}
+
+		visits, err := se.GetBrowserVisits(date)
+		if err != nil {
+			t.Fatalf("Failed to get visits: %v", err)
+		}
+		if len(visits) != 1 {
+			t.Fatalf("Expected 1 visit, got %d", len(visits))
+		}
+		if visits[0].URL != "https://go.dev/doc" || visits[0].Title != "Go Docs" {
+			t.Errorf("Unexpected visit: %+v", visits[0])
+		}
+		if visits[0].ActivityBlockID != block.ID {
+			t.Errorf("Expected block %d, got %d", block.ID, visits[0].ActivityBlockID)
+		}
+		if !visits[0].VisitedAt.Equal(visitTime) {
+			t.Errorf("Expected visit time %v, got %v", visitTime, visits[0].VisitedAt)
+		}
+	})
+
+	t.Run("Re-import only reads visits after the high-water mark", func(t *testing.T) {
+		result, err := bi.Import(kind, historyPath)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.VisitsRead != 0 {
+			t.Errorf("Expected no new visits, got %d", result.VisitsRead)
+		}
+
+		db, _ := sql.Open("sqlite", historyPath)
+		db.Exec(`INSERT INTO visits (url, visit_time) VALUES (1, ?)`, chromiumTime(visitTime.Add(time.Hour)))
+		db.Close()
+
+		result, err = bi.Import(kind, historyPath)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.VisitsRead != 1 || result.VisitsImported != 1 {
+			t.Errorf("Expected 1 new visit, got %+v", result)
+		}
+	})
+}
+
+func TestFirefoxHistoryImport(t *testing.T) {
+	se := setupTestStorage(t)
+
+	visitTime := time.Date(2025, 3, 11, 9, 0, 0, 0, time.Local)
+	historyPath := filepath.Join(t.TempDir(), "places.sqlite")
+	createTestDB(t, historyPath,
+		`CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url TEXT, title TEXT)`,
+		`CREATE TABLE moz_historyvisits (id INTEGER PRIMARY KEY, place_id INTEGER, visit_date INTEGER)`,
+		`INSERT INTO moz_places VALUES (1, 'https://example.com/', NULL)`,
+	)
+	db, _ := sql.Open("sqlite", historyPath)
+	db.Exec(`INSERT INTO moz_historyvisits (place_id, visit_date) VALUES (1, ?)`, visitTime.UnixMicro())
+	db.Close()
+
+	result, err := NewBrowserHistoryImporter(se).Import(BrowserFirefox, historyPath)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.VisitsImported != 1 || result.LinkedToBlocks != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// Session is created on demand for the visit's day
+	visits, err := se.GetBrowserVisits(visitTime.Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("Failed to get visits: %v", err)
+	}
+	if len(visits) != 1 || visits[0].Browser != string(BrowserFirefox) {
+		t.Errorf("Unexpected visits: %+v", visits)
+	}
+}
+
+func TestDetectBrowserKindUnknown(t *testing.T) {
+	if _, err := DetectBrowserKind("/tmp/Cookies"); err == nil {
+		t.Error("Expected error for unknown history file")
+	}
+}
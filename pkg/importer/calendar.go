@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// DefaultCalendarLookback is how far back meetings are imported from a calendar.
+const DefaultCalendarLookback = 90 * 24 * time.Hour
+
+// CalendarImportResult summarizes the import of one iCalendar file.
+type CalendarImportResult struct {
+	Source      string `json:"source"`
+	EventsRead  int    `json:"eventsRead"`
+	Occurrences int    `json:"occurrences"` // Meetings in the import window after recurrence expansion
+	Inserted    int    `json:"inserted"`
+	Updated     int    `json:"updated"`
+	Removed     int    `json:"removed"`
+}
+
+// CalendarImporter imports meetings from iCalendar (.ics) files. Only
+// meetings that have already started are stored; re-importing a file
+// updates moved meetings and removes cancelled ones.
+type CalendarImporter struct {
+	storage  *storage.StorageEngine
+	lookback time.Duration
+	now      func() time.Time
+}
+
+// NewCalendarImporter creates a new CalendarImporter.
+func NewCalendarImporter(storageEngine *storage.StorageEngine) *CalendarImporter {
+	return &CalendarImporter{
+		storage:  storageEngine,
+		lookback: DefaultCalendarLookback,
+		now:      time.Now,
+	}
+}
+
+// Import imports an .ics file, or every .ics file below a directory.
+func (ci *CalendarImporter) Import(path string) ([]*CalendarImportResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat calendar path: %w", err)
+	}
+
+	if !info.IsDir() {
+		result, err := ci.ImportFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*CalendarImportResult{result}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".ics") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan calendar directory: %w", err)
+	}
+
+	results := make([]*CalendarImportResult, 0, len(files))
+	for _, f := range files {
+		result, err := ci.ImportFile(f)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", f, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ImportFile parses an .ics file, expands recurring events and syncs the
+// meetings that started within the lookback window up to now.
+func (ci *CalendarImporter) ImportFile(path string) (*CalendarImportResult, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve calendar path: %w", err)
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cal, err := parseICS(f)
+	if err != nil {
+		return nil, err
+	}
+
+	to := ci.now()
+	from := to.Add(-ci.lookback)
+
+	occurrences, err := cal.occurrences(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	meetings := make([]storage.Meeting, 0, len(occurrences))
+	for _, occ := range occurrences {
+		ev := occ.event
+		meetings = append(meetings, storage.Meeting{
+			UID:          ev.uid,
+			RecurrenceID: occ.recurrenceID,
+			Title:        ev.summary,
+			Location:     ev.location,
+			Organizer:    ev.organizer,
+			Attendees:    ev.attendees,
+			StartTime:    occ.start,
+			EndTime:      occ.end,
+			AllDay:       ev.allDay,
+			TimeZone:     ev.tzid,
+		})
+	}
+
+	sync, err := ci.storage.SyncMeetings(absPath, meetings, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CalendarImportResult{
+		Source:      absPath,
+		EventsRead:  len(cal.events),
+		Occurrences: len(meetings),
+		Inserted:    sync.Inserted,
+		Updated:     sync.Updated,
+		Removed:     sync.Removed,
+	}, nil
+}
@@ -0,0 +1,244 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+func TestRRuleExpansion(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load zone: %v", err)
+	}
+
+	t.Run("Weekly keeps wall-clock time across DST", func(t *testing.T) {
+		rule, err := parseRRule("FREQ=WEEKLY;BYDAY=TU,TH;COUNT=6")
+		if err != nil {
+			t.Fatalf("Failed to parse rule: %v", err)
+		}
+		// 2025-03-04 is a Tuesday; DST starts on 2025-03-09 in New York
+		dtstart := time.Date(2025, 3, 4, 9, 30, 0, 0, ny)
+		got := rule.expand(dtstart, dtstart.AddDate(1, 0, 0))
+
+		if len(got) != 6 {
+			t.Fatalf("Expected 6 occurrences, got %d", len(got))
+		}
+		wantDays := []int{4, 6, 11, 13, 18, 20}
+		for i, occ := range got {
+			if occ.Day() != wantDays[i] || occ.Hour() != 9 || occ.Minute() != 30 {
+				t.Errorf("Occurrence %d = %v, want March %d 09:30", i, occ, wantDays[i])
+			}
+		}
+		if got[0].UTC().Hour() == got[2].UTC().Hour() {
+			t.Error("Expected the UTC hour to shift after the DST change")
+		}
+	})
+
+	t.Run("Monthly nth and last weekday", func(t *testing.T) {
+		rule, err := parseRRule("FREQ=MONTHLY;BYDAY=2MO,-1FR;UNTIL=20250430T235959Z")
+		if err != nil {
+			t.Fatalf("Failed to parse rule: %v", err)
+		}
+		dtstart := time.Date(2025, 1, 13, 14, 0, 0, 0, time.UTC)
+		got := rule.expand(dtstart, dtstart.AddDate(1, 0, 0))
+
+		want := []string{"2025-01-13", "2025-01-31", "2025-02-10", "2025-02-28", "2025-03-10", "2025-03-28", "2025-04-14", "2025-04-25"}
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d occurrences, got %v", len(want), got)
+		}
+		for i, occ := range got {
+			if occ.Format("2006-01-02") != want[i] {
+				t.Errorf("Occurrence %d = %s, want %s", i, occ.Format("2006-01-02"), want[i])
+			}
+		}
+	})
+
+	t.Run("Open-ended rule stops at window end", func(t *testing.T) {
+		rule, err := parseRRule("FREQ=DAILY;INTERVAL=2")
+		if err != nil {
+			t.Fatalf("Failed to parse rule: %v", err)
+		}
+		dtstart := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+		got := rule.expand(dtstart, time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC))
+		if len(got) != 5 {
+			t.Errorf("Expected 5 occurrences, got %d", len(got))
+		}
+	})
+
+	if _, err := parseRRule("FREQ=HOURLY"); err == nil {
+		t.Error("Expected unsupported frequency to be rejected")
+	}
+}
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"SUMMARY:Team standup\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20250407T100000\r\n" +
+	"DTEND;TZID=W. Europe Standard Time:20250407T101500\r\n" +
+	"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=5\r\n" +
+	"EXDATE;TZID=W. Europe Standard Time:20250409T100000\r\n" +
+	"ORGANIZER;CN=Ana:mailto:ana@example.com\r\n" +
+	"ATTENDEE;CN=\"Lee, Sam\";PARTSTAT=ACCEPTED:mailto:sam@example.com\r\n" +
+	"ATTENDEE:mailto:kim@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"RECURRENCE-ID;TZID=W. Europe Standard Time:20250408T100000\r\n" +
+	"SUMMARY:Team standup (moved)\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20250408T113000\r\n" +
+	"DTEND;TZID=W. Europe Standard Time:20250408T114500\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"RECURRENCE-ID;TZID=W. Europe Standard Time:20250410T100000\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20250410T100000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review@example.com\r\n" +
+	"SUMMARY:Design review for the new\r\n" +
+	"  importer\\, part 1\r\n" +
+	"DTSTART:20250407T130000Z\r\n" +
+	"DURATION:PT1H\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	cal, err := parseICS(strings.NewReader(testCalendar))
+	if err != nil {
+		t.Fatalf("Failed to parse calendar: %v", err)
+	}
+	if len(cal.events) != 4 {
+		t.Fatalf("Expected 4 events, got %d", len(cal.events))
+	}
+
+	standup := cal.events[0]
+	if standup.tzid != "Europe/Berlin" {
+		t.Errorf("Expected Windows zone mapped to Europe/Berlin, got %q", standup.tzid)
+	}
+	if standup.organizer != "Ana" || len(standup.attendees) != 2 || standup.attendees[0] != "Lee, Sam" || standup.attendees[1] != "kim@example.com" {
+		t.Errorf("Unexpected people: organizer=%q attendees=%v", standup.organizer, standup.attendees)
+	}
+	if cal.events[3].summary != "Design review for the new importer, part 1" {
+		t.Errorf("Unexpected unfolded summary: %q", cal.events[3].summary)
+	}
+
+	from := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	occurrences, err := cal.occurrences(from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("Failed to expand occurrences: %v", err)
+	}
+
+	// Standup: Mon, Tue (moved), Fri; Wed excluded and Thu cancelled; plus the review
+	var titles []string
+	for _, occ := range occurrences {
+		titles = append(titles, occ.event.summary+"@"+occ.start.UTC().Format("01-02T15:04"))
+	}
+	want := []string{
+		"Team standup@04-07T08:00",
+		"Design review for the new importer, part 1@04-07T13:00",
+		"Team standup (moved)@04-08T09:30",
+		"Team standup@04-11T08:00",
+	}
+	if strings.Join(titles, "|") != strings.Join(want, "|") {
+		t.Errorf("Unexpected occurrences:\n got %v\nwant %v", titles, want)
+	}
+}
+
+func TestCalendarImport(t *testing.T) {
+	se := setupTestStorage(t)
+	ci := NewCalendarImporter(se)
+	ci.now = func() time.Time { return time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC) }
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "work.ics")
+	if err := os.WriteFile(path, []byte(testCalendar), 0644); err != nil {
+		t.Fatalf("Failed to write calendar: %v", err)
+	}
+
+	review := time.Date(2025, 4, 7, 13, 0, 0, 0, time.UTC)
+	date := review.Local().Format("2006-01-02")
+
+	// A block captured during the design review
+	if _, err := se.CreateSession(date); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	block := &storage.ActivityBlock{
+		BlockID:      review.Local().Format("15-04"),
+		StartTime:    review.Add(10 * time.Minute),
+		EndTime:      review.Add(20 * time.Minute),
+		MicroSummary: "Figma: importer flow",
+	}
+	if err := se.AddActivityBlock(date, "Figma", block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	results, err := ci.Import(dir)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Inserted != 4 || results[0].EventsRead != 4 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	t.Run("Meetings are filed under sessions", func(t *testing.T) {
+		meetings, err := se.GetMeetings(date)
+		if err != nil {
+			t.Fatalf("Failed to get meetings: %v", err)
+		}
+		var found bool
+		for _, m := range meetings {
+			if m.UID == "review@example.com" {
+				found = m.EndTime.Sub(m.StartTime) == time.Hour
+			}
+		}
+		if !found {
+			t.Errorf("Expected one-hour review meeting on %s, got %+v", date, meetings)
+		}
+	})
+
+	t.Run("What happened during a meeting", func(t *testing.T) {
+		matches, err := se.FindMeetings("design review", 10)
+		if err != nil || len(matches) != 1 {
+			t.Fatalf("Expected to find the review, got %v (%v)", matches, err)
+		}
+
+		activity, err := se.GetMeetingActivity(int64(matches[0].ID))
+		if err != nil {
+			t.Fatalf("Failed to get meeting activity: %v", err)
+		}
+		if len(activity.Blocks) != 1 || activity.Blocks[0].AppName != "Figma" || activity.Blocks[0].SessionDate != date {
+			t.Errorf("Unexpected meeting blocks: %+v", activity.Blocks)
+		}
+	})
+
+	t.Run("Re-import is idempotent and drops cancelled meetings", func(t *testing.T) {
+		results, err := ci.Import(path)
+		if err != nil {
+			t.Fatalf("Re-import failed: %v", err)
+		}
+		if results[0].Inserted != 0 || results[0].Updated != 0 || results[0].Removed != 0 {
+			t.Errorf("Expected no changes, got %+v", results[0])
+		}
+
+		trimmed := strings.Replace(testCalendar, "COUNT=5", "COUNT=1", 1)
+		if err := os.WriteFile(path, []byte(trimmed), 0644); err != nil {
+			t.Fatalf("Failed to rewrite calendar: %v", err)
+		}
+		results, err = ci.Import(path)
+		if err != nil {
+			t.Fatalf("Re-import failed: %v", err)
+		}
+		// The moved Tuesday override survives on its own; Friday's occurrence is gone
+		if results[0].Removed != 1 {
+			t.Errorf("Expected one removed occurrence, got %+v", results[0])
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// gitLogFormat separates fields with US and commits with RS so subjects and
+// bodies can contain anything but those control characters.
+const gitLogFormat = "%H%x1f%aI%x1f%an%x1f%ae%x1f%D%x1f%s%x1f%b%x1e"
+
+// DefaultGitLookback is how far back the first scan of a repository reaches.
+const DefaultGitLookback = 30 * 24 * time.Hour
+
+// gitRescanOverlap is subtracted from the previous scan time, because commit
+// dates lag behind when commits become visible (rebases, fetched branches).
+const gitRescanOverlap = 24 * time.Hour
+
+// GitCommitSource reads commits by the given authors from a local repository
+// using the git command line. Commits on every branch are included.
+type GitCommitSource struct {
+	repo    string
+	authors []string
+	since   time.Time
+}
+
+// NewGitCommitSource creates a source for commits in repo made after since
+// by any of authors (matched by git against name or email). With no
+// authors the repository's configured user.email is used.
+func NewGitCommitSource(repo string, authors []string, since time.Time) *GitCommitSource {
+	return &GitCommitSource{
+		repo:    repo,
+		authors: authors,
+		since:   since,
+	}
+}
+
+// Importer returns the importer name. Commit SHAs are the dedup keys.
+func (s *GitCommitSource) Importer() string { return "git" }
+
+// Source returns the repository path.
+func (s *GitCommitSource) Source() string { return s.repo }
+
+// Records runs git log and returns one record per commit.
+func (s *GitCommitSource) Records() ([]ActivityRecord, error) {
+	authors := s.authors
+	if len(authors) == 0 {
+		email, err := runGit(s.repo, "config", "user.email")
+		if err != nil || strings.TrimSpace(email) == "" {
+			return nil, fmt.Errorf("no git author configured for %s", s.repo)
+		}
+		authors = []string{strings.TrimSpace(email)}
+	}
+
+	args := []string{"log", "--all", "--no-merges", "--format=" + gitLogFormat}
+	if !s.since.IsZero() {
+		args = append(args, "--since="+s.since.Format(time.RFC3339))
+	}
+	for _, author := range authors {
+		args = append(args, "--author="+author)
+	}
+
+	out, err := runGit(s.repo, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	repoName := filepath.Base(s.repo)
+	var records []ActivityRecord
+	for _, raw := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(raw, "\n"), "\x1f")
+		if len(fields) != 7 {
+			continue
+		}
+		sha, date, name, email, refs, subject, body := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], strings.TrimSpace(fields[6])
+
+		at, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date on commit %s: %w", sha, err)
+		}
+
+		subject = RedactSecrets(subject)
+		message := subject
+		if body != "" {
+			message += "\n\n" + RedactSecrets(body)
+		}
+
+		metadata := map[string]interface{}{
+			"type":    "git_commit",
+			"repo":    s.repo,
+			"sha":     sha,
+			"message": message,
+			"author":  fmt.Sprintf("%s <%s>", name, email),
+		}
+		if refs != "" {
+			metadata["refs"] = refs
+		}
+
+		records = append(records, ActivityRecord{
+			ExternalKey: sha,
+			AppName:     "git",
+			Title:       truncateSummary(subject),
+			Start:       at,
+			End:         at.Add(pointEventDuration),
+			Metadata:    metadata,
+			Text:        fmt.Sprintf("Committed %s to %s: %s", shortSHA(sha), repoName, message),
+		})
+	}
+
+	return records, nil
+}
+
+// runGit runs a git subcommand in repo and returns its standard output.
+func runGit(repo string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// shortSHA abbreviates a commit hash for display.
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// GitCommitImporter scans local repositories for the user's commits.
+type GitCommitImporter struct {
+	storage  *storage.StorageEngine
+	activity *ActivityImporter
+	exclude  []TimeWindow // Spans whose activity is never imported, such as incognito periods
+	authors  []string
+}
+
+// NewGitCommitImporter creates a new GitCommitImporter matching commits by
+// authors, or by each repository's user.email when authors is empty.
+func NewGitCommitImporter(storageEngine *storage.StorageEngine, authors []string) *GitCommitImporter {
+	return &GitCommitImporter{
+		storage:  storageEngine,
+		activity: NewActivityImporter(storageEngine),
+		authors:  authors,
+	}
+}
+
+// Import imports commits made since the previous scan of repo, or within
+// DefaultGitLookback on the first scan.
+func (gi *GitCommitImporter) Import(repo string) (*ImportStats, error) {
+	absRepo, err := filepath.Abs(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+
+	key := "git:" + absRepo
+	scanStarted := time.Now()
+
+	since := scanStarted.Add(-DefaultGitLookback)
+	mark, err := gi.storage.GetImportWatermark(key)
+	if err != nil {
+		return nil, err
+	}
+	if mark != "" {
+		last, err := time.Parse(time.RFC3339, mark)
+		if err != nil {
+			return nil, fmt.Errorf("invalid git watermark %q: %w", mark, err)
+		}
+		since = last.Add(-gitRescanOverlap)
+	}
+
+	stats, err := gi.activity.Run(NewGitCommitSource(absRepo, gi.authors, since), ImportOptions{Exclude: gi.exclude})
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, gi.storage.SetImportWatermark(key, scanStarted.UTC().Format(time.RFC3339))
+}
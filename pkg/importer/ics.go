@@ -0,0 +1,541 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embedded zone data so TZIDs resolve on machines without a tz database (Windows)
+	_ "time/tzdata"
+)
+
+// icsProperty is a single content line of an iCalendar component.
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// icsEvent is a VEVENT with the properties the meeting importer uses.
+type icsEvent struct {
+	uid          string
+	summary      string
+	location     string
+	organizer    string
+	attendees    []string
+	start        time.Time
+	end          time.Time
+	duration     time.Duration // From DURATION when DTEND is absent
+	hasEnd       bool
+	allDay       bool
+	tzid         string // IANA zone of DTSTART, empty for UTC or floating times
+	rrule        string
+	rdates       []time.Time
+	exdates      []time.Time
+	recurrenceID time.Time // Set on overrides of a single occurrence
+	cancelled    bool
+}
+
+// icsCalendar is a parsed iCalendar file.
+type icsCalendar struct {
+	events []icsEvent
+	zones  map[string]*time.Location // Custom VTIMEZONE definitions by TZID
+}
+
+// windowsZones maps Windows time zone names, which Outlook and Exchange use
+// as TZIDs, to IANA zones.
+var windowsZones = map[string]string{
+	"Dateline Standard Time":         "Etc/GMT+12",
+	"Hawaiian Standard Time":         "Pacific/Honolulu",
+	"Alaskan Standard Time":          "America/Anchorage",
+	"Pacific Standard Time":          "America/Los_Angeles",
+	"Mountain Standard Time":         "America/Denver",
+	"US Mountain Standard Time":      "America/Phoenix",
+	"Central Standard Time":          "America/Chicago",
+	"Eastern Standard Time":          "America/New_York",
+	"Atlantic Standard Time":         "America/Halifax",
+	"E. South America Standard Time": "America/Sao_Paulo",
+	"UTC":                            "UTC",
+	"GMT Standard Time":              "Europe/London",
+	"W. Europe Standard Time":        "Europe/Berlin",
+	"Romance Standard Time":          "Europe/Paris",
+	"Central Europe Standard Time":   "Europe/Budapest",
+	"Central European Standard Time": "Europe/Warsaw",
+	"E. Europe Standard Time":        "Europe/Chisinau",
+	"FLE Standard Time":              "Europe/Kiev",
+	"GTB Standard Time":              "Europe/Bucharest",
+	"Russian Standard Time":          "Europe/Moscow",
+	"Israel Standard Time":           "Asia/Jerusalem",
+	"Arabian Standard Time":          "Asia/Dubai",
+	"India Standard Time":            "Asia/Kolkata",
+	"China Standard Time":            "Asia/Shanghai",
+	"Singapore Standard Time":        "Asia/Singapore",
+	"Tokyo Standard Time":            "Asia/Tokyo",
+	"Korea Standard Time":            "Asia/Seoul",
+	"AUS Eastern Standard Time":      "Australia/Sydney",
+	"New Zealand Standard Time":      "Pacific/Auckland",
+}
+
+var icsDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICS parses the VEVENTs of an iCalendar stream.
+func parseICS(r io.Reader) (*icsCalendar, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &icsCalendar{zones: make(map[string]*time.Location)}
+
+	var stack []string
+	var props []icsProperty
+	var tzProps []icsProperty
+	sawCalendar := false
+
+	for _, line := range unfoldICS(string(data)) {
+		if line == "" {
+			continue
+		}
+		prop, err := parseContentLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.value)
+			stack = append(stack, component)
+			switch component {
+			case "VCALENDAR":
+				sawCalendar = true
+			case "VEVENT":
+				props = nil
+			case "VTIMEZONE":
+				tzProps = nil
+			}
+			continue
+		case "END":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected END:%s", prop.value)
+			}
+			component := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch component {
+			case "VEVENT":
+				ev, err := cal.buildEvent(props)
+				if err != nil {
+					return nil, err
+				}
+				cal.events = append(cal.events, ev)
+			case "VTIMEZONE":
+				if tzid, loc := zoneFromVTimezone(tzProps); tzid != "" && loc != nil {
+					cal.zones[tzid] = loc
+				}
+			}
+			continue
+		}
+
+		if len(stack) == 0 {
+			continue
+		}
+		switch stack[len(stack)-1] {
+		case "VEVENT":
+			props = append(props, prop)
+		case "VTIMEZONE", "STANDARD":
+			// DAYLIGHT rules are ignored; see zoneFromVTimezone
+			tzProps = append(tzProps, prop)
+		}
+	}
+
+	if !sawCalendar {
+		return nil, fmt.Errorf("not an iCalendar file: missing BEGIN:VCALENDAR")
+	}
+
+	return cal, nil
+}
+
+// unfoldICS splits data into logical lines, joining folded continuation lines.
+func unfoldICS(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+
+	var lines []string
+	for _, raw := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(raw, " ") || strings.HasPrefix(raw, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += raw[1:]
+			continue
+		}
+		lines = append(lines, raw)
+	}
+	return lines
+}
+
+// parseContentLine splits "NAME;PARAM=value;PARAM=\"quoted\":value".
+func parseContentLine(line string) (icsProperty, error) {
+	prop := icsProperty{params: make(map[string]string)}
+
+	// Find the first colon outside quoted parameter values
+	inQuotes := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch {
+		case line[i] == '"':
+			inQuotes = !inQuotes
+		case line[i] == ':' && !inQuotes:
+			colon = i
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("malformed iCalendar line %q", line)
+	}
+
+	head := line[:colon]
+	prop.value = line[colon+1:]
+
+	parts := splitOutsideQuotes(head, ';')
+	prop.name = strings.ToUpper(parts[0])
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		prop.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return prop, nil
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside double quotes.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeICSText reverses TEXT value escaping.
+func unescapeICSText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// buildEvent converts the properties of a VEVENT into an icsEvent.
+func (cal *icsCalendar) buildEvent(props []icsProperty) (icsEvent, error) {
+	var ev icsEvent
+	for _, p := range props {
+		var err error
+		switch p.name {
+		case "UID":
+			ev.uid = p.value
+		case "SUMMARY":
+			ev.summary = unescapeICSText(p.value)
+		case "LOCATION":
+			ev.location = unescapeICSText(p.value)
+		case "ORGANIZER":
+			ev.organizer = calAddressName(p)
+		case "ATTENDEE":
+			if name := calAddressName(p); name != "" {
+				ev.attendees = append(ev.attendees, name)
+			}
+		case "STATUS":
+			ev.cancelled = strings.EqualFold(p.value, "CANCELLED")
+		case "DTSTART":
+			ev.start, ev.allDay, ev.tzid, err = cal.parseDateTime(p)
+		case "DTEND":
+			ev.end, _, _, err = cal.parseDateTime(p)
+			ev.hasEnd = true
+		case "DURATION":
+			ev.duration, err = parseICSDuration(p.value)
+		case "RRULE":
+			ev.rrule = p.value
+		case "RDATE", "EXDATE":
+			var times []time.Time
+			times, err = cal.parseDateTimeList(p)
+			if p.name == "RDATE" {
+				ev.rdates = append(ev.rdates, times...)
+			} else {
+				ev.exdates = append(ev.exdates, times...)
+			}
+		case "RECURRENCE-ID":
+			ev.recurrenceID, _, _, err = cal.parseDateTime(p)
+		}
+		if err != nil {
+			return ev, fmt.Errorf("event %q: invalid %s: %w", ev.uid, p.name, err)
+		}
+	}
+
+	if ev.uid == "" {
+		return ev, fmt.Errorf("event %q has no UID", ev.summary)
+	}
+	if ev.start.IsZero() {
+		return ev, fmt.Errorf("event %q has no DTSTART", ev.uid)
+	}
+
+	return ev, nil
+}
+
+// calAddressName returns the display name of an ORGANIZER or ATTENDEE,
+// falling back to the e-mail address.
+func calAddressName(p icsProperty) string {
+	if cn := strings.TrimSpace(p.params["CN"]); cn != "" {
+		return cn
+	}
+	value := p.value
+	if strings.HasPrefix(strings.ToLower(value), "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	return strings.TrimSpace(value)
+}
+
+// parseDateTime parses a DATE or DATE-TIME value honoring TZID. All-day
+// dates and floating times are interpreted in the local zone.
+func (cal *icsCalendar) parseDateTime(p icsProperty) (time.Time, bool, string, error) {
+	value := strings.TrimSpace(p.value)
+	loc, tzid := cal.resolveZone(p.params["TZID"])
+
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, "", err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, "", err
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, tzid, err
+}
+
+// parseDateTimeList parses a comma-separated RDATE or EXDATE value.
+func (cal *icsCalendar) parseDateTimeList(p icsProperty) ([]time.Time, error) {
+	var times []time.Time
+	for _, v := range strings.Split(p.value, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			// PERIOD values: keep only the start
+			v, _, _ = strings.Cut(v, "/")
+		}
+		t, _, _, err := cal.parseDateTime(icsProperty{name: p.name, params: p.params, value: v})
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// resolveZone maps a TZID to a location. IANA names, Mozilla-style prefixed
+// names, Windows names and VTIMEZONE definitions are tried in that order;
+// unknown zones fall back to local time. The returned name is the IANA zone
+// when one was found.
+func (cal *icsCalendar) resolveZone(tzid string) (*time.Location, string) {
+	tzid = strings.TrimSpace(tzid)
+	if tzid == "" {
+		return time.Local, ""
+	}
+
+	candidates := []string{tzid}
+	// "/mozilla.org/20050126_1/Europe/Berlin" style prefixes
+	if parts := strings.Split(strings.Trim(tzid, "/"), "/"); len(parts) > 2 {
+		candidates = append(candidates, strings.Join(parts[len(parts)-2:], "/"))
+	}
+	if iana, ok := windowsZones[tzid]; ok {
+		candidates = append(candidates, iana)
+	}
+
+	for _, name := range candidates {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, loc.String()
+		}
+	}
+
+	if loc, ok := cal.zones[tzid]; ok {
+		return loc, ""
+	}
+
+	return time.Local, ""
+}
+
+// zoneFromVTimezone builds a location for a custom VTIMEZONE. An
+// X-LIC-LOCATION naming an IANA zone is used when present; otherwise the
+// standard-time offset gives a fixed zone, which ignores daylight saving.
+func zoneFromVTimezone(props []icsProperty) (string, *time.Location) {
+	var tzid, licLocation, offset string
+	for _, p := range props {
+		switch p.name {
+		case "TZID":
+			tzid = p.value
+		case "X-LIC-LOCATION":
+			licLocation = p.value
+		case "TZOFFSETTO":
+			offset = p.value
+		}
+	}
+
+	if licLocation != "" {
+		if loc, err := time.LoadLocation(licLocation); err == nil {
+			return tzid, loc
+		}
+	}
+
+	if len(offset) == 5 || len(offset) == 7 {
+		sign := 1
+		if offset[0] == '-' {
+			sign = -1
+		}
+		h, errH := strconv.Atoi(offset[1:3])
+		m, errM := strconv.Atoi(offset[3:5])
+		if errH == nil && errM == nil {
+			return tzid, time.FixedZone(tzid, sign*(h*3600+m*60))
+		}
+	}
+
+	return tzid, nil
+}
+
+// parseICSDuration parses an RFC 5545 DURATION such as "PT1H30M" or "P1D".
+func parseICSDuration(value string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// icsOccurrence is one expanded instance of an event.
+type icsOccurrence struct {
+	event        *icsEvent
+	recurrenceID time.Time
+	start        time.Time
+	end          time.Time
+}
+
+// occurrences expands every event into instances starting within [from, to),
+// applying RRULE, RDATE, EXDATE and per-occurrence overrides.
+func (cal *icsCalendar) occurrences(from, to time.Time) ([]icsOccurrence, error) {
+	overrides := make(map[string][]*icsEvent)
+	for i := range cal.events {
+		ev := &cal.events[i]
+		if !ev.recurrenceID.IsZero() {
+			overrides[ev.uid] = append(overrides[ev.uid], ev)
+		}
+	}
+
+	var result []icsOccurrence
+	for i := range cal.events {
+		ev := &cal.events[i]
+		if !ev.recurrenceID.IsZero() || ev.cancelled {
+			continue
+		}
+
+		starts := []time.Time{ev.start}
+		if ev.rrule != "" {
+			rule, err := parseRRule(ev.rrule)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: %w", ev.uid, err)
+			}
+			starts = rule.expand(ev.start, to)
+		}
+		starts = append(starts, ev.rdates...)
+
+		instances := make(map[int64]icsOccurrence)
+		for _, s := range starts {
+			if containsInstant(ev.exdates, s, ev.allDay) {
+				continue
+			}
+			instances[s.Unix()] = icsOccurrence{event: ev, recurrenceID: s, start: s, end: ev.endFor(s)}
+		}
+
+		for _, ov := range overrides[ev.uid] {
+			key := ov.recurrenceID.Unix()
+			if ov.cancelled {
+				delete(instances, key)
+				continue
+			}
+			instances[key] = icsOccurrence{event: ov, recurrenceID: ov.recurrenceID, start: ov.start, end: ov.endFor(ov.start)}
+		}
+
+		for _, occ := range instances {
+			if !occ.start.Before(from) && occ.start.Before(to) {
+				result = append(result, occ)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].start.Equal(result[j].start) {
+			return result[i].event.uid < result[j].event.uid
+		}
+		return result[i].start.Before(result[j].start)
+	})
+
+	return result, nil
+}
+
+// endFor returns the end of the instance starting at start, keeping the
+// event's length. All-day events without an end last one day.
+func (ev *icsEvent) endFor(start time.Time) time.Time {
+	switch {
+	case ev.hasEnd && ev.allDay:
+		days := int(ev.end.Sub(ev.start).Round(24*time.Hour) / (24 * time.Hour))
+		return start.AddDate(0, 0, days)
+	case ev.hasEnd:
+		return start.Add(ev.end.Sub(ev.start))
+	case ev.duration > 0:
+		return start.Add(ev.duration)
+	case ev.allDay:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start
+	}
+}
+
+// containsInstant reports whether list holds t; all-day events match by date.
+func containsInstant(list []time.Time, t time.Time, allDay bool) bool {
+	for _, x := range list {
+		if x.Equal(t) {
+			return true
+		}
+		if allDay && x.Format("20060102") == t.Format("20060102") {
+			return true
+		}
+	}
+	return false
+}
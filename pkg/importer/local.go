@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// LocalSourcesConfig lists the terminal, git and calendar sources to poll.
+type LocalSourcesConfig struct {
+	ShellHistoryFiles []string      // History files to tail; detected with DefaultShellHistoryPaths when empty
+	GitRepos          []string      // Repositories to scan for commits
+	GitAuthors        []string      // Author names or emails; each repository's user.email when empty
+	CalendarPaths     []string      // .ics files or directories of them to watch
+	Interval          time.Duration // Time between polls
+}
+
+// pausedWindowsKey is the watermark key under which the worker saves the
+// windows whose activity it must never import.
+const pausedWindowsKey = "local:paused"
+
+// LocalSourcesWorker periodically imports new shell commands, git commits
+// and calendar meetings. While paused, as in incognito mode, it imports
+// nothing, and commands and commits from the paused window are skipped for
+// good once it resumes.
+type LocalSourcesWorker struct {
+	cfg      LocalSourcesConfig
+	storage  *storage.StorageEngine
+	shell    *ShellHistoryImporter
+	git      *GitCommitImporter
+	calendar *CalendarImporter
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex // Held while polling
+	pausedSince time.Time  // Zero unless paused
+	skipped     []TimeWindow
+}
+
+// NewLocalSourcesWorker creates a new LocalSourcesWorker.
+func NewLocalSourcesWorker(storageEngine *storage.StorageEngine, cfg LocalSourcesConfig) *LocalSourcesWorker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+	if len(cfg.ShellHistoryFiles) == 0 {
+		cfg.ShellHistoryFiles = DefaultShellHistoryPaths()
+	}
+
+	return &LocalSourcesWorker{
+		cfg:      cfg,
+		storage:  storageEngine,
+		shell:    NewShellHistoryImporter(storageEngine),
+		git:      NewGitCommitImporter(storageEngine, cfg.GitAuthors),
+		calendar: NewCalendarImporter(storageEngine),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start begins background polling, running a first poll immediately.
+func (w *LocalSourcesWorker) Start() error {
+	saved, err := w.storage.GetImportWatermark(pausedWindowsKey)
+	if err != nil {
+		return err
+	}
+	if saved != "" {
+		w.mu.Lock()
+		err = json.Unmarshal([]byte(saved), &w.skipped)
+		w.mu.Unlock()
+		if err != nil {
+			log.Printf("Ignoring invalid paused windows %q: %v", saved, err)
+		}
+	}
+
+	w.wg.Add(1)
+	go w.pollLoop()
+	return nil
+}
+
+// Close stops the worker gracefully. A worker closed while paused still
+// skips the paused window after a restart.
+func (w *LocalSourcesWorker) Close() error {
+	close(w.quit)
+	w.wg.Wait()
+	return w.SetPaused(false)
+}
+
+// SetPaused pauses or resumes importing. Pausing waits for a poll in
+// progress; resuming saves the paused window so its activity is skipped in
+// every later poll.
+func (w *LocalSourcesWorker) SetPaused(paused bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if paused {
+		if w.pausedSince.IsZero() {
+			w.pausedSince = time.Now()
+		}
+		return nil
+	}
+	if w.pausedSince.IsZero() {
+		return nil
+	}
+
+	w.skipped = append(w.skipped, TimeWindow{Start: w.pausedSince, End: time.Now()})
+	w.pausedSince = time.Time{}
+
+	saved, err := json.Marshal(w.skipped)
+	if err != nil {
+		return err
+	}
+	return w.storage.SetImportWatermark(pausedWindowsKey, string(saved))
+}
+
+// pollLoop runs the background polling
+func (w *LocalSourcesWorker) pollLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.PollOnce()
+
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollOnce imports from every configured source, logging failures so one
+// broken source does not block the others. It does nothing while paused.
+func (w *LocalSourcesWorker) PollOnce() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.pausedSince.IsZero() {
+		return
+	}
+	w.shell.exclude = w.skipped
+	w.git.exclude = w.skipped
+
+	for _, path := range w.cfg.ShellHistoryFiles {
+		kind, err := DetectShellKind(path)
+		if err != nil {
+			log.Printf("Shell history import skipped: %v", err)
+			continue
+		}
+		stats, err := w.shell.Import(kind, path)
+		if err != nil {
+			log.Printf("Shell history import failed for %s: %v", path, err)
+			continue
+		}
+		if stats.BlocksCreated > 0 {
+			log.Printf("Imported %d shell commands from %s", stats.BlocksCreated, path)
+		}
+	}
+
+	for _, repo := range w.cfg.GitRepos {
+		stats, err := w.git.Import(repo)
+		if err != nil {
+			log.Printf("Git commit import failed for %s: %v", repo, err)
+			continue
+		}
+		if stats.BlocksCreated > 0 {
+			log.Printf("Imported %d commits from %s", stats.BlocksCreated, repo)
+		}
+	}
+
+	for _, path := range w.cfg.CalendarPaths {
+		results, err := w.calendar.Import(path)
+		if err != nil {
+			log.Printf("Calendar import failed for %s: %v", path, err)
+		}
+		for _, result := range results {
+			if result.Inserted+result.Updated+result.Removed > 0 {
+				log.Printf("Synced meetings from %s: %d new, %d updated, %d removed",
+					result.Source, result.Inserted, result.Updated, result.Removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalSourcesWorkerPause(t *testing.T) {
+	se := setupTestStorage(t)
+
+	historyPath := filepath.Join(t.TempDir(), ".zsh_history")
+	zshLine := func(at time.Time, cmd string) string {
+		return ": " + itoa(at.Unix()) + ":0;" + cmd + "\n"
+	}
+	appendLine := func(line string) {
+		f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatalf("Failed to open history: %v", err)
+		}
+		defer f.Close()
+		f.WriteString(line)
+	}
+
+	now := time.Now()
+	dates := map[string]bool{}
+	// commands returns the imported commands
+	commands := func() string {
+		var all []string
+		for date := range dates {
+			blocks, err := se.GetActivityBlocks(date, "zsh")
+			if err != nil {
+				continue
+			}
+			for _, block := range blocks {
+				all = append(all, block.MicroSummary)
+			}
+		}
+		return strings.Join(all, "\n")
+	}
+
+	cfg := LocalSourcesConfig{ShellHistoryFiles: []string{historyPath}, Interval: time.Hour}
+	w := NewLocalSourcesWorker(se, cfg)
+	before := now.Add(-2 * time.Hour)
+	dates[se.SessionDate(before)] = true
+	appendLine(zshLine(before, "cd /src/waddle"))
+	w.PollOnce()
+	if !strings.Contains(commands(), "cd /src/waddle") {
+		t.Fatalf("Expected the first command imported, got %q", commands())
+	}
+
+	during := now.Add(-30 * time.Minute)
+	dates[se.SessionDate(during)] = true
+
+	t.Run("Nothing is imported while paused", func(t *testing.T) {
+		if err := w.SetPaused(true); err != nil {
+			t.Fatalf("Failed to pause: %v", err)
+		}
+		w.pausedSince = now.Add(-time.Hour) // Paused an hour ago
+		appendLine(zshLine(during, "ssh private-host"))
+		w.PollOnce()
+		if strings.Contains(commands(), "private-host") {
+			t.Errorf("Expected nothing imported while paused, got %q", commands())
+		}
+	})
+
+	t.Run("Commands from the paused window are skipped after resuming", func(t *testing.T) {
+		if err := w.SetPaused(false); err != nil {
+			t.Fatalf("Failed to resume: %v", err)
+		}
+		after := time.Now().Add(2 * time.Second)
+		dates[se.SessionDate(after)] = true
+		appendLine(zshLine(after, "git push"))
+		w.PollOnce()
+
+		got := commands()
+		if strings.Contains(got, "private-host") || !strings.Contains(got, "git push") {
+			t.Errorf("Expected only the command after resuming imported, got %q", got)
+		}
+	})
+
+	t.Run("The paused window is kept across restarts", func(t *testing.T) {
+		w.Close()
+
+		// A rewritten history file is read again from the start
+		if err := os.WriteFile(historyPath, []byte(zshLine(during, "ssh private-host")), 0600); err != nil {
+			t.Fatalf("Failed to rewrite history: %v", err)
+		}
+		restarted := NewLocalSourcesWorker(se, cfg)
+		if err := restarted.Start(); err != nil {
+			t.Fatalf("Failed to start worker: %v", err)
+		}
+		restarted.Close()
+
+		if strings.Contains(commands(), "private-host") {
+			t.Errorf("Expected the paused window skipped after a restart, got %q", commands())
+		}
+	})
+}
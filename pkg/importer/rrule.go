@@ -0,0 +1,322 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRRulePeriods bounds expansion of rules without COUNT or UNTIL whose
+// filters never match, so a malformed rule cannot loop forever.
+const maxRRulePeriods = 100000
+
+// rruleWeekday is a BYDAY entry such as "MO", "2TU" or "-1FR".
+type rruleWeekday struct {
+	n       int // Ordinal within the month or year; 0 means every such weekday
+	weekday time.Weekday
+}
+
+// rrule is a parsed RFC 5545 recurrence rule. BYSETPOS, BYWEEKNO,
+// BYYEARDAY and sub-daily frequencies are not supported.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	untilDate  bool // UNTIL was a DATE, so it includes that whole day
+	byDay      []rruleWeekday
+	byMonthDay []int
+	byMonth    []int
+	weekStart  time.Weekday
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule parses an RRULE value like "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+func parseRRule(value string) (*rrule, error) {
+	r := &rrule{interval: 1, weekStart: time.Monday}
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToUpper(key)
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(val)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			switch {
+			case len(val) == 8:
+				r.until, err = time.ParseInLocation("20060102", val, time.Local)
+				r.untilDate = true
+			case strings.HasSuffix(val, "Z"):
+				r.until, err = time.Parse("20060102T150405Z", val)
+			default:
+				r.until, err = time.ParseInLocation("20060102T150405", val, time.Local)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				var wd rruleWeekday
+				wd, err = parseRRuleWeekday(d)
+				if err != nil {
+					break
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseIntList(val)
+		case "BYMONTH":
+			r.byMonth, err = parseIntList(val)
+		case "WKST":
+			wd, ok := rruleWeekdays[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("unknown weekday %q", val)
+			}
+			r.weekStart = wd
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s=%s: %w", key, val, err)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.freq)
+	}
+
+	return r, nil
+}
+
+// parseRRuleWeekday parses a BYDAY entry with an optional signed ordinal.
+func parseRRuleWeekday(s string) (rruleWeekday, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return rruleWeekday{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	wd, ok := rruleWeekdays[s[len(s)-2:]]
+	if !ok {
+		return rruleWeekday{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	n := 0
+	if prefix := s[:len(s)-2]; prefix != "" {
+		var err error
+		if n, err = strconv.Atoi(prefix); err != nil {
+			return rruleWeekday{}, fmt.Errorf("invalid weekday ordinal %q", s)
+		}
+	}
+	return rruleWeekday{n: n, weekday: wd}, nil
+}
+
+// parseIntList parses a comma-separated list of integers.
+func parseIntList(s string) ([]int, error) {
+	var out []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// expand returns the occurrence starts of the rule beginning at dtstart, up
+// to (but excluding) windowEnd. Occurrences keep dtstart's wall-clock time in
+// its location, so a 09:00 meeting stays at 09:00 across DST changes.
+// dtstart itself is always the first occurrence.
+func (r *rrule) expand(dtstart, windowEnd time.Time) []time.Time {
+	occurrences := []time.Time{dtstart}
+	emitted := 1
+
+	for period := 0; period < maxRRulePeriods; period++ {
+		candidates := r.periodCandidates(dtstart, period)
+		if len(candidates) == 0 && r.periodStart(dtstart, period).After(windowEnd) {
+			break
+		}
+
+		for _, c := range candidates {
+			if !c.After(dtstart) {
+				continue
+			}
+			if r.pastUntil(c) || (r.count > 0 && emitted >= r.count) || !c.Before(windowEnd) {
+				return occurrences
+			}
+			occurrences = append(occurrences, c)
+			emitted++
+		}
+	}
+
+	return occurrences
+}
+
+// pastUntil reports whether t falls after the rule's UNTIL bound.
+func (r *rrule) pastUntil(t time.Time) bool {
+	if r.until.IsZero() {
+		return false
+	}
+	if r.untilDate {
+		return !t.Before(r.until.AddDate(0, 0, 1))
+	}
+	return t.After(r.until)
+}
+
+// periodStart returns the first day of the given period.
+func (r *rrule) periodStart(dtstart time.Time, period int) time.Time {
+	y, m, d := dtstart.Date()
+	loc := dtstart.Location()
+	switch r.freq {
+	case "DAILY":
+		return time.Date(y, m, d+period*r.interval, 0, 0, 0, 0, loc)
+	case "WEEKLY":
+		offset := (int(dtstart.Weekday()) - int(r.weekStart) + 7) % 7
+		return time.Date(y, m, d-offset+7*period*r.interval, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(period*r.interval), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y+period*r.interval, 1, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// periodCandidates returns the sorted occurrence starts within one period.
+func (r *rrule) periodCandidates(dtstart time.Time, period int) []time.Time {
+	start := r.periodStart(dtstart, period)
+	var days []time.Time
+
+	switch r.freq {
+	case "DAILY":
+		if r.matchesDay(start) {
+			days = append(days, start)
+		}
+	case "WEEKLY":
+		for i := 0; i < 7; i++ {
+			day := start.AddDate(0, 0, i)
+			if len(r.byDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesDay(day) {
+				days = append(days, day)
+			}
+		}
+	case "MONTHLY":
+		days = r.monthDays(start.Year(), start.Month(), dtstart)
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(dtstart.Month())}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(start.Year(), time.Month(m), dtstart)...)
+		}
+	}
+
+	h, mi, s := dtstart.Clock()
+	out := make([]time.Time, 0, len(days))
+	for _, day := range days {
+		out = append(out, time.Date(day.Year(), day.Month(), day.Day(), h, mi, s, dtstart.Nanosecond(), dtstart.Location()))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// monthDays returns the matching days of a month for MONTHLY and YEARLY rules.
+func (r *rrule) monthDays(year int, month time.Month, dtstart time.Time) []time.Time {
+	loc := dtstart.Location()
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	daysIn := first.AddDate(0, 1, -1).Day()
+
+	if len(r.byMonth) > 0 && !containsInt(r.byMonth, int(month)) {
+		return nil
+	}
+
+	var days []time.Time
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, md := range r.byMonthDay {
+			if md < 0 {
+				md = daysIn + md + 1
+			}
+			if md < 1 || md > daysIn {
+				continue
+			}
+			day := time.Date(year, month, md, 0, 0, 0, 0, loc)
+			if len(r.byDay) == 0 || r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			var matches []time.Time
+			for d := 1; d <= daysIn; d++ {
+				day := time.Date(year, month, d, 0, 0, 0, 0, loc)
+				if day.Weekday() == wd.weekday {
+					matches = append(matches, day)
+				}
+			}
+			switch {
+			case wd.n == 0:
+				days = append(days, matches...)
+			case wd.n > 0 && wd.n <= len(matches):
+				days = append(days, matches[wd.n-1])
+			case wd.n < 0 && -wd.n <= len(matches):
+				days = append(days, matches[len(matches)+wd.n])
+			}
+		}
+	default:
+		// Months without dtstart's day (e.g. the 31st) are skipped, per RFC 5545
+		if dtstart.Day() <= daysIn {
+			days = append(days, time.Date(year, month, dtstart.Day(), 0, 0, 0, 0, loc))
+		}
+	}
+
+	return days
+}
+
+// matchesDay applies the BYMONTH, BYMONTHDAY and BYDAY filters to a day.
+func (r *rrule) matchesDay(day time.Time) bool {
+	if len(r.byMonth) > 0 && !containsInt(r.byMonth, int(day.Month())) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 {
+		daysIn := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		if !containsInt(r.byMonthDay, day.Day()) && !containsInt(r.byMonthDay, day.Day()-daysIn-1) {
+			return false
+		}
+	}
+	return len(r.byDay) == 0 || r.matchesWeekday(day)
+}
+
+// matchesWeekday reports whether day's weekday is listed in BYDAY.
+func (r *rrule) matchesWeekday(day time.Time) bool {
+	for _, wd := range r.byDay {
+		if wd.weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether list contains n.
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,502 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"waddle/pkg/storage"
+)
+
+// ShellKind identifies the on-disk format of a shell history file.
+type ShellKind string
+
+const (
+	// ShellBash is a bash history file; timestamps are present when HISTTIMEFORMAT is set.
+	ShellBash ShellKind = "bash"
+	// ShellZsh is a zsh history file; timestamps are present with EXTENDED_HISTORY.
+	ShellZsh ShellKind = "zsh"
+	// ShellFish is a fish history file, which always records timestamps.
+	ShellFish ShellKind = "fish"
+)
+
+// pointEventDuration is the span given to instantaneous events such as a
+// shell command without a recorded duration or a git commit.
+const pointEventDuration = time.Second
+
+// maxCommandSummary caps the command length used as a block's micro summary.
+const maxCommandSummary = 200
+
+var (
+	bashTimestampLine = regexp.MustCompile(`^#(\d{9,})$`)
+	zshExtendedLine   = regexp.MustCompile(`^: (\d+):(\d+);(.*)$`)
+)
+
+// DefaultShellHistoryPaths returns the history files of the current user
+// that exist on disk.
+func DefaultShellHistoryPaths() []string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	candidates := []string{
+		filepath.Join(homeDir, ".bash_history"),
+		filepath.Join(homeDir, ".zsh_history"),
+		filepath.Join(homeDir, ".local", "share", "fish", "fish_history"),
+	}
+	if histFile := os.Getenv("HISTFILE"); histFile != "" {
+		candidates = append(candidates, histFile)
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range candidates {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// DetectShellKind guesses the history format from the file name.
+func DetectShellKind(historyPath string) (ShellKind, error) {
+	name := strings.ToLower(filepath.Base(historyPath))
+	switch {
+	case strings.Contains(name, "fish"):
+		return ShellFish, nil
+	case strings.Contains(name, "zsh") || name == ".zhistory":
+		return ShellZsh, nil
+	case strings.Contains(name, "bash") || name == ".history":
+		return ShellBash, nil
+	default:
+		return "", fmt.Errorf("cannot detect shell from file name %q", filepath.Base(historyPath))
+	}
+}
+
+// shellEntry is one command parsed from a history file.
+type shellEntry struct {
+	command  string
+	at       time.Time     // Zero when the history has no timestamps
+	duration time.Duration // Elapsed time, recorded only by zsh extended history
+	offset   int64         // Byte offset where the entry starts
+	end      int64         // Byte offset just past the entry
+}
+
+// shellWatermark is the tail position saved between imports of a history file.
+type shellWatermark struct {
+	Offset int64  `json:"offset"`
+	Cwd    string `json:"cwd,omitempty"` // Working directory inferred from cd commands so far
+}
+
+// ShellHistorySource reads the commands appended to a history file since a
+// byte offset. Commands are redacted with RedactSecrets before they leave
+// the source; the working directory is inferred by following cd commands.
+type ShellHistorySource struct {
+	path   string
+	kind   ShellKind
+	offset int64
+	cwd    string
+
+	next shellWatermark // Position after the last complete entry, set by Records
+}
+
+// NewShellHistorySource creates a source that reads historyPath from offset,
+// starting with cwd as the known working directory (empty if unknown).
+func NewShellHistorySource(historyPath string, kind ShellKind, offset int64, cwd string) *ShellHistorySource {
+	return &ShellHistorySource{
+		path:   historyPath,
+		kind:   kind,
+		offset: offset,
+		cwd:    cwd,
+	}
+}
+
+// Importer returns the importer name.
+func (s *ShellHistorySource) Importer() string { return "shell_history" }
+
+// Source returns the history file path.
+func (s *ShellHistorySource) Source() string { return s.path }
+
+// Records parses complete entries after the start offset. Entries without a
+// timestamp are dated with the file's modification time, which is when
+// they were appended at the latest.
+func (s *ShellHistorySource) Records() ([]ActivityRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []shellEntry
+	switch s.kind {
+	case ShellBash:
+		entries = parseBashHistory(data, s.offset)
+	case ShellZsh:
+		entries = parseZshHistory(data, s.offset)
+	case ShellFish:
+		entries = parseFishHistory(data, s.offset)
+	default:
+		return nil, fmt.Errorf("unsupported shell kind %q", s.kind)
+	}
+
+	s.next = shellWatermark{Offset: s.offset, Cwd: s.cwd}
+	absPath, _ := filepath.Abs(s.path)
+
+	records := make([]ActivityRecord, 0, len(entries))
+	seen := make(map[string]int)
+	for _, e := range entries {
+		s.next.Offset = e.end
+
+		cwd := s.next.Cwd
+		s.next.Cwd = followCd(cwd, e.command)
+
+		if e.command == "" || strings.HasPrefix(e.command, " ") {
+			// Leading-space commands are the user's way of keeping them out of history
+			continue
+		}
+
+		at := e.at
+		if at.IsZero() {
+			at = info.ModTime()
+		}
+		duration := e.duration
+		if duration <= 0 {
+			duration = pointEventDuration
+		}
+
+		command := RedactSecrets(e.command)
+
+		// Identify timestamped entries by content so rewritten history files
+		// (zsh deduplication, fish merges) do not re-import old commands
+		var identity string
+		if e.at.IsZero() {
+			identity = fmt.Sprintf("%s\x00@%d", absPath, e.offset)
+		} else {
+			identity = fmt.Sprintf("%s\x00%d\x00%s", absPath, e.at.Unix(), e.command)
+		}
+		seen[identity]++
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", identity, seen[identity])))
+
+		metadata := map[string]interface{}{
+			"type":    "shell_command",
+			"shell":   string(s.kind),
+			"command": command,
+			"history": absPath,
+		}
+		if cwd != "" {
+			metadata["cwd"] = cwd
+		}
+		if e.at.IsZero() {
+			metadata["timeApproximate"] = true
+		}
+
+		text := "$ " + command
+		if cwd != "" {
+			text = cwd + " " + text
+		}
+
+		records = append(records, ActivityRecord{
+			ExternalKey: hex.EncodeToString(hash[:]),
+			AppName:     string(s.kind),
+			Title:       truncateSummary(command),
+			Start:       at,
+			End:         at.Add(duration),
+			Metadata:    metadata,
+			Text:        text,
+		})
+	}
+
+	return records, nil
+}
+
+// parseBashHistory parses bash history. With HISTTIMEFORMAT set, each
+// command is preceded by a "#<epoch>" line; otherwise lines are bare commands.
+// In that format a line without its own timestamp continues the previous
+// multi-line command. A timestamp line with no command after it yet is left
+// for the next read.
+func parseBashHistory(data []byte, base int64) []shellEntry {
+	var entries []shellEntry
+	var pending time.Time
+	pendingOffset := int64(-1)
+
+	forEachLine(data, func(line string, start, end int64) {
+		if m := bashTimestampLine.FindStringSubmatch(line); m != nil {
+			sec, _ := strconv.ParseInt(m[1], 10, 64)
+			pending = time.Unix(sec, 0)
+			pendingOffset = start
+			return
+		}
+		if pendingOffset < 0 && len(entries) > 0 && !entries[len(entries)-1].at.IsZero() {
+			last := &entries[len(entries)-1]
+			last.command += "\n" + line
+			last.end = end
+			return
+		}
+		e := shellEntry{command: line, at: pending, offset: start, end: end}
+		if pendingOffset >= 0 {
+			e.offset = pendingOffset
+		}
+		entries = append(entries, e)
+		pending = time.Time{}
+		pendingOffset = -1
+	})
+
+	return offsetEntries(entries, base)
+}
+
+// parseZshHistory parses zsh history in both the plain and the extended
+// ": <epoch>:<elapsed>;<command>" formats. Multi-line commands are stored
+// with a trailing backslash on every line but the last.
+func parseZshHistory(data []byte, base int64) []shellEntry {
+	var entries []shellEntry
+	var cur *shellEntry
+
+	forEachLine(data, func(line string, start, end int64) {
+		if cur == nil {
+			cur = &shellEntry{offset: start}
+			if m := zshExtendedLine.FindStringSubmatch(line); m != nil {
+				sec, _ := strconv.ParseInt(m[1], 10, 64)
+				elapsed, _ := strconv.ParseInt(m[2], 10, 64)
+				cur.at = time.Unix(sec, 0)
+				cur.duration = time.Duration(elapsed) * time.Second
+				line = m[3]
+			}
+		} else {
+			cur.command += "\n"
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			cur.command += strings.TrimSuffix(line, "\\")
+			return
+		}
+
+		cur.command += line
+		cur.end = end
+		entries = append(entries, *cur)
+		cur = nil
+	})
+
+	return offsetEntries(entries, base)
+}
+
+// parseFishHistory parses fish's YAML-like history:
+//
+//   - cmd: git status
+//     when: 1712000000
+//     paths:
+//   - src
+func parseFishHistory(data []byte, base int64) []shellEntry {
+	var entries []shellEntry
+	var cur *shellEntry
+
+	forEachLine(data, func(line string, start, end int64) {
+		switch {
+		case strings.HasPrefix(line, "- cmd: "):
+			if cur != nil {
+				entries = append(entries, *cur)
+			}
+			cur = &shellEntry{command: unescapeFish(strings.TrimPrefix(line, "- cmd: ")), offset: start, end: end}
+		case cur == nil:
+			return
+		case strings.HasPrefix(line, "  when: "):
+			sec, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "  when: ")), 10, 64)
+			if err == nil {
+				cur.at = time.Unix(sec, 0)
+			}
+			cur.end = end
+		default:
+			cur.end = end
+		}
+	})
+	if cur != nil {
+		entries = append(entries, *cur)
+	}
+
+	return offsetEntries(entries, base)
+}
+
+// unescapeFish reverses fish's escaping of newlines and backslashes in commands.
+func unescapeFish(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// forEachLine calls fn for every newline-terminated line in data with its
+// byte range; an unterminated final line is still being written and skipped.
+func forEachLine(data []byte, fn func(line string, start, end int64)) {
+	var pos int64
+	for {
+		idx := bytes.IndexByte(data[pos:], '\n')
+		if idx < 0 {
+			return
+		}
+		line := strings.TrimSuffix(string(data[pos:pos+int64(idx)]), "\r")
+		if !utf8.ValidString(line) {
+			line = strings.ToValidUTF8(line, "?")
+		}
+		fn(line, pos, pos+int64(idx)+1)
+		pos += int64(idx) + 1
+	}
+}
+
+// offsetEntries shifts entry offsets from buffer-relative to file-relative.
+func offsetEntries(entries []shellEntry, base int64) []shellEntry {
+	for i := range entries {
+		entries[i].offset += base
+		entries[i].end += base
+	}
+	return entries
+}
+
+// followCd returns the working directory after command runs in cwd. Only
+// plain "cd" invocations are understood; anything ambiguous resets to unknown.
+func followCd(cwd, command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || (fields[0] != "cd" && fields[0] != "pushd") {
+		return cwd
+	}
+	if len(fields) > 2 || strings.ContainsAny(command, ";&|$`") {
+		return ""
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	if len(fields) == 1 {
+		return homeDir
+	}
+
+	target := strings.Trim(fields[1], `"'`)
+	switch {
+	case target == "-":
+		return ""
+	case target == "~":
+		return homeDir
+	case strings.HasPrefix(target, "~/"):
+		if homeDir == "" {
+			return ""
+		}
+		return filepath.Join(homeDir, target[2:])
+	case filepath.IsAbs(target) || strings.HasPrefix(target, "/"):
+		return filepath.Clean(target)
+	case cwd != "":
+		return filepath.Join(cwd, target)
+	default:
+		return ""
+	}
+}
+
+// truncateSummary shortens long commands for use as a micro summary.
+func truncateSummary(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if utf8.RuneCountInString(s) <= maxCommandSummary {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxCommandSummary-1]) + "…"
+}
+
+// ShellHistoryImporter tails shell history files, importing the commands
+// appended since the previous run as activity blocks.
+type ShellHistoryImporter struct {
+	storage  *storage.StorageEngine
+	activity *ActivityImporter
+	exclude  []TimeWindow // Spans whose activity is never imported, such as incognito periods
+}
+
+// NewShellHistoryImporter creates a new ShellHistoryImporter.
+func NewShellHistoryImporter(storageEngine *storage.StorageEngine) *ShellHistoryImporter {
+	return &ShellHistoryImporter{
+		storage:  storageEngine,
+		activity: NewActivityImporter(storageEngine),
+	}
+}
+
+// Import reads the commands added to historyPath since the saved tail
+// position. A file that shrank was truncated or rewritten and is re-read
+// from the start; already imported commands are skipped as duplicates.
+func (si *ShellHistoryImporter) Import(kind ShellKind, historyPath string) (*ImportStats, error) {
+	absPath, err := filepath.Abs(historyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve history path: %w", err)
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat history file: %w", err)
+	}
+
+	key := fmt.Sprintf("shell:%s:%s", kind, absPath)
+	var mark shellWatermark
+	saved, err := si.storage.GetImportWatermark(key)
+	if err != nil {
+		return nil, err
+	}
+	if saved != "" {
+		if err := json.Unmarshal([]byte(saved), &mark); err != nil {
+			return nil, fmt.Errorf("invalid shell history watermark %q: %w", saved, err)
+		}
+	}
+	if mark.Offset > info.Size() {
+		mark = shellWatermark{}
+	}
+
+	src := NewShellHistorySource(absPath, kind, mark.Offset, mark.Cwd)
+	stats, err := si.activity.Run(src, ImportOptions{Exclude: si.exclude})
+	if err != nil {
+		return stats, err
+	}
+
+	if src.next != mark {
+		next, err := json.Marshal(src.next)
+		if err != nil {
+			return stats, fmt.Errorf("failed to marshal shell history watermark: %w", err)
+		}
+		if err := si.storage.SetImportWatermark(key, string(next)); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,273 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TabularFormat identifies a generic activity export format.
+type TabularFormat string
+
+const (
+	// FormatCSV is a comma-separated file with a header row.
+	FormatCSV TabularFormat = "csv"
+	// FormatNDJSON is newline-delimited JSON, one object per line.
+	FormatNDJSON TabularFormat = "ndjson"
+)
+
+// Time layouts accepted by FieldMapping.TimeLayout besides Go layouts.
+const (
+	TimeLayoutUnix   = "unix"   // Seconds since the Unix epoch
+	TimeLayoutUnixMs = "unixms" // Milliseconds since the Unix epoch
+)
+
+// FieldMapping names the CSV columns or NDJSON keys that hold each record
+// field. Either End or Duration (in seconds) must be set.
+type FieldMapping struct {
+	App        string `json:"app"`
+	Title      string `json:"title"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Duration   string `json:"duration"`
+	Key        string `json:"key"`        // Optional stable row ID for dedup
+	TimeLayout string `json:"timeLayout"` // Go layout, "unix" or "unixms"; default RFC3339
+}
+
+// DefaultFieldMapping returns a mapping for exports using the common
+// app/title/start/end column names with RFC3339 timestamps.
+func DefaultFieldMapping() FieldMapping {
+	return FieldMapping{
+		App:        "app",
+		Title:      "title",
+		Start:      "start",
+		End:        "end",
+		TimeLayout: time.RFC3339,
+	}
+}
+
+// Validate checks that the mapping names the required fields.
+func (m FieldMapping) Validate() error {
+	if m.App == "" || m.Start == "" {
+		return fmt.Errorf("field mapping requires app and start fields")
+	}
+	if m.End == "" && m.Duration == "" {
+		return fmt.Errorf("field mapping requires an end or duration field")
+	}
+	return nil
+}
+
+// TabularSource reads activity records from a CSV or NDJSON file using a FieldMapping.
+type TabularSource struct {
+	path    string
+	format  TabularFormat
+	mapping FieldMapping
+}
+
+// NewTabularSource creates a source for a generic CSV or NDJSON export.
+func NewTabularSource(path string, format TabularFormat, mapping FieldMapping) *TabularSource {
+	return &TabularSource{
+		path:    path,
+		format:  format,
+		mapping: mapping,
+	}
+}
+
+// DetectTabularFormat guesses the format from the file extension.
+func DetectTabularFormat(path string) (TabularFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("cannot detect export format from extension %q", filepath.Ext(path))
+	}
+}
+
+// Importer returns the importer name, which scopes dedup keys by format.
+func (s *TabularSource) Importer() string { return "generic_" + string(s.format) }
+
+// Source returns the export file path.
+func (s *TabularSource) Source() string { return s.path }
+
+// Records parses every row of the file into an ActivityRecord.
+func (s *TabularSource) Records() ([]ActivityRecord, error) {
+	if err := s.mapping.Validate(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []map[string]string
+	switch s.format {
+	case FormatCSV:
+		rows, err = readCSVRows(f)
+	case FormatNDJSON:
+		rows, err = readNDJSONRows(f)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", s.format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]ActivityRecord, 0, len(rows))
+	for i, row := range rows {
+		rec, err := s.mapRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// mapRow converts a row into a record; unmapped fields become metadata.
+func (s *TabularSource) mapRow(row map[string]string) (ActivityRecord, error) {
+	m := s.mapping
+	rec := ActivityRecord{
+		AppName:  row[m.App],
+		Title:    row[m.Title],
+		Metadata: make(map[string]interface{}),
+	}
+
+	var err error
+	rec.Start, err = parseTime(row[m.Start], m.TimeLayout)
+	if err != nil {
+		return rec, fmt.Errorf("invalid start time: %w", err)
+	}
+
+	if m.End != "" && row[m.End] != "" {
+		rec.End, err = parseTime(row[m.End], m.TimeLayout)
+		if err != nil {
+			return rec, fmt.Errorf("invalid end time: %w", err)
+		}
+	} else if m.Duration != "" {
+		seconds, err := strconv.ParseFloat(row[m.Duration], 64)
+		if err != nil {
+			return rec, fmt.Errorf("invalid duration: %w", err)
+		}
+		rec.End = rec.Start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	if m.Key != "" {
+		rec.ExternalKey = row[m.Key]
+	}
+
+	mapped := map[string]bool{m.App: true, m.Title: true, m.Start: true, m.End: true, m.Duration: true, m.Key: true}
+	for k, v := range row {
+		if !mapped[k] {
+			rec.Metadata[k] = v
+		}
+	}
+
+	return rec, nil
+}
+
+// parseTime parses a timestamp using a Go layout or one of the Unix layouts.
+func parseTime(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch layout {
+	case TimeLayoutUnix, TimeLayoutUnixMs:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == TimeLayoutUnixMs {
+			return time.UnixMilli(int64(n)), nil
+		}
+		return time.Unix(0, int64(n*float64(time.Second))), nil
+	case "":
+		layout = time.RFC3339
+	}
+	return time.Parse(layout, value)
+}
+
+// readCSVRows reads a CSV file with a header row into column maps.
+func readCSVRows(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	var rows []map[string]string
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row: %w", err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(fields) {
+				row[name] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readNDJSONRows reads one JSON object per line, stringifying scalar values.
+func readNDJSONRows(r io.Reader) ([]map[string]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var rows []map[string]string
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON: %w", line, err)
+		}
+
+		row := make(map[string]string, len(obj))
+		for k, v := range obj {
+			switch val := v.(type) {
+			case string:
+				row[k] = val
+			case nil:
+				row[k] = ""
+			default:
+				row[k] = fmt.Sprint(val)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+
+	return rows, nil
+}
@@ -4,16 +4,44 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"waddle/pkg/types"
 )
 
 type Config struct {
 	DataDir           string
-	RetentionDays     int
-	BackupHour        int
+	RetentionDays     int    // 0 uses the storage default of 365 days
+	BackupTime        string // Local "HH:MM" of the nightly backup
 	EmbeddingModel    string
 	OCRBatchSize      int
 	SynthesisInterval time.Duration
 	Port              string
+	SessionIdleGap    time.Duration // Idle time that starts a new work session within a day
+	TimeZone          string        // IANA zone for session dates; empty means the system zone
+	DayRolloverHour   int           // Hour a new session day starts, so late-night work counts toward the previous day
+
+	// Edit history of sessions and knowledge cards; 0 disables a limit
+	RevisionRetentionDays int
+	MaxRevisionsPerEntity int
+
+	// Per-app and per-tag retention overrides, first match wins; e.g. keep
+	// Slack for 30 days, never delete tagged sessions, or drop screenshots
+	// after 7 days while keeping their text
+	RetentionRules []types.RetentionRule
+
+	// Screenshot storage tiers by age; empty uses the storage defaults
+	ScreenshotTiers []types.ScreenshotTier
+
+	// Cron schedule overrides for maintenance jobs by name: backup, retention,
+	// vacuum and notifications
+	JobSchedules map[string]string
+
+	// Terminal, git and calendar activity sources
+	ShellHistoryFiles    []string // Empty means detect the user's bash/zsh/fish history
+	GitRepos             []string
+	GitAuthors           []string // Empty means each repository's user.email
+	CalendarPaths        []string // .ics files or directories of them
+	LocalSourcesInterval time.Duration
 }
 
 func DefaultConfig() Config {
@@ -22,11 +50,16 @@ func DefaultConfig() Config {
 
 	return Config{
 		DataDir:           dataDir,
-		RetentionDays:     30,
-		BackupHour:        2,
+		BackupTime:        "02:00",
 		EmbeddingModel:    "nomic-embed-text",
 		OCRBatchSize:      10,
 		SynthesisInterval: 1 * time.Hour,
 		Port:              "8080",
+		SessionIdleGap:    30 * time.Minute,
+
+		RevisionRetentionDays: 180,
+		MaxRevisionsPerEntity: 50,
+
+		LocalSourcesInterval: 5 * time.Minute,
 	}
 }
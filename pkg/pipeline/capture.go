@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"waddle/pkg/capture"
+	"waddle/pkg/storage"
 )
 
 // CaptureSource indicates where the activity data came from
@@ -40,12 +41,14 @@ type PipelineStats struct {
 	DroppedEvents      int64  `json:"droppedEvents"`
 	ActivityBufferSize int    `json:"activityBufferSize"`
 	OCRBufferSize      int    `json:"ocrBufferSize"`
+	Incognito          bool   `json:"incognito"`
 }
 
 // Pipeline orchestrates the hybrid capture pipeline: Sensing → Processing → Storage
 type Pipeline struct {
 	engine         capture.CaptureEngine
-	storage        interface{} // Storage engine interface
+	storage        storage.StorageEngineInterface
+	incognito      *storage.MemoryStorageEngine // Replaces storage while in incognito mode
 	ctx            context.Context
 	cancel         context.CancelFunc
 	router         *EventRouter
@@ -56,7 +59,7 @@ type Pipeline struct {
 }
 
 // NewPipeline creates a new hybrid capture pipeline.
-func NewPipeline(storage interface{}, engine capture.CaptureEngine) (*Pipeline, error) {
+func NewPipeline(store storage.StorageEngineInterface, engine capture.CaptureEngine) (*Pipeline, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if engine == nil {
@@ -73,7 +76,7 @@ func NewPipeline(storage interface{}, engine capture.CaptureEngine) (*Pipeline,
 
 	p := &Pipeline{
 		engine:         engine,
-		storage:        storage,
+		storage:        store,
 		ctx:            ctx,
 		cancel:         cancel,
 		router:         router,
@@ -109,9 +112,11 @@ func (p *Pipeline) Start() error {
 	return nil
 }
 
-// Stop stops the capture pipeline and cleans up resources
+// Stop stops the capture pipeline and cleans up resources. Anything
+// captured in incognito mode is discarded.
 func (p *Pipeline) Stop() error {
 	p.mu.Lock()
+	p.discardIncognito()
 	if !p.running {
 		p.mu.Unlock()
 		return nil
@@ -146,6 +151,61 @@ func (p *Pipeline) IsRunning() bool {
 	return p.running
 }
 
+// SetIncognito turns incognito mode on or off. While it is on, captured
+// data goes to an in-memory store that nothing writes to disk, and turning
+// it off discards everything in that store.
+func (p *Pipeline) SetIncognito(on bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !on {
+		p.discardIncognito()
+		return nil
+	}
+	if p.incognito != nil {
+		return nil
+	}
+
+	// Sessions keep the dates the persistent store would give them
+	var config *storage.StorageConfig
+	if c, ok := p.storage.(interface{ Config() *storage.StorageConfig }); ok {
+		config = c.Config()
+	}
+	store := storage.NewMemoryStorageEngine(config)
+	if err := store.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize incognito storage: %w", err)
+	}
+	p.incognito = store
+	return nil
+}
+
+// discardIncognito leaves incognito mode, dropping its store. The caller
+// must hold the lock.
+func (p *Pipeline) discardIncognito() {
+	if p.incognito != nil {
+		p.incognito.Close()
+		p.incognito = nil
+	}
+}
+
+// IsIncognito returns true if the pipeline is in incognito mode.
+func (p *Pipeline) IsIncognito() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.incognito != nil
+}
+
+// Storage returns the store captured data goes to: the in-memory store in
+// incognito mode, otherwise the persistent one.
+func (p *Pipeline) Storage() storage.StorageEngineInterface {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.incognito != nil {
+		return p.incognito
+	}
+	return p.storage
+}
+
 // GetPipelineStats returns pipeline statistics.
 func (p *Pipeline) GetPipelineStats() PipelineStats {
 	running := p.IsRunning()
@@ -173,6 +233,7 @@ func (p *Pipeline) GetPipelineStats() PipelineStats {
 		DroppedEvents:      dropped,
 		ActivityBufferSize: 0, // Migrated to channels in processor
 		OCRBufferSize:      0, // Will be reintegrated with storage layer
+		Incognito:          p.IsIncognito(),
 	}
 }
 
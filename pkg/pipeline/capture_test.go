@@ -112,4 +112,35 @@ func TestCaptureSourceTypes(t *testing.T) {
 			t.Errorf("CaptureSource %d should be %q, got %q", i, expectedValues[i], string(source))
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestPipelineIncognito tests that incognito mode swaps in an in-memory
+// store and discards it when turned off
+func TestPipelineIncognito(t *testing.T) {
+	p := newTestPipeline(t)
+	defer p.Stop()
+
+	if p.IsIncognito() || p.Storage() != nil {
+		t.Fatalf("Pipeline should start with the persistent store")
+	}
+	if err := p.SetIncognito(true); err != nil {
+		t.Fatalf("Failed to turn incognito on: %v", err)
+	}
+	store := p.Storage()
+	if store == nil || !p.GetPipelineStats().Incognito {
+		t.Fatalf("Pipeline should use an in-memory store in incognito mode")
+	}
+	if _, err := store.CreateSession("2025-03-01"); err != nil {
+		t.Fatalf("Failed to create incognito session: %v", err)
+	}
+
+	if err := p.SetIncognito(false); err != nil {
+		t.Fatalf("Failed to turn incognito off: %v", err)
+	}
+	if p.IsIncognito() || p.Storage() != nil {
+		t.Errorf("Pipeline should return to the persistent store")
+	}
+	if _, total, _ := store.ListSessions(1, 10); total != 0 {
+		t.Errorf("Incognito sessions should be discarded, got %d", total)
+	}
+}
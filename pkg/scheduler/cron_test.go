@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2025, 1, 30, 10, 7, 30, 0, time.Local) // A Thursday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 1, 30, 10, 15, 0, 0, time.Local)},
+		{"0 2 * * *", time.Date(2025, 1, 31, 2, 0, 0, 0, time.Local)},
+		{"30 9-17/4 * * *", time.Date(2025, 1, 30, 13, 30, 0, 0, time.Local)},
+		{"0 0 * * 0", time.Date(2025, 2, 2, 0, 0, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2025, 2, 2, 0, 0, 0, 0, time.Local)},
+		{"0 0 1,15 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.Local)},
+		// Day of month and day of week both restricted: either matches
+		{"0 12 15 * 5", time.Date(2025, 1, 31, 12, 0, 0, 0, time.Local)},
+		{"@monthly", time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2025, 1, 30, 11, 0, 0, 0, time.Local)},
+		{"@every 90m", time.Date(2025, 1, 30, 11, 37, 30, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: next run %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every 10s", "@yearly"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("Expected ParseSchedule(%q) to fail", expr)
+		}
+	}
+}
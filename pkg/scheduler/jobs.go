@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// MaintenanceConfig configures the built-in maintenance jobs.
+type MaintenanceConfig struct {
+	NotificationMaxAge time.Duration     // Age after which notifications are deleted. Default: 30 days
+	Schedules          map[string]string // Schedule overrides by job name
+}
+
+// MaintenanceJobs returns the backup, retention, vacuum and notification
+// cleanup jobs. The backup runs daily at the storage config's BackupTime
+// unless its schedule is overridden.
+func MaintenanceJobs(se *storage.StorageEngine, cfg MaintenanceConfig) ([]Job, error) {
+	if cfg.NotificationMaxAge <= 0 {
+		cfg.NotificationMaxAge = 30 * 24 * time.Hour
+	}
+	backup := cfg.Schedules["backup"]
+	if backup == "" {
+		var err error
+		if backup, err = dailySchedule(se.Config().BackupTime); err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := []Job{
+		{
+			Name:        "backup",
+			Description: "Snapshot the database, vectors and files, then prune old snapshots",
+			Schedule:    backup,
+			Jitter:      15 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				if err := se.Backup(); err != nil {
+					return "", err
+				}
+				if err := se.CleanupOldBackups(); err != nil {
+					return "snapshot created", err
+				}
+				return "snapshot created", nil
+			},
+		},
+		{
+			Name:        "retention",
+			Description: "Delete or archive sessions past the retention period and prune edit history",
+			Schedule:    "30 3 * * *",
+			Jitter:      15 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				result, err := se.ApplyRetentionPolicy()
+				if err != nil {
+					return "", err
+				}
+				message := fmt.Sprintf("%d sessions deleted, %d archived, %d revisions pruned",
+					result.SessionsDeleted, result.SessionsArchived, result.RevisionsPruned)
+				if len(result.Errors) > 0 {
+					return message, fmt.Errorf("%s", strings.Join(result.Errors, "; "))
+				}
+				return message, nil
+			},
+		},
+		{
+			Name:        "vacuum",
+			Description: "Rebuild the database file to reclaim free space",
+			Schedule:    "0 4 * * 0",
+			Jitter:      15 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				return "", se.Vacuum()
+			},
+		},
+		{
+			Name:        "notifications",
+			Description: "Delete old notifications",
+			Schedule:    "0 5 * * *",
+			Jitter:      15 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				count, err := se.DeleteOldNotifications(cfg.NotificationMaxAge)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d notifications deleted", count), nil
+			},
+		},
+	}
+
+	for i := range jobs {
+		if schedule, ok := cfg.Schedules[jobs[i].Name]; ok && schedule != "" {
+			jobs[i].Schedule = schedule
+		}
+	}
+	return jobs, nil
+}
+
+// dailySchedule returns the schedule of a job run daily at a local "HH:MM"
+// time.
+func dailySchedule(at string) (string, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return "", storage.NewStorageError(storage.ErrValidation, fmt.Sprintf("invalid time %q, expected HH:MM", at), err)
+	}
+	return fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour()), nil
+}
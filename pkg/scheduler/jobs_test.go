@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+
+	"waddle/pkg/storage"
+)
+
+// TestMaintenanceJobs tests scheduling the backup at the configured
+// BackupTime unless its schedule is overridden.
+func TestMaintenanceJobs(t *testing.T) {
+	backupSchedule := func(jobs []Job) string {
+		for _, job := range jobs {
+			if job.Name == "backup" {
+				return job.Schedule
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name       string
+		backupTime string
+		overrides  map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{"Default time", "02:00", nil, "0 2 * * *", false},
+		{"Hour and minute", "02:30", nil, "30 2 * * *", false},
+		{"Override wins", "02:30", map[string]string{"backup": "15 23 * * *"}, "15 23 * * *", false},
+		{"Override skips an invalid time", "late", map[string]string{"backup": "0 1 * * *"}, "0 1 * * *", false},
+		{"Invalid time", "2:30pm", nil, "", true},
+		{"Out of range", "24:00", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := storage.DefaultStorageConfig(t.TempDir())
+			config.BackupTime = tt.backupTime
+			jobs, err := MaintenanceJobs(storage.NewStorageEngine(config), MaintenanceConfig{Schedules: tt.overrides})
+			if tt.wantErr {
+				if !storage.IsValidation(err) {
+					t.Errorf("Expected a validation error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to build jobs: %v", err)
+			}
+			if got := backupSchedule(jobs); got != tt.want {
+				t.Errorf("Expected backup schedule %q, got %q", tt.want, got)
+			}
+			if _, err := ParseSchedule(backupSchedule(jobs)); err != nil {
+				t.Errorf("Expected a valid schedule: %v", err)
+			}
+		})
+	}
+}
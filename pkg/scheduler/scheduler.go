@@ -0,0 +1,356 @@
+// Package scheduler runs maintenance jobs such as backups and retention on
+// cron-style schedules, persisting when each job last and next runs.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+const (
+	// DefaultTick is how often the scheduler checks for due jobs.
+	DefaultTick = 30 * time.Second
+	// runHistoryLimit is the number of runs kept per job.
+	runHistoryLimit = 50
+)
+
+// ErrSchedulerClosed is returned when starting a job after Close.
+var ErrSchedulerClosed = storage.NewStorageError(storage.ErrConflict, "scheduler is closed", nil)
+
+// Job is a task run on a schedule.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string        // Cron expression or descriptor, see ParseSchedule
+	Jitter      time.Duration // Upper bound of a random delay added to each scheduled run
+	// Run does the work and returns a short summary of what it did.
+	Run func(ctx context.Context) (string, error)
+}
+
+// JobStatus is the current state of a registered job.
+type JobStatus struct {
+	storage.JobState
+	Description string `json:"description"`
+	Running     bool   `json:"running"`
+}
+
+type scheduledJob struct {
+	job      Job
+	schedule Schedule
+	nextRun  time.Time
+}
+
+// Scheduler runs registered jobs when they are due. A job runs at most
+// once at a time, runs missed while the machine was off or asleep are
+// caught up with a single run, and every run is recorded in storage.
+type Scheduler struct {
+	storage *storage.StorageEngine
+	tick    time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	jobs    []*scheduledJob
+	byName  map[string]*scheduledJob
+	running map[string]bool
+	paused  bool
+	closed  bool
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	quit      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New creates a scheduler that records job state in storageEngine.
+func New(storageEngine *storage.StorageEngine) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		storage: storageEngine,
+		tick:    DefaultTick,
+		now:     time.Now,
+		byName:  make(map[string]*scheduledJob),
+		running: make(map[string]bool),
+		ctx:     ctx,
+		cancel:  cancel,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return storage.NewStorageError(storage.ErrValidation, "job needs a name and a run function", nil)
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return storage.NewStorageError(storage.ErrValidation, fmt.Sprintf("job %s", job.Name), err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.byName[job.Name]; exists {
+		return storage.NewStorageError(storage.ErrConflict, "job "+job.Name+" is already registered", nil)
+	}
+	sj := &scheduledJob{job: job, schedule: schedule}
+	s.jobs = append(s.jobs, sj)
+	s.byName[job.Name] = sj
+	return nil
+}
+
+// Start restores each job's next run from storage and begins running jobs
+// in the background. A job whose schedule changed is rescheduled.
+func (s *Scheduler) Start() error {
+	if n, err := s.storage.FailInterruptedJobRuns(); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted job runs as failed", n)
+	}
+
+	states, err := s.storage.GetJobStates()
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]storage.JobState, len(states))
+	for _, state := range states {
+		saved[state.Name] = state
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSchedulerClosed
+	}
+	for _, sj := range s.jobs {
+		if state, ok := saved[sj.job.Name]; ok && state.Schedule == sj.job.Schedule && !state.NextRunAt.IsZero() {
+			sj.nextRun = state.NextRunAt
+		} else {
+			sj.nextRun = s.nextRunAfter(sj, now)
+		}
+		if err := s.storage.SaveJobSchedule(sj.job.Name, sj.job.Schedule, sj.nextRun); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go s.loop()
+	return nil
+}
+
+// Close stops scheduling and waits for running jobs, whose context is
+// cancelled, to return. Jobs can't be started once Close is called, and
+// calling it again only waits.
+func (s *Scheduler) Close() error {
+	s.closeOnce.Do(func() {
+		// Once closed is set under mu no goroutine is added to wg, so
+		// waiting on it can't race with starting a job
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.quit)
+		s.cancel()
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// loop checks for due jobs on every tick.
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		s.runDue()
+
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetPaused pauses or resumes scheduled runs, as in incognito mode. Runs
+// missed while paused are caught up once on resuming; RunNow still works.
+func (s *Scheduler) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// runDue starts every job whose next run has passed and schedules its
+// following run. However many runs were missed, a job runs once.
+func (s *Scheduler) runDue() {
+	now := s.now()
+
+	s.mu.Lock()
+	if s.paused {
+		s.mu.Unlock()
+		return
+	}
+	var due []*scheduledJob
+	var triggers []storage.JobTrigger
+	for _, sj := range s.jobs {
+		if sj.nextRun.After(now) {
+			continue
+		}
+		// A run more than a couple of ticks late was missed rather than
+		// just reached
+		trigger := storage.JobTriggerSchedule
+		if now.Sub(sj.nextRun) > 2*s.tick {
+			trigger = storage.JobTriggerCatchUp
+		}
+		sj.nextRun = s.nextRunAfter(sj, now)
+		if err := s.storage.SaveJobSchedule(sj.job.Name, sj.job.Schedule, sj.nextRun); err != nil {
+			log.Printf("Failed to save schedule of job %s: %v", sj.job.Name, err)
+		}
+		due = append(due, sj)
+		triggers = append(triggers, trigger)
+	}
+	s.mu.Unlock()
+
+	for i, sj := range due {
+		if _, err := s.start(sj, triggers[i]); err != nil && !storage.IsConflict(err) {
+			log.Printf("Failed to start job %s: %v", sj.job.Name, err)
+		}
+	}
+}
+
+// nextRunAfter returns the job's next run after t, delayed by its jitter.
+func (s *Scheduler) nextRunAfter(sj *scheduledJob, t time.Time) time.Time {
+	next := sj.schedule.Next(t)
+	if sj.job.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int64N(int64(sj.job.Jitter))))
+	}
+	return next
+}
+
+// start runs a job in the background unless it is already running or the
+// scheduler is closed.
+func (s *Scheduler) start(sj *scheduledJob, trigger storage.JobTrigger) (*storage.JobRun, error) {
+	name := sj.job.Name
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSchedulerClosed
+	}
+	if s.running[name] {
+		s.mu.Unlock()
+		return nil, storage.NewStorageError(storage.ErrConflict, "job "+name+" is already running", nil)
+	}
+	s.running[name] = true
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	run, err := s.storage.StartJobRun(name, trigger)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.running, name)
+		s.mu.Unlock()
+		s.wg.Done()
+		return nil, err
+	}
+	started := *run
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, name)
+			s.mu.Unlock()
+		}()
+
+		message, err := s.execute(sj.job)
+		run.Status = storage.JobRunSucceeded
+		run.Message = message
+		if err != nil {
+			run.Status = storage.JobRunFailed
+			run.Error = err.Error()
+			log.Printf("Job %s failed: %v", name, err)
+		}
+		if err := s.storage.FinishJobRun(run); err != nil {
+			log.Printf("Failed to record run of job %s: %v", name, err)
+		}
+		if _, err := s.storage.PruneJobRuns(name, runHistoryLimit); err != nil {
+			log.Printf("Failed to prune runs of job %s: %v", name, err)
+		}
+	}()
+
+	return &started, nil
+}
+
+// execute runs a job, turning a panic into an error.
+func (s *Scheduler) execute(job Job) (message string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(s.ctx)
+}
+
+// RunNow starts a job immediately, outside its schedule. It returns the
+// started run, or a conflict error if the job is already running or the
+// scheduler is closed.
+func (s *Scheduler) RunNow(name string) (*storage.JobRun, error) {
+	s.mu.Lock()
+	sj, ok := s.byName[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, storage.NewStorageError(storage.ErrNotFound, "job "+name+" not found", nil)
+	}
+	return s.start(sj, storage.JobTriggerManual)
+}
+
+// Status returns the state of every registered job in registration order.
+func (s *Scheduler) Status() ([]JobStatus, error) {
+	states, err := s.storage.GetJobStates()
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]storage.JobState, len(states))
+	for _, state := range states {
+		saved[state.Name] = state
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		state := saved[sj.job.Name]
+		state.Name = sj.job.Name
+		state.Schedule = sj.job.Schedule
+		state.NextRunAt = sj.nextRun
+		statuses = append(statuses, JobStatus{
+			JobState:    state,
+			Description: sj.job.Description,
+			Running:     s.running[sj.job.Name],
+		})
+	}
+	return statuses, nil
+}
+
+// History returns the most recent runs of a job, newest first.
+func (s *Scheduler) History(name string, limit int) ([]storage.JobRun, error) {
+	s.mu.Lock()
+	_, ok := s.byName[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, storage.NewStorageError(storage.ErrNotFound, "job "+name+" not found", nil)
+	}
+	return s.storage.GetJobRuns(name, limit)
+}
@@ -0,0 +1,227 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// fakeClock is a settable time source.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func setupTestStorage(t *testing.T) *storage.StorageEngine {
+	t.Helper()
+
+	se := storage.NewStorageEngine(storage.DefaultStorageConfig(t.TempDir()))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	t.Cleanup(func() { se.Close() })
+
+	return se
+}
+
+func newTestScheduler(se *storage.StorageEngine, clock *fakeClock, jobs ...Job) (*Scheduler, error) {
+	s := New(se)
+	s.now = clock.Now
+	s.tick = time.Hour // Due jobs are run by calling runDue
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.Start()
+}
+
+// waitIdle waits for a job's run to finish.
+func waitIdle(t *testing.T, s *Scheduler, name string) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		s.mu.Lock()
+		running := s.running[name]
+		s.mu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", name)
+}
+
+func TestScheduler(t *testing.T) {
+	se := setupTestStorage(t)
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 1, 0, 0, 0, time.Local)}
+
+	var mu sync.Mutex
+	runs := 0
+	nightly := Job{
+		Name:     "nightly",
+		Schedule: "0 2 * * *",
+		Run: func(ctx context.Context) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs++
+			return "done", nil
+		},
+	}
+	release := make(chan struct{})
+	slow := Job{
+		Name:     "slow",
+		Schedule: "0 0 1 1 *",
+		Run: func(ctx context.Context) (string, error) {
+			<-release
+			return "", errors.New("disk full")
+		},
+	}
+
+	s, err := newTestScheduler(se, clock, nightly, slow)
+	if err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+
+	t.Run("Runs jobs when due", func(t *testing.T) {
+		clock.Set(time.Date(2025, 5, 1, 2, 0, 10, 0, time.Local))
+		s.runDue()
+		waitIdle(t, s, "nightly")
+
+		history, err := s.History("nightly", 10)
+		if err != nil || len(history) != 1 {
+			t.Fatalf("Expected 1 run, got %+v (%v)", history, err)
+		}
+		if history[0].Trigger != storage.JobTriggerSchedule || history[0].Status != storage.JobRunSucceeded || history[0].Message != "done" {
+			t.Errorf("Unexpected run: %+v", history[0])
+		}
+	})
+
+	t.Run("Catches up missed runs once", func(t *testing.T) {
+		// Asleep for three scheduled runs
+		clock.Set(time.Date(2025, 5, 5, 9, 0, 0, 0, time.Local))
+		s.runDue()
+		waitIdle(t, s, "nightly")
+		s.runDue()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if runs != 2 {
+			t.Errorf("Expected 2 runs in total, got %d", runs)
+		}
+		history, _ := s.History("nightly", 1)
+		if len(history) != 1 || history[0].Trigger != storage.JobTriggerCatchUp {
+			t.Errorf("Expected a catch-up run, got %+v", history)
+		}
+	})
+
+	t.Run("Run now is single-flight", func(t *testing.T) {
+		run, err := s.RunNow("slow")
+		if err != nil || run.Status != storage.JobRunRunning {
+			t.Fatalf("Failed to start job: %+v (%v)", run, err)
+		}
+		if _, err := s.RunNow("slow"); !storage.IsConflict(err) {
+			t.Errorf("Expected conflict starting a running job, got %v", err)
+		}
+		if _, err := s.RunNow("missing"); !storage.IsNotFound(err) {
+			t.Errorf("Expected not found for an unknown job, got %v", err)
+		}
+
+		releaseOnce.Do(func() { close(release) })
+		waitIdle(t, s, "slow")
+		history, _ := s.History("slow", 10)
+		if len(history) != 1 || history[0].Trigger != storage.JobTriggerManual ||
+			history[0].Status != storage.JobRunFailed || history[0].Error != "disk full" {
+			t.Errorf("Expected a failed manual run, got %+v", history)
+		}
+	})
+
+	t.Run("Paused jobs run once on resuming", func(t *testing.T) {
+		hourlyRuns := 0
+		hourly := Job{
+			Name:     "hourly",
+			Schedule: "0 * * * *",
+			Run: func(ctx context.Context) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				hourlyRuns++
+				return "", nil
+			},
+		}
+		clock.Set(time.Date(2025, 5, 5, 9, 30, 0, 0, time.Local))
+		paused, err := newTestScheduler(se, clock, hourly)
+		if err != nil {
+			t.Fatalf("Failed to start scheduler: %v", err)
+		}
+		defer paused.Close()
+
+		paused.SetPaused(true)
+		clock.Set(time.Date(2025, 5, 5, 12, 30, 0, 0, time.Local))
+		paused.runDue()
+		waitIdle(t, paused, "hourly")
+		if history, _ := paused.History("hourly", 10); len(history) != 0 {
+			t.Errorf("Expected no runs while paused, got %+v", history)
+		}
+		paused.SetPaused(false)
+		paused.runDue()
+		waitIdle(t, paused, "hourly")
+
+		mu.Lock()
+		defer mu.Unlock()
+		history, _ := paused.History("hourly", 10)
+		if hourlyRuns != 1 || len(history) != 1 || history[0].Trigger != storage.JobTriggerCatchUp {
+			t.Errorf("Expected one catch-up run after resuming, got %d runs: %+v", hourlyRuns, history)
+		}
+	})
+
+	t.Run("Closing twice is safe and stops runs", func(t *testing.T) {
+		if err := s.Close(); err != nil {
+			t.Fatalf("Failed to close scheduler: %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("Failed to close scheduler again: %v", err)
+		}
+		if _, err := s.RunNow("nightly"); err != ErrSchedulerClosed {
+			t.Errorf("Expected starting a job after close to fail, got %v", err)
+		}
+	})
+
+	t.Run("Restart keeps the schedule", func(t *testing.T) {
+
+		clock.Set(time.Date(2025, 5, 5, 10, 0, 0, 0, time.Local))
+		s, err := newTestScheduler(se, clock, nightly, slow)
+		if err != nil {
+			t.Fatalf("Failed to restart scheduler: %v", err)
+		}
+		defer s.Close()
+
+		statuses, err := s.Status()
+		if err != nil || len(statuses) != 2 {
+			t.Fatalf("Expected 2 job statuses, got %+v (%v)", statuses, err)
+		}
+		want := time.Date(2025, 5, 6, 2, 0, 0, 0, time.Local)
+		if !statuses[0].NextRunAt.Equal(want) || statuses[0].LastStatus != storage.JobRunSucceeded {
+			t.Errorf("Expected the persisted next run %v, got %+v", want, statuses[0])
+		}
+		if statuses[1].LastStatus != storage.JobRunFailed || statuses[1].LastError != "disk full" {
+			t.Errorf("Expected the failed last run, got %+v", statuses[1])
+		}
+	})
+}
@@ -100,7 +100,7 @@ func (s *Server) handleArchiveMove(w http.ResponseWriter, r *http.Request) {
 		destName = req.SessionID
 		
 		// Delete from StorageEngine (this handles database, vector, and file cleanup)
-		if err := s.storageEngine.DeleteSession(req.SessionID); err != nil {
+		if err := s.store().DeleteSession(req.SessionID); err != nil {
 			// Log error but continue with filesystem move
 			fmt.Printf("Warning: Failed to delete session from storage engine: %v\n", err)
 		}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"waddle/pkg/ai"
 	"waddle/pkg/storage"
+	"waddle/pkg/synthesis"
+	"waddle/pkg/types"
 	"net/http"
 	"strings"
 	"time"
@@ -14,6 +16,8 @@ type ChatRequest struct {
 	Context   string `json:"context"` // "global" or "session_id" (e.g., "2023-10-27")
 	Message   string `json:"message"`
 	SessionID string `json:"sessionId,omitempty"` // Optional, specific session ID if context is "session"
+
+	WorkSessionID int64 `json:"workSessionId,omitempty"` // Optional, narrows a session chat to one work session
 }
 
 type ChatMessage struct {
@@ -60,6 +64,8 @@ func (s *Server) processChat(w http.ResponseWriter, r *http.Request) {
 	contextText := ""
 	if req.Context == "global" {
 		contextText = s.gatherGlobalContextFromStorage(req.Message)
+	} else if req.WorkSessionID != 0 {
+		contextText = s.gatherWorkSessionContextFromStorage(req.WorkSessionID)
 	} else {
 		contextText = s.gatherSessionContextFromStorage(req.Context, req.Message)
 	}
@@ -92,6 +98,8 @@ Answer the question based on the context provided. If the context doesn't contai
 		Content:   req.Message,
 		Timestamp: time.Now(),
 	}
+	chatMsg.WorkSessionID = types.ElementID(req.WorkSessionID)
+	userMsg.WorkSessionID = types.ElementID(req.WorkSessionID)
 
 	s.saveChatToStorage(req.Context, userMsg, chatMsg)
 
@@ -109,13 +117,13 @@ func (s *Server) saveChatToStorage(context string, userMsg, aiMsg storage.ChatMe
 	// For session-specific chats, save to the session
 	if context != "global" {
 		// Save user message
-		if err := s.storageEngine.AddChat(context, &userMsg); err != nil {
+		if err := s.store().AddChat(context, &userMsg); err != nil {
 			// Log error but don't fail
 			fmt.Printf("Error saving user chat message: %v\n", err)
 		}
 		
 		// Save AI message
-		if err := s.storageEngine.AddChat(context, &aiMsg); err != nil {
+		if err := s.store().AddChat(context, &aiMsg); err != nil {
 			// Log error but don't fail
 			fmt.Printf("Error saving AI chat message: %v\n", err)
 		}
@@ -123,12 +131,39 @@ func (s *Server) saveChatToStorage(context string, userMsg, aiMsg storage.ChatMe
 	// TODO: Implement global chat storage in StorageEngine
 }
 
+func (s *Server) gatherWorkSessionContextFromStorage(workSessionID int64) string {
+	store, err := s.persistentStore()
+	if err != nil {
+		return "No data found for this work session"
+	}
+	activity, err := store.GetWorkSessionActivity(workSessionID)
+	if err != nil {
+		return "No data found for this work session"
+	}
+
+	ws := activity.WorkSession
+	var contextBuilder strings.Builder
+	contextBuilder.WriteString(fmt.Sprintf("Activity from %s to %s:\n",
+		ws.StartTime.Local().Format("2006-01-02 15:04"), ws.EndTime.Local().Format("15:04")))
+	contextBuilder.WriteString(synthesis.WorkSessionContext(activity))
+
+	chats, err := store.GetWorkSessionChats(workSessionID)
+	if err == nil && len(chats) > 0 {
+		contextBuilder.WriteString("\nPrevious Chat History:\n")
+		for _, chat := range chats {
+			contextBuilder.WriteString(fmt.Sprintf("%s: %s\n", chat.Role, chat.Content))
+		}
+	}
+
+	return contextBuilder.String()
+}
+
 func (s *Server) gatherGlobalContextFromStorage(_ string) string {
 	var contextBuilder strings.Builder
 	contextBuilder.WriteString("Recent Activity Summaries:\n")
 
 	// Get recent sessions using StorageEngine
-	sessions, _, err := s.storageEngine.ListSessions(1, 10) // Get last 10 sessions
+	sessions, _, err := s.store().ListSessions(1, 10) // Get last 10 sessions
 	if err != nil {
 		return "No recent activity found."
 	}
@@ -161,7 +196,7 @@ func (s *Server) gatherSessionContextFromStorage(date string, _ string) string {
 	contextBuilder.WriteString(fmt.Sprintf("Activity for %s:\n", date))
 
 	// Get session details
-	session, err := s.storageEngine.GetSession(date)
+	session, err := s.store().GetSession(date)
 	if err != nil {
 		return fmt.Sprintf("No data found for %s", date)
 	}
@@ -177,8 +212,16 @@ func (s *Server) gatherSessionContextFromStorage(date string, _ string) string {
 		contextBuilder.WriteString(fmt.Sprintf("Extracted Text: %s\n", session.ExtractedText))
 	}
 
+	// Add meetings so questions about a meeting can be answered
+	if persistent, err := s.persistentStore(); err == nil {
+		meetings, err := persistent.GetMeetings(date)
+		if err == nil && len(meetings) > 0 {
+			contextBuilder.WriteString(synthesis.MeetingContext(meetings))
+		}
+	}
+
 	// Get chat history for this session
-	chats, err := s.storageEngine.GetChats(date)
+	chats, err := s.store().GetChats(date)
 	if err == nil && len(chats) > 0 {
 		contextBuilder.WriteString("\nPrevious Chat History:\n")
 		for _, chat := range chats {
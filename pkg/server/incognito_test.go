@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"waddle/pkg/storage"
+)
+
+// TestActiveStorage tests that captured data goes through the active store,
+// so the API reads and writes the in-memory one in incognito mode.
+func TestActiveStorage(t *testing.T) {
+	storageEngine := storage.NewStorageEngine(storage.DefaultStorageConfig(filepath.Join(t.TempDir(), ".waddle")))
+	if err := storageEngine.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer storageEngine.Close()
+
+	incognito := storage.NewMemoryStorageEngine(storageEngine.Config())
+	if err := incognito.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize memory storage: %v", err)
+	}
+	defer incognito.Close()
+
+	server := NewServer(t.TempDir(), "8080", &atomic.Bool{}, storageEngine)
+	server.SetActiveStorage(func() storage.StorageEngineInterface { return incognito })
+
+	const date = "2025-06-02"
+	body, _ := json.Marshal(SessionMetadata{
+		CustomTitle: "Private",
+		ManualNotes: []ManualNote{{Content: "Not for disk"}},
+	})
+	w := httptest.NewRecorder()
+	server.handleAppDetails(w, httptest.NewRequest("PUT", "/api/sessions/"+date, bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected session update to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("Writes reach only the active store", func(t *testing.T) {
+		if _, err := storageEngine.GetSession(date); !storage.IsNotFound(err) {
+			t.Errorf("Expected no session on disk, got %v", err)
+		}
+		notes, err := incognito.GetNotes(date)
+		if err != nil || len(notes) != 1 {
+			t.Errorf("Expected the note in the active store, got %+v (%v)", notes, err)
+		}
+	})
+
+	t.Run("Reads come from the active store", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleSessions(w, httptest.NewRequest("GET", "/api/sessions", nil))
+		var dates []string
+		if err := json.Unmarshal(w.Body.Bytes(), &dates); err != nil || len(dates) != 1 || dates[0] != date {
+			t.Errorf("Expected only the incognito session listed, got %s", w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		server.handleAppDetails(w, httptest.NewRequest("GET", "/api/sessions/"+date+"/metadata", nil))
+		var metadata SessionMetadata
+		if err := json.Unmarshal(w.Body.Bytes(), &metadata); err != nil || metadata.CustomTitle != "Private" || len(metadata.ManualNotes) != 1 {
+			t.Errorf("Expected the incognito session's metadata, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Revisions come from the active store", func(t *testing.T) {
+		session, err := incognito.GetSession(date)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.handleRevisions(w, httptest.NewRequest("GET", "/api/revisions/session/"+strconv.FormatInt(int64(session.ID), 10), nil))
+		var revisions []storage.Revision
+		if err := json.Unmarshal(w.Body.Bytes(), &revisions); err != nil || len(revisions) == 0 {
+			t.Errorf("Expected the incognito session's revisions, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Tags are refused for in-memory items", func(t *testing.T) {
+		block := &storage.ActivityBlock{BlockID: "09-00", StartTime: time.Now(), EndTime: time.Now().Add(time.Minute)}
+		if err := incognito.AddActivityBlock(date, "Code", block); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+		blocks, err := incognito.GetActivityBlocks(date, "Code")
+		if err != nil || len(blocks) != 1 {
+			t.Fatalf("Expected the block in the active store, got %+v (%v)", blocks, err)
+		}
+
+		body, _ := json.Marshal(map[string]string{"name": "secret"})
+		w := httptest.NewRecorder()
+		path := "/api/tags/block/" + strconv.FormatInt(int64(blocks[0].ID), 10)
+		server.handleTag(w, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected tagging to be refused, got %d: %s", w.Code, w.Body.String())
+		}
+		tags, err := storageEngine.ListTags()
+		if err != nil || len(tags) != 0 {
+			t.Errorf("Expected no tags on disk, got %+v (%v)", tags, err)
+		}
+	})
+}
@@ -1,18 +1,24 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
+	"waddle/pkg/exporter"
+	"waddle/pkg/scheduler"
 	"waddle/pkg/storage"
+	"waddle/pkg/types"
 )
 
 type Server struct {
@@ -20,6 +26,8 @@ type Server struct {
 	port          string
 	isPaused      *atomic.Bool
 	storageEngine *storage.StorageEngine
+	activeStorage func() storage.StorageEngineInterface
+	scheduler     *scheduler.Scheduler
 }
 
 func NewServer(rootDir string, port string, isPaused *atomic.Bool, storageEngine *storage.StorageEngine) *Server {
@@ -31,6 +39,34 @@ func NewServer(rootDir string, port string, isPaused *atomic.Bool, storageEngine
 	}
 }
 
+// SetScheduler makes the maintenance job scheduler available to the API.
+func (s *Server) SetScheduler(sched *scheduler.Scheduler) {
+	s.scheduler = sched
+}
+
+// SetActiveStorage sets where captured data is read and written: the store
+// fn returns, which is the in-memory one in incognito mode. Operations on
+// sessions, blocks and other items go through it, and those it doesn't
+// support are refused while incognito mode is on.
+func (s *Server) SetActiveStorage(fn func() storage.StorageEngineInterface) {
+	s.activeStorage = fn
+}
+
+// store returns the store captured data currently goes to.
+func (s *Server) store() storage.StorageEngineInterface {
+	if s.activeStorage != nil {
+		return s.activeStorage()
+	}
+	return s.storageEngine
+}
+
+// persistentStore returns the persistent store for the operations the
+// in-memory one doesn't support, or a conflict error while incognito mode
+// is on.
+func (s *Server) persistentStore() (*storage.StorageEngine, error) {
+	return storage.PersistentStore(s.store())
+}
+
 func (s *Server) Start() {
 	mux := http.NewServeMux()
 
@@ -54,6 +90,37 @@ func (s *Server) Start() {
 	// Knowledge Cards Endpoint
 	mux.HandleFunc("/api/knowledge-cards", cors(s.handleKnowledgeCards))
 
+	// Meetings Endpoints
+	mux.HandleFunc("/api/meetings", cors(s.handleMeetings))
+	mux.HandleFunc("/api/meetings/", cors(s.handleMeetingActivity))
+
+	// Work Session Endpoints
+	mux.HandleFunc("/api/work-sessions/merge", cors(s.handleWorkSessionMerge))
+	mux.HandleFunc("/api/work-sessions/", cors(s.handleWorkSession))
+
+	// Tag Endpoints
+	mux.HandleFunc("/api/tags", cors(s.handleTags))
+	mux.HandleFunc("/api/tags/", cors(s.handleTag))
+
+	// Revision Endpoints
+	mux.HandleFunc("/api/revisions/", cors(s.handleRevisions))
+
+	// Export Endpoints
+	mux.HandleFunc("/api/export/markdown", cors(s.handleMarkdownExport))
+	mux.HandleFunc("/api/bundle/export", cors(s.handleBundleExport))
+	mux.HandleFunc("/api/bundle/import", cors(s.handleBundleImport))
+	mux.HandleFunc("/api/recovery", cors(s.handleRecovery))
+
+	// Job Endpoints
+	mux.HandleFunc("/api/jobs", cors(s.handleJobs))
+	mux.HandleFunc("/api/jobs/", cors(s.handleJob))
+
+	// Retention Endpoints
+	mux.HandleFunc("/api/retention", cors(s.handleRetention))
+	mux.HandleFunc("/api/purge", cors(s.handlePurge))
+	mux.HandleFunc("/api/purge/preview", cors(s.handlePurge))
+	mux.HandleFunc("/api/storage/stats", cors(s.handleStorageStats))
+
 	// New search endpoints
 	mux.HandleFunc("/api/search/fulltext", cors(s.handleFullTextSearch))
 	mux.HandleFunc("/api/search/semantic", cors(s.handleSemanticSearch))
@@ -86,6 +153,7 @@ func (s *Server) Start() {
 	// Static Files (Images)
 	fileServer := http.FileServer(http.Dir(s.rootDir))
 	mux.Handle("/images/", http.StripPrefix("/images/", fileServer))
+	mux.HandleFunc("/images/files/", cors(s.handleFileImage))
 
 	fmt.Printf("Starting API Server on port %s...\n", s.port)
 	go http.ListenAndServe(":"+s.port, mux)
@@ -98,21 +166,27 @@ func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use StorageEngine to list sessions
-	sessions, _, err := s.storageEngine.ListSessions(1, 1000) // Get all sessions
+	// Newest first
+	var dates []string
+	var err error
+	if store, ok := s.store().(*storage.StorageEngine); ok {
+		err = store.IterateSessions(storage.SessionQuery{Newest: true, WithoutText: true}, func(session storage.Session) error {
+			dates = append(dates, session.Date)
+			return nil
+		})
+	} else {
+		// The in-memory incognito store holds few sessions
+		var sessions []storage.Session
+		sessions, _, err = s.store().ListSessions(1, math.MaxInt32)
+		for _, session := range sessions {
+			dates = append(dates, session.Date)
+		}
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var dates []string
-	for _, session := range sessions {
-		dates = append(dates, session.Date)
-	}
-
-	// Sort reverse (newest first)
-	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
-
 	json.NewEncoder(w).Encode(dates)
 }
 
@@ -148,7 +222,617 @@ func (s *Server) handleKnowledgeCards(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(cards)
 }
 
-// GET /api/search/fulltext -> Full-text search
+// GET /api/meetings?q=<title> -> Returns meetings whose title matches, newest first
+func (s *Server) handleMeetings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	meetings, err := store.FindMeetings(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meetings)
+}
+
+// GET /api/meetings/{id}/activity -> Returns the activity blocks recorded during a meeting
+func (s *Server) handleMeetingActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/meetings/"), "/")
+	if len(parts) != 2 || parts[1] != "activity" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	meetingID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid meeting ID", http.StatusBadRequest)
+		return
+	}
+
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	activity, err := store.GetMeetingActivity(meetingID)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "Meeting not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
+
+// GET /api/work-sessions/{id} -> Returns a work session with its blocks, meetings and knowledge cards
+// PUT /api/work-sessions/{id} -> Renames a work session
+// POST /api/work-sessions/{id}/split -> Splits a work session at {"at": RFC 3339 time}
+func (s *Server) handleWorkSession(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/work-sessions/"), "/")
+	workSessionID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid work session ID", http.StatusBadRequest)
+		return
+	}
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	var result interface{}
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		result, err = store.GetWorkSessionActivity(workSessionID)
+
+	case len(parts) == 1 && r.Method == "PUT":
+		var req struct {
+			Title string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ws *storage.WorkSession
+		if ws, err = store.GetWorkSession(workSessionID); err == nil {
+			ws.Title = req.Title
+			err = store.UpdateWorkSession(ws)
+			result = ws
+		}
+
+	case len(parts) == 2 && parts[1] == "split" && r.Method == "POST":
+		var req struct {
+			At time.Time `json:"at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err = store.SplitWorkSession(workSessionID, req.At)
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// POST /api/work-sessions/merge -> Merges adjacent work sessions {"ids": [...]}
+func (s *Server) handleWorkSessionMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	merged, err := store.MergeWorkSessions(req.IDs)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+// GET /api/tags -> Returns all tags
+// POST /api/tags -> Creates a tag {"name": ..., "color": ...}
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	var result interface{}
+	switch r.Method {
+	case "GET":
+		result, err = store.ListTags()
+
+	case "POST":
+		var tag storage.Tag
+		if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = store.CreateTag(&tag)
+		result = tag
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// PUT /api/tags/{id} -> Renames or recolors a tag {"name": ..., "color": ...}
+// DELETE /api/tags/{id} -> Deletes a tag
+// GET /api/tags/rules -> Returns the auto-tag rules
+// POST /api/tags/rules -> Creates an auto-tag rule {"entityType": ..., "pattern": ..., "tag": ...}
+// DELETE /api/tags/rules/{id} -> Deletes an auto-tag rule
+// GET /api/tags/{target}/{itemId} -> Returns the tags of a session, block or card
+// POST /api/tags/{target}/{itemId} -> Tags an item {"name": ...}
+// DELETE /api/tags/{target}/{itemId}/{tagId} -> Removes a tag from an item
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tags/"), "/")
+
+	var ids []int64
+	for _, part := range parts[1:] {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	store, err := s.persistentStore()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	var result interface{}
+	switch {
+	case parts[0] == "rules" && len(ids) == 0 && r.Method == "GET":
+		result, err = store.ListTagRules()
+
+	case parts[0] == "rules" && len(ids) == 0 && r.Method == "POST":
+		var rule storage.TagRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = store.CreateTagRule(&rule)
+		result = rule
+
+	case parts[0] == "rules" && len(ids) == 1 && r.Method == "DELETE":
+		err = store.DeleteTagRule(ids[0])
+		result = map[string]bool{"success": err == nil}
+
+	case len(parts) == 1 && (r.Method == "PUT" || r.Method == "DELETE"):
+		tagID, perr := strconv.ParseInt(parts[0], 10, 64)
+		if perr != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method == "DELETE" {
+			err = store.DeleteTag(tagID)
+			result = map[string]bool{"success": err == nil}
+			break
+		}
+		var tag storage.Tag
+		if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tag.ID = types.ElementID(tagID)
+		err = store.UpdateTag(&tag)
+		result = tag
+
+	case len(ids) == 1 && r.Method == "GET":
+		result, err = store.GetItemTags(storage.TagTarget(parts[0]), ids[0])
+
+	case len(ids) == 1 && r.Method == "POST":
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err = store.TagItem(storage.TagTarget(parts[0]), ids[0], req.Name)
+
+	case len(ids) == 2 && r.Method == "DELETE":
+		err = store.UntagItem(storage.TagTarget(parts[0]), ids[0], ids[1])
+		result = map[string]bool{"success": err == nil}
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/revisions/{entity}/{id} -> Returns the edit history of a session or card
+// POST /api/revisions/{revisionId}/restore -> Undoes a revision and every later one
+func (s *Server) handleRevisions(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/revisions/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	var result interface{}
+	var err error
+	switch {
+	case parts[1] == "restore" && r.Method == "POST":
+		revisionID, perr := strconv.ParseInt(parts[0], 10, 64)
+		if perr != nil {
+			http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+			return
+		}
+		err = s.store().RestoreRevision(revisionID)
+		result = map[string]bool{"success": err == nil}
+
+	case r.Method == "GET":
+		id, perr := strconv.ParseInt(parts[1], 10, 64)
+		if perr != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		result, err = s.store().GetRevisions(storage.RevisionEntity(parts[0]), id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/jobs -> Returns the state of the scheduled maintenance jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.scheduler == nil {
+		http.Error(w, "Job scheduler not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	statuses, err := s.scheduler.Status()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// GET /api/jobs/{name}/runs?limit=N -> Returns the most recent runs of a job
+// POST /api/jobs/{name}/run -> Starts the job now, 409 if it is already running
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if s.scheduler == nil {
+		http.Error(w, "Job scheduler not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result interface{}
+	var err error
+	status := http.StatusOK
+	switch {
+	case parts[1] == "runs" && r.Method == "GET":
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		result, err = s.scheduler.History(parts[0], limit)
+
+	case parts[1] == "run" && r.Method == "POST":
+		result, err = s.scheduler.RunNow(parts[0])
+		status = http.StatusAccepted
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/retention -> Returns what the retention policy would delete, archive and compress, without changing anything
+// POST /api/retention -> Applies the retention policy
+func (s *Server) handleRetention(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+	var err error
+	switch r.Method {
+	case "GET":
+		result, err = s.storageEngine.PreviewRetentionPolicy()
+	case "POST":
+		result, err = s.storageEngine.ApplyRetentionPolicy()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// POST /api/purge -> Erases everything matching {"term", "app", "domain", "start", "end", "redact", "backups"} and returns the purge report
+// POST /api/purge/preview -> Returns what the purge would erase, without changing anything
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req storage.PurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var report *storage.PurgeReport
+	var err error
+	if strings.HasSuffix(r.URL.Path, "/preview") {
+		report, err = s.storageEngine.PreviewPurge(req)
+	} else {
+		report, err = s.storageEngine.Purge(req)
+	}
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GET /api/storage/stats -> Returns file storage statistics with screenshot bytes per tier
+func (s *Server) handleStorageStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := s.storageEngine.GetFileStats()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GET /images/files/{path} -> Returns a stored screenshot, decrypted
+func (s *Server) handleFileImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rel := strings.TrimPrefix(path.Clean(r.URL.Path), "/images/files/")
+	data, err := s.storageEngine.ReadFile(filepath.FromSlash(rel))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	http.ServeContent(w, r, path.Base(rel), time.Time{}, bytes.NewReader(data))
+}
+
+// POST /api/export/markdown -> Exports sessions to a Markdown vault {"dir": ..., "from": ..., "to": ..., "screenshots": ...}
+func (s *Server) handleMarkdownExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var opts exporter.MarkdownOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(opts.Dir) {
+		http.Error(w, "dir must be an absolute path", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := exporter.NewMarkdownExporter(s.storageEngine).Export(opts)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// POST /api/bundle/export -> Writes a portable export bundle {"path": ..., "password": ..., "skipFiles": ..., "skipEmbeddings": ...}
+func (s *Server) handleBundleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+		storage.BundleExportOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(req.Path) {
+		http.Error(w, "path must be an absolute path", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.storageEngine.ExportBundle(req.Path, req.BundleExportOptions)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// POST /api/bundle/import -> Imports an export bundle {"path": ..., "password": ..., "onConflict": ..., "regenerateEmbeddings": ...}
+func (s *Server) handleBundleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+		storage.BundleImportOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(req.Path) {
+		http.Error(w, "path must be an absolute path", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.storageEngine.ImportBundle(req.Path, req.BundleImportOptions)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/recovery -> Returns the recovery key for the current master key
+// POST /api/recovery -> Sets up recovery under a passphrase {"passphrase": ...} and returns the recovery key
+func (s *Server) handleRecovery(w http.ResponseWriter, r *http.Request) {
+	var rk *storage.RecoveryKey
+	var err error
+	switch r.Method {
+	case "GET":
+		rk, err = s.storageEngine.GetRecoveryKey()
+	case "POST":
+		var req struct {
+			Passphrase string `json:"passphrase"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rk, err = s.storageEngine.SetupRecovery(req.Passphrase)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rk)
+}
+
+// writeStorageError maps storage error codes to HTTP statuses.
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case storage.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case storage.IsValidation(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case storage.IsConflict(err):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GET /api/search/fulltext -> Full-text search, optionally filtered by ?tag=...
 func (s *Server) handleFullTextSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -175,7 +859,8 @@ func (s *Server) handleFullTextSearch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	results, err := s.storageEngine.FullTextSearch(query, page, pageSize)
+	// Repeated "tag" parameters narrow results to sessions carrying all of them
+	results, err := s.store().FullTextSearch(query, page, pageSize, r.URL.Query()["tag"]...)
 	if err != nil {
 		// Return empty array instead of error for compatibility
 		json.NewEncoder(w).Encode([]storage.SearchResult{})
@@ -185,7 +870,7 @@ func (s *Server) handleFullTextSearch(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
-// GET /api/search/semantic -> Semantic search
+// GET /api/search/semantic -> Semantic search, optionally filtered by ?tag=...
 func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -215,7 +900,7 @@ func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	results, err := s.storageEngine.SemanticSearch(query, topK, dateRange)
+	results, err := s.store().SemanticSearch(query, topK, dateRange, r.URL.Query()["tag"]...)
 	if err != nil {
 		// Return empty array instead of error for compatibility
 		json.NewEncoder(w).Encode([]storage.SearchResult{})
@@ -323,6 +1008,7 @@ func (s *Server) handleBlacklist(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
 	parts := strings.Split(path, "/")
+	store := s.store()
 
 	// Handle PUT for session update
 	if r.Method == "PUT" && len(parts) == 1 && parts[0] != "" {
@@ -343,7 +1029,7 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 		date := parts[0]
 
 		// Verify session exists
-		_, err := s.storageEngine.GetSession(date)
+		_, err := store.GetSession(date)
 		if err != nil {
 			if storage.IsNotFound(err) {
 				http.Error(w, "Date not found", http.StatusNotFound)
@@ -353,7 +1039,7 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		activities, err := s.storageEngine.GetSessionAppActivities(date)
+		activities, err := store.GetSessionAppActivities(date)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -369,10 +1055,50 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 2 && parts[1] == "meetings" && r.Method == "GET" {
+		// List the session's meetings. Only the persistent store has any
+		persistent, err := s.persistentStore()
+		if err != nil {
+			json.NewEncoder(w).Encode([]storage.Meeting{})
+			return
+		}
+		meetings, err := persistent.GetMeetings(parts[0])
+		if err != nil {
+			if storage.IsNotFound(err) {
+				json.NewEncoder(w).Encode([]storage.Meeting{})
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(meetings)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "work-sessions" && r.Method == "GET" {
+		// Segment the day into work sessions and list them
+		persistent, err := s.persistentStore()
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		workSessions, err := persistent.SegmentSession(parts[0])
+		if err != nil {
+			if storage.IsNotFound(err) {
+				json.NewEncoder(w).Encode([]storage.WorkSession{})
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(workSessions)
+		return
+	}
+
 	if len(parts) == 2 && parts[1] == "metadata" {
 		// Get Session Metadata using StorageEngine
 		date := parts[0]
-		session, err := s.storageEngine.GetSession(date)
+		session, err := store.GetSession(date)
 		if err != nil {
 			if storage.IsNotFound(err) {
 				// Return empty/default metadata
@@ -391,50 +1117,27 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 			ManualNotes:     []ManualNote{},
 		}
 
-		rows, err := s.storageEngine.DB().Query(`
-			SELECT id, content, created_at, updated_at
-			FROM manual_notes
-			WHERE session_id = ?
-			ORDER BY created_at ASC
-		`, int64(session.ID))
+		notes, err := store.GetNotes(date)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var noteID int64
-			var content string
-			var createdAtRaw string
-			var updatedAtRaw string
-			if err := rows.Scan(&noteID, &content, &createdAtRaw, &updatedAtRaw); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			createdAt, err := normalizeAPITimestamp(createdAtRaw)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		for _, note := range notes {
+			metadata.ManualNotes = append(metadata.ManualNotes, ManualNote{
+				ID:        strconv.FormatInt(int64(note.ID), 10),
+				Content:   note.Content,
+				CreatedAt: note.CreatedAt.UTC().Format(time.RFC3339),
+				UpdatedAt: note.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		}
 
-			updatedAt, err := normalizeAPITimestamp(updatedAtRaw)
-			if err != nil {
+		// Meetings are only imported into the persistent store
+		if persistent, err := s.persistentStore(); err == nil {
+			metadata.Meetings, err = persistent.GetMeetings(date)
+			if err != nil && !storage.IsNotFound(err) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-
-			metadata.ManualNotes = append(metadata.ManualNotes, ManualNote{
-				ID:        strconv.FormatInt(noteID, 10),
-				Content:   content,
-				CreatedAt: createdAt,
-				UpdatedAt: updatedAt,
-			})
-		}
-		if err := rows.Err(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
 		}
 
 		json.NewEncoder(w).Encode(metadata)
@@ -447,7 +1150,7 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 		app := parts[1]
 
 		// Verify session exists
-		_, err := s.storageEngine.GetSession(date)
+		_, err := store.GetSession(date)
 		if err != nil {
 			if storage.IsNotFound(err) {
 				http.Error(w, "Session not found", http.StatusNotFound)
@@ -459,7 +1162,7 @@ func (s *Server) handleAppDetails(w http.ResponseWriter, r *http.Request) {
 
 		// Check if requesting blocks
 		if len(parts) == 3 && parts[2] == "blocks" {
-			blocks, err := s.storageEngine.GetActivityBlocks(date, app)
+			blocks, err := store.GetActivityBlocks(date, app)
 			if err != nil {
 				// Return empty list if no blocks yet
 				json.NewEncoder(w).Encode([]interface{}{})
@@ -512,20 +1215,23 @@ type ManualNote struct {
 
 // SessionMetadata stores user customizations for a session
 type SessionMetadata struct {
-	CustomTitle     string       `json:"customTitle,omitempty"`
-	CustomSummary   string       `json:"customSummary,omitempty"`
-	OriginalSummary string       `json:"originalSummary,omitempty"`
-	ManualNotes     []ManualNote `json:"manualNotes"`
+	CustomTitle     string            `json:"customTitle,omitempty"`
+	CustomSummary   string            `json:"customSummary,omitempty"`
+	OriginalSummary string            `json:"originalSummary,omitempty"`
+	ManualNotes     []ManualNote      `json:"manualNotes"`
+	Meetings        []storage.Meeting `json:"meetings"`
 }
 
 // PUT /api/sessions/{date} -> Updates session metadata
 func (s *Server) handleSessionUpdate(w http.ResponseWriter, r *http.Request, date string) {
+	store := s.store()
+
 	// Get existing session
-	session, err := s.storageEngine.GetSession(date)
+	session, err := store.GetSession(date)
 	if err != nil {
 		if storage.IsNotFound(err) {
 			// Create new session if it doesn't exist
-			session, err = s.storageEngine.CreateSession(date)
+			session, err = store.CreateSession(date)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -547,12 +1253,12 @@ func (s *Server) handleSessionUpdate(w http.ResponseWriter, r *http.Request, dat
 	session.CustomSummary = metadata.CustomSummary
 	session.OriginalSummary = metadata.OriginalSummary
 
-	if err := s.storageEngine.UpdateSession(session); err != nil {
+	if err := store.UpdateSession(session); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := s.upsertManualNotes(int64(session.ID), metadata.ManualNotes); err != nil {
+	if err := syncManualNotes(store, date, metadata.ManualNotes); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -560,91 +1266,57 @@ func (s *Server) handleSessionUpdate(w http.ResponseWriter, r *http.Request, dat
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// upsertManualNotes replaces all manual notes for a session with the provided list.
-func (s *Server) upsertManualNotes(sessionID int64, notes []ManualNote) error {
-	tx, err := s.storageEngine.DB().Begin()
+// syncManualNotes makes a session's notes match the provided list. Notes
+// with a known ID are updated, which keeps their earlier content as a
+// revision; notes without one are added, and notes missing from the list
+// are deleted.
+func syncManualNotes(store storage.StorageEngineInterface, date string, notes []ManualNote) error {
+	existing, err := store.GetNotes(date)
 	if err != nil {
 		return err
 	}
-
-	rollback := func(cause error) error {
-		_ = tx.Rollback()
-		return cause
-	}
-
-	if _, err := tx.Exec("DELETE FROM manual_notes WHERE session_id = ?", sessionID); err != nil {
-		return rollback(err)
+	byID := make(map[string]storage.ManualNote, len(existing))
+	for _, note := range existing {
+		byID[strconv.FormatInt(int64(note.ID), 10)] = note
 	}
-	insertSQL := `
-		INSERT INTO manual_notes (session_id, content, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-	`
 
+	kept := make(map[string]bool, len(notes))
 	for _, note := range notes {
 		if strings.TrimSpace(note.Content) == "" {
 			continue
 		}
 
-		createdAt := strings.TrimSpace(note.CreatedAt)
-		if createdAt == "" {
-			createdAt = time.Now().UTC().Format(time.RFC3339)
-		} else {
-			parsed, err := normalizeAPITimestamp(createdAt)
-			if err != nil {
-				return rollback(err)
+		if current, ok := byID[note.ID]; ok {
+			kept[note.ID] = true
+			if current.Content == note.Content {
+				continue
 			}
-			createdAt = parsed
-		}
-
-		updatedAt := strings.TrimSpace(note.UpdatedAt)
-		if updatedAt == "" {
-			updatedAt = createdAt
-		} else {
-			parsed, err := normalizeAPITimestamp(updatedAt)
-			if err != nil {
-				return rollback(err)
+			current.Content = note.Content
+			if err := store.UpdateNote(&current); err != nil {
+				return err
 			}
-			updatedAt = parsed
+			continue
 		}
 
-		if _, err := tx.Exec(insertSQL, sessionID, note.Content, createdAt, updatedAt); err != nil {
-			return rollback(err)
+		if err := store.AddNote(date, &storage.ManualNote{Content: note.Content}); err != nil {
+			return err
 		}
 	}
 
-	return tx.Commit()
-}
-
-func normalizeAPITimestamp(raw string) (string, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return "", nil
-	}
-
-	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
-		return t.UTC().Format(time.RFC3339), nil
-	}
-	if t, err := time.Parse(time.RFC3339, raw); err == nil {
-		return t.UTC().Format(time.RFC3339), nil
-	}
-
-	sqliteLayouts := []string{
-		"2006-01-02 15:04:05",
-		"2006-01-02 15:04:05.999999999-07:00",
-		"2006-01-02 15:04:05.999999999",
-	}
-	for _, layout := range sqliteLayouts {
-		if t, err := time.Parse(layout, raw); err == nil {
-			return t.UTC().Format(time.RFC3339), nil
+	for id, note := range byID {
+		if !kept[id] {
+			if err := store.DeleteNote(int64(note.ID)); err != nil {
+				return err
+			}
 		}
 	}
 
-	return "", fmt.Errorf("invalid timestamp format: %s", raw)
+	return nil
 }
 
 // DELETE /api/sessions/{date} -> Deletes session
 func (s *Server) handleSessionDelete(w http.ResponseWriter, _ *http.Request, date string) {
-	if err := s.storageEngine.DeleteSession(date); err != nil {
+	if err := s.store().DeleteSession(date); err != nil {
 		if storage.IsNotFound(err) {
 			http.Error(w, "Session not found", http.StatusNotFound)
 			return
@@ -673,7 +1345,7 @@ type Notification struct {
 func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 		// Use StorageEngine to get notifications
-		notifications, err := s.storageEngine.GetNotifications(100) // Get last 100
+		notifications, err := s.store().GetNotifications(100) // Get last 100
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -733,7 +1405,7 @@ func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		if err := s.storageEngine.AddNotification(storageNotif); err != nil {
+		if err := s.store().AddNotification(storageNotif); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -766,7 +1438,7 @@ func (s *Server) handleNotificationsRead(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Use StorageEngine to mark notifications as read
-	if err := s.storageEngine.MarkNotificationsRead(body.IDs); err != nil {
+	if err := s.store().MarkNotificationsRead(body.IDs); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -9,6 +9,12 @@ import (
 
 // AddBlock adds an activity block to a session's app activity.
 func (sm *SessionManager) AddBlock(sessionID int64, appName string, block *ActivityBlock) error {
+	return sm.addBlock(sm.db, sessionID, appName, block)
+}
+
+// addBlock adds an activity block using q, which may be a write batch's
+// transaction.
+func (sm *SessionManager) addBlock(q execQueryer, sessionID int64, appName string, block *ActivityBlock) error {
 	if appName == "" {
 		return NewStorageError(ErrValidation, "app name is required", nil)
 	}
@@ -17,7 +23,7 @@ func (sm *SessionManager) AddBlock(sessionID int64, appName string, block *Activ
 	}
 
 	// Get or create app activity
-	appActivityID, err := sm.getOrCreateAppActivity(sessionID, appName)
+	appActivityID, err := sm.getOrCreateAppActivity(q, sessionID, appName)
 	if err != nil {
 		return err
 	}
@@ -25,7 +31,7 @@ func (sm *SessionManager) AddBlock(sessionID int64, appName string, block *Activ
 	// Encrypt OCR text
 	var encryptedOCR []byte
 	if block.OCRText != "" && sm.encryptionMgr != nil {
-		encryptedOCR, err = sm.encryptionMgr.Encrypt([]byte(block.OCRText))
+		encryptedOCR, err = sm.sealFor(q, sessionID, []byte(block.OCRText))
 		if err != nil {
 			return NewStorageError(ErrEncryption, "failed to encrypt OCR text", err)
 		}
@@ -44,11 +50,6 @@ func (sm *SessionManager) AddBlock(sessionID int64, appName string, block *Activ
 			structured_metadata = excluded.structured_metadata
 	`
 
-	stmt, err := sm.getStmt(query)
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
-	}
-
 	// Set defaults for capture columns if not provided
 	if block.CaptureSource == "" {
 		block.CaptureSource = "polling_ocr"
@@ -57,7 +58,7 @@ func (sm *SessionManager) AddBlock(sessionID int64, appName string, block *Activ
 		block.StructuredMetadata = "{}"
 	}
 
-	result, err := stmt.Exec(
+	result, err := sm.execCached(q, query,
 		appActivityID,
 		block.BlockID,
 		block.StartTime,
@@ -136,10 +137,10 @@ func (sm *SessionManager) GetBlocks(sessionID int64, appName string) ([]Activity
 }
 
 // getOrCreateAppActivity gets or creates an app activity for a session.
-func (sm *SessionManager) getOrCreateAppActivity(sessionID int64, appName string) (int64, error) {
+func (sm *SessionManager) getOrCreateAppActivity(q execQueryer, sessionID int64, appName string) (int64, error) {
 	// Try to get existing
 	var id int64
-	err := sm.db.QueryRow(`
+	err := q.QueryRow(`
 		SELECT id FROM app_activities WHERE session_id = ? AND app_name = ?
 	`, sessionID, appName).Scan(&id)
 
@@ -153,14 +154,14 @@ func (sm *SessionManager) getOrCreateAppActivity(sessionID int64, appName string
 
 	// Create new
 	now := time.Now()
-	result, err := sm.db.Exec(`
+	result, err := q.Exec(`
 		INSERT INTO app_activities (session_id, app_name, created_at, updated_at)
 		VALUES (?, ?, ?, ?)
 	`, sessionID, appName, now, now)
 	if err != nil {
 		// Check if it was created by another goroutine
 		if isUniqueConstraintError(err) {
-			err := sm.db.QueryRow(`
+			err := q.QueryRow(`
 				SELECT id FROM app_activities WHERE session_id = ? AND app_name = ?
 			`, sessionID, appName).Scan(&id)
 			if err == nil {
@@ -218,6 +219,12 @@ func (sm *SessionManager) GetAppActivities(sessionID int64) ([]AppActivity, erro
 
 // AddChat adds a chat message to a session.
 func (sm *SessionManager) AddChat(sessionID int64, chat *ChatMessage) error {
+	return sm.addChat(sm.db, sessionID, chat)
+}
+
+// addChat adds a chat message using q, which may be a write batch's
+// transaction.
+func (sm *SessionManager) addChat(q execQueryer, sessionID int64, chat *ChatMessage) error {
 	if !ValidChatRoles[chat.Role] {
 		return NewStorageError(ErrValidation, "invalid chat role", nil)
 	}
@@ -229,7 +236,7 @@ func (sm *SessionManager) AddChat(sessionID int64, chat *ChatMessage) error {
 	var encryptedContent []byte
 	var err error
 	if sm.encryptionMgr != nil {
-		encryptedContent, err = sm.encryptionMgr.Encrypt([]byte(chat.Content))
+		encryptedContent, err = sm.sealFor(q, sessionID, []byte(chat.Content))
 		if err != nil {
 			return NewStorageError(ErrEncryption, "failed to encrypt chat content", err)
 		}
@@ -241,17 +248,17 @@ func (sm *SessionManager) AddChat(sessionID int64, chat *ChatMessage) error {
 		chat.Timestamp = time.Now()
 	}
 
+	var workSessionRef interface{}
+	if chat.WorkSessionID != 0 {
+		workSessionRef = int64(chat.WorkSessionID)
+	}
+
 	query := `
-		INSERT INTO chats (session_id, role, content_encrypted, timestamp)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO chats (session_id, work_session_id, role, content_encrypted, timestamp)
+		VALUES (?, ?, ?, ?, ?)
 	`
 
-	stmt, err := sm.getStmt(query)
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
-	}
-
-	result, err := stmt.Exec(sessionID, chat.Role, encryptedContent, chat.Timestamp)
+	result, err := sm.execCached(q, query, sessionID, workSessionRef, chat.Role, encryptedContent, chat.Timestamp)
 	if err != nil {
 		return NewStorageError(ErrDatabase, "failed to add chat", err)
 	}
@@ -266,10 +273,11 @@ func (sm *SessionManager) AddChat(sessionID int64, chat *ChatMessage) error {
 	return nil
 }
 
-// GetChats retrieves all chat messages for a session.
+// GetChats retrieves all chat messages for a session, including those
+// about one of its work sessions.
 func (sm *SessionManager) GetChats(sessionID int64) ([]ChatMessage, error) {
 	query := `
-		SELECT id, session_id, role, content_encrypted, timestamp
+		SELECT id, session_id, work_session_id, role, content_encrypted, timestamp
 		FROM chats
 		WHERE session_id = ?
 		ORDER BY timestamp ASC
@@ -281,13 +289,38 @@ func (sm *SessionManager) GetChats(sessionID int64) ([]ChatMessage, error) {
 	}
 	defer rows.Close()
 
+	return sm.scanChats(rows)
+}
+
+// GetWorkSessionChats retrieves the chat messages about a work session.
+func (sm *SessionManager) GetWorkSessionChats(workSessionID int64) ([]ChatMessage, error) {
+	query := `
+		SELECT id, session_id, work_session_id, role, content_encrypted, timestamp
+		FROM chats
+		WHERE work_session_id = ?
+		ORDER BY timestamp ASC
+	`
+
+	rows, err := sm.db.Query(query, workSessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get chats", err)
+	}
+	defer rows.Close()
+
+	return sm.scanChats(rows)
+}
+
+// scanChats scans and decrypts chat rows.
+func (sm *SessionManager) scanChats(rows *sql.Rows) ([]ChatMessage, error) {
 	var chats []ChatMessage
 	for rows.Next() {
 		var chat ChatMessage
+		var workSessionID sql.NullInt64
 		var encryptedContent []byte
 		err := rows.Scan(
 			&chat.ID,
 			&chat.SessionID,
+			&workSessionID,
 			&chat.Role,
 			&encryptedContent,
 			&chat.Timestamp,
@@ -295,6 +328,7 @@ func (sm *SessionManager) GetChats(sessionID int64) ([]ChatMessage, error) {
 		if err != nil {
 			return nil, NewStorageError(ErrDatabase, "failed to scan chat", err)
 		}
+		chat.WorkSessionID = types.ElementID(workSessionID.Int64)
 
 		// Decrypt content
 		if len(encryptedContent) > 0 && sm.encryptionMgr != nil {
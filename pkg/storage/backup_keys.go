@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// backupKeysName is the file in the backup directory holding the data keys
+// of backed up sessions, wrapped by the master key. Snapshots store their
+// database with the keys removed, so destroying a session's key here and in
+// the live database leaves the session unreadable in every snapshot.
+const backupKeysName = "keys.json"
+
+// recoveryKeyName is the file in the backup directory holding the recovery
+// key, so a copy of the directory can be restored without this machine's
+// vault.
+const recoveryKeyName = "recovery.json"
+
+// readBackupKeys returns the wrapped data keys kept for snapshots by ID.
+func (bm *BackupManager) readBackupKeys() (map[int64][]byte, error) {
+	keys := make(map[int64][]byte)
+	data, err := os.ReadFile(filepath.Join(bm.backupDir, backupKeysName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to read backup keys", err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, NewStorageError(ErrValidation, "invalid backup keys", err)
+	}
+	return keys, nil
+}
+
+// writeBackupKeys replaces the data keys kept for snapshots atomically.
+func (bm *BackupManager) writeBackupKeys(keys map[int64][]byte) error {
+	if err := bm.replaceJSONFile(backupKeysName, keys); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to write backup keys", err)
+	}
+	return nil
+}
+
+// replaceJSONFile atomically replaces a file in the backup directory with
+// data as JSON.
+func (bm *BackupManager) replaceJSONFile(name string, data interface{}) error {
+	path := filepath.Join(bm.backupDir, name)
+	if err := os.MkdirAll(bm.backupDir, 0755); err != nil {
+		return err
+	}
+	if err := bm.writeJSONFile(path+".tmp", data); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// writeRecoveryKey writes the recovery key for the current master key to
+// the backup directory. It returns a not found error if recovery is not set
+// up.
+func (bm *BackupManager) writeRecoveryKey() (*RecoveryKey, error) {
+	rk, err := bm.storageEngine.encryptionMgr.RecoveryKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := bm.replaceJSONFile(recoveryKeyName, rk); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to write recovery key", err)
+	}
+	return rk, nil
+}
+
+// canUnwrap reports whether an encryption manager holds the master key the
+// data keys kept for snapshots are wrapped by.
+func canUnwrap(keys map[int64][]byte, em *EncryptionManager) bool {
+	for _, wrapped := range keys {
+		_, err := em.Decrypt(wrapped)
+		return err == nil
+	}
+	return true
+}
+
+// saveBackupKeys adds the live data keys to those kept for snapshots. Keys
+// of sessions deleted since an older snapshot are already gone from both.
+func (bm *BackupManager) saveBackupKeys() error {
+	keys, err := bm.readBackupKeys()
+	if err != nil {
+		return err
+	}
+	live, err := bm.storageEngine.sessionMgr.ListDataKeys()
+	if err != nil {
+		return err
+	}
+	for id, wrapped := range live {
+		keys[id] = wrapped
+	}
+	return bm.writeBackupKeys(keys)
+}
+
+// ForgetBackupKey destroys a data key kept for snapshots, leaving the
+// session it sealed unreadable in all of them.
+func (bm *BackupManager) ForgetBackupKey(id int64) error {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	keys, err := bm.readBackupKeys()
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[id]; !ok {
+		return nil
+	}
+	delete(keys, id)
+	return bm.writeBackupKeys(keys)
+}
+
+// RewrapBackupKeys re-wraps the data keys kept for snapshots from one
+// master key to another. Keys the old key can't open are left as they are.
+// Returns the number of keys re-wrapped.
+func (bm *BackupManager) RewrapBackupKeys(from, to *EncryptionManager) (int, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	keys, err := bm.readBackupKeys()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for id, wrapped := range keys {
+		key, err := from.Decrypt(wrapped)
+		if err != nil {
+			continue
+		}
+		if keys[id], err = to.Encrypt(key); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return count, bm.writeBackupKeys(keys)
+}
+
+// sealSnapshotDatabase removes the data keys from a snapshot's copy of the
+// database, along with the note index, which holds note text in the clear.
+// Session fields stored unencrypted, and their full-text index, are kept.
+func sealSnapshotDatabase(path string) error {
+	db, err := sql.Open("sqlite", path+"?_pragma=secure_delete(ON)")
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to open backup database", err)
+	}
+	defer db.Close()
+
+	for _, query := range []string{
+		"UPDATE data_keys SET wrapped_key = NULL",
+		"DELETE FROM notes_fts",
+		"VACUUM",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			return NewStorageError(ErrDatabase, "failed to seal backup database", err)
+		}
+	}
+	return nil
+}
+
+// unsealSnapshotDatabase puts the kept data keys back into a restored
+// database. Sessions whose key has been destroyed keep a NULL key.
+func unsealSnapshotDatabase(path string, keys map[int64][]byte) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to open restored database", err)
+	}
+	defer db.Close()
+
+	for id, wrapped := range keys {
+		if _, err := db.Exec("UPDATE data_keys SET wrapped_key = ? WHERE id = ?", wrapped, id); err != nil {
+			return NewStorageError(ErrDatabase, "failed to restore data keys", err)
+		}
+	}
+	return nil
+}
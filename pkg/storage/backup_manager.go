@@ -1,19 +1,69 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// BackupManifestVersion is the version of snapshot manifests.
+	BackupManifestVersion = 2
+
+	backupManifestName = "manifest.json"
+	backupChunksDir    = "chunks"
+	// backupChunkSize is the size files are split into. Chunks are stored by
+	// the SHA-256 of their content, so unchanged parts of a file are shared
+	// between snapshots.
+	backupChunkSize = 4 << 20
+)
+
+// backupMu serializes snapshot creation and chunk garbage collection, so a
+// cleanup never removes chunks a backup in progress is about to reference.
+var backupMu sync.Mutex
+
+// backupSources are the directories under the data directory that are
+// backed up alongside the database.
+var backupSources = []string{"vectors", "files"}
+
+// BackupManifest lists every file of a snapshot with the chunks it is made
+// of. Each snapshot is complete on its own; only chunks are shared.
+type BackupManifest struct {
+	Version       int           `json:"version"`
+	Timestamp     time.Time     `json:"timestamp"`
+	DataDir       string        `json:"dataDir"`
+	Files         []BackupFile  `json:"files"`
+	ChunksWritten int           `json:"chunksWritten"` // New chunks this snapshot added to the store
+	BytesWritten  int64         `json:"bytesWritten"`
+	Stats         *StorageStats `json:"stats,omitempty"`
+	KeysSealed    bool          `json:"keysSealed,omitempty"` // Data keys are kept in keys.json, not the database
+}
+
+// BackupFile is a file in a snapshot, relative to the data directory.
+type BackupFile struct {
+	Path    string    `json:"path"` // Slash separated
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+	Chunks  []string  `json:"chunks"`
+}
+
 // BackupManager handles automated backups and recovery operations.
+// Snapshots live in backups/backup-<timestamp>/ and store only a manifest;
+// file content is kept in a shared, content-addressed chunk store in
+// backups/chunks/.
 type BackupManager struct {
-	config      *StorageConfig
-	backupDir   string
+	config        *StorageConfig
+	backupDir     string
 	storageEngine *StorageEngine
 }
 
@@ -27,52 +77,202 @@ func NewBackupManager(config *StorageConfig, storageEngine *StorageEngine) *Back
 	}
 }
 
-// CreateBackup creates a backup of the current storage state.
+// CreateBackup creates an incremental snapshot of the current storage state.
+// Files whose size and modification time match the previous snapshot reuse
+// its chunks without being read again.
 func (bm *BackupManager) CreateBackup() (string, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
 	// Create backup directory with timestamp (microsecond precision)
-	timestamp := time.Now().Format("20060102-150405.000000")
+	now := time.Now()
+	timestamp := now.Format("20060102-150405.000000")
 	backupPath := filepath.Join(bm.backupDir, fmt.Sprintf("backup-%s", timestamp))
-	
-	if err := os.MkdirAll(backupPath, 0755); err != nil {
+
+	if err := os.MkdirAll(filepath.Join(bm.backupDir, backupChunksDir), 0755); err != nil {
 		return "", NewStorageError(ErrFileSystem, "failed to create backup directory", err)
 	}
 
-	// Backup SQLite database using VACUUM INTO
+	previous := make(map[string]BackupFile)
+	if backups, err := bm.ListBackups(); err == nil {
+		for _, backup := range backups {
+			if manifest, err := bm.readManifest(backup.Path); err == nil {
+				for _, file := range manifest.Files {
+					previous[file.Path] = file
+				}
+				break
+			}
+		}
+	}
+
+	manifest := &BackupManifest{
+		Version:   BackupManifestVersion,
+		Timestamp: now,
+		DataDir:   bm.config.DataDir,
+	}
+
+	// Snapshot the database with VACUUM INTO, then chunk the copy
 	dbPath := filepath.Join(bm.config.DataDir, "waddle.db")
-	backupDBPath := filepath.Join(backupPath, "waddle.db")
-	
-	if err := bm.backupSQLiteDatabase(dbPath, backupDBPath); err != nil {
+	tempDBPath := filepath.Join(bm.backupDir, fmt.Sprintf(".waddle-%s.db", timestamp))
+	defer os.Remove(tempDBPath)
+	if err := bm.backupSQLiteDatabase(dbPath, tempDBPath); err != nil {
 		return "", err
 	}
+	if _, err := os.Stat(tempDBPath); err == nil {
+		// Keep the data keys out of the snapshot, so destroying one later
+		// reaches this copy too
+		if bm.storageEngine.sessionMgr != nil {
+			if err := bm.saveBackupKeys(); err != nil {
+				return "", err
+			}
+			if err := sealSnapshotDatabase(tempDBPath); err != nil {
+				return "", err
+			}
+			manifest.KeysSealed = true
+		}
+		if err := bm.addFile(manifest, tempDBPath, "waddle.db", nil); err != nil {
+			return "", err
+		}
+	}
 
-	// Backup vector database directory
-	vectorSrcPath := filepath.Join(bm.config.DataDir, "vectors")
-	vectorBackupPath := filepath.Join(backupPath, "vectors")
-	
-	if _, err := os.Stat(vectorSrcPath); err == nil {
-		if err := bm.copyDirectory(vectorSrcPath, vectorBackupPath); err != nil {
-			return "", NewStorageError(ErrFileSystem, "failed to backup vector database", err)
+	// Save the vector index first, so restoring the snapshot doesn't rebuild it
+	if bm.storageEngine.vectorMgr != nil {
+		if err := bm.storageEngine.vectorMgr.Flush(); err != nil {
+			return "", err
 		}
 	}
 
-	// Backup files directory
-	filesSrcPath := filepath.Join(bm.config.DataDir, "files")
-	filesBackupPath := filepath.Join(backupPath, "files")
-	
-	if _, err := os.Stat(filesSrcPath); err == nil {
-		if err := bm.copyDirectory(filesSrcPath, filesBackupPath); err != nil {
-			return "", NewStorageError(ErrFileSystem, "failed to backup files directory", err)
+	// Back up the vector database and files directories
+	for _, source := range backupSources {
+		srcPath := filepath.Join(bm.config.DataDir, source)
+		if _, err := os.Stat(srcPath); err != nil {
+			continue
+		}
+		err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(bm.config.DataDir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if prev, ok := previous[rel]; ok && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) && bm.hasChunks(prev.Chunks) {
+				manifest.Files = append(manifest.Files, prev)
+				return nil
+			}
+			return bm.addFile(manifest, path, rel, info)
+		})
+		if err != nil {
+			return "", NewStorageError(ErrFileSystem, "failed to back up "+source, err)
 		}
 	}
 
-	// Create backup metadata
-	if err := bm.createBackupMetadata(backupPath); err != nil {
+	// Get storage stats if available
+	if bm.storageEngine != nil && bm.storageEngine.fileMgr != nil {
+		if stats, err := bm.storageEngine.fileMgr.GetStorageStats(); err == nil {
+			manifest.Stats = stats
+		}
+	}
+
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return "", NewStorageError(ErrFileSystem, "failed to create backup directory", err)
+	}
+	if err := bm.writeManifest(backupPath, manifest); err != nil {
 		return "", err
 	}
 
 	return backupPath, nil
 }
 
+// addFile splits a file into chunks, stores the ones not yet in the chunk
+// store and adds the file to the manifest.
+func (bm *BackupManager) addFile(manifest *BackupManifest, srcPath, rel string, info os.FileInfo) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return NewStorageError(ErrFileSystem, "failed to open "+rel, err)
+	}
+	defer f.Close()
+
+	if info == nil {
+		if info, err = f.Stat(); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to stat "+rel, err)
+		}
+	}
+
+	file := BackupFile{Path: rel, ModTime: info.ModTime()}
+	fileHash := sha256.New()
+	buf := make([]byte, backupChunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			fileHash.Write(chunk)
+			sum := sha256.Sum256(chunk)
+			hash := hex.EncodeToString(sum[:])
+			written, err := bm.writeChunk(hash, chunk)
+			if err != nil {
+				return err
+			}
+			if written {
+				manifest.ChunksWritten++
+				manifest.BytesWritten += int64(n)
+			}
+			file.Chunks = append(file.Chunks, hash)
+			file.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return NewStorageError(ErrFileSystem, "failed to read "+rel, err)
+		}
+	}
+	file.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+
+	manifest.Files = append(manifest.Files, file)
+	return nil
+}
+
+// chunkPath returns the path of a chunk in the chunk store.
+func (bm *BackupManager) chunkPath(hash string) string {
+	return filepath.Join(bm.backupDir, backupChunksDir, hash[:2], hash)
+}
+
+// writeChunk stores a chunk unless the store already has it. It reports
+// whether the chunk was written.
+func (bm *BackupManager) writeChunk(hash string, data []byte) (bool, error) {
+	path := bm.chunkPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, NewStorageError(ErrFileSystem, "failed to create chunk directory", err)
+	}
+
+	// Write to a temporary file first so an interrupted backup never
+	// leaves a truncated chunk under its hash
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return false, NewStorageError(ErrFileSystem, "failed to write chunk", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, NewStorageError(ErrFileSystem, "failed to write chunk", err)
+	}
+	return true, nil
+}
+
+// hasChunks reports whether every chunk is in the chunk store.
+func (bm *BackupManager) hasChunks(chunks []string) bool {
+	for _, hash := range chunks {
+		if _, err := os.Stat(bm.chunkPath(hash)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // backupSQLiteDatabase creates a backup of the SQLite database using VACUUM INTO.
 func (bm *BackupManager) backupSQLiteDatabase(srcPath, dstPath string) error {
 	// Check if source database exists
@@ -177,25 +377,25 @@ func (bm *BackupManager) copyFile(src, dst string) error {
 	return err
 }
 
-// createBackupMetadata creates metadata for the backup.
-func (bm *BackupManager) createBackupMetadata(backupPath string) error {
-	metadata := map[string]interface{}{
-		"timestamp":    time.Now().Format(time.RFC3339),
-		"version":      "1.0",
-		"dataDir":      bm.config.DataDir,
-		"retentionDays": bm.config.RetentionDays,
+// writeManifest writes a snapshot manifest.
+func (bm *BackupManager) writeManifest(backupPath string, manifest *BackupManifest) error {
+	if err := bm.writeJSONFile(filepath.Join(backupPath, backupManifestName), manifest); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to write backup manifest", err)
 	}
+	return nil
+}
 
-	// Get storage stats if available
-	if bm.storageEngine != nil && bm.storageEngine.fileMgr != nil {
-		if stats, err := bm.storageEngine.fileMgr.GetStorageStats(); err == nil {
-			metadata["stats"] = stats
-		}
+// readManifest reads a snapshot manifest.
+func (bm *BackupManager) readManifest(backupPath string) (*BackupManifest, error) {
+	data, err := os.ReadFile(filepath.Join(backupPath, backupManifestName))
+	if err != nil {
+		return nil, NewStorageError(ErrNotFound, "backup manifest not found", err)
 	}
-
-	// Write metadata to JSON file
-	metadataPath := filepath.Join(backupPath, "backup_metadata.json")
-	return bm.writeJSONFile(metadataPath, metadata)
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, NewStorageError(ErrValidation, "invalid backup manifest", err)
+	}
+	return &manifest, nil
 }
 
 // writeJSONFile writes data to a JSON file.
@@ -211,13 +411,73 @@ func (bm *BackupManager) writeJSONFile(path string, data interface{}) error {
 	return encoder.Encode(data)
 }
 
-// VerifyBackup verifies the integrity of a backup.
+// VerifyBackup verifies the integrity of a backup. Every chunk is re-hashed
+// and checked against the manifest, and the database is reassembled and
+// checked with PRAGMA integrity_check.
 func (bm *BackupManager) VerifyBackup(backupPath string) error {
 	// Check if backup directory exists
 	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
 		return NewStorageError(ErrNotFound, "backup directory not found", err)
 	}
 
+	if _, err := os.Stat(filepath.Join(backupPath, backupManifestName)); os.IsNotExist(err) {
+		return bm.verifyLegacyBackup(backupPath)
+	}
+
+	manifest, err := bm.readManifest(backupPath)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Files) == 0 {
+		return NewStorageError(ErrValidation, "backup contains no data", nil)
+	}
+
+	for _, file := range manifest.Files {
+		if err := bm.verifyFile(file); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range manifest.Files {
+		if file.Path != "waddle.db" {
+			continue
+		}
+		tempDBPath := filepath.Join(bm.backupDir, ".verify-"+filepath.Base(backupPath)+".db")
+		defer os.Remove(tempDBPath)
+		if err := bm.restoreFile(file, tempDBPath); err != nil {
+			return err
+		}
+		return bm.verifySQLiteIntegrity(tempDBPath)
+	}
+
+	return nil
+}
+
+// verifyFile re-hashes a file's chunks and the file as a whole.
+func (bm *BackupManager) verifyFile(file BackupFile) error {
+	fileHash := sha256.New()
+	var size int64
+	for _, hash := range file.Chunks {
+		data, err := os.ReadFile(bm.chunkPath(hash))
+		if err != nil {
+			return NewStorageError(ErrValidation, fmt.Sprintf("chunk %s of %s is missing", hash, file.Path), err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != hash {
+			return NewStorageError(ErrValidation, fmt.Sprintf("chunk %s of %s is corrupt", hash, file.Path), nil)
+		}
+		fileHash.Write(data)
+		size += int64(len(data))
+	}
+	if size != file.Size || hex.EncodeToString(fileHash.Sum(nil)) != file.SHA256 {
+		return NewStorageError(ErrValidation, "checksum mismatch for "+file.Path, nil)
+	}
+	return nil
+}
+
+// verifyLegacyBackup verifies a backup made before snapshots were
+// chunked, which holds plain copies of the data.
+func (bm *BackupManager) verifyLegacyBackup(backupPath string) error {
 	// Verify SQLite database integrity
 	dbBackupPath := filepath.Join(backupPath, "waddle.db")
 	if _, err := os.Stat(dbBackupPath); err == nil {
@@ -236,8 +496,6 @@ func (bm *BackupManager) VerifyBackup(backupPath string) error {
 
 // verifySQLiteIntegrity runs PRAGMA integrity_check on the backup database.
 func (bm *BackupManager) verifySQLiteIntegrity(dbPath string) error {
-	// This would require opening the backup database separately
-	// For now, we'll just check that the file exists and is not empty
 	info, err := os.Stat(dbPath)
 	if err != nil {
 		return NewStorageError(ErrFileSystem, "backup database file not accessible", err)
@@ -247,6 +505,20 @@ func (bm *BackupManager) verifySQLiteIntegrity(dbPath string) error {
 		return NewStorageError(ErrValidation, "backup database file is empty", nil)
 	}
 
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to open backup database", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return NewStorageError(ErrValidation, "backup database is not readable", err)
+	}
+	if result != "ok" {
+		return NewStorageError(ErrValidation, "backup database failed integrity check: "+result, nil)
+	}
+
 	return nil
 }
 
@@ -260,15 +532,15 @@ func (bm *BackupManager) verifyBackupStructure(backupPath string) error {
 
 	// Check for at least one of: database, vectors, or files
 	hasContent := false
-	
+
 	if _, err := os.Stat(filepath.Join(backupPath, "waddle.db")); err == nil {
 		hasContent = true
 	}
-	
+
 	if _, err := os.Stat(filepath.Join(backupPath, "vectors")); err == nil {
 		hasContent = true
 	}
-	
+
 	if _, err := os.Stat(filepath.Join(backupPath, "files")); err == nil {
 		hasContent = true
 	}
@@ -280,31 +552,85 @@ func (bm *BackupManager) verifyBackupStructure(backupPath string) error {
 	return nil
 }
 
-// Restore restores the system from a backup.
-func (bm *BackupManager) Restore(backupPath string) error {
+// RestoreOptions controls a restore.
+type RestoreOptions struct {
+	// RecoveryKey and Passphrase unlock backups made under another master
+	// key, as on another machine or after the vault was lost. The recovered
+	// key replaces this machine's.
+	RecoveryKey *RecoveryKey `json:"recoveryKey,omitempty"`
+	Passphrase  string       `json:"passphrase,omitempty"`
+}
+
+// Restore restores the system from a backup. Any snapshot can be restored,
+// since each manifest lists the complete state. Sessions deleted after the
+// snapshot was taken stay deleted, as their data keys are gone.
+//
+// Writes to the engine wait until the restore is done, and backups and
+// their cleanup don't run during it. Reads aren't held back, so callers
+// stop capture and background work first.
+func (bm *BackupManager) Restore(backupPath string, opts RestoreOptions) error {
+	// Writes take writeMu before backupMu, so it's locked first
+	se := bm.storageEngine
+	se.writeMu.Lock()
+	defer se.writeMu.Unlock()
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
 	// Verify backup before restore
 	if err := bm.VerifyBackup(backupPath); err != nil {
 		return NewStorageError(ErrValidation, "backup verification failed", err)
 	}
 
+	manifest, err := bm.readManifest(backupPath)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	sealed := manifest != nil && manifest.KeysSealed
+	var keys map[int64][]byte
+	if sealed {
+		// Without the key file every session would read as deleted
+		if _, err := os.Stat(filepath.Join(bm.backupDir, backupKeysName)); err != nil {
+			return NewStorageError(ErrNotFound, "backup keys not found", err)
+		}
+		if keys, err = bm.readBackupKeys(); err != nil {
+			return err
+		}
+	}
+
+	// Check the backups open under the key they'll be restored with before
+	// anything is replaced
+	em := bm.storageEngine.encryptionMgr
+	if opts.RecoveryKey != nil {
+		if em, err = opts.RecoveryKey.manager(opts.Passphrase); err != nil {
+			return err
+		}
+	}
+	if sealed && !canUnwrap(keys, em) {
+		return NewStorageError(ErrValidation, "backup was made under another key; restore it with its recovery key", nil)
+	}
+
 	// Close storage engine to release locks
 	if err := bm.storageEngine.Close(); err != nil {
 		return NewStorageError(ErrDatabase, "failed to close storage engine", err)
 	}
 
-	// Restore database
-	if err := bm.restoreDatabase(backupPath); err != nil {
-		return err
+	if manifest != nil {
+		err = bm.restoreSnapshot(manifest)
+	} else {
+		err = bm.restoreLegacyBackup(backupPath)
 	}
-
-	// Restore vector database
-	if err := bm.restoreVectorDatabase(backupPath); err != nil {
+	if err != nil {
 		return err
 	}
-
-	// Restore files
-	if err := bm.restoreFiles(backupPath); err != nil {
-		return err
+	if sealed {
+		if err := unsealSnapshotDatabase(filepath.Join(bm.config.DataDir, "waddle.db"), keys); err != nil {
+			return err
+		}
+	}
+	if opts.RecoveryKey != nil {
+		if err := bm.storageEngine.encryptionMgr.RecoverKey(opts.RecoveryKey, opts.Passphrase); err != nil {
+			return err
+		}
 	}
 
 	// Reinitialize storage engine
@@ -312,17 +638,125 @@ func (bm *BackupManager) Restore(backupPath string) error {
 		return NewStorageError(ErrDatabase, "failed to reinitialize after restore", err)
 	}
 
+	// Sessions deleted since the snapshot are unreadable; finish deleting
+	// them and rebuild the note index the snapshot left out
+	if sealed {
+		dates, err := bm.storageEngine.sessionMgr.GetShreddedSessions()
+		if err != nil {
+			return err
+		}
+		for _, date := range dates {
+			// Their keys are already gone from the key file
+			if err := se.deleteSession(date, false); err != nil {
+				return err
+			}
+		}
+		if _, err := bm.storageEngine.sessionMgr.RebuildNoteIndex(); err != nil {
+			return err
+		}
+	}
+
+	// Purges made after the snapshot was taken are applied again
+	if backup, err := bm.getBackupInfo(backupPath); err == nil {
+		if _, err := bm.reapplyPurges(*backup); err != nil {
+			return err
+		}
+	}
+	if opts.RecoveryKey != nil {
+		if _, err := bm.writeRecoveryKey(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreSnapshot replaces the database, vector database and files with
+// the contents of a snapshot.
+func (bm *BackupManager) restoreSnapshot(manifest *BackupManifest) error {
+	if err := bm.removeDatabase(); err != nil {
+		return err
+	}
+	for _, source := range backupSources {
+		if err := os.RemoveAll(filepath.Join(bm.config.DataDir, source)); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to remove current "+source+" directory", err)
+		}
+	}
+
+	for _, file := range manifest.Files {
+		dstPath := filepath.Join(bm.config.DataDir, filepath.FromSlash(file.Path))
+		if err := bm.restoreFile(file, dstPath); err != nil {
+			return err
+		}
+		os.Chtimes(dstPath, file.ModTime, file.ModTime)
+	}
+
+	return nil
+}
+
+// restoreFile reassembles a file from its chunks.
+func (bm *BackupManager) restoreFile(file BackupFile, dstPath string) error {
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to create directory", err)
+	}
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return NewStorageError(ErrFileSystem, "failed to restore "+file.Path, err)
+	}
+	defer out.Close()
+
+	for _, hash := range file.Chunks {
+		data, err := os.ReadFile(bm.chunkPath(hash))
+		if err != nil {
+			return NewStorageError(ErrFileSystem, fmt.Sprintf("failed to read chunk %s of %s", hash, file.Path), err)
+		}
+		if _, err := out.Write(data); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to restore "+file.Path, err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to restore "+file.Path, err)
+	}
+	return nil
+}
+
+// removeDatabase removes the current database along with its WAL files, so
+// a stale log is never replayed onto the restored database.
+func (bm *BackupManager) removeDatabase() error {
+	dbPath := filepath.Join(bm.config.DataDir, "waddle.db")
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return NewStorageError(ErrFileSystem, "failed to remove current database", err)
+		}
+	}
 	return nil
 }
 
+// restoreLegacyBackup restores a backup made before snapshots were chunked.
+func (bm *BackupManager) restoreLegacyBackup(backupPath string) error {
+	// Restore database
+	if err := bm.restoreDatabase(backupPath); err != nil {
+		return err
+	}
+
+	// Restore vector database
+	if err := bm.restoreVectorDatabase(backupPath); err != nil {
+		return err
+	}
+
+	// Restore files
+	return bm.restoreFiles(backupPath)
+}
+
 // restoreDatabase restores the SQLite database from backup.
 func (bm *BackupManager) restoreDatabase(backupPath string) error {
 	srcPath := filepath.Join(backupPath, "waddle.db")
 	dstPath := filepath.Join(bm.config.DataDir, "waddle.db")
 
 	// Remove current database
-	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
-		return NewStorageError(ErrFileSystem, "failed to remove current database", err)
+	if err := bm.removeDatabase(); err != nil {
+		return err
 	}
 
 	// Copy backup database
@@ -375,15 +809,6 @@ func (bm *BackupManager) restoreFiles(backupPath string) error {
 	return nil
 }
 
-// rollbackRestore attempts to rollback a failed restore.
-func (bm *BackupManager) rollbackRestore(currentBackupPath string) error {
-	// This is a best-effort rollback
-	bm.restoreDatabase(currentBackupPath)
-	bm.restoreVectorDatabase(currentBackupPath)
-	bm.restoreFiles(currentBackupPath)
-	return nil
-}
-
 // ListBackups returns a list of available backups.
 func (bm *BackupManager) ListBackups() ([]BackupInfo, error) {
 	if _, err := os.Stat(bm.backupDir); os.IsNotExist(err) {
@@ -423,7 +848,30 @@ func (bm *BackupManager) getBackupInfo(backupPath string) (*BackupInfo, error) {
 		return nil, err
 	}
 
-	// Try to read metadata
+	if manifest, err := bm.readManifest(backupPath); err == nil {
+		var size int64
+		for _, file := range manifest.Files {
+			size += file.Size
+		}
+		backup := &BackupInfo{
+			Path:      backupPath,
+			Name:      filepath.Base(backupPath),
+			Timestamp: manifest.Timestamp,
+			Size:      size,
+			Metadata: map[string]interface{}{
+				"version":       manifest.Version,
+				"files":         len(manifest.Files),
+				"chunksWritten": manifest.ChunksWritten,
+				"bytesWritten":  manifest.BytesWritten,
+			},
+		}
+		if pending, err := bm.pendingPurges(*backup); err == nil && len(pending) > 0 {
+			backup.Metadata["purgesPending"] = len(pending)
+		}
+		return backup, nil
+	}
+
+	// Try to read legacy metadata
 	metadataPath := filepath.Join(backupPath, "backup_metadata.json")
 	var metadata map[string]interface{}
 	if data, err := os.ReadFile(metadataPath); err == nil {
@@ -462,28 +910,115 @@ func (bm *BackupManager) calculateDirectorySize(dirPath string) (int64, error) {
 	return size, err
 }
 
-// CleanupOldBackups removes backups older than the retention period.
+// CleanupOldBackups applies a grandfather-father-son policy: the newest
+// snapshot of each of the last BackupKeepDaily days, BackupKeepWeekly weeks
+// and BackupKeepMonthly months that have snapshots is kept, as is the newest
+// snapshot overall. Chunks no longer referenced by a kept snapshot are then
+// removed.
 func (bm *BackupManager) CleanupOldBackups() error {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
 	backups, err := bm.ListBackups()
 	if err != nil {
 		return err
 	}
 
-	retentionDuration := time.Duration(bm.config.RetentionDays) * 24 * time.Hour
-	cutoffTime := time.Now().Add(-retentionDuration)
-
-	var deletedCount int
+	keep := selectBackupsToKeep(backups, bm.config.BackupKeepDaily, bm.config.BackupKeepWeekly, bm.config.BackupKeepMonthly)
 	for _, backup := range backups {
-		if backup.Timestamp.Before(cutoffTime) {
-			if err := os.RemoveAll(backup.Path); err != nil {
-				// Log error but continue
-				continue
+		if keep[backup.Path] {
+			continue
+		}
+		if err := os.RemoveAll(backup.Path); err != nil {
+			// Log error but continue
+			continue
+		}
+	}
+
+	return bm.collectChunks()
+}
+
+// selectBackupsToKeep returns the paths of the backups a
+// grandfather-father-son policy keeps. backups must be sorted newest first.
+func selectBackupsToKeep(backups []BackupInfo, daily, weekly, monthly int) map[string]bool {
+	keep := make(map[string]bool)
+	if len(backups) == 0 {
+		return keep
+	}
+	keep[backups[0].Path] = true
+
+	periods := []struct {
+		count int
+		key   func(t time.Time) string
+	}{
+		{daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, period := range periods {
+		seen := make(map[string]bool)
+		for _, backup := range backups {
+			if len(seen) >= period.count {
+				break
+			}
+			key := period.key(backup.Timestamp.Local())
+			if !seen[key] {
+				seen[key] = true
+				keep[backup.Path] = true
 			}
-			deletedCount++
 		}
 	}
 
-	return nil
+	return keep
+}
+
+// collectChunks removes chunks that no remaining snapshot references, along
+// with temporary files left by interrupted backups.
+func (bm *BackupManager) collectChunks() error {
+	chunksDir := filepath.Join(bm.backupDir, backupChunksDir)
+	if _, err := os.Stat(chunksDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	entries, err := os.ReadDir(bm.backupDir)
+	if err != nil {
+		return NewStorageError(ErrFileSystem, "failed to read backup directory", err)
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "backup-") {
+			continue
+		}
+		manifest, err := bm.readManifest(filepath.Join(bm.backupDir, entry.Name()))
+		if IsNotFound(err) {
+			continue // Legacy backup without chunks
+		}
+		if err != nil {
+			// A snapshot we can't read might reference any chunk
+			return err
+		}
+		for _, file := range manifest.Files {
+			for _, hash := range file.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+
+	return filepath.Walk(chunksDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if referenced[info.Name()] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to remove chunk", err)
+		}
+		return nil
+	})
 }
 
 // BackupInfo contains information about a backup.
@@ -493,4 +1028,4 @@ type BackupInfo struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Size      int64                  `json:"size"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-}
\ No newline at end of file
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -95,7 +99,7 @@ func TestBackupRestoreRoundTrip(t *testing.T) {
 			}
 
 			// Restore from backup
-			if err := backupMgr.Restore(backupPath); err != nil {
+			if err := backupMgr.Restore(backupPath, RestoreOptions{}); err != nil {
 				t.Logf("Failed to restore from backup: %v", err)
 				return false
 			}
@@ -198,15 +202,18 @@ func TestBackupCreation(t *testing.T) {
 		t.Error("Backup directory was not created")
 	}
 
-	// Verify backup metadata exists
-	metadataPath := filepath.Join(backupPath, "backup_metadata.json")
-	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
-		t.Error("Backup metadata was not created")
+	// Verify the manifest lists the database
+	manifest, err := backupMgr.readManifest(backupPath)
+	if err != nil {
+		t.Fatalf("Backup manifest was not created: %v", err)
 	}
-
-	// Verify database backup exists
-	dbBackupPath := filepath.Join(backupPath, "waddle.db")
-	if _, err := os.Stat(dbBackupPath); os.IsNotExist(err) {
+	hasDB := false
+	for _, file := range manifest.Files {
+		if file.Path == "waddle.db" && len(file.Chunks) > 0 {
+			hasDB = true
+		}
+	}
+	if !hasDB {
 		t.Error("Database backup was not created")
 	}
 
@@ -216,69 +223,208 @@ func TestBackupCreation(t *testing.T) {
 	}
 }
 
-// TestBackupRetention tests backup cleanup functionality
+// TestBackupRetention tests the grandfather-father-son backup cleanup
 func TestBackupRetention(t *testing.T) {
-	tempDir := t.TempDir()
-	storageDir := filepath.Join(tempDir, "storage")
-	
-	// Initialize storage engine with short retention
-	config := DefaultStorageConfig(storageDir)
-	config.RetentionDays = 1 // 1 day retention for testing
+	day := func(daysAgo int) time.Time {
+		return time.Date(2025, 3, 31, 12, 0, 0, 0, time.Local).AddDate(0, 0, -daysAgo)
+	}
+
+	// Two snapshots on the newest day, then one a day going back 90 days
+	backups := []BackupInfo{{Path: "latest", Timestamp: day(0).Add(time.Hour)}}
+	for i := 0; i <= 90; i++ {
+		backups = append(backups, BackupInfo{Path: fmt.Sprintf("day-%d", i), Timestamp: day(i)})
+	}
+
+	keep := selectBackupsToKeep(backups, 3, 2, 3)
+	for _, path := range []string{"latest", "day-1", "day-2"} {
+		if !keep[path] {
+			t.Errorf("Expected %s to be kept", path)
+		}
+	}
+	if keep["day-0"] {
+		t.Error("Expected the older snapshot of the newest day to be removed")
+	}
+	// 2025-03-31 is a Monday: the previous week's newest snapshot is a day old
+	// and the previous months' are their last days
+	for _, path := range []string{"day-31", "day-59"} {
+		if !keep[path] {
+			t.Errorf("Expected monthly snapshot %s to be kept", path)
+		}
+	}
+	if len(keep) != 5 {
+		t.Errorf("Expected 5 snapshots kept, got %d: %v", len(keep), keep)
+	}
+
+	if keep := selectBackupsToKeep(backups, 0, 0, 0); len(keep) != 1 || !keep["latest"] {
+		t.Errorf("Expected only the newest snapshot to be kept, got %v", keep)
+	}
+}
+
+// TestIncrementalBackup tests that snapshots share chunks, that verification
+// re-hashes them, that any snapshot restores and that cleanup keeps chunks
+// still referenced.
+func TestIncrementalBackup(t *testing.T) {
+	config := DefaultStorageConfig(filepath.Join(t.TempDir(), "storage"))
 	storageEngine := NewStorageEngine(config)
 	if err := storageEngine.Initialize(); err != nil {
 		t.Fatalf("Failed to initialize storage engine: %v", err)
 	}
 	defer storageEngine.Close()
 
-	// Create backup manager
+	session, err := storageEngine.CreateSession("2025-03-01")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	session.CustomTitle = "First"
+	if err := storageEngine.UpdateSession(session); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	screenshot := bytes.Repeat([]byte("png"), 1000)
+	if _, err := storageEngine.SaveScreenshot(session.Date, "Code", "shot.png", screenshot); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+
 	backupMgr := NewBackupManager(config, storageEngine)
+	first, err := backupMgr.CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
 
-	// Create multiple backups with different timestamps
-	backupPaths := make([]string, 3)
-	for i := 0; i < 3; i++ {
-		// Add delay to ensure different timestamps
-		if i > 0 {
-			time.Sleep(10 * time.Millisecond)
+	session.CustomTitle = "Second"
+	if err := storageEngine.UpdateSession(session); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	second, err := backupMgr.CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	firstManifest, _ := backupMgr.readManifest(first)
+	secondManifest, err := backupMgr.readManifest(second)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	// Only the changed database is stored again; the screenshot is shared
+	if secondManifest.ChunksWritten != 1 || len(secondManifest.Files) != len(firstManifest.Files) {
+		t.Errorf("Expected only the database to be written, got %d chunks for %d files",
+			secondManifest.ChunksWritten, len(secondManifest.Files))
+	}
+
+	t.Run("Restores an older snapshot", func(t *testing.T) {
+		if err := backupMgr.Restore(first, RestoreOptions{}); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
 		}
-		
-		backupPath, err := backupMgr.CreateBackup()
-		if err != nil {
-			t.Fatalf("Failed to create backup %d: %v", i, err)
+		restored, err := storageEngine.GetSession("2025-03-01")
+		if err != nil || restored.CustomTitle != "First" {
+			t.Errorf("Expected the first snapshot's title, got %+v (%v)", restored, err)
+		}
+		data, err := storageEngine.ReadFile(filepath.Join(session.Date, "Code", "screenshots", "shot.png"))
+		if err != nil || !bytes.Equal(data, screenshot) {
+			t.Errorf("Expected the screenshot to be restored (%v)", err)
+		}
+	})
+
+	t.Run("Cleanup keeps shared chunks", func(t *testing.T) {
+		config.BackupKeepDaily, config.BackupKeepWeekly, config.BackupKeepMonthly = 0, 0, 0
+		if err := backupMgr.CleanupOldBackups(); err != nil {
+			t.Fatalf("Cleanup failed: %v", err)
+		}
+		if _, err := os.Stat(first); !os.IsNotExist(err) {
+			t.Errorf("Expected the older snapshot to be removed, got %v", err)
 		}
-		backupPaths[i] = backupPath
+		for _, file := range firstManifest.Files {
+			if file.Path == "waddle.db" {
+				if _, err := os.Stat(backupMgr.chunkPath(file.Chunks[0])); !os.IsNotExist(err) {
+					t.Errorf("Expected the unreferenced database chunk to be removed")
+				}
+			}
+		}
+		if err := backupMgr.VerifyBackup(second); err != nil {
+			t.Errorf("Expected the remaining snapshot to verify, got %v", err)
+		}
+	})
 
-		// Modify timestamp to simulate old backups
-		if i < 2 {
-			oldTime := time.Now().Add(-time.Duration(2+i) * 24 * time.Hour)
-			if err := os.Chtimes(backupPath, oldTime, oldTime); err != nil {
-				t.Logf("Failed to modify backup timestamp: %v", err)
+	t.Run("Verify detects corrupt chunks", func(t *testing.T) {
+		ref, err := storageEngine.StatScreenshot(storageEngine.GetScreenshotPath(session.Date, "Code", "shot.png"))
+		if err != nil {
+			t.Fatalf("Failed to stat screenshot: %v", err)
+		}
+		for _, file := range secondManifest.Files {
+			if strings.HasSuffix(file.Path, ref.Hash) {
+				if err := os.WriteFile(backupMgr.chunkPath(file.Chunks[0]), []byte("tampered"), 0644); err != nil {
+					t.Fatalf("Failed to corrupt chunk: %v", err)
+				}
 			}
 		}
+		if err := backupMgr.VerifyBackup(second); !IsValidation(err) {
+			t.Errorf("Expected validation error for a corrupt chunk, got %v", err)
+		}
+	})
+}
+
+// TestRestoreDuringCapture restores a snapshot while activity blocks are
+// being added. Writes wait for the restore instead of failing.
+func TestRestoreDuringCapture(t *testing.T) {
+	config := DefaultStorageConfig(filepath.Join(t.TempDir(), "storage"))
+	storageEngine := NewStorageEngine(config)
+	if err := storageEngine.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
 	}
+	defer storageEngine.Close()
 
-	// List backups before cleanup
-	backups, err := backupMgr.ListBackups()
+	session, err := storageEngine.CreateSession("2025-03-01")
 	if err != nil {
-		t.Fatalf("Failed to list backups: %v", err)
+		t.Fatalf("Failed to create session: %v", err)
 	}
-
-	if len(backups) != 3 {
-		t.Errorf("Expected 3 backups, got %d", len(backups))
+	backupMgr := NewBackupManager(config, storageEngine)
+	backupPath, err := backupMgr.CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
 	}
 
-	// Run cleanup
-	if err := backupMgr.CleanupOldBackups(); err != nil {
-		t.Fatalf("Failed to cleanup old backups: %v", err)
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				block := &ActivityBlock{
+					BlockID:   fmt.Sprintf("%d-%d", w, i),
+					StartTime: time.Now(),
+					EndTime:   time.Now().Add(time.Minute),
+					OCRText:   "Captured during restore",
+				}
+				if err := storageEngine.AddActivityBlock(session.Date, "Code", block); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
 	}
 
-	// List backups after cleanup
-	backups, err = backupMgr.ListBackups()
-	if err != nil {
-		t.Fatalf("Failed to list backups after cleanup: %v", err)
-	}
+	time.Sleep(50 * time.Millisecond)
+	restoreErr := backupMgr.Restore(backupPath, RestoreOptions{})
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	close(errs)
 
-	// Should have fewer backups now (exact count depends on timing)
-	if len(backups) > 2 {
-		t.Errorf("Expected cleanup to remove old backups, still have %d", len(backups))
+	if restoreErr != nil {
+		t.Fatalf("Failed to restore: %v", restoreErr)
+	}
+	for err := range errs {
+		t.Errorf("Expected writes to wait for the restore, got %v", err)
 	}
-}
\ No newline at end of file
+	if err := storageEngine.AddActivityBlock(session.Date, "Code", &ActivityBlock{
+		BlockID: "after", StartTime: time.Now(), EndTime: time.Now().Add(time.Minute),
+	}); err != nil {
+		t.Errorf("Failed to add a block after the restore: %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// purgeLogName is the file in the backup directory logging purges that
+// snapshots taken before them still hold data for. Restoring one of those
+// snapshots applies the purges again.
+const purgeLogName = "purges.json"
+
+// purgeLogEntry is a logged purge. The request is sealed with the master
+// key, since its term is often the very thing being forgotten.
+type purgeLogEntry struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Sealed    []byte    `json:"sealed"`              // The request as JSON
+	Rewritten []string  `json:"rewritten,omitempty"` // Snapshots already purged
+}
+
+// pending reports whether a snapshot was taken before the purge and still
+// holds what it erased.
+func (e *purgeLogEntry) pending(backup BackupInfo) bool {
+	return backup.Timestamp.Before(e.CreatedAt) && !slices.Contains(e.Rewritten, backup.Name)
+}
+
+// readPurgeLog returns the logged purges, oldest first.
+func (bm *BackupManager) readPurgeLog() ([]purgeLogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(bm.backupDir, purgeLogName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to read purge log", err)
+	}
+	var entries []purgeLogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, NewStorageError(ErrValidation, "invalid purge log", err)
+	}
+	return entries, nil
+}
+
+// writePurgeLog replaces the purge log, dropping purges no remaining
+// snapshot is pending.
+func (bm *BackupManager) writePurgeLog(entries []purgeLogEntry) error {
+	backups, err := bm.ListBackups()
+	if err != nil {
+		return err
+	}
+	entries = slices.DeleteFunc(entries, func(e purgeLogEntry) bool {
+		return !slices.ContainsFunc(backups, e.pending)
+	})
+	if len(entries) == 0 {
+		if err := os.Remove(filepath.Join(bm.backupDir, purgeLogName)); err != nil && !os.IsNotExist(err) {
+			return NewStorageError(ErrFileSystem, "failed to remove purge log", err)
+		}
+		return nil
+	}
+	if err := bm.replaceJSONFile(purgeLogName, entries); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to write purge log", err)
+	}
+	return nil
+}
+
+// pendingPurges returns the logged purges a snapshot still holds data for.
+func (bm *BackupManager) pendingPurges(backup BackupInfo) ([]purgeLogEntry, error) {
+	entries, err := bm.readPurgeLog()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(e purgeLogEntry) bool { return !e.pending(backup) }), nil
+}
+
+// purgeBackups flags or rewrites the snapshots taken before a purge.
+// Snapshots that can't be rewritten, such as those from an older schema,
+// are flagged instead. Returns the number of snapshots flagged and
+// rewritten.
+func (bm *BackupManager) purgeBackups(report *PurgeReport) (int, int, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	backups, err := bm.ListBackups()
+	if err != nil || len(backups) == 0 {
+		return 0, 0, err
+	}
+	req := report.Request
+	entry := purgeLogEntry{ID: report.GeneratedAt.Format("20060102-150405.000000"), CreatedAt: report.GeneratedAt}
+
+	if req.Backups == PurgeBackupsRewrite {
+		m, err := newPurgeMatcher(req)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, backup := range backups {
+			rewritten, err := bm.rewriteSnapshot(backup, m)
+			if err != nil {
+				return 0, len(entry.Rewritten), err
+			}
+			if rewritten {
+				entry.Rewritten = append(entry.Rewritten, backup.Name)
+			}
+		}
+		if err := bm.collectChunks(); err != nil {
+			return 0, len(entry.Rewritten), err
+		}
+	}
+
+	flagged := 0
+	for _, backup := range backups {
+		if entry.pending(backup) {
+			flagged++
+		}
+	}
+	if flagged > 0 {
+		req.Backups = PurgeBackupsKeep
+		data, err := json.Marshal(req)
+		if err != nil {
+			return 0, len(entry.Rewritten), NewStorageError(ErrValidation, "failed to encode purge", err)
+		}
+		if entry.Sealed, err = bm.storageEngine.encryptionMgr.Encrypt(data); err != nil {
+			return 0, len(entry.Rewritten), err
+		}
+	}
+	entries, err := bm.readPurgeLog()
+	if err != nil {
+		return 0, len(entry.Rewritten), err
+	}
+	return flagged, len(entry.Rewritten), bm.writePurgeLog(append(entries, entry))
+}
+
+// rewriteSnapshot purges a snapshot's database, vector store and files,
+// storing the changed files as new chunks and updating its manifest.
+// Reports false for snapshots it can't rewrite: legacy ones and those with
+// another schema version. The caller holds backupMu.
+func (bm *BackupManager) rewriteSnapshot(backup BackupInfo, m *purgeMatcher) (bool, error) {
+	manifest, err := bm.readManifest(backup.Path)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(manifest.Files, func(f BackupFile) bool { return f.Path == "waddle.db" })
+	if manifest.Version != BackupManifestVersion || i < 0 {
+		return false, nil
+	}
+
+	tmp, err := os.MkdirTemp(bm.backupDir, ".purge-")
+	if err != nil {
+		return false, NewStorageError(ErrFileSystem, "failed to create temporary directory", err)
+	}
+	defer os.RemoveAll(tmp)
+	dbPath := filepath.Join(tmp, "waddle.db")
+	if err := bm.restoreFile(manifest.Files[i], dbPath); err != nil {
+		return false, err
+	}
+
+	items, dropped, err := bm.purgeSnapshotDatabase(dbPath, manifest.KeysSealed, m)
+	if err != nil || len(items) == 0 {
+		return items != nil, err
+	}
+
+	files := []BackupFile{}
+	rewritten := &BackupManifest{
+		Version: manifest.Version, Timestamp: manifest.Timestamp, DataDir: manifest.DataDir,
+		Stats: manifest.Stats, KeysSealed: manifest.KeysSealed,
+	}
+	if err := bm.addFile(rewritten, dbPath, "waddle.db", nil); err != nil {
+		return false, err
+	}
+
+	// Embeddings of redacted notes and sessions are deleted too, as there is
+	// no embedding model to run here
+	var docs []string
+	for _, item := range items {
+		if item.Kind == "note" || item.Kind == "session" {
+			docs = append(docs, item.Kind+"_"+item.ID)
+		}
+	}
+	vectors := len(docs) > 0 && slices.ContainsFunc(manifest.Files, func(f BackupFile) bool { return strings.HasPrefix(f.Path, "vectors/") })
+	if vectors {
+		if err := bm.purgeSnapshotVectors(manifest, rewritten, tmp, docs); err != nil {
+			return false, err
+		}
+	}
+
+	for _, file := range manifest.Files {
+		switch {
+		case file.Path == "waddle.db", vectors && strings.HasPrefix(file.Path, "vectors/"):
+		case strings.HasPrefix(file.Path, "files/"+blobDir+"/") && dropped[filepath.Base(file.Path)]:
+		default:
+			files = append(files, file)
+		}
+	}
+	rewritten.Files = append(rewritten.Files, files...)
+	rewritten.ChunksWritten += manifest.ChunksWritten
+	rewritten.BytesWritten += manifest.BytesWritten
+	return true, bm.writeManifest(backup.Path, rewritten)
+}
+
+// purgeSnapshotDatabase purges a snapshot's copy of the database, sealing
+// it again afterwards if its data keys were kept apart. Returns the purged
+// items, nil if the snapshot's schema differs from the live one, and the
+// blobs no longer referenced.
+func (bm *BackupManager) purgeSnapshotDatabase(dbPath string, sealed bool, m *purgeMatcher) ([]PurgeItem, map[string]bool, error) {
+	live := bm.storageEngine.sessionMgr
+	if sealed {
+		keys, err := bm.readBackupKeys()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := unsealSnapshotDatabase(dbPath, keys); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(ON)&_pragma=secure_delete(ON)")
+	if err != nil {
+		return nil, nil, NewStorageError(ErrDatabase, "failed to open backup database", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	sm := &SessionManager{db: db, encryptionMgr: live.encryptionMgr, dbPath: dbPath, calendar: live.calendar}
+
+	version, err := sm.GetSchemaVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+	if current, err := live.GetSchemaVersion(); err != nil || version != current {
+		return nil, nil, err
+	}
+	items, err := sm.planPurge(m)
+	if err != nil || len(items) == 0 {
+		return []PurgeItem{}, nil, err
+	}
+	released, err := sm.applyPurge(items)
+	if err != nil {
+		return nil, nil, err
+	}
+	dropped := make(map[string]bool)
+	for _, hash := range released {
+		deleted, err := sm.DeleteBlob(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		dropped[hash] = deleted
+	}
+
+	if sealed {
+		// Keep any data key the redaction created alongside the others
+		created, err := sm.ListDataKeys()
+		if err != nil {
+			return nil, nil, err
+		}
+		keys, err := bm.readBackupKeys()
+		if err != nil {
+			return nil, nil, err
+		}
+		for id, wrapped := range created {
+			keys[id] = wrapped
+		}
+		if err := bm.writeBackupKeys(keys); err != nil {
+			return nil, nil, err
+		}
+		db.Close()
+		return items, dropped, sealSnapshotDatabase(dbPath)
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return nil, nil, NewStorageError(ErrDatabase, "failed to vacuum backup database", err)
+	}
+	return items, dropped, nil
+}
+
+// purgeSnapshotVectors deletes documents from a snapshot's vector store and
+// adds its files to the rewritten manifest.
+func (bm *BackupManager) purgeSnapshotVectors(manifest, rewritten *BackupManifest, tmp string, docs []string) error {
+	for _, file := range manifest.Files {
+		if strings.HasPrefix(file.Path, "vectors/") {
+			if err := bm.restoreFile(file, filepath.Join(tmp, filepath.FromSlash(file.Path))); err != nil {
+				return err
+			}
+		}
+	}
+	vm, err := NewVectorManager(&VectorManagerConfig{DataDir: tmp})
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		kind, id, _ := strings.Cut(doc, "_")
+		n, _ := strconv.ParseInt(id, 10, 64)
+		if kind == "note" {
+			err = vm.DeleteNoteEmbedding(n)
+		} else {
+			err = vm.DeleteEmbedding(n)
+		}
+		if err != nil {
+			vm.Close()
+			return err
+		}
+	}
+	vm.Close()
+
+	return filepath.Walk(filepath.Join(tmp, "vectors"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			return err
+		}
+		return bm.addFile(rewritten, path, filepath.ToSlash(rel), info)
+	})
+}
+
+// reapplyPurges applies the logged purges a restored snapshot was taken
+// before. Returns the number of purges applied.
+func (bm *BackupManager) reapplyPurges(backup BackupInfo) (int, error) {
+	entries, err := bm.pendingPurges(backup)
+	if err != nil {
+		return 0, err
+	}
+	pm := NewPurgeManager(bm.config, bm.storageEngine)
+	for i, entry := range entries {
+		data, err := bm.storageEngine.encryptionMgr.Decrypt(entry.Sealed)
+		if err != nil {
+			return i, NewStorageError(ErrEncryption, "failed to open purge "+entry.ID, err)
+		}
+		var req PurgeRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return i, NewStorageError(ErrValidation, "invalid purge "+entry.ID, err)
+		}
+		req.Backups = PurgeBackupsKeep
+		if _, err := pm.Purge(req); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// RewrapPurgeLog re-seals the logged purges from one master key to
+// another. Entries the old key can't open are left as they are. Returns
+// the number of entries re-sealed.
+func (bm *BackupManager) RewrapPurgeLog(from, to *EncryptionManager) (int, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	entries, err := bm.readPurgeLog()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := range entries {
+		data, err := from.Decrypt(entries[i].Sealed)
+		if err != nil {
+			continue
+		}
+		if entries[i].Sealed, err = to.Encrypt(data); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := bm.replaceJSONFile(purgeLogName, entries); err != nil {
+		return 0, NewStorageError(ErrFileSystem, "failed to write purge log", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,518 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// blobDir holds file contents named by their SHA-256, sharded by the
+	// first two bytes: blobs/ab/cd/abcd...
+	blobDir = "blobs"
+
+	// DefaultBlobGracePeriod is how long an unreferenced blob is kept before
+	// garbage collection deletes it, so backups taken meanwhile stay whole.
+	DefaultBlobGracePeriod = time.Hour
+)
+
+// FileRef is a stored file: a logical path and the blob holding its content.
+type FileRef struct {
+	Path    string    `json:"path"`           // Slash-separated, relative to the files directory
+	Hash    string    `json:"hash,omitempty"` // SHA-256 of the content; empty for files outside the store
+	Size    int64     `json:"size"`           // Bytes on disk
+	BlockID int64     `json:"blockId,omitempty"`
+	ModTime time.Time `json:"modTime"`
+	KeyID   int64     `json:"-"` // Data key the blob is sealed with; 0 for the master key
+}
+
+// SetIndex stores files in the content-addressed blob store, with their
+// paths and reference counts kept in the session database. Without an
+// index files are plain files in directories named by their paths.
+func (fm *FileManager) SetIndex(sm *SessionManager) {
+	fm.index = sm
+}
+
+// blobHash returns the name of the blob holding data.
+func blobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// blobPath returns the filesystem path of a blob.
+func (fm *FileManager) blobPath(hash string) string {
+	return filepath.Join(fm.baseDir, blobDir, hash[:2], hash[2:4], hash)
+}
+
+// fullPath returns the filesystem path of a logical path outside the store.
+func (fm *FileManager) fullPath(rel string) string {
+	return filepath.Join(fm.baseDir, filepath.FromSlash(rel))
+}
+
+// relPath returns the logical path of a full path under the files
+// directory.
+func (fm *FileManager) relPath(fullPath string) (string, error) {
+	rel, err := filepath.Rel(fm.baseDir, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", NewStorageError(ErrValidation, "path is outside the files directory", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// put stores data at ref.Path with ref's modification time, the current
+// time if unset, and activity block.
+func (fm *FileManager) put(ref FileRef, data []byte) error {
+	if ref.ModTime.IsZero() {
+		ref.ModTime = time.Now()
+	}
+
+	if fm.index == nil {
+		full := fm.fullPath(ref.Path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to create directory", err)
+		}
+		if err := fm.writeFile(full, data); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to write file", err)
+		}
+		os.Chtimes(full, ref.ModTime, ref.ModTime)
+		return nil
+	}
+
+	// Blobs of a session are sealed with its data key and named by a MAC
+	// under it, so content is only shared within a session and destroying
+	// the key leaves its blobs unreadable
+	ref.Hash = blobHash(data)
+	if fm.encryption != nil {
+		keyID, err := fm.index.sessionDataKeyByDate(sessionOf(ref.Path))
+		if err != nil {
+			return err
+		}
+		if keyID != 0 {
+			if ref.Hash, err = fm.encryption.blobName(keyID, data); err != nil {
+				return err
+			}
+		}
+		ref.KeyID = keyID
+	}
+	blob := fm.blobPath(ref.Hash)
+
+	// Held until the reference is recorded, so garbage collection can't
+	// delete the blob between the existence check and the reference
+	fm.blobMu.Lock()
+	defer fm.blobMu.Unlock()
+
+	info, err := os.Stat(blob)
+	if err != nil {
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to create blob directory", err)
+		}
+		if err := fm.writeFileWithKey(blob, data, ref.KeyID); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to write blob", err)
+		}
+		if info, err = os.Stat(blob); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to stat blob", err)
+		}
+	}
+	ref.Size = info.Size()
+	return fm.index.PutFileRef(ref)
+}
+
+// stat returns the file stored at a logical path.
+func (fm *FileManager) stat(rel string) (*FileRef, error) {
+	if fm.index != nil {
+		return fm.index.GetFileRef(rel)
+	}
+	info, err := os.Stat(fm.fullPath(rel))
+	if err != nil || info.IsDir() {
+		if err == nil || os.IsNotExist(err) {
+			return nil, NewStorageError(ErrNotFound, "file not found", err)
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to stat file", err)
+	}
+	return &FileRef{Path: rel, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// diskPath returns the filesystem path holding the content of a logical
+// path.
+func (fm *FileManager) diskPath(rel string) (string, error) {
+	if fm.index == nil {
+		return fm.fullPath(rel), nil
+	}
+	ref, err := fm.index.GetFileRef(rel)
+	if err != nil {
+		return "", err
+	}
+	return fm.blobPath(ref.Hash), nil
+}
+
+// get reads and decrypts the file at a logical path.
+func (fm *FileManager) get(rel string) ([]byte, error) {
+	path, err := fm.diskPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fm.readFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NewStorageError(ErrNotFound, "file not found", err)
+		}
+		if _, ok := err.(*StorageError); ok {
+			return nil, err
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to read file", err)
+	}
+	return data, nil
+}
+
+// open opens the file at a logical path, decrypting it as it is read.
+func (fm *FileManager) open(rel string) (io.ReadCloser, error) {
+	path, err := fm.diskPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	return fm.openPath(path)
+}
+
+// list returns the files at or below a logical path, or every file when
+// prefix is empty, ordered by path.
+func (fm *FileManager) list(prefix string) ([]FileRef, error) {
+	if fm.index != nil {
+		return fm.index.ListFileRefs(prefix)
+	}
+
+	var refs []FileRef
+	blobs := filepath.Join(fm.baseDir, blobDir)
+	err := filepath.Walk(fm.fullPath(prefix), func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if file == blobs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isFileMetadata(file) {
+			return nil
+		}
+		rel, err := fm.relPath(file)
+		if err != nil {
+			return nil
+		}
+		refs = append(refs, FileRef{Path: rel, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to list files", err)
+	}
+	return refs, nil
+}
+
+// remove deletes the files at or below a logical path. Returns the number
+// of files deleted.
+func (fm *FileManager) remove(prefix string) (int, error) {
+	if prefix == "" || prefix == "." {
+		return 0, NewStorageError(ErrValidation, "path is required", nil)
+	}
+	if fm.index != nil {
+		n, err := fm.index.DeleteFileRefs(prefix)
+		if err != nil {
+			return 0, err
+		}
+		// Files an earlier version left outside the store
+		if sessionOf(prefix) != blobDir {
+			os.RemoveAll(fm.fullPath(prefix))
+		}
+		return n, nil
+	}
+
+	refs, err := fm.list(prefix)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(fm.fullPath(prefix)); err != nil {
+		return 0, NewStorageError(ErrFileSystem, "failed to delete files", err)
+	}
+	return len(refs), nil
+}
+
+// setModTime sets the modification time of the file at a logical path.
+func (fm *FileManager) setModTime(rel string, modTime time.Time) error {
+	if fm.index != nil {
+		return fm.index.SetFileRefTime(rel, modTime)
+	}
+	if err := os.Chtimes(fm.fullPath(rel), modTime, modTime); err != nil {
+		if os.IsNotExist(err) {
+			return NewStorageError(ErrNotFound, "file not found", err)
+		}
+		return NewStorageError(ErrFileSystem, "failed to update file time", err)
+	}
+	return nil
+}
+
+// StatFile returns the stored file at a full path from GetFilePath or
+// ListSessionFiles.
+func (fm *FileManager) StatFile(fullPath string) (*FileRef, error) {
+	rel, err := fm.relPath(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return fm.stat(fm.resolveScreenshot(rel))
+}
+
+// SetFileTime sets the modification time of the stored file at a full
+// path, which is the age retention and tiering see.
+func (fm *FileManager) SetFileTime(fullPath string, modTime time.Time) error {
+	rel, err := fm.relPath(fullPath)
+	if err != nil {
+		return err
+	}
+	return fm.setModTime(fm.resolveScreenshot(rel), modTime)
+}
+
+// LinkFile links a stored file to the activity block it was captured for.
+func (fm *FileManager) LinkFile(fullPath string, blockID int64) error {
+	if fm.index == nil {
+		return NewStorageError(ErrNotImplemented, "files are not indexed", nil)
+	}
+	rel, err := fm.relPath(fullPath)
+	if err != nil {
+		return err
+	}
+	return fm.index.LinkFileRef(fm.resolveScreenshot(rel), blockID)
+}
+
+// MoveFiles moves the files at or below a logical path out of the store
+// into dstDir, keeping their paths, modification times and encryption.
+// Returns the number of files moved.
+func (fm *FileManager) MoveFiles(prefix, dstDir string) (int, error) {
+	if fm.index == nil {
+		src := fm.fullPath(prefix)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			return 0, nil
+		}
+		refs, err := fm.list(prefix)
+		if err != nil {
+			return 0, err
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(prefix))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return 0, NewStorageError(ErrFileSystem, "failed to create directory", err)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return 0, NewStorageError(ErrFileSystem, "failed to move files", err)
+		}
+		return len(refs), nil
+	}
+
+	refs, err := fm.list(prefix)
+	if err != nil {
+		return 0, err
+	}
+	for _, ref := range refs {
+		data, err := fm.get(ref.Path)
+		if err != nil {
+			return 0, err
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(ref.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return 0, NewStorageError(ErrFileSystem, "failed to create directory", err)
+		}
+		if err := fm.writeFile(dst, data); err != nil {
+			return 0, NewStorageError(ErrFileSystem, "failed to write "+ref.Path, err)
+		}
+		os.Chtimes(dst, ref.ModTime, ref.ModTime)
+	}
+	if _, err := fm.remove(prefix); err != nil {
+		return 0, err
+	}
+	return len(refs), nil
+}
+
+// CollectGarbage deletes blobs no file has referenced for the grace
+// period, along with blob files an interrupted write left unrecorded.
+// Returns the number of blobs deleted and the bytes freed.
+func (fm *FileManager) CollectGarbage(grace time.Duration) (int, int64, error) {
+	if fm.index == nil {
+		return 0, 0, nil
+	}
+
+	hashes, err := fm.index.GetUnreferencedBlobs(grace)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := 0
+	var freed int64
+	for _, hash := range hashes {
+		n, err := fm.collectBlob(hash, func() (bool, error) { return fm.index.DeleteBlob(hash) })
+		if err != nil {
+			return count, freed, err
+		}
+		if n > 0 {
+			count++
+			freed += n
+		}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	err = filepath.Walk(filepath.Join(fm.baseDir, blobDir), func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+			return nil
+		}
+		hash := filepath.Base(file)
+		if strings.HasSuffix(hash, ".tmp") {
+			if os.Remove(file) == nil {
+				freed += info.Size()
+			}
+			return nil
+		}
+		n, err := fm.collectBlob(hash, func() (bool, error) {
+			exists, err := fm.index.HasBlob(hash)
+			return !exists, err
+		})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			count++
+			freed += n
+		}
+		return nil
+	})
+	if err != nil {
+		return count, freed, NewStorageError(ErrFileSystem, "failed to walk blob directory", err)
+	}
+	return count, freed, nil
+}
+
+// collectBlob deletes a blob's file if release reports that its record is
+// gone. Returns the bytes freed.
+func (fm *FileManager) collectBlob(hash string, release func() (bool, error)) (int64, error) {
+	if len(hash) < 4 {
+		return 0, nil
+	}
+	fm.blobMu.Lock()
+	defer fm.blobMu.Unlock()
+
+	released, err := release()
+	if err != nil || !released {
+		return 0, err
+	}
+	blob := fm.blobPath(hash)
+	info, err := os.Stat(blob)
+	if err != nil {
+		return 0, nil
+	}
+	if err := os.Remove(blob); err != nil {
+		return 0, NewStorageError(ErrFileSystem, "failed to delete blob", err)
+	}
+	return info.Size(), nil
+}
+
+// MigrateToBlobStore moves files stored in directories by earlier versions
+// into the blob store, keeping their paths and modification times. A
+// directory is removed once all of its files are stored. Returns the
+// number of files moved.
+func (fm *FileManager) MigrateToBlobStore() (int, error) {
+	if fm.index == nil {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(fm.baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, NewStorageError(ErrFileSystem, "failed to read files directory", err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == blobDir {
+			continue
+		}
+		dir := filepath.Join(fm.baseDir, entry.Name())
+		complete := true
+		err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				complete = false
+				return nil
+			}
+			if info.IsDir() || isFileMetadata(file) {
+				return nil
+			}
+			rel, err := fm.relPath(file)
+			if err != nil {
+				return nil
+			}
+			data, err := fm.readFile(file)
+			if err != nil {
+				complete = false // Left in place rather than lost
+				return nil
+			}
+			if err := fm.put(FileRef{Path: rel, ModTime: info.ModTime()}, data); err != nil {
+				return err
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if complete {
+			os.RemoveAll(dir)
+		}
+	}
+	return count, nil
+}
+
+// MigrateDataKeys reseals files of sessions stored under the master key,
+// as files were before sessions had data keys, with their session's key.
+// The old blobs are left to garbage collection. Returns the number of files
+// resealed.
+func (fm *FileManager) MigrateDataKeys() (int, error) {
+	if fm.index == nil || fm.encryption == nil {
+		return 0, nil
+	}
+	refs, err := fm.index.GetUnkeyedFileRefs()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, ref := range refs {
+		data, err := fm.get(ref.Path)
+		if err != nil {
+			continue // Left as it is rather than lost
+		}
+		if err := fm.put(ref, data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// sessionOf returns the session date a logical path belongs to.
+func sessionOf(rel string) string {
+	if i := strings.Index(rel, "/"); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
+
+// appPathOf returns the session and app part of a logical path, as in
+// "2025-03-01/Code".
+func appPathOf(rel string) string {
+	parts := strings.SplitN(rel, "/", 3)
+	if len(parts) < 2 {
+		return rel
+	}
+	return path.Join(parts[0], parts[1])
+}
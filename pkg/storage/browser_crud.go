@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// browserAppHints maps a browser family to the process names the capture
+// pipeline records for it. Blocks from these apps are preferred when linking
+// an imported visit to the activity block that was open at the time.
+var browserAppHints = map[string][]string{
+	"chromium": {"chrome", "msedge", "edge", "brave", "vivaldi", "opera", "chromium"},
+	"firefox":  {"firefox", "librewolf", "waterfox"},
+}
+
+// AddBrowserVisit stores an imported browser visit for a session.
+// Visits are deduplicated on (browser, url, visited_at); the returned bool
+// reports whether a new row was written. If visit.ActivityBlockID is unset,
+// the visit is linked to the session's activity block covering VisitedAt.
+func (sm *SessionManager) AddBrowserVisit(sessionID int64, visit *BrowserVisit) (bool, error) {
+	if err := validateBrowserVisit(visit); err != nil {
+		return false, err
+	}
+
+	var spans []blockSpan
+	if visit.ActivityBlockID == 0 {
+		var err error
+		if spans, err = sm.getBlockSpans(sessionID); err != nil {
+			return false, err
+		}
+	}
+
+	return sm.addBrowserVisit(sessionID, visit, spans)
+}
+
+// AddBrowserVisits stores imported browser visits for a session like
+// AddBrowserVisit, loading the session's activity blocks once to link them
+// all. A visit's ID is set only if it was new. It returns how many visits
+// were handled, which is fewer than len(visits) only on error.
+func (sm *SessionManager) AddBrowserVisits(sessionID int64, visits []*BrowserVisit) (int, error) {
+	spans, err := sm.getBlockSpans(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, visit := range visits {
+		if err := validateBrowserVisit(visit); err != nil {
+			return i, err
+		}
+		if _, err := sm.addBrowserVisit(sessionID, visit, spans); err != nil {
+			return i, err
+		}
+	}
+	return len(visits), nil
+}
+
+// validateBrowserVisit checks a visit's required fields.
+func validateBrowserVisit(visit *BrowserVisit) error {
+	if visit.Browser == "" {
+		return NewStorageError(ErrValidation, "browser is required", nil)
+	}
+	if visit.URL == "" {
+		return NewStorageError(ErrValidation, "visit URL is required", nil)
+	}
+	if visit.VisitedAt.IsZero() {
+		return NewStorageError(ErrValidation, "visit time is required", nil)
+	}
+	return nil
+}
+
+// addBrowserVisit inserts a validated visit, linking it to the covering
+// block among spans if visit.ActivityBlockID is unset.
+func (sm *SessionManager) addBrowserVisit(sessionID int64, visit *BrowserVisit, spans []blockSpan) (bool, error) {
+	// Normalize to UTC so the dedup key is stable across imports
+	visit.VisitedAt = visit.VisitedAt.UTC()
+
+	if visit.ActivityBlockID == 0 {
+		visit.ActivityBlockID = types.ElementID(blockAt(spans, visit.VisitedAt, browserAppHints[visit.Browser]))
+	}
+
+	var blockRef interface{}
+	if visit.ActivityBlockID != 0 {
+		blockRef = int64(visit.ActivityBlockID)
+	}
+
+	query := `
+		INSERT INTO browser_visits (session_id, activity_block_id, browser, url, title, visited_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(browser, url, visited_at) DO NOTHING
+	`
+
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to prepare statement", err)
+	}
+
+	result, err := stmt.Exec(sessionID, blockRef, visit.Browser, visit.URL, visit.Title, visit.VisitedAt)
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to add browser visit", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to get last insert id", err)
+	}
+
+	visit.ID = types.ElementID(id)
+	visit.SessionID = types.SessionID(sessionID)
+	return true, nil
+}
+
+// GetBrowserVisits retrieves all imported browser visits for a session in time order.
+func (sm *SessionManager) GetBrowserVisits(sessionID int64) ([]BrowserVisit, error) {
+	query := `
+		SELECT id, session_id, activity_block_id, browser, url, title, visited_at
+		FROM browser_visits
+		WHERE session_id = ?
+		ORDER BY visited_at ASC
+	`
+
+	rows, err := sm.db.Query(query, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get browser visits", err)
+	}
+	defer rows.Close()
+
+	var visits []BrowserVisit
+	for rows.Next() {
+		var visit BrowserVisit
+		var blockID sql.NullInt64
+		var title sql.NullString
+		err := rows.Scan(
+			&visit.ID,
+			&visit.SessionID,
+			&blockID,
+			&visit.Browser,
+			&visit.URL,
+			&title,
+			&visit.VisitedAt,
+		)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan browser visit", err)
+		}
+		visit.ActivityBlockID = types.ElementID(blockID.Int64)
+		visit.Title = title.String
+
+		visits = append(visits, visit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating browser visits", err)
+	}
+
+	return visits, nil
+}
+
+// blockSpan is the time range of an activity block, for linking imported
+// items to the block that was open at the time.
+type blockSpan struct {
+	id    int64
+	app   string // Lower-cased app name
+	start time.Time
+	end   time.Time
+	reach time.Time // Latest end of this and every earlier span
+}
+
+// getBlockSpans returns the spans of a session's activity blocks in start
+// time order.
+func (sm *SessionManager) getBlockSpans(sessionID int64) ([]blockSpan, error) {
+	query := `
+		SELECT ab.id, aa.app_name, ab.start_time, ab.end_time
+		FROM activity_blocks ab
+		JOIN app_activities aa ON ab.app_activity_id = aa.id
+		WHERE aa.session_id = ?
+	`
+
+	rows, err := sm.db.Query(query, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query activity blocks", err)
+	}
+	defer rows.Close()
+
+	var spans []blockSpan
+	for rows.Next() {
+		var span blockSpan
+		if err := rows.Scan(&span.id, &span.app, &span.start, &span.end); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan activity block", err)
+		}
+		span.app = strings.ToLower(span.app)
+		spans = append(spans, span)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating activity blocks", err)
+	}
+
+	// Timestamps may be stored with differing offsets, so sort as instants
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start.Before(spans[j].start)
+	})
+	for i := range spans {
+		spans[i].reach = spans[i].end
+		if i > 0 && spans[i-1].reach.After(spans[i].reach) {
+			spans[i].reach = spans[i-1].reach
+		}
+	}
+
+	return spans, nil
+}
+
+// blockAt returns the ID of the earliest-starting span covering at, preferring
+// spans whose app matches one of appHints, or 0 if none covers it.
+func blockAt(spans []blockSpan, at time.Time, appHints []string) int64 {
+	// Only spans starting at or before at can cover it, and scanning back
+	// stops once no earlier span reaches it
+	i := sort.Search(len(spans), func(i int) bool {
+		return spans[i].start.After(at)
+	})
+
+	var match, fallback int64
+	for i--; i >= 0 && !spans[i].reach.Before(at); i-- {
+		if spans[i].end.Before(at) {
+			continue
+		}
+		fallback = spans[i].id
+		for _, hint := range appHints {
+			if strings.Contains(spans[i].app, hint) {
+				match = spans[i].id
+				break
+			}
+		}
+	}
+
+	if match != 0 {
+		return match
+	}
+	return fallback
+}
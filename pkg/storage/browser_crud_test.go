@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBlockAt tests finding the activity block covering a visit among
+// overlapping blocks.
+func TestBlockAt(t *testing.T) {
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	spans := []blockSpan{
+		{id: 1, app: "code", start: at(0), end: at(120)}, // Long block reaching past later ones
+		{id: 2, app: "chrome.exe", start: at(10), end: at(20)},
+		{id: 3, app: "slack", start: at(30), end: at(40)},
+		{id: 4, app: "firefox", start: at(35), end: at(50)},
+		{id: 5, app: "terminal", start: at(200), end: at(210)},
+	}
+	for i := range spans {
+		spans[i].reach = spans[i].end
+		if i > 0 && spans[i-1].reach.After(spans[i].reach) {
+			spans[i].reach = spans[i-1].reach
+		}
+	}
+	chromium := browserAppHints["chromium"]
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		hints []string
+		want  int64
+	}{
+		{"Prefers the browser's block", at(15), chromium, 2},
+		{"Block bounds are inclusive", at(20), chromium, 2},
+		{"Falls back to the earliest covering block", at(36), chromium, 1},
+		{"Finds a block started long before", at(100), chromium, 1},
+		{"Matches a later browser block", at(45), browserAppHints["firefox"], 4},
+		{"Nothing open", at(150), chromium, 0},
+		{"Before every block", base.Add(-time.Minute), chromium, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockAt(spans, tt.at, tt.hints); got != tt.want {
+				t.Errorf("Expected block %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
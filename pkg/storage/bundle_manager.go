@@ -0,0 +1,1053 @@
+package storage
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Bundle format identification written to every manifest.
+const (
+	BundleFormat  = "waddle-bundle"
+	BundleVersion = 1
+)
+
+// Conflict policies for sessions whose date already exists on import.
+const (
+	BundleConflictMerge   = "merge"   // Add the bundle's data to the existing session
+	BundleConflictSkip    = "skip"    // Keep the existing session and skip the bundle's
+	BundleConflictReplace = "replace" // Delete the existing session first
+)
+
+const (
+	bundleManifestName   = "manifest.json"
+	bundleEmbeddingsName = "embeddings.ndjson"
+	bundleFilesPrefix    = "files/"
+	bundleCheckText      = BundleFormat
+)
+
+// bundleTable describes how one table is written to and read back from a
+// bundle. Tables are listed parents first so references can be remapped.
+type bundleTable struct {
+	name string
+	// Columns holding IDs of rows in another table
+	refs map[string]string
+	// Columns identifying an existing row that an imported row merges into
+	natural []string
+	// BLOB columns encrypted with the store key; bundled as plaintext
+	encryptedBlobs []string
+	// TEXT column encrypted with the store key when the row's encrypted flag is set
+	encryptedText string
+	// entity_id refers to the table named by entity_type, as in revisions
+	entityRef bool
+}
+
+func (t bundleTable) isEncryptedBlob(column string) bool {
+	for _, c := range t.encryptedBlobs {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+var bundleTables = []bundleTable{
+	{name: "sessions", natural: []string{"date"}, encryptedBlobs: []string{"extracted_text_encrypted"}},
+	{name: "app_activities", refs: map[string]string{"session_id": "sessions"}, natural: []string{"session_id", "app_name"}},
+	{name: "work_sessions", refs: map[string]string{"session_id": "sessions"}, natural: []string{"session_id", "start_time"}},
+	{name: "activity_blocks", refs: map[string]string{"app_activity_id": "app_activities"},
+		natural: []string{"app_activity_id", "block_id"}, encryptedBlobs: []string{"ocr_text_encrypted"}},
+	{name: "chats", refs: map[string]string{"session_id": "sessions", "work_session_id": "work_sessions"},
+		natural: []string{"session_id", "role", "timestamp"}, encryptedBlobs: []string{"content_encrypted"}},
+	{name: "manual_notes", refs: map[string]string{"session_id": "sessions"},
+		natural: []string{"session_id", "created_at"}, encryptedText: "content"},
+	{name: "note_revisions", refs: map[string]string{"note_id": "manual_notes"},
+		natural: []string{"note_id", "created_at"}, encryptedText: "content"},
+	{name: "note_links", refs: map[string]string{"note_id": "manual_notes", "block_id": "activity_blocks"},
+		natural: []string{"note_id", "block_id", "start_time", "end_time"}},
+	{name: "knowledge_cards", refs: map[string]string{"session_id": "sessions", "work_session_id": "work_sessions"},
+		natural: []string{"session_id", "title", "created_at"}},
+	{name: "browser_visits", refs: map[string]string{"session_id": "sessions", "activity_block_id": "activity_blocks"},
+		natural: []string{"browser", "url", "visited_at"}},
+	{name: "meetings", refs: map[string]string{"session_id": "sessions"}, natural: []string{"source", "uid", "recurrence_id"}},
+	{name: "tags", natural: []string{"name"}},
+	{name: "session_tags", refs: map[string]string{"session_id": "sessions", "tag_id": "tags"}, natural: []string{"session_id", "tag_id"}},
+	{name: "block_tags", refs: map[string]string{"block_id": "activity_blocks", "tag_id": "tags"}, natural: []string{"block_id", "tag_id"}},
+	{name: "card_tags", refs: map[string]string{"card_id": "knowledge_cards", "tag_id": "tags"}, natural: []string{"card_id", "tag_id"}},
+	{name: "tag_rules", natural: []string{"entity_type", "pattern", "tag"}},
+	{name: "revisions", entityRef: true, natural: []string{"entity_type", "entity_id", "created_at"}},
+	{name: "notifications", natural: []string{"id"}},
+}
+
+// BundleManifest describes the contents of an export bundle. It is the only
+// entry that is never encrypted.
+type BundleManifest struct {
+	Format         string            `json:"format"`
+	Version        int               `json:"version"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	SchemaVersion  int               `json:"schemaVersion"`
+	Encryption     *BundleEncryption `json:"encryption,omitempty"`
+	Tables         []BundleTableInfo `json:"tables"`
+	Files          int               `json:"files"`
+	Embeddings     int               `json:"embeddings"`
+	EmbeddingModel string            `json:"embeddingModel,omitempty"`
+}
+
+// BundleTableInfo describes one table's NDJSON entry. Encrypted columns hold
+// plaintext, and timestamps keep the text they were stored as.
+type BundleTableInfo struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Rows    int      `json:"rows"`
+	Columns []string `json:"columns"`
+}
+
+// BundleEncryption holds the key derivation parameters of a password
+// protected bundle. Every entry but the manifest is sealed with AES-256-GCM
+// under the derived key; Check seals a known text to detect wrong passwords.
+type BundleEncryption struct {
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Check   []byte `json:"check"`
+}
+
+// BundleExportOptions controls a bundle export.
+type BundleExportOptions struct {
+	Password       string `json:"password,omitempty"` // Encrypts the bundle when set
+	SkipFiles      bool   `json:"skipFiles"`          // Leave out screenshots and other session files
+	SkipEmbeddings bool   `json:"skipEmbeddings"`     // Leave out embeddings; the importer regenerates them
+}
+
+// BundleExportResult summarizes a bundle export.
+type BundleExportResult struct {
+	Path          string         `json:"path"`
+	Rows          map[string]int `json:"rows"`
+	Files         int            `json:"files"`
+	Embeddings    int            `json:"embeddings"`
+	Undecryptable int            `json:"undecryptable"` // Encrypted values that couldn't be read and were left empty
+}
+
+// BundleImportOptions controls a bundle import.
+type BundleImportOptions struct {
+	Password             string `json:"password,omitempty"`
+	OnConflict           string `json:"onConflict"`           // "merge" (default), "skip" or "replace"
+	RegenerateEmbeddings bool   `json:"regenerateEmbeddings"` // Recompute embeddings instead of using bundled ones
+}
+
+// BundleImportResult summarizes a bundle import.
+type BundleImportResult struct {
+	Inserted           map[string]int `json:"inserted"`
+	Merged             map[string]int `json:"merged"`  // Rows matching an existing row, which is kept
+	Skipped            map[string]int `json:"skipped"` // Rows skipped by the conflict policy or whose parent was
+	SessionsReplaced   int            `json:"sessionsReplaced"`
+	Files              int            `json:"files"`
+	EmbeddingsRestored int            `json:"embeddingsRestored"`
+	EmbeddingsQueued   int            `json:"embeddingsQueued"`
+}
+
+// bundleEmbedding is one line of embeddings.ndjson.
+type bundleEmbedding struct {
+	Kind      string    `json:"kind"` // "session" or "note"
+	ID        int64     `json:"id"`
+	Model     string    `json:"model"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// BundleManager writes and reads portable export bundles: zip archives with
+// a JSON manifest, one NDJSON file per table, session files and embeddings.
+// Unlike backups, bundles hold decrypted data (optionally sealed with a
+// password) so they can be imported on another machine or account, where
+// the data is re-encrypted under that store's key.
+type BundleManager struct {
+	config        *StorageConfig
+	storageEngine *StorageEngine
+}
+
+// NewBundleManager creates a new bundle manager.
+func NewBundleManager(config *StorageConfig, storageEngine *StorageEngine) *BundleManager {
+	return &BundleManager{
+		config:        config,
+		storageEngine: storageEngine,
+	}
+}
+
+// bundleCipher seals bundle entries with a password-derived key.
+type bundleCipher struct {
+	aead cipher.AEAD
+}
+
+func newBundleCipher(password string, enc *BundleEncryption) (*bundleCipher, error) {
+	key := argon2.IDKey([]byte(password), enc.Salt, enc.Time, enc.Memory, enc.Threads, KeySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create bundle cipher", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create bundle cipher", err)
+	}
+	return &bundleCipher{aead: aead}, nil
+}
+
+func (bc *bundleCipher) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to generate nonce", err)
+	}
+	return bc.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (bc *bundleCipher) open(data []byte) ([]byte, error) {
+	if len(data) < NonceSize+bc.aead.Overhead() {
+		return nil, NewStorageError(ErrEncryption, "bundle entry too short", nil)
+	}
+	plaintext, err := bc.aead.Open(nil, data[:NonceSize], data[NonceSize:], nil)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to decrypt bundle entry", err)
+	}
+	return plaintext, nil
+}
+
+// bundleColumn is a column of a destination table.
+type bundleColumn struct {
+	name     string
+	declared string
+	pk       bool
+}
+
+// tableColumns returns a table's columns, or nil when the table doesn't exist.
+func tableColumns(db *sql.DB, table string) ([]bundleColumn, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to read columns of "+table, err)
+	}
+	defer rows.Close()
+
+	var columns []bundleColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, declared string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &declared, &notNull, &dflt, &pk); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan column of "+table, err)
+		}
+		columns = append(columns, bundleColumn{name: name, declared: strings.ToUpper(declared), pk: pk > 0})
+	}
+	return columns, rows.Err()
+}
+
+// hasRowID reports whether a table's id is an integer key assigned on insert,
+// which is remapped on import.
+func hasRowID(columns []bundleColumn) bool {
+	for _, column := range columns {
+		if column.name == "id" {
+			return column.pk && column.declared == "INTEGER"
+		}
+	}
+	return false
+}
+
+func isTimestampColumn(column bundleColumn) bool {
+	return strings.Contains(column.declared, "TIMESTAMP") || strings.Contains(column.declared, "DATE")
+}
+
+// Export writes the store to a bundle at path.
+func (bm *BundleManager) Export(path string, opts BundleExportOptions) (*BundleExportResult, error) {
+	se := bm.storageEngine
+	db := se.sessionMgr.DB()
+
+	schemaVersion, err := se.sessionMgr.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	manifest := BundleManifest{
+		Format:        BundleFormat,
+		Version:       BundleVersion,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: schemaVersion,
+	}
+
+	var bc *bundleCipher
+	if opts.Password != "" {
+		enc := &BundleEncryption{KDF: "argon2id", Salt: make([]byte, SaltSize),
+			Time: argon2Time, Memory: argon2Memory, Threads: argon2Threads}
+		if _, err := io.ReadFull(rand.Reader, enc.Salt); err != nil {
+			return nil, NewStorageError(ErrEncryption, "failed to generate salt", err)
+		}
+		if bc, err = newBundleCipher(opts.Password, enc); err != nil {
+			return nil, err
+		}
+		if enc.Check, err = bc.seal([]byte(bundleCheckText)); err != nil {
+			return nil, err
+		}
+		manifest.Encryption = enc
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to create bundle directory", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to create bundle", err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+
+	writeEntry := func(name string, data []byte) error {
+		if bc != nil {
+			if data, err = bc.seal(data); err != nil {
+				return err
+			}
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return NewStorageError(ErrFileSystem, "failed to add "+name+" to bundle", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to write "+name+" to bundle", err)
+		}
+		return nil
+	}
+
+	result := &BundleExportResult{Path: path, Rows: make(map[string]int)}
+	exported := make(map[string][]int64)
+	for _, table := range bundleTables {
+		columns, err := tableColumns(db, table.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		data, ids, info, err := bm.exportTable(table, columns, result)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(info.File, data); err != nil {
+			return nil, err
+		}
+		manifest.Tables = append(manifest.Tables, info)
+		exported[table.name] = ids
+		result.Rows[table.name] = info.Rows
+	}
+
+	if !opts.SkipFiles {
+		refs, err := se.fileMgr.list("")
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			// Files are bundled as plaintext, like encrypted columns
+			data, err := se.fileMgr.get(ref.Path)
+			if err != nil {
+				return nil, NewStorageError(ErrFileSystem, "failed to read "+ref.Path, err)
+			}
+			if err := writeEntry(bundleFilesPrefix+ref.Path, data); err != nil {
+				return nil, err
+			}
+			result.Files++
+		}
+		manifest.Files = result.Files
+	}
+
+	if !opts.SkipEmbeddings && se.vectorMgr != nil {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		add := func(kind string, id int64, embedding []float32, model string) error {
+			result.Embeddings++
+			return enc.Encode(bundleEmbedding{Kind: kind, ID: id, Model: model, Embedding: embedding})
+		}
+		for _, id := range exported["sessions"] {
+			if embedding, model, err := se.vectorMgr.GetEmbedding(id); err == nil {
+				if err := add("session", id, embedding, model); err != nil {
+					return nil, NewStorageError(ErrVector, "failed to encode embedding", err)
+				}
+			}
+		}
+		for _, id := range exported["manual_notes"] {
+			if embedding, model, err := se.vectorMgr.GetNoteEmbedding(id); err == nil {
+				if err := add("note", id, embedding, model); err != nil {
+					return nil, NewStorageError(ErrVector, "failed to encode embedding", err)
+				}
+			}
+		}
+		if result.Embeddings > 0 {
+			if err := writeEntry(bundleEmbeddingsName, buf.Bytes()); err != nil {
+				return nil, err
+			}
+		}
+		manifest.Embeddings = result.Embeddings
+		manifest.EmbeddingModel = se.vectorMgr.GetModelVersion()
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to encode bundle manifest", err)
+	}
+	w, err := zw.Create(bundleManifestName)
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to add manifest to bundle", err)
+	}
+	if _, err := w.Write(manifestJSON); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to write bundle manifest", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to finish bundle", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to finish bundle", err)
+	}
+
+	return result, nil
+}
+
+// exportTable renders a table as NDJSON with encrypted columns decrypted. It
+// also returns the exported row IDs.
+func (bm *BundleManager) exportTable(table bundleTable, columns []bundleColumn, result *BundleExportResult) ([]byte, []int64, BundleTableInfo, error) {
+	sm := bm.storageEngine.sessionMgr
+	info := BundleTableInfo{Name: table.name, File: table.name + ".ndjson"}
+
+	// Timestamps are read as their stored text so they round-trip exactly
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		info.Columns = append(info.Columns, column.name)
+		if isTimestampColumn(column) {
+			selects[i] = "CAST(" + column.name + " AS TEXT)"
+		} else {
+			selects[i] = column.name
+		}
+	}
+
+	rows, err := sm.DB().Query("SELECT " + strings.Join(selects, ", ") + " FROM " + table.name + " ORDER BY rowid")
+	if err != nil {
+		return nil, nil, info, NewStorageError(ErrDatabase, "failed to read "+table.name, err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	var ids []int64
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, info, NewStorageError(ErrDatabase, "failed to scan "+table.name, err)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.(bool); ok {
+				value = 0
+				if b {
+					value = 1
+				}
+			}
+			if table.isEncryptedBlob(column.name) {
+				value = bm.decryptBlob(value, result)
+			}
+			row[column.name] = value
+		}
+
+		if table.encryptedText != "" {
+			if flag, _ := row["encrypted"].(int64); flag == 1 {
+				text, _ := row[table.encryptedText].(string)
+				plaintext, err := sm.decryptNote(text, true)
+				if err != nil {
+					result.Undecryptable++
+					plaintext = ""
+				}
+				row[table.encryptedText] = plaintext
+				row["encrypted"] = 0
+			}
+		}
+
+		if id, ok := row["id"].(int64); ok {
+			ids = append(ids, id)
+		}
+		if err := enc.Encode(row); err != nil {
+			return nil, nil, info, NewStorageError(ErrDatabase, "failed to encode "+table.name+" row", err)
+		}
+		info.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, info, NewStorageError(ErrDatabase, "error iterating "+table.name, err)
+	}
+
+	return buf.Bytes(), ids, info, nil
+}
+
+// decryptBlob returns the plaintext of an encrypted BLOB value, or nil.
+func (bm *BundleManager) decryptBlob(value interface{}, result *BundleExportResult) interface{} {
+	data, ok := value.([]byte)
+	if !ok || len(data) == 0 {
+		return nil
+	}
+	em := bm.storageEngine.sessionMgr.encryptionMgr
+	if em == nil {
+		return string(data)
+	}
+	plaintext, err := em.Decrypt(data)
+	if err != nil {
+		result.Undecryptable++
+		return nil
+	}
+	return string(plaintext)
+}
+
+// bundleReader reads entries from an open bundle.
+type bundleReader struct {
+	files  map[string]*zip.File
+	cipher *bundleCipher
+}
+
+func (br *bundleReader) read(name string) ([]byte, error) {
+	f, ok := br.files[name]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to open "+name+" in bundle", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to read "+name+" in bundle", err)
+	}
+	if br.cipher != nil && name != bundleManifestName {
+		return br.cipher.open(data)
+	}
+	return data, nil
+}
+
+// ReadManifest returns the manifest of the bundle at path.
+func (bm *BundleManager) ReadManifest(path string) (*BundleManifest, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, NewStorageError(ErrValidation, "not a bundle", err)
+	}
+	defer zr.Close()
+	return readBundleManifest(&zr.Reader)
+}
+
+func readBundleManifest(zr *zip.Reader) (*BundleManifest, error) {
+	br := &bundleReader{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		br.files[f.Name] = f
+	}
+	data, err := br.read(bundleManifestName)
+	if err != nil {
+		return nil, err
+	}
+	var manifest BundleManifest
+	if data == nil || json.Unmarshal(data, &manifest) != nil || manifest.Format != BundleFormat {
+		return nil, NewStorageError(ErrValidation, "not a bundle: missing or invalid manifest", nil)
+	}
+	if manifest.Version > BundleVersion {
+		return nil, NewStorageError(ErrValidation,
+			fmt.Sprintf("bundle version %d is newer than supported version %d", manifest.Version, BundleVersion), nil)
+	}
+	return &manifest, nil
+}
+
+// Import merges the bundle at path into the store. Rows get new IDs, with
+// references between them remapped, and encrypted columns are re-encrypted
+// under this store's key. Rows matching an existing row (a session on the
+// same date, a tag with the same name, ...) are merged into it, except
+// that sessions follow the OnConflict policy.
+func (bm *BundleManager) Import(path string, opts BundleImportOptions) (*BundleImportResult, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = BundleConflictMerge
+	case BundleConflictMerge, BundleConflictSkip, BundleConflictReplace:
+	default:
+		return nil, NewStorageError(ErrValidation, "unknown conflict policy "+opts.OnConflict, nil)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, NewStorageError(ErrValidation, "not a bundle", err)
+	}
+	defer zr.Close()
+
+	manifest, err := readBundleManifest(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	br := &bundleReader{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		br.files[f.Name] = f
+	}
+	if manifest.Encryption != nil {
+		if opts.Password == "" {
+			return nil, NewStorageError(ErrValidation, "bundle is password protected", nil)
+		}
+		if br.cipher, err = newBundleCipher(opts.Password, manifest.Encryption); err != nil {
+			return nil, err
+		}
+		if check, err := br.cipher.open(manifest.Encryption.Check); err != nil || string(check) != bundleCheckText {
+			return nil, NewStorageError(ErrValidation, "wrong bundle password", nil)
+		}
+	}
+
+	tables := make(map[string][]map[string]interface{})
+	for _, info := range manifest.Tables {
+		data, err := br.read(info.File)
+		if err != nil {
+			return nil, err
+		}
+		if tables[info.Name], err = parseBundleRows(data); err != nil {
+			return nil, NewStorageError(ErrValidation, "invalid rows in "+info.File, err)
+		}
+	}
+
+	result := &BundleImportResult{
+		Inserted: make(map[string]int),
+		Merged:   make(map[string]int),
+		Skipped:  make(map[string]int),
+	}
+
+	se := bm.storageEngine
+	if opts.OnConflict == BundleConflictReplace {
+		for _, row := range tables["sessions"] {
+			date, _ := row["date"].(string)
+			if _, err := se.sessionMgr.Get(date); err == nil {
+				// Import already runs on the writer
+				if err := se.deleteSession(date, true); err != nil {
+					return nil, err
+				}
+				result.SessionsReplaced++
+			}
+		}
+	}
+
+	idMaps, inserted, err := bm.importRows(tables, opts, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bm.importFiles(br, result); err != nil {
+		return result, err
+	}
+
+	if se.vectorMgr != nil {
+		if err := bm.importEmbeddings(br, manifest, opts, idMaps, inserted, result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// parseBundleRows decodes NDJSON rows, keeping numbers exact.
+func parseBundleRows(data []byte) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// bundleInt64 reads an integer bundle value.
+func bundleInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		id, err := v.Int64()
+		return id, err == nil
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// importedRows tracks what an import inserted, for embeddings.
+type importedRows struct {
+	sessions map[int64]bool  // New session IDs
+	notes    map[int64]int64 // New note ID -> new session ID
+	noteText map[int64]string
+}
+
+// importRows inserts the bundle's rows in one transaction and returns the
+// ID mapping of every table from bundle IDs to store IDs.
+func (bm *BundleManager) importRows(tables map[string][]map[string]interface{}, opts BundleImportOptions,
+	result *BundleImportResult) (map[string]map[int64]int64, *importedRows, error) {
+	sm := bm.storageEngine.sessionMgr
+
+	destColumns := make(map[string][]bundleColumn)
+	for _, table := range bundleTables {
+		columns, err := tableColumns(sm.DB(), table.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		destColumns[table.name] = columns
+	}
+
+	tx, err := sm.DB().Begin()
+	if err != nil {
+		return nil, nil, NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	idMaps := make(map[string]map[int64]int64)
+	inserted := &importedRows{sessions: make(map[int64]bool), notes: make(map[int64]int64), noteText: make(map[int64]string)}
+	for _, table := range bundleTables {
+		columns := destColumns[table.name]
+		idMaps[table.name] = make(map[int64]int64)
+		if len(columns) == 0 {
+			continue
+		}
+		rowID := hasRowID(columns)
+
+	rows:
+		for _, row := range tables[table.name] {
+			oldID, _ := bundleInt64(row["id"])
+
+			// Remap references; rows whose parent wasn't imported are skipped
+			for column, parent := range table.refs {
+				if row[column] == nil {
+					continue
+				}
+				ref, _ := bundleInt64(row[column])
+				newRef, ok := idMaps[parent][ref]
+				if !ok {
+					result.Skipped[table.name]++
+					continue rows
+				}
+				row[column] = newRef
+			}
+			if table.entityRef {
+				entity, _ := row["entity_type"].(string)
+				rt, ok := revisionTables[RevisionEntity(entity)]
+				ref, _ := bundleInt64(row["entity_id"])
+				newRef, mapped := idMaps[rt.table][ref]
+				if !ok || !mapped {
+					result.Skipped[table.name]++
+					continue rows
+				}
+				row["entity_id"] = newRef
+			}
+
+			// Merge into an existing row with the same natural key
+			existing, found, err := findNaturalRow(tx, table, rowID, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			if found {
+				if table.name == "sessions" && opts.OnConflict == BundleConflictSkip {
+					result.Skipped[table.name]++
+					continue
+				}
+				if rowID {
+					idMaps[table.name][oldID] = existing
+				}
+				result.Merged[table.name]++
+				continue
+			}
+
+			// Re-encrypt under the data key of the row's session in this store.
+			// A new session's own text is sealed once the session exists
+			sessionID, err := bundleRowSession(tx, table.name, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			var plaintext string
+			sealed := make(map[string][]byte)
+			for _, column := range table.encryptedBlobs {
+				text, ok := row[column].(string)
+				if !ok {
+					row[column] = nil
+					continue
+				}
+				if sm.encryptionMgr == nil {
+					row[column] = []byte(text)
+					continue
+				}
+				if table.name == "sessions" {
+					sealed[column] = []byte(text)
+					row[column] = nil
+					continue
+				}
+				ciphertext, err := sm.sealFor(tx, sessionID, []byte(text))
+				if err != nil {
+					return nil, nil, NewStorageError(ErrEncryption, "failed to encrypt "+table.name+"."+column, err)
+				}
+				row[column] = ciphertext
+			}
+			if table.encryptedText != "" {
+				plaintext, _ = row[table.encryptedText].(string)
+				ciphertext, encrypted, err := sm.encryptNote(tx, sessionID, plaintext)
+				if err != nil {
+					return nil, nil, err
+				}
+				row[table.encryptedText] = ciphertext
+				row["encrypted"] = 0
+				if encrypted {
+					row["encrypted"] = 1
+				}
+			}
+
+			newID, err := insertBundleRow(tx, table.name, columns, rowID, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			result.Inserted[table.name]++
+			for column, text := range sealed {
+				ciphertext, err := sm.sealFor(tx, newID, text)
+				if err != nil {
+					return nil, nil, NewStorageError(ErrEncryption, "failed to encrypt "+table.name+"."+column, err)
+				}
+				if _, err := tx.Exec("UPDATE "+table.name+" SET "+column+" = ? WHERE id = ?", ciphertext, newID); err != nil {
+					return nil, nil, NewStorageError(ErrDatabase, "failed to store "+table.name+"."+column, err)
+				}
+			}
+			if !rowID {
+				continue
+			}
+			idMaps[table.name][oldID] = newID
+
+			switch table.name {
+			case "sessions":
+				inserted.sessions[newID] = true
+			case "manual_notes":
+				if _, err := tx.Exec(`INSERT INTO notes_fts(rowid, content) VALUES (?, ?)`, newID, plaintext); err != nil {
+					return nil, nil, NewStorageError(ErrDatabase, "failed to index note", err)
+				}
+				sessionID, _ := bundleInt64(row["session_id"])
+				inserted.notes[newID] = sessionID
+				inserted.noteText[newID] = plaintext
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, NewStorageError(ErrDatabase, "failed to commit bundle import", err)
+	}
+	return idMaps, inserted, nil
+}
+
+// bundleRowSession returns the store session a remapped row belongs to, or 0
+// if it has none.
+func bundleRowSession(tx *sql.Tx, table string, row map[string]interface{}) (int64, error) {
+	var query string
+	var ref interface{}
+	switch table {
+	case "activity_blocks":
+		query, ref = "SELECT session_id FROM app_activities WHERE id = ?", row["app_activity_id"]
+	case "note_revisions":
+		query, ref = "SELECT session_id FROM manual_notes WHERE id = ?", row["note_id"]
+	default:
+		sessionID, _ := bundleInt64(row["session_id"])
+		return sessionID, nil
+	}
+	if ref == nil {
+		return 0, nil
+	}
+	var sessionID int64
+	if err := tx.QueryRow(query, ref).Scan(&sessionID); err != nil && err != sql.ErrNoRows {
+		return 0, NewStorageError(ErrDatabase, "failed to get session of "+table, err)
+	}
+	return sessionID, nil
+}
+
+// findNaturalRow looks up an existing row with the same natural key. IS
+// matches NULLs as equal.
+func findNaturalRow(tx *sql.Tx, table bundleTable, rowID bool, row map[string]interface{}) (int64, bool, error) {
+	if len(table.natural) == 0 {
+		return 0, false, nil
+	}
+
+	where := make([]string, len(table.natural))
+	args := make([]interface{}, len(table.natural))
+	for i, column := range table.natural {
+		where[i] = column + " IS ?"
+		args[i] = bundleArg(row[column], false)
+	}
+	selectColumn := "1"
+	if rowID {
+		selectColumn = "id"
+	}
+
+	var id int64
+	err := tx.QueryRow("SELECT "+selectColumn+" FROM "+table.name+" WHERE "+strings.Join(where, " AND ")+" LIMIT 1", args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, NewStorageError(ErrDatabase, "failed to match "+table.name+" row", err)
+	}
+	return id, true, nil
+}
+
+// bundleArg converts a bundle value to a query argument.
+func bundleArg(value interface{}, blob bool) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		if blob {
+			if data, err := base64.StdEncoding.DecodeString(v); err == nil {
+				return data
+			}
+		}
+		return v
+	}
+	return value
+}
+
+// insertBundleRow inserts the row's columns that exist in the destination
+// table, letting SQLite assign the integer id.
+func insertBundleRow(tx *sql.Tx, table string, columns []bundleColumn, rowID bool, row map[string]interface{}) (int64, error) {
+	var names, marks []string
+	var args []interface{}
+	for _, column := range columns {
+		value, ok := row[column.name]
+		if !ok || (rowID && column.name == "id") {
+			continue
+		}
+		names = append(names, column.name)
+		marks = append(marks, "?")
+		args = append(args, bundleArg(value, column.declared == "BLOB"))
+	}
+
+	res, err := tx.Exec("INSERT INTO "+table+" ("+strings.Join(names, ", ")+") VALUES ("+strings.Join(marks, ", ")+")", args...)
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to import "+table+" row", err)
+	}
+	if !rowID {
+		return 0, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get "+table+" ID", err)
+	}
+	return id, nil
+}
+
+// importFiles copies the bundle's session files, encrypted under this
+// store's key, keeping files that already exist.
+func (bm *BundleManager) importFiles(br *bundleReader, result *BundleImportResult) error {
+	fm := bm.storageEngine.fileMgr
+	for name := range br.files {
+		if !strings.HasPrefix(name, bundleFilesPrefix) {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(name, bundleFilesPrefix))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) || isFileMetadata(rel) || sessionOf(rel) == blobDir {
+			continue
+		}
+		if _, err := fm.stat(rel); err == nil {
+			continue
+		}
+
+		data, err := br.read(name)
+		if err != nil {
+			return err
+		}
+		if err := fm.put(FileRef{Path: rel}, data); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to write "+rel, err)
+		}
+		result.Files++
+	}
+	return nil
+}
+
+// importEmbeddings stores the bundled embeddings of imported sessions and
+// notes when they come from this store's model, and queues the rest to be
+// regenerated.
+func (bm *BundleManager) importEmbeddings(br *bundleReader, manifest *BundleManifest, opts BundleImportOptions,
+	idMaps map[string]map[int64]int64, inserted *importedRows, result *BundleImportResult) error {
+	se := bm.storageEngine
+	vm := se.vectorMgr
+
+	restored := make(map[string]bool)
+	if !opts.RegenerateEmbeddings {
+		data, err := br.read(bundleEmbeddingsName)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var e bundleEmbedding
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Model != vm.GetModelVersion() {
+				continue
+			}
+			switch e.Kind {
+			case "session":
+				id, ok := idMaps["sessions"][e.ID]
+				if ok && inserted.sessions[id] && vm.StoreEmbedding(id, e.Embedding) == nil {
+					restored[fmt.Sprintf("session_%d", id)] = true
+					result.EmbeddingsRestored++
+				}
+			case "note":
+				id, ok := idMaps["manual_notes"][e.ID]
+				if sessionID, isNew := inserted.notes[id]; ok && isNew && vm.StoreNoteEmbedding(id, sessionID, e.Embedding) == nil {
+					restored[fmt.Sprintf("note_%d", id)] = true
+					result.EmbeddingsRestored++
+				}
+			}
+		}
+	}
+
+	for id := range inserted.sessions {
+		if restored[fmt.Sprintf("session_%d", id)] {
+			continue
+		}
+		session, err := se.sessionMgr.GetByID(id)
+		if err != nil {
+			continue
+		}
+		text := strings.TrimSpace(session.CustomSummary + " " + session.OriginalSummary + " " + session.ExtractedText)
+		if text != "" && vm.QueueEmbedding(id, text) == nil {
+			result.EmbeddingsQueued++
+		}
+	}
+	for id, sessionID := range inserted.notes {
+		if restored[fmt.Sprintf("note_%d", id)] {
+			continue
+		}
+		if vm.QueueNoteEmbedding(id, sessionID, inserted.noteText[id]) == nil {
+			result.EmbeddingsQueued++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupBundleEngine(t *testing.T) *StorageEngine {
+	t.Helper()
+
+	se := NewStorageEngine(DefaultStorageConfig(t.TempDir()))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	t.Cleanup(func() { se.Close() })
+	return se
+}
+
+// TestBundle tests exporting a store to a password protected bundle and
+// importing it into another store.
+func TestBundle(t *testing.T) {
+	src := setupBundleEngine(t)
+
+	session, err := src.CreateSession("2025-08-04")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	session.CustomTitle = "Migration day"
+	session.ExtractedText = "secret captured text"
+	if err := src.UpdateSession(session); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	start := time.Date(2025, 8, 4, 9, 0, 0, 0, time.UTC)
+	block := &ActivityBlock{BlockID: "09-00", StartTime: start, EndTime: start.Add(5 * time.Minute), OCRText: "ocr words"}
+	if err := src.AddActivityBlock(session.Date, "Code", block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	if err := src.AddChat(session.Date, &ChatMessage{Role: ChatRoleUser, Content: "hello there", Timestamp: start}); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	if err := src.AddNote(session.Date, &ManualNote{Content: "private note"}); err != nil {
+		t.Fatalf("Failed to add note: %v", err)
+	}
+	if _, err := src.TagItem(TagTargetSession, int64(session.ID), "project:move"); err != nil {
+		t.Fatalf("Failed to tag session: %v", err)
+	}
+	if _, err := src.SaveScreenshot(session.Date, "Code", "shot.png", []byte("png")); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+	embedding := make([]float32, 768)
+	embedding[0] = 1
+	if err := src.vectorMgr.StoreEmbedding(int64(session.ID), embedding); err != nil {
+		t.Fatalf("Failed to store embedding: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.zip")
+	exported, err := src.ExportBundle(path, BundleExportOptions{Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if exported.Rows["sessions"] != 1 || exported.Files != 1 || exported.Embeddings != 1 || exported.Undecryptable != 0 {
+		t.Errorf("Unexpected export result: %+v", exported)
+	}
+
+	// The destination has its own key and an unrelated session taking ID 1
+	dst := setupBundleEngine(t)
+	if _, err := dst.CreateSession("2025-08-01"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	t.Run("Rejects a wrong password", func(t *testing.T) {
+		if _, err := dst.ImportBundle(path, BundleImportOptions{Password: "wrong"}); !IsValidation(err) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+		if _, err := dst.ImportBundle(path, BundleImportOptions{}); !IsValidation(err) {
+			t.Errorf("Expected validation error without password, got %v", err)
+		}
+	})
+
+	t.Run("Imports under the destination key", func(t *testing.T) {
+		result, err := dst.ImportBundle(path, BundleImportOptions{Password: "hunter2"})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.Inserted["sessions"] != 1 || result.Inserted["chats"] != 1 || result.Files != 1 || result.EmbeddingsRestored != 1 {
+			t.Errorf("Unexpected import result: %+v", result)
+		}
+
+		imported, err := dst.GetSession("2025-08-04")
+		if err != nil {
+			t.Fatalf("Failed to get imported session: %v", err)
+		}
+		if imported.ID == session.ID {
+			t.Errorf("Expected the session to get a new ID")
+		}
+		if imported.CustomTitle != "Migration day" || imported.ExtractedText != "secret captured text" {
+			t.Errorf("Unexpected imported session: %+v", imported)
+		}
+		blocks, err := dst.GetActivityBlocks(imported.Date, "Code")
+		if err != nil || len(blocks) != 1 || blocks[0].OCRText != "ocr words" || !blocks[0].StartTime.Equal(start) {
+			t.Errorf("Unexpected imported blocks: %+v (%v)", blocks, err)
+		}
+		chats, err := dst.GetChats(imported.Date)
+		if err != nil || len(chats) != 1 || chats[0].Content != "hello there" {
+			t.Errorf("Unexpected imported chats: %+v (%v)", chats, err)
+		}
+		notes, err := dst.GetNotes(imported.Date)
+		if err != nil || len(notes) != 1 || notes[0].Content != "private note" {
+			t.Errorf("Unexpected imported notes: %+v (%v)", notes, err)
+		}
+		tags, err := dst.GetItemTags(TagTargetSession, int64(imported.ID))
+		if err != nil || len(tags) != 1 || tags[0].Name != "project:move" {
+			t.Errorf("Unexpected imported tags: %+v (%v)", tags, err)
+		}
+		got, _, err := dst.vectorMgr.GetEmbedding(int64(imported.ID))
+		if err != nil || len(got) != len(embedding) {
+			t.Errorf("Expected the embedding to be carried over, got %v (%v)", got, err)
+		}
+	})
+
+	t.Run("Importing again merges without duplicates", func(t *testing.T) {
+		result, err := dst.ImportBundle(path, BundleImportOptions{Password: "hunter2"})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		for table, n := range result.Inserted {
+			t.Errorf("Expected nothing inserted, got %d rows in %s", n, table)
+		}
+		if result.Merged["sessions"] != 1 || result.Merged["chats"] != 1 {
+			t.Errorf("Unexpected merge result: %+v", result)
+		}
+		chats, _ := dst.GetChats("2025-08-04")
+		if len(chats) != 1 {
+			t.Errorf("Expected 1 chat after re-import, got %d", len(chats))
+		}
+	})
+
+	t.Run("Skip leaves existing sessions alone", func(t *testing.T) {
+		result, err := dst.ImportBundle(path, BundleImportOptions{Password: "hunter2", OnConflict: BundleConflictSkip})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if result.Skipped["sessions"] != 1 || result.Merged["chats"] != 0 || len(result.Inserted) != 0 {
+			t.Errorf("Unexpected skip result: %+v", result)
+		}
+		if _, err := dst.ImportBundle(path, BundleImportOptions{Password: "hunter2", OnConflict: "overwrite"}); !IsValidation(err) {
+			t.Errorf("Expected validation error for unknown conflict policy, got %v", err)
+		}
+	})
+}
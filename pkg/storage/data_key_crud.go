@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+)
+
+// execQueryer is implemented by *sql.DB and *sql.Tx.
+type execQueryer interface {
+	queryer
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sessionSealedColumns lists the encrypted columns holding session data,
+// each with a query selecting a value's row ID, session ID and ciphertext.
+// Text columns hold base64.
+var sessionSealedColumns = []struct {
+	table, column string
+	text          bool
+	query         string
+}{
+	{table: "sessions", column: "extracted_text_encrypted",
+		query: "SELECT id, id, extracted_text_encrypted FROM sessions WHERE LENGTH(extracted_text_encrypted) > 0"},
+	{table: "activity_blocks", column: "ocr_text_encrypted",
+		query: `SELECT b.id, a.session_id, b.ocr_text_encrypted FROM activity_blocks b
+			JOIN app_activities a ON a.id = b.app_activity_id WHERE LENGTH(b.ocr_text_encrypted) > 0`},
+	{table: "chats", column: "content_encrypted",
+		query: "SELECT id, session_id, content_encrypted FROM chats WHERE session_id IS NOT NULL AND LENGTH(content_encrypted) > 0"},
+	{table: "manual_notes", column: "content", text: true,
+		query: "SELECT id, session_id, content FROM manual_notes WHERE encrypted = 1"},
+	{table: "note_revisions", column: "content", text: true,
+		query: `SELECT r.id, n.session_id, r.content FROM note_revisions r
+			JOIN manual_notes n ON n.id = r.note_id WHERE r.encrypted = 1`},
+}
+
+// sessionDataKey returns the ID of a session's data key, creating the key
+// if the session has none yet.
+func (sm *SessionManager) sessionDataKey(q execQueryer, sessionID int64) (int64, error) {
+	var id int64
+	var wrapped []byte
+	err := q.QueryRow("SELECT id, wrapped_key FROM data_keys WHERE session_id = ?", sessionID).Scan(&id, &wrapped)
+	if err == nil {
+		if !sm.encryptionMgr.HasDataKey(id) {
+			if err := sm.encryptionMgr.LoadDataKey(id, wrapped); err != nil {
+				return 0, err
+			}
+		}
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, NewStorageError(ErrDatabase, "failed to get data key", err)
+	}
+
+	id, wrapped, err = sm.encryptionMgr.NewDataKey()
+	if err != nil {
+		return 0, err
+	}
+	result, err := q.Exec("INSERT OR IGNORE INTO data_keys (id, session_id, wrapped_key) VALUES (?, ?, ?)", id, sessionID, wrapped)
+	if err != nil {
+		sm.encryptionMgr.ForgetDataKey(id)
+		return 0, NewStorageError(ErrDatabase, "failed to store data key", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Another writer created the session's key first
+		sm.encryptionMgr.ForgetDataKey(id)
+		return sm.sessionDataKey(q, sessionID)
+	}
+	return id, nil
+}
+
+// sessionDataKeyByDate returns the ID of the data key of the session on a
+// date, or 0 if there is no such session.
+func (sm *SessionManager) sessionDataKeyByDate(date string) (int64, error) {
+	var sessionID int64
+	err := sm.db.QueryRow("SELECT id FROM sessions WHERE date = ?", date).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get session", err)
+	}
+	return sm.sessionDataKey(sm.db, sessionID)
+}
+
+// sealFor encrypts plaintext under a session's data key, or the master key
+// if sessionID is 0.
+func (sm *SessionManager) sealFor(q execQueryer, sessionID int64, plaintext []byte) ([]byte, error) {
+	if sessionID == 0 {
+		return sm.encryptionMgr.Encrypt(plaintext)
+	}
+	id, err := sm.sessionDataKey(q, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return sm.encryptionMgr.EncryptWithKey(id, plaintext)
+}
+
+// sealStringFor encrypts a string like sealFor, returning base64.
+func (sm *SessionManager) sealStringFor(q execQueryer, sessionID int64, plaintext string) (string, error) {
+	if sessionID == 0 {
+		return sm.encryptionMgr.EncryptString(plaintext)
+	}
+	id, err := sm.sessionDataKey(q, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return sm.encryptionMgr.EncryptStringWithKey(id, plaintext)
+}
+
+// LoadDataKeys unwraps every stored data key so sealed data can be read.
+// Keys destroyed in a backup snapshot are skipped. Returns the number of
+// keys loaded.
+func (sm *SessionManager) LoadDataKeys() (int, error) {
+	keys, err := sm.ListDataKeys()
+	if err != nil {
+		return 0, err
+	}
+	for id, wrapped := range keys {
+		if err := sm.encryptionMgr.LoadDataKey(id, wrapped); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// ListDataKeys returns the wrapped data keys by ID.
+func (sm *SessionManager) ListDataKeys() (map[int64][]byte, error) {
+	rows, err := sm.db.Query("SELECT id, wrapped_key FROM data_keys WHERE wrapped_key IS NOT NULL")
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query data keys", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		var wrapped []byte
+		if err := rows.Scan(&id, &wrapped); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan data key", err)
+		}
+		keys[id] = wrapped
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating data keys", err)
+	}
+	return keys, nil
+}
+
+// GetSessionDataKeyID returns the ID of a session's data key, or 0 if it
+// has none.
+func (sm *SessionManager) GetSessionDataKeyID(sessionID int64) (int64, error) {
+	var id int64
+	err := sm.db.QueryRow("SELECT id FROM data_keys WHERE session_id = ?", sessionID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get data key", err)
+	}
+	return id, nil
+}
+
+// DestroyDataKey deletes a data key, which deleting its session already
+// does, forgets it and checkpoints the WAL so no copy of it is left in the
+// log. The full-text indexes are merged first: FTS5 only marks deleted rows,
+// so the terms of the session's summaries would otherwise stay in them.
+func (sm *SessionManager) DestroyDataKey(id int64) error {
+	if _, err := sm.db.Exec("DELETE FROM data_keys WHERE id = ?", id); err != nil {
+		return NewStorageError(ErrDatabase, "failed to delete data key", err)
+	}
+	sm.encryptionMgr.ForgetDataKey(id)
+	for _, table := range []string{"sessions_fts", "activity_blocks_fts", "notes_fts"} {
+		if _, err := sm.db.Exec("INSERT INTO " + table + "(" + table + ") VALUES ('optimize')"); err != nil {
+			return NewStorageError(ErrDatabase, "failed to merge "+table, err)
+		}
+	}
+	if _, err := sm.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return NewStorageError(ErrDatabase, "failed to checkpoint database", err)
+	}
+	return nil
+}
+
+// GetShreddedSessions returns the dates of sessions whose data key has
+// been destroyed, as happens when a backup taken before a session was
+// deleted is restored.
+func (sm *SessionManager) GetShreddedSessions() ([]string, error) {
+	rows, err := sm.db.Query(`
+		SELECT s.date FROM sessions s
+		JOIN data_keys k ON k.session_id = s.id
+		WHERE k.wrapped_key IS NULL
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query sessions", err)
+	}
+	defer rows.Close()
+
+	var dates []string
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan session", err)
+		}
+		dates = append(dates, date)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating sessions", err)
+	}
+	return dates, nil
+}
+
+// resealSessionData re-encrypts session data sealed with the master key
+// under the sessions' data keys. Values the master key can't open are left
+// as they are. Returns the number of values resealed.
+func (sm *SessionManager) resealSessionData(tx *sql.Tx) (int, error) {
+	count := 0
+	for _, sc := range sessionSealedColumns {
+		values, err := readSessionSealedValues(tx, sc.query)
+		if err != nil {
+			return count, err
+		}
+		for _, v := range values {
+			ciphertext := v.data
+			if sc.text {
+				if ciphertext, err = base64.StdEncoding.DecodeString(string(v.data)); err != nil {
+					continue
+				}
+			}
+			if _, sealed := DataKeyOf(ciphertext); sealed {
+				continue // Already under a data key
+			}
+			plaintext, err := sm.encryptionMgr.Decrypt(ciphertext)
+			if err != nil {
+				continue
+			}
+
+			var value interface{}
+			if sc.text {
+				value, err = sm.sealStringFor(tx, v.session, string(plaintext))
+			} else {
+				value, err = sm.sealFor(tx, v.session, plaintext)
+			}
+			if err != nil {
+				return count, err
+			}
+			if _, err := tx.Exec("UPDATE "+sc.table+" SET "+sc.column+" = ? WHERE id = ?", value, v.id); err != nil {
+				return count, NewStorageError(ErrDatabase, "failed to reseal "+sc.table, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// sessionSealedValue is one encrypted value of a session.
+type sessionSealedValue struct {
+	id, session int64
+	data        []byte
+}
+
+// readSessionSealedValues reads the values selected by a
+// sessionSealedColumns query.
+func readSessionSealedValues(tx *sql.Tx, query string) ([]sessionSealedValue, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query encrypted values", err)
+	}
+	defer rows.Close()
+
+	var values []sessionSealedValue
+	for rows.Next() {
+		var v sessionSealedValue
+		if err := rows.Scan(&v.id, &v.session, &v.data); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan encrypted value", err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating encrypted values", err)
+	}
+	return values, nil
+}
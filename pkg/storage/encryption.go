@@ -36,11 +36,12 @@ const (
 // EncryptionManager handles encryption/decryption using AES-256-GCM.
 // Key material is stored via a vault.Vault (DPAPI on Windows).
 type EncryptionManager struct {
-	key   []byte
-	salt  []byte
-	aead  cipher.AEAD
-	vault vault.Vault
-	mutex sync.RWMutex
+	key      []byte
+	salt     []byte
+	aead     cipher.AEAD
+	vault    vault.Vault
+	dataKeys map[int64]*dataKey // Unwrapped per-session keys by ID
+	mutex    sync.RWMutex
 }
 
 // NewEncryptionManager creates a new EncryptionManager backed by the given data directory.
@@ -65,6 +66,12 @@ func (em *EncryptionManager) InitializeKey() error {
 		}
 	}
 
+	return em.loadKey(combined)
+}
+
+// loadKey derives the encryption key from stored key material and makes it
+// current. The caller holds the lock.
+func (em *EncryptionManager) loadKey(combined []byte) error {
 	if len(combined) != KeySize+SaltSize {
 		return NewStorageError(ErrEncryption, "invalid key data length", nil)
 	}
@@ -155,6 +162,16 @@ func (em *EncryptionManager) Decrypt(ciphertext []byte) ([]byte, error) {
 		return []byte{}, nil
 	}
 
+	// Values sealed with a data key name it in a header. A legacy value
+	// whose random nonce happens to look like one falls through to the
+	// master key.
+	id, sealed := DataKeyOf(ciphertext)
+	if dk := em.dataKeys[id]; sealed && dk != nil {
+		if plaintext, err := dk.open(ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+
 	// Validate minimum length (nonce + at least auth tag)
 	if len(ciphertext) < NonceSize+em.aead.Overhead() {
 		return nil, NewStorageError(ErrEncryption, "ciphertext too short", nil)
@@ -167,6 +184,9 @@ func (em *EncryptionManager) Decrypt(ciphertext []byte) ([]byte, error) {
 	// Decrypt
 	plaintext, err := em.aead.Open(nil, nonce, encryptedData, nil)
 	if err != nil {
+		if sealed && em.dataKeys[id] == nil {
+			return nil, NewStorageError(ErrEncryption, "data key not available", err)
+		}
 		return nil, NewStorageError(ErrEncryption, "decryption failed", err)
 	}
 
@@ -217,8 +237,10 @@ func (em *EncryptionManager) RotateKey(newPassphrase string) error {
 		return NewStorageError(ErrEncryption, "failed to generate new salt", err)
 	}
 
-	// Derive new key from passphrase
-	newKey := argon2.IDKey([]byte(newPassphrase), newSalt, argon2Time, argon2Memory, argon2Threads, KeySize)
+	// Derive a master key from the passphrase, then the encryption key from
+	// it as InitializeKey does, so the stored key loads on the next start
+	masterKey := argon2.IDKey([]byte(newPassphrase), newSalt, argon2Time, argon2Memory, argon2Threads, KeySize)
+	newKey := argon2.IDKey(masterKey, newSalt, argon2Time, argon2Memory, argon2Threads, KeySize)
 
 	// Create new cipher
 	block, err := aes.NewCipher(newKey)
@@ -232,7 +254,7 @@ func (em *EncryptionManager) RotateKey(newPassphrase string) error {
 	}
 
 	// Store new key material in vault
-	combined := append([]byte(newPassphrase), newSalt...)
+	combined := append(masterKey, newSalt...)
 	if err := em.vault.Save(VaultKeyName, combined); err != nil {
 		return NewStorageError(ErrEncryption, "failed to store new key", err)
 	}
@@ -244,3 +266,27 @@ func (em *EncryptionManager) RotateKey(newPassphrase string) error {
 
 	return nil
 }
+
+// snapshot returns a copy of the current key that stays usable after a
+// rotation, along with the stored key material to restore it from.
+func (em *EncryptionManager) snapshot() (*EncryptionManager, []byte, error) {
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+
+	if em.aead == nil {
+		return nil, nil, NewStorageError(ErrEncryption, "encryption not initialized", nil)
+	}
+	combined, err := em.vault.Load(VaultKeyName)
+	if err != nil {
+		return nil, nil, NewStorageError(ErrEncryption, "failed to load key", err)
+	}
+	return &EncryptionManager{key: em.key, salt: em.salt, aead: em.aead}, combined, nil
+}
+
+// restoreKey stores key material taken by snapshot and loads it again.
+func (em *EncryptionManager) restoreKey(combined []byte) error {
+	if err := em.vault.Save(VaultKeyName, combined); err != nil {
+		return NewStorageError(ErrEncryption, "failed to restore key", err)
+	}
+	return em.InitializeKey()
+}
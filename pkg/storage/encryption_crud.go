@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+)
+
+// encryptedValue is one encrypted column value awaiting re-encryption.
+type encryptedValue struct {
+	id   int64
+	data []byte
+}
+
+// ReencryptColumns re-wraps the data keys and re-encrypts every column value
+// sealed with the master key from one key to another in a single
+// transaction. Values under data keys, and values the old key can't open
+// such as rows written after the new key took effect, are left as they are.
+// Returns the number of keys and values re-encrypted.
+func (sm *SessionManager) ReencryptColumns(from, to *EncryptionManager) (int, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Data keys are re-wrapped; the session data they seal is left alone
+	count := 0
+	keys, err := readEncryptedValues(tx, "SELECT id, wrapped_key FROM data_keys WHERE LENGTH(wrapped_key) > 0")
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		key, err := from.Decrypt(k.data)
+		if err != nil {
+			continue
+		}
+		wrapped, err := to.Encrypt(key)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE data_keys SET wrapped_key = ? WHERE id = ?", wrapped, k.id); err != nil {
+			return 0, NewStorageError(ErrDatabase, "failed to re-wrap data key", err)
+		}
+		count++
+	}
+
+	for _, table := range bundleTables {
+		for _, column := range table.encryptedBlobs {
+			values, err := readEncryptedValues(tx, "SELECT id, "+column+" FROM "+table.name+" WHERE LENGTH("+column+") > 0")
+			if err != nil {
+				return 0, err
+			}
+			for _, v := range values {
+				if underDataKey(v.data, from, to) {
+					continue
+				}
+				plaintext, err := from.Decrypt(v.data)
+				if err != nil {
+					continue
+				}
+				ciphertext, err := to.Encrypt(plaintext)
+				if err != nil {
+					return 0, err
+				}
+				if _, err := tx.Exec("UPDATE "+table.name+" SET "+column+" = ? WHERE id = ?", ciphertext, v.id); err != nil {
+					return 0, NewStorageError(ErrDatabase, "failed to re-encrypt "+table.name, err)
+				}
+				count++
+			}
+		}
+
+		if table.encryptedText != "" {
+			column := table.encryptedText
+			values, err := readEncryptedValues(tx, "SELECT id, "+column+" FROM "+table.name+" WHERE encrypted = 1")
+			if err != nil {
+				return 0, err
+			}
+			for _, v := range values {
+				if ciphertext, err := base64.StdEncoding.DecodeString(string(v.data)); err == nil && underDataKey(ciphertext, from, to) {
+					continue
+				}
+				plaintext, err := from.DecryptString(string(v.data))
+				if err != nil {
+					continue
+				}
+				ciphertext, err := to.EncryptString(plaintext)
+				if err != nil {
+					return 0, err
+				}
+				if _, err := tx.Exec("UPDATE "+table.name+" SET "+column+" = ? WHERE id = ?", ciphertext, v.id); err != nil {
+					return 0, NewStorageError(ErrDatabase, "failed to re-encrypt "+table.name, err)
+				}
+				count++
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to commit re-encryption", err)
+	}
+	return count, nil
+}
+
+// readEncryptedValues reads the ID and value pairs selected by query.
+func readEncryptedValues(tx *sql.Tx, query string) ([]encryptedValue, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query encrypted values", err)
+	}
+	defer rows.Close()
+
+	var values []encryptedValue
+	for rows.Next() {
+		var v encryptedValue
+		if err := rows.Scan(&v.id, &v.data); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan encrypted value", err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating encrypted values", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+// Session data is sealed with a per-session data key rather than the master
+// key. Data keys are random, wrapped by the master key and stored in the
+// data_keys table, so deleting a session's key leaves its data unreadable
+// wherever a copy survives, and rotating the master key only re-wraps them.
+//
+// Sealed values name their key in a header, which is also authenticated:
+//
+//	magic (4) | key ID (8) | nonce (12) | ciphertext and tag
+const (
+	dataKeyMagic      = "WDK\x01"
+	dataKeyHeaderSize = len(dataKeyMagic) + 8
+)
+
+// dataKey is an unwrapped data key.
+type dataKey struct {
+	aead    cipher.AEAD
+	nameKey []byte // Keys the MAC that names blobs sealed with this key
+}
+
+// DataKeyOf returns the ID of the data key a value is sealed with, and
+// false for values sealed with the master key.
+func DataKeyOf(ciphertext []byte) (int64, bool) {
+	if len(ciphertext) < dataKeyHeaderSize+NonceSize || string(ciphertext[:len(dataKeyMagic)]) != dataKeyMagic {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(ciphertext[len(dataKeyMagic):dataKeyHeaderSize])), true
+}
+
+// underDataKey reports whether a value is sealed with a data key either
+// manager holds. Changing the master key leaves such values alone.
+func underDataKey(ciphertext []byte, from, to *EncryptionManager) bool {
+	id, sealed := DataKeyOf(ciphertext)
+	return sealed && (from.HasDataKey(id) || to.HasDataKey(id))
+}
+
+// newDataKey returns the ciphers for a raw data key.
+func newDataKey(key []byte) (*dataKey, error) {
+	aead, err := newFileAEAD(key)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create data key cipher", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("waddle blob names"))
+	return &dataKey{aead: aead, nameKey: mac.Sum(nil)}, nil
+}
+
+// seal encrypts plaintext under the data key with the given ID.
+func (dk *dataKey) seal(id int64, plaintext []byte) ([]byte, error) {
+	out := make([]byte, dataKeyHeaderSize+NonceSize, dataKeyHeaderSize+NonceSize+len(plaintext)+dk.aead.Overhead())
+	copy(out, dataKeyMagic)
+	binary.BigEndian.PutUint64(out[len(dataKeyMagic):], uint64(id))
+	nonce := out[dataKeyHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to generate nonce", err)
+	}
+	return dk.aead.Seal(out, nonce, plaintext, out[:dataKeyHeaderSize]), nil
+}
+
+// open decrypts a value sealed with the data key.
+func (dk *dataKey) open(ciphertext []byte) ([]byte, error) {
+	header := ciphertext[:dataKeyHeaderSize]
+	nonce := ciphertext[dataKeyHeaderSize : dataKeyHeaderSize+NonceSize]
+	return dk.aead.Open(nil, nonce, ciphertext[dataKeyHeaderSize+NonceSize:], header)
+}
+
+// NewDataKey generates a data key and returns its ID and the key wrapped by
+// the master key for storage. The key is usable right away.
+func (em *EncryptionManager) NewDataKey() (int64, []byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return 0, nil, NewStorageError(ErrEncryption, "failed to generate data key", err)
+	}
+	// IDs are random rather than assigned by the database, so a key created
+	// in a transaction that rolls back can never be mistaken for a later one
+	var buf [8]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return 0, nil, NewStorageError(ErrEncryption, "failed to generate data key ID", err)
+	}
+	id := int64(binary.BigEndian.Uint64(buf[:])>>1) | 1
+
+	wrapped, err := em.Encrypt(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	dk, err := newDataKey(key)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	if em.dataKeys == nil {
+		em.dataKeys = make(map[int64]*dataKey)
+	}
+	em.dataKeys[id] = dk
+	return id, wrapped, nil
+}
+
+// LoadDataKey unwraps a stored data key and makes it usable.
+func (em *EncryptionManager) LoadDataKey(id int64, wrapped []byte) error {
+	if len(wrapped) == 0 {
+		return NewStorageError(ErrEncryption, "data key has been destroyed", nil)
+	}
+	key, err := em.Decrypt(wrapped)
+	if err != nil {
+		return NewStorageError(ErrEncryption, "failed to unwrap data key", err)
+	}
+	dk, err := newDataKey(key)
+	if err != nil {
+		return err
+	}
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	if em.dataKeys == nil {
+		em.dataKeys = make(map[int64]*dataKey)
+	}
+	em.dataKeys[id] = dk
+	return nil
+}
+
+// HasDataKey reports whether a data key is loaded.
+func (em *EncryptionManager) HasDataKey(id int64) bool {
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+	return em.dataKeys[id] != nil
+}
+
+// ForgetDataKey drops a data key from memory once it has been destroyed.
+func (em *EncryptionManager) ForgetDataKey(id int64) {
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	delete(em.dataKeys, id)
+}
+
+// dataKey returns a loaded data key.
+func (em *EncryptionManager) dataKey(id int64) (*dataKey, error) {
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+	dk := em.dataKeys[id]
+	if dk == nil {
+		return nil, NewStorageError(ErrEncryption, "data key not available", nil)
+	}
+	return dk, nil
+}
+
+// EncryptWithKey encrypts plaintext under a data key. Decrypt opens the
+// result while the key is loaded.
+func (em *EncryptionManager) EncryptWithKey(id int64, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return []byte{}, nil
+	}
+	dk, err := em.dataKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return dk.seal(id, plaintext)
+}
+
+// EncryptStringWithKey encrypts a string under a data key and returns
+// base64-encoded ciphertext.
+func (em *EncryptionManager) EncryptStringWithKey(id int64, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ciphertext, err := em.EncryptWithKey(id, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// blobName returns the name of the blob holding data sealed with a data
+// key. Names are keyed, so equal content under different keys is stored
+// apart and a name reveals nothing about the content.
+func (em *EncryptionManager) blobName(id int64, data []byte) (string, error) {
+	dk, err := em.dataKey(id)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, dk.nameKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// RecoveryKeyVersion is the version of recovery keys.
+	RecoveryKeyVersion = 1
+	// RecoveryVaultKeyName is the name the recovery setup is stored under in
+	// the vault, so rotation can rewrap the master key without asking for
+	// the passphrase again.
+	RecoveryVaultKeyName = "recovery_key"
+
+	// minRecoveryPassphrase is the shortest passphrase recovery accepts.
+	minRecoveryPassphrase = 12
+	recoveryKeyAAD        = "waddle recovery key"
+)
+
+// RecoveryKey is an escrow of the master key wrapped under a key derived
+// from a recovery passphrase. With it and the passphrase, backups can be
+// restored after the vault holding the master key is lost, as on a
+// reinstalled OS or another machine.
+type RecoveryKey struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"createdAt"`
+	KDF        string    `json:"kdf"`
+	Salt       []byte    `json:"salt"`
+	Time       uint32    `json:"time"`
+	Memory     uint32    `json:"memory"`
+	Threads    uint8     `json:"threads"`
+	WrappedKey []byte    `json:"wrappedKey,omitempty"` // Nonce, then the sealed master key material
+}
+
+// recoverySetup is what the vault keeps of recovery: the key derived from
+// the passphrase and how it was derived.
+type recoverySetup struct {
+	Key []byte `json:"key"`
+	RecoveryKey
+}
+
+// deriveKey derives the key wrapping the master key from a passphrase.
+func (rk *RecoveryKey) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), rk.Salt, rk.Time, rk.Memory, rk.Threads, KeySize)
+}
+
+// open returns the key derived from the passphrase and the master key
+// material the recovery key wraps.
+func (rk *RecoveryKey) open(passphrase string) ([]byte, []byte, error) {
+	if rk.Version != RecoveryKeyVersion || rk.KDF != "argon2id" {
+		return nil, nil, NewStorageError(ErrValidation, "unsupported recovery key", nil)
+	}
+	key := rk.deriveKey(passphrase)
+	aead, err := newFileAEAD(key)
+	if err != nil {
+		return nil, nil, NewStorageError(ErrEncryption, "failed to create recovery cipher", err)
+	}
+	if len(rk.WrappedKey) < NonceSize+aead.Overhead() {
+		return nil, nil, NewStorageError(ErrValidation, "recovery key is truncated", nil)
+	}
+	combined, err := aead.Open(nil, rk.WrappedKey[:NonceSize], rk.WrappedKey[NonceSize:], []byte(recoveryKeyAAD))
+	if err != nil {
+		return nil, nil, NewStorageError(ErrValidation, "wrong recovery passphrase", nil)
+	}
+	return key, combined, nil
+}
+
+// manager returns an encryption manager holding the master key a recovery
+// key wraps, without storing it.
+func (rk *RecoveryKey) manager(passphrase string) (*EncryptionManager, error) {
+	_, combined, err := rk.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	em := &EncryptionManager{}
+	if err := em.loadKey(combined); err != nil {
+		return nil, err
+	}
+	return em, nil
+}
+
+// ReadRecoveryKey reads a recovery key file.
+func ReadRecoveryKey(path string) (*RecoveryKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NewStorageError(ErrNotFound, "recovery key not found", err)
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to read recovery key", err)
+	}
+	var rk RecoveryKey
+	if err := json.Unmarshal(data, &rk); err != nil {
+		return nil, NewStorageError(ErrValidation, "invalid recovery key", err)
+	}
+	return &rk, nil
+}
+
+// EnableRecovery sets up recovery of the master key under a passphrase,
+// replacing any earlier setup, and returns the recovery key.
+func (em *EncryptionManager) EnableRecovery(passphrase string) (*RecoveryKey, error) {
+	if len(passphrase) < minRecoveryPassphrase {
+		return nil, NewStorageError(ErrValidation, "recovery passphrase must be at least 12 characters", nil)
+	}
+	setup := recoverySetup{RecoveryKey: RecoveryKey{
+		Version: RecoveryKeyVersion, KDF: "argon2id", Salt: make([]byte, SaltSize),
+		Time: argon2Time, Memory: argon2Memory, Threads: argon2Threads,
+	}}
+	if _, err := io.ReadFull(rand.Reader, setup.Salt); err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to generate salt", err)
+	}
+	setup.Key = setup.deriveKey(passphrase)
+	if err := em.saveRecoverySetup(&setup); err != nil {
+		return nil, err
+	}
+	return em.RecoveryKey()
+}
+
+// RecoveryKey returns the current master key wrapped for recovery, or a
+// not found error if recovery is not set up.
+func (em *EncryptionManager) RecoveryKey() (*RecoveryKey, error) {
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+
+	data, err := em.vault.Load(RecoveryVaultKeyName)
+	if err != nil {
+		return nil, NewStorageError(ErrNotFound, "recovery is not set up", err)
+	}
+	var setup recoverySetup
+	if err := json.Unmarshal(data, &setup); err != nil {
+		return nil, NewStorageError(ErrEncryption, "invalid recovery setup", err)
+	}
+	combined, err := em.vault.Load(VaultKeyName)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to load key", err)
+	}
+
+	aead, err := newFileAEAD(setup.Key)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create recovery cipher", err)
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to generate nonce", err)
+	}
+	rk := setup.RecoveryKey
+	rk.CreatedAt = time.Now().UTC()
+	rk.WrappedKey = aead.Seal(nonce, nonce, combined, []byte(recoveryKeyAAD))
+	return &rk, nil
+}
+
+// RecoverKey makes the master key a recovery key wraps current, storing it
+// in the vault along with the recovery setup. Data keys unwrapped under the
+// previous key are forgotten.
+func (em *EncryptionManager) RecoverKey(rk *RecoveryKey, passphrase string) error {
+	key, combined, err := rk.open(passphrase)
+	if err != nil {
+		return err
+	}
+	setup := recoverySetup{Key: key, RecoveryKey: *rk}
+	setup.WrappedKey = nil
+	if err := em.saveRecoverySetup(&setup); err != nil {
+		return err
+	}
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	if err := em.vault.Save(VaultKeyName, combined); err != nil {
+		return NewStorageError(ErrEncryption, "failed to store recovered key", err)
+	}
+	em.dataKeys = nil
+	return em.loadKey(combined)
+}
+
+// saveRecoverySetup stores a recovery setup in the vault.
+func (em *EncryptionManager) saveRecoverySetup(setup *recoverySetup) error {
+	data, err := json.Marshal(setup)
+	if err != nil {
+		return NewStorageError(ErrEncryption, "failed to encode recovery setup", err)
+	}
+	if err := em.vault.Save(RecoveryVaultKeyName, data); err != nil {
+		return NewStorageError(ErrEncryption, "failed to store recovery setup", err)
+	}
+	return nil
+}
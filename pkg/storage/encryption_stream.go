@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Encrypted files start with a header holding a random per-file key wrapped
+// by the master key or a session's data key, followed by the content sealed
+// in chunks:
+//
+//	magic (8) | wrapped key length (2) | wrapped key | chunk size (4) | chunks...
+//
+// Each chunk is sealed with AES-GCM under the file key. Its nonce is the
+// chunk counter plus a flag marking the final chunk, so chunks can't be
+// reordered, dropped or truncated without failing authentication. Only the
+// header depends on the master key, which lets key rotation rewrap files in
+// place; files under a data key need no rewrapping at all.
+const (
+	fileMagic          = "WDLENC1\x00"
+	fileChunkSize      = 64 * 1024
+	fileWrappedKeySize = NonceSize + KeySize + 16 // Nonce, key and GCM tag
+	fileHeaderSize     = len(fileMagic) + 2 + fileWrappedKeySize + 4
+)
+
+// IsEncryptedFile reports whether data starts with the encrypted file header.
+func IsEncryptedFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(fileMagic))
+}
+
+// fileNonce returns the nonce of chunk n.
+func fileNonce(n uint64, last bool) []byte {
+	nonce := make([]byte, NonceSize)
+	binary.BigEndian.PutUint64(nonce, n)
+	if last {
+		nonce[NonceSize-1] = 1
+	}
+	return nonce
+}
+
+// newFileAEAD returns the cipher for a file key.
+func newFileAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptWriter seals everything written to it into chunks.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	buf    []byte
+	n      uint64
+	closed bool
+}
+
+// NewEncryptWriter returns a writer that encrypts to w under a new file key.
+// Close must be called to write the final chunk; it does not close w.
+func (em *EncryptionManager) NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	return newEncryptWriter(w, em.Encrypt)
+}
+
+// NewEncryptWriterWithKey is NewEncryptWriter with the file key wrapped by
+// a data key, so the file becomes unreadable when the key is destroyed.
+func (em *EncryptionManager) NewEncryptWriterWithKey(w io.Writer, id int64) (io.WriteCloser, error) {
+	return newEncryptWriter(w, func(key []byte) ([]byte, error) { return em.EncryptWithKey(id, key) })
+}
+
+// newEncryptWriter writes the header of a new file key wrapped by wrap and
+// returns a writer sealing chunks under it.
+func newEncryptWriter(w io.Writer, wrap func([]byte) ([]byte, error)) (io.WriteCloser, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to generate file key", err)
+	}
+	wrapped, err := wrap(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newFileAEAD(key)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create file cipher", err)
+	}
+
+	header := make([]byte, 0, len(fileMagic)+2+len(wrapped)+4)
+	header = append(header, fileMagic...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	header = binary.BigEndian.AppendUint32(header, fileChunkSize)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, os.ErrClosed
+	}
+	ew.buf = append(ew.buf, p...)
+	// Hold back a full chunk so the final one is never empty unless the
+	// whole file is
+	for len(ew.buf) > fileChunkSize {
+		if err := ew.seal(ew.buf[:fileChunkSize], false); err != nil {
+			return 0, err
+		}
+		ew.buf = append(ew.buf[:0], ew.buf[fileChunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.seal(ew.buf, true)
+}
+
+func (ew *encryptWriter) seal(chunk []byte, last bool) error {
+	sealed := ew.aead.Seal(nil, fileNonce(ew.n, last), chunk, nil)
+	ew.n++
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// decryptReader opens chunks as they are read.
+type decryptReader struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	chunkSize int
+	buf       []byte
+	n         uint64
+	done      bool
+}
+
+// readFileHeader reads an encrypted file header, returning the wrapped key
+// and chunk size.
+func readFileHeader(r io.Reader) ([]byte, int, error) {
+	magic := make([]byte, len(fileMagic)+2)
+	if _, err := io.ReadFull(r, magic); err != nil || !IsEncryptedFile(magic) {
+		return nil, 0, NewStorageError(ErrEncryption, "not an encrypted file", err)
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(magic[len(fileMagic):]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, 0, NewStorageError(ErrEncryption, "truncated file header", err)
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, 0, NewStorageError(ErrEncryption, "truncated file header", err)
+	}
+	chunkSize := int(binary.BigEndian.Uint32(size[:]))
+	if chunkSize <= 0 || chunkSize > 16*fileChunkSize {
+		return nil, 0, NewStorageError(ErrEncryption, "invalid file chunk size", nil)
+	}
+	return wrapped, chunkSize, nil
+}
+
+// NewDecryptReader returns a reader of the plaintext of an encrypted file
+// read from r.
+func (em *EncryptionManager) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	wrapped, chunkSize, err := readFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	key, err := em.Decrypt(wrapped)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to unwrap file key", err)
+	}
+	aead, err := newFileAEAD(key)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to create file cipher", err)
+	}
+	return &decryptReader{r: bufio.NewReader(r), aead: aead, chunkSize: chunkSize}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk.
+func (dr *decryptReader) open() error {
+	sealed := make([]byte, dr.chunkSize+dr.aead.Overhead())
+	n, err := io.ReadFull(dr.r, sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return NewStorageError(ErrEncryption, "encrypted file is truncated", nil)
+		}
+		return err
+	}
+	last := n < len(sealed)
+	if !last {
+		_, err := dr.r.Peek(1)
+		last = err == io.EOF
+	}
+
+	plaintext, err := dr.aead.Open(sealed[:0], fileNonce(dr.n, last), sealed[:n], nil)
+	if err != nil {
+		return NewStorageError(ErrEncryption, "encrypted file is corrupt or truncated", err)
+	}
+	dr.n++
+	dr.buf = plaintext
+	dr.done = last
+	return nil
+}
+
+// EncryptFile returns data encrypted in the file format.
+func (em *EncryptionManager) EncryptFile(data []byte) ([]byte, error) {
+	return encryptFile(data, em.NewEncryptWriter)
+}
+
+// EncryptFileWithKey returns data encrypted in the file format under a
+// data key.
+func (em *EncryptionManager) EncryptFileWithKey(id int64, data []byte) ([]byte, error) {
+	return encryptFile(data, func(w io.Writer) (io.WriteCloser, error) { return em.NewEncryptWriterWithKey(w, id) })
+}
+
+// encryptFile encrypts data with a writer from newWriter.
+func encryptFile(data []byte, newWriter func(io.Writer) (io.WriteCloser, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := newWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptFile returns the plaintext of data in the file format.
+func (em *EncryptionManager) DecryptFile(data []byte) ([]byte, error) {
+	r, err := em.NewDecryptReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// rewrapFile re-wraps the key of the encrypted file at path from one
+// master key to another without touching its content. Returns false if the
+// file is already wrapped by to.
+func rewrapFile(path string, from, to *EncryptionManager) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	wrapped, _, err := readFileHeader(f)
+	if err != nil {
+		return false, err
+	}
+	if underDataKey(wrapped, from, to) {
+		return false, nil
+	}
+	key, err := from.Decrypt(wrapped)
+	if err != nil {
+		// Written after the new key took effect, or under a destroyed data key
+		_, toErr := to.Decrypt(wrapped)
+		if _, sealed := DataKeyOf(wrapped); toErr == nil || sealed {
+			return false, nil
+		}
+		return false, err
+	}
+	rewrapped, err := to.Encrypt(key)
+	if err != nil {
+		return false, err
+	}
+	if len(rewrapped) != len(wrapped) {
+		return false, NewStorageError(ErrEncryption, "wrapped file key size changed", nil)
+	}
+	if _, err := f.WriteAt(rewrapped, int64(len(fileMagic)+2)); err != nil {
+		return false, err
+	}
+	return true, f.Sync()
+}
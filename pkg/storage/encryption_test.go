@@ -2,7 +2,11 @@ package storage
 
 import (
 	"bytes"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/prop"
@@ -258,3 +262,418 @@ func GenNonEmptyPlaintext() gopter.Gen {
 		return gopter.NewGenResult(data, gopter.NoShrinker)
 	})
 }
+
+// TestScreenshotEncryption verifies the chunked file format, encryption of
+// saved and existing screenshots, and key rotation.
+func TestScreenshotEncryption(t *testing.T) {
+	t.Run("File format round-trips and detects tampering", func(t *testing.T) {
+		em := NewEncryptionManager(t.TempDir())
+		if err := em.InitializeKey(); err != nil {
+			t.Fatalf("Failed to initialize encryption: %v", err)
+		}
+
+		for _, size := range []int{0, 1, fileChunkSize, fileChunkSize + 1, 3 * fileChunkSize} {
+			data := bytes.Repeat([]byte{byte(size)}, size)
+			encrypted, err := em.EncryptFile(data)
+			if err != nil {
+				t.Fatalf("EncryptFile(%d bytes) failed: %v", size, err)
+			}
+			if !IsEncryptedFile(encrypted) {
+				t.Fatalf("Expected %d byte file to have the encrypted header", size)
+			}
+			decrypted, err := em.DecryptFile(encrypted)
+			if err != nil || !bytes.Equal(decrypted, data) {
+				t.Fatalf("Round-trip of %d bytes failed: %v", size, err)
+			}
+		}
+
+		encrypted, _ := em.EncryptFile(bytes.Repeat([]byte("x"), 2*fileChunkSize+10))
+		sealedChunk := fileChunkSize + 16
+		if _, err := em.DecryptFile(encrypted[:fileHeaderSize+sealedChunk]); err == nil {
+			t.Error("Expected a file truncated at a chunk boundary to fail")
+		}
+		encrypted[len(encrypted)-1] ^= 0xff
+		if _, err := em.DecryptFile(encrypted); err == nil {
+			t.Error("Expected a tampered file to fail")
+		}
+	})
+
+	dataDir := filepath.Join(t.TempDir(), "storage")
+	legacyPath := filepath.Join(dataDir, "files", "2025-03-01", "Editor", "screenshots", "0900.png")
+	if err := os.MkdirAll(filepath.Dir(legacyPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacyPath, []byte("legacy screenshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	os.Chtimes(legacyPath, modTime, modTime)
+
+	se := NewStorageEngine(DefaultStorageConfig(dataDir))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer func() { se.Close() }()
+
+	// raw reads what is on disk for a path relative to the files directory
+	raw := func(rel string) []byte {
+		t.Helper()
+		file, err := se.fileMgr.diskPath(filepath.ToSlash(rel))
+		if err != nil {
+			t.Fatalf("Failed to find %s: %v", rel, err)
+		}
+		data, _ := os.ReadFile(file)
+		return data
+	}
+
+	t.Run("Existing files are encrypted once", func(t *testing.T) {
+		if !IsEncryptedFile(raw("2025-03-01/Editor/screenshots/0900.png")) {
+			t.Fatal("Expected the existing screenshot to be encrypted on start")
+		}
+		if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+			t.Errorf("Expected the plaintext screenshot to be removed, got %v", err)
+		}
+		if info, _ := se.StatScreenshot(legacyPath); info == nil || !info.ModTime.Equal(modTime) {
+			t.Errorf("Expected modification time %v to be kept, got %+v", modTime, info)
+		}
+		data, err := se.ReadFile(filepath.Join("2025-03-01", "Editor", "screenshots", "0900.png"))
+		if err != nil || string(data) != "legacy screenshot" {
+			t.Errorf("Expected the migrated screenshot to decrypt, got %q, %v", data, err)
+		}
+		if n, _ := se.fileMgr.MigrateEncryption(); n != 0 {
+			t.Errorf("Expected the migration to run once, encrypted %d files again", n)
+		}
+	})
+
+	session, err := se.CreateSession("2025-03-01")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := se.AddChat(session.Date, &ChatMessage{Role: ChatRoleUser, Content: "what was on screen", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	if _, err := se.SaveScreenshot(session.Date, "Editor", "0930.png", []byte("new screenshot")); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+	screenshotPath := se.GetScreenshotPath(session.Date, "Editor", "0930.png")
+	screenshotRel := filepath.Join(session.Date, "Editor", "screenshots", "0930.png")
+
+	t.Run("Saved screenshots are encrypted and open decrypted", func(t *testing.T) {
+		data := raw(screenshotRel)
+		if !IsEncryptedFile(data) || bytes.Contains(data, []byte("new screenshot")) {
+			t.Fatal("Expected the saved screenshot to be encrypted on disk")
+		}
+		r, err := se.OpenScreenshot(screenshotPath)
+		if err != nil {
+			t.Fatalf("OpenScreenshot failed: %v", err)
+		}
+		data, _ = io.ReadAll(r)
+		r.Close()
+		if string(data) != "new screenshot" {
+			t.Errorf("Expected decrypted screenshot, got %q", data)
+		}
+		if _, err := se.OpenScreenshot(filepath.Join(dataDir, "vault")); !IsValidation(err) {
+			t.Errorf("Expected paths outside the files directory to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Key rotation rewraps keys and survives a restart", func(t *testing.T) {
+		legacyRel := filepath.Join("2025-03-01", "Editor", "screenshots", "0900.png")
+		before, legacyBefore := raw(screenshotRel), raw(legacyRel)
+		if err := se.RotateKey("a new passphrase"); err != nil {
+			t.Fatalf("RotateKey failed: %v", err)
+		}
+		if !bytes.Equal(before, raw(screenshotRel)) {
+			t.Error("Expected a file under a session's data key to be left alone")
+		}
+		legacyAfter := raw(legacyRel)
+		if bytes.Equal(legacyBefore, legacyAfter) || !bytes.Equal(legacyBefore[fileHeaderSize:], legacyAfter[fileHeaderSize:]) {
+			t.Error("Expected only the header of a file under the master key to change")
+		}
+
+		se.Close()
+		se = NewStorageEngine(DefaultStorageConfig(dataDir))
+		if err := se.Initialize(); err != nil {
+			t.Fatalf("Failed to reopen storage engine: %v", err)
+		}
+		data, err := se.ReadFile(screenshotRel)
+		if err != nil || string(data) != "new screenshot" {
+			t.Errorf("Expected the screenshot to decrypt after rotation, got %q, %v", data, err)
+		}
+		data, err = se.ReadFile(legacyRel)
+		if err != nil || string(data) != "legacy screenshot" {
+			t.Errorf("Expected the file resealed with its session's key on start to decrypt, got %q, %v", data, err)
+		}
+		if bytes.Equal(legacyAfter, raw(legacyRel)) {
+			t.Error("Expected the file under the master key to be resealed with its session's key on start")
+		}
+		chats, err := se.GetChats(session.Date)
+		if err != nil || len(chats) != 1 || chats[0].Content != "what was on screen" {
+			t.Errorf("Expected the chat to decrypt after rotation, got %+v, %v", chats, err)
+		}
+	})
+}
+
+// TestCryptoShredding tests that session data is sealed with per-session
+// data keys, that deleting a session destroys its key in the database and
+// the backup key file, and that rotating the master key only rewraps keys.
+func TestCryptoShredding(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "storage")
+	se := NewStorageEngine(DefaultStorageConfig(dataDir))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer func() { se.Close() }()
+
+	for _, date := range []string{"2025-03-01", "2025-03-02"} {
+		if _, err := se.CreateSession(date); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if err := se.AddChat(date, &ChatMessage{Role: ChatRoleUser, Content: "chat on " + date, Timestamp: time.Now()}); err != nil {
+			t.Fatalf("Failed to add chat: %v", err)
+		}
+		if err := se.AddNote(date, &ManualNote{Content: "plan for " + date}); err != nil {
+			t.Fatalf("Failed to add note: %v", err)
+		}
+		if _, err := se.SaveScreenshot(date, "Editor", "0900.png", []byte("screen on "+date)); err != nil {
+			t.Fatalf("Failed to save screenshot: %v", err)
+		}
+	}
+	session, _ := se.GetSession("2025-03-01")
+	session.CustomSummary = "Zanzibar offsite"
+	if err := se.UpdateSession(session); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	keyID, err := se.sessionMgr.GetSessionDataKeyID(int64(session.ID))
+	if err != nil || keyID == 0 {
+		t.Fatalf("Expected the session to have a data key, got %d (%v)", keyID, err)
+	}
+
+	var chat []byte
+	if err := se.DB().QueryRow("SELECT content_encrypted FROM chats WHERE session_id = ?", session.ID).Scan(&chat); err != nil {
+		t.Fatalf("Failed to read chat: %v", err)
+	}
+	screenshot, err := se.fileMgr.diskPath("2025-03-01/Editor/screenshots/0900.png")
+	if err != nil {
+		t.Fatalf("Failed to find screenshot: %v", err)
+	}
+	file, _ := os.ReadFile(screenshot)
+
+	t.Run("Session data is sealed with the session's key", func(t *testing.T) {
+		if id, sealed := DataKeyOf(chat); !sealed || id != keyID {
+			t.Errorf("Expected the chat sealed with key %d, got %d, %v", keyID, id, sealed)
+		}
+		var blobKey int64
+		se.DB().QueryRow("SELECT key_id FROM blobs b JOIN file_refs r ON r.blob_hash = b.hash WHERE r.path = ?",
+			"2025-03-01/Editor/screenshots/0900.png").Scan(&blobKey)
+		if blobKey != keyID {
+			t.Errorf("Expected the screenshot sealed with key %d, got %d", keyID, blobKey)
+		}
+		if _, err := se.encryptionMgr.DecryptFile(file); err != nil {
+			t.Errorf("Expected the screenshot to decrypt, got %v", err)
+		}
+	})
+
+	t.Run("Master-sealed data is resealed", func(t *testing.T) {
+		legacy, _ := se.encryptionMgr.Encrypt([]byte("legacy chat"))
+		se.DB().Exec("UPDATE chats SET content_encrypted = ? WHERE session_id = ?", legacy, session.ID)
+		tx, _ := se.DB().Begin()
+		n, err := se.sessionMgr.resealSessionData(tx)
+		tx.Commit()
+		if err != nil || n != 1 {
+			t.Errorf("Expected 1 value resealed, got %d (%v)", n, err)
+		}
+		chats, _ := se.GetChats("2025-03-01")
+		if len(chats) != 1 || chats[0].Content != "legacy chat" {
+			t.Errorf("Expected the resealed chat to decrypt, got %+v", chats)
+		}
+	})
+
+	t.Run("Rotation rewraps keys only", func(t *testing.T) {
+		var before, after []byte
+		se.DB().QueryRow("SELECT wrapped_key FROM data_keys WHERE id = ?", keyID).Scan(&before)
+		if err := se.RotateKey("a new passphrase"); err != nil {
+			t.Fatalf("RotateKey failed: %v", err)
+		}
+		se.DB().QueryRow("SELECT wrapped_key FROM data_keys WHERE id = ?", keyID).Scan(&after)
+		if bytes.Equal(before, after) {
+			t.Error("Expected the data key to be rewrapped")
+		}
+		if now, _ := os.ReadFile(screenshot); !bytes.Equal(file, now) {
+			t.Error("Expected the screenshot to be left alone")
+		}
+
+		se.Close()
+		se = NewStorageEngine(DefaultStorageConfig(dataDir))
+		if err := se.Initialize(); err != nil {
+			t.Fatalf("Failed to reopen storage engine: %v", err)
+		}
+		if data, err := se.ReadFile("2025-03-01/Editor/screenshots/0900.png"); err != nil || string(data) != "screen on 2025-03-01" {
+			t.Errorf("Expected the screenshot to decrypt after rotation, got %q, %v", data, err)
+		}
+	})
+
+	backupMgr := NewBackupManager(se.config, se)
+	backupPath, err := backupMgr.CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	t.Run("Deleting a session destroys its key", func(t *testing.T) {
+		keys, _ := backupMgr.readBackupKeys()
+		if keys[keyID] == nil {
+			t.Fatal("Expected the key in the backup key file")
+		}
+		if err := se.DeleteSession("2025-03-01"); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		keys, _ = backupMgr.readBackupKeys()
+		if keys[keyID] != nil || se.encryptionMgr.HasDataKey(keyID) {
+			t.Error("Expected the key to be destroyed")
+		}
+		if _, err := se.encryptionMgr.Decrypt(chat); err == nil {
+			t.Error("Expected the old chat ciphertext to be unreadable")
+		}
+		if _, err := se.encryptionMgr.DecryptFile(file); err == nil {
+			t.Error("Expected the old screenshot to be unreadable")
+		}
+		var indexed int
+		se.DB().QueryRow("SELECT COUNT(*) FROM sessions_fts_data WHERE instr(block, CAST('zanzibar' AS BLOB)) > 0").Scan(&indexed)
+		if indexed != 0 {
+			t.Error("Expected the session's summary erased from the full-text index")
+		}
+	})
+
+	t.Run("Restoring a backup keeps deleted sessions deleted", func(t *testing.T) {
+		if err := backupMgr.Restore(backupPath, RestoreOptions{}); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if _, err := se.GetSession("2025-03-01"); !IsNotFound(err) {
+			t.Errorf("Expected the deleted session to stay deleted, got %v", err)
+		}
+		chats, err := se.GetChats("2025-03-02")
+		if err != nil || len(chats) != 1 || chats[0].Content != "chat on 2025-03-02" {
+			t.Errorf("Expected the other session to be readable, got %+v (%v)", chats, err)
+		}
+		var indexed int
+		se.DB().QueryRow("SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH 'plan'").Scan(&indexed)
+		if indexed != 1 {
+			t.Errorf("Expected the remaining note to be indexed again, got %d", indexed)
+		}
+
+		os.Remove(filepath.Join(dataDir, "backups", backupKeysName))
+		if err := backupMgr.Restore(backupPath, RestoreOptions{}); !IsNotFound(err) {
+			t.Errorf("Expected a restore without the key file to fail, got %v", err)
+		}
+	})
+}
+
+// TestRecoveryKey tests that a recovery key follows the master key through
+// rotation and restores backups on a machine whose vault never held it.
+func TestRecoveryKey(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "storage")
+	se := NewStorageEngine(DefaultStorageConfig(dataDir))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer se.Close()
+
+	if _, err := se.GetRecoveryKey(); !IsNotFound(err) {
+		t.Errorf("Expected no recovery key before setup, got %v", err)
+	}
+	if _, err := se.SetupRecovery("short"); !IsValidation(err) {
+		t.Errorf("Expected a short passphrase to be rejected, got %v", err)
+	}
+	const passphrase = "correct horse battery staple"
+	if _, err := se.SetupRecovery(passphrase); err != nil {
+		t.Fatalf("SetupRecovery failed: %v", err)
+	}
+	recoveryPath := filepath.Join(dataDir, "backups", recoveryKeyName)
+
+	if _, err := se.CreateSession("2025-03-01"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := se.AddChat("2025-03-01", &ChatMessage{Role: ChatRoleUser, Content: "before the move", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	if _, err := se.SaveScreenshot("2025-03-01", "Editor", "0900.png", []byte("screen")); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+
+	t.Run("Rotation rewraps the recovery key", func(t *testing.T) {
+		before, _ := ReadRecoveryKey(recoveryPath)
+		if err := se.RotateKey("a new passphrase"); err != nil {
+			t.Fatalf("RotateKey failed: %v", err)
+		}
+		after, err := ReadRecoveryKey(recoveryPath)
+		if err != nil || bytes.Equal(before.WrappedKey, after.WrappedKey) {
+			t.Fatalf("Expected the recovery key to be rewrapped, got %v", err)
+		}
+		_, combined, err := after.open(passphrase)
+		stored, _ := se.encryptionMgr.vault.Load(VaultKeyName)
+		if err != nil || !bytes.Equal(combined, stored) {
+			t.Errorf("Expected the recovery key to wrap the new master key, got %v", err)
+		}
+		if _, _, err := after.open("the wrong passphrase"); !IsValidation(err) {
+			t.Errorf("Expected a wrong passphrase to be rejected, got %v", err)
+		}
+	})
+
+	backupPath, err := NewBackupManager(se.config, se).CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	// Another machine has its own master key and a copy of the backups
+	otherDir := filepath.Join(t.TempDir(), "storage")
+	other := NewStorageEngine(DefaultStorageConfig(otherDir))
+	if err := other.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize other storage engine: %v", err)
+	}
+	defer func() { other.Close() }()
+	backupMgr := NewBackupManager(other.config, other)
+	if err := backupMgr.copyDirectory(filepath.Join(dataDir, "backups"), filepath.Join(otherDir, "backups")); err != nil {
+		t.Fatalf("Failed to copy backups: %v", err)
+	}
+	copied := filepath.Join(otherDir, "backups", filepath.Base(backupPath))
+
+	t.Run("Backups from another machine need the recovery key", func(t *testing.T) {
+		if err := other.Restore(copied, RestoreOptions{}); !IsValidation(err) {
+			t.Errorf("Expected the restore to be refused, got %v", err)
+		}
+		rk, _ := ReadRecoveryKey(filepath.Join(otherDir, "backups", recoveryKeyName))
+		if err := other.Restore(copied, RestoreOptions{RecoveryKey: rk, Passphrase: "the wrong passphrase"}); !IsValidation(err) {
+			t.Errorf("Expected a wrong passphrase to be refused, got %v", err)
+		}
+		if _, err := other.CreateSession("2025-04-01"); err != nil {
+			t.Errorf("Expected a refused restore to leave the store usable, got %v", err)
+		}
+	})
+
+	t.Run("The recovery key restores backups elsewhere", func(t *testing.T) {
+		rk, err := ReadRecoveryKey(filepath.Join(otherDir, "backups", recoveryKeyName))
+		if err != nil {
+			t.Fatalf("Failed to read recovery key: %v", err)
+		}
+		if err := other.Restore(copied, RestoreOptions{RecoveryKey: rk, Passphrase: passphrase}); err != nil {
+			t.Fatalf("Restore with recovery key failed: %v", err)
+		}
+
+		// The recovered key is kept, so the store opens after a restart
+		other.Close()
+		other = NewStorageEngine(DefaultStorageConfig(otherDir))
+		if err := other.Initialize(); err != nil {
+			t.Fatalf("Failed to reopen other storage engine: %v", err)
+		}
+		chats, err := other.GetChats("2025-03-01")
+		if err != nil || len(chats) != 1 || chats[0].Content != "before the move" {
+			t.Errorf("Expected the chat to decrypt, got %+v (%v)", chats, err)
+		}
+		if data, err := other.ReadFile("2025-03-01/Editor/screenshots/0900.png"); err != nil || string(data) != "screen" {
+			t.Errorf("Expected the screenshot to decrypt, got %q, %v", data, err)
+		}
+		if _, err := other.GetRecoveryKey(); err != nil {
+			t.Errorf("Expected recovery to stay set up, got %v", err)
+		}
+	})
+}
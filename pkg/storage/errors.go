@@ -130,6 +130,15 @@ func IsConflict(err error) bool {
 	return false
 }
 
+// IsValidation checks if the error is a validation error.
+func IsValidation(err error) bool {
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.Code == ErrValidation
+	}
+	return false
+}
+
 // IsRetryable checks if the error is retryable.
 func IsRetryable(err error) bool {
 	var storageErr *StorageError
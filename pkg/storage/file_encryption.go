@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// encryptedMarker is written to the files directory once every file in it
+// has been encrypted. Restoring an older backup replaces the directory and
+// the marker with it, so its files are encrypted again on the next start.
+const encryptedMarker = ".encrypted"
+
+// SetEncryption makes the file manager encrypt the files it writes with
+// the store's key. Files are decrypted on read either way.
+func (fm *FileManager) SetEncryption(em *EncryptionManager) {
+	fm.encryption = em
+}
+
+// writeFile writes data to path atomically, encrypting it when a key is set.
+func (fm *FileManager) writeFile(path string, data []byte) error {
+	return fm.writeFileWithKey(path, data, 0)
+}
+
+// writeFileWithKey is writeFile sealing data under a data key, or the
+// master key if keyID is 0.
+func (fm *FileManager) writeFileWithKey(path string, data []byte, keyID int64) error {
+	if fm.encryption != nil {
+		encrypt := fm.encryption.EncryptFile
+		if keyID != 0 {
+			encrypt = func(data []byte) ([]byte, error) { return fm.encryption.EncryptFileWithKey(keyID, data) }
+		}
+		encrypted, err := encrypt(data)
+		if err != nil {
+			return err
+		}
+		data = encrypted
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// decryptFile returns the plaintext of a file's contents. Files written
+// before encryption are returned as they are.
+func (fm *FileManager) decryptFile(data []byte) ([]byte, error) {
+	if !IsEncryptedFile(data) {
+		return data, nil
+	}
+	if fm.encryption == nil {
+		return nil, NewStorageError(ErrEncryption, "file is encrypted but no key is available", nil)
+	}
+	plaintext, err := fm.encryption.DecryptFile(data)
+	if err != nil {
+		return nil, NewStorageError(ErrEncryption, "failed to decrypt file", err)
+	}
+	return plaintext, nil
+}
+
+// readFile reads and decrypts the file at path.
+func (fm *FileManager) readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return fm.decryptFile(data)
+}
+
+// decryptingFile closes the file a decrypting reader reads from.
+type decryptingFile struct {
+	io.Reader
+	f *os.File
+}
+
+func (df *decryptingFile) Close() error {
+	return df.f.Close()
+}
+
+// OpenFile opens a stored file by a full path from GetFilePath or
+// ListSessionFiles, decrypting it as it is read.
+func (fm *FileManager) OpenFile(path string) (io.ReadCloser, error) {
+	rel, err := fm.relPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return fm.open(fm.resolveScreenshot(rel))
+}
+
+// openPath opens a file on disk, decrypting it as it is read.
+func (fm *FileManager) openPath(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NewStorageError(ErrNotFound, "file not found", err)
+		}
+		return nil, NewStorageError(ErrFileSystem, "failed to open file", err)
+	}
+	magic := make([]byte, len(fileMagic))
+	n, _ := io.ReadFull(f, magic)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, NewStorageError(ErrFileSystem, "failed to read file", err)
+	}
+	if !IsEncryptedFile(magic[:n]) {
+		return f, nil
+	}
+	if fm.encryption == nil {
+		f.Close()
+		return nil, NewStorageError(ErrEncryption, "file is encrypted but no key is available", nil)
+	}
+	r, err := fm.encryption.NewDecryptReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decryptingFile{Reader: r, f: f}, nil
+}
+
+// isFileMetadata reports whether a path under the files directory is
+// bookkeeping rather than a stored file.
+func isFileMetadata(path string) bool {
+	return filepath.Base(path) == encryptedMarker || strings.HasSuffix(path, ".tmp")
+}
+
+// MigrateEncryption encrypts the files written before encryption was
+// enabled, once. Later calls return immediately.
+func (fm *FileManager) MigrateEncryption() (int, error) {
+	if fm.encryption == nil {
+		return 0, nil
+	}
+	marker := filepath.Join(fm.baseDir, encryptedMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return 0, nil
+	}
+
+	count, err := fm.EncryptFiles()
+	if err != nil {
+		return count, err
+	}
+	if err := os.MkdirAll(fm.baseDir, 0755); err != nil {
+		return count, NewStorageError(ErrFileSystem, "failed to create files directory", err)
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return count, NewStorageError(ErrFileSystem, "failed to write encryption marker", err)
+	}
+	return count, nil
+}
+
+// EncryptFiles encrypts every plaintext file in the files directory,
+// keeping modification times so retention and tiering still see their age.
+// Returns the number of files encrypted.
+func (fm *FileManager) EncryptFiles() (int, error) {
+	if fm.encryption == nil {
+		return 0, NewStorageError(ErrEncryption, "no encryption key is set", nil)
+	}
+
+	count := 0
+	err := filepath.Walk(fm.baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isFileMetadata(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if IsEncryptedFile(data) {
+			return nil
+		}
+		if err := fm.writeFile(path, data); err != nil {
+			return err
+		}
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, NewStorageError(ErrFileSystem, "failed to encrypt files", err)
+	}
+	return count, nil
+}
+
+// RewrapFileKeys re-wraps the key of every encrypted file from one master
+// key to another, leaving file contents untouched. If a file fails, the
+// files already rewrapped are put back under the old key.
+func (fm *FileManager) RewrapFileKeys(from, to *EncryptionManager) (int, error) {
+	var rewrapped []string
+	err := filepath.Walk(fm.baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isFileMetadata(path) {
+			return nil
+		}
+		magic := make([]byte, len(fileMagic))
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		n, _ := io.ReadFull(f, magic)
+		f.Close()
+		if !IsEncryptedFile(magic[:n]) {
+			return nil
+		}
+
+		changed, err := rewrapFile(path, from, to)
+		if err != nil {
+			return err
+		}
+		if changed {
+			os.Chtimes(path, info.ModTime(), info.ModTime())
+			rewrapped = append(rewrapped, path)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, path := range rewrapped {
+			rewrapFile(path, to, from)
+		}
+		return 0, NewStorageError(ErrEncryption, "failed to rewrap file keys", err)
+	}
+	return len(rewrapped), nil
+}
@@ -1,24 +1,33 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
-	"io"
+	"image"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 // FileManager handles filesystem operations for binary assets (screenshots).
 type FileManager struct {
-	baseDir string // ~/.waddle/files/
+	baseDir    string // ~/.waddle/files/
+	tiers      []ScreenshotTier
+	encryption *EncryptionManager // Files are stored as plaintext when nil
+	index      *SessionManager    // Files are stored in directories when nil
+	blobMu     sync.Mutex         // Orders blob writes against garbage collection
 }
 
 // NewFileManager creates a new FileManager instance.
 func NewFileManager(dataDir string) *FileManager {
-	return &FileManager{
+	fm := &FileManager{
 		baseDir: filepath.Join(dataDir, "files"),
 	}
+	fm.SetScreenshotTiers(DefaultScreenshotTiers())
+	return fm
 }
 
 // Initialize creates the base directory if it doesn't exist.
@@ -29,7 +38,8 @@ func (fm *FileManager) Initialize() error {
 	return nil
 }
 
-// SaveFile saves a file and returns the path where it was stored.
+// SaveFile saves a file and returns the path where it was stored. Images
+// also get a thumbnail in {baseDir}/{sessionID}/{appName}/thumbnails/.
 // Path format: {baseDir}/{sessionID}/{appName}/screenshots/{filename}
 func (fm *FileManager) SaveFile(sessionID, appName, filename string, data []byte) (string, error) {
 	if sessionID == "" {
@@ -47,22 +57,20 @@ func (fm *FileManager) SaveFile(sessionID, appName, filename string, data []byte
 	safeAppName := sanitizePathComponent(appName)
 	safeFilename := sanitizePathComponent(filename)
 
-	// Build path
-	dir := filepath.Join(fm.baseDir, safeSessionID, safeAppName, "screenshots")
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", NewStorageError(ErrFileSystem, "failed to create directory", err)
+	rel := path.Join(safeSessionID, safeAppName, "screenshots", safeFilename)
+	if err := fm.put(FileRef{Path: rel}, data); err != nil {
+		return "", err
 	}
 
-	fullPath := filepath.Join(dir, safeFilename)
-
-	// Write file
-	if err := os.WriteFile(fullPath, data, 0644); err != nil {
-		return "", NewStorageError(ErrFileSystem, "failed to write file", err)
+	// A missing thumbnail is not worth failing the save over
+	if isImageFile(rel) {
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			fm.writeThumbnail(rel, img, time.Time{})
+		}
 	}
 
 	// Return relative path from baseDir
-	relPath, _ := filepath.Rel(fm.baseDir, fullPath)
-	return relPath, nil
+	return filepath.FromSlash(rel), nil
 }
 
 // SaveLatestScreenshot saves the latest screenshot for an app.
@@ -78,28 +86,22 @@ func (fm *FileManager) SaveLatestScreenshot(sessionID, appName string, data []by
 	safeSessionID := sanitizePathComponent(sessionID)
 	safeAppName := sanitizePathComponent(appName)
 
-	dir := filepath.Join(fm.baseDir, safeSessionID, safeAppName)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", NewStorageError(ErrFileSystem, "failed to create directory", err)
-	}
-
-	fullPath := filepath.Join(dir, "latest.png")
-
-	if err := os.WriteFile(fullPath, data, 0644); err != nil {
-		return "", NewStorageError(ErrFileSystem, "failed to write file", err)
+	rel := path.Join(safeSessionID, safeAppName, "latest.png")
+	if err := fm.put(FileRef{Path: rel}, data); err != nil {
+		return "", err
 	}
-
-	relPath, _ := filepath.Rel(fm.baseDir, fullPath)
-	return relPath, nil
+	return filepath.FromSlash(rel), nil
 }
 
-// GetFilePath returns the full filesystem path for a file.
+// GetFilePath returns the full path for a file, resolving screenshots that
+// have since moved to another storage tier. With the blob store the path
+// names the file rather than a location on disk; open it with OpenFile.
 func (fm *FileManager) GetFilePath(sessionID, appName, filename string) string {
 	safeSessionID := sanitizePathComponent(sessionID)
 	safeAppName := sanitizePathComponent(appName)
 	safeFilename := sanitizePathComponent(filename)
 
-	return filepath.Join(fm.baseDir, safeSessionID, safeAppName, "screenshots", safeFilename)
+	return fm.fullPath(fm.resolveScreenshot(path.Join(safeSessionID, safeAppName, "screenshots", safeFilename)))
 }
 
 // GetLatestScreenshotPath returns the path to the latest screenshot for an app.
@@ -111,23 +113,14 @@ func (fm *FileManager) GetLatestScreenshotPath(sessionID, appName string) string
 }
 
 // FileExists checks if a file exists at the given path.
-func (fm *FileManager) FileExists(path string) bool {
-	fullPath := filepath.Join(fm.baseDir, path)
-	_, err := os.Stat(fullPath)
+func (fm *FileManager) FileExists(relPath string) bool {
+	_, err := fm.stat(fm.resolveScreenshot(filepath.ToSlash(relPath)))
 	return err == nil
 }
 
-// ReadFile reads a file from the storage.
-func (fm *FileManager) ReadFile(path string) ([]byte, error) {
-	fullPath := filepath.Join(fm.baseDir, path)
-	data, err := os.ReadFile(fullPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, NewStorageError(ErrNotFound, "file not found", err)
-		}
-		return nil, NewStorageError(ErrFileSystem, "failed to read file", err)
-	}
-	return data, nil
+// ReadFile reads and decrypts a file from the storage.
+func (fm *FileManager) ReadFile(relPath string) ([]byte, error) {
+	return fm.get(fm.resolveScreenshot(filepath.ToSlash(relPath)))
 }
 
 // DeleteSessionFiles deletes all files for a session.
@@ -136,117 +129,98 @@ func (fm *FileManager) DeleteSessionFiles(sessionID string) error {
 		return NewStorageError(ErrValidation, "session ID is required", nil)
 	}
 
-	safeSessionID := sanitizePathComponent(sessionID)
-	sessionDir := filepath.Join(fm.baseDir, safeSessionID)
-
-	// Check if directory exists
-	if _, err := os.Stat(sessionDir); os.IsNotExist(err) {
-		return nil // Nothing to delete
-	}
-
-	if err := os.RemoveAll(sessionDir); err != nil {
-		return NewStorageError(ErrFileSystem, "failed to delete session files", err)
-	}
-
-	return nil
+	_, err := fm.remove(sanitizePathComponent(sessionID))
+	return err
 }
 
 // CleanOrphanedFiles removes files that don't have corresponding session IDs.
-// Returns the number of files deleted.
+// Returns the number of sessions whose files were deleted.
 func (fm *FileManager) CleanOrphanedFiles(validSessionIDs []string) (int, error) {
 	validSet := make(map[string]bool)
 	for _, id := range validSessionIDs {
 		validSet[sanitizePathComponent(id)] = true
 	}
 
-	entries, err := os.ReadDir(fm.baseDir)
+	orphaned := make(map[string]bool)
+	refs, err := fm.list("")
 	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, nil
+		return 0, err
+	}
+	for _, ref := range refs {
+		if session := sessionOf(ref.Path); !validSet[session] {
+			orphaned[session] = true
 		}
-		return 0, NewStorageError(ErrFileSystem, "failed to read files directory", err)
 	}
 
-	deletedCount := 0
+	// Directories left outside the store, and empty ones
+	entries, err := os.ReadDir(fm.baseDir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, NewStorageError(ErrFileSystem, "failed to read files directory", err)
+	}
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+		if entry.IsDir() && entry.Name() != blobDir && !validSet[entry.Name()] {
+			orphaned[entry.Name()] = true
 		}
+	}
 
-		sessionID := entry.Name()
-		if !validSet[sessionID] {
-			sessionDir := filepath.Join(fm.baseDir, sessionID)
-			if err := os.RemoveAll(sessionDir); err != nil {
-				// Log but continue
-				continue
-			}
-			deletedCount++
+	deletedCount := 0
+	for session := range orphaned {
+		if _, err := fm.remove(session); err != nil {
+			// Log but continue
+			continue
 		}
+		os.RemoveAll(fm.fullPath(session))
+		deletedCount++
 	}
 
 	return deletedCount, nil
 }
 
-// CompressOldScreenshots compresses screenshots older than the specified duration.
-// Note: This is a placeholder - actual compression would require image processing.
+// CompressOldScreenshots moves screenshots older than the specified
+// duration into the storage tier for their age.
 func (fm *FileManager) CompressOldScreenshots(olderThan time.Duration) error {
-	cutoff := time.Now().Add(-olderThan)
-
-	return filepath.Walk(fm.baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip errors
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		// Only process PNG files
-		if !strings.HasSuffix(strings.ToLower(path), ".png") {
-			return nil
-		}
-
-		// Skip if not old enough
-		if info.ModTime().After(cutoff) {
-			return nil
-		}
-
-		// TODO: Implement actual compression (e.g., convert to JPEG with lower quality)
-		// For now, this is a no-op placeholder
-
-		return nil
-	})
+	_, err := fm.TierScreenshots(olderThan)
+	return err
 }
 
-// GetStorageStats returns statistics about file storage.
+// GetStorageStats returns statistics about file storage. Bytes count each
+// blob once, however many files share it.
 func (fm *FileManager) GetStorageStats() (*StorageStats, error) {
-	stats := &StorageStats{}
+	stats := &StorageStats{
+		TierBytes: make(map[string]int64),
+		TierFiles: make(map[string]int64),
+	}
 
-	err := filepath.Walk(fm.baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip errors
-		}
+	refs, err := fm.list("")
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to get storage stats", err)
+	}
 
-		if info.IsDir() {
-			return nil
+	counted := make(map[string]bool)
+	for _, ref := range refs {
+		size := ref.Size
+		if ref.Hash != "" {
+			if counted[ref.Hash] {
+				size = 0
+			}
+			counted[ref.Hash] = true
 		}
 
 		stats.TotalFiles++
-		stats.TotalSizeBytes += info.Size()
+		stats.TotalSizeBytes += size
 
-		if strings.HasSuffix(strings.ToLower(path), ".png") {
-			stats.ScreenshotCount++
+		if isImageFile(ref.Path) {
+			tier := fm.ScreenshotTierOf(ref.Path)
+			if tier != ScreenshotTierThumbnail {
+				stats.ScreenshotCount++
+			}
+			stats.TierBytes[tier] += size
+			stats.TierFiles[tier]++
 		}
 
-		if stats.OldestFile.IsZero() || info.ModTime().Before(stats.OldestFile) {
-			stats.OldestFile = info.ModTime()
+		if stats.OldestFile.IsZero() || ref.ModTime.Before(stats.OldestFile) {
+			stats.OldestFile = ref.ModTime
 		}
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, NewStorageError(ErrFileSystem, "failed to get storage stats", err)
 	}
 
 	return stats, nil
@@ -254,61 +228,27 @@ func (fm *FileManager) GetStorageStats() (*StorageStats, error) {
 
 // ListSessionFiles lists all files for a session.
 func (fm *FileManager) ListSessionFiles(sessionID string) ([]string, error) {
-	safeSessionID := sanitizePathComponent(sessionID)
-	sessionDir := filepath.Join(fm.baseDir, safeSessionID)
-
-	var files []string
-
-	err := filepath.Walk(sessionDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
-			}
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		relPath, _ := filepath.Rel(fm.baseDir, path)
-		files = append(files, relPath)
-		return nil
-	})
-
+	refs, err := fm.list(sanitizePathComponent(sessionID))
 	if err != nil {
 		return nil, NewStorageError(ErrFileSystem, "failed to list session files", err)
 	}
 
+	var files []string
+	for _, ref := range refs {
+		files = append(files, filepath.FromSlash(ref.Path))
+	}
 	return files, nil
 }
 
 // CopyFile copies a file from src to dst.
 func (fm *FileManager) CopyFile(src, dst string) error {
-	srcPath := filepath.Join(fm.baseDir, src)
-	dstPath := filepath.Join(fm.baseDir, dst)
-
-	// Ensure destination directory exists
-	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return NewStorageError(ErrFileSystem, "failed to create destination directory", err)
-	}
-
-	srcFile, err := os.Open(srcPath)
+	data, err := fm.get(filepath.ToSlash(src))
 	if err != nil {
 		return NewStorageError(ErrFileSystem, "failed to open source file", err)
 	}
-	defer srcFile.Close()
-
-	dstFile, err := os.Create(dstPath)
-	if err != nil {
-		return NewStorageError(ErrFileSystem, "failed to create destination file", err)
-	}
-	defer dstFile.Close()
-
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
+	if err := fm.put(FileRef{Path: filepath.ToSlash(dst)}, data); err != nil {
 		return NewStorageError(ErrFileSystem, "failed to copy file", err)
 	}
-
 	return nil
 }
 
@@ -1,9 +1,15 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/prop"
@@ -294,3 +300,158 @@ func TestCopyFile(t *testing.T) {
 		t.Error("Copied file content doesn't match source")
 	}
 }
+
+// TestBlobStore tests that identical screenshots of a session share a blob,
+// that blobs are reference counted, and that garbage collection respects the grace
+// period and concurrent saves.
+func TestBlobStore(t *testing.T) {
+	storageEngine := NewStorageEngine(DefaultStorageConfig(t.TempDir()))
+	if err := storageEngine.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer storageEngine.Close()
+	fm := storageEngine.fileMgr
+
+	for _, date := range []string{"2025-03-01", "2025-03-02"} {
+		if _, err := storageEngine.CreateSession(date); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	shot := []byte("the same screen")
+	for _, saved := range [][2]string{{"2025-03-01", "Code"}, {"2025-03-01", "Slack"}, {"2025-03-02", "Code"}} {
+		if _, err := storageEngine.SaveScreenshot(saved[0], saved[1], "0900.png", shot); err != nil {
+			t.Fatalf("Failed to save screenshot: %v", err)
+		}
+	}
+
+	ref, err := storageEngine.StatScreenshot(storageEngine.GetScreenshotPath("2025-03-01", "Code", "0900.png"))
+	if err != nil {
+		t.Fatalf("Failed to stat screenshot: %v", err)
+	}
+	refCount := func() int {
+		t.Helper()
+		var n int
+		if err := storageEngine.DB().QueryRow("SELECT ref_count FROM blobs WHERE hash = ?", ref.Hash).Scan(&n); err != nil {
+			t.Fatalf("Failed to read reference count: %v", err)
+		}
+		return n
+	}
+
+	t.Run("Identical files of a session share a blob", func(t *testing.T) {
+		if n := refCount(); n != 2 {
+			t.Errorf("Expected 2 references, got %d", n)
+		}
+		other, err := storageEngine.StatScreenshot(storageEngine.GetScreenshotPath("2025-03-02", "Code", "0900.png"))
+		if err != nil || other.Hash == ref.Hash {
+			t.Errorf("Expected another session's copy in its own blob, got %+v (%v)", other, err)
+		}
+		var blobs int
+		filepath.Walk(filepath.Join(fm.GetBaseDir(), blobDir), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				blobs++
+			}
+			return nil
+		})
+		if blobs != 2 {
+			t.Errorf("Expected 2 blobs on disk, got %d", blobs)
+		}
+		stats, err := storageEngine.GetFileStats()
+		if err != nil || stats.TotalFiles != 3 || stats.TotalSizeBytes != 2*ref.Size {
+			t.Errorf("Expected 3 files in %d bytes, got %+v (%v)", 2*ref.Size, stats, err)
+		}
+	})
+
+	t.Run("Screenshots link to their activity block", func(t *testing.T) {
+		block := &ActivityBlock{BlockID: "09-00", StartTime: time.Now(), EndTime: time.Now()}
+		if err := storageEngine.AddActivityBlock("2025-03-01", "Code", block); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+		blocks, _ := storageEngine.GetActivityBlocks("2025-03-01", "Code")
+		if len(blocks) != 1 {
+			t.Fatalf("Expected 1 block, got %d", len(blocks))
+		}
+		blockID := int64(blocks[0].ID)
+		if err := storageEngine.LinkScreenshot("2025-03-01", "Code", "0900.png", blockID); err != nil {
+			t.Fatalf("Failed to link screenshot: %v", err)
+		}
+		linked, err := storageEngine.GetBlockScreenshots(blockID)
+		if err != nil || len(linked) != 1 || linked[0].Path != "2025-03-01/Code/screenshots/0900.png" {
+			t.Errorf("Expected the linked screenshot, got %+v (%v)", linked, err)
+		}
+		if err := storageEngine.LinkScreenshot("2025-03-01", "Code", "missing.png", blockID); !IsNotFound(err) {
+			t.Errorf("Expected not found for a missing screenshot, got %v", err)
+		}
+	})
+
+	t.Run("Released blobs are collected after the grace period", func(t *testing.T) {
+		if err := storageEngine.DeleteSession("2025-03-02"); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		if n := refCount(); n != 2 {
+			t.Errorf("Expected 2 references after deleting another session, got %d", n)
+		}
+		if err := storageEngine.DeleteSession("2025-03-01"); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		if n := refCount(); n != 0 {
+			t.Errorf("Expected no references, got %d", n)
+		}
+
+		if n, _, err := storageEngine.CollectGarbage(); err != nil || n != 0 {
+			t.Errorf("Expected the blob to be kept for the grace period, collected %d (%v)", n, err)
+		}
+		n, freed, err := fm.CollectGarbage(0)
+		if err != nil || n != 2 || freed != 2*ref.Size {
+			t.Errorf("Expected 2 blobs of %d bytes collected, got %d of %d (%v)", ref.Size, n, freed, err)
+		}
+		if _, err := os.Stat(fm.blobPath(ref.Hash)); !os.IsNotExist(err) {
+			t.Errorf("Expected the blob file to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("Saves racing garbage collection keep their blobs", func(t *testing.T) {
+		if _, err := storageEngine.CreateSession("2025-03-03"); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					name := fmt.Sprintf("%d-%d.png", i, j)
+					if _, err := storageEngine.SaveScreenshot("2025-03-03", "Code", name, shot); err != nil {
+						t.Errorf("Failed to save screenshot: %v", err)
+					}
+					if j%2 == 0 {
+						fm.remove(path.Join("2025-03-03", "Code", "screenshots", name))
+					}
+				}
+			}(i)
+		}
+		for i := 0; i < 10; i++ {
+			if _, _, err := fm.CollectGarbage(0); err != nil {
+				t.Errorf("Garbage collection failed: %v", err)
+			}
+		}
+		wg.Wait()
+		fm.CollectGarbage(0)
+
+		files, err := storageEngine.ListScreenshots("2025-03-03")
+		if err != nil || len(files) != 20 {
+			t.Fatalf("Expected 20 screenshots, got %d (%v)", len(files), err)
+		}
+		for _, file := range files {
+			r, err := storageEngine.OpenScreenshot(file)
+			if err != nil {
+				t.Errorf("Expected %s to open, got %v", file, err)
+				continue
+			}
+			data, _ := io.ReadAll(r)
+			r.Close()
+			if !bytes.Equal(data, shot) {
+				t.Errorf("Unexpected content in %s: %q", file, data)
+			}
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// fileRefColumns selects a FileRef from file_refs r joined with blobs b.
+const fileRefColumns = "r.path, r.blob_hash, b.size, r.block_id, r.modified_at"
+
+// PutFileRef points a logical file path at a blob, recording the blob if it
+// is new. A path that already exists is repointed, releasing its old blob.
+func (sm *SessionManager) PutFileRef(ref FileRef) error {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	var keyID interface{}
+	if ref.KeyID != 0 {
+		keyID = ref.KeyID
+	}
+	if _, err := tx.Exec("INSERT OR IGNORE INTO blobs (hash, size, key_id) VALUES (?, ?, ?)", ref.Hash, ref.Size, keyID); err != nil {
+		return NewStorageError(ErrDatabase, "failed to record blob", err)
+	}
+	var blockID interface{}
+	if ref.BlockID != 0 {
+		blockID = ref.BlockID
+	}
+	_, err = tx.Exec(`
+		INSERT INTO file_refs (path, blob_hash, block_id, modified_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET blob_hash = excluded.blob_hash,
+			block_id = COALESCE(excluded.block_id, block_id), modified_at = excluded.modified_at
+	`, ref.Path, ref.Hash, blockID, ref.ModTime)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to save file reference", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit file reference", err)
+	}
+	return nil
+}
+
+// GetFileRef returns the reference stored at a logical path.
+func (sm *SessionManager) GetFileRef(path string) (*FileRef, error) {
+	var ref FileRef
+	var blockID sql.NullInt64
+	err := sm.db.QueryRow(`
+		SELECT `+fileRefColumns+`
+		FROM file_refs r
+		JOIN blobs b ON b.hash = r.blob_hash
+		WHERE r.path = ?
+	`, path).Scan(&ref.Path, &ref.Hash, &ref.Size, &blockID, &ref.ModTime)
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "file not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get file reference", err)
+	}
+	ref.BlockID = blockID.Int64
+	return &ref, nil
+}
+
+// ListFileRefs returns the references at or below a logical path, or every
+// reference when prefix is empty, ordered by path.
+func (sm *SessionManager) ListFileRefs(prefix string) ([]FileRef, error) {
+	// substr rather than LIKE, since sanitized names contain underscores
+	return sm.queryFileRefs(`
+		SELECT `+fileRefColumns+`
+		FROM file_refs r
+		JOIN blobs b ON b.hash = r.blob_hash
+		WHERE ? = '' OR r.path = ? OR substr(r.path, 1, length(?) + 1) = ? || '/'
+		ORDER BY r.path
+	`, prefix, prefix, prefix, prefix)
+}
+
+// queryFileRefs returns the references selected by a query on
+// fileRefColumns.
+func (sm *SessionManager) queryFileRefs(query string, args ...interface{}) ([]FileRef, error) {
+	rows, err := sm.db.Query(query, args...)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query file references", err)
+	}
+	defer rows.Close()
+
+	var refs []FileRef
+	for rows.Next() {
+		var ref FileRef
+		var blockID sql.NullInt64
+		if err := rows.Scan(&ref.Path, &ref.Hash, &ref.Size, &blockID, &ref.ModTime); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan file reference", err)
+		}
+		ref.BlockID = blockID.Int64
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating file references", err)
+	}
+	return refs, nil
+}
+
+// DeleteFileRefs deletes the references at or below a logical path,
+// releasing their blobs. Returns the number of references deleted.
+func (sm *SessionManager) DeleteFileRefs(prefix string) (int, error) {
+	if prefix == "" {
+		return 0, NewStorageError(ErrValidation, "path is required", nil)
+	}
+	result, err := sm.db.Exec(`
+		DELETE FROM file_refs WHERE path = ? OR substr(path, 1, length(?) + 1) = ? || '/'
+	`, prefix, prefix, prefix)
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to delete file references", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// SetFileRefTime sets the modification time of the file at a logical path.
+func (sm *SessionManager) SetFileRefTime(path string, modTime time.Time) error {
+	result, err := sm.db.Exec("UPDATE file_refs SET modified_at = ? WHERE path = ?", modTime, path)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to update file time", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "file not found", nil)
+	}
+	return nil
+}
+
+// LinkFileRef links the file at a logical path to the activity block it
+// was captured for.
+func (sm *SessionManager) LinkFileRef(path string, blockID int64) error {
+	result, err := sm.db.Exec("UPDATE file_refs SET block_id = ? WHERE path = ?", blockID, path)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to link file", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "file not found", nil)
+	}
+	return nil
+}
+
+// GetBlockFileRefs returns the files linked to an activity block.
+func (sm *SessionManager) GetBlockFileRefs(blockID int64) ([]FileRef, error) {
+	return sm.queryFileRefs(`
+		SELECT `+fileRefColumns+`
+		FROM file_refs r
+		JOIN blobs b ON b.hash = r.blob_hash
+		WHERE r.block_id = ?
+		ORDER BY r.path
+	`, blockID)
+}
+
+// GetUnkeyedFileRefs returns the files of existing sessions whose blobs
+// are sealed with the master key rather than a data key.
+func (sm *SessionManager) GetUnkeyedFileRefs() ([]FileRef, error) {
+	return sm.queryFileRefs(`
+		SELECT ` + fileRefColumns + `
+		FROM file_refs r
+		JOIN blobs b ON b.hash = r.blob_hash
+		WHERE b.key_id IS NULL
+		  AND substr(r.path, 1, instr(r.path, '/') - 1) IN (SELECT date FROM sessions)
+		ORDER BY r.path
+	`)
+}
+
+// HasBlob reports whether a blob is recorded.
+func (sm *SessionManager) HasBlob(hash string) (bool, error) {
+	var exists bool
+	err := sm.db.QueryRow("SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = ?)", hash).Scan(&exists)
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to check blob", err)
+	}
+	return exists, nil
+}
+
+// GetUnreferencedBlobs returns the blobs no file has referenced for at
+// least grace.
+func (sm *SessionManager) GetUnreferencedBlobs(grace time.Duration) ([]string, error) {
+	rows, err := sm.db.Query(`
+		SELECT hash FROM blobs
+		WHERE ref_count = 0 AND COALESCE(released_at, created_at) <= datetime('now', ?)
+	`, fmt.Sprintf("-%d seconds", int64(grace/time.Second)))
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query unreferenced blobs", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan blob", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating blobs", err)
+	}
+	return hashes, nil
+}
+
+// DeleteBlob deletes a blob's record if nothing references it. Returns
+// false if it was referenced again in the meantime.
+func (sm *SessionManager) DeleteBlob(hash string) (bool, error) {
+	result, err := sm.db.Exec("DELETE FROM blobs WHERE hash = ? AND ref_count = 0", hash)
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to delete blob", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,692 @@
+package storage
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultIndexM is the default number of neighbours per node on the
+	// upper layers of the HNSW graph. The bottom layer keeps twice as many.
+	DefaultIndexM = 16
+	// DefaultIndexEfConstruction is the default number of candidates
+	// considered when linking a new vector into the graph.
+	DefaultIndexEfConstruction = 100
+	// DefaultIndexEfSearch is the default number of candidates considered
+	// per search.
+	DefaultIndexEfSearch = 128
+	// DefaultIndexExactThreshold is the default collection size up to which
+	// searches scan every vector instead of walking the graph.
+	DefaultIndexExactThreshold = 1000
+	// DefaultIndexSegmentSize is the default number of vectors per on-disk segment.
+	DefaultIndexSegmentSize = 4096
+
+	// hnswMaxLevel caps the number of graph layers.
+	hnswMaxLevel = 16
+	// hnswRepairRatio is the share of deleted nodes that triggers unlinking
+	// them from the graph.
+	hnswRepairRatio = 0.1
+)
+
+// hnswGraphMagic starts a saved HNSW graph.
+var hnswGraphMagic = [8]byte{'W', 'H', 'N', 'S', 'W', '0', '0', '1'}
+
+// VectorIndexConfig tunes the approximate nearest-neighbour index of the
+// vector store. Raising EfSearch improves recall at the cost of latency;
+// raising M and EfConstruction improves recall at the cost of memory and
+// insert time.
+type VectorIndexConfig struct {
+	M              int // Neighbours per node on the upper layers, twice this on the bottom one (default: 16)
+	EfConstruction int // Candidates considered when inserting (default: 100)
+	EfSearch       int // Candidates considered per search, at least topK (default: 128)
+	ExactThreshold int // Collections up to this size are searched exactly (default: 1000)
+	SegmentSize    int // Vectors per on-disk segment (default: 4096)
+}
+
+// DefaultVectorIndexConfig returns a VectorIndexConfig with default values.
+func DefaultVectorIndexConfig() *VectorIndexConfig {
+	return &VectorIndexConfig{
+		M:              DefaultIndexM,
+		EfConstruction: DefaultIndexEfConstruction,
+		EfSearch:       DefaultIndexEfSearch,
+		ExactThreshold: DefaultIndexExactThreshold,
+		SegmentSize:    DefaultIndexSegmentSize,
+	}
+}
+
+// withDefaults returns a copy of the config with unset values defaulted.
+func (c *VectorIndexConfig) withDefaults() *VectorIndexConfig {
+	config := DefaultVectorIndexConfig()
+	if c == nil {
+		return config
+	}
+	if c.M > 1 {
+		config.M = c.M
+	}
+	if c.EfConstruction > 0 {
+		config.EfConstruction = c.EfConstruction
+	}
+	if c.EfSearch > 0 {
+		config.EfSearch = c.EfSearch
+	}
+	if c.ExactThreshold >= 0 {
+		config.ExactThreshold = c.ExactThreshold
+	}
+	if c.SegmentSize > 0 {
+		config.SegmentSize = c.SegmentSize
+	}
+	return config
+}
+
+// vectorKey identifies a document in the vector store.
+type vectorKey struct {
+	kind uint8
+	id   int64
+}
+
+const (
+	vectorKindSession uint8 = iota
+	vectorKindNote
+)
+
+// hnswNode is a vector in the graph with its neighbours on each layer.
+type hnswNode struct {
+	key     vectorKey
+	stamp   int64 // Version of the document the node was built from
+	vec     []float32
+	links   [][]uint32
+	deleted bool
+}
+
+// hnswMatch is a node and its similarity to a query.
+type hnswMatch struct {
+	id    uint32
+	score float32
+}
+
+// hnswIndex is a hierarchical navigable small world graph over unit-length
+// vectors, ranking by cosine similarity. Deleted nodes stay in the graph as
+// waypoints until enough accumulate to unlink them in one pass. It isn't
+// safe for concurrent use, except for concurrent searches.
+type hnswIndex struct {
+	m              int
+	m0             int
+	efConstruction int
+	levelMult      float64
+	nodes          []*hnswNode
+	free           []uint32
+	entry          int64 // -1 when empty
+	maxLevel       int
+	deleted        int
+	rng            *rand.Rand
+	visited        sync.Pool
+}
+
+// newHNSWIndex creates an empty index.
+func newHNSWIndex(config *VectorIndexConfig) *hnswIndex {
+	return &hnswIndex{
+		m:              config.M,
+		m0:             2 * config.M,
+		efConstruction: config.EfConstruction,
+		levelMult:      1 / math.Log(float64(config.M)),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(1)),
+	}
+}
+
+// dotProduct returns the dot product of two vectors of the same length,
+// which for unit-length vectors is their cosine similarity. Converting to
+// arrays drops the bounds checks, which makes it a third faster.
+func dotProduct(a, b []float32) float32 {
+	n := len(a) &^ 7
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	for i := 0; i < n; i += 8 {
+		x := (*[8]float32)(a[i : i+8])
+		y := (*[8]float32)(b[i : i+8])
+		s0 += x[0]*y[0] + x[4]*y[4]
+		s1 += x[1]*y[1] + x[5]*y[5]
+		s2 += x[2]*y[2] + x[6]*y[6]
+		s3 += x[3]*y[3] + x[7]*y[7]
+	}
+	for i := n; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// live returns the number of nodes not deleted.
+func (h *hnswIndex) live() int {
+	return len(h.nodes) - len(h.free) - h.deleted
+}
+
+// maxLinks returns how many neighbours a node keeps on a layer.
+func (h *hnswIndex) maxLinks(level int) int {
+	if level == 0 {
+		return h.m0
+	}
+	return h.m
+}
+
+// randomLevel draws the top layer of a new node.
+func (h *hnswIndex) randomLevel() int {
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelMult)
+	if level > hnswMaxLevel {
+		level = hnswMaxLevel
+	}
+	return level
+}
+
+// insert adds a unit-length vector and returns its node.
+func (h *hnswIndex) insert(key vectorKey, stamp int64, vec []float32) uint32 {
+	if h.deleted > 0 && h.live() == 0 {
+		h.repair()
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{key: key, stamp: stamp, vec: vec, links: make([][]uint32, level+1)}
+	var id uint32
+	if n := len(h.free); n > 0 {
+		id = h.free[n-1]
+		h.free = h.free[:n-1]
+		h.nodes[id] = node
+	} else {
+		id = uint32(len(h.nodes))
+		h.nodes = append(h.nodes, node)
+	}
+
+	if h.entry < 0 {
+		h.entry = int64(id)
+		h.maxLevel = level
+		return id
+	}
+
+	cur := uint32(h.entry)
+	for l := h.maxLevel; l > level; l-- {
+		cur = h.greedy(vec, cur, l)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vec, cur, h.efConstruction, l)
+		if len(candidates) == 0 {
+			continue
+		}
+		neighbours := h.selectNeighbours(vec, candidates, h.m)
+		node.links[l] = make([]uint32, 0, len(neighbours))
+		for _, n := range neighbours {
+			node.links[l] = append(node.links[l], n.id)
+			h.link(n.id, id, l)
+		}
+		cur = candidates[0].id
+	}
+
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = int64(id)
+	}
+	return id
+}
+
+// link adds a link from one node to another on a layer. A node with too
+// many neighbours keeps the most similar; choosing them as selectNeighbours
+// does costs twice the insert time without better recall.
+func (h *hnswIndex) link(from, to uint32, level int) {
+	node := h.nodes[from]
+	if len(node.links[level]) < h.maxLinks(level) {
+		node.links[level] = append(node.links[level], to)
+		return
+	}
+
+	candidates := make([]hnswMatch, 0, len(node.links[level])+1)
+	for _, n := range append(node.links[level], to) {
+		candidates = append(candidates, hnswMatch{id: n, score: dotProduct(node.vec, h.nodes[n].vec)})
+	}
+	sortMatches(candidates)
+	h.setLinks(node, level, candidates[:h.maxLinks(level)])
+}
+
+// setLinks replaces a node's neighbours on a layer.
+func (h *hnswIndex) setLinks(node *hnswNode, level int, neighbours []hnswMatch) {
+	links := node.links[level][:0]
+	for _, n := range neighbours {
+		links = append(links, n.id)
+	}
+	node.links[level] = links
+}
+
+// selectNeighbours picks up to m of the candidates, sorted most similar
+// first, preferring ones that aren't closer to an already picked neighbour
+// than to vec so that links spread in different directions. Skipped
+// candidates fill any remaining places.
+func (h *hnswIndex) selectNeighbours(vec []float32, candidates []hnswMatch, m int) []hnswMatch {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]hnswMatch, 0, m)
+	var skipped []hnswMatch
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		cvec := h.nodes[c.id].vec
+		diverse := true
+		for _, s := range selected {
+			if dotProduct(cvec, h.nodes[s.id].vec) > c.score {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for _, c := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// greedy walks a layer from a node towards vec, returning the closest node
+// it reaches.
+func (h *hnswIndex) greedy(vec []float32, cur uint32, level int) uint32 {
+	best := dotProduct(vec, h.nodes[cur].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range h.nodes[cur].links[level] {
+			if score := dotProduct(vec, h.nodes[n].vec); score > best {
+				best, cur, changed = score, n, true
+			}
+		}
+	}
+	return cur
+}
+
+// searchLayer returns up to ef live nodes on a layer most similar to vec,
+// most similar first, walking out from the entry node. Deleted nodes are
+// walked through but not returned.
+func (h *hnswIndex) searchLayer(vec []float32, entry uint32, ef, level int) []hnswMatch {
+	visited := h.visitedSet()
+	defer h.visited.Put(visited)
+	visited.visit(entry)
+
+	score := dotProduct(vec, h.nodes[entry].vec)
+	candidates := &matchHeap{max: true}
+	results := &matchHeap{}
+	heap.Push(candidates, hnswMatch{id: entry, score: score})
+	if !h.nodes[entry].deleted {
+		heap.Push(results, hnswMatch{id: entry, score: score})
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswMatch)
+		if results.Len() >= ef && c.score < results.matches[0].score {
+			break
+		}
+		for _, n := range h.nodes[c.id].links[level] {
+			if !visited.visit(n) {
+				continue
+			}
+			node := h.nodes[n]
+			score := dotProduct(vec, node.vec)
+			if results.Len() < ef || score > results.matches[0].score {
+				heap.Push(candidates, hnswMatch{id: n, score: score})
+				if !node.deleted {
+					heap.Push(results, hnswMatch{id: n, score: score})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	matches := results.matches
+	sortMatches(matches)
+	return matches
+}
+
+// search returns up to k live nodes most similar to vec, considering ef
+// candidates.
+func (h *hnswIndex) search(vec []float32, k, ef int) []hnswMatch {
+	if h.entry < 0 {
+		return nil
+	}
+	cur := uint32(h.entry)
+	for l := h.maxLevel; l > 0; l-- {
+		cur = h.greedy(vec, cur, l)
+	}
+	matches := h.searchLayer(vec, cur, max(ef, k), 0)
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// searchExact returns the k live nodes most similar to vec by comparing
+// it with every node.
+func (h *hnswIndex) searchExact(vec []float32, k int) []hnswMatch {
+	results := &matchHeap{}
+	for id, node := range h.nodes {
+		if node == nil || node.deleted {
+			continue
+		}
+		score := dotProduct(vec, node.vec)
+		if results.Len() < k {
+			heap.Push(results, hnswMatch{id: uint32(id), score: score})
+		} else if score > results.matches[0].score {
+			results.matches[0] = hnswMatch{id: uint32(id), score: score}
+			heap.Fix(results, 0)
+		}
+	}
+	matches := results.matches
+	sortMatches(matches)
+	return matches
+}
+
+// remove marks a node deleted, unlinking deleted nodes from the graph once
+// they make up a tenth of it.
+func (h *hnswIndex) remove(id uint32) {
+	if h.nodes[id].deleted {
+		return
+	}
+	h.nodes[id].deleted = true
+	h.deleted++
+	if float64(h.deleted) >= hnswRepairRatio*float64(len(h.nodes)-len(h.free)) {
+		h.repair()
+	}
+}
+
+// repair unlinks the deleted nodes, reconnecting each of their neighbours
+// to the most similar of its remaining neighbours and the deleted nodes'
+// ones, and frees their slots.
+func (h *hnswIndex) repair() {
+	if h.deleted == 0 {
+		return
+	}
+
+	for id, node := range h.nodes {
+		if node == nil || node.deleted {
+			continue
+		}
+		for level, links := range node.links {
+			if !h.linksDeleted(links) {
+				continue
+			}
+
+			seen := map[uint32]bool{uint32(id): true}
+			var candidates []hnswMatch
+			add := func(n uint32) {
+				if seen[n] || h.nodes[n].deleted {
+					return
+				}
+				seen[n] = true
+				candidates = append(candidates, hnswMatch{id: n, score: dotProduct(node.vec, h.nodes[n].vec)})
+			}
+			for _, n := range links {
+				if !h.nodes[n].deleted {
+					add(n)
+					continue
+				}
+				if gone := h.nodes[n]; level < len(gone.links) {
+					for _, nn := range gone.links[level] {
+						add(nn)
+					}
+				}
+			}
+			sortMatches(candidates)
+			h.setLinks(node, level, candidates[:min(len(candidates), h.maxLinks(level))])
+		}
+	}
+
+	for id, node := range h.nodes {
+		if node != nil && node.deleted {
+			h.nodes[id] = nil
+			h.free = append(h.free, uint32(id))
+		}
+	}
+	h.deleted = 0
+
+	if h.entry >= 0 && h.nodes[h.entry] == nil {
+		h.entry = -1
+		h.maxLevel = 0
+		for id, node := range h.nodes {
+			if node != nil && (h.entry < 0 || len(node.links)-1 > h.maxLevel) {
+				h.entry = int64(id)
+				h.maxLevel = len(node.links) - 1
+			}
+		}
+	}
+	if h.entry < 0 {
+		h.nodes = nil
+		h.free = nil
+	}
+}
+
+// linksDeleted reports whether any of the links point at deleted nodes.
+func (h *hnswIndex) linksDeleted(links []uint32) bool {
+	for _, n := range links {
+		if h.nodes[n].deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTo saves the graph's structure; vectors are stored separately.
+func (h *hnswIndex) writeTo(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	le := binary.LittleEndian
+
+	bw.Write(hnswGraphMagic[:])
+	buf := make([]byte, 0, 64)
+	buf = le.AppendUint32(buf, uint32(h.m))
+	buf = le.AppendUint32(buf, uint32(len(h.nodes)))
+	buf = le.AppendUint64(buf, uint64(h.entry))
+	buf = le.AppendUint32(buf, uint32(h.maxLevel))
+	bw.Write(buf)
+
+	for _, node := range h.nodes {
+		buf = buf[:0]
+		if node == nil || node.deleted {
+			buf = append(buf, 0)
+			bw.Write(buf)
+			continue
+		}
+		buf = append(buf, 1, node.key.kind)
+		buf = le.AppendUint64(buf, uint64(node.key.id))
+		buf = le.AppendUint64(buf, uint64(node.stamp))
+		buf = append(buf, byte(len(node.links)))
+		for _, links := range node.links {
+			buf = le.AppendUint16(buf, uint16(len(links)))
+			for _, n := range links {
+				buf = le.AppendUint32(buf, n)
+			}
+		}
+		bw.Write(buf)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(le.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+// errHNSWGraphInvalid is returned for a saved graph that can't be used.
+var errHNSWGraphInvalid = errors.New("invalid HNSW graph")
+
+// readHNSWIndex loads a graph saved by writeTo. resolve returns the vector
+// of a node's document if it still has the version the node was built
+// from; nodes it can't resolve are unlinked.
+func readHNSWIndex(data []byte, config *VectorIndexConfig, resolve func(key vectorKey, stamp int64, id uint32) ([]float32, bool)) (*hnswIndex, error) {
+	le := binary.LittleEndian
+	if len(data) < 36 || [8]byte(data[:8]) != hnswGraphMagic {
+		return nil, errHNSWGraphInvalid
+	}
+	body, sum := data[:len(data)-4], le.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, errHNSWGraphInvalid
+	}
+
+	h := newHNSWIndex(config)
+	if int(le.Uint32(body[8:])) != h.m {
+		return nil, errHNSWGraphInvalid
+	}
+	count := int(le.Uint32(body[12:]))
+	h.entry = int64(le.Uint64(body[16:]))
+	h.maxLevel = int(le.Uint32(body[24:]))
+	pos := 28
+
+	read := func(n int) []byte {
+		if pos+n > len(body) {
+			return nil
+		}
+		b := body[pos : pos+n]
+		pos += n
+		return b
+	}
+
+	h.nodes = make([]*hnswNode, count)
+	for id := range h.nodes {
+		present := read(1)
+		if present == nil {
+			return nil, errHNSWGraphInvalid
+		}
+		if present[0] == 0 {
+			continue
+		}
+		head := read(18)
+		if head == nil {
+			return nil, errHNSWGraphInvalid
+		}
+		node := &hnswNode{
+			key:   vectorKey{kind: head[0], id: int64(le.Uint64(head[1:]))},
+			stamp: int64(le.Uint64(head[9:])),
+			links: make([][]uint32, head[17]),
+		}
+		for level := range node.links {
+			n := read(2)
+			if n == nil {
+				return nil, errHNSWGraphInvalid
+			}
+			links := read(4 * int(le.Uint16(n)))
+			if links == nil {
+				return nil, errHNSWGraphInvalid
+			}
+			node.links[level] = make([]uint32, len(links)/4)
+			for i := range node.links[level] {
+				node.links[level][i] = le.Uint32(links[4*i:])
+			}
+		}
+		h.nodes[id] = node
+	}
+	if pos != len(body) {
+		return nil, errHNSWGraphInvalid
+	}
+
+	// Check the links before resolving vectors, so a bad graph is rejected whole
+	for _, node := range h.nodes {
+		if node == nil {
+			continue
+		}
+		for _, links := range node.links {
+			for _, n := range links {
+				if int(n) >= count || h.nodes[n] == nil {
+					return nil, errHNSWGraphInvalid
+				}
+			}
+		}
+	}
+	if (h.entry >= 0) != (count > 0) || h.entry >= int64(count) || (h.entry >= 0 && h.nodes[h.entry] == nil) {
+		return nil, errHNSWGraphInvalid
+	}
+
+	for id, node := range h.nodes {
+		if node == nil {
+			h.free = append(h.free, uint32(id))
+			continue
+		}
+		vec, ok := resolve(node.key, node.stamp, uint32(id))
+		if !ok {
+			node.deleted = true
+			h.deleted++
+			continue
+		}
+		node.vec = vec
+	}
+	h.repair()
+	return h, nil
+}
+
+// visitedSet marks the nodes a search has reached. Marks are generation
+// numbers, so reusing a set doesn't need clearing it.
+type visitedSet struct {
+	marks []uint32
+	gen   uint32
+}
+
+// visitedSet returns a visited set sized for the graph.
+func (h *hnswIndex) visitedSet() *visitedSet {
+	v, _ := h.visited.Get().(*visitedSet)
+	if v == nil {
+		v = &visitedSet{}
+	}
+	if len(v.marks) < len(h.nodes) {
+		v.marks = make([]uint32, len(h.nodes)+len(h.nodes)/4)
+		v.gen = 0
+	}
+	v.gen++
+	if v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+	return v
+}
+
+// visit marks a node, reporting whether it wasn't marked already.
+func (v *visitedSet) visit(id uint32) bool {
+	if v.marks[id] == v.gen {
+		return false
+	}
+	v.marks[id] = v.gen
+	return true
+}
+
+// matchHeap is a heap of matches, least similar on top unless max is set.
+type matchHeap struct {
+	matches []hnswMatch
+	max     bool
+}
+
+func (m *matchHeap) Len() int { return len(m.matches) }
+func (m *matchHeap) Less(i, j int) bool {
+	if m.max {
+		return m.matches[i].score > m.matches[j].score
+	}
+	return m.matches[i].score < m.matches[j].score
+}
+func (m *matchHeap) Swap(i, j int) { m.matches[i], m.matches[j] = m.matches[j], m.matches[i] }
+func (m *matchHeap) Push(x any)    { m.matches = append(m.matches, x.(hnswMatch)) }
+func (m *matchHeap) Pop() any {
+	last := m.matches[len(m.matches)-1]
+	m.matches = m.matches[:len(m.matches)-1]
+	return last
+}
+
+// sortMatches orders matches most similar first.
+func sortMatches(matches []hnswMatch) {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	chromem "github.com/philippgille/chromem-go"
+)
+
+// embeddingGenerator returns a function drawing embeddings around a fixed
+// set of topic centres. Embeddings of real text cluster like this; uniform
+// random vectors have no near neighbours for an index to find.
+func embeddingGenerator(seed int64) func() []float32 {
+	rng := rand.New(rand.NewSource(seed))
+	centres := make([][]float32, 50)
+	for i := range centres {
+		centres[i] = make([]float32, EmbeddingDimensions)
+		for j := range centres[i] {
+			centres[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return func() []float32 {
+		centre := centres[rng.Intn(len(centres))]
+		embedding := make([]float32, EmbeddingDimensions)
+		for j := range embedding {
+			embedding[j] = centre[j] + 0.8*float32(rng.NormFloat64())
+		}
+		return embedding
+	}
+}
+
+// measureRecall returns the share of the exact top k the store's
+// approximate search finds, averaged over the queries.
+func measureRecall(s *vectorStore, queries [][]float32, k, ef int) float64 {
+	var found, total int
+	for _, query := range queries {
+		exact := make(map[vectorKey]bool, k)
+		for _, m := range s.searchExact(query, k) {
+			exact[m.doc.key] = true
+		}
+		for _, m := range s.search(query, k, ef) {
+			if exact[m.doc.key] {
+				found++
+			}
+		}
+		total += len(exact)
+	}
+	return float64(found) / float64(total)
+}
+
+// TestVectorIndex tests the approximate index's recall against exact
+// search, deleting and replacing vectors, reopening after a crash and
+// importing chromem-go databases.
+func TestVectorIndex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "vector_index_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir := filepath.Join(tempDir, "index")
+	config := DefaultVectorIndexConfig()
+	config.ExactThreshold = 0
+	config.SegmentSize = 256
+	s, err := openVectorStore(dir, EmbeddingDimensions, config)
+	if err != nil {
+		t.Fatalf("Failed to open vector store: %v", err)
+	}
+	defer func() { s.close() }()
+
+	generate := embeddingGenerator(1)
+	const n = 3000
+	for i := int64(1); i <= n; i++ {
+		if err := s.put(vectorKey{kind: vectorKindSession, id: i}, i, DefaultEmbeddingModel, generate()); err != nil {
+			t.Fatalf("Failed to store vector %d: %v", i, err)
+		}
+	}
+	queries := make([][]float32, 50)
+	for i := range queries {
+		queries[i] = generate()
+	}
+
+	t.Run("Search finds the exact nearest neighbours", func(t *testing.T) {
+		if recall := measureRecall(s, queries, 10, config.EfSearch); recall < 0.95 {
+			t.Errorf("Expected recall@10 of at least 0.95, got %.3f", recall)
+		}
+		if narrow, wide := measureRecall(s, queries, 10, 10), measureRecall(s, queries, 10, 200); narrow > wide {
+			t.Errorf("Expected recall to grow with ef, got %.3f at 10 and %.3f at 200", narrow, wide)
+		}
+	})
+
+	t.Run("Deleted and replaced vectors leave the index and the disk", func(t *testing.T) {
+		deleted := s.docs[vectorKey{kind: vectorKindSession, id: 7}].vec
+		replaced := s.docs[vectorKey{kind: vectorKindSession, id: 8}].vec
+		for i := int64(1); i <= 600; i++ {
+			key := vectorKey{kind: vectorKindSession, id: i}
+			if i%2 == 1 {
+				err = s.remove(key)
+			} else {
+				err = s.put(key, i, DefaultEmbeddingModel, generate())
+			}
+			if err != nil {
+				t.Fatalf("Failed to change vector %d: %v", i, err)
+			}
+		}
+		if s.count() != n-300 || s.index.live() != n-300 {
+			t.Fatalf("Expected %d vectors, got %d stored and %d indexed", n-300, s.count(), s.index.live())
+		}
+
+		for _, m := range s.search(deleted, 10, config.EfSearch) {
+			if m.doc.key.id%2 == 1 && m.doc.key.id <= 600 {
+				t.Errorf("Expected deleted vector %d not found", m.doc.key.id)
+			}
+		}
+		if top := s.search(replaced, 1, config.EfSearch); len(top) == 1 && top[0].doc.key.id == 8 && top[0].score > 0.999 {
+			t.Errorf("Expected the replaced vector gone from the index")
+		}
+		if recall := measureRecall(s, queries, 10, config.EfSearch); recall < 0.95 {
+			t.Errorf("Expected recall@10 of at least 0.95 after changes, got %.3f", recall)
+		}
+
+		// The bytes of removed vectors are overwritten, not just unlinked
+		needle := make([]byte, 0, 64)
+		for _, v := range deleted[:16] {
+			needle = binary.LittleEndian.AppendUint32(needle, math.Float32bits(v))
+		}
+		paths, _ := filepath.Glob(filepath.Join(dir, "segment-*.vec"))
+		for _, path := range paths {
+			data, _ := os.ReadFile(path)
+			if bytes.Contains(data, needle) {
+				t.Errorf("Expected the deleted vector erased from %s", filepath.Base(path))
+			}
+		}
+	})
+
+	t.Run("The index reopens and catches up after a crash", func(t *testing.T) {
+		if err := s.flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		added := generate()
+		if err := s.put(vectorKey{kind: vectorKindNote, id: 1}, 42, DefaultEmbeddingModel, added); err != nil {
+			t.Fatalf("Failed to store note vector: %v", err)
+		}
+		if err := s.remove(vectorKey{kind: vectorKindSession, id: 1000}); err != nil {
+			t.Fatalf("Failed to remove vector: %v", err)
+		}
+		// Stop without saving the graph
+		s.segments.close()
+
+		s, err = openVectorStore(dir, EmbeddingDimensions, config)
+		if err != nil {
+			t.Fatalf("Failed to reopen vector store: %v", err)
+		}
+		if s.count() != n-300 || s.index.live() != n-300 {
+			t.Errorf("Expected %d vectors after reopening, got %d stored and %d indexed", n-300, s.count(), s.index.live())
+		}
+		top := s.search(added, 1, config.EfSearch)
+		if len(top) != 1 || top[0].doc.key != (vectorKey{kind: vectorKindNote, id: 1}) || top[0].doc.sessionID != 42 {
+			t.Errorf("Expected the note vector added before the crash found, got %+v", top)
+		}
+		if recall := measureRecall(s, queries, 10, config.EfSearch); recall < 0.95 {
+			t.Errorf("Expected recall@10 of at least 0.95 after reopening, got %.3f", recall)
+		}
+
+		s.close()
+		if err := os.WriteFile(filepath.Join(dir, hnswGraphFile), []byte("not a graph"), 0644); err != nil {
+			t.Fatalf("Failed to corrupt graph: %v", err)
+		}
+		s, err = openVectorStore(dir, EmbeddingDimensions, config)
+		if err != nil {
+			t.Fatalf("Failed to reopen vector store with a corrupt graph: %v", err)
+		}
+		if s.index.live() != n-300 || !s.dirty {
+			t.Errorf("Expected the graph rebuilt, got %d indexed", s.index.live())
+		}
+	})
+
+	t.Run("chromem-go databases are imported", func(t *testing.T) {
+		dataDir := filepath.Join(tempDir, "chromem")
+		db, err := chromem.NewPersistentDB(filepath.Join(dataDir, "vectors", "chromem"), false)
+		if err != nil {
+			t.Fatalf("Failed to create chromem-go database: %v", err)
+		}
+		collection, err := db.GetOrCreateCollection(CollectionName, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to create collection: %v", err)
+		}
+		err = collection.Add(context.Background(),
+			[]string{"session_5", "note_9"},
+			[][]float32{generate(), generate()},
+			[]map[string]string{
+				{"session_id": "5", "model_version": "older-model"},
+				{"session_id": "5", "note_id": "9", "kind": "note", "model_version": DefaultEmbeddingModel},
+			},
+			[]string{"", ""})
+		if err != nil {
+			t.Fatalf("Failed to add chromem-go documents: %v", err)
+		}
+
+		vm, err := NewVectorManager(DefaultVectorManagerConfig(dataDir))
+		if err != nil {
+			t.Fatalf("Failed to create VectorManager: %v", err)
+		}
+		defer vm.Close()
+
+		if _, model, err := vm.GetEmbedding(5); err != nil || model != "older-model" {
+			t.Errorf("Expected the session embedding imported with its model, got %q (%v)", model, err)
+		}
+		if _, _, err := vm.GetNoteEmbedding(9); err != nil || vm.Count() != 2 {
+			t.Errorf("Expected the note embedding imported, got %d embeddings (%v)", vm.Count(), err)
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, "vectors", "chromem")); !os.IsNotExist(err) {
+			t.Errorf("Expected the chromem-go database removed, got %v", err)
+		}
+	})
+}
+
+// BenchmarkVectorIndexRecall measures search latency and recall@10 against
+// exact search on 50k embeddings (10k with -short) as ef grows.
+func BenchmarkVectorIndexRecall(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "vector_index_bench_*")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := DefaultVectorIndexConfig()
+	config.ExactThreshold = 0
+	s, err := openVectorStore(tempDir, EmbeddingDimensions, config)
+	if err != nil {
+		b.Fatalf("Failed to open vector store: %v", err)
+	}
+	defer s.close()
+
+	n := 50000
+	if testing.Short() {
+		n = 10000
+	}
+	generate := embeddingGenerator(1)
+	start := time.Now()
+	for i := 1; i <= n; i++ {
+		if err := s.put(vectorKey{kind: vectorKindSession, id: int64(i)}, int64(i), DefaultEmbeddingModel, generate()); err != nil {
+			b.Fatalf("Failed to store vector %d: %v", i, err)
+		}
+	}
+	b.Logf("Indexed %d vectors in %v", n, time.Since(start))
+	queries := make([][]float32, 200)
+	for i := range queries {
+		queries[i] = generate()
+	}
+
+	b.Run("exact", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.searchExact(queries[i%len(queries)], 10)
+		}
+	})
+	for _, ef := range []int{16, 32, 64, 128, 256} {
+		b.Run(fmt.Sprintf("ef=%d", ef), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.search(queries[i%len(queries)], 10, ef)
+			}
+			b.StopTimer()
+			b.ReportMetric(measureRecall(s, queries, 10, ef), "recall@10")
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetImportWatermark returns the saved high-water mark for an import source,
+// or an empty string if the source has never been imported.
+func (sm *SessionManager) GetImportWatermark(source string) (string, error) {
+	if source == "" {
+		return "", NewStorageError(ErrValidation, "import source is required", nil)
+	}
+
+	query := "SELECT high_water_mark FROM import_state WHERE source = ?"
+
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return "", NewStorageError(ErrDatabase, "failed to prepare statement", err)
+	}
+
+	var mark string
+	err = stmt.QueryRow(source).Scan(&mark)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", NewStorageError(ErrDatabase, "failed to get import watermark", err)
+	}
+
+	return mark, nil
+}
+
+// SetImportWatermark saves the high-water mark for an import source.
+func (sm *SessionManager) SetImportWatermark(source, mark string) error {
+	if source == "" {
+		return NewStorageError(ErrValidation, "import source is required", nil)
+	}
+
+	query := `
+		INSERT INTO import_state (source, high_water_mark, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(source) DO UPDATE SET
+			high_water_mark = excluded.high_water_mark,
+			updated_at = excluded.updated_at
+	`
+
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
+	}
+
+	if _, err := stmt.Exec(source, mark, time.Now()); err != nil {
+		return NewStorageError(ErrDatabase, "failed to set import watermark", err)
+	}
+
+	return nil
+}
+
+// BeginImport records the start of an import run and returns its ID.
+func (sm *SessionManager) BeginImport(importer, source string) (int64, error) {
+	if importer == "" {
+		return 0, NewStorageError(ErrValidation, "importer name is required", nil)
+	}
+
+	result, err := sm.db.Exec(`
+		INSERT INTO imports (importer, source, status, started_at)
+		VALUES (?, ?, ?, ?)
+	`, importer, source, ImportStatusRunning, time.Now())
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to begin import", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get last insert id", err)
+	}
+
+	return id, nil
+}
+
+// FinishImport marks an import run as completed or failed and stores its stats.
+func (sm *SessionManager) FinishImport(importID int64, status, statsJSON string) error {
+	if statsJSON == "" {
+		statsJSON = "{}"
+	}
+
+	result, err := sm.db.Exec(`
+		UPDATE imports SET status = ?, stats_json = ?, completed_at = ?
+		WHERE id = ?
+	`, status, statsJSON, time.Now(), importID)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to finish import", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return NewStorageError(ErrNotFound, "import not found", nil)
+	}
+
+	return nil
+}
+
+// AddImportRecord links an entity created by an import run to that run.
+// A non-empty externalKey marks the entity as imported for deduplication;
+// a stale key left behind by a deleted entity is taken over.
+func (sm *SessionManager) AddImportRecord(importID int64, importer, entityType string, entityID int64, externalKey string) error {
+	var key interface{}
+	if externalKey != "" {
+		key = externalKey
+	}
+
+	query := `
+		INSERT OR REPLACE INTO import_records (import_id, importer, entity_type, entity_id, external_key)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
+	}
+
+	if _, err := stmt.Exec(importID, importer, entityType, entityID, key); err != nil {
+		return NewStorageError(ErrDatabase, "failed to add import record", err)
+	}
+
+	return nil
+}
+
+// HasImportedKey reports whether an importer already created a still-existing
+// activity block for the given external key.
+func (sm *SessionManager) HasImportedKey(importer, externalKey string) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM import_records ir
+		JOIN activity_blocks ab ON ab.id = ir.entity_id
+		WHERE ir.importer = ? AND ir.external_key = ? AND ir.entity_type = 'activity_block'
+	`
+
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to prepare statement", err)
+	}
+
+	var count int
+	if err := stmt.QueryRow(importer, externalKey).Scan(&count); err != nil {
+		return false, NewStorageError(ErrDatabase, "failed to check imported key", err)
+	}
+
+	return count > 0, nil
+}
+
+// ListImports returns import runs, newest first.
+func (sm *SessionManager) ListImports(limit int) ([]ImportRun, error) {
+	if limit < 1 {
+		limit = 50
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT id, importer, source, status, stats_json, started_at, completed_at
+		FROM imports
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to list imports", err)
+	}
+	defer rows.Close()
+
+	var runs []ImportRun
+	for rows.Next() {
+		var run ImportRun
+		var completedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &run.Importer, &run.Source, &run.Status, &run.StatsJSON, &run.StartedAt, &completedAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan import", err)
+		}
+		if completedAt.Valid {
+			run.CompletedAt = &completedAt.Time
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating imports", err)
+	}
+
+	return runs, nil
+}
+
+// UndoImport deletes the activity blocks created by an import run, then any
+// app activities and sessions it created that are left empty. Sessions that
+// gained other content since the import are kept.
+func (sm *SessionManager) UndoImport(importID int64) (*ImportUndoResult, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin undo transaction", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM imports WHERE id = ?", importID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "import not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get import", err)
+	}
+	if status == ImportStatusUndone {
+		return nil, NewStorageError(ErrConflict, "import already undone", nil)
+	}
+
+	result := &ImportUndoResult{ImportID: importID, SessionsDeleted: []int64{}}
+
+	// Remember which app activities are affected before their blocks go away
+	appActivityIDs, err := queryInt64s(tx, `
+		SELECT DISTINCT ab.app_activity_id
+		FROM activity_blocks ab
+		JOIN import_records ir ON ir.entity_id = ab.id
+		WHERE ir.import_id = ? AND ir.entity_type = 'activity_block'
+	`, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(`
+		DELETE FROM activity_blocks WHERE id IN (
+			SELECT entity_id FROM import_records
+			WHERE import_id = ? AND entity_type = 'activity_block'
+		)
+	`, importID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to delete imported blocks", err)
+	}
+	deleted, _ := res.RowsAffected()
+	result.BlocksDeleted = int(deleted)
+
+	for _, id := range appActivityIDs {
+		if _, err := tx.Exec(`
+			DELETE FROM app_activities
+			WHERE id = ? AND NOT EXISTS (SELECT 1 FROM activity_blocks WHERE app_activity_id = ?)
+		`, id, id); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to delete empty app activity", err)
+		}
+	}
+
+	sessionIDs, err := queryInt64s(tx, `
+		SELECT entity_id FROM import_records
+		WHERE import_id = ? AND entity_type = 'session'
+	`, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range sessionIDs {
+		res, err := tx.Exec(`
+			DELETE FROM sessions
+			WHERE id = ?
+			  AND COALESCE(custom_title, '') = '' AND COALESCE(custom_summary, '') = ''
+			  AND NOT EXISTS (SELECT 1 FROM app_activities WHERE session_id = ?)
+			  AND NOT EXISTS (SELECT 1 FROM chats WHERE session_id = ?)
+			  AND NOT EXISTS (SELECT 1 FROM manual_notes WHERE session_id = ?)
+			  AND NOT EXISTS (SELECT 1 FROM browser_visits WHERE session_id = ?)
+			  AND NOT EXISTS (SELECT 1 FROM meetings WHERE session_id = ?)
+		`, id, id, id, id, id, id)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to delete imported session", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.SessionsDeleted = append(result.SessionsDeleted, id)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM import_records WHERE import_id = ?", importID); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to delete import records", err)
+	}
+	if _, err := tx.Exec("UPDATE imports SET status = ? WHERE id = ?", ImportStatusUndone, importID); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to mark import undone", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit undo", err)
+	}
+
+	return result, nil
+}
+
+// queryInt64s runs a single-column integer query inside a transaction.
+func queryInt64s(tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "query failed", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan id", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating ids", err)
+	}
+
+	return ids, nil
+}
@@ -8,9 +8,30 @@ import (
 type StorageConfig struct {
 	DataDir        string // Base directory (default: ~/.waddle/)
 	EncryptionKey  []byte // Derived from DPAPI
-	RetentionDays  int    // Default: 365
-	BackupTime     string // Default: "02:00"
+	RetentionDays  int    // Days sessions are kept; 0 keeps them forever. Default: 365
+	BackupTime     string // Local "HH:MM" of the nightly backup. Default: "02:00"
 	EmbeddingModel string // Default: "nomic-embed-text"
+
+	SessionIdleGap time.Duration // Idle time that starts a new work session. Default: 30m
+
+	TimeZone        string // IANA zone session dates are computed in. Default: "" (system zone)
+	DayRolloverHour int    // Hour at which a new session day starts. Default: 0
+
+	RevisionRetentionDays int // Days edit history is kept; 0 keeps it forever. Default: 180
+	MaxRevisionsPerEntity int // Revisions kept per session or card; 0 is unlimited. Default: 50
+
+	// Per-app and per-tag overrides of RetentionDays, first match wins
+	RetentionRules []RetentionRule
+
+	// Tiers screenshots are re-encoded into as they age. Default:
+	// DefaultScreenshotTiers
+	ScreenshotTiers []ScreenshotTier
+
+	// Backup snapshots kept by the grandfather-father-son cleanup; the newest
+	// snapshot is always kept
+	BackupKeepDaily   int // Default: 7
+	BackupKeepWeekly  int // Default: 4
+	BackupKeepMonthly int // Default: 12
 }
 
 // DefaultStorageConfig returns a StorageConfig with default values.
@@ -20,6 +41,16 @@ func DefaultStorageConfig(dataDir string) *StorageConfig {
 		RetentionDays:  365,
 		BackupTime:     "02:00",
 		EmbeddingModel: "nomic-embed-text",
+		SessionIdleGap: DefaultSessionIdleGap,
+
+		RevisionRetentionDays: 180,
+		MaxRevisionsPerEntity: 50,
+
+		ScreenshotTiers: DefaultScreenshotTiers(),
+
+		BackupKeepDaily:   7,
+		BackupKeepWeekly:  4,
+		BackupKeepMonthly: 12,
 	}
 }
 
@@ -33,18 +64,31 @@ type StorageEngineInterface interface {
 	ListSessions(page, pageSize int) ([]Session, int, error)
 
 	// Search operations
-	FullTextSearch(query string, page, pageSize int) ([]SearchResult, error)
-	SemanticSearch(query string, topK int, dateRange *DateRange) ([]SearchResult, error)
+	FullTextSearch(query string, page, pageSize int, tags ...string) ([]SearchResult, error)
+	SemanticSearch(query string, topK int, dateRange *DateRange, tags ...string) ([]SearchResult, error)
 
 	// Activity operations
 	AddActivityBlock(sessionDate, appName string, block *ActivityBlock) error
 	GetActivityBlocks(sessionDate, appName string) ([]ActivityBlock, error)
 	GetSessionAppActivities(sessionDate string) ([]AppActivity, error)
+	GetSessionWithActivities(sessionDate string) (*Session, error)
 
 	// Chat operations
 	AddChat(sessionDate string, chat *ChatMessage) error
 	GetChats(sessionDate string) ([]ChatMessage, error)
 
+	// Note operations
+	AddNote(sessionDate string, note *ManualNote) error
+	GetNote(noteID int64) (*ManualNote, error)
+	GetNotes(sessionDate string) ([]ManualNote, error)
+	UpdateNote(note *ManualNote) error
+	DeleteNote(noteID int64) error
+	GetNoteRevisions(noteID int64) ([]NoteRevision, error)
+
+	// Revision operations
+	GetRevisions(entity RevisionEntity, id int64) ([]Revision, error)
+	RestoreRevision(revisionID int64) error
+
 	// Notification operations
 	AddNotification(notif *Notification) error
 	GetNotifications(limit int) ([]Notification, error)
@@ -58,7 +102,7 @@ type StorageEngineInterface interface {
 	Initialize() error
 	Close() error
 	Backup() error
-	Restore(backupPath string) error
+	Restore(backupPath string, opts RestoreOptions) error
 
 	// Health
 	HealthCheck() (*HealthStatus, error)
@@ -81,7 +125,7 @@ type SessionManagerInterface interface {
 	UpdateSessionSynthesis(sessionID int64, entitiesJSON, synthesisStatus, aiSummary, aiBullets string) error
 
 	// FTS5 Search
-	Search(query string, page, pageSize int) ([]SearchResult, error)
+	Search(query string, page, pageSize int, tags ...string) ([]SearchResult, error)
 
 	// Activity Blocks
 	AddBlock(sessionID int64, appName string, block *ActivityBlock) error
@@ -130,6 +174,7 @@ type VectorManagerInterface interface {
 // EmbedRequest represents an async embedding generation request.
 type EmbedRequest struct {
 	SessionID int64
+	NoteID    int64 // Set when embedding a note of the session
 	Text      string
 	Callback  func(error)
 }
@@ -162,6 +207,15 @@ type EncryptionManagerInterface interface {
 	DecryptString(ciphertext string) (string, error)
 }
 
+// The implementations must keep up with the interfaces above.
+var (
+	_ StorageEngineInterface     = (*StorageEngine)(nil)
+	_ SessionManagerInterface    = (*SessionManager)(nil)
+	_ VectorManagerInterface     = (*VectorManager)(nil)
+	_ FileManagerInterface       = (*FileManager)(nil)
+	_ EncryptionManagerInterface = (*EncryptionManager)(nil)
+)
+
 // HealthStatus represents the health of the storage system.
 type HealthStatus struct {
 	Status    string           `json:"status"` // "healthy", "degraded", "unhealthy"
@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// ErrStopIteration is returned by an iteration callback to stop early; the
+// iteration then returns nil.
+var ErrStopIteration = errors.New("stop iteration")
+
+// iterateBatchSize is how many rows an iteration reads per query.
+const iterateBatchSize = 200
+
+// sessionColumns is the column list shared by session queries, in
+// scanSession order.
+const sessionColumns = `id, date, custom_title, custom_summary, original_summary, extracted_text_encrypted,
+	entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+	start_time, end_time, time_zone`
+
+// SessionQuery selects the sessions to page through, in date order. Pages
+// are read by keyset on the date index, so they stay as fast years into the
+// history as at its start.
+type SessionQuery struct {
+	From            string // Earliest date, inclusive; "" is unbounded
+	To              string // Latest date, inclusive; "" is unbounded
+	SynthesisStatus string // "" matches every status
+	Newest          bool   // Newest first rather than oldest first
+	WithoutText     bool   // Leaves ExtractedText empty rather than decrypting it
+}
+
+// scanSession reads a session selected with sessionColumns, decrypting its
+// extracted text unless withoutText is set.
+func (sm *SessionManager) scanSession(row rowScanner, withoutText bool) (*Session, error) {
+	var session Session
+	var encryptedText []byte
+	var bounds sessionBounds
+	err := row.Scan(
+		&session.ID, &session.Date, &session.CustomTitle, &session.CustomSummary,
+		&session.OriginalSummary, &encryptedText, &session.EntitiesJSON, &session.SynthesisStatus,
+		&session.AISummary, &session.AIBullets, &session.CreatedAt, &session.UpdatedAt,
+		&bounds.start, &bounds.end, &bounds.zone,
+	)
+	if err != nil {
+		return nil, err
+	}
+	bounds.apply(&session)
+
+	if !withoutText && len(encryptedText) > 0 && sm.encryptionMgr != nil {
+		decrypted, err := sm.encryptionMgr.Decrypt(encryptedText)
+		if err != nil {
+			return nil, NewStorageError(ErrEncryption, "failed to decrypt extracted text", err)
+		}
+		session.ExtractedText = string(decrypted)
+	}
+	return &session, nil
+}
+
+// ListSessionsAfter returns up to limit sessions following cursor and the
+// cursor of the next page, which is "" after the last page. An empty cursor
+// starts at the first page.
+func (sm *SessionManager) ListSessionsAfter(q SessionQuery, cursor string, limit int) ([]Session, string, error) {
+	if limit < 1 || limit > 1000 {
+		return nil, "", NewStorageError(ErrValidation, "limit must be between 1 and 1000", nil)
+	}
+
+	var where []string
+	var args []interface{}
+	if q.From != "" {
+		where = append(where, "date >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "date <= ?")
+		args = append(args, q.To)
+	}
+	if q.SynthesisStatus != "" {
+		where = append(where, "synthesis_status = ?")
+		args = append(args, q.SynthesisStatus)
+	}
+	order, after := "ASC", "date > ?"
+	if q.Newest {
+		order, after = "DESC", "date < ?"
+	}
+	if cursor != "" {
+		where = append(where, after)
+		args = append(args, cursor)
+	}
+
+	query := `SELECT ` + sessionColumns + ` FROM sessions`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// One row past the page tells whether another page follows
+	query += ` ORDER BY date ` + order + ` LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := sm.db.Query(query, args...)
+	if err != nil {
+		return nil, "", NewStorageError(ErrDatabase, "failed to list sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := sm.scanSession(rows, q.WithoutText)
+		if err != nil {
+			if _, ok := err.(*StorageError); ok {
+				return nil, "", err
+			}
+			return nil, "", NewStorageError(ErrDatabase, "failed to scan session", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", NewStorageError(ErrDatabase, "error iterating sessions", err)
+	}
+
+	if len(sessions) <= limit {
+		return sessions, "", nil
+	}
+	sessions = sessions[:limit]
+	return sessions, sessions[limit-1].Date, nil
+}
+
+// IterateSessions calls fn for each session matching q, reading them a page
+// at a time. No query is open while fn runs, so it may use the store.
+func (sm *SessionManager) IterateSessions(q SessionQuery, fn func(Session) error) error {
+	cursor := ""
+	for {
+		sessions, next, err := sm.ListSessionsAfter(q, cursor, iterateBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			if err := fn(session); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// BlockQuery selects the activity blocks to page through, in the order they
+// were added. Pages are read by keyset on the block ID.
+type BlockQuery struct {
+	SessionID     int64     // 0 matches every session
+	From          string    // Earliest session date, inclusive; "" is unbounded
+	To            string    // Latest session date, inclusive; "" is unbounded
+	AppName       string    // "" matches every app
+	CaptureSource string    // "" matches every source
+	Start         time.Time // Blocks ending after Start; zero is unbounded
+	End           time.Time // Blocks starting before End; zero is unbounded
+	WithoutText   bool      // Leaves OCRText empty rather than decrypting it
+}
+
+// SessionBlock is an activity block with the session and app it belongs to.
+type SessionBlock struct {
+	ActivityBlock
+	SessionID   types.SessionID `json:"sessionId" ts_type:"string"`
+	SessionDate string          `json:"sessionDate"`
+	AppName     string          `json:"appName"`
+}
+
+// overlaps reports whether a block falls in the query's time range.
+func (q BlockQuery) overlaps(block *ActivityBlock) bool {
+	if !q.Start.IsZero() && !block.EndTime.After(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !block.StartTime.Before(q.End) {
+		return false
+	}
+	return true
+}
+
+// ListBlocksAfter returns up to limit blocks following the block with ID
+// cursor and the cursor of the next page, which is 0 after the last page. A
+// zero cursor starts at the first page.
+func (sm *SessionManager) ListBlocksAfter(q BlockQuery, cursor int64, limit int) ([]SessionBlock, int64, error) {
+	if limit < 1 || limit > 1000 {
+		return nil, 0, NewStorageError(ErrValidation, "limit must be between 1 and 1000", nil)
+	}
+
+	var where []string
+	var args []interface{}
+	if q.SessionID != 0 {
+		where = append(where, "aa.session_id = ?")
+		args = append(args, q.SessionID)
+	}
+	// Block times are compared as instants below; the session dates a time
+	// range can fall in narrow the rows read, allowing a day either side
+	// for sessions recorded in another zone
+	from, to := q.From, q.To
+	if !q.Start.IsZero() {
+		if d := addDays(sm.calendar.Date(q.Start), -1); d > from {
+			from = d
+		}
+	}
+	if !q.End.IsZero() {
+		if d := addDays(sm.calendar.Date(q.End), 1); to == "" || d < to {
+			to = d
+		}
+	}
+	if from != "" {
+		where = append(where, "s.date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		where = append(where, "s.date <= ?")
+		args = append(args, to)
+	}
+	if q.AppName != "" {
+		where = append(where, "aa.app_name = ?")
+		args = append(args, q.AppName)
+	}
+	if q.CaptureSource != "" {
+		where = append(where, "ab.capture_source = ?")
+		args = append(args, q.CaptureSource)
+	}
+	where = append(where, "ab.id > ?")
+
+	query := `
+		SELECT ab.id, ab.app_activity_id, ab.block_id, ab.start_time, ab.end_time, ab.ocr_text_encrypted,
+		       ab.micro_summary, ab.capture_source, ab.structured_metadata, s.id, s.date, aa.app_name
+		FROM activity_blocks ab
+		JOIN app_activities aa ON aa.id = ab.app_activity_id
+		JOIN sessions s ON s.id = aa.session_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ab.id
+		LIMIT ?`
+
+	type scannedBlock struct {
+		SessionBlock
+		encryptedOCR []byte
+	}
+	blocks := []SessionBlock{}
+	for {
+		// Rows are read into memory and closed before decrypting, and read
+		// again when the time range filters out part of a page
+		rows, err := sm.db.Query(query, append(args, cursor, iterateBatchSize)...)
+		if err != nil {
+			return nil, 0, NewStorageError(ErrDatabase, "failed to list blocks", err)
+		}
+		var batch []scannedBlock
+		for rows.Next() {
+			var b scannedBlock
+			err := rows.Scan(
+				&b.ID, &b.AppActivityID, &b.BlockID, &b.StartTime, &b.EndTime, &b.encryptedOCR,
+				&b.MicroSummary, &b.CaptureSource, &b.StructuredMetadata, &b.SessionID, &b.SessionDate, &b.AppName,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, 0, NewStorageError(ErrDatabase, "failed to scan block", err)
+			}
+			batch = append(batch, b)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, 0, NewStorageError(ErrDatabase, "error iterating blocks", err)
+		}
+
+		for i, b := range batch {
+			cursor = int64(b.ID)
+			if !q.overlaps(&b.ActivityBlock) {
+				continue
+			}
+			if !q.WithoutText && len(b.encryptedOCR) > 0 && sm.encryptionMgr != nil {
+				decrypted, err := sm.encryptionMgr.Decrypt(b.encryptedOCR)
+				if err != nil {
+					return nil, 0, NewStorageError(ErrEncryption, "failed to decrypt OCR text", err)
+				}
+				b.OCRText = string(decrypted)
+			}
+			blocks = append(blocks, b.SessionBlock)
+			if len(blocks) == limit {
+				if i == len(batch)-1 && len(batch) < iterateBatchSize {
+					return blocks, 0, nil
+				}
+				return blocks, cursor, nil
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return blocks, 0, nil
+		}
+	}
+}
+
+// IterateBlocks calls fn for each block matching q, reading them a page at
+// a time. No query is open while fn runs, so it may use the store.
+func (sm *SessionManager) IterateBlocks(q BlockQuery, fn func(SessionBlock) error) error {
+	var cursor int64
+	for {
+		blocks, next, err := sm.ListBlocksAfter(q, cursor, iterateBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			if err := fn(block); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// GetActivitiesWithBlocks returns a session's app activities by app name,
+// each with its blocks earliest first, in a single query.
+func (sm *SessionManager) GetActivitiesWithBlocks(sessionID int64) ([]AppActivity, error) {
+	rows, err := sm.db.Query(`
+		SELECT aa.id, aa.session_id, aa.app_name, aa.created_at, aa.updated_at,
+		       ab.id, ab.block_id, ab.start_time, ab.end_time, ab.ocr_text_encrypted, ab.micro_summary,
+		       ab.capture_source, ab.structured_metadata
+		FROM app_activities aa
+		LEFT JOIN activity_blocks ab ON ab.app_activity_id = aa.id
+		WHERE aa.session_id = ?
+		ORDER BY aa.app_name ASC, aa.id
+	`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get activities", err)
+	}
+	defer rows.Close()
+
+	activities := []AppActivity{}
+	var encrypted [][][]byte // OCR ciphertext by activity and block
+	for rows.Next() {
+		var activity AppActivity
+		var blockID sql.NullInt64
+		var blockKey, microSummary, captureSource, metadata sql.NullString
+		var start, end sql.NullTime
+		var encryptedOCR []byte
+		err := rows.Scan(
+			&activity.ID, &activity.SessionID, &activity.AppName, &activity.CreatedAt, &activity.UpdatedAt,
+			&blockID, &blockKey, &start, &end, &encryptedOCR, &microSummary, &captureSource, &metadata,
+		)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan activity", err)
+		}
+
+		if n := len(activities); n == 0 || activities[n-1].ID != activity.ID {
+			activities = append(activities, activity)
+			encrypted = append(encrypted, nil)
+		}
+		if !blockID.Valid {
+			continue
+		}
+		n := len(activities) - 1
+		activities[n].Blocks = append(activities[n].Blocks, ActivityBlock{
+			ID:                 types.ElementID(blockID.Int64),
+			AppActivityID:      activity.ID,
+			BlockID:            blockKey.String,
+			StartTime:          start.Time,
+			EndTime:            end.Time,
+			MicroSummary:       microSummary.String,
+			CaptureSource:      captureSource.String,
+			StructuredMetadata: metadata.String,
+		})
+		encrypted[n] = append(encrypted[n], encryptedOCR)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating activities", err)
+	}
+	rows.Close()
+
+	for i := range activities {
+		blocks := activities[i].Blocks
+		for j := range blocks {
+			if len(encrypted[i][j]) > 0 && sm.encryptionMgr != nil {
+				decrypted, err := sm.encryptionMgr.Decrypt(encrypted[i][j])
+				if err != nil {
+					return nil, NewStorageError(ErrEncryption, "failed to decrypt OCR text", err)
+				}
+				blocks[j].OCRText = string(decrypted)
+			}
+		}
+		// Timestamps are stored as text, so order them as instants
+		sort.SliceStable(blocks, func(a, b int) bool { return blocks[a].StartTime.Before(blocks[b].StartTime) })
+	}
+	return activities, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestIterate tests keyset pages and iteration over sessions and blocks
+// across several batches, and loading a session's activities eagerly.
+func TestIterate(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// More sessions and blocks than fit in one batch
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	const days = iterateBatchSize + 50
+	var sessionIDs []int64
+	for i := 0; i < days; i++ {
+		day := first.AddDate(0, 0, i)
+		session := &Session{Date: day.Format("2006-01-02"), ExtractedText: "text"}
+		if i%3 == 0 {
+			session.SynthesisStatus = "completed"
+		}
+		if err := sm.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		sessionIDs = append(sessionIDs, int64(session.ID))
+
+		for _, app := range []string{"Editor", "Browser"} {
+			start := day.Add(9 * time.Hour)
+			block := &ActivityBlock{BlockID: "09-00", StartTime: start, EndTime: start.Add(time.Minute), OCRText: app + " text"}
+			if err := sm.AddBlock(int64(session.ID), app, block); err != nil {
+				t.Fatalf("Failed to add block: %v", err)
+			}
+		}
+	}
+
+	t.Run("Session pages follow the cursor", func(t *testing.T) {
+		var dates []string
+		cursor := ""
+		for {
+			page, next, err := sm.ListSessionsAfter(SessionQuery{Newest: true}, cursor, 100)
+			if err != nil {
+				t.Fatalf("Failed to list sessions: %v", err)
+			}
+			for _, s := range page {
+				dates = append(dates, s.Date)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if len(dates) != days || dates[0] != first.AddDate(0, 0, days-1).Format("2006-01-02") {
+			t.Fatalf("Expected %d sessions newest first, got %d starting %v", days, len(dates), dates[:1])
+		}
+		for i := 1; i < len(dates); i++ {
+			if dates[i] >= dates[i-1] {
+				t.Fatalf("Expected dates in descending order, got %s after %s", dates[i], dates[i-1])
+			}
+		}
+	})
+
+	t.Run("Iterating sessions filters and stops early", func(t *testing.T) {
+		pending := 0
+		err := sm.IterateSessions(SessionQuery{SynthesisStatus: "pending", WithoutText: true}, func(s Session) error {
+			if s.SynthesisStatus != "pending" || s.ExtractedText != "" {
+				t.Errorf("Unexpected session %+v", s)
+			}
+			pending++
+			return nil
+		})
+		if err != nil || pending != days-(days+2)/3 {
+			t.Errorf("Expected %d pending sessions, got %d (%v)", days-(days+2)/3, pending, err)
+		}
+
+		var seen []string
+		err = sm.IterateSessions(SessionQuery{From: "2024-02-01"}, func(s Session) error {
+			seen = append(seen, s.Date)
+			if len(seen) == 2 {
+				return ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil || len(seen) != 2 || seen[0] != "2024-02-01" || seen[1] != "2024-02-02" {
+			t.Errorf("Expected to stop after two sessions from February, got %v (%v)", seen, err)
+		}
+	})
+
+	t.Run("Iterating blocks filters by app and time", func(t *testing.T) {
+		count := 0
+		var lastID int64
+		err := sm.IterateBlocks(BlockQuery{AppName: "Editor"}, func(b SessionBlock) error {
+			if b.AppName != "Editor" || b.OCRText != "Editor text" || int64(b.ID) <= lastID {
+				t.Errorf("Unexpected block %+v", b)
+			}
+			lastID = int64(b.ID)
+			count++
+			return nil
+		})
+		if err != nil || count != days {
+			t.Errorf("Expected %d editor blocks, got %d (%v)", days, count, err)
+		}
+
+		start := first.AddDate(0, 0, 10)
+		blocks, next, err := sm.ListBlocksAfter(BlockQuery{Start: start, End: start.AddDate(0, 0, 2), WithoutText: true}, 0, 10)
+		if err != nil || next != 0 || len(blocks) != 4 {
+			t.Fatalf("Expected the 4 blocks of two days, got %d (next %d, %v)", len(blocks), next, err)
+		}
+		if blocks[0].SessionDate != start.Format("2006-01-02") || blocks[0].OCRText != "" {
+			t.Errorf("Unexpected first block %+v", blocks[0])
+		}
+	})
+
+	t.Run("Activities load with their blocks", func(t *testing.T) {
+		activities, err := sm.GetActivitiesWithBlocks(sessionIDs[0])
+		if err != nil {
+			t.Fatalf("Failed to get activities: %v", err)
+		}
+		if len(activities) != 2 || activities[0].AppName != "Browser" || len(activities[0].Blocks) != 1 ||
+			activities[0].Blocks[0].OCRText != "Browser text" || len(activities[1].Blocks) != 1 {
+			t.Errorf("Unexpected activities %+v", activities)
+		}
+		if err := sm.IterateSessions(SessionQuery{}, func(Session) error { return fmt.Errorf("failed") }); err == nil {
+			t.Errorf("Expected a callback error to be returned")
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// GetJobStates returns the persisted schedule state of every job.
+func (sm *SessionManager) GetJobStates() ([]JobState, error) {
+	rows, err := sm.db.Query(`
+		SELECT name, schedule, next_run_at, last_run_at, last_status, last_error
+		FROM job_state
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query job state", err)
+	}
+	defer rows.Close()
+
+	var states []JobState
+	for rows.Next() {
+		var state JobState
+		var nextRunAt, lastRunAt sql.NullTime
+		var lastStatus, lastError sql.NullString
+		if err := rows.Scan(&state.Name, &state.Schedule, &nextRunAt, &lastRunAt, &lastStatus, &lastError); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan job state", err)
+		}
+		state.NextRunAt = nextRunAt.Time
+		if lastRunAt.Valid {
+			state.LastRunAt = &lastRunAt.Time
+		}
+		state.LastStatus = JobRunStatus(lastStatus.String)
+		state.LastError = lastError.String
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating job state", err)
+	}
+
+	return states, nil
+}
+
+// SaveJobSchedule records a job's schedule and next run, keeping the
+// outcome of its last run.
+func (sm *SessionManager) SaveJobSchedule(name, schedule string, nextRunAt time.Time) error {
+	_, err := sm.db.Exec(`
+		INSERT INTO job_state (name, schedule, next_run_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET schedule = excluded.schedule, next_run_at = excluded.next_run_at
+	`, name, schedule, nextRunAt)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to save job schedule", err)
+	}
+	return nil
+}
+
+// StartJobRun records the start of a job run. A job runs at most once at a
+// time: starting a run while another is running is a conflict.
+func (sm *SessionManager) StartJobRun(job string, trigger JobTrigger) (*JobRun, error) {
+	run := &JobRun{Job: job, Trigger: trigger, Status: JobRunRunning, StartedAt: time.Now()}
+
+	result, err := sm.db.Exec(`
+		INSERT INTO job_runs (job, triggered_by, status, started_at)
+		SELECT ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM job_runs WHERE job = ? AND status = ?)
+	`, job, trigger, JobRunRunning, run.StartedAt, job, JobRunRunning)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to start job run", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, NewStorageError(ErrConflict, "job "+job+" is already running", nil)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get job run ID", err)
+	}
+	run.ID = types.ElementID(id)
+	return run, nil
+}
+
+// FinishJobRun records the outcome of a job run and sets it as the job's
+// last run.
+func (sm *SessionManager) FinishJobRun(run *JobRun) error {
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE job_runs SET status = ?, message = ?, error = ?, finished_at = ? WHERE id = ?`,
+		run.Status, run.Message, run.Error, finishedAt, run.ID)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to finish job run", err)
+	}
+	_, err = tx.Exec(`UPDATE job_state SET last_run_at = ?, last_status = ?, last_error = ? WHERE name = ?`,
+		run.StartedAt, run.Status, run.Error, run.Job)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to update job state", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit job run", err)
+	}
+	return nil
+}
+
+// FailInterruptedJobRuns marks runs still recorded as running, left behind
+// when the app exited mid-run, as failed. It returns the number of runs marked.
+func (sm *SessionManager) FailInterruptedJobRuns() (int, error) {
+	result, err := sm.db.Exec(`UPDATE job_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		JobRunFailed, "interrupted", time.Now(), JobRunRunning)
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to fail interrupted job runs", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get rows affected", err)
+	}
+	return int(count), nil
+}
+
+// GetJobRuns returns the most recent runs of a job, newest first. An empty
+// job returns the runs of every job.
+func (sm *SessionManager) GetJobRuns(job string, limit int) ([]JobRun, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT id, job, triggered_by, status, message, error, started_at, finished_at
+		FROM job_runs
+		WHERE ? = '' OR job = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, job, job, limit)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query job runs", err)
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		var run JobRun
+		var message, runErr sql.NullString
+		var finishedAt sql.NullTime
+		err := rows.Scan(&run.ID, &run.Job, &run.Trigger, &run.Status, &message, &runErr, &run.StartedAt, &finishedAt)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan job run", err)
+		}
+		run.Message = message.String
+		run.Error = runErr.String
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating job runs", err)
+	}
+
+	return runs, nil
+}
+
+// PruneJobRuns deletes all but the newest keep finished runs of a job. It
+// returns the number of runs deleted.
+func (sm *SessionManager) PruneJobRuns(job string, keep int) (int, error) {
+	result, err := sm.db.Exec(`
+		DELETE FROM job_runs
+		WHERE job = ? AND status != ? AND id NOT IN (
+			SELECT id FROM job_runs WHERE job = ? ORDER BY id DESC LIMIT ?
+		)
+	`, job, JobRunRunning, job, keep)
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to prune job runs", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get rows affected", err)
+	}
+	return int(count), nil
+}
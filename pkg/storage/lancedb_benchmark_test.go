@@ -124,10 +124,13 @@ func TestPerformanceTargets(t *testing.T) {
 	}{
 		{"1k vectors", 1000, 10 * time.Millisecond},   // Warm-up
 		{"10k vectors", 10000, 15 * time.Millisecond}, // Intermediate
-		{"50k vectors", 50000, 35 * time.Millisecond}, // Realistic for chromem-go brute-force
-		// NOTE: With actual LanceDB IVF_PQ indexing, target would be 20ms
+		{"50k vectors", 50000, 20 * time.Millisecond}, // README target, held by the HNSW index
 	}
 	
+	// Latency depends on the machine, so missing a target only fails the
+	// test when WADDLE_PERF_TARGETS is set
+	enforceTargets := os.Getenv("WADDLE_PERF_TARGETS") != ""
+	
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Insert vectors
@@ -200,10 +203,10 @@ func TestPerformanceTargets(t *testing.T) {
 			t.Logf("  P99: %v", p99Latency)
 			t.Logf("  Target P99: %v", tc.targetP99)
 			
-			if p99Latency > tc.targetP99 {
+			if p99Latency > tc.targetP99 && enforceTargets {
+				t.Errorf("P99 latency %v exceeds target %v", p99Latency, tc.targetP99)
+			} else if p99Latency > tc.targetP99 {
 				t.Logf("WARNING: P99 latency %v exceeds target %v", p99Latency, tc.targetP99)
-				// Don't fail the test - this is informational for now
-				// In production, we'd fail here: t.Errorf("P99 latency %v exceeds target %v", p99Latency, tc.targetP99)
 			} else {
 				t.Logf("✓ P99 latency %v meets target %v", p99Latency, tc.targetP99)
 			}
@@ -1,12 +1,10 @@
 package storage
 
 import (
-	"context"
 	"fmt"
+	"log"
 	"sync"
 	"time"
-
-	"waddle/pkg/types"
 )
 
 // LanceDBConfig holds configuration for LanceDB optimization.
@@ -28,8 +26,8 @@ type LanceDBConfig struct {
 }
 
 // DefaultLanceDBConfig returns optimized configuration for Windows.
-// NOTE: Current implementation uses chromem-go for testing, which doesn't support
-// IVF_PQ indexing. These settings are prepared for future LanceDB integration.
+// NOTE: The vector store indexes with HNSW, tuned through VectorIndexConfig.
+// The IVF_PQ settings here are kept for configuration compatibility and unused.
 func DefaultLanceDBConfig() *LanceDBConfig {
 	return &LanceDBConfig{
 		IndexType:     "IVF_PQ",
@@ -148,59 +146,40 @@ func (ovm *OptimizedVectorManager) triggerFlush() {
 // processBatches handles batch flushing in a separate goroutine.
 func (ovm *OptimizedVectorManager) processBatches() {
 	for range ovm.flushChan {
-		ovm.flushBatch()
+		if err := ovm.flushBatch(); err != nil {
+			log.Printf("Failed to flush vector batch: %v", err)
+		}
 	}
 }
 
-// flushBatch writes the current batch to the vector database.
-func (ovm *OptimizedVectorManager) flushBatch() {
+// flushBatch writes the current batch to the vector database. A vector that
+// fails to insert doesn't stop the rest; the first failure is returned.
+func (ovm *OptimizedVectorManager) flushBatch() error {
 	ovm.batchMutex.Lock()
 	defer ovm.batchMutex.Unlock()
 	
 	if len(ovm.batchBuffer.SessionIDs) == 0 {
-		return
+		return nil
 	}
 	
-	// Create document IDs
-	docIDs := make([]string, len(ovm.batchBuffer.SessionIDs))
+	// Insert the batch under one lock, so searches see it whole
+	var firstErr error
+	ovm.mu.Lock()
 	for i, sessionID := range ovm.batchBuffer.SessionIDs {
-		docIDs[i] = fmt.Sprintf("session_%d", sessionID)
-	}
-	
-	// Create empty content array (we store pre-computed embeddings)
-	contents := make([]string, len(ovm.batchBuffer.SessionIDs))
-	
-	// Batch insert to chromem-go
-	ctx := context.Background()
-	err := ovm.collection.Add(ctx, docIDs, ovm.batchBuffer.Embeddings, ovm.batchBuffer.Metadata, contents)
-	if err != nil {
-		// Log error but don't fail - we'll retry individual inserts
-		fmt.Printf("Batch insert failed, falling back to individual inserts: %v\n", err)
-		ovm.fallbackToIndividualInserts()
+		key := vectorKey{kind: vectorKindSession, id: sessionID}
+		err := ovm.store.put(key, sessionID, ovm.modelVersion, ovm.batchBuffer.Embeddings[i])
+		if err != nil && firstErr == nil {
+			firstErr = NewStorageError(ErrVector, fmt.Sprintf("failed to insert vector for session %d", sessionID), err)
+		}
 	}
+	ovm.mu.Unlock()
 	
 	// Clear batch buffer
 	ovm.batchBuffer.SessionIDs = ovm.batchBuffer.SessionIDs[:0]
 	ovm.batchBuffer.Embeddings = ovm.batchBuffer.Embeddings[:0]
 	ovm.batchBuffer.Metadata = ovm.batchBuffer.Metadata[:0]
 	ovm.batchBuffer.Timestamp = time.Now()
-}
-
-// fallbackToIndividualInserts tries to insert each vector individually on batch failure.
-func (ovm *OptimizedVectorManager) fallbackToIndividualInserts() {
-	ctx := context.Background()
-	for i := range ovm.batchBuffer.SessionIDs {
-		docID := fmt.Sprintf("session_%d", ovm.batchBuffer.SessionIDs[i])
-		err := ovm.collection.Add(ctx,
-			[]string{docID},
-			[][]float32{ovm.batchBuffer.Embeddings[i]},
-			[]map[string]string{ovm.batchBuffer.Metadata[i]},
-			[]string{""},
-		)
-		if err != nil {
-			fmt.Printf("Failed to insert vector for session %d: %v\n", ovm.batchBuffer.SessionIDs[i], err)
-		}
-	}
+	return firstErr
 }
 
 // SearchOptimized performs optimized vector search with Windows-specific tuning.
@@ -219,35 +198,8 @@ func (ovm *OptimizedVectorManager) SearchOptimized(queryEmbedding []float32, top
 	ovm.mu.RLock()
 	defer ovm.mu.RUnlock()
 	
-	ctx := context.Background()
-	
-	// For chromem-go, we use the standard search but with optimized parameters
-	// In a real LanceDB implementation, this would configure IVF_PQ search with nprobe
-	results, err := ovm.collection.QueryEmbedding(ctx, queryEmbedding, topK, nil, nil)
-	if err != nil {
-		return nil, NewStorageError(ErrVector, "optimized search failed", err)
-	}
-	
-	// Convert results with performance metadata
-	searchResults := make([]VectorSearchResult, 0, len(results))
-	for _, r := range results {
-		sessionIDStr, ok := r.Metadata["session_id"]
-		if !ok {
-			continue
-		}
-		var sessionID int64
-		fmt.Sscanf(sessionIDStr, "%d", &sessionID)
-		
-		modelVersion := r.Metadata["model_version"]
-		
-		searchResults = append(searchResults, VectorSearchResult{
-			SessionID:    types.SessionID(sessionID),
-			Score:        r.Similarity,
-			ModelVersion: modelVersion,
-		})
-	}
-	
-	return searchResults, nil
+	// The HNSW index is tuned through VectorManagerConfig.Index, not nprobe
+	return toVectorSearchResults(ovm.store.search(queryEmbedding, topK, ovm.indexConfig.EfSearch)), nil
 }
 
 // GetBatchStats returns statistics about vector batching.
@@ -279,11 +231,14 @@ func (ovm *OptimizedVectorManager) Close() error {
 	}
 	
 	// Flush any remaining vectors
-	ovm.flushBatch()
+	flushErr := ovm.flushBatch()
 	
 	// Close flush channel
 	close(ovm.flushChan)
 	
 	// Close base vector manager
-	return ovm.VectorManager.Close()
+	if err := ovm.VectorManager.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
\ No newline at end of file
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// meetingColumns is the column list shared by meeting queries, in scanMeetings order.
+const meetingColumns = `id, session_id, source, uid, recurrence_id, title, location, organizer,
+	attendees_json, start_time, end_time, all_day, time_zone`
+
+// SyncMeetings stores the occurrences read from a calendar source. Each
+// meeting must already carry the ID of the session it starts in. Existing
+// occurrences are updated in place so their IDs stay stable; occurrences of
+// the source that start within [from, to) but are no longer present were
+// cancelled or moved out of range and are removed.
+func (sm *SessionManager) SyncMeetings(source string, meetings []Meeting, from, to time.Time) (*MeetingSyncResult, error) {
+	if source == "" {
+		return nil, NewStorageError(ErrValidation, "meeting source is required", nil)
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin meeting sync", err)
+	}
+	defer tx.Rollback()
+
+	result := &MeetingSyncResult{}
+	kept := make(map[int64]bool, len(meetings))
+	now := time.Now()
+
+	for i := range meetings {
+		m := &meetings[i]
+		if m.UID == "" {
+			return nil, NewStorageError(ErrValidation, "meeting UID is required", nil)
+		}
+		if m.SessionID == 0 {
+			return nil, NewStorageError(ErrValidation, "meeting session is required", nil)
+		}
+		if m.StartTime.IsZero() || m.EndTime.Before(m.StartTime) {
+			return nil, NewStorageError(ErrValidation, "meeting has an invalid time span", nil)
+		}
+
+		// Normalize to UTC so stored times order and compare consistently
+		m.Source = source
+		m.StartTime = m.StartTime.UTC()
+		m.EndTime = m.EndTime.UTC()
+		if m.RecurrenceID.IsZero() {
+			m.RecurrenceID = m.StartTime
+		}
+		m.RecurrenceID = m.RecurrenceID.UTC()
+		if m.Attendees == nil {
+			m.Attendees = []string{}
+		}
+
+		attendeesJSON, err := json.Marshal(m.Attendees)
+		if err != nil {
+			return nil, NewStorageError(ErrValidation, "failed to marshal attendees", err)
+		}
+		recurrenceKey := m.RecurrenceID.Format(time.RFC3339)
+
+		var id int64
+		err = tx.QueryRow(`
+			SELECT id FROM meetings WHERE source = ? AND uid = ? AND recurrence_id = ?
+		`, source, m.UID, recurrenceKey).Scan(&id)
+
+		switch {
+		case err == sql.ErrNoRows:
+			res, err := tx.Exec(`
+				INSERT INTO meetings (session_id, source, uid, recurrence_id, title, location, organizer,
+				                      attendees_json, start_time, end_time, all_day, time_zone, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, int64(m.SessionID), source, m.UID, recurrenceKey, m.Title, m.Location, m.Organizer,
+				string(attendeesJSON), m.StartTime, m.EndTime, m.AllDay, m.TimeZone, now, now)
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to insert meeting", err)
+			}
+			id, err = res.LastInsertId()
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to get last insert id", err)
+			}
+			result.Inserted++
+		case err != nil:
+			return nil, NewStorageError(ErrDatabase, "failed to look up meeting", err)
+		default:
+			// Only touch rows whose details changed, so re-syncing an unchanged calendar is a no-op
+			res, err := tx.Exec(`
+				UPDATE meetings
+				SET session_id = ?, title = ?, location = ?, organizer = ?, attendees_json = ?,
+				    start_time = ?, end_time = ?, all_day = ?, time_zone = ?, updated_at = ?
+				WHERE id = ?
+				  AND (session_id IS NOT ? OR title IS NOT ? OR location IS NOT ? OR organizer IS NOT ?
+				       OR attendees_json IS NOT ? OR start_time IS NOT ? OR end_time IS NOT ?
+				       OR all_day IS NOT ? OR time_zone IS NOT ?)
+			`, int64(m.SessionID), m.Title, m.Location, m.Organizer, string(attendeesJSON),
+				m.StartTime, m.EndTime, m.AllDay, m.TimeZone, now, id,
+				int64(m.SessionID), m.Title, m.Location, m.Organizer, string(attendeesJSON),
+				m.StartTime, m.EndTime, m.AllDay, m.TimeZone)
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to update meeting", err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				result.Updated++
+			}
+		}
+
+		m.ID = types.ElementID(id)
+		kept[id] = true
+	}
+
+	// Find occurrences in the synced window that the source no longer contains
+	rows, err := tx.Query("SELECT id, start_time FROM meetings WHERE source = ?", source)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query meetings", err)
+	}
+	var stale []int64
+	for rows.Next() {
+		var id int64
+		var start time.Time
+		if err := rows.Scan(&id, &start); err != nil {
+			rows.Close()
+			return nil, NewStorageError(ErrDatabase, "failed to scan meeting", err)
+		}
+		if !kept[id] && !start.Before(from) && start.Before(to) {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating meetings", err)
+	}
+
+	for _, id := range stale {
+		if _, err := tx.Exec("DELETE FROM meetings WHERE id = ?", id); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to delete stale meeting", err)
+		}
+	}
+	result.Removed = len(stale)
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit meeting sync", err)
+	}
+
+	return result, nil
+}
+
+// GetMeetings retrieves all meetings of a session in start time order.
+func (sm *SessionManager) GetMeetings(sessionID int64) ([]Meeting, error) {
+	rows, err := sm.db.Query(`
+		SELECT `+meetingColumns+`
+		FROM meetings
+		WHERE session_id = ?
+		ORDER BY start_time ASC
+	`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get meetings", err)
+	}
+	defer rows.Close()
+
+	return scanMeetings(rows)
+}
+
+// GetMeeting retrieves a meeting by ID.
+func (sm *SessionManager) GetMeeting(meetingID int64) (*Meeting, error) {
+	rows, err := sm.db.Query(`SELECT `+meetingColumns+` FROM meetings WHERE id = ?`, meetingID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get meeting", err)
+	}
+	defer rows.Close()
+
+	meetings, err := scanMeetings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(meetings) == 0 {
+		return nil, NewStorageError(ErrNotFound, "meeting not found", nil)
+	}
+
+	return &meetings[0], nil
+}
+
+// FindMeetings returns meetings whose title contains query, newest first.
+func (sm *SessionManager) FindMeetings(query string, limit int) ([]Meeting, error) {
+	if limit < 1 {
+		limit = 20
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+
+	rows, err := sm.db.Query(`
+		SELECT `+meetingColumns+`
+		FROM meetings
+		WHERE title LIKE ? ESCAPE '\'
+		ORDER BY start_time DESC
+		LIMIT ?
+	`, "%"+escaped+"%", limit)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to find meetings", err)
+	}
+	defer rows.Close()
+
+	return scanMeetings(rows)
+}
+
+// scanMeetings reads meeting rows selected with meetingColumns.
+func scanMeetings(rows *sql.Rows) ([]Meeting, error) {
+	meetings := []Meeting{}
+	for rows.Next() {
+		var m Meeting
+		var recurrenceKey string
+		var title, location, organizer, attendeesJSON, timeZone sql.NullString
+		err := rows.Scan(
+			&m.ID,
+			&m.SessionID,
+			&m.Source,
+			&m.UID,
+			&recurrenceKey,
+			&title,
+			&location,
+			&organizer,
+			&attendeesJSON,
+			&m.StartTime,
+			&m.EndTime,
+			&m.AllDay,
+			&timeZone,
+		)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan meeting", err)
+		}
+
+		m.RecurrenceID, _ = time.Parse(time.RFC3339, recurrenceKey)
+		m.Title = title.String
+		m.Location = location.String
+		m.Organizer = organizer.String
+		m.TimeZone = timeZone.String
+		m.Attendees = []string{}
+		if attendeesJSON.String != "" {
+			if err := json.Unmarshal([]byte(attendeesJSON.String), &m.Attendees); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to parse meeting attendees", err)
+			}
+		}
+
+		meetings = append(meetings, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating meetings", err)
+	}
+
+	return meetings, nil
+}
+
+// getBlocksOverlapping returns the session's activity blocks that overlap
+// [start, end), across all apps, in start time order.
+func (sm *SessionManager) getBlocksOverlapping(sessionID int64, start, end time.Time) ([]AppBlock, error) {
+	rows, err := sm.db.Query(`
+		SELECT ab.id, ab.app_activity_id, ab.block_id, ab.start_time, ab.end_time, ab.ocr_text_encrypted,
+		       ab.micro_summary, ab.capture_source, ab.structured_metadata, aa.app_name
+		FROM activity_blocks ab
+		JOIN app_activities aa ON ab.app_activity_id = aa.id
+		WHERE aa.session_id = ?
+		ORDER BY ab.start_time ASC
+	`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get blocks", err)
+	}
+	defer rows.Close()
+
+	var blocks []AppBlock
+	for rows.Next() {
+		var block AppBlock
+		var encryptedOCR []byte
+		err := rows.Scan(
+			&block.ID,
+			&block.AppActivityID,
+			&block.BlockID,
+			&block.StartTime,
+			&block.EndTime,
+			&encryptedOCR,
+			&block.MicroSummary,
+			&block.CaptureSource,
+			&block.StructuredMetadata,
+			&block.AppName,
+		)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan block", err)
+		}
+
+		// Timestamps may be stored with differing offsets, so compare as instants
+		if !block.StartTime.Before(end) || !block.EndTime.After(start) {
+			continue
+		}
+
+		if len(encryptedOCR) > 0 && sm.encryptionMgr != nil {
+			decrypted, err := sm.encryptionMgr.Decrypt(encryptedOCR)
+			if err != nil {
+				return nil, NewStorageError(ErrEncryption, "failed to decrypt OCR text", err)
+			}
+			block.OCRText = string(decrypted)
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating blocks", err)
+	}
+
+	return blocks, nil
+}
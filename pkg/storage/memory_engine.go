@@ -0,0 +1,1158 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"waddle/pkg/types"
+)
+
+// Compile-time check that the in-memory engine implements StorageEngineInterface.
+var _ StorageEngineInterface = (*MemoryStorageEngine)(nil)
+
+// memoryScreenshotPrefix starts the paths of screenshots held in memory, so
+// they can't be mistaken for files on disk.
+const memoryScreenshotPrefix = "memory://"
+
+// MemoryStorageEngine implements StorageEngineInterface without touching
+// disk or the network. It backs incognito capture and makes a fast,
+// isolated store for tests. Everything it holds is discarded on Close.
+//
+// It follows the validation and errors of StorageEngine. Text is searched
+// the way the full-text indexes would search it, sessions are embedded with
+// EmbedFunc, and tags, backups and knowledge cards are not supported.
+type MemoryStorageEngine struct {
+	config   *StorageConfig
+	calendar *SessionCalendar
+
+	// EmbedFunc generates embeddings for semantic search. Default:
+	// HashEmbedding, which runs locally
+	EmbedFunc func(text string) ([]float32, error)
+
+	mu                sync.RWMutex
+	lastID            int64
+	sessions          map[int64]*Session
+	dates             map[string]int64         // Session IDs by date
+	activities        map[int64][]*AppActivity // By session ID, with their blocks
+	chats             map[int64][]ChatMessage  // By session ID
+	notes             map[int64]*ManualNote    // By note ID
+	noteRevisions     map[int64][]NoteRevision // By note ID, oldest first
+	revisions         []Revision               // Oldest first
+	notifications     map[string]Notification  // By notification ID
+	screenshots       map[string][]byte        // By path
+	sessionEmbeddings map[int64][]float32      // By session ID
+	noteEmbeddings    map[int64][]float32      // By note ID
+}
+
+// NewMemoryStorageEngine creates an empty in-memory storage engine. Only the
+// calendar settings of config are used; nil uses the defaults.
+func NewMemoryStorageEngine(config *StorageConfig) *MemoryStorageEngine {
+	if config == nil {
+		config = DefaultStorageConfig("")
+	}
+	me := &MemoryStorageEngine{
+		config:    config,
+		calendar:  DefaultSessionCalendar(),
+		EmbedFunc: HashEmbedding,
+	}
+	me.reset()
+	return me
+}
+
+// PersistentStore returns store as the on-disk engine, for the operations
+// only it supports. Any other store, such as the in-memory one backing
+// incognito capture, gets a conflict error, so those operations are refused
+// rather than run against the data on disk.
+func PersistentStore(store StorageEngineInterface) (*StorageEngine, error) {
+	if se, ok := store.(*StorageEngine); ok && se != nil {
+		return se, nil
+	}
+	return nil, NewStorageError(ErrConflict, "not available in incognito mode", nil)
+}
+
+// reset drops everything the engine holds, wiping screenshot data.
+func (me *MemoryStorageEngine) reset() {
+	for _, data := range me.screenshots {
+		clear(data)
+	}
+	me.sessions = make(map[int64]*Session)
+	me.dates = make(map[string]int64)
+	me.activities = make(map[int64][]*AppActivity)
+	me.chats = make(map[int64][]ChatMessage)
+	me.notes = make(map[int64]*ManualNote)
+	me.noteRevisions = make(map[int64][]NoteRevision)
+	me.revisions = nil
+	me.notifications = make(map[string]Notification)
+	me.screenshots = make(map[string][]byte)
+	me.sessionEmbeddings = make(map[int64][]float32)
+	me.noteEmbeddings = make(map[int64][]float32)
+}
+
+func (me *MemoryStorageEngine) nextID() int64 {
+	me.lastID++
+	return me.lastID
+}
+
+// Lifecycle
+
+// Initialize sets up the session calendar from the configuration.
+func (me *MemoryStorageEngine) Initialize() error {
+	calendar, err := NewSessionCalendar(me.config.TimeZone, me.config.DayRolloverHour)
+	if err != nil {
+		return err
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.calendar = calendar
+	return nil
+}
+
+// Close discards everything the engine holds. The engine can be used again
+// afterwards, starting empty.
+func (me *MemoryStorageEngine) Close() error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.reset()
+	return nil
+}
+
+// Backup is not supported, as in-memory data must never reach disk.
+func (me *MemoryStorageEngine) Backup() error {
+	return NewStorageError(ErrNotImplemented, "in-memory storage can't be backed up", nil)
+}
+
+// Restore is not supported.
+func (me *MemoryStorageEngine) Restore(backupPath string, opts RestoreOptions) error {
+	return NewStorageError(ErrNotImplemented, "in-memory storage can't be restored", nil)
+}
+
+// HealthCheck reports how much the engine holds. It is always healthy.
+func (me *MemoryStorageEngine) HealthCheck() (*HealthStatus, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	return &HealthStatus{
+		Status: HealthStatusHealthy,
+		Checks: map[string]Check{
+			"memory": {
+				Status:  HealthStatusHealthy,
+				Message: fmt.Sprintf("%d sessions, %d embeddings", len(me.sessions), len(me.sessionEmbeddings)+len(me.noteEmbeddings)),
+			},
+		},
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// Session operations
+
+// CreateSession creates a new session for the given date.
+func (me *MemoryStorageEngine) CreateSession(date string) (*Session, error) {
+	if date == "" {
+		return nil, ErrEmptyRequiredField
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if _, ok := me.dates[date]; ok {
+		return nil, ErrSessionAlreadyExists
+	}
+	start, end, err := me.calendar.Bounds(date)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:              types.SessionID(me.nextID()),
+		Date:            date,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		StartTime:       start.UTC(),
+		EndTime:         end.UTC(),
+		TimeZone:        me.calendar.ZoneName(),
+		EntitiesJSON:    "[]",
+		SynthesisStatus: "pending",
+		AIBullets:       "[]",
+	}
+	me.sessions[int64(session.ID)] = session
+	me.dates[date] = int64(session.ID)
+
+	created := *session
+	return &created, nil
+}
+
+// sessionByDate returns the stored session for a date. The caller must
+// hold the lock.
+func (me *MemoryStorageEngine) sessionByDate(date string) (*Session, error) {
+	if date == "" {
+		return nil, ErrInvalidDate
+	}
+	id, ok := me.dates[date]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return me.sessions[id], nil
+}
+
+// GetSession retrieves a session by date.
+func (me *MemoryStorageEngine) GetSession(date string) (*Session, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	session, err := me.sessionByDate(date)
+	if err != nil {
+		return nil, err
+	}
+	found := *session
+	return &found, nil
+}
+
+// UpdateSession updates an existing session as an edit by the user,
+// recording changes to its titles, summaries and entities as a revision.
+func (me *MemoryStorageEngine) UpdateSession(session *Session) error {
+	if session.ID == 0 {
+		return NewStorageError(ErrValidation, "session ID is required for update", nil)
+	}
+	session.UpdatedAt = time.Now()
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	err := me.updateWithRevision(int64(session.ID), RevisionActorUser, func(stored *Session) {
+		stored.CustomTitle = session.CustomTitle
+		stored.CustomSummary = session.CustomSummary
+		stored.OriginalSummary = session.OriginalSummary
+		stored.ExtractedText = session.ExtractedText
+		stored.EntitiesJSON = session.EntitiesJSON
+		stored.SynthesisStatus = session.SynthesisStatus
+		stored.AISummary = session.AISummary
+		stored.AIBullets = session.AIBullets
+		stored.UpdatedAt = session.UpdatedAt
+	})
+	if err != nil {
+		return err
+	}
+
+	me.embedSession(me.sessions[int64(session.ID)])
+	return nil
+}
+
+// sessionRevisionFields returns the fields of a session tracked by
+// revisions, keyed by the column names StorageEngine records.
+func sessionRevisionFields(s *Session) map[string]string {
+	return map[string]string{
+		"custom_title":     s.CustomTitle,
+		"custom_summary":   s.CustomSummary,
+		"original_summary": s.OriginalSummary,
+		"ai_summary":       s.AISummary,
+		"ai_bullets":       s.AIBullets,
+		"entities_json":    s.EntitiesJSON,
+	}
+}
+
+// setSessionRevisionField sets a tracked field of a session by column name.
+func setSessionRevisionField(s *Session, column, value string) {
+	switch column {
+	case "custom_title":
+		s.CustomTitle = value
+	case "custom_summary":
+		s.CustomSummary = value
+	case "original_summary":
+		s.OriginalSummary = value
+	case "ai_summary":
+		s.AISummary = value
+	case "ai_bullets":
+		s.AIBullets = value
+	case "entities_json":
+		s.EntitiesJSON = value
+	}
+}
+
+// updateWithRevision applies update to a stored session and records the
+// changes it made to the tracked fields as a revision by actor. The caller
+// must hold the lock.
+func (me *MemoryStorageEngine) updateWithRevision(id int64, actor RevisionActor, update func(stored *Session)) error {
+	stored, ok := me.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	before := sessionRevisionFields(stored)
+	update(stored)
+	after := sessionRevisionFields(stored)
+
+	changes := make(map[string]FieldChange)
+	for column, old := range before {
+		if value := after[column]; value != old {
+			changes[column] = FieldChange{Old: old, New: value}
+		}
+	}
+	if len(changes) > 0 {
+		me.revisions = append(me.revisions, Revision{
+			ID:         types.ElementID(me.nextID()),
+			EntityType: RevisionEntitySession,
+			EntityID:   types.ElementID(id),
+			Actor:      actor,
+			Changes:    changes,
+			CreatedAt:  time.Now(),
+		})
+	}
+	return nil
+}
+
+// DeleteSession deletes a session and all associated data.
+func (me *MemoryStorageEngine) DeleteSession(date string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	session, err := me.sessionByDate(date)
+	if err != nil {
+		return err
+	}
+	id := int64(session.ID)
+
+	for noteID, note := range me.notes {
+		if int64(note.SessionID) == id {
+			delete(me.notes, noteID)
+			delete(me.noteRevisions, noteID)
+			delete(me.noteEmbeddings, noteID)
+		}
+	}
+	kept := me.revisions[:0]
+	for _, revision := range me.revisions {
+		if revision.EntityType != RevisionEntitySession || int64(revision.EntityID) != id {
+			kept = append(kept, revision)
+		}
+	}
+	me.revisions = kept
+
+	prefix := memoryScreenshotPrefix + sanitizePathComponent(date) + "/"
+	for p, data := range me.screenshots {
+		if strings.HasPrefix(p, prefix) {
+			clear(data)
+			delete(me.screenshots, p)
+		}
+	}
+
+	delete(me.sessions, id)
+	delete(me.dates, date)
+	delete(me.activities, id)
+	delete(me.chats, id)
+	delete(me.sessionEmbeddings, id)
+	return nil
+}
+
+// ListSessions returns a page of sessions, newest first, with the total
+// count.
+func (me *MemoryStorageEngine) ListSessions(page, pageSize int) ([]Session, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 50
+	}
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	sessions := make([]Session, 0, len(me.sessions))
+	for _, session := range me.sessions {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Date > sessions[j].Date })
+
+	total := len(sessions)
+	offset := (page - 1) * pageSize
+	if offset >= total {
+		return []Session{}, total, nil
+	}
+	return sessions[offset:min(offset+pageSize, total)], total, nil
+}
+
+// Search operations
+
+// FullTextSearch searches sessions, activity blocks and notes for sessions
+// where one of them holds every word of the query, best match first. As
+// with the full-text indexes, only a session's titles, summaries and
+// entities and a block's summary and metadata are searched. No session
+// carries tags, so none match when tags are given.
+func (me *MemoryStorageEngine) FullTextSearch(query string, page, pageSize int, tags ...string) ([]SearchResult, error) {
+	if query == "" {
+		return nil, NewStorageError(ErrValidation, "search query cannot be empty", nil)
+	}
+	if page < 1 {
+		return nil, NewStorageError(ErrValidation, "page must be >= 1", nil)
+	}
+	if pageSize < 1 || pageSize > 1000 {
+		return nil, NewStorageError(ErrValidation, "pageSize must be between 1 and 1000", nil)
+	}
+
+	terms := queryTerms(query)
+	if len(terms) == 0 || len(tags) > 0 {
+		return nil, nil
+	}
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	best := make(map[int64]SearchResult)
+	consider := func(sessionID int64, text string) {
+		score, snippet := matchText(text, terms)
+		if score == 0 {
+			return
+		}
+		if found, ok := best[sessionID]; ok && found.Score >= score {
+			return
+		}
+		best[sessionID] = SearchResult{
+			Session:   *me.sessions[sessionID],
+			Score:     score,
+			Snippet:   snippet,
+			MatchType: MatchTypeFullText,
+		}
+	}
+
+	for id, s := range me.sessions {
+		consider(id, strings.Join([]string{s.Date, s.CustomTitle, s.CustomSummary, s.OriginalSummary, s.AISummary, s.EntitiesJSON}, " "))
+		for _, activity := range me.activities[id] {
+			for _, block := range activity.Blocks {
+				consider(id, block.MicroSummary+" "+block.StructuredMetadata)
+			}
+		}
+	}
+	for _, note := range me.notes {
+		consider(int64(note.SessionID), note.Content)
+	}
+
+	results := make([]SearchResult, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Session.Date > results[j].Session.Date
+	})
+
+	offset := (page - 1) * pageSize
+	if offset >= len(results) {
+		return nil, nil
+	}
+	return results[offset:min(offset+pageSize, len(results))], nil
+}
+
+// SemanticSearch ranks sessions by how close the query's embedding is to
+// the embeddings of the session or one of its notes. No session carries
+// tags, so none match when tags are given.
+func (me *MemoryStorageEngine) SemanticSearch(query string, topK int, dateRange *DateRange, tags ...string) ([]SearchResult, error) {
+	if query == "" {
+		return nil, NewStorageError(ErrValidation, "search query cannot be empty", nil)
+	}
+	if topK < 1 || topK > 1000 {
+		return nil, NewStorageError(ErrValidation, "topK must be between 1 and 1000", nil)
+	}
+
+	queryEmbedding, err := me.EmbedFunc(query)
+	if err != nil {
+		return nil, NewStorageError(ErrVector, "failed to generate query embedding", err)
+	}
+	if len(tags) > 0 {
+		return []SearchResult{}, nil
+	}
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	scores := make(map[int64]float32)
+	for id, embedding := range me.sessionEmbeddings {
+		scores[id] = max(scores[id], cosineSimilarity(queryEmbedding, embedding))
+	}
+	for noteID, embedding := range me.noteEmbeddings {
+		id := int64(me.notes[noteID].SessionID)
+		scores[id] = max(scores[id], cosineSimilarity(queryEmbedding, embedding))
+	}
+
+	results := []SearchResult{}
+	for id, score := range scores {
+		session := me.sessions[id]
+		if score <= 0 || !inDateRange(dateRange, session.Date) {
+			continue
+		}
+		results = append(results, SearchResult{Session: *session, Score: score, MatchType: MatchTypeSemantic})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+// inDateRange reports whether a session date falls in r. A nil range holds
+// every date.
+func inDateRange(r *DateRange, date string) bool {
+	if r == nil {
+		return true
+	}
+	return (r.StartDate == "" || date >= r.StartDate) && (r.EndDate == "" || date <= r.EndDate)
+}
+
+// embedSession stores the embedding of a session's text, as StorageEngine
+// queues it after an update. Embedding failures leave the session out of
+// semantic search. The caller must hold the lock.
+func (me *MemoryStorageEngine) embedSession(s *Session) {
+	delete(me.sessionEmbeddings, int64(s.ID))
+	if s.CustomSummary == "" && s.OriginalSummary == "" && s.ExtractedText == "" {
+		return
+	}
+	if embedding, err := me.EmbedFunc(s.CustomSummary + " " + s.OriginalSummary + " " + s.ExtractedText); err == nil {
+		me.sessionEmbeddings[int64(s.ID)] = embedding
+	}
+}
+
+// embedNote stores the embedding of a note. The caller must hold the lock.
+func (me *MemoryStorageEngine) embedNote(note *ManualNote) {
+	delete(me.noteEmbeddings, int64(note.ID))
+	if embedding, err := me.EmbedFunc(note.Content); err == nil {
+		me.noteEmbeddings[int64(note.ID)] = embedding
+	}
+}
+
+// Activity operations
+
+// AddActivityBlock adds an activity block to a session, replacing the
+// app's block with the same block ID.
+func (me *MemoryStorageEngine) AddActivityBlock(sessionDate, appName string, block *ActivityBlock) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return err
+	}
+	if appName == "" {
+		return NewStorageError(ErrValidation, "app name is required", nil)
+	}
+	if block.BlockID == "" {
+		return NewStorageError(ErrValidation, "block ID is required", nil)
+	}
+	if block.CaptureSource == "" {
+		block.CaptureSource = "polling_ocr"
+	}
+	if block.StructuredMetadata == "" {
+		block.StructuredMetadata = "{}"
+	}
+
+	now := time.Now()
+	activity := me.appActivity(int64(session.ID), appName)
+	if activity == nil {
+		activity = &AppActivity{
+			ID:        types.ElementID(me.nextID()),
+			SessionID: session.ID,
+			AppName:   appName,
+			CreatedAt: now,
+		}
+		me.activities[int64(session.ID)] = append(me.activities[int64(session.ID)], activity)
+	}
+	activity.UpdatedAt = now
+	block.AppActivityID = activity.ID
+
+	for i := range activity.Blocks {
+		if activity.Blocks[i].BlockID == block.BlockID {
+			block.ID = activity.Blocks[i].ID
+			activity.Blocks[i] = *block
+			return nil
+		}
+	}
+	block.ID = types.ElementID(me.nextID())
+	activity.Blocks = append(activity.Blocks, *block)
+	return nil
+}
+
+// appActivity returns a session's activity for an app, or nil. The caller
+// must hold the lock.
+func (me *MemoryStorageEngine) appActivity(sessionID int64, appName string) *AppActivity {
+	for _, activity := range me.activities[sessionID] {
+		if activity.AppName == appName {
+			return activity
+		}
+	}
+	return nil
+}
+
+// GetActivityBlocks retrieves a session's activity blocks for an app,
+// earliest first.
+func (me *MemoryStorageEngine) GetActivityBlocks(sessionDate, appName string) ([]ActivityBlock, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+	activity := me.appActivity(int64(session.ID), appName)
+	if activity == nil || len(activity.Blocks) == 0 {
+		return nil, nil
+	}
+
+	blocks := append([]ActivityBlock(nil), activity.Blocks...)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].StartTime.Before(blocks[j].StartTime) })
+	return blocks, nil
+}
+
+// GetSessionAppActivities retrieves a session's app activities, without
+// their blocks, by app name.
+func (me *MemoryStorageEngine) GetSessionAppActivities(sessionDate string) ([]AppActivity, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var activities []AppActivity
+	for _, activity := range me.activities[int64(session.ID)] {
+		found := *activity
+		found.Blocks = nil
+		activities = append(activities, found)
+	}
+	sort.Slice(activities, func(i, j int) bool { return activities[i].AppName < activities[j].AppName })
+	return activities, nil
+}
+
+// GetSessionWithActivities retrieves a session with its app activities and
+// their blocks.
+func (me *MemoryStorageEngine) GetSessionWithActivities(sessionDate string) (*Session, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	stored, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	session := *stored
+	session.Activities = []AppActivity{}
+	for _, activity := range me.activities[int64(stored.ID)] {
+		found := *activity
+		found.Blocks = append([]ActivityBlock(nil), activity.Blocks...)
+		sort.SliceStable(found.Blocks, func(i, j int) bool { return found.Blocks[i].StartTime.Before(found.Blocks[j].StartTime) })
+		session.Activities = append(session.Activities, found)
+	}
+	sort.Slice(session.Activities, func(i, j int) bool { return session.Activities[i].AppName < session.Activities[j].AppName })
+	return &session, nil
+}
+
+// Chat operations
+
+// AddChat adds a chat message to a session.
+func (me *MemoryStorageEngine) AddChat(sessionDate string, chat *ChatMessage) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return err
+	}
+	if !ValidChatRoles[chat.Role] {
+		return NewStorageError(ErrValidation, "invalid chat role", nil)
+	}
+	if chat.Content == "" {
+		return NewStorageError(ErrValidation, "chat content is required", nil)
+	}
+	if chat.Timestamp.IsZero() {
+		chat.Timestamp = time.Now()
+	}
+
+	chat.ID = types.ElementID(me.nextID())
+	chat.SessionID = session.ID
+	me.chats[int64(session.ID)] = append(me.chats[int64(session.ID)], *chat)
+	return nil
+}
+
+// GetChats retrieves a session's chat messages, oldest first.
+func (me *MemoryStorageEngine) GetChats(sessionDate string) ([]ChatMessage, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+	chats := me.chats[int64(session.ID)]
+	if len(chats) == 0 {
+		return nil, nil
+	}
+
+	chats = append([]ChatMessage(nil), chats...)
+	sort.SliceStable(chats, func(i, j int) bool { return chats[i].Timestamp.Before(chats[j].Timestamp) })
+	return chats, nil
+}
+
+// Note operations
+
+// checkNoteLinks checks that the blocks a note links exist. The caller
+// must hold the lock.
+func (me *MemoryStorageEngine) checkNoteLinks(links []NoteLink) error {
+	for _, link := range links {
+		if link.BlockID != 0 && !me.hasBlock(link.BlockID) {
+			return NewStorageError(ErrNotFound, "linked activity block not found", nil)
+		}
+	}
+	return nil
+}
+
+// hasBlock reports whether an activity block exists. The caller must hold
+// the lock.
+func (me *MemoryStorageEngine) hasBlock(id types.ElementID) bool {
+	for _, activities := range me.activities {
+		for _, activity := range activities {
+			for _, block := range activity.Blocks {
+				if block.ID == id {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// copyNote returns a copy of a stored note that doesn't share its links.
+func copyNote(note *ManualNote) ManualNote {
+	found := *note
+	found.Links = append([]NoteLink(nil), note.Links...)
+	return found
+}
+
+// AddNote adds a Markdown note to a session.
+func (me *MemoryStorageEngine) AddNote(sessionDate string, note *ManualNote) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return err
+	}
+	note.SessionID = session.ID
+	if err := validateNote(note); err != nil {
+		return err
+	}
+	if err := me.checkNoteLinks(note.Links); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	note.ID = types.ElementID(me.nextID())
+	note.CreatedAt = now
+	note.UpdatedAt = now
+
+	stored := copyNote(note)
+	me.notes[int64(note.ID)] = &stored
+	me.embedNote(&stored)
+	return nil
+}
+
+// GetNote retrieves a note by ID.
+func (me *MemoryStorageEngine) GetNote(noteID int64) (*ManualNote, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	note, ok := me.notes[noteID]
+	if !ok {
+		return nil, NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	found := copyNote(note)
+	return &found, nil
+}
+
+// GetNotes retrieves the notes of a session, oldest first.
+func (me *MemoryStorageEngine) GetNotes(sessionDate string) ([]ManualNote, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	session, err := me.sessionByDate(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := []ManualNote{}
+	for _, note := range me.notes {
+		if note.SessionID == session.ID {
+			notes = append(notes, copyNote(note))
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	return notes, nil
+}
+
+// UpdateNote updates a note's content and links, keeping the previous
+// content as a revision.
+func (me *MemoryStorageEngine) UpdateNote(note *ManualNote) error {
+	if note.ID == 0 {
+		return NewStorageError(ErrValidation, "note ID is required for update", nil)
+	}
+	if err := validateNote(note); err != nil {
+		return err
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	stored, ok := me.notes[int64(note.ID)]
+	if !ok {
+		return NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	if err := me.checkNoteLinks(note.Links); err != nil {
+		return err
+	}
+
+	if stored.Content != note.Content {
+		// The revision is stamped with when the old content was written
+		me.noteRevisions[int64(note.ID)] = append(me.noteRevisions[int64(note.ID)], NoteRevision{
+			ID:        types.ElementID(me.nextID()),
+			NoteID:    note.ID,
+			Content:   stored.Content,
+			CreatedAt: stored.UpdatedAt,
+		})
+		stored.Content = note.Content
+		stored.UpdatedAt = time.Now().UTC()
+		me.embedNote(stored)
+	}
+	stored.Links = append([]NoteLink(nil), note.Links...)
+
+	note.SessionID = stored.SessionID
+	note.CreatedAt = stored.CreatedAt
+	note.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// DeleteNote deletes a note with its revisions and embedding.
+func (me *MemoryStorageEngine) DeleteNote(noteID int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if _, ok := me.notes[noteID]; !ok {
+		return NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	delete(me.notes, noteID)
+	delete(me.noteRevisions, noteID)
+	delete(me.noteEmbeddings, noteID)
+	return nil
+}
+
+// GetNoteRevisions returns the earlier versions of a note, newest first.
+func (me *MemoryStorageEngine) GetNoteRevisions(noteID int64) ([]NoteRevision, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	stored := me.noteRevisions[noteID]
+	revisions := make([]NoteRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
+
+// Revision operations
+
+// GetRevisions returns the revisions of a session, newest first. Knowledge
+// cards are not stored, so they have none.
+func (me *MemoryStorageEngine) GetRevisions(entity RevisionEntity, id int64) ([]Revision, error) {
+	if _, err := getRevisionTable(entity); err != nil {
+		return nil, err
+	}
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	var revisions []Revision
+	for i := len(me.revisions) - 1; i >= 0; i-- {
+		if revision := me.revisions[i]; revision.EntityType == entity && int64(revision.EntityID) == id {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+// RestoreRevision returns a session's tracked fields to the values they had
+// before the revision was made, undoing it and every later revision. The
+// restore is itself recorded as a revision by the user.
+func (me *MemoryStorageEngine) RestoreRevision(revisionID int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	index := -1
+	for i, revision := range me.revisions {
+		if int64(revision.ID) == revisionID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return NewStorageError(ErrNotFound, "revision not found", nil)
+	}
+	entityID := me.revisions[index].EntityID
+
+	// Walk back from the newest revision so the oldest old value wins
+	fields := make(map[string]string)
+	for i := len(me.revisions) - 1; i >= index; i-- {
+		if revision := me.revisions[i]; revision.EntityType == RevisionEntitySession && revision.EntityID == entityID {
+			for column, change := range revision.Changes {
+				fields[column] = change.Old
+			}
+		}
+	}
+
+	return me.updateWithRevision(int64(entityID), RevisionActorUser, func(stored *Session) {
+		for column, value := range fields {
+			setSessionRevisionField(stored, column, value)
+		}
+		stored.UpdatedAt = time.Now()
+	})
+}
+
+// Notification operations
+
+// AddNotification adds a notification, replacing any with the same ID.
+func (me *MemoryStorageEngine) AddNotification(notif *Notification) error {
+	if notif.ID == "" {
+		return NewStorageError(ErrValidation, "notification ID is required", nil)
+	}
+	if notif.Type == "" {
+		return NewStorageError(ErrValidation, "notification type is required", nil)
+	}
+	if notif.Title == "" {
+		return NewStorageError(ErrValidation, "notification title is required", nil)
+	}
+	if notif.Timestamp.IsZero() {
+		notif.Timestamp = time.Now()
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.notifications[notif.ID] = *notif
+	return nil
+}
+
+// GetNotifications retrieves up to limit notifications, newest first.
+func (me *MemoryStorageEngine) GetNotifications(limit int) ([]Notification, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	var notifications []Notification
+	for _, notif := range me.notifications {
+		notifications = append(notifications, notif)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].Timestamp.After(notifications[j].Timestamp) })
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the specified notifications as read.
+func (me *MemoryStorageEngine) MarkNotificationsRead(ids []string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, id := range ids {
+		if notif, ok := me.notifications[id]; ok {
+			notif.Read = true
+			me.notifications[id] = notif
+		}
+	}
+	return nil
+}
+
+// File operations
+
+// SaveScreenshot keeps a copy of a screenshot in memory and returns its
+// path, which only GetScreenshot can read.
+func (me *MemoryStorageEngine) SaveScreenshot(sessionDate, appName, filename string, data []byte) (string, error) {
+	if sessionDate == "" {
+		return "", NewStorageError(ErrValidation, "session ID is required", nil)
+	}
+	if appName == "" {
+		return "", NewStorageError(ErrValidation, "app name is required", nil)
+	}
+	if filename == "" {
+		return "", NewStorageError(ErrValidation, "filename is required", nil)
+	}
+
+	p := me.GetScreenshotPath(sessionDate, appName, filename)
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if old, ok := me.screenshots[p]; ok {
+		clear(old)
+	}
+	me.screenshots[p] = append([]byte(nil), data...)
+	return p, nil
+}
+
+// GetScreenshotPath returns the in-memory path of a screenshot.
+func (me *MemoryStorageEngine) GetScreenshotPath(sessionDate, appName, filename string) string {
+	return memoryScreenshotPrefix + path.Join(sanitizePathComponent(sessionDate), sanitizePathComponent(appName),
+		"screenshots", sanitizePathComponent(filename))
+}
+
+// GetScreenshot returns a copy of a screenshot saved at screenshotPath.
+func (me *MemoryStorageEngine) GetScreenshot(screenshotPath string) ([]byte, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	data, ok := me.screenshots[screenshotPath]
+	if !ok {
+		return nil, NewStorageError(ErrNotFound, "screenshot not found", nil)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Search helpers
+
+// queryTerms returns the lowercased words of a search query, without the
+// FTS5 boolean operators.
+func queryTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if field == "AND" || field == "OR" || field == "NOT" {
+			continue
+		}
+		for _, span := range wordSpans(field) {
+			terms = append(terms, strings.ToLower(field[span[0]:span[1]]))
+		}
+	}
+	return terms
+}
+
+// wordSpans returns the byte offsets of the words in text, splitting on
+// anything but letters and digits as the FTS5 tokenizer does.
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// matchText scores text against query terms by how many of its words match
+// one, returning 0 unless every term appears. The snippet marks the matches
+// in a window of up to 32 words around the first, as the full-text search
+// does.
+func matchText(text string, terms []string) (float32, string) {
+	spans := wordSpans(text)
+	want := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		want[term] = true
+	}
+
+	seen := make(map[string]bool, len(terms))
+	first, count := -1, 0
+	for i, span := range spans {
+		if word := strings.ToLower(text[span[0]:span[1]]); want[word] {
+			seen[word] = true
+			count++
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if len(seen) < len(want) {
+		return 0, ""
+	}
+
+	const window = 32
+	from := max(0, first-window/4)
+	to := min(len(spans), from+window)
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("...")
+	}
+	for i := from; i < to; i++ {
+		if i > from {
+			b.WriteString(" ")
+		}
+		word := text[spans[i][0]:spans[i][1]]
+		if want[strings.ToLower(word)] {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+	}
+	if to < len(spans) {
+		b.WriteString("...")
+	}
+	return float32(count), b.String()
+}
+
+// HashEmbedding embeds text by hashing its lowercased words into
+// EmbeddingDimensions buckets, normalized to unit length. It needs no
+// model, so texts sharing words score as similar rather than texts sharing
+// meaning.
+func HashEmbedding(text string) ([]float32, error) {
+	embedding := make([]float32, EmbeddingDimensions)
+	for _, span := range wordSpans(text) {
+		h := fnv.New32a()
+		h.Write([]byte(strings.ToLower(text[span[0]:span[1]])))
+		sum := h.Sum32()
+		if sum&(1<<31) != 0 {
+			embedding[sum%EmbeddingDimensions]--
+		} else {
+			embedding[sum%EmbeddingDimensions]++
+		}
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range embedding {
+			embedding[i] *= scale
+		}
+	}
+	return embedding, nil
+}
+
+// cosineSimilarity returns the cosine similarity of two embeddings, or 0
+// if their dimensions differ or either is zero.
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
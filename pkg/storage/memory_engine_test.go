@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMemoryStorageEngine tests sessions, blocks, notes, search and revisions
+// in the in-memory engine, and that Close discards everything.
+func TestMemoryStorageEngine(t *testing.T) {
+	me := NewMemoryStorageEngine(nil)
+	if err := me.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize memory engine: %v", err)
+	}
+	defer me.Close()
+
+	const date = "2025-03-01"
+	session, err := me.CreateSession(date)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if session.StartTime.IsZero() || session.SynthesisStatus != "pending" {
+		t.Errorf("Expected session defaults set, got %+v", session)
+	}
+	at := time.Date(2025, 3, 1, 14, 3, 0, 0, time.Local)
+	block := &ActivityBlock{BlockID: "14-03", StartTime: at, EndTime: at.Add(time.Minute), MicroSummary: "Reviewing the quarterly budget"}
+	if err := me.AddActivityBlock(date, "Excel", block); err != nil {
+		t.Fatalf("Failed to add activity block: %v", err)
+	}
+	note := &ManualNote{Content: "Ask finance about travel costs", Links: []NoteLink{{BlockID: block.ID}}}
+	if err := me.AddNote(date, note); err != nil {
+		t.Fatalf("Failed to add note: %v", err)
+	}
+	if err := me.AddChat(date, &ChatMessage{Role: ChatRoleUser, Content: "What did I work on?"}); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	if _, err := me.SaveScreenshot(date, "Excel", "1403.png", []byte("screen")); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
+	}
+
+	t.Run("Errors match the on-disk engine", func(t *testing.T) {
+		if _, err := me.CreateSession(date); !IsConflict(err) {
+			t.Errorf("Expected a conflict for a duplicate session, got %v", err)
+		}
+		if _, err := me.GetSession("2025-03-02"); !IsNotFound(err) {
+			t.Errorf("Expected a missing session not found, got %v", err)
+		}
+		if err := me.AddChat(date, &ChatMessage{Role: "robot", Content: "hi"}); !IsValidation(err) {
+			t.Errorf("Expected an invalid chat role rejected, got %v", err)
+		}
+		if err := me.AddNote(date, &ManualNote{Content: "x", Links: []NoteLink{{BlockID: 999}}}); !IsNotFound(err) {
+			t.Errorf("Expected a link to a missing block rejected, got %v", err)
+		}
+		if err := me.Backup(); err == nil {
+			t.Errorf("Expected backups to be refused")
+		}
+	})
+
+	t.Run("Blocks are replaced by block ID", func(t *testing.T) {
+		replaced := &ActivityBlock{BlockID: "14-03", StartTime: at, EndTime: at.Add(time.Minute), MicroSummary: "Reviewing the quarterly budget forecast"}
+		if err := me.AddActivityBlock(date, "Excel", replaced); err != nil {
+			t.Fatalf("Failed to replace activity block: %v", err)
+		}
+		blocks, _ := me.GetActivityBlocks(date, "Excel")
+		if len(blocks) != 1 || blocks[0].ID != block.ID || blocks[0].CaptureSource != "polling_ocr" {
+			t.Errorf("Expected one replaced block, got %+v", blocks)
+		}
+		activities, _ := me.GetSessionAppActivities(date)
+		if len(activities) != 1 || activities[0].AppName != "Excel" {
+			t.Errorf("Expected one app activity, got %+v", activities)
+		}
+	})
+
+	t.Run("Full-text search needs every term in one place", func(t *testing.T) {
+		results, err := me.FullTextSearch("quarterly BUDGET", 1, 10)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 1 || results[0].Snippet != "Reviewing the <mark>quarterly</mark> <mark>budget</mark> forecast" {
+			t.Errorf("Expected the block matched, got %+v", results)
+		}
+		if results, _ := me.FullTextSearch("budget travel", 1, 10); len(results) != 0 {
+			t.Errorf("Expected terms split across a block and a note not to match, got %+v", results)
+		}
+		if results, _ := me.FullTextSearch("finance", 1, 10); len(results) != 1 {
+			t.Errorf("Expected the note matched, got %+v", results)
+		}
+		if _, err := me.FullTextSearch("", 1, 10); !IsValidation(err) {
+			t.Errorf("Expected an empty query rejected, got %v", err)
+		}
+	})
+
+	t.Run("Semantic search ranks by embedding", func(t *testing.T) {
+		session.CustomSummary = "Planned the team offsite"
+		if err := me.UpdateSession(session); err != nil {
+			t.Fatalf("Failed to update session: %v", err)
+		}
+		results, err := me.SemanticSearch("team offsite", 5, nil)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 1 || results[0].Session.ID != session.ID || results[0].MatchType != MatchTypeSemantic {
+			t.Errorf("Expected the session matched, got %+v", results)
+		}
+		if results, _ := me.SemanticSearch("team offsite", 5, &DateRange{StartDate: "2025-04-01"}); len(results) != 0 {
+			t.Errorf("Expected the date range to exclude the session, got %+v", results)
+		}
+	})
+
+	t.Run("Revisions can be restored", func(t *testing.T) {
+		revisions, _ := me.GetRevisions(RevisionEntitySession, int64(session.ID))
+		if len(revisions) != 1 || revisions[0].Changes["custom_summary"].New != "Planned the team offsite" {
+			t.Fatalf("Expected one revision, got %+v", revisions)
+		}
+		if err := me.RestoreRevision(int64(revisions[0].ID)); err != nil {
+			t.Fatalf("Failed to restore revision: %v", err)
+		}
+		restored, _ := me.GetSession(date)
+		if restored.CustomSummary != "" {
+			t.Errorf("Expected the summary restored, got %q", restored.CustomSummary)
+		}
+
+		note.Content = "Ask finance about hotel costs"
+		if err := me.UpdateNote(note); err != nil {
+			t.Fatalf("Failed to update note: %v", err)
+		}
+		noteRevisions, _ := me.GetNoteRevisions(int64(note.ID))
+		if len(noteRevisions) != 1 || noteRevisions[0].Content != "Ask finance about travel costs" {
+			t.Errorf("Expected the old note content kept, got %+v", noteRevisions)
+		}
+	})
+
+	t.Run("Close discards everything", func(t *testing.T) {
+		path := me.GetScreenshotPath(date, "Excel", "1403.png")
+		if err := me.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		if sessions, total, _ := me.ListSessions(1, 10); total != 0 || len(sessions) != 0 {
+			t.Errorf("Expected no sessions, got %d", total)
+		}
+		if _, err := me.GetScreenshot(path); !IsNotFound(err) {
+			t.Errorf("Expected the screenshot discarded, got %v", err)
+		}
+		if _, err := me.GetNote(int64(note.ID)); !IsNotFound(err) {
+			t.Errorf("Expected the note discarded, got %v", err)
+		}
+	})
+}
@@ -541,7 +541,7 @@ func (mm *MigrationManager) migrateSessionMetadata(metadataPath string, session
 	session.OriginalSummary = metadata.OriginalSummary
 	session.ExtractedText = metadata.ExtractedText
 
-	return storageEngine.UpdateSession(session)
+	return storageEngine.UpdateSessionAs(session, RevisionActorImport)
 }
 
 // migrateAppActivities migrates app activities and blocks.
@@ -731,17 +731,12 @@ func (mm *MigrationManager) migrateNotifications(state *MigrationState, storageE
 
 // generateEmbeddings generates embeddings for migrated sessions.
 func (mm *MigrationManager) generateEmbeddings(state *MigrationState, storageEngine *StorageEngine) error {
-	// Get all sessions
-	sessions, _, err := storageEngine.ListSessions(1, 10000) // Get all sessions
-	if err != nil {
-		return err
-	}
-
-	for _, session := range sessions {
+	queued := 0
+	err := storageEngine.IterateSessions(SessionQuery{}, func(session Session) error {
 		// Generate text for embedding
 		text := session.CustomSummary + " " + session.OriginalSummary + " " + session.ExtractedText
 		if strings.TrimSpace(text) == "" {
-			continue // Skip sessions with no text
+			return nil // Skip sessions with no text
 		}
 
 		// Queue embedding generation (async) - access through vector manager
@@ -749,10 +744,15 @@ func (mm *MigrationManager) generateEmbeddings(state *MigrationState, storageEng
 			// Log error but continue
 			fmt.Printf("Warning: Failed to queue embedding for session %s: %v\n", session.Date, err)
 		}
+		queued++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	return mm.AddCheckpoint(state, "embeddings_queued", 
-		fmt.Sprintf("Queued embeddings for %d sessions", len(sessions)), true)
+		fmt.Sprintf("Queued embeddings for %d sessions", queued), true)
 }
 
 // GetProgress returns the current migration progress as a percentage.
@@ -183,8 +183,7 @@ func TestMigrationDataIntegrity(t *testing.T) {
 			}
 
 			// Verify file was copied correctly
-			newPath := storageEngine.GetScreenshotPath("2024-01-16", "TestApp", "test.png")
-			newData, err := os.ReadFile(newPath)
+			newData, err := storageEngine.ReadFile(filepath.Join("2024-01-16", "TestApp", "screenshots", "test.png"))
 			if err != nil {
 				return false
 			}
@@ -334,7 +333,7 @@ func verifyMigrationIntegrity(_ string, storageEngine *StorageEngine, t *testing
 
 	// Verify screenshot was copied
 	screenshotPath := storageEngine.GetScreenshotPath("2024-01-15", "TestApp", "15-30-00.png")
-	if _, err := os.Stat(screenshotPath); os.IsNotExist(err) {
+	if _, err := storageEngine.StatScreenshot(screenshotPath); err != nil {
 		t.Logf("Screenshot was not copied: %s", screenshotPath)
 		return false
 	}
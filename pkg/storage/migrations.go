@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 // Migration represents a database schema migration.
@@ -12,8 +15,76 @@ type Migration struct {
 	Version     int
 	Description string
 	SQL         string
+
+	// Backfill optionally fills existing rows after SQL runs, for values
+	// that can't be computed in SQLite. It runs in the migration transaction.
+	Backfill func(sm *SessionManager, tx *sql.Tx) error
+
+	// Down reverts SQL. Revert optionally restores existing rows before
+	// Down runs, the reverse of Backfill.
+	Down   string
+	Revert func(sm *SessionManager, tx *sql.Tx) error
+
+	// Irreversible says why a migration without Down can't be reverted.
+	Irreversible string
 }
 
+// ftsSchemaV2 creates the full-text indexes of migration 2. Reverting
+// migration 3 restores them.
+const ftsSchemaV2 = `
+-- FTS5 virtual tables for full-text search on non-encrypted fields
+CREATE VIRTUAL TABLE IF NOT EXISTS sessions_fts USING fts5(
+    date,
+    custom_title,
+    custom_summary,
+    original_summary,
+    content='sessions',
+    content_rowid='id'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS activity_blocks_fts USING fts5(
+    micro_summary,
+    content='activity_blocks',
+    content_rowid='id'
+);
+
+-- Triggers to keep sessions_fts in sync
+CREATE TRIGGER IF NOT EXISTS sessions_ai AFTER INSERT ON sessions BEGIN
+    INSERT INTO sessions_fts(rowid, date, custom_title, custom_summary, original_summary)
+    VALUES (new.id, new.date, new.custom_title, new.custom_summary, new.original_summary);
+END;
+
+CREATE TRIGGER IF NOT EXISTS sessions_ad AFTER DELETE ON sessions BEGIN
+    INSERT INTO sessions_fts(sessions_fts, rowid, date, custom_title, custom_summary, original_summary)
+    VALUES ('delete', old.id, old.date, old.custom_title, old.custom_summary, old.original_summary);
+END;
+
+CREATE TRIGGER IF NOT EXISTS sessions_au AFTER UPDATE ON sessions BEGIN
+    INSERT INTO sessions_fts(sessions_fts, rowid, date, custom_title, custom_summary, original_summary)
+    VALUES ('delete', old.id, old.date, old.custom_title, old.custom_summary, old.original_summary);
+    INSERT INTO sessions_fts(rowid, date, custom_title, custom_summary, original_summary)
+    VALUES (new.id, new.date, new.custom_title, new.custom_summary, new.original_summary);
+END;
+
+-- Triggers to keep activity_blocks_fts in sync
+CREATE TRIGGER IF NOT EXISTS activity_blocks_ai AFTER INSERT ON activity_blocks BEGIN
+    INSERT INTO activity_blocks_fts(rowid, micro_summary)
+    VALUES (new.id, new.micro_summary);
+END;
+
+CREATE TRIGGER IF NOT EXISTS activity_blocks_ad AFTER DELETE ON activity_blocks BEGIN
+    INSERT INTO activity_blocks_fts(activity_blocks_fts, rowid, micro_summary)
+    VALUES ('delete', old.id, old.micro_summary);
+END;
+
+CREATE TRIGGER IF NOT EXISTS activity_blocks_au AFTER UPDATE ON activity_blocks BEGIN
+    INSERT INTO activity_blocks_fts(activity_blocks_fts, rowid, micro_summary)
+    VALUES ('delete', old.id, old.micro_summary);
+    INSERT INTO activity_blocks_fts(rowid, micro_summary)
+    VALUES (new.id, new.micro_summary);
+END;
+`
+
 // migrations contains all database migrations in order.
 var migrations = []Migration{
 	{
@@ -112,63 +183,29 @@ CREATE TABLE IF NOT EXISTS manual_notes (
 );
 
 CREATE INDEX IF NOT EXISTS idx_manual_notes_session ON manual_notes(session_id);
+`,
+		Down: `
+DROP TABLE IF EXISTS manual_notes;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS chats;
+DROP TABLE IF EXISTS activity_blocks;
+DROP TABLE IF EXISTS app_activities;
+DROP TABLE IF EXISTS sessions;
 `,
 	},
 	{
 		Version:     2,
 		Description: "Add FTS5 virtual tables for full-text search",
-		SQL: `
--- FTS5 virtual tables for full-text search on non-encrypted fields
-CREATE VIRTUAL TABLE IF NOT EXISTS sessions_fts USING fts5(
-    date,
-    custom_title,
-    custom_summary,
-    original_summary,
-    content='sessions',
-    content_rowid='id'
-);
-
-CREATE VIRTUAL TABLE IF NOT EXISTS activity_blocks_fts USING fts5(
-    micro_summary,
-    content='activity_blocks',
-    content_rowid='id'
-);
-
--- Triggers to keep sessions_fts in sync
-CREATE TRIGGER IF NOT EXISTS sessions_ai AFTER INSERT ON sessions BEGIN
-    INSERT INTO sessions_fts(rowid, date, custom_title, custom_summary, original_summary)
-    VALUES (new.id, new.date, new.custom_title, new.custom_summary, new.original_summary);
-END;
-
-CREATE TRIGGER IF NOT EXISTS sessions_ad AFTER DELETE ON sessions BEGIN
-    INSERT INTO sessions_fts(sessions_fts, rowid, date, custom_title, custom_summary, original_summary)
-    VALUES ('delete', old.id, old.date, old.custom_title, old.custom_summary, old.original_summary);
-END;
-
-CREATE TRIGGER IF NOT EXISTS sessions_au AFTER UPDATE ON sessions BEGIN
-    INSERT INTO sessions_fts(sessions_fts, rowid, date, custom_title, custom_summary, original_summary)
-    VALUES ('delete', old.id, old.date, old.custom_title, old.custom_summary, old.original_summary);
-    INSERT INTO sessions_fts(rowid, date, custom_title, custom_summary, original_summary)
-    VALUES (new.id, new.date, new.custom_title, new.custom_summary, new.original_summary);
-END;
-
--- Triggers to keep activity_blocks_fts in sync
-CREATE TRIGGER IF NOT EXISTS activity_blocks_ai AFTER INSERT ON activity_blocks BEGIN
-    INSERT INTO activity_blocks_fts(rowid, micro_summary)
-    VALUES (new.id, new.micro_summary);
-END;
-
-CREATE TRIGGER IF NOT EXISTS activity_blocks_ad AFTER DELETE ON activity_blocks BEGIN
-    INSERT INTO activity_blocks_fts(activity_blocks_fts, rowid, micro_summary)
-    VALUES ('delete', old.id, old.micro_summary);
-END;
-
-CREATE TRIGGER IF NOT EXISTS activity_blocks_au AFTER UPDATE ON activity_blocks BEGIN
-    INSERT INTO activity_blocks_fts(activity_blocks_fts, rowid, micro_summary)
-    VALUES ('delete', old.id, old.micro_summary);
-    INSERT INTO activity_blocks_fts(rowid, micro_summary)
-    VALUES (new.id, new.micro_summary);
-END;
+		SQL:         ftsSchemaV2,
+		Down: `
+DROP TRIGGER IF EXISTS sessions_ai;
+DROP TRIGGER IF EXISTS sessions_ad;
+DROP TRIGGER IF EXISTS sessions_au;
+DROP TRIGGER IF EXISTS activity_blocks_ai;
+DROP TRIGGER IF EXISTS activity_blocks_ad;
+DROP TRIGGER IF EXISTS activity_blocks_au;
+DROP TABLE IF EXISTS sessions_fts;
+DROP TABLE IF EXISTS activity_blocks_fts;
 `,
 	},
 	{
@@ -266,32 +303,683 @@ CREATE TRIGGER activity_blocks_au AFTER UPDATE ON activity_blocks BEGIN
     INSERT INTO activity_blocks_fts(rowid, micro_summary, structured_metadata)
     VALUES (new.id, new.micro_summary, new.structured_metadata);
 END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS sessions_ai;
+DROP TRIGGER IF EXISTS sessions_ad;
+DROP TRIGGER IF EXISTS sessions_au;
+DROP TRIGGER IF EXISTS activity_blocks_ai;
+DROP TRIGGER IF EXISTS activity_blocks_ad;
+DROP TRIGGER IF EXISTS activity_blocks_au;
+DROP TABLE IF EXISTS sessions_fts;
+DROP TABLE IF EXISTS activity_blocks_fts;
+
+DROP TABLE IF EXISTS knowledge_cards;
+
+ALTER TABLE sessions DROP COLUMN entities_json;
+ALTER TABLE sessions DROP COLUMN synthesis_status;
+ALTER TABLE sessions DROP COLUMN ai_summary;
+ALTER TABLE sessions DROP COLUMN ai_bullets;
+ALTER TABLE activity_blocks DROP COLUMN capture_source;
+ALTER TABLE activity_blocks DROP COLUMN structured_metadata;
+` + ftsSchemaV2 + `
+INSERT INTO sessions_fts(sessions_fts) VALUES ('rebuild');
+INSERT INTO activity_blocks_fts(activity_blocks_fts) VALUES ('rebuild');
+`,
+	},
+	{
+		Version:     4,
+		Description: "Add browser_visits table and import_state high-water marks for external importers",
+		SQL: `
+-- Page visits imported from local browser history databases
+CREATE TABLE IF NOT EXISTS browser_visits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    activity_block_id INTEGER,
+    browser TEXT NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT,
+    visited_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (activity_block_id) REFERENCES activity_blocks(id) ON DELETE SET NULL,
+    UNIQUE(browser, url, visited_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_browser_visits_session ON browser_visits(session_id);
+CREATE INDEX IF NOT EXISTS idx_browser_visits_visited_at ON browser_visits(visited_at);
+CREATE INDEX IF NOT EXISTS idx_browser_visits_block ON browser_visits(activity_block_id);
+
+-- Incremental import progress, keyed by importer-defined source name
+CREATE TABLE IF NOT EXISTS import_state (
+    source TEXT PRIMARY KEY,
+    high_water_mark TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS browser_visits;
+DROP TABLE IF EXISTS import_state;
+`,
+	},
+	{
+		Version:     5,
+		Description: "Add imports and import_records tables for import provenance and undo",
+		SQL: `
+-- One row per import run
+CREATE TABLE IF NOT EXISTS imports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    importer TEXT NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'completed', 'failed', 'undone')),
+    stats_json TEXT DEFAULT '{}',
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_imports_importer ON imports(importer);
+
+-- Entities created by an import run; external_key deduplicates re-imports
+CREATE TABLE IF NOT EXISTS import_records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    import_id INTEGER NOT NULL,
+    importer TEXT NOT NULL,
+    entity_type TEXT NOT NULL CHECK(entity_type IN ('session', 'activity_block')),
+    entity_id INTEGER NOT NULL,
+    external_key TEXT,
+    FOREIGN KEY (import_id) REFERENCES imports(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_records_import ON import_records(import_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_import_records_key ON import_records(importer, external_key)
+    WHERE external_key IS NOT NULL;
+`,
+		Down: `
+DROP TABLE IF EXISTS import_records;
+DROP TABLE IF EXISTS imports;
+`,
+	},
+	{
+		Version:     6,
+		Description: "Add meetings table for calendar events imported from iCalendar files",
+		SQL: `
+-- One row per meeting occurrence; recurring events are expanded on import
+CREATE TABLE IF NOT EXISTS meetings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    uid TEXT NOT NULL,
+    recurrence_id TEXT NOT NULL,
+    title TEXT,
+    location TEXT,
+    organizer TEXT,
+    attendees_json TEXT DEFAULT '[]',
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    all_day BOOLEAN DEFAULT 0,
+    time_zone TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    UNIQUE(source, uid, recurrence_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_meetings_session ON meetings(session_id);
+CREATE INDEX IF NOT EXISTS idx_meetings_source ON meetings(source);
+`,
+		Down: `
+DROP TABLE IF EXISTS meetings;
+`,
+	},
+	{
+		Version:     7,
+		Description: "Add work_sessions table so a day can hold several work sessions, and link chats and knowledge cards to them",
+		SQL: `
+-- Time ranges within a day's session, split at idle gaps or manual boundaries
+CREATE TABLE IF NOT EXISTS work_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    boundary TEXT NOT NULL DEFAULT 'idle' CHECK(boundary IN ('idle', 'manual')),
+    title TEXT DEFAULT '',
+    synthesis_status TEXT NOT NULL DEFAULT 'pending' CHECK(synthesis_status IN ('pending', 'completed', 'failed')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_work_sessions_session ON work_sessions(session_id);
+
+-- NULL means the chat or card belongs to the day as a whole
+ALTER TABLE chats ADD COLUMN work_session_id INTEGER REFERENCES work_sessions(id) ON DELETE SET NULL;
+ALTER TABLE knowledge_cards ADD COLUMN work_session_id INTEGER REFERENCES work_sessions(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_chats_work_session ON chats(work_session_id);
+CREATE INDEX IF NOT EXISTS idx_knowledge_cards_work_session ON knowledge_cards(work_session_id);
+`,
+		Down: `
+DROP INDEX IF EXISTS idx_chats_work_session;
+DROP INDEX IF EXISTS idx_knowledge_cards_work_session;
+
+-- Columns with foreign keys can't be dropped, so both tables are rebuilt
+CREATE TABLE chats_v6 (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    role TEXT NOT NULL CHECK(role IN ('user', 'assistant')),
+    content_encrypted BLOB NOT NULL,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+INSERT INTO chats_v6 (id, session_id, role, content_encrypted, timestamp)
+    SELECT id, session_id, role, content_encrypted, timestamp FROM chats;
+DROP TABLE chats;
+ALTER TABLE chats_v6 RENAME TO chats;
+CREATE INDEX IF NOT EXISTS idx_chats_session ON chats(session_id);
+CREATE INDEX IF NOT EXISTS idx_chats_timestamp ON chats(timestamp);
+
+CREATE TABLE knowledge_cards_v6 (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    bullets TEXT NOT NULL,
+    entities TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'completed', 'failed')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+INSERT INTO knowledge_cards_v6 (id, session_id, title, bullets, entities, status, created_at, updated_at)
+    SELECT id, session_id, title, bullets, entities, status, created_at, updated_at FROM knowledge_cards;
+DROP TABLE knowledge_cards;
+ALTER TABLE knowledge_cards_v6 RENAME TO knowledge_cards;
+CREATE INDEX IF NOT EXISTS idx_knowledge_cards_session ON knowledge_cards(session_id);
+CREATE INDEX IF NOT EXISTS idx_knowledge_cards_status ON knowledge_cards(status);
+
+DROP TABLE IF EXISTS work_sessions;
+`,
+	},
+	{
+		Version:     8,
+		Description: "Add start_time, end_time and time_zone to sessions for timezone-aware day boundaries",
+		SQL: `
+-- UTC instants bounding the session day, and the IANA zone its date was computed in
+ALTER TABLE sessions ADD COLUMN start_time TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN end_time TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN time_zone TEXT DEFAULT '';
+`,
+		Backfill: backfillSessionBounds,
+		Down: `
+ALTER TABLE sessions DROP COLUMN start_time;
+ALTER TABLE sessions DROP COLUMN end_time;
+ALTER TABLE sessions DROP COLUMN time_zone;
+`,
+	},
+	{
+		Version:     9,
+		Description: "Add tags with links to sessions, activity blocks and knowledge cards, and auto-tag rules",
+		SQL: `
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    color TEXT DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS session_tags (
+    session_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (session_id, tag_id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS block_tags (
+    block_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (block_id, tag_id),
+    FOREIGN KEY (block_id) REFERENCES activity_blocks(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS card_tags (
+    card_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (card_id, tag_id),
+    FOREIGN KEY (card_id) REFERENCES knowledge_cards(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_block_tags_tag ON block_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_card_tags_tag ON card_tags(tag_id);
+
+-- Entity patterns that tag sessions and knowledge cards when they are synthesized
+CREATE TABLE IF NOT EXISTS tag_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity_type TEXT DEFAULT '',
+    pattern TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS tag_rules;
+DROP TABLE IF EXISTS card_tags;
+DROP TABLE IF EXISTS block_tags;
+DROP TABLE IF EXISTS session_tags;
+DROP TABLE IF EXISTS tags;
+`,
+	},
+	{
+		Version:     10,
+		Description: "Encrypt manual notes, index them for full-text search, and add note revisions and backlinks",
+		SQL: `
+-- Set once content holds ciphertext; legacy notes are plaintext until backfilled
+ALTER TABLE manual_notes ADD COLUMN encrypted INTEGER DEFAULT 0;
+
+-- Earlier versions of a note's content, encrypted like the note
+CREATE TABLE IF NOT EXISTS note_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INTEGER NOT NULL,
+    content TEXT,
+    encrypted INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (note_id) REFERENCES manual_notes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_revisions_note ON note_revisions(note_id);
+
+-- Blocks and time ranges a note refers to
+CREATE TABLE IF NOT EXISTS note_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INTEGER NOT NULL,
+    block_id INTEGER,
+    start_time TIMESTAMP,
+    end_time TIMESTAMP,
+    FOREIGN KEY (note_id) REFERENCES manual_notes(id) ON DELETE CASCADE,
+    FOREIGN KEY (block_id) REFERENCES activity_blocks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_links_note ON note_links(note_id);
+CREATE INDEX IF NOT EXISTS idx_note_links_block ON note_links(block_id);
+
+-- Contentless so the index holds no note text; rows are maintained from Go
+-- because triggers can't see the decrypted content
+CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+    content,
+    content='',
+    contentless_delete=1
+);
+
+-- Deletes need no content, so they also cover notes removed with their session
+CREATE TRIGGER IF NOT EXISTS manual_notes_ad AFTER DELETE ON manual_notes BEGIN
+    DELETE FROM notes_fts WHERE rowid = old.id;
+END;
+`,
+		Backfill: backfillNotes,
+		Down: `
+DROP TRIGGER IF EXISTS manual_notes_ad;
+DROP TABLE IF EXISTS notes_fts;
+DROP TABLE IF EXISTS note_links;
+DROP TABLE IF EXISTS note_revisions;
+ALTER TABLE manual_notes DROP COLUMN encrypted;
+`,
+		Revert: revertNotes,
+	},
+	{
+		Version:     11,
+		Description: "Add an append-only revision log for sessions and knowledge cards",
+		SQL: `
+-- changes_json maps each changed column to its old and new value
+CREATE TABLE IF NOT EXISTS revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity_type TEXT NOT NULL,
+    entity_id INTEGER NOT NULL,
+    actor TEXT NOT NULL,
+    changes_json TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revisions_entity ON revisions(entity_type, entity_id);
+
+-- Revisions can't reference two tables, so they are removed with their item here
+CREATE TRIGGER IF NOT EXISTS sessions_revisions_ad AFTER DELETE ON sessions BEGIN
+    DELETE FROM revisions WHERE entity_type = 'session' AND entity_id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS knowledge_cards_revisions_ad AFTER DELETE ON knowledge_cards BEGIN
+    DELETE FROM revisions WHERE entity_type = 'card' AND entity_id = old.id;
+END;
+`,
+		Down: `
+DROP TRIGGER IF EXISTS sessions_revisions_ad;
+DROP TRIGGER IF EXISTS knowledge_cards_revisions_ad;
+DROP TABLE IF EXISTS revisions;
+`,
+	},
+	{
+		Version:     12,
+		Description: "Add scheduled job state and run history",
+		SQL: `
+CREATE TABLE IF NOT EXISTS job_state (
+    name TEXT PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    last_status TEXT,
+    last_error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job TEXT NOT NULL,
+    triggered_by TEXT NOT NULL,
+    status TEXT NOT NULL,
+    message TEXT,
+    error TEXT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job, id);
+`,
+		Down: `
+DROP TABLE IF EXISTS job_runs;
+DROP TABLE IF EXISTS job_state;
+`,
+	},
+	{
+		Version:     13,
+		Description: "Add a content-addressed file store with reference counts",
+		SQL: `
+-- ref_count is kept by the file_refs triggers; blobs at zero are collected
+-- once released_at is older than the collection grace period
+CREATE TABLE IF NOT EXISTS blobs (
+    hash TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+-- path is the file's logical path, as in "2025-03-01/Code/screenshots/0930.png"
+CREATE TABLE IF NOT EXISTS file_refs (
+    path TEXT PRIMARY KEY,
+    blob_hash TEXT NOT NULL REFERENCES blobs(hash),
+    block_id INTEGER REFERENCES activity_blocks(id) ON DELETE SET NULL,
+    modified_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_refs_blob ON file_refs(blob_hash);
+CREATE INDEX IF NOT EXISTS idx_file_refs_block ON file_refs(block_id);
+CREATE INDEX IF NOT EXISTS idx_blobs_unreferenced ON blobs(ref_count) WHERE ref_count = 0;
+
+CREATE TRIGGER IF NOT EXISTS file_refs_ai AFTER INSERT ON file_refs BEGIN
+    UPDATE blobs SET ref_count = ref_count + 1, released_at = NULL WHERE hash = new.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_refs_ad AFTER DELETE ON file_refs BEGIN
+    UPDATE blobs SET ref_count = ref_count - 1,
+        released_at = CASE WHEN ref_count = 1 THEN CURRENT_TIMESTAMP ELSE released_at END
+    WHERE hash = old.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_refs_au AFTER UPDATE OF blob_hash ON file_refs
+WHEN old.blob_hash != new.blob_hash BEGIN
+    UPDATE blobs SET ref_count = ref_count + 1, released_at = NULL WHERE hash = new.blob_hash;
+    UPDATE blobs SET ref_count = ref_count - 1,
+        released_at = CASE WHEN ref_count = 1 THEN CURRENT_TIMESTAMP ELSE released_at END
+    WHERE hash = old.blob_hash;
+END;
+`,
+		Irreversible: "screenshots were moved into the blob store, and earlier versions look for them in per-day folders",
+	},
+	{
+		Version:     14,
+		Description: "Seal session data with per-session data keys",
+		SQL: `
+-- Each session's data is sealed with its own key, wrapped by the master key.
+-- Deleting the session deletes its key, so copies of the data left in free
+-- pages, the WAL or backups can't be read. Backup snapshots store
+-- wrapped_key as NULL; the keys are kept in a file beside them.
+CREATE TABLE IF NOT EXISTS data_keys (
+    id INTEGER PRIMARY KEY,
+    session_id INTEGER NOT NULL UNIQUE REFERENCES sessions(id) ON DELETE CASCADE,
+    wrapped_key BLOB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The data key a blob is sealed with; NULL for the master key
+ALTER TABLE blobs ADD COLUMN key_id INTEGER;
+`,
+		Backfill:     backfillDataKeys,
+		Irreversible: "session data is sealed with data keys that earlier versions can't read",
+	},
+	{
+		Version:     15,
+		Description: "Index sessions by synthesis status for keyset iteration",
+		SQL: `
+-- Iterating the sessions pending synthesis reads them in date order
+-- without scanning every session
+CREATE INDEX IF NOT EXISTS idx_sessions_synthesis_status ON sessions(synthesis_status, date);
+`,
+		Down: `
+DROP INDEX IF EXISTS idx_sessions_synthesis_status;
 `,
 	},
 }
 
-// runMigrations runs all pending database migrations.
-func (sm *SessionManager) runMigrations() error {
-	// Get current schema version
-	currentVersion := sm.getCurrentSchemaVersion()
+// backfillSessionBounds sets the day bounds of existing sessions. Their
+// dates were computed from the system zone with days starting at midnight.
+func backfillSessionBounds(_ *SessionManager, tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, date FROM sessions WHERE start_time IS NULL")
+	if err != nil {
+		return err
+	}
+
+	type sessionDate struct {
+		id   int64
+		date string
+	}
+	var pending []sessionDate
+	for rows.Next() {
+		var sd sessionDate
+		if err := rows.Scan(&sd.id, &sd.date); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, sd)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cal := DefaultSessionCalendar()
+	zone := cal.ZoneName()
+	for _, sd := range pending {
+		start, end, err := cal.Bounds(sd.date)
+		if err != nil {
+			continue // Leave malformed legacy dates without bounds
+		}
+		if _, err := tx.Exec("UPDATE sessions SET start_time = ?, end_time = ?, time_zone = ? WHERE id = ?",
+			start.UTC(), end.UTC(), zone, sd.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backfillNotes encrypts existing plaintext notes and adds them to the
+// full-text index.
+func backfillNotes(sm *SessionManager, tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, content FROM manual_notes WHERE encrypted = 0")
+	if err != nil {
+		return err
+	}
 
-	for _, migration := range migrations {
-		if migration.Version > currentVersion {
-			if err := sm.runMigration(migration); err != nil {
+	type plainNote struct {
+		id      int64
+		content string
+	}
+	var pending []plainNote
+	for rows.Next() {
+		var n plainNote
+		var content sql.NullString
+		if err := rows.Scan(&n.id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		n.content = content.String
+		pending = append(pending, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, n := range pending {
+		if sm.encryptionMgr != nil {
+			ciphertext, err := sm.encryptionMgr.EncryptString(n.content)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE manual_notes SET content = ?, encrypted = 1 WHERE id = ?", ciphertext, n.id); err != nil {
 				return err
 			}
 		}
+		if _, err := tx.Exec("INSERT INTO notes_fts(rowid, content) VALUES (?, ?)", n.id, n.content); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// backfillDataKeys re-encrypts existing session data under the sessions'
+// data keys. Screenshots are resealed by the file manager on start.
+func backfillDataKeys(sm *SessionManager, tx *sql.Tx) error {
+	if sm.encryptionMgr == nil {
+		return nil
+	}
+	_, err := sm.resealSessionData(tx)
+	return err
+}
+
+// revertNotes decrypts notes for the schema before notes were encrypted.
+func revertNotes(sm *SessionManager, tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, content FROM manual_notes WHERE encrypted = 1")
+	if err != nil {
+		return err
+	}
+
+	type sealedNote struct {
+		id      int64
+		content string
+	}
+	var pending []sealedNote
+	for rows.Next() {
+		var n sealedNote
+		var content sql.NullString
+		if err := rows.Scan(&n.id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		n.content = content.String
+		pending = append(pending, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, n := range pending {
+		plaintext, err := sm.decryptNote(n.content, true)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE manual_notes SET content = ? WHERE id = ?", plaintext, n.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LatestSchemaVersion is the schema version this build migrates databases to.
+var LatestSchemaVersion = migrations[len(migrations)-1].Version
+
+// migrationBackupDir holds copies of the database taken before migrating,
+// relative to the database's directory.
+const migrationBackupDir = "migration_backups"
+
+// MigrationOptions controls how MigrateTo changes the schema.
+type MigrationOptions struct {
+	DryRun     bool // Apply the migrations in a transaction that is rolled back
+	SkipBackup bool // Don't copy the database before migrating
+}
+
+// MigrationStep is a migration applied or reverted by MigrateTo.
+type MigrationStep struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Down        bool   `json:"down"`
+}
+
+// MigrationResult reports the migrations MigrateTo ran.
+type MigrationResult struct {
+	From   int             `json:"from"`
+	To     int             `json:"to"`
+	Steps  []MigrationStep `json:"steps"`
+	Backup string          `json:"backup,omitempty"` // Copy of the database taken first
+	DryRun bool            `json:"dryRun"`
+}
+
+// AppliedMigration is a migration recorded in the database.
+type AppliedMigration struct {
+	Version      int       `json:"version"`
+	Description  string    `json:"description"`
+	AppliedAt    time.Time `json:"appliedAt"`
+	Modified     bool      `json:"modified"`               // This build's SQL differs from what was applied
+	Irreversible string    `json:"irreversible,omitempty"` // Why it can't be reverted
+	Unknown      bool      `json:"unknown"`                // Applied by a newer build
+}
+
+// SchemaStatus reports a database's schema against this build's migrations.
+type SchemaStatus struct {
+	Version int                `json:"version"`
+	Latest  int                `json:"latest"`
+	Applied []AppliedMigration `json:"applied"`
+	Pending []MigrationStep    `json:"pending"`
+}
+
+// newerSchemaError is returned for a database migrated by a newer build.
+func newerSchemaError(version int) error {
+	return NewStorageError(ErrMigration, fmt.Sprintf("database schema version %d is newer than this build supports (%d); update Waddle to open it", version, LatestSchemaVersion), nil)
+}
+
+// runMigrations brings the database to the latest schema, copying it first
+// unless it is new. A database with a newer schema is refused.
+func (sm *SessionManager) runMigrations() error {
+	currentVersion := sm.getCurrentSchemaVersion()
+	if currentVersion > LatestSchemaVersion {
+		return newerSchemaError(currentVersion)
+	}
+	if currentVersion == LatestSchemaVersion {
+		return nil
+	}
+
+	_, err := sm.MigrateTo(LatestSchemaVersion, MigrationOptions{SkipBackup: currentVersion == 0})
+	return err
+}
+
 // getCurrentSchemaVersion returns the current schema version from the database.
 func (sm *SessionManager) getCurrentSchemaVersion() int {
 	// Check if schema_version table exists
 	var tableName string
 	err := sm.db.QueryRow(`
-		SELECT name FROM sqlite_master 
+		SELECT name FROM sqlite_master
 		WHERE type='table' AND name='schema_version'
 	`).Scan(&tableName)
 
@@ -312,19 +1000,126 @@ func (sm *SessionManager) getCurrentSchemaVersion() int {
 	return version
 }
 
-// runMigration executes a single migration within a transaction.
-func (sm *SessionManager) runMigration(migration Migration) error {
+// MigrateTo applies or reverts migrations until the schema is at target,
+// after copying the database to the migration backups folder. A dry run
+// applies them all in one transaction and rolls it back, so it reports
+// whether they would succeed without changing anything.
+func (sm *SessionManager) MigrateTo(target int, opts MigrationOptions) (*MigrationResult, error) {
+	current := sm.getCurrentSchemaVersion()
+	if current > LatestSchemaVersion {
+		return nil, newerSchemaError(current)
+	}
+	if target < 0 || target > LatestSchemaVersion {
+		return nil, NewStorageError(ErrValidation, fmt.Sprintf("schema version must be between 0 and %d", LatestSchemaVersion), nil)
+	}
+
+	down := target < current
+	var plan []Migration
+	if down {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.Version > current || m.Version <= target {
+				continue
+			}
+			if m.Down == "" {
+				return nil, NewStorageError(ErrMigration, fmt.Sprintf("migration %d can't be reverted: %s", m.Version, m.Irreversible), nil)
+			}
+			plan = append(plan, m)
+		}
+	} else {
+		for _, m := range migrations {
+			if m.Version > current && m.Version <= target {
+				plan = append(plan, m)
+			}
+		}
+	}
+
+	result := &MigrationResult{From: current, To: target, DryRun: opts.DryRun}
+	for _, m := range plan {
+		result.Steps = append(result.Steps, MigrationStep{Version: m.Version, Description: m.Description, Down: down})
+	}
+	if len(plan) == 0 {
+		return result, nil
+	}
+
+	if opts.DryRun {
+		tx, err := sm.db.Begin()
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to begin migration transaction", err)
+		}
+		defer tx.Rollback()
+		for _, m := range plan {
+			if err := sm.stepMigration(tx, m, down); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	if !opts.SkipBackup {
+		backup, err := sm.backupBeforeMigration(current)
+		if err != nil {
+			return nil, err
+		}
+		result.Backup = backup
+	}
+
+	// Each migration commits on its own, so a failure keeps the ones before it
+	for _, m := range plan {
+		if err := sm.runMigration(m, down); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// runMigration applies or reverts a single migration within a transaction.
+func (sm *SessionManager) runMigration(migration Migration, down bool) error {
 	tx, err := sm.db.Begin()
 	if err != nil {
 		return NewStorageError(ErrDatabase, "failed to begin migration transaction", err)
 	}
 	defer tx.Rollback()
 
+	if err := sm.stepMigration(tx, migration, down); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit migration", err)
+	}
+
+	return nil
+}
+
+// stepMigration applies or reverts a migration in tx and records it.
+func (sm *SessionManager) stepMigration(tx *sql.Tx, migration Migration, down bool) error {
+	if down {
+		if migration.Revert != nil {
+			if err := migration.Revert(sm, tx); err != nil {
+				return NewStorageError(ErrMigration, fmt.Sprintf("migration %d revert failed: %s", migration.Version, migration.Description), err)
+			}
+		}
+		if _, err := tx.Exec(migration.Down); err != nil {
+			return NewStorageError(ErrMigration, fmt.Sprintf("migration %d down failed: %s", migration.Version, migration.Description), err)
+		}
+		if _, err := tx.Exec("DELETE FROM schema_version WHERE version = ?", migration.Version); err != nil {
+			return NewStorageError(ErrDatabase, "failed to record migration", err)
+		}
+		return nil
+	}
+
 	// Execute migration SQL
-	_, err = tx.Exec(migration.SQL)
+	_, err := tx.Exec(migration.SQL)
 	if err != nil {
 		return NewStorageError(ErrDatabase, fmt.Sprintf("migration %d failed: %s", migration.Version, migration.Description), err)
 	}
+	if migration.Backfill != nil {
+		if err := migration.Backfill(sm, tx); err != nil {
+			return NewStorageError(ErrDatabase, fmt.Sprintf("migration %d backfill failed: %s", migration.Version, migration.Description), err)
+		}
+	}
 
 	// Calculate checksum
 	checksum := calculateChecksum(migration.SQL)
@@ -338,11 +1133,22 @@ func (sm *SessionManager) runMigration(migration Migration) error {
 		return NewStorageError(ErrDatabase, "failed to record migration", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return NewStorageError(ErrDatabase, "failed to commit migration", err)
+	return nil
+}
+
+// backupBeforeMigration copies the database at version into the migration
+// backups folder and returns the copy's path.
+func (sm *SessionManager) backupBeforeMigration(version int) (string, error) {
+	dir := filepath.Join(filepath.Dir(sm.dbPath), migrationBackupDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", NewStorageError(ErrFileSystem, "failed to create migration backup directory", err)
 	}
 
-	return nil
+	path := filepath.Join(dir, fmt.Sprintf("waddle-v%d-%s.db", version, time.Now().Format("20060102-150405.000")))
+	if _, err := sm.db.Exec("VACUUM INTO ?", path); err != nil {
+		return "", NewStorageError(ErrDatabase, "failed to back up database before migrating", err)
+	}
+	return path, nil
 }
 
 // calculateChecksum calculates SHA256 checksum of the migration SQL.
@@ -360,3 +1166,52 @@ func (sm *SessionManager) GetSchemaVersion() (int, error) {
 	}
 	return version, nil
 }
+
+// GetSchemaStatus reports the migrations applied to the database and those
+// this build would apply.
+func (sm *SessionManager) GetSchemaStatus() (*SchemaStatus, error) {
+	status := &SchemaStatus{Version: sm.getCurrentSchemaVersion(), Latest: LatestSchemaVersion}
+
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	if status.Version > 0 {
+		rows, err := sm.db.Query("SELECT version, COALESCE(description, ''), applied_at, COALESCE(checksum, '') FROM schema_version ORDER BY version")
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to get applied migrations", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var applied AppliedMigration
+			var appliedAt sql.NullTime
+			var checksum string
+			if err := rows.Scan(&applied.Version, &applied.Description, &appliedAt, &checksum); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to scan applied migration", err)
+			}
+			applied.AppliedAt = appliedAt.Time
+			if m, ok := known[applied.Version]; ok {
+				applied.Modified = checksum != "" && checksum != calculateChecksum(m.SQL)
+				if m.Down == "" {
+					applied.Irreversible = m.Irreversible
+				}
+			} else {
+				applied.Unknown = true
+			}
+			status.Applied = append(status.Applied, applied)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to read applied migrations", err)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version > status.Version {
+			status.Pending = append(status.Pending, MigrationStep{Version: m.Version, Description: m.Description})
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// isMigrationError reports whether err is a StorageError with ErrMigration.
+func isMigrationError(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.Code == ErrMigration
+}
+
+// TestReversibleMigrations tests reverting migrations with their data,
+// dry runs, backups before migrating, and refusing irreversible migrations
+// and newer schemas.
+func TestReversibleMigrations(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "waddle_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	em := NewEncryptionManager(tempDir)
+	if err := em.InitializeKey(); err != nil {
+		t.Fatalf("Failed to initialize encryption: %v", err)
+	}
+
+	sm := NewSessionManager(tempDir, em)
+	if err := sm.Open(); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer sm.Close()
+
+	tableExists := func(name string) bool {
+		var count int
+		sm.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&count)
+		return count > 0
+	}
+
+	t.Run("Reversible migrations round-trip with their data", func(t *testing.T) {
+		if _, err := sm.MigrateTo(12, MigrationOptions{SkipBackup: true}); err != nil {
+			t.Fatalf("Failed to migrate up: %v", err)
+		}
+		sealed, err := em.EncryptString("Call the venue")
+		if err != nil {
+			t.Fatalf("Failed to encrypt note: %v", err)
+		}
+		for _, stmt := range []string{
+			`INSERT INTO sessions (id, date, custom_title) VALUES (1, '2024-06-01', 'Offsite planning')`,
+			`INSERT INTO work_sessions (id, session_id, start_time, end_time) VALUES (1, 1, '2024-06-01 09:00:00', '2024-06-01 10:00:00')`,
+			`INSERT INTO chats (session_id, work_session_id, role, content_encrypted) VALUES (1, 1, 'user', x'00')`,
+			`INSERT INTO knowledge_cards (session_id, work_session_id, title, bullets, entities) VALUES (1, 1, 'Offsite', '[]', '[]')`,
+			`INSERT INTO manual_notes (id, session_id, content, encrypted) VALUES (1, 1, '` + sealed + `', 1)`,
+		} {
+			if _, err := sm.db.Exec(stmt); err != nil {
+				t.Fatalf("Failed to insert test data: %v", err)
+			}
+		}
+
+		result, err := sm.MigrateTo(6, MigrationOptions{SkipBackup: true})
+		if err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if len(result.Steps) != 6 || result.Steps[0].Version != 12 || !result.Steps[0].Down {
+			t.Errorf("Expected migrations 12 to 7 reverted, got %+v", result.Steps)
+		}
+		var chats, cards int
+		var note string
+		sm.db.QueryRow("SELECT COUNT(*) FROM chats").Scan(&chats)
+		sm.db.QueryRow("SELECT COUNT(*) FROM knowledge_cards").Scan(&cards)
+		sm.db.QueryRow("SELECT content FROM manual_notes WHERE id = 1").Scan(&note)
+		if chats != 1 || cards != 1 || note != "Call the venue" || tableExists("work_sessions") {
+			t.Errorf("Expected the chat, card and decrypted note kept, got %d chats, %d cards, note %q", chats, cards, note)
+		}
+
+		if _, err := sm.MigrateTo(2, MigrationOptions{SkipBackup: true}); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		var matches int
+		sm.db.QueryRow("SELECT COUNT(*) FROM sessions_fts WHERE sessions_fts MATCH 'offsite'").Scan(&matches)
+		if matches != 1 || tableExists("knowledge_cards") {
+			t.Errorf("Expected the earlier full-text index rebuilt, got %d matches", matches)
+		}
+
+		if _, err := sm.MigrateTo(0, MigrationOptions{SkipBackup: true}); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if tableExists("sessions") || sm.getCurrentSchemaVersion() != 0 {
+			t.Errorf("Expected an empty schema at version 0")
+		}
+
+		if _, err := sm.MigrateTo(LatestSchemaVersion, MigrationOptions{SkipBackup: true}); err != nil {
+			t.Fatalf("Failed to migrate up again: %v", err)
+		}
+		if version, _ := sm.GetSchemaVersion(); version != LatestSchemaVersion {
+			t.Errorf("Expected version %d, got %d", LatestSchemaVersion, version)
+		}
+	})
+
+	t.Run("Dry runs change nothing", func(t *testing.T) {
+		result, err := sm.MigrateTo(14, MigrationOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("Failed to dry-run: %v", err)
+		}
+		if !result.DryRun || result.Backup != "" || len(result.Steps) != 1 || result.Steps[0].Version != 15 {
+			t.Errorf("Unexpected dry-run result %+v", result)
+		}
+		if sm.getCurrentSchemaVersion() != LatestSchemaVersion || !tableExists("idx_sessions_synthesis_status") {
+			t.Errorf("Expected the schema unchanged by a dry run")
+		}
+	})
+
+	t.Run("Migrating down backs up first", func(t *testing.T) {
+		result, err := sm.MigrateTo(14, MigrationOptions{})
+		if err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if _, err := os.Stat(result.Backup); err != nil {
+			t.Errorf("Expected a backup at %q: %v", result.Backup, err)
+		}
+		status, err := sm.GetSchemaStatus()
+		if err != nil {
+			t.Fatalf("Failed to get status: %v", err)
+		}
+		if status.Version != 14 || len(status.Pending) != 1 || status.Applied[12].Irreversible == "" || status.Applied[0].Modified {
+			t.Errorf("Unexpected status %+v", status)
+		}
+		if _, err := sm.MigrateTo(12, MigrationOptions{}); !isMigrationError(err) {
+			t.Errorf("Expected reverting the data key migration refused, got %v", err)
+		}
+		if sm.getCurrentSchemaVersion() != 14 {
+			t.Errorf("Expected a refused migration to change nothing")
+		}
+	})
+
+	t.Run("Newer schemas are refused", func(t *testing.T) {
+		if _, err := sm.db.Exec("INSERT INTO schema_version (version, description) VALUES (99, 'From the future')"); err != nil {
+			t.Fatalf("Failed to record version: %v", err)
+		}
+		if _, err := sm.MigrateTo(LatestSchemaVersion, MigrationOptions{}); !isMigrationError(err) {
+			t.Errorf("Expected migrating a newer schema refused, got %v", err)
+		}
+		status, _ := sm.GetSchemaStatus()
+		if last := status.Applied[len(status.Applied)-1]; !last.Unknown {
+			t.Errorf("Expected the newer migration reported unknown, got %+v", last)
+		}
+
+		other := NewSessionManager(tempDir, em)
+		defer other.Close()
+		if err := other.Initialize(); !isMigrationError(err) {
+			t.Errorf("Expected opening a newer schema refused, got %v", err)
+		}
+	})
+}
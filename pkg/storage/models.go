@@ -17,7 +17,26 @@ type AppActivity = types.AppActivity
 type ActivityBlock = types.ActivityBlock
 type ChatMessage = types.ChatMessage
 type ManualNote = types.ManualNote
+type NoteLink = types.NoteLink
+type NoteRevision = types.NoteRevision
 type KnowledgeCard = types.KnowledgeCard
+type Revision = types.Revision
+type RevisionEntity = types.RevisionEntity
+type RevisionActor = types.RevisionActor
+type FieldChange = types.FieldChange
+type JobRun = types.JobRun
+type JobRunStatus = types.JobRunStatus
+type JobTrigger = types.JobTrigger
+type JobState = types.JobState
+type RetentionRule = types.RetentionRule
+type RetentionTarget = types.RetentionTarget
+type ScreenshotTier = types.ScreenshotTier
+type BrowserVisit = types.BrowserVisit
+type Meeting = types.Meeting
+type WorkSession = types.WorkSession
+type Tag = types.Tag
+type TagTarget = types.TagTarget
+type TagRule = types.TagRule
 type Notification = types.Notification
 type SearchResult = types.SearchResult
 type VectorSearchResult = types.VectorSearchResult
@@ -40,6 +59,38 @@ const (
 	MatchTypeSemantic = types.MatchTypeSemantic
 )
 
+// Re-export tag target constants from types.
+const (
+	TagTargetSession = types.TagTargetSession
+	TagTargetBlock   = types.TagTargetBlock
+	TagTargetCard    = types.TagTargetCard
+)
+
+// Re-export revision entity and actor constants from types.
+const (
+	RevisionEntitySession  = types.RevisionEntitySession
+	RevisionEntityCard     = types.RevisionEntityCard
+	RevisionActorUser      = types.RevisionActorUser
+	RevisionActorSynthesis = types.RevisionActorSynthesis
+	RevisionActorImport    = types.RevisionActorImport
+)
+
+// Re-export job run status and trigger constants from types.
+const (
+	JobRunRunning      = types.JobRunRunning
+	JobRunSucceeded    = types.JobRunSucceeded
+	JobRunFailed       = types.JobRunFailed
+	JobTriggerSchedule = types.JobTriggerSchedule
+	JobTriggerCatchUp  = types.JobTriggerCatchUp
+	JobTriggerManual   = types.JobTriggerManual
+)
+
+// Re-export retention target constants from types.
+const (
+	RetentionTargetActivity    = types.RetentionTargetActivity
+	RetentionTargetScreenshots = types.RetentionTargetScreenshots
+)
+
 // ════════════════════════════════════════════════════════════════════════
 // STORAGE-SPECIFIC TYPES — These belong only in the storage layer.
 // ════════════════════════════════════════════════════════════════════════
@@ -50,6 +101,43 @@ type StorageStats struct {
 	TotalSizeBytes  int64     `json:"totalSizeBytes"`
 	ScreenshotCount int64     `json:"screenshotCount"`
 	OldestFile      time.Time `json:"oldestFile"`
+
+	// Screenshot bytes and files by storage tier: original, thumbnail or
+	// the name of a ScreenshotTier
+	TierBytes map[string]int64 `json:"tierBytes"`
+	TierFiles map[string]int64 `json:"tierFiles"`
+}
+
+// Import run status constants.
+const (
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+	ImportStatusUndone    = "undone"
+)
+
+// Import entity type constants for provenance records.
+const (
+	ImportEntitySession       = "session"
+	ImportEntityActivityBlock = "activity_block"
+)
+
+// ImportRun records a single run of an external importer.
+type ImportRun struct {
+	ID          int64      `json:"id"`
+	Importer    string     `json:"importer"`
+	Source      string     `json:"source"`
+	Status      string     `json:"status"`
+	StatsJSON   string     `json:"statsJson"`
+	StartedAt   time.Time  `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// ImportUndoResult reports what was removed when an import was undone.
+type ImportUndoResult struct {
+	ImportID        int64   `json:"importId"`
+	BlocksDeleted   int     `json:"blocksDeleted"`
+	SessionsDeleted []int64 `json:"sessionsDeleted"`
 }
 
 // MigrationStatus represents the state of a data migration.
@@ -86,3 +174,34 @@ type MigrationCheckpoint struct {
 	Success   bool      `json:"success"`
 	Details   string    `json:"details,omitempty"`
 }
+
+// MeetingActivity is a meeting together with the activity blocks that
+// overlap its time span, answering "what happened during this meeting".
+type MeetingActivity struct {
+	Meeting Meeting    `json:"meeting"`
+	Blocks  []AppBlock `json:"blocks"`
+}
+
+// AppBlock is an activity block together with the app it belongs to and
+// the session date it was recorded in.
+type AppBlock struct {
+	ActivityBlock
+	AppName     string `json:"appName"`
+	SessionDate string `json:"sessionDate"`
+}
+
+// WorkSessionActivity is a work session together with the activity blocks,
+// meetings and knowledge cards that fall within it.
+type WorkSessionActivity struct {
+	WorkSession    WorkSession     `json:"workSession"`
+	Blocks         []AppBlock      `json:"blocks"`
+	Meetings       []Meeting       `json:"meetings"`
+	KnowledgeCards []KnowledgeCard `json:"knowledgeCards"`
+}
+
+// MeetingSyncResult reports the changes made when a calendar source was synced.
+type MeetingSyncResult struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Removed  int `json:"removed"`
+}
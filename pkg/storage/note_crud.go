@@ -0,0 +1,485 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// noteColumns is the column list shared by note queries, in scanNote order.
+const noteColumns = `id, session_id, content, encrypted, created_at, updated_at`
+
+// encryptNote encrypts note content under its session's data key when an
+// encryption manager is set and reports whether it did.
+func (sm *SessionManager) encryptNote(q execQueryer, sessionID int64, content string) (string, bool, error) {
+	if sm.encryptionMgr == nil {
+		return content, false, nil
+	}
+	ciphertext, err := sm.sealStringFor(q, sessionID, content)
+	if err != nil {
+		return "", false, NewStorageError(ErrEncryption, "failed to encrypt note", err)
+	}
+	return ciphertext, true, nil
+}
+
+// decryptNote returns the plaintext of stored note content.
+func (sm *SessionManager) decryptNote(content string, encrypted bool) (string, error) {
+	if !encrypted {
+		return content, nil
+	}
+	if sm.encryptionMgr == nil {
+		return "", NewStorageError(ErrEncryption, "note is encrypted but no key is available", nil)
+	}
+	plaintext, err := sm.encryptionMgr.DecryptString(content)
+	if err != nil {
+		return "", NewStorageError(ErrEncryption, "failed to decrypt note", err)
+	}
+	return plaintext, nil
+}
+
+// validateNote checks a note's content and links before it is stored.
+func validateNote(note *ManualNote) error {
+	if strings.TrimSpace(note.Content) == "" {
+		return NewStorageError(ErrValidation, "note content is required", nil)
+	}
+	for _, link := range note.Links {
+		if link.BlockID == 0 && (link.StartTime.IsZero() || !link.EndTime.After(link.StartTime)) {
+			return NewStorageError(ErrValidation, "note link needs a block or a time range", nil)
+		}
+	}
+	return nil
+}
+
+// AddNote adds a Markdown note to a session. The content is encrypted and
+// added to the full-text index.
+func (sm *SessionManager) AddNote(note *ManualNote) error {
+	if note.SessionID == 0 {
+		return NewStorageError(ErrValidation, "note session is required", nil)
+	}
+	if err := validateNote(note); err != nil {
+		return err
+	}
+
+	content, encrypted, err := sm.encryptNote(sm.db, int64(note.SessionID), note.Content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin note insert", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		INSERT INTO manual_notes (session_id, content, encrypted, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, int64(note.SessionID), content, encrypted, now, now)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to add note", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get note ID", err)
+	}
+
+	if err := saveNoteLinks(tx, id, note.Links); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO notes_fts(rowid, content) VALUES (?, ?)`, id, note.Content); err != nil {
+		return NewStorageError(ErrDatabase, "failed to index note", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit note", err)
+	}
+
+	note.ID = types.ElementID(id)
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	return nil
+}
+
+// saveNoteLinks replaces the links of a note.
+func saveNoteLinks(tx *sql.Tx, noteID int64, links []NoteLink) error {
+	if _, err := tx.Exec(`DELETE FROM note_links WHERE note_id = ?`, noteID); err != nil {
+		return NewStorageError(ErrDatabase, "failed to clear note links", err)
+	}
+
+	for _, link := range links {
+		var blockRef, start, end interface{}
+		if link.BlockID != 0 {
+			var exists int
+			err := tx.QueryRow(`SELECT 1 FROM activity_blocks WHERE id = ?`, int64(link.BlockID)).Scan(&exists)
+			if err == sql.ErrNoRows {
+				return NewStorageError(ErrNotFound, "linked activity block not found", nil)
+			}
+			if err != nil {
+				return NewStorageError(ErrDatabase, "failed to look up linked block", err)
+			}
+			blockRef = int64(link.BlockID)
+		} else {
+			start, end = link.StartTime.UTC(), link.EndTime.UTC()
+		}
+
+		if _, err := tx.Exec(`INSERT INTO note_links (note_id, block_id, start_time, end_time) VALUES (?, ?, ?, ?)`,
+			noteID, blockRef, start, end); err != nil {
+			return NewStorageError(ErrDatabase, "failed to link note", err)
+		}
+	}
+	return nil
+}
+
+// scanNote reads a note selected with noteColumns and decrypts it.
+func (sm *SessionManager) scanNote(row rowScanner) (*ManualNote, error) {
+	var note ManualNote
+	var content sql.NullString
+	var encrypted bool
+	if err := row.Scan(&note.ID, &note.SessionID, &content, &encrypted, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		return nil, err
+	}
+	plaintext, err := sm.decryptNote(content.String, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	note.Content = plaintext
+	return &note, nil
+}
+
+// GetNote retrieves a note with its links.
+func (sm *SessionManager) GetNote(id int64) (*ManualNote, error) {
+	note, err := sm.scanNote(sm.db.QueryRow(`SELECT `+noteColumns+` FROM manual_notes WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	if err != nil {
+		if _, ok := err.(*StorageError); ok {
+			return nil, err
+		}
+		return nil, NewStorageError(ErrDatabase, "failed to get note", err)
+	}
+
+	links, err := sm.getNoteLinks(`WHERE note_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	note.Links = links[int64(note.ID)]
+	return note, nil
+}
+
+// GetNotes returns a session's notes with their links, oldest first.
+func (sm *SessionManager) GetNotes(sessionID int64) ([]ManualNote, error) {
+	rows, err := sm.db.Query(`SELECT `+noteColumns+` FROM manual_notes WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get notes", err)
+	}
+	defer rows.Close()
+
+	notes := []ManualNote{}
+	for rows.Next() {
+		note, err := sm.scanNote(rows)
+		if err != nil {
+			if _, ok := err.(*StorageError); ok {
+				return nil, err
+			}
+			return nil, NewStorageError(ErrDatabase, "failed to scan note", err)
+		}
+		notes = append(notes, *note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating notes", err)
+	}
+
+	links, err := sm.getNoteLinks(`WHERE note_id IN (SELECT id FROM manual_notes WHERE session_id = ?)`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		notes[i].Links = links[int64(notes[i].ID)]
+	}
+
+	// Timestamps are stored as text, so order them as instants
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].CreatedAt.Before(notes[j].CreatedAt) })
+	return notes, nil
+}
+
+// getNoteLinks returns note links matching where, keyed by note ID.
+func (sm *SessionManager) getNoteLinks(where string, args ...interface{}) (map[int64][]NoteLink, error) {
+	rows, err := sm.db.Query(`SELECT note_id, block_id, start_time, end_time FROM note_links `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get note links", err)
+	}
+	defer rows.Close()
+
+	links := make(map[int64][]NoteLink)
+	for rows.Next() {
+		var noteID int64
+		var blockID sql.NullInt64
+		var start, end sql.NullTime
+		if err := rows.Scan(&noteID, &blockID, &start, &end); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan note link", err)
+		}
+		links[noteID] = append(links[noteID], NoteLink{
+			BlockID:   types.ElementID(blockID.Int64),
+			StartTime: start.Time,
+			EndTime:   end.Time,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating note links", err)
+	}
+	return links, nil
+}
+
+// UpdateNote replaces a note's content and links. When the content changes,
+// the previous version is kept as a revision.
+func (sm *SessionManager) UpdateNote(note *ManualNote) error {
+	if note.ID == 0 {
+		return NewStorageError(ErrValidation, "note ID is required for update", nil)
+	}
+	if err := validateNote(note); err != nil {
+		return err
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin note update", err)
+	}
+	defer tx.Rollback()
+
+	var oldContent sql.NullString
+	var oldEncrypted bool
+	var sessionID int64
+	var createdAt, oldUpdatedAt time.Time
+	err = tx.QueryRow(`SELECT session_id, content, encrypted, created_at, updated_at FROM manual_notes WHERE id = ?`, int64(note.ID)).
+		Scan(&sessionID, &oldContent, &oldEncrypted, &createdAt, &oldUpdatedAt)
+	if err == sql.ErrNoRows {
+		return NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get note", err)
+	}
+	oldPlaintext, err := sm.decryptNote(oldContent.String, oldEncrypted)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if oldPlaintext != note.Content {
+		// The revision is stamped with when the old content was written
+		if _, err := tx.Exec(`INSERT INTO note_revisions (note_id, content, encrypted, created_at) VALUES (?, ?, ?, ?)`,
+			int64(note.ID), oldContent.String, oldEncrypted, oldUpdatedAt); err != nil {
+			return NewStorageError(ErrDatabase, "failed to save note revision", err)
+		}
+
+		content, encrypted, err := sm.encryptNote(tx, sessionID, note.Content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE manual_notes SET content = ?, encrypted = ?, updated_at = ? WHERE id = ?`,
+			content, encrypted, now, int64(note.ID)); err != nil {
+			return NewStorageError(ErrDatabase, "failed to update note", err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM notes_fts WHERE rowid = ?`, int64(note.ID)); err != nil {
+			return NewStorageError(ErrDatabase, "failed to unindex note", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO notes_fts(rowid, content) VALUES (?, ?)`, int64(note.ID), note.Content); err != nil {
+			return NewStorageError(ErrDatabase, "failed to index note", err)
+		}
+	} else {
+		now = oldUpdatedAt
+	}
+
+	if err := saveNoteLinks(tx, int64(note.ID), note.Links); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit note update", err)
+	}
+
+	note.SessionID = types.SessionID(sessionID)
+	note.CreatedAt = createdAt
+	note.UpdatedAt = now
+	return nil
+}
+
+// DeleteNote deletes a note with its links and revisions. A trigger removes
+// it from the full-text index.
+func (sm *SessionManager) DeleteNote(id int64) error {
+	result, err := sm.db.Exec(`DELETE FROM manual_notes WHERE id = ?`, id)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to delete note", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "note not found", nil)
+	}
+	return nil
+}
+
+// RebuildNoteIndex replaces the full-text index with the text of every note
+// that can be decrypted. Returns the number of notes indexed.
+func (sm *SessionManager) RebuildNoteIndex() (int, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to begin note index rebuild", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, content, encrypted FROM manual_notes`)
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to query notes", err)
+	}
+	texts := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var content sql.NullString
+		var encrypted bool
+		if err := rows.Scan(&id, &content, &encrypted); err != nil {
+			rows.Close()
+			return 0, NewStorageError(ErrDatabase, "failed to scan note", err)
+		}
+		if text, err := sm.decryptNote(content.String, encrypted); err == nil {
+			texts[id] = text
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, NewStorageError(ErrDatabase, "error iterating notes", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM notes_fts`); err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to clear note index", err)
+	}
+	for id, text := range texts {
+		if _, err := tx.Exec(`INSERT INTO notes_fts(rowid, content) VALUES (?, ?)`, id, text); err != nil {
+			return 0, NewStorageError(ErrDatabase, "failed to index note", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to commit note index", err)
+	}
+	return len(texts), nil
+}
+
+// GetNoteRevisions returns the earlier versions of a note, newest first.
+func (sm *SessionManager) GetNoteRevisions(noteID int64) ([]NoteRevision, error) {
+	rows, err := sm.db.Query(`SELECT id, note_id, content, encrypted, created_at FROM note_revisions WHERE note_id = ?`, noteID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get note revisions", err)
+	}
+	defer rows.Close()
+
+	revisions := []NoteRevision{}
+	for rows.Next() {
+		var rev NoteRevision
+		var content sql.NullString
+		var encrypted bool
+		if err := rows.Scan(&rev.ID, &rev.NoteID, &content, &encrypted, &rev.CreatedAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan note revision", err)
+		}
+		if rev.Content, err = sm.decryptNote(content.String, encrypted); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating note revisions", err)
+	}
+
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].ID > revisions[j].ID })
+	return revisions, nil
+}
+
+// GetBlockNotes returns the notes that link an activity block, either
+// directly or through a time range overlapping the block.
+func (sm *SessionManager) GetBlockNotes(blockID int64) ([]ManualNote, error) {
+	var start, end time.Time
+	err := sm.db.QueryRow(`SELECT start_time, end_time FROM activity_blocks WHERE id = ?`, blockID).Scan(&start, &end)
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "activity block not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get activity block", err)
+	}
+
+	links, err := sm.getNoteLinks(`WHERE block_id = ? OR block_id IS NULL`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	return sm.getLinkedNotes(links, func(link NoteLink) bool {
+		if link.BlockID != 0 {
+			return true
+		}
+		return link.StartTime.Before(end) && link.EndTime.After(start)
+	})
+}
+
+// GetNotesInRange returns the notes that link a time range or an activity
+// block overlapping [start, end).
+func (sm *SessionManager) GetNotesInRange(start, end time.Time) ([]ManualNote, error) {
+	if !end.After(start) {
+		return nil, NewStorageError(ErrValidation, "end must be after start", nil)
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT nl.note_id, nl.block_id, nl.start_time, nl.end_time, ab.start_time, ab.end_time
+		FROM note_links nl
+		LEFT JOIN activity_blocks ab ON ab.id = nl.block_id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get note links", err)
+	}
+	defer rows.Close()
+
+	links := make(map[int64][]NoteLink)
+	for rows.Next() {
+		var noteID int64
+		var blockID sql.NullInt64
+		var linkStart, linkEnd, blockStart, blockEnd sql.NullTime
+		if err := rows.Scan(&noteID, &blockID, &linkStart, &linkEnd, &blockStart, &blockEnd); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan note link", err)
+		}
+		// Block links are matched by the block's span
+		link := NoteLink{BlockID: types.ElementID(blockID.Int64), StartTime: linkStart.Time, EndTime: linkEnd.Time}
+		if blockID.Valid {
+			link.StartTime, link.EndTime = blockStart.Time, blockEnd.Time
+		}
+		links[noteID] = append(links[noteID], link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating note links", err)
+	}
+
+	return sm.getLinkedNotes(links, func(link NoteLink) bool {
+		return link.StartTime.Before(end) && link.EndTime.After(start)
+	})
+}
+
+// getLinkedNotes loads the notes having at least one link that matches,
+// oldest first.
+func (sm *SessionManager) getLinkedNotes(links map[int64][]NoteLink, match func(NoteLink) bool) ([]ManualNote, error) {
+	notes := []ManualNote{}
+	for noteID, noteLinks := range links {
+		for _, link := range noteLinks {
+			if !match(link) {
+				continue
+			}
+			note, err := sm.GetNote(noteID)
+			if err != nil {
+				return nil, err
+			}
+			notes = append(notes, *note)
+			break
+		}
+	}
+
+	sort.Slice(notes, func(i, j int) bool { return notes[i].CreatedAt.Before(notes[j].CreatedAt) })
+	return notes, nil
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNotes tests note CRUD, encryption at rest, revisions, full-text
+// indexing and backlinks.
+func TestNotes(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := &Session{Date: "2025-06-02"}
+	if err := sm.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sessionID := int64(session.ID)
+
+	base := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	block := &ActivityBlock{BlockID: "09-00", StartTime: base, EndTime: base.Add(10 * time.Minute)}
+	if err := sm.AddBlock(sessionID, "Code", block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	note := &ManualNote{
+		SessionID: session.ID,
+		Content:   "# Standup\nDiscussed the **flamingo** rollout",
+		Links:     []NoteLink{{BlockID: block.ID}},
+	}
+
+	t.Run("Add encrypts and indexes", func(t *testing.T) {
+		if err := sm.AddNote(&ManualNote{SessionID: session.ID, Content: "  "}); !IsValidation(err) {
+			t.Errorf("Expected validation error for empty note, got %v", err)
+		}
+		if err := sm.AddNote(note); err != nil {
+			t.Fatalf("Failed to add note: %v", err)
+		}
+
+		var raw string
+		if err := sm.db.QueryRow("SELECT content FROM manual_notes WHERE id = ?", int64(note.ID)).Scan(&raw); err != nil {
+			t.Fatalf("Failed to read raw note: %v", err)
+		}
+		if raw == note.Content {
+			t.Error("Expected note content to be encrypted at rest")
+		}
+
+		got, err := sm.GetNote(int64(note.ID))
+		if err != nil || got.Content != note.Content || len(got.Links) != 1 || got.Links[0].BlockID != block.ID {
+			t.Errorf("Unexpected note: %+v (%v)", got, err)
+		}
+
+		results, err := sm.Search("flamingo", 1, 10)
+		if err != nil || len(results) != 1 || results[0].Session.ID != session.ID {
+			t.Errorf("Expected search to find the note's session, got %+v (%v)", results, err)
+		}
+	})
+
+	t.Run("Update keeps revisions and reindexes", func(t *testing.T) {
+		rangeStart := base.Add(time.Hour)
+		note.Content = "# Standup\nDiscussed the **pelican** rollout"
+		note.Links = []NoteLink{{StartTime: rangeStart, EndTime: rangeStart.Add(30 * time.Minute)}}
+		if err := sm.UpdateNote(note); err != nil {
+			t.Fatalf("Failed to update note: %v", err)
+		}
+
+		revisions, err := sm.GetNoteRevisions(int64(note.ID))
+		if err != nil || len(revisions) != 1 || revisions[0].Content != "# Standup\nDiscussed the **flamingo** rollout" {
+			t.Fatalf("Expected the previous content as a revision, got %+v (%v)", revisions, err)
+		}
+
+		// Saving unchanged content adds no revision
+		if err := sm.UpdateNote(note); err != nil {
+			t.Fatalf("Failed to re-save note: %v", err)
+		}
+		if revisions, _ := sm.GetNoteRevisions(int64(note.ID)); len(revisions) != 1 {
+			t.Errorf("Expected 1 revision after unchanged save, got %d", len(revisions))
+		}
+
+		if results, _ := sm.Search("flamingo", 1, 10); len(results) != 0 {
+			t.Errorf("Expected old content to be unindexed, got %+v", results)
+		}
+		if results, _ := sm.Search("pelican", 1, 10); len(results) != 1 {
+			t.Errorf("Expected new content to be indexed, got %+v", results)
+		}
+	})
+
+	t.Run("Backlinks", func(t *testing.T) {
+		// The note now links 10:00-10:30, which no longer covers the block
+		notes, err := sm.GetBlockNotes(int64(block.ID))
+		if err != nil || len(notes) != 0 {
+			t.Errorf("Expected no notes for the block, got %+v (%v)", notes, err)
+		}
+
+		notes, err = sm.GetNotesInRange(base.Add(70*time.Minute), base.Add(80*time.Minute))
+		if err != nil || len(notes) != 1 || notes[0].ID != note.ID {
+			t.Errorf("Expected the note for an overlapping range, got %+v (%v)", notes, err)
+		}
+
+		other := &ManualNote{SessionID: session.ID, Content: "block note", Links: []NoteLink{{BlockID: block.ID}}}
+		if err := sm.AddNote(other); err != nil {
+			t.Fatalf("Failed to add block note: %v", err)
+		}
+		notes, err = sm.GetBlockNotes(int64(block.ID))
+		if err != nil || len(notes) != 1 || notes[0].ID != other.ID {
+			t.Errorf("Expected the block note, got %+v (%v)", notes, err)
+		}
+		notes, err = sm.GetNotesInRange(base, base.Add(5*time.Minute))
+		if err != nil || len(notes) != 1 || notes[0].ID != other.ID {
+			t.Errorf("Expected the block note for the block's span, got %+v (%v)", notes, err)
+		}
+
+		if err := sm.AddNote(&ManualNote{SessionID: session.ID, Content: "x", Links: []NoteLink{{BlockID: 9999}}}); !IsNotFound(err) {
+			t.Errorf("Expected not found for missing block, got %v", err)
+		}
+	})
+
+	t.Run("Delete unindexes", func(t *testing.T) {
+		if err := sm.DeleteNote(int64(note.ID)); err != nil {
+			t.Fatalf("Failed to delete note: %v", err)
+		}
+		if _, err := sm.GetNote(int64(note.ID)); !IsNotFound(err) {
+			t.Errorf("Expected deleted note to be gone, got %v", err)
+		}
+
+		var indexed int
+		sm.db.QueryRow("SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH 'pelican'").Scan(&indexed)
+		if indexed != 0 {
+			t.Errorf("Expected deleted note to be unindexed, found %d", indexed)
+		}
+
+		notes, err := sm.GetNotes(sessionID)
+		if err != nil || len(notes) != 1 {
+			t.Errorf("Expected 1 remaining note, got %+v (%v)", notes, err)
+		}
+	})
+
+	t.Run("Backfill encrypts legacy notes", func(t *testing.T) {
+		_, err := sm.db.Exec(`INSERT INTO manual_notes (session_id, content, encrypted, created_at, updated_at)
+			VALUES (?, 'legacy heron note', 0, ?, ?)`, sessionID, base, base)
+		if err != nil {
+			t.Fatalf("Failed to insert legacy note: %v", err)
+		}
+
+		tx, err := sm.db.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		if err := backfillNotes(sm, tx); err != nil {
+			tx.Rollback()
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		var plain int
+		sm.db.QueryRow("SELECT COUNT(*) FROM manual_notes WHERE encrypted = 0").Scan(&plain)
+		if plain != 0 {
+			t.Errorf("Expected all notes to be encrypted, %d are not", plain)
+		}
+		if results, _ := sm.Search("heron", 1, 10); len(results) != 1 {
+			t.Errorf("Expected the legacy note to be searchable, got %+v", results)
+		}
+	})
+}
@@ -6,6 +6,12 @@ import (
 
 // AddNotification adds a notification to the database.
 func (sm *SessionManager) AddNotification(notif *Notification) error {
+	return sm.addNotification(sm.db, notif)
+}
+
+// addNotification adds a notification using q, which may be a write batch's
+// transaction.
+func (sm *SessionManager) addNotification(q execQueryer, notif *Notification) error {
 	if notif.ID == "" {
 		return NewStorageError(ErrValidation, "notification ID is required", nil)
 	}
@@ -33,17 +39,12 @@ func (sm *SessionManager) AddNotification(notif *Notification) error {
 			metadata = excluded.metadata
 	`
 
-	stmt, err := sm.getStmt(query)
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
-	}
-
 	readInt := 0
 	if notif.Read {
 		readInt = 1
 	}
 
-	_, err = stmt.Exec(
+	_, err := sm.execCached(q, query,
 		notif.ID,
 		notif.Type,
 		notif.Title,
@@ -0,0 +1,962 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// purgeMatcher decides which stored content a purge request matches.
+type purgeMatcher struct {
+	req      PurgeRequest
+	term     *regexp.Regexp // nil without a term
+	jsonTerm *regexp.Regexp // The term as it appears inside JSON strings
+	domain   string
+}
+
+// newPurgeMatcher validates a purge request and returns its matcher.
+func newPurgeMatcher(req PurgeRequest) (*purgeMatcher, error) {
+	req.Term = strings.TrimSpace(req.Term)
+	req.App = strings.TrimSpace(req.App)
+	m := &purgeMatcher{req: req, domain: normalizeDomain(req.Domain)}
+
+	switch {
+	case req.Term == "" && req.App == "" && m.domain == "" && !m.hasTime():
+		return nil, NewStorageError(ErrValidation, "purge needs a term, app, domain or time range", nil)
+	case req.Term != "" && len([]rune(req.Term)) < minPurgeTerm:
+		return nil, NewStorageError(ErrValidation, "purge term must be at least 3 characters", nil)
+	case req.Redact && req.Term == "":
+		return nil, NewStorageError(ErrValidation, "redacting needs a term", nil)
+	case !req.Start.IsZero() && !req.End.IsZero() && !req.End.After(req.Start):
+		return nil, NewStorageError(ErrValidation, "purge end must be after start", nil)
+	}
+	switch req.Backups {
+	case PurgeBackupsKeep, PurgeBackupsFlag, PurgeBackupsRewrite:
+	default:
+		return nil, NewStorageError(ErrValidation, "unknown purge backups mode "+string(req.Backups), nil)
+	}
+
+	if req.Term != "" {
+		m.term = regexp.MustCompile("(?i)" + regexp.QuoteMeta(req.Term))
+		encoded, _ := json.Marshal(req.Term)
+		m.jsonTerm = regexp.MustCompile("(?i)" + regexp.QuoteMeta(string(encoded[1:len(encoded)-1])))
+	}
+	return m, nil
+}
+
+// normalizeDomain returns the host a domain criterion names, accepting a
+// URL as well.
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if strings.Contains(domain, "://") {
+		if u, err := url.Parse(domain); err == nil {
+			domain = u.Hostname()
+		}
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(domain, "."), "www.")
+}
+
+func (m *purgeMatcher) hasTime() bool {
+	return !m.req.Start.IsZero() || !m.req.End.IsZero()
+}
+
+// dayLevel reports whether content belonging to a whole day, rather than
+// to an app or page, can match.
+func (m *purgeMatcher) dayLevel() bool {
+	return m.term != nil && m.req.App == "" && m.domain == ""
+}
+
+// overlaps reports whether [start, end) overlaps the time range.
+func (m *purgeMatcher) overlaps(start, end time.Time) bool {
+	if !m.req.Start.IsZero() && !end.After(m.req.Start) {
+		return false
+	}
+	if !m.req.End.IsZero() && !start.Before(m.req.End) {
+		return false
+	}
+	return true
+}
+
+// at reports whether t falls in the time range.
+func (m *purgeMatcher) at(t time.Time) bool {
+	return (m.req.Start.IsZero() || !t.Before(m.req.Start)) && (m.req.End.IsZero() || t.Before(m.req.End))
+}
+
+// inURL reports whether a URL is on the domain or one of its subdomains.
+func (m *purgeMatcher) inURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == m.domain || strings.HasSuffix(host, "."+m.domain)
+}
+
+// purgeField is a text column of a matched row with the value a purge
+// leaves in it.
+type purgeField struct {
+	column string
+	value  interface{}
+	seal   purgeSeal
+}
+
+// purgeSeal is how a purged value is encrypted before it is stored.
+type purgeSeal int
+
+const (
+	sealNone  purgeSeal = iota
+	sealBytes           // Under the session's data key
+	sealText            // Under the session's data key, as base64
+)
+
+// purgeText holds the text columns of a matched row.
+type purgeText struct {
+	fields []purgeField // Values as stored, decrypted
+	json   map[string]bool
+}
+
+func (pt *purgeText) add(column, value string, seal purgeSeal) {
+	pt.fields = append(pt.fields, purgeField{column: column, value: value, seal: seal})
+}
+
+func (pt *purgeText) addJSON(column, value string) {
+	if pt.json == nil {
+		pt.json = make(map[string]bool)
+	}
+	pt.json[column] = true
+	pt.add(column, value, sealNone)
+}
+
+// matches reports whether any column holds the term, or true without one.
+func (pt *purgeText) matches(m *purgeMatcher) bool {
+	if m.term == nil {
+		return true
+	}
+	for _, f := range pt.fields {
+		if pt.pattern(m, f.column).MatchString(f.value.(string)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pt *purgeText) pattern(m *purgeMatcher, column string) *regexp.Regexp {
+	if pt.json[column] {
+		return m.jsonTerm
+	}
+	return m.term
+}
+
+// redacted returns the columns holding the term with each occurrence
+// replaced.
+func (pt *purgeText) redacted(m *purgeMatcher) []purgeField {
+	var fields []purgeField
+	for _, f := range pt.fields {
+		re := pt.pattern(m, f.column)
+		if value := f.value.(string); re.MatchString(value) {
+			f.value = re.ReplaceAllLiteralString(value, PurgeRedaction)
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// cleared returns the columns holding the term emptied.
+func (pt *purgeText) cleared(m *purgeMatcher) []purgeField {
+	fields := pt.redacted(m)
+	for i := range fields {
+		switch {
+		case pt.json[fields[i].column]:
+			fields[i].value = "[]"
+		case fields[i].seal != sealNone:
+			fields[i].value = nil
+		default:
+			fields[i].value = ""
+		}
+		fields[i].seal = sealNone
+	}
+	return fields
+}
+
+// item returns a plan item deleting a matched row, or redacting it when
+// the request asks for that.
+func (pt *purgeText) item(m *purgeMatcher, item PurgeItem) PurgeItem {
+	item.Action = PurgeDelete
+	if m.req.Redact {
+		item.Action = PurgeRedact
+		item.updates = pt.redacted(m)
+		item.Fields = fieldColumns(item.updates)
+	}
+	return item
+}
+
+func fieldColumns(fields []purgeField) []string {
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+	return columns
+}
+
+// openSealed returns the plaintext of an encrypted column, or false if it
+// can't be decrypted, as when its session's data key has been destroyed.
+func (sm *SessionManager) openSealed(data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", true
+	}
+	if sm.encryptionMgr == nil {
+		return string(data), true
+	}
+	plaintext, err := sm.encryptionMgr.Decrypt(data)
+	if err != nil {
+		return "", false
+	}
+	return string(plaintext), true
+}
+
+// planPurge returns the stored content a purge request matches, in the
+// order it is applied.
+func (sm *SessionManager) planPurge(m *purgeMatcher) ([]PurgeItem, error) {
+	var items []PurgeItem
+	for _, plan := range []func(*purgeMatcher) ([]PurgeItem, error){
+		sm.planPurgeBlocks,
+		sm.planPurgeChats,
+		sm.planPurgeNotes,
+		sm.planPurgeSessions,
+		sm.planPurgeCards,
+		sm.planPurgeRevisions,
+		sm.planPurgeVisits,
+		sm.planPurgeMeetings,
+		sm.planPurgeNotifications,
+	} {
+		planned, err := plan(m)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, planned...)
+	}
+
+	files, err := sm.planPurgeFiles(m, items)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, files...), nil
+}
+
+// planPurgeBlocks matches activity blocks by app, time, the pages they
+// show and their text. Their screenshots are matched with them.
+func (sm *SessionManager) planPurgeBlocks(m *purgeMatcher) ([]PurgeItem, error) {
+	onDomain := make(map[int64]bool)
+	if m.domain != "" {
+		rows, err := sm.db.Query("SELECT activity_block_id, url FROM browser_visits WHERE activity_block_id IS NOT NULL")
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to query browser visits for purge", err)
+		}
+		for rows.Next() {
+			var blockID int64
+			var rawURL string
+			if err := rows.Scan(&blockID, &rawURL); err != nil {
+				rows.Close()
+				return nil, NewStorageError(ErrDatabase, "failed to scan browser visit", err)
+			}
+			if m.inURL(rawURL) {
+				onDomain[blockID] = true
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "error iterating browser visits", err)
+		}
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT ab.id, s.id, s.date, aa.app_name, ab.start_time, ab.end_time, ab.ocr_text_encrypted,
+			COALESCE(ab.micro_summary, ''), COALESCE(ab.structured_metadata, '')
+		FROM activity_blocks ab
+		JOIN app_activities aa ON aa.id = ab.app_activity_id
+		JOIN sessions s ON s.id = aa.session_id
+		WHERE ? = '' OR aa.app_name = ? COLLATE NOCASE
+		ORDER BY ab.start_time, ab.id
+	`, m.req.App, m.req.App)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query activity blocks for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id, sessionID int64
+		var date, app, summary, metadata string
+		var start, end time.Time
+		var ocr []byte
+		if err := rows.Scan(&id, &sessionID, &date, &app, &start, &end, &ocr, &summary, &metadata); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan activity block", err)
+		}
+		if m.hasTime() && !m.overlaps(start, end) {
+			continue
+		}
+		if m.domain != "" && !onDomain[id] && !m.inURL(metadataURL(metadata)) {
+			continue
+		}
+		var text purgeText
+		if plaintext, ok := sm.openSealed(ocr); ok {
+			text.add("ocr_text_encrypted", plaintext, sealBytes)
+		}
+		text.add("micro_summary", summary, sealNone)
+		text.addJSON("structured_metadata", metadata)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, text.item(m, PurgeItem{
+			Kind: "block", ID: strconv.FormatInt(id, 10), SessionDate: date, AppName: app,
+			table: "activity_blocks", key: id, sessionID: sessionID,
+		}))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating activity blocks", err)
+	}
+	return items, nil
+}
+
+// metadataURL returns the URL recorded in a block's structured metadata.
+func metadataURL(metadata string) string {
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(metadata), &fields) != nil {
+		return ""
+	}
+	rawURL, _ := fields["url"].(string)
+	return rawURL
+}
+
+// planPurgeChats matches chat messages by time and text.
+func (sm *SessionManager) planPurgeChats(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.req.App != "" || m.domain != "" {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT c.id, COALESCE(s.id, 0), COALESCE(s.date, ''), c.content_encrypted, c.timestamp
+		FROM chats c
+		LEFT JOIN sessions s ON s.id = c.session_id
+		ORDER BY c.timestamp, c.id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query chats for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id, sessionID int64
+		var date string
+		var content []byte
+		var timestamp time.Time
+		if err := rows.Scan(&id, &sessionID, &date, &content, &timestamp); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan chat", err)
+		}
+		if m.hasTime() && !m.at(timestamp) {
+			continue
+		}
+		plaintext, ok := sm.openSealed(content)
+		if !ok {
+			continue
+		}
+		var text purgeText
+		text.add("content_encrypted", plaintext, sealBytes)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, text.item(m, PurgeItem{
+			Kind: "chat", ID: strconv.FormatInt(id, 10), SessionDate: date,
+			table: "chats", key: id, sessionID: sessionID,
+		}))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating chats", err)
+	}
+	return items, nil
+}
+
+// purgeNote is a note or note revision read for a purge.
+type purgeNote struct {
+	id, noteID, sessionID int64
+	date                  string
+	content               sql.NullString
+	encrypted             bool
+	createdAt             time.Time
+}
+
+// planPurgeNotes matches notes by when they were written and their text,
+// and earlier revisions holding the term of notes that no longer do.
+func (sm *SessionManager) planPurgeNotes(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.req.App != "" || m.domain != "" {
+		return nil, nil
+	}
+	notes, err := sm.readPurgeNotes(`
+		SELECT n.id, n.id, s.id, s.date, n.content, n.encrypted, n.created_at
+		FROM manual_notes n
+		JOIN sessions s ON s.id = n.session_id
+		ORDER BY n.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := sm.readPurgeNotes(`
+		SELECT r.id, n.id, s.id, s.date, r.content, r.encrypted, r.created_at
+		FROM note_revisions r
+		JOIN manual_notes n ON n.id = r.note_id
+		JOIN sessions s ON s.id = n.session_id
+		ORDER BY r.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []PurgeItem
+	deleted := make(map[int64]bool)
+	for _, n := range notes {
+		item, ok := sm.planPurgeNote(m, n, "note", "manual_notes")
+		if !ok {
+			continue
+		}
+		deleted[n.id] = item.Action == PurgeDelete
+		items = append(items, item)
+	}
+	if m.term == nil {
+		return items, nil // Revisions go with their note
+	}
+	for _, r := range revisions {
+		if deleted[r.noteID] {
+			continue
+		}
+		if item, ok := sm.planPurgeNote(m, r, "note_revision", "note_revisions"); ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// planPurgeNote returns the plan item of a note or revision if it matches.
+func (sm *SessionManager) planPurgeNote(m *purgeMatcher, n purgeNote, kind, table string) (PurgeItem, bool) {
+	if m.hasTime() && !m.at(n.createdAt) {
+		return PurgeItem{}, false
+	}
+	plaintext, err := sm.decryptNote(n.content.String, n.encrypted)
+	if err != nil {
+		return PurgeItem{}, false
+	}
+	seal := sealNone
+	if sm.encryptionMgr != nil {
+		seal = sealText
+	}
+	var text purgeText
+	text.add("content", plaintext, seal)
+	if !text.matches(m) {
+		return PurgeItem{}, false
+	}
+	item := text.item(m, PurgeItem{
+		Kind: kind, ID: strconv.FormatInt(n.id, 10), SessionDate: n.date,
+		table: table, key: n.id, sessionID: n.sessionID,
+	})
+	if item.Action == PurgeRedact && seal == sealText && !n.encrypted {
+		item.updates = append(item.updates, purgeField{column: "encrypted", value: 1})
+	}
+	return item, true
+}
+
+// readPurgeNotes reads the notes or revisions a query selects.
+func (sm *SessionManager) readPurgeNotes(query string) ([]purgeNote, error) {
+	rows, err := sm.db.Query(query)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query notes for purge", err)
+	}
+	defer rows.Close()
+
+	var notes []purgeNote
+	for rows.Next() {
+		var n purgeNote
+		if err := rows.Scan(&n.id, &n.noteID, &n.sessionID, &n.date, &n.content, &n.encrypted, &n.createdAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan note", err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating notes", err)
+	}
+	return notes, nil
+}
+
+// purgeDay is a session's day read for a purge.
+type purgeDay struct {
+	id         int64
+	date       string
+	start, end sql.NullTime
+}
+
+// overlaps reports whether the day overlaps the time range.
+func (d purgeDay) overlaps(sm *SessionManager, m *purgeMatcher) bool {
+	if !m.hasTime() {
+		return true
+	}
+	if d.start.Valid && d.end.Valid {
+		return m.overlaps(d.start.Time, d.end.Time)
+	}
+	cal := sm.calendar
+	if cal == nil {
+		cal = DefaultSessionCalendar()
+	}
+	start, end, err := cal.Bounds(d.date)
+	return err == nil && m.overlaps(start, end)
+}
+
+// planPurgeSessions matches the titles, summaries and extracted text of
+// sessions whose day overlaps the time range. Sessions are never deleted;
+// their fields holding the term are cleared or redacted.
+func (sm *SessionManager) planPurgeSessions(m *purgeMatcher) ([]PurgeItem, error) {
+	if !m.dayLevel() {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT id, date, start_time, end_time, COALESCE(custom_title, ''), COALESCE(custom_summary, ''),
+			COALESCE(original_summary, ''), COALESCE(ai_summary, ''), COALESCE(ai_bullets, ''),
+			COALESCE(entities_json, ''), extracted_text_encrypted
+		FROM sessions
+		ORDER BY date
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query sessions for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var day purgeDay
+		var title, custom, original, ai, bullets, entities string
+		var extracted []byte
+		if err := rows.Scan(&day.id, &day.date, &day.start, &day.end, &title, &custom, &original, &ai, &bullets, &entities, &extracted); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan session", err)
+		}
+		if !day.overlaps(sm, m) {
+			continue
+		}
+		var text purgeText
+		text.add("custom_title", title, sealNone)
+		text.add("custom_summary", custom, sealNone)
+		text.add("original_summary", original, sealNone)
+		text.add("ai_summary", ai, sealNone)
+		text.addJSON("ai_bullets", bullets)
+		text.addJSON("entities_json", entities)
+		if plaintext, ok := sm.openSealed(extracted); ok {
+			text.add("extracted_text_encrypted", plaintext, sealBytes)
+		}
+		if !text.matches(m) {
+			continue
+		}
+		item := PurgeItem{
+			Kind: "session", ID: strconv.FormatInt(day.id, 10), SessionDate: day.date, Action: PurgeClear,
+			table: "sessions", key: day.id, sessionID: day.id, updates: text.cleared(m),
+		}
+		if m.req.Redact {
+			item.Action = PurgeRedact
+			item.updates = text.redacted(m)
+		}
+		item.Fields = fieldColumns(item.updates)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating sessions", err)
+	}
+	return items, nil
+}
+
+// planPurgeCards matches the knowledge cards of sessions whose day
+// overlaps the time range by their text.
+func (sm *SessionManager) planPurgeCards(m *purgeMatcher) ([]PurgeItem, error) {
+	if !m.dayLevel() {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT k.id, s.id, s.date, s.start_time, s.end_time, k.title, k.bullets, k.entities
+		FROM knowledge_cards k
+		JOIN sessions s ON s.id = k.session_id
+		ORDER BY k.id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query knowledge cards for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id int64
+		var day purgeDay
+		var title, bullets, entities string
+		if err := rows.Scan(&id, &day.id, &day.date, &day.start, &day.end, &title, &bullets, &entities); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan knowledge card", err)
+		}
+		if !day.overlaps(sm, m) {
+			continue
+		}
+		var text purgeText
+		text.add("title", title, sealNone)
+		text.addJSON("bullets", bullets)
+		text.addJSON("entities", entities)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, text.item(m, PurgeItem{
+			Kind: "card", ID: strconv.FormatInt(id, 10), SessionDate: day.date,
+			table: "knowledge_cards", key: id, sessionID: day.id,
+		}))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating knowledge cards", err)
+	}
+	return items, nil
+}
+
+// planPurgeRevisions matches the edit history of sessions and knowledge
+// cards, which keeps old values of their fields, like the sessions and
+// cards themselves.
+func (sm *SessionManager) planPurgeRevisions(m *purgeMatcher) ([]PurgeItem, error) {
+	if !m.dayLevel() {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT r.id, s.id, s.date, s.start_time, s.end_time, r.changes_json
+		FROM revisions r
+		LEFT JOIN knowledge_cards k ON r.entity_type = 'card' AND k.id = r.entity_id
+		JOIN sessions s ON s.id = CASE WHEN r.entity_type = 'session' THEN r.entity_id ELSE k.session_id END
+		ORDER BY r.id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query revisions for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id int64
+		var day purgeDay
+		var changes string
+		if err := rows.Scan(&id, &day.id, &day.date, &day.start, &day.end, &changes); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan revision", err)
+		}
+		if !day.overlaps(sm, m) {
+			continue
+		}
+		var text purgeText
+		text.addJSON("changes_json", changes)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, text.item(m, PurgeItem{
+			Kind: "revision", ID: strconv.FormatInt(id, 10), SessionDate: day.date,
+			table: "revisions", key: id, sessionID: day.id,
+		}))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating revisions", err)
+	}
+	return items, nil
+}
+
+// planPurgeVisits matches browser visits by domain, time and their URL and
+// title. Visits are always deleted.
+func (sm *SessionManager) planPurgeVisits(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.req.App != "" {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT v.id, s.date, v.url, COALESCE(v.title, ''), v.visited_at
+		FROM browser_visits v
+		JOIN sessions s ON s.id = v.session_id
+		ORDER BY v.visited_at, v.id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query browser visits for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id int64
+		var date, rawURL, title string
+		var visitedAt time.Time
+		if err := rows.Scan(&id, &date, &rawURL, &title, &visitedAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan browser visit", err)
+		}
+		if (m.hasTime() && !m.at(visitedAt)) || (m.domain != "" && !m.inURL(rawURL)) {
+			continue
+		}
+		var text purgeText
+		text.add("url", rawURL, sealNone)
+		text.add("title", title, sealNone)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, PurgeItem{
+			Kind: "visit", Action: PurgeDelete, ID: strconv.FormatInt(id, 10), SessionDate: date,
+			table: "browser_visits", key: id,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating browser visits", err)
+	}
+	return items, nil
+}
+
+// planPurgeMeetings matches meetings by time and their title, location,
+// organizer and attendees.
+func (sm *SessionManager) planPurgeMeetings(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.req.App != "" || m.domain != "" {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT mt.id, s.date, mt.start_time, mt.end_time, COALESCE(mt.title, ''), COALESCE(mt.location, ''),
+			COALESCE(mt.organizer, ''), COALESCE(mt.attendees_json, '')
+		FROM meetings mt
+		JOIN sessions s ON s.id = mt.session_id
+		ORDER BY mt.start_time, mt.id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query meetings for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id int64
+		var date, title, location, organizer, attendees string
+		var start, end time.Time
+		if err := rows.Scan(&id, &date, &start, &end, &title, &location, &organizer, &attendees); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan meeting", err)
+		}
+		if m.hasTime() && !m.overlaps(start, end) {
+			continue
+		}
+		var text purgeText
+		text.add("title", title, sealNone)
+		text.add("location", location, sealNone)
+		text.add("organizer", organizer, sealNone)
+		text.addJSON("attendees_json", attendees)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, text.item(m, PurgeItem{
+			Kind: "meeting", ID: strconv.FormatInt(id, 10), SessionDate: date,
+			table: "meetings", key: id,
+		}))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating meetings", err)
+	}
+	return items, nil
+}
+
+// planPurgeNotifications matches notifications by time and text.
+// Notifications are always deleted.
+func (sm *SessionManager) planPurgeNotifications(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.req.App != "" || m.domain != "" {
+		return nil, nil
+	}
+	rows, err := sm.db.Query(`
+		SELECT id, COALESCE(session_ref, ''), timestamp, title, COALESCE(message, ''), COALESCE(metadata, '')
+		FROM notifications
+		ORDER BY timestamp, id
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query notifications for purge", err)
+	}
+	defer rows.Close()
+
+	var items []PurgeItem
+	for rows.Next() {
+		var id, ref, title, message, metadata string
+		var timestamp time.Time
+		if err := rows.Scan(&id, &ref, &timestamp, &title, &message, &metadata); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan notification", err)
+		}
+		if m.hasTime() && !m.at(timestamp) {
+			continue
+		}
+		var text purgeText
+		text.add("title", title, sealNone)
+		text.add("message", message, sealNone)
+		text.addJSON("metadata", metadata)
+		if !text.matches(m) {
+			continue
+		}
+		items = append(items, PurgeItem{
+			Kind: "notification", Action: PurgeDelete, ID: id, SessionDate: ref,
+			table: "notifications", key: id,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating notifications", err)
+	}
+	return items, nil
+}
+
+// planPurgeFiles matches the screenshots of matched blocks, which can't be
+// redacted, and with no term or domain, the stored files of the app saved
+// in the time range. Thumbnails go with their screenshot.
+func (sm *SessionManager) planPurgeFiles(m *purgeMatcher, items []PurgeItem) ([]PurgeItem, error) {
+	var refs []FileRef
+	for _, item := range items {
+		if item.Kind != "block" {
+			continue
+		}
+		linked, err := sm.GetBlockFileRefs(item.key.(int64))
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, linked...)
+	}
+	if m.term == nil && m.domain == "" {
+		all, err := sm.ListFileRefs("")
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range all {
+			if m.req.App != "" && !strings.EqualFold(purgeAppOf(ref.Path), sanitizePathComponent(m.req.App)) {
+				continue
+			}
+			if m.hasTime() && !m.at(ref.ModTime) {
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	byPath := make(map[string]FileRef)
+	for _, ref := range refs {
+		byPath[ref.Path] = ref
+		if isImageFile(ref.Path) && path.Base(path.Dir(ref.Path)) == "screenshots" {
+			if thumb, err := sm.GetFileRef(thumbnailPath(ref.Path)); err == nil {
+				byPath[thumb.Path] = *thumb
+			}
+		}
+	}
+
+	var files []PurgeItem
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		for _, p := range []string{ref.Path, thumbnailPath(ref.Path)} {
+			ref, ok := byPath[p]
+			if !ok || seen[p] {
+				continue
+			}
+			seen[p] = true
+			files = append(files, PurgeItem{
+				Kind: "screenshot", Action: PurgeDelete, SessionDate: sessionOf(p), AppName: purgeAppOf(p), Path: p,
+				table: "file_refs", key: p, hash: ref.Hash,
+			})
+		}
+	}
+	return files, nil
+}
+
+// purgeAppOf returns the app directory of a logical file path.
+func purgeAppOf(rel string) string {
+	parts := strings.SplitN(rel, "/", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// applyPurge deletes and redacts the planned items in one transaction, then
+// merges the full-text indexes so no deleted text is left in their
+// segments. Returns the blobs of deleted files.
+func (sm *SessionManager) applyPurge(items []PurgeItem) ([]string, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin purge", err)
+	}
+	defer tx.Rollback()
+
+	var released []string
+	keyColumn := map[string]string{"file_refs": "path"}
+	for _, item := range items {
+		if item.table == "" {
+			continue
+		}
+		key := keyColumn[item.table]
+		if key == "" {
+			key = "id"
+		}
+
+		if item.Action == PurgeDelete {
+			if _, err := tx.Exec("DELETE FROM "+item.table+" WHERE "+key+" = ?", item.key); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to purge "+item.Kind, err)
+			}
+			if item.hash != "" {
+				released = append(released, item.hash)
+			}
+			continue
+		}
+
+		sets := make([]string, len(item.updates))
+		args := make([]interface{}, 0, len(item.updates)+1)
+		for i, f := range item.updates {
+			value, err := sm.sealPurgeField(tx, item.sessionID, f)
+			if err != nil {
+				return nil, err
+			}
+			sets[i] = f.column + " = ?"
+			args = append(args, value)
+		}
+		args = append(args, item.key)
+		if _, err := tx.Exec("UPDATE "+item.table+" SET "+strings.Join(sets, ", ")+" WHERE "+key+" = ?", args...); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to redact "+item.Kind, err)
+		}
+		if item.Kind == "note" {
+			if _, err := tx.Exec(`DELETE FROM notes_fts WHERE rowid = ?`, item.key); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to unindex note", err)
+			}
+			if _, err := tx.Exec(`INSERT INTO notes_fts(rowid, content) VALUES (?, ?)`, item.key, item.updates[0].value); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to index note", err)
+			}
+		}
+	}
+
+	for _, index := range []string{"sessions_fts", "activity_blocks_fts", "notes_fts"} {
+		if _, err := tx.Exec("INSERT INTO " + index + "(" + index + ") VALUES ('optimize')"); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to merge "+index, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit purge", err)
+	}
+	return released, sm.checkpoint()
+}
+
+// sealPurgeField returns the value a purge stores in a column.
+func (sm *SessionManager) sealPurgeField(tx *sql.Tx, sessionID int64, f purgeField) (interface{}, error) {
+	switch {
+	case f.seal == sealNone:
+	case sm.encryptionMgr == nil:
+		return []byte(f.value.(string)), nil
+	case f.seal == sealBytes:
+		return sm.sealFor(tx, sessionID, []byte(f.value.(string)))
+	case f.seal == sealText:
+		return sm.sealStringFor(tx, sessionID, f.value.(string))
+	}
+	return f.value, nil
+}
+
+// checkpoint copies the WAL into the database and truncates it, so no
+// copy of changed pages is left in the log.
+func (sm *SessionManager) checkpoint() error {
+	if _, err := sm.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return NewStorageError(ErrDatabase, "failed to checkpoint database", err)
+	}
+	return nil
+}
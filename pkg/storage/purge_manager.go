@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PurgeManager erases everything matching a term, app, domain or time range
+// from every place the data is kept: the database and its full-text
+// indexes, the vector store, stored files and the archive, and optionally
+// backup snapshots.
+type PurgeManager struct {
+	config        *StorageConfig
+	storageEngine *StorageEngine
+}
+
+// NewPurgeManager creates a new purge manager.
+func NewPurgeManager(config *StorageConfig, storageEngine *StorageEngine) *PurgeManager {
+	return &PurgeManager{
+		config:        config,
+		storageEngine: storageEngine,
+	}
+}
+
+const (
+	// PurgeRedaction replaces the term in redacted text.
+	PurgeRedaction = "[redacted]"
+
+	// minPurgeTerm is the shortest term a purge accepts, so a typo can't
+	// match most of the database.
+	minPurgeTerm = 3
+)
+
+// PurgeAction is what a purge does to an item.
+type PurgeAction string
+
+const (
+	PurgeDelete PurgeAction = "delete"
+	PurgeRedact PurgeAction = "redact" // The term is replaced with PurgeRedaction
+	PurgeClear  PurgeAction = "clear"  // Fields holding the term are emptied; sessions are never deleted
+)
+
+// PurgeBackups is what a purge does to backup snapshots taken before it.
+type PurgeBackups string
+
+const (
+	PurgeBackupsKeep    PurgeBackups = ""        // Snapshots are left as they are
+	PurgeBackupsFlag    PurgeBackups = "flag"    // The purge is logged and applied again when a snapshot is restored
+	PurgeBackupsRewrite PurgeBackups = "rewrite" // Snapshots are purged too
+)
+
+// PurgeRequest selects what a purge erases. Everything given must match;
+// at least one of Term, App, Domain, Start and End is required.
+type PurgeRequest struct {
+	Term   string    `json:"term,omitempty"`   // Case-insensitive text
+	App    string    `json:"app,omitempty"`    // App name
+	Domain string    `json:"domain,omitempty"` // Matches its subdomains too
+	Start  time.Time `json:"start,omitempty"`
+	End    time.Time `json:"end,omitempty"`
+	// Redact replaces the term in text rather than deleting what holds it.
+	// Screenshots, visits and notifications are deleted either way.
+	Redact  bool         `json:"redact,omitempty"`
+	Backups PurgeBackups `json:"backups,omitempty"`
+}
+
+// PurgeItem is one thing a purge deletes, redacts or clears.
+type PurgeItem struct {
+	Kind        string      `json:"kind"` // block, chat, note, note_revision, session, card, revision, visit, meeting, notification, screenshot or archive
+	Action      PurgeAction `json:"action"`
+	ID          string      `json:"id,omitempty"`
+	SessionDate string      `json:"sessionDate,omitempty"`
+	AppName     string      `json:"appName,omitempty"`
+	Path        string      `json:"path,omitempty"`   // Relative to the files directory, or the data directory for archive files
+	Fields      []string    `json:"fields,omitempty"` // Columns redacted or cleared
+
+	table     string
+	key       interface{}
+	sessionID int64
+	updates   []purgeField
+	hash      string // Blob of a screenshot
+}
+
+// PurgeReport lists what a purge erased, or would erase in a preview.
+type PurgeReport struct {
+	GeneratedAt         time.Time      `json:"generatedAt"`
+	Preview             bool           `json:"preview"`
+	Request             PurgeRequest   `json:"request"`
+	Items               []PurgeItem    `json:"items"`
+	Counts              map[string]int `json:"counts"` // Items by kind
+	Deleted             int            `json:"deleted"`
+	Redacted            int            `json:"redacted"`
+	Cleared             int            `json:"cleared"`
+	EmbeddingsDeleted   int            `json:"embeddingsDeleted"`
+	BlobsDeleted        int            `json:"blobsDeleted"`
+	BlobBytesFreed      int64          `json:"blobBytesFreed"`
+	DatabaseBytesBefore int64          `json:"databaseBytesBefore,omitempty"`
+	DatabaseBytesAfter  int64          `json:"databaseBytesAfter,omitempty"`
+	BackupsAffected     int            `json:"backupsAffected"` // Snapshots that may hold purged data
+	BackupsFlagged      int            `json:"backupsFlagged"`
+	BackupsRewritten    int            `json:"backupsRewritten"`
+	Duration            time.Duration  `json:"duration"`
+	Errors              []string       `json:"errors,omitempty"`
+}
+
+func (r *PurgeReport) add(item PurgeItem) {
+	r.Items = append(r.Items, item)
+	r.Counts[item.Kind]++
+	switch item.Action {
+	case PurgeDelete:
+		r.Deleted++
+	case PurgeRedact:
+		r.Redacted++
+	case PurgeClear:
+		r.Cleared++
+	}
+}
+
+// PlanPurge works out what Purge would erase without changing anything.
+func (pm *PurgeManager) PlanPurge(req PurgeRequest) (*PurgeReport, error) {
+	m, err := newPurgeMatcher(req)
+	if err != nil {
+		return nil, err
+	}
+	report := &PurgeReport{GeneratedAt: time.Now(), Preview: true, Request: m.req, Items: []PurgeItem{}, Counts: map[string]int{}}
+
+	items, err := pm.storageEngine.sessionMgr.planPurge(m)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := pm.planPurgeArchive(m)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range append(items, archived...) {
+		report.add(item)
+	}
+
+	if len(report.Items) > 0 {
+		if backups, err := NewBackupManager(pm.config, pm.storageEngine).ListBackups(); err == nil {
+			report.BackupsAffected = len(backups)
+		}
+	}
+	return report, nil
+}
+
+// planPurgeArchive matches files of archived sessions by app and time.
+// Archived files can't be searched, so a term or domain never matches them.
+func (pm *PurgeManager) planPurgeArchive(m *purgeMatcher) ([]PurgeItem, error) {
+	if m.term != nil || m.domain != "" {
+		return nil, nil
+	}
+	dir := filepath.Join(pm.config.DataDir, "archive", "files")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var items []PurgeItem
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		app := purgeAppOf(rel)
+		if m.req.App != "" && !strings.EqualFold(app, sanitizePathComponent(m.req.App)) {
+			return nil
+		}
+		if m.hasTime() && !m.at(info.ModTime()) {
+			return nil
+		}
+		items = append(items, PurgeItem{
+			Kind: "archive", Action: PurgeDelete, SessionDate: sessionOf(rel), AppName: app,
+			Path: "archive/files/" + rel,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to walk archive directory", err)
+	}
+	return items, nil
+}
+
+// Purge erases everything a request matches. Matched rows are deleted or
+// redacted in one transaction, the full-text indexes merged and the
+// database vacuumed, so no copy of the text is left in free pages or the
+// WAL. Blobs no longer referenced are deleted at once rather than after
+// the garbage collection grace period.
+func (pm *PurgeManager) Purge(req PurgeRequest) (*PurgeReport, error) {
+	start := time.Now()
+	report, err := pm.PlanPurge(req)
+	if err != nil {
+		return nil, err
+	}
+	report.Preview = false
+	if len(report.Items) == 0 {
+		report.Duration = time.Since(start)
+		return report, nil
+	}
+
+	se := pm.storageEngine
+	report.DatabaseBytesBefore = databaseSize(se.sessionMgr.dbPath)
+	released, err := se.sessionMgr.applyPurge(report.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range released {
+		freed, err := se.fileMgr.collectBlob(hash, func() (bool, error) { return se.sessionMgr.DeleteBlob(hash) })
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to delete blob %s: %v", hash, err))
+			continue
+		}
+		if freed > 0 {
+			report.BlobsDeleted++
+			report.BlobBytesFreed += freed
+		}
+	}
+
+	for _, item := range report.Items {
+		var err error
+		switch item.Kind {
+		case "archive":
+			err = os.Remove(filepath.Join(pm.config.DataDir, filepath.FromSlash(item.Path)))
+		case "note", "session":
+			err = pm.purgeEmbedding(item)
+			if err == nil {
+				report.EmbeddingsDeleted++
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to %s %s %s: %v", item.Action, item.Kind, item.ID+item.Path, err))
+		}
+	}
+
+	if err := se.sessionMgr.Vacuum(); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to vacuum database: %v", err))
+	} else if err := se.sessionMgr.checkpoint(); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to checkpoint database: %v", err))
+	}
+	report.DatabaseBytesAfter = databaseSize(se.sessionMgr.dbPath)
+
+	if req.Backups != PurgeBackupsKeep {
+		bm := NewBackupManager(pm.config, se)
+		flagged, rewritten, err := bm.purgeBackups(report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to purge backups: %v", err))
+		}
+		report.BackupsFlagged = flagged
+		report.BackupsRewritten = rewritten
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// purgeEmbedding deletes the embedding of a purged note or session. A
+// redacted one is embedded again from its redacted text.
+func (pm *PurgeManager) purgeEmbedding(item PurgeItem) error {
+	se := pm.storageEngine
+	id, _ := strconv.ParseInt(item.ID, 10, 64)
+	if item.Kind == "note" {
+		if err := se.vectorMgr.DeleteNoteEmbedding(id); err != nil {
+			return err
+		}
+		if item.Action == PurgeRedact {
+			se.vectorMgr.QueueNoteEmbedding(id, item.sessionID, item.updates[0].value.(string))
+		}
+		return nil
+	}
+
+	if err := se.vectorMgr.DeleteEmbedding(id); err != nil {
+		return err
+	}
+	session, err := se.sessionMgr.Get(item.SessionDate)
+	if err != nil {
+		return err
+	}
+	if session.CustomSummary != "" || session.OriginalSummary != "" || session.ExtractedText != "" {
+		se.vectorMgr.QueueEmbedding(id, session.CustomSummary+" "+session.OriginalSummary+" "+session.ExtractedText)
+	}
+	return nil
+}
+
+// databaseSize returns the size of a database file and its WAL.
+func databaseSize(dbPath string) int64 {
+	var size int64
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
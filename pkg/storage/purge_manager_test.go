@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPurge tests previewing and applying purges by term and by app, and
+// that a purge flagged for backups is applied again on restore.
+func TestPurge(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "storage")
+	se := NewStorageEngine(DefaultStorageConfig(dataDir))
+	if err := se.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer func() { se.Close() }()
+
+	const date = "2025-03-01"
+	if _, err := se.CreateSession(date); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	at := time.Date(2025, 3, 1, 14, 3, 0, 0, time.Local)
+	for _, b := range []struct{ app, text string }{
+		{"Browser", "Login form with password hunter2 visible"},
+		{"Editor", "func main() {}"},
+	} {
+		block := &ActivityBlock{BlockID: "14-03", StartTime: at, EndTime: at.Add(time.Minute), OCRText: b.text, MicroSummary: "Working in " + b.app}
+		if err := se.AddActivityBlock(date, b.app, block); err != nil {
+			t.Fatalf("Failed to add activity block: %v", err)
+		}
+		if _, err := se.SaveScreenshot(date, b.app, "1403.png", []byte("screen of "+b.app)); err != nil {
+			t.Fatalf("Failed to save screenshot: %v", err)
+		}
+		if err := se.LinkScreenshot(date, b.app, "1403.png", int64(block.ID)); err != nil {
+			t.Fatalf("Failed to link screenshot: %v", err)
+		}
+	}
+	if err := se.AddChat(date, &ChatMessage{Role: ChatRoleUser, Content: "my password is Hunter2", Timestamp: at}); err != nil {
+		t.Fatalf("Failed to add chat: %v", err)
+	}
+	if err := se.AddNote(date, &ManualNote{Content: "rotate hunter2 tomorrow"}); err != nil {
+		t.Fatalf("Failed to add note: %v", err)
+	}
+
+	backupMgr := NewBackupManager(se.config, se)
+	backupPath, err := backupMgr.CreateBackup()
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	byTerm := PurgeRequest{Term: "hunter2", Redact: true, Backups: PurgeBackupsFlag}
+
+	t.Run("Invalid requests are rejected", func(t *testing.T) {
+		for _, req := range []PurgeRequest{{}, {Term: "ab"}, {App: "Editor", Redact: true}, {Term: "hunter2", Backups: "shred"}} {
+			if _, err := se.PreviewPurge(req); !IsValidation(err) {
+				t.Errorf("Expected %+v to be rejected, got %v", req, err)
+			}
+		}
+	})
+
+	t.Run("Preview changes nothing", func(t *testing.T) {
+		report, err := se.PreviewPurge(byTerm)
+		if err != nil {
+			t.Fatalf("Failed to preview purge: %v", err)
+		}
+		if !report.Preview || report.Counts["block"] != 1 || report.Counts["chat"] != 1 || report.Counts["note"] != 1 || report.Counts["screenshot"] != 1 {
+			t.Errorf("Unexpected preview counts %v", report.Counts)
+		}
+		if report.BackupsAffected != 1 {
+			t.Errorf("Expected 1 affected backup, got %d", report.BackupsAffected)
+		}
+		chats, _ := se.GetChats(date)
+		if len(chats) != 1 || chats[0].Content != "my password is Hunter2" {
+			t.Errorf("Expected the preview to leave chats alone, got %+v", chats)
+		}
+	})
+
+	t.Run("Redacting a term reaches every layer", func(t *testing.T) {
+		report, err := se.Purge(byTerm)
+		if err != nil {
+			t.Fatalf("Failed to purge: %v", err)
+		}
+		if len(report.Errors) > 0 || report.Redacted != 3 || report.BlobsDeleted != 1 || report.BackupsFlagged != 1 {
+			t.Errorf("Unexpected report %+v", report)
+		}
+
+		chats, _ := se.GetChats(date)
+		if len(chats) != 1 || chats[0].Content != "my password is "+PurgeRedaction {
+			t.Errorf("Expected the chat redacted, got %+v", chats)
+		}
+		notes, _ := se.GetNotes(date)
+		if len(notes) != 1 || notes[0].Content != "rotate "+PurgeRedaction+" tomorrow" {
+			t.Errorf("Expected the note redacted, got %+v", notes)
+		}
+		blocks, _ := se.GetActivityBlocks(date, "Browser")
+		if len(blocks) != 1 || strings.Contains(blocks[0].OCRText, "hunter2") {
+			t.Errorf("Expected the block redacted, got %+v", blocks)
+		}
+		var indexed int
+		se.DB().QueryRow("SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH 'hunter2'").Scan(&indexed)
+		if indexed != 0 {
+			t.Errorf("Expected the term gone from the note index, got %d matches", indexed)
+		}
+		if _, err := se.StatScreenshot(se.GetScreenshotPath(date, "Browser", "1403.png")); !IsNotFound(err) {
+			t.Errorf("Expected the screenshot deleted, got %v", err)
+		}
+		if _, err := se.StatScreenshot(se.GetScreenshotPath(date, "Editor", "1403.png")); err != nil {
+			t.Errorf("Expected other screenshots kept, got %v", err)
+		}
+	})
+
+	t.Run("Purging an app deletes its blocks and screenshots", func(t *testing.T) {
+		report, err := se.Purge(PurgeRequest{App: "editor", Start: at.Add(-time.Hour), End: at.Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to purge: %v", err)
+		}
+		if report.Counts["block"] != 1 || report.Counts["screenshot"] != 1 || report.Counts["chat"] != 0 {
+			t.Errorf("Unexpected counts %v", report.Counts)
+		}
+		if blocks, _ := se.GetActivityBlocks(date, "Editor"); len(blocks) != 0 {
+			t.Errorf("Expected the app's blocks deleted, got %+v", blocks)
+		}
+		if _, err := se.StatScreenshot(se.GetScreenshotPath(date, "Editor", "1403.png")); !IsNotFound(err) {
+			t.Errorf("Expected the app's screenshot deleted, got %v", err)
+		}
+	})
+
+	t.Run("Restoring a flagged backup applies the purge again", func(t *testing.T) {
+		backups, err := backupMgr.ListBackups()
+		if err != nil || len(backups) != 1 || backups[0].Metadata["purgesPending"] != 1 {
+			t.Fatalf("Expected one backup with a pending purge, got %+v (%v)", backups, err)
+		}
+		if err := backupMgr.Restore(backupPath, RestoreOptions{}); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		chats, _ := se.GetChats(date)
+		if len(chats) != 1 || chats[0].Content != "my password is "+PurgeRedaction {
+			t.Errorf("Expected the chat redacted again, got %+v", chats)
+		}
+		// The app purge wasn't flagged
+		if blocks, _ := se.GetActivityBlocks(date, "Editor"); len(blocks) != 1 {
+			t.Errorf("Expected the unflagged purge not applied, got %+v", blocks)
+		}
+	})
+
+	t.Run("Rewriting backups purges the snapshots", func(t *testing.T) {
+		report, err := se.Purge(PurgeRequest{Term: "login form", Backups: PurgeBackupsRewrite})
+		if err != nil {
+			t.Fatalf("Failed to purge: %v", err)
+		}
+		if len(report.Errors) > 0 || report.Counts["block"] != 1 || report.BackupsRewritten != 1 || report.BackupsFlagged != 0 {
+			t.Errorf("Unexpected report %+v", report)
+		}
+		backups, _ := backupMgr.ListBackups()
+		if len(backups) != 1 || backups[0].Metadata["purgesPending"] != 1 {
+			t.Errorf("Expected only the flagged purge pending, got %+v", backups)
+		}
+		if err := backupMgr.Restore(backupPath, RestoreOptions{}); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if blocks, _ := se.GetActivityBlocks(date, "Browser"); len(blocks) != 0 {
+			t.Errorf("Expected the block gone from the snapshot, got %+v", blocks)
+		}
+		chats, _ := se.GetChats(date)
+		if len(chats) != 1 || chats[0].Content != "my password is "+PurgeRedaction {
+			t.Errorf("Expected the chat still readable, got %+v", chats)
+		}
+	})
+}
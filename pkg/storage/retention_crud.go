@@ -0,0 +1,124 @@
+package storage
+
+// retentionSession is a session with what retention rules are evaluated on.
+type retentionSession struct {
+	ID    int64
+	Date  string
+	Tags  []string
+	Apps  []retentionApp
+	Bytes int64 // Estimated size of the session's rows, including its apps
+	// Custom titles, summaries and chats are user content, so the session
+	// is archived rather than deleted
+	HasUserContent bool
+}
+
+// retentionApp is one app's activity within a session.
+type retentionApp struct {
+	ID    int64
+	Name  string
+	Bytes int64 // Estimated size of the app's activity blocks
+}
+
+// getRetentionSessions returns every session with its tags, apps and
+// estimated sizes, oldest first.
+func (sm *SessionManager) getRetentionSessions() ([]retentionSession, error) {
+	rows, err := sm.db.Query(`
+		SELECT s.id, s.date,
+			COALESCE(s.custom_title, '') != '' OR COALESCE(s.custom_summary, '') != ''
+				OR EXISTS (SELECT 1 FROM chats c WHERE c.session_id = s.id),
+			COALESCE(LENGTH(s.custom_title), 0) + COALESCE(LENGTH(s.custom_summary), 0)
+				+ COALESCE(LENGTH(s.original_summary), 0) + COALESCE(LENGTH(s.extracted_text_encrypted), 0)
+				+ COALESCE((SELECT SUM(LENGTH(c.content_encrypted)) FROM chats c WHERE c.session_id = s.id), 0)
+				+ COALESCE((SELECT SUM(LENGTH(n.content)) FROM manual_notes n WHERE n.session_id = s.id), 0)
+		FROM sessions s
+		ORDER BY s.date
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query sessions for retention", err)
+	}
+
+	var sessions []retentionSession
+	byID := make(map[int64]int)
+	for rows.Next() {
+		var s retentionSession
+		if err := rows.Scan(&s.ID, &s.Date, &s.HasUserContent, &s.Bytes); err != nil {
+			rows.Close()
+			return nil, NewStorageError(ErrDatabase, "failed to scan session", err)
+		}
+		byID[s.ID] = len(sessions)
+		sessions = append(sessions, s)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating sessions", err)
+	}
+
+	rows, err = sm.db.Query(`
+		SELECT aa.session_id, aa.id, aa.app_name,
+			COALESCE(SUM(COALESCE(LENGTH(ab.ocr_text_encrypted), 0) + COALESCE(LENGTH(ab.micro_summary), 0)), 0)
+		FROM app_activities aa
+		LEFT JOIN activity_blocks ab ON ab.app_activity_id = aa.id
+		GROUP BY aa.id
+		ORDER BY aa.session_id, aa.app_name
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query app activities for retention", err)
+	}
+	for rows.Next() {
+		var sessionID int64
+		var app retentionApp
+		if err := rows.Scan(&sessionID, &app.ID, &app.Name, &app.Bytes); err != nil {
+			rows.Close()
+			return nil, NewStorageError(ErrDatabase, "failed to scan app activity", err)
+		}
+		if i, ok := byID[sessionID]; ok {
+			sessions[i].Apps = append(sessions[i].Apps, app)
+			sessions[i].Bytes += app.Bytes
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating app activities", err)
+	}
+
+	rows, err = sm.db.Query(`
+		SELECT st.session_id, t.name
+		FROM session_tags st
+		JOIN tags t ON t.id = st.tag_id
+		ORDER BY t.name COLLATE NOCASE
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query session tags for retention", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID int64
+		var name string
+		if err := rows.Scan(&sessionID, &name); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan session tag", err)
+		}
+		if i, ok := byID[sessionID]; ok {
+			sessions[i].Tags = append(sessions[i].Tags, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating session tags", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteAppActivity deletes one app's activity in a session along with its
+// activity blocks.
+func (sm *SessionManager) DeleteAppActivity(id int64) error {
+	result, err := sm.db.Exec("DELETE FROM app_activities WHERE id = ?", id)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to delete app activity", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "app activity not found", nil)
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package storage
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -22,250 +24,495 @@ func NewRetentionManager(config *StorageConfig, storageEngine *StorageEngine) *R
 	}
 }
 
-// ApplyRetentionPolicy applies the retention policy to delete old sessions.
-func (rm *RetentionManager) ApplyRetentionPolicy() (*RetentionResult, error) {
-	result := &RetentionResult{
-		StartTime: time.Now(),
+// RetentionAction is what the retention policy does to an item.
+type RetentionAction string
+
+const (
+	RetentionDelete   RetentionAction = "delete"
+	RetentionArchive  RetentionAction = "archive"  // Files are moved to the archive directory before the session is deleted
+	RetentionCompress RetentionAction = "compress" // Screenshots re-encoded into the storage tier for their age
+)
+
+// RetentionItem is one thing the retention policy deletes, archives or
+// compresses.
+type RetentionItem struct {
+	Action      RetentionAction `json:"action"`
+	Kind        string          `json:"kind"` // session, activity, screenshot or orphan
+	SessionDate string          `json:"sessionDate,omitempty"`
+	AppName     string          `json:"appName,omitempty"`
+	Path        string          `json:"path,omitempty"` // Relative to the files directory
+	Bytes       int64           `json:"bytes"`          // Estimated database and file bytes
+	Reason      string          `json:"reason"`
+
+	appActivityID int64
+	tier          ScreenshotTier
+}
+
+// RetentionPlan lists everything applying the retention policy would do.
+type RetentionPlan struct {
+	GeneratedAt           time.Time       `json:"generatedAt"`
+	Items                 []RetentionItem `json:"items"`
+	SessionsDeleted       int             `json:"sessionsDeleted"`
+	SessionsArchived      int             `json:"sessionsArchived"`
+	ActivitiesDeleted     int             `json:"activitiesDeleted"`
+	ScreenshotsDeleted    int             `json:"screenshotsDeleted"`
+	ScreenshotsCompressed int             `json:"screenshotsCompressed"`
+	OrphanedFilesDeleted  int             `json:"orphanedFilesDeleted"`
+	RevisionsPruned       int             `json:"revisionsPruned"`
+	BytesDeleted          int64           `json:"bytesDeleted"`
+	BytesArchived         int64           `json:"bytesArchived"`
+	BytesCompressed       int64           `json:"bytesCompressed"` // Size of the screenshots before compression
+}
+
+func (p *RetentionPlan) add(item RetentionItem) {
+	p.Items = append(p.Items, item)
+	switch item.Action {
+	case RetentionDelete:
+		p.BytesDeleted += item.Bytes
+	case RetentionArchive:
+		p.BytesArchived += item.Bytes
+	case RetentionCompress:
+		p.BytesCompressed += item.Bytes
 	}
 
-	// Calculate cutoff date
-	retentionDuration := time.Duration(rm.config.RetentionDays) * 24 * time.Hour
-	cutoffDate := time.Now().Add(-retentionDuration)
+	switch {
+	case item.Kind == "session" && item.Action == RetentionArchive:
+		p.SessionsArchived++
+	case item.Kind == "session":
+		p.SessionsDeleted++
+	case item.Kind == "activity":
+		p.ActivitiesDeleted++
+	case item.Kind == "screenshot" && item.Action == RetentionCompress:
+		p.ScreenshotsCompressed++
+	case item.Kind == "screenshot":
+		p.ScreenshotsDeleted++
+	case item.Kind == "orphan":
+		p.OrphanedFilesDeleted++
+	}
+}
+
+// PlanRetention works out what ApplyRetentionPolicy would delete, archive
+// and compress without changing anything.
+//
+// Each app's activity in a session is kept for the period of the first
+// retention rule matching the app and the session's tags, or for
+// RetentionDays if none does. A session whose apps have all expired is
+// deleted, or archived if it has user content; otherwise only the expired
+// apps are deleted. Screenshot rules delete screenshot files on their own
+// schedule while the activity's text is kept.
+func (rm *RetentionManager) PlanRetention() (*RetentionPlan, error) {
+	if err := validateRetentionRules(rm.config.RetentionRules); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	plan := &RetentionPlan{GeneratedAt: now, Items: []RetentionItem{}}
+	filesDir := filepath.Join(rm.config.DataDir, "files")
 
-	// Get all sessions
-	sessions, _, err := rm.storageEngine.ListSessions(1, 10000) // Get all sessions
+	sessions, err := rm.storageEngine.sessionMgr.getRetentionSessions()
 	if err != nil {
-		return result, NewStorageError(ErrDatabase, "failed to list sessions for retention", err)
+		return nil, err
 	}
 
-	// Identify sessions to delete/archive
-	var sessionsToDelete []string
-	var sessionsToArchive []string
+	// Session and app file directories already covered by a plan item
+	removed := make(map[string]bool)
+	tagsByDate := make(map[string][]string, len(sessions))
 
 	for _, session := range sessions {
+		tagsByDate[session.Date] = session.Tags
+
 		sessionDate, err := time.Parse("2006-01-02", session.Date)
 		if err != nil {
 			continue // Skip invalid dates
 		}
 
-		if sessionDate.Before(cutoffDate) {
-			// Check if session should be archived instead of deleted
-			if rm.shouldArchive(session) {
-				sessionsToArchive = append(sessionsToArchive, session.Date)
-			} else {
-				sessionsToDelete = append(sessionsToDelete, session.Date)
+		var expired []RetentionItem
+		var reasons []string
+		if len(session.Apps) == 0 {
+			keepDays, reason := rm.retentionPeriod(RetentionTargetActivity, "", session.Tags)
+			if !retentionExpired(sessionDate, keepDays, now) {
+				continue
+			}
+			reasons = append(reasons, reason)
+		}
+		for _, app := range session.Apps {
+			keepDays, reason := rm.retentionPeriod(RetentionTargetActivity, app.Name, session.Tags)
+			if !retentionExpired(sessionDate, keepDays, now) {
+				continue
+			}
+			rel := filepath.Join(sanitizePathComponent(session.Date), sanitizePathComponent(app.Name))
+			expired = append(expired, RetentionItem{
+				Action:        RetentionDelete,
+				Kind:          "activity",
+				SessionDate:   session.Date,
+				AppName:       app.Name,
+				Path:          filepath.ToSlash(rel),
+				Bytes:         app.Bytes + rm.storedSize(filepath.ToSlash(rel)),
+				Reason:        reason,
+				appActivityID: app.ID,
+			})
+			if !slices.Contains(reasons, reason) {
+				reasons = append(reasons, reason)
 			}
 		}
-	}
 
-	// Archive sessions
-	for _, sessionDate := range sessionsToArchive {
-		if err := rm.archiveSession(sessionDate); err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("Failed to archive session %s: %v", sessionDate, err))
-		} else {
-			result.SessionsArchived++
+		if len(expired) < len(session.Apps) {
+			// Some apps are still kept, so only the expired ones go
+			for _, item := range expired {
+				removed[item.Path] = true
+				plan.add(item)
+			}
+			continue
 		}
-	}
 
-	// Delete sessions
-	for _, sessionDate := range sessionsToDelete {
-		if err := rm.storageEngine.DeleteSession(sessionDate); err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("Failed to delete session %s: %v", sessionDate, err))
-		} else {
-			result.SessionsDeleted++
+		rel := sanitizePathComponent(session.Date)
+		item := RetentionItem{
+			Action:      RetentionDelete,
+			Kind:        "session",
+			SessionDate: session.Date,
+			Path:        rel,
+			Bytes:       session.Bytes + rm.storedSize(rel),
+			Reason:      strings.Join(reasons, "; "),
 		}
+		if session.HasUserContent {
+			item.Action = RetentionArchive
+		}
+		removed[rel] = true
+		plan.add(item)
 	}
 
-	// Clean orphaned files
-	orphanedCount, err := rm.CleanOrphanedFiles()
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("Failed to clean orphaned files: %v", err))
-	} else {
-		result.OrphanedFilesDeleted = orphanedCount
+	if err := rm.planFiles(plan, filesDir, tagsByDate, removed, now); err != nil {
+		return nil, err
 	}
 
-	// Compress old screenshots
-	compressedCount, err := rm.CompressOldScreenshots()
+	maxAge := time.Duration(rm.config.RevisionRetentionDays) * 24 * time.Hour
+	revisions, err := rm.storageEngine.sessionMgr.CountPrunableRevisions(maxAge, rm.config.MaxRevisionsPerEntity)
 	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("Failed to compress screenshots: %v", err))
-	} else {
-		result.ScreenshotsCompressed = compressedCount
+		return nil, err
 	}
+	plan.RevisionsPruned = revisions
 
-	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime)
-
-	return result, nil
+	return plan, nil
 }
 
-// shouldArchive determines if a session should be archived instead of deleted.
-func (rm *RetentionManager) shouldArchive(session Session) bool {
-	// Archive sessions with custom titles or summaries (user-modified content)
-	if session.CustomTitle != "" || session.CustomSummary != "" {
-		return true
-	}
-
-	// Archive sessions with chat messages (user interactions)
-	chats, err := rm.storageEngine.GetChats(session.Date)
-	if err == nil && len(chats) > 0 {
-		return true
+// planFiles adds orphaned session files and expired or compressible
+// screenshots to the plan.
+func (rm *RetentionManager) planFiles(plan *RetentionPlan, filesDir string, tagsByDate map[string][]string, removed map[string]bool, now time.Time) error {
+	fm := rm.storageEngine.fileMgr
+	refs, err := fm.list("")
+	if err != nil {
+		return err
 	}
 
-	return false
-}
+	var orphans []string
+	orphanBytes := make(map[string]int64)
+	for _, ref := range refs {
+		sessionDate := sessionOf(ref.Path)
+		if removed[sessionDate] || removed[appPathOf(ref.Path)] {
+			continue
+		}
+		tags, ok := tagsByDate[sessionDate]
+		if !ok {
+			if _, seen := orphanBytes[sessionDate]; !seen {
+				orphans = append(orphans, sessionDate)
+			}
+			orphanBytes[sessionDate] += ref.Size
+			continue
+		}
 
-// archiveSession moves a session to the archive directory.
-func (rm *RetentionManager) archiveSession(sessionDate string) error {
-	// Create archive directory
-	archiveDir := filepath.Join(rm.config.DataDir, "archive")
-	if err := os.MkdirAll(archiveDir, 0755); err != nil {
-		return NewStorageError(ErrFileSystem, "failed to create archive directory", err)
+		parts := strings.Split(ref.Path, "/")
+		if len(parts) < 3 || !isImageFile(ref.Path) {
+			continue
+		}
+		item := RetentionItem{
+			Kind:        "screenshot",
+			SessionDate: sessionDate,
+			AppName:     parts[1],
+			Path:        ref.Path,
+			Bytes:       ref.Size,
+		}
+		keepDays, reason := rm.retentionPeriod(RetentionTargetScreenshots, parts[1], tags)
+		tier, tierDue := fm.screenshotTierDue(ref.Path, ref.ModTime, now)
+		switch {
+		case keepDays > 0 && ref.ModTime.Before(now.AddDate(0, 0, -keepDays)):
+			item.Action = RetentionDelete
+			item.Reason = reason
+		case tierDue && parts[2] == "screenshots":
+			item.Action = RetentionCompress
+			item.Reason = fmt.Sprintf("older than %d days: re-encode to the %s tier", tier.AfterDays, tier.Name)
+			item.tier = tier
+		default:
+			continue
+		}
+		plan.add(item)
 	}
 
-	// Move session files to archive
-	sessionFilesDir := filepath.Join(rm.config.DataDir, "files", sessionDate)
-	archiveFilesDir := filepath.Join(archiveDir, "files", sessionDate)
-	
-	if _, err := os.Stat(sessionFilesDir); err == nil {
-		if err := rm.moveDirectory(sessionFilesDir, archiveFilesDir); err != nil {
-			return NewStorageError(ErrFileSystem, "failed to move session files to archive", err)
+	// Directories an earlier version left outside the store
+	entries, err := os.ReadDir(filesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return NewStorageError(ErrFileSystem, "failed to read files directory", err)
+	}
+	for _, entry := range entries {
+		sessionDate := entry.Name()
+		if !entry.IsDir() || sessionDate == blobDir || removed[sessionDate] {
+			continue
+		}
+		if _, ok := tagsByDate[sessionDate]; ok {
+			continue
+		}
+		if _, seen := orphanBytes[sessionDate]; !seen {
+			orphans = append(orphans, sessionDate)
+		}
+		if fm.index != nil {
+			orphanBytes[sessionDate] += dirSize(filepath.Join(filesDir, sessionDate))
 		}
 	}
 
-	// Mark session as archived in database (add archive flag)
-	// For now, we'll just delete from main storage since archived sessions
-	// would need a separate table or flag system
-	return rm.storageEngine.DeleteSession(sessionDate)
+	for _, sessionDate := range orphans {
+		plan.add(RetentionItem{
+			Action:      RetentionDelete,
+			Kind:        "orphan",
+			SessionDate: sessionDate,
+			Path:        sessionDate,
+			Bytes:       orphanBytes[sessionDate],
+			Reason:      "no session for these files",
+		})
+	}
+	return nil
 }
 
-// moveDirectory moves a directory from src to dst.
-func (rm *RetentionManager) moveDirectory(src, dst string) error {
-	// Create destination directory
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
+// retentionPeriod returns the days data of the given target, app and
+// session tags is kept, 0 meaning forever, and a description of the rule
+// that set it. Screenshots matching no screenshot rule are kept with their
+// activity.
+func (rm *RetentionManager) retentionPeriod(target RetentionTarget, appName string, tags []string) (int, string) {
+	for i, rule := range rm.config.RetentionRules {
+		if !retentionRuleMatches(rule, target, appName, tags) {
+			continue
+		}
+		return rule.KeepDays, fmt.Sprintf("older than %d days (rule %d)", rule.KeepDays, i+1)
 	}
-
-	// Move directory
-	return os.Rename(src, dst)
+	if target == RetentionTargetScreenshots {
+		return 0, ""
+	}
+	return rm.config.RetentionDays, fmt.Sprintf("older than the %d-day retention period", rm.config.RetentionDays)
 }
 
-// CleanOrphanedFiles removes files that don't have corresponding database entries.
-func (rm *RetentionManager) CleanOrphanedFiles() (int, error) {
-	filesDir := filepath.Join(rm.config.DataDir, "files")
-	if _, err := os.Stat(filesDir); os.IsNotExist(err) {
-		return 0, nil // No files directory
+// retentionRuleMatches reports whether a rule applies to data of the given
+// target, app and session tags.
+func retentionRuleMatches(rule RetentionRule, target RetentionTarget, appName string, tags []string) bool {
+	ruleTarget := rule.Target
+	if ruleTarget == "" {
+		ruleTarget = RetentionTargetActivity
 	}
-
-	// Get all valid session IDs from database
-	sessions, _, err := rm.storageEngine.ListSessions(1, 10000)
-	if err != nil {
-		return 0, NewStorageError(ErrDatabase, "failed to get valid session IDs", err)
+	if ruleTarget != target {
+		return false
 	}
 
-	validSessionDates := make(map[string]bool)
-	for _, session := range sessions {
-		validSessionDates[session.Date] = true
+	if len(rule.Apps) > 0 {
+		matched := false
+		for _, pattern := range rule.Apps {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(appName)); ok && appName != "" {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
 	}
 
-	// Scan files directory for orphaned session directories
-	var orphanedCount int
-	entries, err := os.ReadDir(filesDir)
-	if err != nil {
-		return 0, NewStorageError(ErrFileSystem, "failed to read files directory", err)
+	if len(rule.Tags) > 0 {
+		for _, want := range rule.Tags {
+			for _, tag := range tags {
+				if want == "*" || strings.EqualFold(want, tag) {
+					return true
+				}
+			}
+		}
+		return false
 	}
+	return true
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			sessionDate := entry.Name()
-			if !validSessionDates[sessionDate] {
-				// This is an orphaned session directory
-				orphanedPath := filepath.Join(filesDir, sessionDate)
-				if err := os.RemoveAll(orphanedPath); err != nil {
-					continue // Log error but continue
-				}
-				orphanedCount++
+// validateRetentionRules checks rule targets, periods and app patterns.
+func validateRetentionRules(rules []RetentionRule) error {
+	for i, rule := range rules {
+		switch rule.Target {
+		case "", RetentionTargetActivity, RetentionTargetScreenshots:
+		default:
+			return NewStorageError(ErrValidation, fmt.Sprintf("retention rule %d: unknown target %q", i+1, rule.Target), nil)
+		}
+		if rule.KeepDays < 0 {
+			return NewStorageError(ErrValidation, fmt.Sprintf("retention rule %d: keepDays must not be negative", i+1), nil)
+		}
+		for _, pattern := range rule.Apps {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return NewStorageError(ErrValidation, fmt.Sprintf("retention rule %d: invalid app pattern %q", i+1, pattern), err)
 			}
 		}
 	}
+	return nil
+}
 
-	return orphanedCount, nil
+// retentionExpired reports whether data from a session date is past a
+// retention period of keepDays. Zero keeps data forever.
+func retentionExpired(sessionDate time.Time, keepDays int, now time.Time) bool {
+	return keepDays > 0 && sessionDate.Before(now.AddDate(0, 0, -keepDays))
 }
 
-// CompressOldScreenshots compresses screenshots older than 30 days.
-func (rm *RetentionManager) CompressOldScreenshots() (int, error) {
-	filesDir := filepath.Join(rm.config.DataDir, "files")
-	if _, err := os.Stat(filesDir); os.IsNotExist(err) {
-		return 0, nil // No files directory
+// storedSize returns the total size of the stored files at or below a
+// logical path.
+func (rm *RetentionManager) storedSize(prefix string) int64 {
+	refs, _ := rm.storageEngine.fileMgr.list(prefix)
+	var size int64
+	for _, ref := range refs {
+		size += ref.Size
 	}
+	return size
+}
 
-	cutoffDate := time.Now().Add(-30 * 24 * time.Hour)
-	var compressedCount int
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
 
-	err := filepath.Walk(filesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// ApplyRetentionPolicy carries out the retention plan and prunes edit
+// history.
+func (rm *RetentionManager) ApplyRetentionPolicy() (*RetentionResult, error) {
+	result := &RetentionResult{
+		StartTime: time.Now(),
+	}
+
+	plan, err := rm.PlanRetention()
+	if err != nil {
+		return result, err
+	}
+
+	// Deletes go through the engine's writer; DeleteSession routes its own
+	se := rm.storageEngine
+	fm := se.fileMgr
+	remove := func(path string) error {
+		return se.exclusive(func() error {
+			_, err := fm.remove(path)
 			return err
+		})
+	}
+	for _, item := range plan.Items {
+		var err error
+		switch {
+		case item.Kind == "session" && item.Action == RetentionArchive:
+			if err = rm.archiveSession(item.SessionDate); err == nil {
+				result.SessionsArchived++
+			}
+		case item.Kind == "session":
+			if err = rm.storageEngine.DeleteSession(item.SessionDate); err == nil {
+				result.SessionsDeleted++
+			}
+		case item.Kind == "activity":
+			err = se.exclusive(func() error {
+				return se.sessionMgr.DeleteAppActivity(item.appActivityID)
+			})
+			if err == nil {
+				err = remove(item.Path)
+				result.ActivitiesDeleted++
+			}
+		case item.Kind == "screenshot" && item.Action == RetentionCompress:
+			err = se.exclusive(func() error {
+				_, err := fm.reencodeScreenshot(item.Path, item.tier)
+				return err
+			})
+			if err == nil {
+				result.ScreenshotsCompressed++
+			}
+		case item.Kind == "screenshot":
+			if err = remove(item.Path); err == nil {
+				result.ScreenshotsDeleted++
+			}
+		case item.Kind == "orphan":
+			if err = remove(item.Path); err == nil {
+				result.OrphanedFilesDeleted++
+			}
 		}
 
-		// Check if it's a screenshot file
-		if !info.IsDir() && rm.isScreenshotFile(path) {
-			// Check if file is older than 30 days
-			if info.ModTime().Before(cutoffDate) {
-				// Check if already compressed
-				if !strings.HasSuffix(path, ".gz") {
-					if err := rm.compressFile(path); err != nil {
-						// Log error but continue
-						return nil
-					}
-					compressedCount++
-				}
-			}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to %s %s %s: %v", item.Action, item.Kind, item.Path, err))
+		} else if item.Action != RetentionCompress {
+			result.BytesFreed += item.Bytes
 		}
+	}
 
-		return nil
+	// Delete blobs no file has referenced for the grace period
+	var blobs int
+	var freed int64
+	err = se.exclusive(func() (err error) {
+		blobs, freed, err = fm.CollectGarbage(DefaultBlobGracePeriod)
+		return err
 	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to collect garbage: %v", err))
+	}
+	result.BlobsDeleted = blobs
+	result.BlobBytesFreed = freed
 
+	// Prune edit history
+	prunedCount, err := rm.storageEngine.PruneRevisions()
 	if err != nil {
-		return compressedCount, NewStorageError(ErrFileSystem, "failed to walk files directory", err)
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to prune revisions: %v", err))
+	} else {
+		result.RevisionsPruned = prunedCount
 	}
 
-	return compressedCount, nil
-}
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
 
-// isScreenshotFile checks if a file is a screenshot based on extension.
-func (rm *RetentionManager) isScreenshotFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	return ext == ".png" || ext == ".jpg" || ext == ".jpeg"
+	return result, nil
 }
 
-// compressFile compresses a file using gzip.
-func (rm *RetentionManager) compressFile(path string) error {
-	// Read original file
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return err
+// archiveSession moves a session to the archive directory.
+func (rm *RetentionManager) archiveSession(sessionDate string) error {
+	// Create archive directory
+	archiveDir := filepath.Join(rm.config.DataDir, "archive")
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to create archive directory", err)
 	}
 
-	// Compress data
-	compressedData, err := rm.gzipCompress(data)
-	if err != nil {
-		return err
+	// Move session files to archive
+	if _, err := rm.storageEngine.fileMgr.MoveFiles(sanitizePathComponent(sessionDate), filepath.Join(archiveDir, "files")); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to move session files to archive", err)
 	}
 
-	// Write compressed file
-	compressedPath := path + ".gz"
-	if err := os.WriteFile(compressedPath, compressedData, 0644); err != nil {
-		return err
-	}
+	// Mark session as archived in database (add archive flag)
+	// For now, we'll just delete from main storage since archived sessions
+	// would need a separate table or flag system
+	return rm.storageEngine.DeleteSession(sessionDate)
+}
 
-	// Remove original file
-	return os.Remove(path)
+// CleanOrphanedFiles removes files that don't have corresponding database entries.
+func (rm *RetentionManager) CleanOrphanedFiles() (int, error) {
+	// Get all valid session dates from database
+	var validSessionDates []string
+	err := rm.storageEngine.IterateSessions(SessionQuery{WithoutText: true}, func(session Session) error {
+		validSessionDates = append(validSessionDates, session.Date)
+		return nil
+	})
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to get valid session IDs", err)
+	}
+	return rm.storageEngine.fileMgr.CleanOrphanedFiles(validSessionDates)
 }
 
-// gzipCompress compresses data using gzip.
-func (rm *RetentionManager) gzipCompress(data []byte) ([]byte, error) {
-	// Simple compression simulation for now
-	// In a real implementation, you'd use compress/gzip
-	return data, nil // Return uncompressed for now
+// CompressOldScreenshots re-encodes screenshots into the storage tier for
+// their age.
+func (rm *RetentionManager) CompressOldScreenshots() (int, error) {
+	return rm.storageEngine.fileMgr.TierScreenshots(0)
 }
 
 // GetRetentionStats returns statistics about retention policy application.
@@ -279,25 +526,12 @@ func (rm *RetentionManager) GetRetentionStats() (*RetentionStats, error) {
 	}
 	stats.TotalSessions = totalCount
 
-	// Calculate sessions by age
-	cutoffDate := time.Now().Add(-time.Duration(rm.config.RetentionDays) * 24 * time.Hour)
-	
-	// Get all sessions to analyze
-	allSessions, _, err := rm.storageEngine.ListSessions(1, 10000)
+	// Sessions the retention policy would remove
+	plan, err := rm.PlanRetention()
 	if err != nil {
 		return stats, err
 	}
-
-	for _, session := range allSessions {
-		sessionDate, err := time.Parse("2006-01-02", session.Date)
-		if err != nil {
-			continue
-		}
-
-		if sessionDate.Before(cutoffDate) {
-			stats.SessionsEligibleForDeletion++
-		}
-	}
+	stats.SessionsEligibleForDeletion = plan.SessionsDeleted + plan.SessionsArchived
 
 	// Get file statistics
 	if rm.storageEngine.fileMgr != nil {
@@ -313,14 +547,20 @@ func (rm *RetentionManager) GetRetentionStats() (*RetentionStats, error) {
 
 // RetentionResult contains the results of applying retention policy.
 type RetentionResult struct {
-	StartTime              time.Time     `json:"startTime"`
-	EndTime                time.Time     `json:"endTime"`
-	Duration               time.Duration `json:"duration"`
-	SessionsDeleted        int           `json:"sessionsDeleted"`
-	SessionsArchived       int           `json:"sessionsArchived"`
-	OrphanedFilesDeleted   int           `json:"orphanedFilesDeleted"`
-	ScreenshotsCompressed  int           `json:"screenshotsCompressed"`
-	Errors                 []string      `json:"errors,omitempty"`
+	StartTime             time.Time     `json:"startTime"`
+	EndTime               time.Time     `json:"endTime"`
+	Duration              time.Duration `json:"duration"`
+	SessionsDeleted       int           `json:"sessionsDeleted"`
+	SessionsArchived      int           `json:"sessionsArchived"`
+	ActivitiesDeleted     int           `json:"activitiesDeleted"`
+	OrphanedFilesDeleted  int           `json:"orphanedFilesDeleted"`
+	ScreenshotsDeleted    int           `json:"screenshotsDeleted"`
+	ScreenshotsCompressed int           `json:"screenshotsCompressed"`
+	RevisionsPruned       int           `json:"revisionsPruned"`
+	BytesFreed            int64         `json:"bytesFreed"` // Estimated, including archived sessions
+	BlobsDeleted          int           `json:"blobsDeleted"`
+	BlobBytesFreed        int64         `json:"blobBytesFreed"` // Measured; blobs are kept for a grace period after release
+	Errors                []string      `json:"errors,omitempty"`
 }
 
 // RetentionStats contains statistics about the retention policy.
@@ -329,4 +569,4 @@ type RetentionStats struct {
 	SessionsEligibleForDeletion int   `json:"sessionsEligibleForDeletion"`
 	TotalFiles                  int64 `json:"totalFiles"`
 	TotalSizeBytes              int64 `json:"totalSizeBytes"`
-}
\ No newline at end of file
+}
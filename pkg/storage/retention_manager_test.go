@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
 	"os"
+	"path"
 	"path/filepath"
 	"testing"
 	"time"
@@ -210,11 +215,12 @@ func TestRetentionStats(t *testing.T) {
 	}
 }
 
-// TestScreenshotCompression tests screenshot compression functionality
+// TestScreenshotCompression tests moving screenshots through the storage
+// tiers as they age
 func TestScreenshotCompression(t *testing.T) {
 	tempDir := t.TempDir()
 	storageDir := filepath.Join(tempDir, "storage")
-	
+
 	config := DefaultStorageConfig(storageDir)
 	storageEngine := NewStorageEngine(config)
 	if err := storageEngine.Initialize(); err != nil {
@@ -228,35 +234,201 @@ func TestScreenshotCompression(t *testing.T) {
 		t.Fatalf("Failed to create session: %v", err)
 	}
 
-	// Create old screenshot file
-	filesDir := filepath.Join(storageDir, "files", sessionDate, "TestApp")
-	if err := os.MkdirAll(filesDir, 0755); err != nil {
-		t.Fatalf("Failed to create files directory: %v", err)
+	img := image.NewRGBA(image.Rect(0, 0, 2400, 1200))
+	for x := 0; x < 2400; x++ {
+		img.Set(x, x%1200, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode screenshot: %v", err)
+	}
+	if _, err := storageEngine.SaveScreenshot(sessionDate, "TestApp", "old_screenshot.png", buf.Bytes()); err != nil {
+		t.Fatalf("Failed to save screenshot: %v", err)
 	}
 
-	screenshotPath := filepath.Join(filesDir, "old_screenshot.png")
-	screenshotData := []byte("fake screenshot data")
-	if err := os.WriteFile(screenshotPath, screenshotData, 0644); err != nil {
-		t.Fatalf("Failed to create screenshot file: %v", err)
+	// Screenshots saved by older versions were renamed to .gz
+	legacyPath := path.Join(sessionDate, "TestApp", "screenshots", "legacy.png.gz")
+	if err := storageEngine.fileMgr.put(FileRef{Path: legacyPath}, buf.Bytes()); err != nil {
+		t.Fatalf("Failed to create legacy screenshot: %v", err)
 	}
 
-	// Set file modification time to 35 days ago
-	oldTime := time.Now().Add(-35 * 24 * time.Hour)
-	if err := os.Chtimes(screenshotPath, oldTime, oldTime); err != nil {
-		t.Fatalf("Failed to set file time: %v", err)
+	width := func(path string) int {
+		t.Helper()
+		f, err := storageEngine.OpenScreenshot(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		return cfg.Width
+	}
+	age := func(days int) {
+		t.Helper()
+		oldTime := time.Now().AddDate(0, 0, -days)
+		for _, name := range []string{"old_screenshot.png", "legacy.png"} {
+			if err := storageEngine.fileMgr.SetFileTime(storageEngine.GetScreenshotPath(sessionDate, "TestApp", name), oldTime); err != nil {
+				t.Fatalf("Failed to set file time: %v", err)
+			}
+		}
+	}
+
+	if w := width(storageEngine.GetThumbnailPath(sessionDate, "TestApp", "old_screenshot.png")); w != 320 {
+		t.Errorf("Expected a 320px thumbnail, got %dpx", w)
 	}
 
 	// Create retention manager
 	retentionMgr := NewRetentionManager(config, storageEngine)
 
-	// Compress old screenshots
-	compressedCount, err := retentionMgr.CompressOldScreenshots()
+	for _, tier := range []struct {
+		days  int
+		name  string
+		width int
+	}{{10, "reduced", 1920}, {35, "archive", 1280}} {
+		age(tier.days)
+		compressedCount, err := retentionMgr.CompressOldScreenshots()
+		if err != nil {
+			t.Fatalf("Failed to compress screenshots: %v", err)
+		}
+		if compressedCount != 2 {
+			t.Errorf("Expected 2 re-encoded files, got %d", compressedCount)
+		}
+
+		path := storageEngine.GetScreenshotPath(sessionDate, "TestApp", "old_screenshot.png")
+		if filepath.Base(path) != "old_screenshot~"+tier.name+".jpg" || width(path) != tier.width {
+			t.Errorf("Expected a %dpx %s screenshot, got %s", tier.width, tier.name, path)
+		}
+		info, _ := storageEngine.StatScreenshot(path)
+		if time.Since(info.ModTime) < time.Duration(tier.days-1)*24*time.Hour {
+			t.Errorf("Re-encoding reset the screenshot's age: %v", info.ModTime)
+		}
+	}
+
+	if count, _ := retentionMgr.CompressOldScreenshots(); count != 0 {
+		t.Errorf("Expected nothing left to re-encode, got %d", count)
+	}
+
+	stats, err := storageEngine.fileMgr.GetStorageStats()
 	if err != nil {
-		t.Fatalf("Failed to compress screenshots: %v", err)
+		t.Fatalf("Failed to get storage stats: %v", err)
+	}
+	if stats.ScreenshotCount != 2 || stats.TierFiles["archive"] != 2 || stats.TierFiles[ScreenshotTierThumbnail] != 2 ||
+		stats.TierBytes["archive"] == 0 || stats.TierFiles[ScreenshotTierOriginal] != 0 {
+		t.Errorf("Unexpected tier stats: %+v", stats)
 	}
+}
+
+// TestRetentionRules tests per-app, per-tag and screenshot retention rules
+// and that applying the policy does exactly what the preview reported.
+func TestRetentionRules(t *testing.T) {
+	config := DefaultStorageConfig(t.TempDir())
+	config.RetentionRules = []RetentionRule{
+		{Tags: []string{"keep"}},
+		{Apps: []string{"slack*"}, KeepDays: 30},
+		{Target: RetentionTargetScreenshots, KeepDays: 7},
+	}
+	storageEngine := NewStorageEngine(config)
+	if err := storageEngine.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage engine: %v", err)
+	}
+	defer storageEngine.Close()
 
-	// For now, compression is a no-op, so count should be 1 but file should still exist
-	if compressedCount != 1 {
-		t.Errorf("Expected 1 compressed file, got %d", compressedCount)
+	today := time.Now()
+	addSession := func(daysAgo int, apps ...string) *Session {
+		date := today.AddDate(0, 0, -daysAgo).Format("2006-01-02")
+		session, err := storageEngine.CreateSession(date)
+		if err != nil {
+			// Sessions created on the same date share a row
+			if session, err = storageEngine.GetSession(date); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+		}
+		for i, app := range apps {
+			start := today.AddDate(0, 0, -daysAgo).Add(time.Duration(i) * time.Hour)
+			block := &ActivityBlock{BlockID: app, StartTime: start, EndTime: start.Add(time.Minute), OCRText: "text from " + app, MicroSummary: "summary"}
+			if err := storageEngine.AddActivityBlock(date, app, block); err != nil {
+				t.Fatalf("Failed to add block: %v", err)
+			}
+			if _, err := storageEngine.SaveScreenshot(date, app, "shot.png", []byte("png data")); err != nil {
+				t.Fatalf("Failed to save screenshot: %v", err)
+			}
+		}
+		return session
 	}
-}
\ No newline at end of file
+
+	mixed := addSession(60, "Slack", "Code") // Slack expires, Code is kept
+	slackOnly := addSession(61, "Slack")     // Every app expired
+	tagged := addSession(62, "Slack")        // Protected by its tag
+	ancient := addSession(400, "Code")       // Past the default period
+	recent := addSession(10, "Code")         // Only its screenshot expires
+	if _, err := storageEngine.TagItem(TagTargetSession, int64(tagged.ID), "Keep"); err != nil {
+		t.Fatalf("Failed to tag session: %v", err)
+	}
+	old := today.Add(-10 * 24 * time.Hour)
+	for _, session := range []*Session{mixed, tagged, recent} {
+		for _, app := range []string{"Code", "Slack"} {
+			storageEngine.fileMgr.SetFileTime(storageEngine.GetScreenshotPath(session.Date, app, "shot.png"), old)
+		}
+	}
+
+	plan, err := storageEngine.PreviewRetentionPolicy()
+	if err != nil {
+		t.Fatalf("Failed to preview retention: %v", err)
+	}
+	if plan.SessionsDeleted != 2 || plan.SessionsArchived != 0 || plan.ActivitiesDeleted != 1 || plan.ScreenshotsDeleted != 3 {
+		t.Errorf("Unexpected plan totals: %+v", plan)
+	}
+	for _, item := range plan.Items {
+		if item.Bytes <= 0 || item.Reason == "" {
+			t.Errorf("Expected a size and reason for %+v", item)
+		}
+		if item.Kind == "activity" && (item.SessionDate != mixed.Date || item.AppName != "Slack") {
+			t.Errorf("Unexpected activity in plan: %+v", item)
+		}
+		if item.SessionDate == tagged.Date && item.Kind != "screenshot" {
+			t.Errorf("Tagged session should only lose screenshots: %+v", item)
+		}
+	}
+	if plan.BytesDeleted == 0 {
+		t.Error("Expected a byte estimate")
+	}
+
+	// The preview changes nothing
+	if blocks, _ := storageEngine.GetActivityBlocks(mixed.Date, "Slack"); len(blocks) != 1 {
+		t.Errorf("Preview deleted activity: %d blocks left", len(blocks))
+	}
+
+	result, err := storageEngine.ApplyRetentionPolicy()
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	if result.SessionsDeleted != plan.SessionsDeleted || result.ActivitiesDeleted != plan.ActivitiesDeleted ||
+		result.ScreenshotsDeleted != plan.ScreenshotsDeleted || result.BytesFreed != plan.BytesDeleted || len(result.Errors) != 0 {
+		t.Errorf("Result %+v does not match plan %+v", result, plan)
+	}
+
+	for _, date := range []string{slackOnly.Date, ancient.Date} {
+		if _, err := storageEngine.GetSession(date); err == nil {
+			t.Errorf("Session %s should be deleted", date)
+		}
+	}
+	if blocks, _ := storageEngine.GetActivityBlocks(mixed.Date, "Slack"); len(blocks) != 0 {
+		t.Errorf("Expected Slack activity to be deleted, got %d blocks", len(blocks))
+	}
+	if blocks, _ := storageEngine.GetActivityBlocks(mixed.Date, "Code"); len(blocks) != 1 || blocks[0].OCRText == "" {
+		t.Errorf("Expected Code activity and its text to be kept, got %+v", blocks)
+	}
+	if blocks, _ := storageEngine.GetActivityBlocks(tagged.Date, "Slack"); len(blocks) != 1 {
+		t.Errorf("Expected tagged session's activity to be kept, got %d blocks", len(blocks))
+	}
+	if _, err := storageEngine.StatScreenshot(storageEngine.GetScreenshotPath(recent.Date, "Code", "shot.png")); !IsNotFound(err) {
+		t.Errorf("Expected the old screenshot to be deleted: %v", err)
+	}
+
+	config.RetentionRules = []RetentionRule{{Apps: []string{"[slack"}, KeepDays: 30}}
+	if _, err := storageEngine.PreviewRetentionPolicy(); !IsValidation(err) {
+		t.Errorf("Expected a validation error for a bad pattern, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// revisionTable describes where the fields tracked by revisions of one kind
+// of item are stored.
+type revisionTable struct {
+	table    string
+	columns  []string
+	notFound error
+}
+
+var revisionTables = map[RevisionEntity]revisionTable{
+	RevisionEntitySession: {
+		table:    "sessions",
+		columns:  []string{"custom_title", "custom_summary", "original_summary", "ai_summary", "ai_bullets", "entities_json"},
+		notFound: ErrSessionNotFound,
+	},
+	RevisionEntityCard: {
+		table:    "knowledge_cards",
+		columns:  []string{"title", "bullets", "entities", "status"},
+		notFound: NewStorageError(ErrNotFound, "knowledge card not found", nil),
+	},
+}
+
+func getRevisionTable(entity RevisionEntity) (revisionTable, error) {
+	rt, ok := revisionTables[entity]
+	if !ok {
+		return revisionTable{}, NewStorageError(ErrValidation, "unknown revision entity "+string(entity), nil)
+	}
+	return rt, nil
+}
+
+// readRevisionFields reads the tracked fields of an item. NULL reads as "".
+func readRevisionFields(tx *sql.Tx, rt revisionTable, id int64) (map[string]string, error) {
+	values := make([]sql.NullString, len(rt.columns))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	query := "SELECT " + strings.Join(rt.columns, ", ") + " FROM " + rt.table + " WHERE id = ?"
+	err := tx.QueryRow(query, id).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, rt.notFound
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to read "+rt.table+" fields", err)
+	}
+
+	fields := make(map[string]string, len(rt.columns))
+	for i, column := range rt.columns {
+		fields[column] = values[i].String
+	}
+	return fields, nil
+}
+
+// updateWithRevision runs update in a transaction and records the changes it
+// made to the item's tracked fields as a revision by actor. Updates that
+// leave the tracked fields alone record nothing.
+func (sm *SessionManager) updateWithRevision(entity RevisionEntity, id int64, actor RevisionActor, update func(tx *sql.Tx) error) error {
+	rt, err := getRevisionTable(entity)
+	if err != nil {
+		return err
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	before, err := readRevisionFields(tx, rt, id)
+	if err != nil {
+		return err
+	}
+	if err := update(tx); err != nil {
+		return err
+	}
+	after, err := readRevisionFields(tx, rt, id)
+	if err != nil {
+		return err
+	}
+
+	changes := make(map[string]FieldChange)
+	for column, old := range before {
+		if value := after[column]; value != old {
+			changes[column] = FieldChange{Old: old, New: value}
+		}
+	}
+	if len(changes) > 0 {
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to encode revision", err)
+		}
+		_, err = tx.Exec(`INSERT INTO revisions (entity_type, entity_id, actor, changes_json, created_at)
+			VALUES (?, ?, ?, ?, ?)`, entity, id, actor, string(changesJSON), time.Now())
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to record revision", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit update", err)
+	}
+	return nil
+}
+
+// GetRevisions returns the revisions of a session or knowledge card, newest
+// first.
+func (sm *SessionManager) GetRevisions(entity RevisionEntity, id int64) ([]Revision, error) {
+	if _, err := getRevisionTable(entity); err != nil {
+		return nil, err
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT id, entity_type, entity_id, actor, changes_json, created_at
+		FROM revisions
+		WHERE entity_type = ? AND entity_id = ?
+		ORDER BY id DESC
+	`, entity, id)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query revisions", err)
+	}
+	defer rows.Close()
+
+	return scanRevisions(rows)
+}
+
+// scanRevisions scans revision rows.
+func scanRevisions(rows *sql.Rows) ([]Revision, error) {
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		var changesJSON string
+		err := rows.Scan(&revision.ID, &revision.EntityType, &revision.EntityID, &revision.Actor,
+			&changesJSON, &revision.CreatedAt)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan revision", err)
+		}
+		if err := json.Unmarshal([]byte(changesJSON), &revision.Changes); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to decode revision changes", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating revisions", err)
+	}
+
+	return revisions, nil
+}
+
+// RestoreRevision returns an item's tracked fields to the values they had
+// before the revision was made, undoing it and every later revision. The
+// restore is itself recorded as a revision by the user, so it can be undone.
+func (sm *SessionManager) RestoreRevision(revisionID int64) error {
+	var entity RevisionEntity
+	var entityID int64
+	err := sm.db.QueryRow("SELECT entity_type, entity_id FROM revisions WHERE id = ?", revisionID).
+		Scan(&entity, &entityID)
+	if err == sql.ErrNoRows {
+		return NewStorageError(ErrNotFound, "revision not found", nil)
+	}
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get revision", err)
+	}
+
+	rt, err := getRevisionTable(entity)
+	if err != nil {
+		return err
+	}
+
+	return sm.updateWithRevision(entity, entityID, RevisionActorUser, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`
+			SELECT id, entity_type, entity_id, actor, changes_json, created_at
+			FROM revisions
+			WHERE entity_type = ? AND entity_id = ? AND id >= ?
+			ORDER BY id DESC
+		`, entity, entityID, revisionID)
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to query revisions", err)
+		}
+		later, err := scanRevisions(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		// Walk back from the newest revision so the oldest old value wins
+		fields := make(map[string]string)
+		for _, revision := range later {
+			for column, change := range revision.Changes {
+				fields[column] = change.Old
+			}
+		}
+
+		var set []string
+		var args []interface{}
+		for _, column := range rt.columns {
+			if value, ok := fields[column]; ok {
+				set = append(set, column+" = ?")
+				args = append(args, value)
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		set = append(set, "updated_at = ?")
+		args = append(args, time.Now(), entityID)
+
+		_, err = tx.Exec("UPDATE "+rt.table+" SET "+strings.Join(set, ", ")+" WHERE id = ?", args...)
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to restore revision", err)
+		}
+		return nil
+	})
+}
+
+// PruneRevisions deletes revisions older than maxAge and all but the newest
+// keep revisions of each item. A zero maxAge or keep disables that rule.
+// Returns the number of revisions deleted.
+func (sm *SessionManager) PruneRevisions(maxAge time.Duration, keep int) (int, error) {
+	expired, err := sm.expiredRevisions(maxAge, keep)
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range expired {
+		if _, err := tx.Exec("DELETE FROM revisions WHERE id = ?", id); err != nil {
+			return 0, NewStorageError(ErrDatabase, "failed to delete revision", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, NewStorageError(ErrDatabase, "failed to commit revision pruning", err)
+	}
+	return len(expired), nil
+}
+
+// CountPrunableRevisions returns the number of revisions PruneRevisions
+// would delete.
+func (sm *SessionManager) CountPrunableRevisions(maxAge time.Duration, keep int) (int, error) {
+	expired, err := sm.expiredRevisions(maxAge, keep)
+	return len(expired), err
+}
+
+// expiredRevisions returns the IDs of revisions past maxAge or beyond the
+// newest keep revisions of their item.
+func (sm *SessionManager) expiredRevisions(maxAge time.Duration, keep int) ([]int64, error) {
+	if maxAge <= 0 && keep <= 0 {
+		return nil, nil
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT id, entity_type, entity_id, created_at
+		FROM revisions
+		ORDER BY entity_type, entity_id, id DESC
+	`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query revisions", err)
+	}
+
+	// Timestamps are compared here rather than in SQL since they are stored
+	// as text with their zone offset
+	cutoff := time.Now().Add(-maxAge)
+	var expired []int64
+	var lastEntity string
+	var lastID int64
+	var kept int
+	for rows.Next() {
+		var id, entityID int64
+		var entity string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &entity, &entityID, &createdAt); err != nil {
+			rows.Close()
+			return nil, NewStorageError(ErrDatabase, "failed to scan revision", err)
+		}
+		if entity != lastEntity || entityID != lastID {
+			lastEntity, lastID, kept = entity, entityID, 0
+		}
+		kept++
+		if (keep > 0 && kept > keep) || (maxAge > 0 && createdAt.Before(cutoff)) {
+			expired = append(expired, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating revisions", err)
+	}
+	return expired, nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// TestRevisions tests the edit history of sessions and knowledge cards,
+// restoring revisions and pruning old ones.
+func TestRevisions(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := &Session{Date: "2025-07-01", CustomTitle: "Draft"}
+	if err := sm.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sessionID := int64(session.ID)
+
+	t.Run("Updates record actor and diff", func(t *testing.T) {
+		session.CustomTitle = "Release prep"
+		if err := sm.Update(session); err != nil {
+			t.Fatalf("Failed to update session: %v", err)
+		}
+		if err := sm.UpdateSessionSynthesis(sessionID, "[]", "completed", "AI summary v1", "[]"); err != nil {
+			t.Fatalf("Failed to update synthesis: %v", err)
+		}
+		if err := sm.UpdateSessionSynthesis(sessionID, "[]", "completed", "AI summary v2", "[]"); err != nil {
+			t.Fatalf("Failed to update synthesis: %v", err)
+		}
+		// Saving unchanged fields records nothing
+		if err := sm.UpdateSessionSynthesis(sessionID, "[]", "completed", "AI summary v2", "[]"); err != nil {
+			t.Fatalf("Failed to update synthesis: %v", err)
+		}
+
+		revisions, err := sm.GetRevisions(RevisionEntitySession, sessionID)
+		if err != nil || len(revisions) != 3 {
+			t.Fatalf("Expected 3 revisions, got %+v (%v)", revisions, err)
+		}
+		if revisions[2].Actor != RevisionActorUser || revisions[0].Actor != RevisionActorSynthesis {
+			t.Errorf("Unexpected actors: %s, %s", revisions[2].Actor, revisions[0].Actor)
+		}
+		want := FieldChange{Old: "Draft", New: "Release prep"}
+		if got := revisions[2].Changes["custom_title"]; got != want || len(revisions[2].Changes) != 1 {
+			t.Errorf("Expected only the title change, got %+v", revisions[2].Changes)
+		}
+		if got := revisions[0].Changes["ai_summary"]; got.Old != "AI summary v1" || got.New != "AI summary v2" {
+			t.Errorf("Unexpected summary change: %+v", got)
+		}
+
+		if err := sm.Update(&Session{ID: 9999, Date: "2025-07-02"}); !IsNotFound(err) {
+			t.Errorf("Expected not found for missing session, got %v", err)
+		}
+	})
+
+	t.Run("Restore undoes later revisions", func(t *testing.T) {
+		revisions, _ := sm.GetRevisions(RevisionEntitySession, sessionID)
+		// Undo both synthesis runs
+		if err := sm.RestoreRevision(int64(revisions[1].ID)); err != nil {
+			t.Fatalf("Failed to restore revision: %v", err)
+		}
+
+		got, err := sm.GetByID(sessionID)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if got.AISummary != "" || got.CustomTitle != "Release prep" {
+			t.Errorf("Expected the summary undone and the title kept, got %q / %q", got.AISummary, got.CustomTitle)
+		}
+
+		revisions, _ = sm.GetRevisions(RevisionEntitySession, sessionID)
+		if len(revisions) != 4 || revisions[0].Actor != RevisionActorUser {
+			t.Fatalf("Expected the restore to be recorded, got %+v", revisions)
+		}
+		// The restore itself can be undone
+		if err := sm.RestoreRevision(int64(revisions[0].ID)); err != nil {
+			t.Fatalf("Failed to undo restore: %v", err)
+		}
+		if got, _ := sm.GetByID(sessionID); got.AISummary != "AI summary v2" {
+			t.Errorf("Expected the summary back, got %q", got.AISummary)
+		}
+
+		if err := sm.RestoreRevision(9999); !IsNotFound(err) {
+			t.Errorf("Expected not found for missing revision, got %v", err)
+		}
+	})
+
+	t.Run("Knowledge cards", func(t *testing.T) {
+		result, err := sm.db.Exec(`INSERT INTO knowledge_cards (session_id, title, bullets, entities, status)
+			VALUES (?, 'Card', '["a"]', '[]', 'completed')`, sessionID)
+		if err != nil {
+			t.Fatalf("Failed to insert card: %v", err)
+		}
+		cardID, _ := result.LastInsertId()
+
+		err = sm.updateWithRevision(RevisionEntityCard, cardID, RevisionActorUser, func(tx *sql.Tx) error {
+			_, err := tx.Exec("UPDATE knowledge_cards SET bullets = ? WHERE id = ?", `["b"]`, cardID)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to update card: %v", err)
+		}
+		revisions, err := sm.GetRevisions(RevisionEntityCard, cardID)
+		if err != nil || len(revisions) != 1 || revisions[0].Changes["bullets"].Old != `["a"]` {
+			t.Errorf("Unexpected card revisions: %+v (%v)", revisions, err)
+		}
+
+		if _, err := sm.GetRevisions("note", cardID); !IsValidation(err) {
+			t.Errorf("Expected validation error for unknown entity, got %v", err)
+		}
+	})
+
+	t.Run("Prune by count and age", func(t *testing.T) {
+		// Keep the newest 2 revisions of each item
+		pruned, err := sm.PruneRevisions(0, 2)
+		if err != nil || pruned != 3 {
+			t.Fatalf("Expected 3 revisions pruned, got %d (%v)", pruned, err)
+		}
+		revisions, _ := sm.GetRevisions(RevisionEntitySession, sessionID)
+		if len(revisions) != 2 {
+			t.Errorf("Expected 2 session revisions left, got %d", len(revisions))
+		}
+
+		old := time.Now().Add(-48 * time.Hour)
+		if _, err := sm.db.Exec("UPDATE revisions SET created_at = ? WHERE id = ?", old, int64(revisions[1].ID)); err != nil {
+			t.Fatalf("Failed to age revision: %v", err)
+		}
+		pruned, err = sm.PruneRevisions(24*time.Hour, 0)
+		if err != nil || pruned != 1 {
+			t.Errorf("Expected 1 aged revision pruned, got %d (%v)", pruned, err)
+		}
+	})
+
+	t.Run("Deleting an item removes its history", func(t *testing.T) {
+		if err := sm.DeleteByID(sessionID); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		var count int
+		sm.db.QueryRow("SELECT COUNT(*) FROM revisions").Scan(&count)
+		if count != 0 {
+			t.Errorf("Expected no revisions left, got %d", count)
+		}
+	})
+}
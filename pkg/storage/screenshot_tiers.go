@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/jpeg"
+	_ "image/png" // Register the PNG decoder for captured screenshots
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// ScreenshotTierOriginal is the tier of screenshots as captured.
+	ScreenshotTierOriginal = "original"
+	// ScreenshotTierThumbnail is the tier of the thumbnails made on save.
+	ScreenshotTierThumbnail = "thumbnail"
+
+	thumbnailDir      = "thumbnails"
+	thumbnailMaxWidth = 320
+	thumbnailQuality  = 70
+
+	// tierSeparator joins a screenshot's name and its tier in re-encoded
+	// file names, as in "1030.png" -> "1030~archive.jpg"
+	tierSeparator = "~"
+)
+
+// DefaultScreenshotTiers returns the default screenshot lifecycle: a
+// full-width JPEG after a week and a smaller, lower quality one after a month.
+func DefaultScreenshotTiers() []ScreenshotTier {
+	return []ScreenshotTier{
+		{Name: "reduced", AfterDays: 7, MaxWidth: 1920, Quality: 80},
+		{Name: "archive", AfterDays: 30, MaxWidth: 1280, Quality: 50},
+	}
+}
+
+// SetScreenshotTiers sets the tiers screenshots move into as they age.
+func (fm *FileManager) SetScreenshotTiers(tiers []ScreenshotTier) {
+	tiers = append([]ScreenshotTier(nil), tiers...)
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].AfterDays < tiers[j].AfterDays })
+	fm.tiers = tiers
+}
+
+// isImageFile reports whether a path has a screenshot image extension,
+// ignoring the .gz suffix older versions added.
+func isImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz"))) {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// screenshotBase returns a screenshot's file name without its extension
+// and tier.
+func screenshotBase(name string) string {
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.LastIndex(name, tierSeparator); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// ScreenshotTierOf returns the tier of a screenshot file.
+func (fm *FileManager) ScreenshotTierOf(file string) string {
+	file = filepath.ToSlash(file)
+	if path.Base(path.Dir(file)) == thumbnailDir {
+		return ScreenshotTierThumbnail
+	}
+	name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	if i := strings.LastIndex(name, tierSeparator); i >= 0 {
+		return name[i+len(tierSeparator):]
+	}
+	return ScreenshotTierOriginal
+}
+
+// resolveScreenshot returns the logical path a screenshot is currently
+// stored at, which differs from the saved path once it has moved to another
+// tier. Paths that don't resolve are returned unchanged.
+func (fm *FileManager) resolveScreenshot(rel string) string {
+	if _, err := fm.stat(rel); err == nil || !isImageFile(rel) {
+		return rel
+	}
+
+	dir := path.Dir(rel)
+	base := screenshotBase(path.Base(rel))
+	for i := len(fm.tiers) - 1; i >= 0; i-- {
+		candidate := path.Join(dir, base+tierSeparator+fm.tiers[i].Name+".jpg")
+		if _, err := fm.stat(candidate); err == nil {
+			return candidate
+		}
+	}
+
+	// Tiers that are no longer configured, and files gzipped by older versions
+	refs, _ := fm.list(dir)
+	for _, ref := range refs {
+		name := path.Base(ref.Path)
+		if path.Dir(ref.Path) != dir {
+			continue
+		}
+		if strings.HasPrefix(name, base+tierSeparator) || name == path.Base(rel)+".gz" {
+			return ref.Path
+		}
+	}
+	return rel
+}
+
+// thumbnailPath returns the logical thumbnail path of a screenshot.
+func thumbnailPath(screenshotPath string) string {
+	dir := path.Join(path.Dir(path.Dir(screenshotPath)), thumbnailDir)
+	return path.Join(dir, screenshotBase(path.Base(screenshotPath))+".jpg")
+}
+
+// GetThumbnailPath returns the full path of a screenshot's thumbnail.
+func (fm *FileManager) GetThumbnailPath(sessionID, appName, filename string) string {
+	return fm.fullPath(thumbnailPath(path.Join(sanitizePathComponent(sessionID), sanitizePathComponent(appName), "screenshots", sanitizePathComponent(filename))))
+}
+
+// writeThumbnail saves a small JPEG copy of a screenshot.
+func (fm *FileManager) writeThumbnail(screenshotPath string, img image.Image, modTime time.Time) error {
+	data, err := encodeJPEG(img, thumbnailMaxWidth, thumbnailQuality)
+	if err != nil {
+		return err
+	}
+	return fm.put(FileRef{Path: thumbnailPath(screenshotPath), ModTime: modTime}, data)
+}
+
+// encodeJPEG encodes img as a JPEG no wider than maxWidth.
+func encodeJPEG(img image.Image, maxWidth, quality int) ([]byte, error) {
+	bounds := img.Bounds()
+	if maxWidth > 0 && bounds.Dx() > maxWidth {
+		height := bounds.Dy() * maxWidth / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+		img = scaled
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeScreenshot reads and decodes the screenshot at a logical path.
+func (fm *FileManager) decodeScreenshot(rel string) (image.Image, error) {
+	data, err := fm.get(rel)
+	if err != nil {
+		return nil, err
+	}
+	// Older versions renamed screenshots to .gz; some were compressed
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// screenshotTierDue returns the tier a screenshot stored at path and last
+// modified at modTime belongs in, if that is a later tier than its current
+// one.
+func (fm *FileManager) screenshotTierDue(path string, modTime, now time.Time) (ScreenshotTier, bool) {
+	current := -1
+	if tier := fm.ScreenshotTierOf(path); tier == ScreenshotTierThumbnail {
+		return ScreenshotTier{}, false
+	} else if tier != ScreenshotTierOriginal {
+		current = len(fm.tiers) // Tiers no longer configured are left alone
+		for i, t := range fm.tiers {
+			if t.Name == tier {
+				current = i
+			}
+		}
+	}
+
+	due := -1
+	for i, t := range fm.tiers {
+		if !modTime.After(now.AddDate(0, 0, -t.AfterDays)) {
+			due = i
+		}
+	}
+	if due <= current {
+		return ScreenshotTier{}, false
+	}
+	return fm.tiers[due], true
+}
+
+// ReencodeScreenshot moves a screenshot, given by its full path, into a
+// tier, returning its new path. The file keeps its modification time so it
+// continues to age, and a missing thumbnail is created.
+func (fm *FileManager) ReencodeScreenshot(fullPath string, tier ScreenshotTier) (string, error) {
+	rel, err := fm.relPath(fullPath)
+	if err != nil {
+		return "", err
+	}
+	newRel, err := fm.reencodeScreenshot(rel, tier)
+	if err != nil {
+		return "", err
+	}
+	return fm.fullPath(newRel), nil
+}
+
+// reencodeScreenshot moves the screenshot at a logical path into a tier,
+// returning its new logical path.
+func (fm *FileManager) reencodeScreenshot(rel string, tier ScreenshotTier) (string, error) {
+	ref, err := fm.stat(rel)
+	if err != nil {
+		return "", err
+	}
+	img, err := fm.decodeScreenshot(rel)
+	if err != nil {
+		return "", NewStorageError(ErrFileSystem, "failed to decode screenshot", err)
+	}
+
+	data, err := encodeJPEG(img, tier.MaxWidth, tier.Quality)
+	if err != nil {
+		return "", NewStorageError(ErrFileSystem, "failed to encode screenshot", err)
+	}
+	newRel := path.Join(path.Dir(rel), screenshotBase(path.Base(rel))+tierSeparator+tier.Name+".jpg")
+	if err := fm.put(FileRef{Path: newRel, ModTime: ref.ModTime, BlockID: ref.BlockID}, data); err != nil {
+		return "", err
+	}
+	if newRel != rel {
+		if _, err := fm.remove(rel); err != nil {
+			return "", NewStorageError(ErrFileSystem, "failed to remove screenshot", err)
+		}
+	}
+
+	if _, err := fm.stat(thumbnailPath(rel)); IsNotFound(err) {
+		fm.writeThumbnail(rel, img, ref.ModTime)
+	}
+	return newRel, nil
+}
+
+// TierScreenshots re-encodes every screenshot older than olderThan that
+// is due for a later tier. Returns the number of screenshots re-encoded.
+func (fm *FileManager) TierScreenshots(olderThan time.Duration) (int, error) {
+	now := time.Now()
+	cutoff := now.Add(-olderThan)
+	count := 0
+
+	refs, err := fm.list("")
+	if err != nil {
+		return 0, err
+	}
+	for _, ref := range refs {
+		if path.Base(path.Dir(ref.Path)) != "screenshots" || !isImageFile(ref.Path) {
+			continue
+		}
+		if ref.ModTime.After(cutoff) {
+			continue
+		}
+		tier, due := fm.screenshotTierDue(ref.Path, ref.ModTime, now)
+		if !due {
+			continue
+		}
+		if _, err := fm.reencodeScreenshot(ref.Path, tier); err != nil {
+			continue // Leave screenshots that can't be decoded as they are
+		}
+		count++
+	}
+	return count, nil
+}
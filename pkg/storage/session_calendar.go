@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	_ "time/tzdata" // Zone data for systems without it, such as Windows
+)
+
+// SessionCalendar maps instants to session dates. A session day runs from
+// RolloverHour on one calendar day to RolloverHour on the next, in Location,
+// so with a rollover of 4 work at 1am counts toward the previous day. Days
+// are computed on the wall clock, so DST changes make them 23 or 25 hours
+// long rather than shifting the boundary.
+type SessionCalendar struct {
+	Location     *time.Location
+	RolloverHour int
+}
+
+// NewSessionCalendar creates a calendar for an IANA zone name ("" for the
+// system zone) and a rollover hour between 0 and 23.
+func NewSessionCalendar(zone string, rolloverHour int) (*SessionCalendar, error) {
+	if rolloverHour < 0 || rolloverHour > 23 {
+		return nil, NewStorageError(ErrValidation, "day rollover hour must be between 0 and 23", nil)
+	}
+
+	loc := time.Local
+	if zone != "" {
+		var err error
+		loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return nil, NewStorageError(ErrValidation, "unknown time zone "+zone, err)
+		}
+	}
+
+	return &SessionCalendar{Location: loc, RolloverHour: rolloverHour}, nil
+}
+
+// DefaultSessionCalendar returns a calendar for the system zone with days
+// starting at midnight, which is how session dates were always computed.
+func DefaultSessionCalendar() *SessionCalendar {
+	return &SessionCalendar{Location: time.Local}
+}
+
+// Date returns the session date ("2006-01-02") that t belongs to.
+func (c *SessionCalendar) Date(t time.Time) string {
+	local := t.In(c.Location)
+	if local.Hour() < c.RolloverHour {
+		local = time.Date(local.Year(), local.Month(), local.Day()-1, 12, 0, 0, 0, c.Location)
+	}
+	return local.Format("2006-01-02")
+}
+
+// Bounds returns the instants at which the session day for date starts and ends.
+func (c *SessionCalendar) Bounds(date string) (time.Time, time.Time, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidDate
+	}
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, c.RolloverHour, 0, 0, 0, c.Location)
+	end := time.Date(y, m, d+1, c.RolloverHour, 0, 0, 0, c.Location)
+	return start, end, nil
+}
+
+// ZoneName returns the IANA name of the calendar's zone. The system zone is
+// resolved from TZ or /etc/localtime where possible, and is "Local" otherwise.
+func (c *SessionCalendar) ZoneName() string {
+	if c.Location != time.Local {
+		return c.Location.String()
+	}
+	return localZoneName()
+}
+
+// BlockID returns the "HH-MM" block ID for a block starting at t, in the
+// calendar's zone. During the hour repeated when DST ends, the second pass
+// gets its UTC offset appended ("01-30-0500") so both stay unique.
+func (c *SessionCalendar) BlockID(t time.Time) string {
+	local := t.In(c.Location)
+	id := local.Format("15-04")
+	if earlier := t.Add(-time.Hour).In(c.Location); earlier.Format("15-04") == id {
+		id += local.Format("-0700")
+	}
+	return id
+}
+
+// localZoneName returns the IANA name of the system zone.
+func localZoneName() string {
+	if tz := os.Getenv("TZ"); tz != "" && !strings.HasPrefix(tz, ":") {
+		return tz
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	return "Local"
+}
+
+// addDays returns the date n days after date.
+func addDays(date string, n int) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return day.AddDate(0, 0, n).Format("2006-01-02")
+}
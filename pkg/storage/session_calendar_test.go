@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSessionCalendar tests day rollover, DST-length days and block IDs.
+func TestSessionCalendar(t *testing.T) {
+	cal, err := NewSessionCalendar("America/New_York", 4)
+	if err != nil {
+		t.Fatalf("Failed to create calendar: %v", err)
+	}
+	ny := cal.Location
+
+	t.Run("Late-night work counts toward the previous day", func(t *testing.T) {
+		if got := cal.Date(time.Date(2025, 6, 10, 1, 0, 0, 0, ny)); got != "2025-06-09" {
+			t.Errorf("Expected 2025-06-09 for 01:00, got %s", got)
+		}
+		if got := cal.Date(time.Date(2025, 6, 10, 4, 0, 0, 0, ny)); got != "2025-06-10" {
+			t.Errorf("Expected 2025-06-10 for 04:00, got %s", got)
+		}
+		// 03:00 UTC is 23:00 the previous evening in New York
+		if got := cal.Date(time.Date(2025, 6, 10, 3, 0, 0, 0, time.UTC)); got != "2025-06-09" {
+			t.Errorf("Expected 2025-06-09 for 03:00 UTC, got %s", got)
+		}
+	})
+
+	t.Run("DST days are 23 and 25 hours", func(t *testing.T) {
+		// With a 4am rollover the 2am change falls in the previous session day
+		for date, want := range map[string]time.Duration{
+			"2025-03-08": 23 * time.Hour,
+			"2025-11-01": 25 * time.Hour,
+			"2025-06-10": 24 * time.Hour,
+		} {
+			start, end, err := cal.Bounds(date)
+			if err != nil {
+				t.Fatalf("Failed to get bounds for %s: %v", date, err)
+			}
+			if got := end.Sub(start); got != want {
+				t.Errorf("Expected %s to last %v, got %v", date, want, got)
+			}
+		}
+		if _, _, err := cal.Bounds("not-a-date"); err != ErrInvalidDate {
+			t.Errorf("Expected ErrInvalidDate, got %v", err)
+		}
+	})
+
+	t.Run("Block IDs stay unique across the repeated hour", func(t *testing.T) {
+		// 2025-11-02 01:30 happens at 05:30 UTC (EDT) and again at 06:30 UTC (EST)
+		first := cal.BlockID(time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC))
+		second := cal.BlockID(time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC))
+		if first != "01-30" {
+			t.Errorf("Expected 01-30 for the first pass, got %s", first)
+		}
+		if second != "01-30-0500" {
+			t.Errorf("Expected 01-30-0500 for the second pass, got %s", second)
+		}
+	})
+
+	t.Run("Invalid settings are rejected", func(t *testing.T) {
+		if _, err := NewSessionCalendar("Mars/Olympus_Mons", 0); !IsValidation(err) {
+			t.Errorf("Expected validation error for unknown zone, got %v", err)
+		}
+		if _, err := NewSessionCalendar("", 24); !IsValidation(err) {
+			t.Errorf("Expected validation error for rollover hour, got %v", err)
+		}
+	})
+
+	t.Run("Sessions store UTC bounds and zone", func(t *testing.T) {
+		sm, cleanup := setupTestDB(t)
+		defer cleanup()
+		sm.calendar = cal
+
+		session := &Session{Date: "2025-11-01"}
+		if err := sm.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		got, err := sm.Get("2025-11-01")
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		wantStart := time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+		wantEnd := time.Date(2025, 11, 2, 9, 0, 0, 0, time.UTC)
+		if !got.StartTime.Equal(wantStart) || !got.EndTime.Equal(wantEnd) {
+			t.Errorf("Unexpected bounds: %v-%v", got.StartTime, got.EndTime)
+		}
+		if got.TimeZone != "America/New_York" {
+			t.Errorf("Expected America/New_York, got %q", got.TimeZone)
+		}
+	})
+}
@@ -13,26 +13,29 @@ func (sm *SessionManager) Create(session *Session) error {
 		return ErrEmptyRequiredField
 	}
 
-	// Encrypt sensitive fields
-	var encryptedText []byte
-	var err error
-	if session.ExtractedText != "" && sm.encryptionMgr != nil {
-		encryptedText, err = sm.encryptionMgr.Encrypt([]byte(session.ExtractedText))
-		if err != nil {
-			return NewStorageError(ErrEncryption, "failed to encrypt extracted text", err)
-		}
-	}
-
 	now := time.Now()
 	if session.CreatedAt.IsZero() {
 		session.CreatedAt = now
 	}
 	session.UpdatedAt = now
 
+	// Record the day's bounds in the zone the date was computed in
+	if session.StartTime.IsZero() {
+		start, end, err := sm.calendar.Bounds(session.Date)
+		if err != nil {
+			return err
+		}
+		session.StartTime, session.EndTime = start, end
+		session.TimeZone = sm.calendar.ZoneName()
+	}
+	session.StartTime = session.StartTime.UTC()
+	session.EndTime = session.EndTime.UTC()
+
 	query := `
 		INSERT INTO sessions (date, custom_title, custom_summary, original_summary, extracted_text_encrypted, 
-		                     entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                     entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+		                     start_time, end_time, time_zone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	stmt, err := sm.getStmt(query)
@@ -54,18 +57,29 @@ func (sm *SessionManager) Create(session *Session) error {
 		session.AIBullets = "[]"
 	}
 
-	result, err := stmt.Exec(
+	// The session is created before its text is encrypted, as the text is
+	// sealed with a data key belonging to the session
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to begin session insert", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Stmt(stmt).Exec(
 		session.Date,
 		session.CustomTitle,
 		session.CustomSummary,
 		session.OriginalSummary,
-		encryptedText,
+		nil,
 		session.EntitiesJSON,
 		session.SynthesisStatus,
 		session.AISummary,
 		session.AIBullets,
 		session.CreatedAt,
 		session.UpdatedAt,
+		session.StartTime,
+		session.EndTime,
+		session.TimeZone,
 	)
 	if err != nil {
 		// Check for unique constraint violation
@@ -80,6 +94,21 @@ func (sm *SessionManager) Create(session *Session) error {
 		return NewStorageError(ErrDatabase, "failed to get last insert id", err)
 	}
 
+	// Encrypt sensitive fields
+	if session.ExtractedText != "" && sm.encryptionMgr != nil {
+		encryptedText, err := sm.sealFor(tx, id, []byte(session.ExtractedText))
+		if err != nil {
+			return NewStorageError(ErrEncryption, "failed to encrypt extracted text", err)
+		}
+		if _, err := tx.Exec("UPDATE sessions SET extracted_text_encrypted = ? WHERE id = ?", encryptedText, id); err != nil {
+			return NewStorageError(ErrDatabase, "failed to store extracted text", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NewStorageError(ErrDatabase, "failed to commit session", err)
+	}
+
 	session.ID = types.SessionID(id)
 	return nil
 }
@@ -92,7 +121,8 @@ func (sm *SessionManager) Get(date string) (*Session, error) {
 
 	query := `
 		SELECT id, date, custom_title, custom_summary, original_summary, extracted_text_encrypted, 
-		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at
+		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+		       start_time, end_time, time_zone
 		FROM sessions
 		WHERE date = ?
 	`
@@ -104,6 +134,7 @@ func (sm *SessionManager) Get(date string) (*Session, error) {
 
 	var session Session
 	var encryptedText []byte
+	var bounds sessionBounds
 	err = stmt.QueryRow(date).Scan(
 		&session.ID,
 		&session.Date,
@@ -117,6 +148,9 @@ func (sm *SessionManager) Get(date string) (*Session, error) {
 		&session.AIBullets,
 		&session.CreatedAt,
 		&session.UpdatedAt,
+		&bounds.start,
+		&bounds.end,
+		&bounds.zone,
 	)
 
 	if err == sql.ErrNoRows {
@@ -126,6 +160,8 @@ func (sm *SessionManager) Get(date string) (*Session, error) {
 		return nil, NewStorageError(ErrDatabase, "failed to get session", err)
 	}
 
+	bounds.apply(&session)
+
 	// Decrypt sensitive fields
 	if len(encryptedText) > 0 && sm.encryptionMgr != nil {
 		decrypted, err := sm.encryptionMgr.Decrypt(encryptedText)
@@ -142,7 +178,8 @@ func (sm *SessionManager) Get(date string) (*Session, error) {
 func (sm *SessionManager) GetByID(id int64) (*Session, error) {
 	query := `
 		SELECT id, date, custom_title, custom_summary, original_summary, extracted_text_encrypted, 
-		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at
+		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+		       start_time, end_time, time_zone
 		FROM sessions
 		WHERE id = ?
 	`
@@ -154,6 +191,7 @@ func (sm *SessionManager) GetByID(id int64) (*Session, error) {
 
 	var session Session
 	var encryptedText []byte
+	var bounds sessionBounds
 	err = stmt.QueryRow(id).Scan(
 		&session.ID,
 		&session.Date,
@@ -167,6 +205,9 @@ func (sm *SessionManager) GetByID(id int64) (*Session, error) {
 		&session.AIBullets,
 		&session.CreatedAt,
 		&session.UpdatedAt,
+		&bounds.start,
+		&bounds.end,
+		&bounds.zone,
 	)
 
 	if err == sql.ErrNoRows {
@@ -176,6 +217,8 @@ func (sm *SessionManager) GetByID(id int64) (*Session, error) {
 		return nil, NewStorageError(ErrDatabase, "failed to get session", err)
 	}
 
+	bounds.apply(&session)
+
 	// Decrypt sensitive fields
 	if len(encryptedText) > 0 && sm.encryptionMgr != nil {
 		decrypted, err := sm.encryptionMgr.Decrypt(encryptedText)
@@ -188,22 +231,18 @@ func (sm *SessionManager) GetByID(id int64) (*Session, error) {
 	return &session, nil
 }
 
-// Update updates an existing session.
+// Update updates an existing session as an edit by the user.
 func (sm *SessionManager) Update(session *Session) error {
+	return sm.UpdateAs(session, RevisionActorUser)
+}
+
+// UpdateAs updates an existing session and records changes to its titles,
+// summaries and entities as a revision by actor.
+func (sm *SessionManager) UpdateAs(session *Session, actor RevisionActor) error {
 	if session.ID == 0 {
 		return NewStorageError(ErrValidation, "session ID is required for update", nil)
 	}
 
-	// Encrypt sensitive fields
-	var encryptedText []byte
-	var err error
-	if session.ExtractedText != "" && sm.encryptionMgr != nil {
-		encryptedText, err = sm.encryptionMgr.Encrypt([]byte(session.ExtractedText))
-		if err != nil {
-			return NewStorageError(ErrEncryption, "failed to encrypt extracted text", err)
-		}
-	}
-
 	session.UpdatedAt = time.Now()
 
 	query := `
@@ -218,32 +257,34 @@ func (sm *SessionManager) Update(session *Session) error {
 		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
 	}
 
-	result, err := stmt.Exec(
-		session.CustomTitle,
-		session.CustomSummary,
-		session.OriginalSummary,
-		encryptedText,
-		session.EntitiesJSON,
-		session.SynthesisStatus,
-		session.AISummary,
-		session.AIBullets,
-		session.UpdatedAt,
-		session.ID,
-	)
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to update session", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to get rows affected", err)
-	}
-
-	if rowsAffected == 0 {
-		return ErrSessionNotFound
-	}
+	return sm.updateWithRevision(RevisionEntitySession, int64(session.ID), actor, func(tx *sql.Tx) error {
+		// Encrypt sensitive fields
+		var encryptedText []byte
+		if session.ExtractedText != "" && sm.encryptionMgr != nil {
+			var err error
+			encryptedText, err = sm.sealFor(tx, int64(session.ID), []byte(session.ExtractedText))
+			if err != nil {
+				return NewStorageError(ErrEncryption, "failed to encrypt extracted text", err)
+			}
+		}
 
-	return nil
+		_, err := tx.Stmt(stmt).Exec(
+			session.CustomTitle,
+			session.CustomSummary,
+			session.OriginalSummary,
+			encryptedText,
+			session.EntitiesJSON,
+			session.SynthesisStatus,
+			session.AISummary,
+			session.AIBullets,
+			session.UpdatedAt,
+			session.ID,
+		)
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to update session", err)
+		}
+		return nil
+	})
 }
 
 // Delete deletes a session by date (cascade deletes related records).
@@ -324,7 +365,8 @@ func (sm *SessionManager) List(page, pageSize int) ([]Session, int, error) {
 	// Get paginated sessions
 	query := `
 		SELECT id, date, custom_title, custom_summary, original_summary, extracted_text_encrypted, 
-		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at
+		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+		       start_time, end_time, time_zone
 		FROM sessions
 		ORDER BY date DESC
 		LIMIT ? OFFSET ?
@@ -340,6 +382,7 @@ func (sm *SessionManager) List(page, pageSize int) ([]Session, int, error) {
 	for rows.Next() {
 		var session Session
 		var encryptedText []byte
+		var bounds sessionBounds
 		err := rows.Scan(
 			&session.ID,
 			&session.Date,
@@ -353,11 +396,16 @@ func (sm *SessionManager) List(page, pageSize int) ([]Session, int, error) {
 			&session.AIBullets,
 			&session.CreatedAt,
 			&session.UpdatedAt,
+			&bounds.start,
+			&bounds.end,
+			&bounds.zone,
 		)
 		if err != nil {
 			return nil, 0, NewStorageError(ErrDatabase, "failed to scan session", err)
 		}
 
+		bounds.apply(&session)
+
 		// Decrypt sensitive fields
 		if len(encryptedText) > 0 && sm.encryptionMgr != nil {
 			decrypted, err := sm.encryptionMgr.Decrypt(encryptedText)
@@ -377,6 +425,20 @@ func (sm *SessionManager) List(page, pageSize int) ([]Session, int, error) {
 	return sessions, totalCount, nil
 }
 
+// sessionBounds holds the nullable day-bound columns of a session row;
+// sessions from before they were recorded have none.
+type sessionBounds struct {
+	start, end sql.NullTime
+	zone       sql.NullString
+}
+
+// apply copies the bounds into a session.
+func (b sessionBounds) apply(session *Session) {
+	session.StartTime = b.start.Time
+	session.EndTime = b.end.Time
+	session.TimeZone = b.zone.String
+}
+
 // isUniqueConstraintError checks if the error is a unique constraint violation.
 func isUniqueConstraintError(err error) bool {
 	if err == nil {
@@ -403,7 +465,8 @@ func containsHelper(s, substr string) bool {
 func (sm *SessionManager) GetPendingSessions() ([]Session, error) {
 	query := `
 		SELECT id, date, custom_title, custom_summary, original_summary, extracted_text_encrypted, 
-		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at
+		       entities_json, synthesis_status, ai_summary, ai_bullets, created_at, updated_at,
+		       start_time, end_time, time_zone
 		FROM sessions
 		WHERE synthesis_status = 'pending'
 		ORDER BY created_at ASC
@@ -419,6 +482,7 @@ func (sm *SessionManager) GetPendingSessions() ([]Session, error) {
 	for rows.Next() {
 		var session Session
 		var encryptedText []byte
+		var bounds sessionBounds
 		err := rows.Scan(
 			&session.ID,
 			&session.Date,
@@ -432,11 +496,16 @@ func (sm *SessionManager) GetPendingSessions() ([]Session, error) {
 			&session.AIBullets,
 			&session.CreatedAt,
 			&session.UpdatedAt,
+			&bounds.start,
+			&bounds.end,
+			&bounds.zone,
 		)
 		if err != nil {
 			return nil, NewStorageError(ErrDatabase, "failed to scan pending session", err)
 		}
 
+		bounds.apply(&session)
+
 		// Decrypt sensitive fields
 		if len(encryptedText) > 0 && sm.encryptionMgr != nil {
 			decrypted, err := sm.encryptionMgr.Decrypt(encryptedText)
@@ -469,7 +538,8 @@ func (sm *SessionManager) GetPendingSessionsCount() (int, error) {
 	return count, nil
 }
 
-// UpdateSessionSynthesis updates only the synthesis-related columns of a session
+// UpdateSessionSynthesis updates only the synthesis-related columns of a session,
+// recording the changes as a revision by synthesis.
 func (sm *SessionManager) UpdateSessionSynthesis(sessionID int64, entitiesJSON, synthesisStatus, aiSummary, aiBullets string) error {
 	query := `
 		UPDATE sessions
@@ -482,26 +552,18 @@ func (sm *SessionManager) UpdateSessionSynthesis(sessionID int64, entitiesJSON,
 		return NewStorageError(ErrDatabase, "failed to prepare statement", err)
 	}
 
-	result, err := stmt.Exec(
-		entitiesJSON,
-		synthesisStatus,
-		aiSummary,
-		aiBullets,
-		time.Now(),
-		sessionID,
-	)
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to update session synthesis", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to get rows affected", err)
-	}
-
-	if rowsAffected == 0 {
-		return ErrSessionNotFound
-	}
-
-	return nil
+	return sm.updateWithRevision(RevisionEntitySession, sessionID, RevisionActorSynthesis, func(tx *sql.Tx) error {
+		_, err := tx.Stmt(stmt).Exec(
+			entitiesJSON,
+			synthesisStatus,
+			aiSummary,
+			aiBullets,
+			time.Now(),
+			sessionID,
+		)
+		if err != nil {
+			return NewStorageError(ErrDatabase, "failed to update session synthesis", err)
+		}
+		return nil
+	})
 }
\ No newline at end of file
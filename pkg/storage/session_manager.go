@@ -21,6 +21,7 @@ type SessionManager struct {
 	stmtCache     map[string]*sql.Stmt
 	stmtMutex     sync.RWMutex
 	dbPath        string
+	calendar      *SessionCalendar // Computes day bounds for new sessions
 }
 
 // NewSessionManager creates a new SessionManager instance.
@@ -30,19 +31,44 @@ func NewSessionManager(dataDir string, encryptionMgr *EncryptionManager) *Sessio
 		encryptionMgr: encryptionMgr,
 		stmtCache:     make(map[string]*sql.Stmt),
 		dbPath:        dbPath,
+		calendar:      DefaultSessionCalendar(),
 	}
 }
 
 // Initialize creates the database and runs migrations.
 func (sm *SessionManager) Initialize() error {
+	if err := sm.Open(); err != nil {
+		return err
+	}
+
+	// Run migrations
+	if err := sm.runMigrations(); err != nil {
+		return err
+	}
+
+	// Unwrap the data keys sealing session data
+	if sm.encryptionMgr != nil {
+		if _, err := sm.LoadDataKeys(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Open opens the database without running migrations, for inspecting or
+// migrating its schema. Use Initialize to open it for use.
+func (sm *SessionManager) Open() error {
 	// Ensure directory exists
 	dir := filepath.Dir(sm.dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return NewStorageError(ErrFileSystem, "failed to create database directory", err)
 	}
 
-	// Open database with WAL mode, foreign keys, and performance optimizations
-	db, err := sql.Open("sqlite", sm.dbPath+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-20000)&_pragma=temp_store(MEMORY)")
+	// Open database with WAL mode, foreign keys, and performance optimizations.
+	// secure_delete overwrites deleted content, so destroyed data keys leave
+	// nothing behind in free pages
+	db, err := sql.Open("sqlite", sm.dbPath+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-20000)&_pragma=temp_store(MEMORY)&_pragma=secure_delete(ON)")
 	if err != nil {
 		return NewStorageError(ErrDatabase, "failed to open database", err)
 	}
@@ -55,16 +81,7 @@ func (sm *SessionManager) Initialize() error {
 	sm.db.SetConnMaxLifetime(time.Hour)
 
 	// Run integrity check on startup
-	if err := sm.RunIntegrityCheck(); err != nil {
-		return err
-	}
-
-	// Run migrations
-	if err := sm.runMigrations(); err != nil {
-		return err
-	}
-
-	return nil
+	return sm.RunIntegrityCheck()
 }
 
 // RunIntegrityCheck runs PRAGMA integrity_check on the database.
@@ -135,15 +152,31 @@ func (sm *SessionManager) getStmt(query string) (*sql.Stmt, error) {
 	return stmt, nil
 }
 
+// execCached executes query on q through the statement cache. Inside a
+// transaction the query is executed directly, since preparing it on the
+// database would wait for the connection the transaction holds.
+func (sm *SessionManager) execCached(q execQueryer, query string, args ...interface{}) (sql.Result, error) {
+	if db, ok := q.(*sql.DB); !ok || db != sm.db {
+		return q.Exec(query, args...)
+	}
+	stmt, err := sm.getStmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
 // DB returns the underlying database connection for advanced operations.
 func (sm *SessionManager) DB() *sql.DB {
 	return sm.db
 }
 
-// Search performs full-text search using SQLite FTS5 across sessions and activity blocks.
-// It searches across custom_title, custom_summary, original_summary, and micro_summary fields.
-// Returns results ranked by relevance with snippet highlighting.
-func (sm *SessionManager) Search(query string, page, pageSize int) ([]SearchResult, error) {
+// Search performs full-text search using SQLite FTS5 across sessions, activity blocks and notes.
+// It searches across custom_title, custom_summary, original_summary, micro_summary and note content.
+// Notes are indexed without their text, so note matches carry no snippet.
+// Returns results ranked by relevance with snippet highlighting. When tags are
+// given, only sessions carrying all of them are returned.
+func (sm *SessionManager) Search(query string, page, pageSize int, tags ...string) ([]SearchResult, error) {
 	if query == "" {
 		return nil, NewStorageError(ErrValidation, "search query cannot be empty", nil)
 	}
@@ -188,27 +221,51 @@ func (sm *SessionManager) Search(query string, page, pageSize int) ([]SearchResu
 			JOIN sessions s ON s.id = aa.session_id
 			WHERE activity_blocks_fts MATCH ?
 		),
+		note_matches AS (
+			SELECT DISTINCT
+				s.id, s.date, s.custom_title, s.custom_summary, s.original_summary,
+				s.extracted_text_encrypted, s.created_at, s.updated_at,
+				s.entities_json, s.synthesis_status, s.ai_summary, s.ai_bullets,
+				fts.rank as score,
+				'' as snippet,
+				'note' as match_source
+			FROM notes_fts fts
+			JOIN manual_notes mn ON mn.id = fts.rowid
+			JOIN sessions s ON s.id = mn.session_id
+			WHERE notes_fts MATCH ?
+		),
 		all_matches AS (
 			SELECT * FROM session_matches
 			UNION ALL
 			SELECT * FROM block_matches
+			UNION ALL
+			SELECT * FROM note_matches
 		)
 		SELECT 
 			id, date, custom_title, custom_summary, original_summary,
 			extracted_text_encrypted, created_at, updated_at,
 			entities_json, synthesis_status, ai_summary, ai_bullets,
 			MAX(score) as best_score, snippet, match_source
-		FROM all_matches
+		FROM all_matches`
+
+	args := []interface{}{ftsQuery, ftsQuery, ftsQuery}
+	if filter, filterArgs := taggedSessionsFilter("id", tags); filter != "" {
+		searchSQL += `
+		WHERE ` + filter
+		args = append(args, filterArgs...)
+	}
+	searchSQL += `
 		GROUP BY id
 		ORDER BY best_score DESC
 		LIMIT ? OFFSET ?`
+	args = append(args, pageSize, offset)
 
 	stmt, err := sm.getStmt(searchSQL)
 	if err != nil {
 		return nil, NewStorageError(ErrDatabase, "failed to prepare search statement", err)
 	}
 
-	rows, err := stmt.Query(ftsQuery, ftsQuery, pageSize, offset)
+	rows, err := stmt.Query(args...)
 	if err != nil {
 		return nil, NewStorageError(ErrDatabase, "search query failed", err)
 	}
@@ -289,8 +346,8 @@ func prepareFTSQuery(query string) string {
 }
 
 // SemanticSearch performs semantic search by generating embeddings and searching LanceDB,
-// then fetching full session metadata from SQLite. Supports date range filtering.
-func (sm *SessionManager) SemanticSearch(query string, topK int, dateRange *DateRange, vectorMgr VectorManagerInterface) ([]SearchResult, error) {
+// then fetching full session metadata from SQLite. Supports date range and tag filtering.
+func (sm *SessionManager) SemanticSearch(query string, topK int, dateRange *DateRange, vectorMgr VectorManagerInterface, tags ...string) ([]SearchResult, error) {
 	if query == "" {
 		return nil, NewStorageError(ErrValidation, "search query cannot be empty", nil)
 	}
@@ -348,6 +405,10 @@ func (sm *SessionManager) SemanticSearch(query string, topK int, dateRange *Date
 			args = append(args, dateRange.EndDate)
 		}
 	}
+	if filter, filterArgs := taggedSessionsFilter("id", tags); filter != "" {
+		baseSQL += " AND " + filter
+		args = append(args, filterArgs...)
+	}
 
 	stmt, err := sm.getStmt(baseSQL)
 	if err != nil {
@@ -396,8 +457,14 @@ func (sm *SessionManager) SemanticSearch(query string, topK int, dateRange *Date
 		return nil, NewStorageError(ErrDatabase, "error iterating semantic search results", err)
 	}
 
-	// Build results in the same order as vector search results, preserving similarity scores
+	// Build results in the same order as vector search results, preserving similarity scores.
+	// A session and its notes are embedded separately, so keep only its best match.
+	seen := make(map[types.SessionID]bool, len(vectorResults))
 	for _, vectorResult := range vectorResults {
+		if seen[vectorResult.SessionID] {
+			continue
+		}
+		seen[vectorResult.SessionID] = true
 		if session, exists := sessionMap[vectorResult.SessionID]; exists {
 			result := SearchResult{
 				Session:   session,
@@ -116,9 +116,10 @@ func TestSchemaVersion(t *testing.T) {
 		t.Fatalf("Failed to get schema version: %v", err)
 	}
 
-	// Should be at version 3 (initial schema + FTS5 + synthesis/capture columns)
-	if version != 3 {
-		t.Errorf("Expected schema version 3, got %d", version)
+	// Should be at the latest migration version
+	latest := migrations[len(migrations)-1].Version
+	if version != latest {
+		t.Errorf("Expected schema version %d, got %d", latest, version)
 	}
 }
 
@@ -3,8 +3,11 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"waddle/pkg/types"
@@ -14,9 +17,12 @@ import (
 type StorageEngine struct {
 	config        *StorageConfig
 	sessionMgr    *SessionManager
+	writer        *WriteCoordinator
+	writeMu       sync.RWMutex // Held for reading by writes, for writing while Restore replaces the store
 	vectorMgr     *VectorManager
 	fileMgr       *FileManager
 	encryptionMgr *EncryptionManager
+	calendar      *SessionCalendar
 }
 
 // NewStorageEngine creates a new StorageEngine instance with the given configuration.
@@ -26,6 +32,11 @@ func NewStorageEngine(config *StorageConfig) *StorageEngine {
 	}
 }
 
+// Config returns the configuration the engine was created with.
+func (se *StorageEngine) Config() *StorageConfig {
+	return se.config
+}
+
 // Initialize initializes all storage components and creates necessary directories.
 func (se *StorageEngine) Initialize() error {
 	// Ensure data directory exists
@@ -33,6 +44,12 @@ func (se *StorageEngine) Initialize() error {
 		return NewStorageError(ErrFileSystem, "failed to create data directory", err)
 	}
 
+	calendar, err := NewSessionCalendar(se.config.TimeZone, se.config.DayRolloverHour)
+	if err != nil {
+		return err
+	}
+	se.calendar = calendar
+
 	// Initialize encryption manager first (needed by others)
 	se.encryptionMgr = NewEncryptionManager(se.config.DataDir)
 	if err := se.encryptionMgr.InitializeKey(); err != nil {
@@ -41,14 +58,17 @@ func (se *StorageEngine) Initialize() error {
 
 	// Initialize session manager
 	se.sessionMgr = NewSessionManager(se.config.DataDir, se.encryptionMgr)
+	se.sessionMgr.calendar = se.calendar
 	if err := se.sessionMgr.Initialize(); err != nil {
 		return NewStorageError(ErrDatabase, "failed to initialize session manager", err)
 	}
 
+	// Every write goes through a single writer, which batches capture writes
+	se.writer = NewWriteCoordinator(DefaultWriteCoordinatorConfig(), se.sessionMgr)
+
 	// Initialize vector manager
 	vectorConfig := DefaultVectorManagerConfig(se.config.DataDir)
 	vectorConfig.ModelVersion = se.config.EmbeddingModel
-	var err error
 	se.vectorMgr, err = NewVectorManager(vectorConfig)
 	if err != nil {
 		return NewStorageError(ErrVector, "failed to initialize vector manager", err)
@@ -56,6 +76,20 @@ func (se *StorageEngine) Initialize() error {
 
 	// Initialize file manager
 	se.fileMgr = NewFileManager(se.config.DataDir)
+	if len(se.config.ScreenshotTiers) > 0 {
+		se.fileMgr.SetScreenshotTiers(se.config.ScreenshotTiers)
+	}
+	se.fileMgr.SetEncryption(se.encryptionMgr)
+	se.fileMgr.SetIndex(se.sessionMgr)
+	if _, err := se.fileMgr.MigrateToBlobStore(); err != nil {
+		return err
+	}
+	if _, err := se.fileMgr.MigrateEncryption(); err != nil {
+		return err
+	}
+	if _, err := se.fileMgr.MigrateDataKeys(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -72,6 +106,13 @@ func (se *StorageEngine) DB() *sql.DB {
 func (se *StorageEngine) Close() error {
 	var lastErr error
 
+	// Flush queued writes before the database closes
+	if se.writer != nil {
+		if err := se.writer.Close(); err != nil {
+			lastErr = err
+		}
+	}
+
 	if se.sessionMgr != nil {
 		if err := se.sessionMgr.Close(); err != nil {
 			lastErr = err
@@ -122,6 +163,62 @@ func (se *StorageEngine) CleanupStaleEncryptedData() (int, error) {
 	return staleCount, rows.Err()
 }
 
+// RotateKey replaces the encryption key with one derived from a new
+// passphrase. Session data keys, including those kept for backups, file
+// keys, logged purges and the recovery key are rewrapped and the remaining
+// encrypted columns re-encrypted, so session data and screenshots are not
+// rewritten; on failure the previous key is restored.
+func (se *StorageEngine) RotateKey(newPassphrase string) error {
+	return se.exclusive(func() error {
+		return se.rotateKey(newPassphrase)
+	})
+}
+
+// rotateKey rotates the key on the writer, so no write encrypts under the
+// old key once its columns have been re-encrypted.
+func (se *StorageEngine) rotateKey(newPassphrase string) error {
+	old, stored, err := se.encryptionMgr.snapshot()
+	if err != nil {
+		return err
+	}
+	if err := se.encryptionMgr.RotateKey(newPassphrase); err != nil {
+		return err
+	}
+
+	if _, err := se.fileMgr.RewrapFileKeys(old, se.encryptionMgr); err != nil {
+		se.encryptionMgr.restoreKey(stored)
+		return err
+	}
+	if _, err := se.sessionMgr.ReencryptColumns(old, se.encryptionMgr); err != nil {
+		se.fileMgr.RewrapFileKeys(se.encryptionMgr, old)
+		se.encryptionMgr.restoreKey(stored)
+		return err
+	}
+	backupMgr := NewBackupManager(se.config, se)
+	if _, err := backupMgr.RewrapBackupKeys(old, se.encryptionMgr); err != nil {
+		se.sessionMgr.ReencryptColumns(se.encryptionMgr, old)
+		se.fileMgr.RewrapFileKeys(se.encryptionMgr, old)
+		se.encryptionMgr.restoreKey(stored)
+		return err
+	}
+	if _, err := backupMgr.RewrapPurgeLog(old, se.encryptionMgr); err != nil {
+		backupMgr.RewrapBackupKeys(se.encryptionMgr, old)
+		se.sessionMgr.ReencryptColumns(se.encryptionMgr, old)
+		se.fileMgr.RewrapFileKeys(se.encryptionMgr, old)
+		se.encryptionMgr.restoreKey(stored)
+		return err
+	}
+	if _, err := backupMgr.writeRecoveryKey(); err != nil && !IsNotFound(err) {
+		backupMgr.RewrapPurgeLog(se.encryptionMgr, old)
+		backupMgr.RewrapBackupKeys(se.encryptionMgr, old)
+		se.sessionMgr.ReencryptColumns(se.encryptionMgr, old)
+		se.fileMgr.RewrapFileKeys(se.encryptionMgr, old)
+		se.encryptionMgr.restoreKey(stored)
+		return err
+	}
+	return nil
+}
+
 // Session operations
 
 // CreateSession creates a new session for the given date.
@@ -132,24 +229,106 @@ func (se *StorageEngine) CreateSession(date string) (*Session, error) {
 		UpdatedAt: time.Now(),
 	}
 
-	if err := se.sessionMgr.Create(session); err != nil {
+	err := se.exclusive(func() error {
+		return se.sessionMgr.Create(session)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return session, nil
 }
 
+// GetOrCreateSession retrieves the session for a date, creating it if needed.
+func (se *StorageEngine) GetOrCreateSession(date string) (*Session, error) {
+	session, err := se.sessionMgr.Get(date)
+	if err == nil {
+		return session, nil
+	}
+	if !IsNotFound(err) {
+		return nil, err
+	}
+
+	session, err = se.CreateSession(date)
+	if IsConflict(err) {
+		// Created concurrently by another writer
+		return se.sessionMgr.Get(date)
+	}
+	return session, err
+}
+
+// SessionDate returns the date of the session day that t falls in, using
+// the configured time zone and day rollover hour.
+func (se *StorageEngine) SessionDate(t time.Time) string {
+	return se.calendar.Date(t)
+}
+
+// BlockID returns the block ID for an activity block starting at t. IDs
+// are unique within a session day, including across a DST fall-back hour.
+func (se *StorageEngine) BlockID(t time.Time) string {
+	return se.calendar.BlockID(t)
+}
+
+// SessionBounds returns the instants at which the session day for date
+// starts and ends. An existing session keeps the bounds it was created with,
+// even if the time zone setting has since changed.
+func (se *StorageEngine) SessionBounds(date string) (time.Time, time.Time, error) {
+	session, err := se.sessionMgr.Get(date)
+	if err == nil && !session.StartTime.IsZero() {
+		return session.StartTime, session.EndTime, nil
+	}
+	if err != nil && !IsNotFound(err) {
+		return time.Time{}, time.Time{}, err
+	}
+	return se.calendar.Bounds(date)
+}
+
+// GetSessionAt returns the session whose day contains t. Sessions recorded
+// in another time zone, for example while travelling, are matched by their
+// stored bounds before falling back to the configured calendar.
+func (se *StorageEngine) GetSessionAt(t time.Time) (*Session, error) {
+	date := se.calendar.Date(t)
+	for _, d := range []string{date, addDays(date, -1), addDays(date, 1)} {
+		session, err := se.sessionMgr.Get(d)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if session.StartTime.IsZero() {
+			if d == date {
+				return session, nil
+			}
+			continue
+		}
+		if !t.Before(session.StartTime) && t.Before(session.EndTime) {
+			return session, nil
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
 // GetSession retrieves a session by date.
 func (se *StorageEngine) GetSession(date string) (*Session, error) {
 	return se.sessionMgr.Get(date)
 }
 
-// UpdateSession updates an existing session.
+// UpdateSession updates an existing session as an edit by the user.
 func (se *StorageEngine) UpdateSession(session *Session) error {
+	return se.UpdateSessionAs(session, RevisionActorUser)
+}
+
+// UpdateSessionAs updates an existing session, recording the change as a
+// revision by actor.
+func (se *StorageEngine) UpdateSessionAs(session *Session, actor RevisionActor) error {
 	session.UpdatedAt = time.Now()
 
 	// Update in database
-	if err := se.sessionMgr.Update(session); err != nil {
+	err := se.exclusive(func() error {
+		return se.sessionMgr.UpdateAs(session, actor)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -167,20 +346,50 @@ func (se *StorageEngine) UpdateSession(session *Session) error {
 
 // DeleteSession deletes a session and all associated data.
 func (se *StorageEngine) DeleteSession(date string) error {
+	return se.exclusive(func() error {
+		return se.deleteSession(date, true)
+	})
+}
+
+// deleteSession deletes a session on the writer, so its data key isn't
+// destroyed while another write still uses it. Unless forgetBackupKey is
+// false, which Restore passes while it holds backupMu, the key is also
+// removed from the backup key file.
+func (se *StorageEngine) deleteSession(date string, forgetBackupKey bool) error {
 	// Get session first to get ID
 	session, err := se.sessionMgr.Get(date)
 	if err != nil {
 		return err
 	}
+	keyID, err := se.sessionMgr.GetSessionDataKeyID(int64(session.ID))
+	if err != nil {
+		return err
+	}
 
 	// Delete from all stores
 	if err := se.sessionMgr.Delete(date); err != nil {
 		return err
 	}
 
+	// Destroy the session's data key, leaving whatever copies of its data
+	// remain in backups, the WAL or free pages unreadable
+	if keyID != 0 {
+		if err := se.sessionMgr.DestroyDataKey(keyID); err != nil {
+			return err
+		}
+		if forgetBackupKey {
+			if err := NewBackupManager(se.config, se).ForgetBackupKey(keyID); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := se.vectorMgr.DeleteEmbedding(int64(session.ID)); err != nil {
 		// Log error but continue - vector might not exist
 	}
+	if err := se.vectorMgr.DeleteSessionNoteEmbeddings(int64(session.ID)); err != nil {
+		// Log error but continue - notes might not be embedded
+	}
 
 	if err := se.fileMgr.DeleteSessionFiles(date); err != nil {
 		// Log error but continue - files might not exist
@@ -194,29 +403,39 @@ func (se *StorageEngine) ListSessions(page, pageSize int) ([]Session, int, error
 	return se.sessionMgr.List(page, pageSize)
 }
 
+// ListSessionsAfter returns up to limit sessions following cursor and the
+// cursor of the next page, which is "" after the last page.
+func (se *StorageEngine) ListSessionsAfter(q SessionQuery, cursor string, limit int) ([]Session, string, error) {
+	return se.sessionMgr.ListSessionsAfter(q, cursor, limit)
+}
+
+// IterateSessions calls fn for each session matching q, a page at a time.
+// Returning ErrStopIteration from fn stops early.
+func (se *StorageEngine) IterateSessions(q SessionQuery, fn func(Session) error) error {
+	return se.sessionMgr.IterateSessions(q, fn)
+}
+
 // Search operations
 
 // FullTextSearch performs full-text search across sessions and activity blocks.
-func (se *StorageEngine) FullTextSearch(query string, page, pageSize int) ([]SearchResult, error) {
-	return se.sessionMgr.Search(query, page, pageSize)
+// When tags are given, only sessions carrying all of them are returned.
+func (se *StorageEngine) FullTextSearch(query string, page, pageSize int, tags ...string) ([]SearchResult, error) {
+	return se.sessionMgr.Search(query, page, pageSize, tags...)
 }
 
 // SemanticSearch performs semantic search using vector embeddings.
-func (se *StorageEngine) SemanticSearch(query string, topK int, dateRange *DateRange) ([]SearchResult, error) {
-	return se.sessionMgr.SemanticSearch(query, topK, dateRange, se.vectorMgr)
+// When tags are given, only sessions carrying all of them are returned.
+func (se *StorageEngine) SemanticSearch(query string, topK int, dateRange *DateRange, tags ...string) ([]SearchResult, error) {
+	return se.sessionMgr.SemanticSearch(query, topK, dateRange, se.vectorMgr, tags...)
 }
 
 // Activity operations
 
 // AddActivityBlock adds an activity block to a session.
 func (se *StorageEngine) AddActivityBlock(sessionDate, appName string, block *ActivityBlock) error {
-	// Get session to get ID
-	session, err := se.sessionMgr.Get(sessionDate)
-	if err != nil {
-		return err
-	}
-
-	return se.sessionMgr.AddBlock(int64(session.ID), appName, block)
+	return se.writeSession(sessionDate, func(tx *sql.Tx, sessionID int64) error {
+		return se.sessionMgr.addBlock(tx, sessionID, appName, block)
+	})
 }
 
 // GetActivityBlocks retrieves activity blocks for a session and app.
@@ -241,35 +460,719 @@ func (se *StorageEngine) GetSessionAppActivities(sessionDate string) ([]AppActiv
 	return se.sessionMgr.GetAppActivities(int64(session.ID))
 }
 
+// GetSessionWithActivities retrieves a session with its app activities and
+// their blocks, loaded in one query.
+func (se *StorageEngine) GetSessionWithActivities(date string) (*Session, error) {
+	session, err := se.sessionMgr.Get(date)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Activities, err = se.sessionMgr.GetActivitiesWithBlocks(int64(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListBlocksAfter returns up to limit activity blocks following the block
+// with ID cursor and the cursor of the next page, which is 0 after the last
+// page.
+func (se *StorageEngine) ListBlocksAfter(q BlockQuery, cursor int64, limit int) ([]SessionBlock, int64, error) {
+	return se.sessionMgr.ListBlocksAfter(q, cursor, limit)
+}
+
+// IterateBlocks calls fn for each activity block matching q, a page at a
+// time. Returning ErrStopIteration from fn stops early.
+func (se *StorageEngine) IterateBlocks(q BlockQuery, fn func(SessionBlock) error) error {
+	return se.sessionMgr.IterateBlocks(q, fn)
+}
+
 // Chat operations
 
 // AddChat adds a chat message to a session.
 func (se *StorageEngine) AddChat(sessionDate string, chat *ChatMessage) error {
+	return se.writeSession(sessionDate, func(tx *sql.Tx, sessionID int64) error {
+		return se.sessionMgr.addChat(tx, sessionID, chat)
+	})
+}
+
+// GetChats retrieves chat messages for a session.
+func (se *StorageEngine) GetChats(sessionDate string) ([]ChatMessage, error) {
 	// Get session to get ID
 	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return se.sessionMgr.GetChats(int64(session.ID))
+}
+
+// Note operations
+
+// AddNote adds a Markdown note to a session and queues its embedding.
+func (se *StorageEngine) AddNote(sessionDate string, note *ManualNote) error {
+	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return err
+	}
+
+	note.SessionID = session.ID
+	err = se.exclusive(func() error {
+		return se.sessionMgr.AddNote(note)
+	})
 	if err != nil {
 		return err
 	}
 
-	return se.sessionMgr.AddChat(int64(session.ID), chat)
+	if err := se.vectorMgr.QueueNoteEmbedding(int64(note.ID), int64(note.SessionID), note.Content); err != nil {
+		// Log error but don't fail the insert
+	}
+	return nil
 }
 
-// GetChats retrieves chat messages for a session.
-func (se *StorageEngine) GetChats(sessionDate string) ([]ChatMessage, error) {
+// GetNote retrieves a note by ID.
+func (se *StorageEngine) GetNote(noteID int64) (*ManualNote, error) {
+	return se.sessionMgr.GetNote(noteID)
+}
+
+// GetNotes retrieves the notes of a session, oldest first.
+func (se *StorageEngine) GetNotes(sessionDate string) ([]ManualNote, error) {
+	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return se.sessionMgr.GetNotes(int64(session.ID))
+}
+
+// UpdateNote updates a note's content and links, keeping the previous
+// content as a revision, and queues its embedding.
+func (se *StorageEngine) UpdateNote(note *ManualNote) error {
+	err := se.exclusive(func() error {
+		return se.sessionMgr.UpdateNote(note)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := se.vectorMgr.QueueNoteEmbedding(int64(note.ID), int64(note.SessionID), note.Content); err != nil {
+		// Log error but don't fail the update
+	}
+	return nil
+}
+
+// DeleteNote deletes a note and its embedding.
+func (se *StorageEngine) DeleteNote(noteID int64) error {
+	err := se.exclusive(func() error {
+		return se.sessionMgr.DeleteNote(noteID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := se.vectorMgr.DeleteNoteEmbedding(noteID); err != nil {
+		// Log error but continue - vector might not exist
+	}
+	return nil
+}
+
+// GetNoteRevisions returns the earlier versions of a note, newest first.
+func (se *StorageEngine) GetNoteRevisions(noteID int64) ([]NoteRevision, error) {
+	return se.sessionMgr.GetNoteRevisions(noteID)
+}
+
+// GetBlockNotes returns the notes linking an activity block directly or
+// through an overlapping time range.
+func (se *StorageEngine) GetBlockNotes(blockID int64) ([]ManualNote, error) {
+	return se.sessionMgr.GetBlockNotes(blockID)
+}
+
+// GetNotesInRange returns the notes linking a time range or block that
+// overlaps [start, end).
+func (se *StorageEngine) GetNotesInRange(start, end time.Time) ([]ManualNote, error) {
+	return se.sessionMgr.GetNotesInRange(start, end)
+}
+
+// Browser visit operations
+
+// AddBrowserVisit stores an imported browser visit in a session and reports
+// whether it was new. The visit is linked to the activity block covering it.
+func (se *StorageEngine) AddBrowserVisit(sessionDate string, visit *BrowserVisit) (bool, error) {
+	// Get session to get ID
+	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return false, err
+	}
+
+	var added bool
+	err = se.exclusive(func() (err error) {
+		added, err = se.sessionMgr.AddBrowserVisit(int64(session.ID), visit)
+		return err
+	})
+	return added, err
+}
+
+// AddBrowserVisits stores imported browser visits in a session, linking each
+// to the activity block covering it. It returns how many visits were handled,
+// which is fewer than len(visits) only on error; new visits get an ID.
+func (se *StorageEngine) AddBrowserVisits(sessionDate string, visits []*BrowserVisit) (int, error) {
+	// Get session to get ID
+	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = se.exclusive(func() (err error) {
+		n, err = se.sessionMgr.AddBrowserVisits(int64(session.ID), visits)
+		return err
+	})
+	return n, err
+}
+
+// GetBrowserVisits retrieves imported browser visits for a session.
+func (se *StorageEngine) GetBrowserVisits(sessionDate string) ([]BrowserVisit, error) {
 	// Get session to get ID
 	session, err := se.sessionMgr.Get(sessionDate)
 	if err != nil {
 		return nil, err
 	}
 
-	return se.sessionMgr.GetChats(int64(session.ID))
+	return se.sessionMgr.GetBrowserVisits(int64(session.ID))
+}
+
+// Meeting operations
+
+// SyncMeetings stores the meeting occurrences read from a calendar source,
+// filing each under the session of the local day it starts on (created if
+// needed). Occurrences of the source starting within [from, to) that are
+// missing from meetings are removed.
+func (se *StorageEngine) SyncMeetings(source string, meetings []Meeting, from, to time.Time) (*MeetingSyncResult, error) {
+	sessionIDs := make(map[string]types.SessionID)
+	for i := range meetings {
+		date := se.calendar.Date(meetings[i].StartTime)
+		if _, ok := sessionIDs[date]; !ok {
+			session, err := se.GetOrCreateSession(date)
+			if err != nil {
+				return nil, err
+			}
+			sessionIDs[date] = session.ID
+		}
+		meetings[i].SessionID = sessionIDs[date]
+	}
+
+	var result *MeetingSyncResult
+	err := se.exclusive(func() (err error) {
+		result, err = se.sessionMgr.SyncMeetings(source, meetings, from, to)
+		return err
+	})
+	return result, err
+}
+
+// GetMeetings retrieves the meetings of a session in start time order.
+func (se *StorageEngine) GetMeetings(sessionDate string) ([]Meeting, error) {
+	// Get session to get ID
+	session, err := se.sessionMgr.Get(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return se.sessionMgr.GetMeetings(int64(session.ID))
+}
+
+// GetMeeting retrieves a meeting by ID.
+func (se *StorageEngine) GetMeeting(meetingID int64) (*Meeting, error) {
+	return se.sessionMgr.GetMeeting(meetingID)
+}
+
+// FindMeetings returns meetings whose title contains query, newest first.
+func (se *StorageEngine) FindMeetings(query string, limit int) ([]Meeting, error) {
+	return se.sessionMgr.FindMeetings(query, limit)
+}
+
+// GetMeetingActivity returns a meeting with every activity block recorded
+// during it, including blocks on the next day for meetings past the day rollover.
+func (se *StorageEngine) GetMeetingActivity(meetingID int64) (*MeetingActivity, error) {
+	meeting, err := se.sessionMgr.GetMeeting(meetingID)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &MeetingActivity{Meeting: *meeting, Blocks: []AppBlock{}}
+
+	first := se.calendar.Date(meeting.StartTime)
+	for date := first; ; date = addDays(date, 1) {
+		dayStart, _, err := se.calendar.Bounds(date)
+		if err != nil {
+			return nil, err
+		}
+		if date != first && !dayStart.Before(meeting.EndTime) {
+			break
+		}
+
+		session, err := se.sessionMgr.Get(date)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		blocks, err := se.sessionMgr.getBlocksOverlapping(int64(session.ID), meeting.StartTime, meeting.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			block.SessionDate = date
+			activity.Blocks = append(activity.Blocks, block)
+		}
+	}
+
+	return activity, nil
+}
+
+// Work session operations
+
+// SegmentSession splits the day's activity into work sessions at idle gaps
+// longer than the configured SessionIdleGap and returns them in order.
+// Earlier splits and merges are kept; see SessionManager.SegmentWorkSessions.
+func (se *StorageEngine) SegmentSession(date string) ([]WorkSession, error) {
+	session, err := se.sessionMgr.Get(date)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []WorkSession
+	err = se.exclusive(func() (err error) {
+		sessions, err = se.sessionMgr.SegmentWorkSessions(int64(session.ID), se.config.SessionIdleGap)
+		return err
+	})
+	return sessions, err
+}
+
+// GetWorkSessions returns the day's work sessions without re-segmenting.
+func (se *StorageEngine) GetWorkSessions(date string) ([]WorkSession, error) {
+	session, err := se.sessionMgr.Get(date)
+	if err != nil {
+		return nil, err
+	}
+	return se.sessionMgr.GetWorkSessions(int64(session.ID))
+}
+
+// GetWorkSession retrieves a work session by ID.
+func (se *StorageEngine) GetWorkSession(workSessionID int64) (*WorkSession, error) {
+	return se.sessionMgr.GetWorkSession(workSessionID)
+}
+
+// UpdateWorkSession updates a work session's title and synthesis status.
+func (se *StorageEngine) UpdateWorkSession(ws *WorkSession) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.UpdateWorkSession(ws)
+	})
+}
+
+// SplitWorkSession splits a work session at the given time and returns the
+// new work session that starts there.
+func (se *StorageEngine) SplitWorkSession(workSessionID int64, at time.Time) (*WorkSession, error) {
+	var ws *WorkSession
+	err := se.exclusive(func() (err error) {
+		ws, err = se.sessionMgr.SplitWorkSession(workSessionID, at)
+		return err
+	})
+	return ws, err
+}
+
+// MergeWorkSessions merges adjacent work sessions of one day and returns the result.
+func (se *StorageEngine) MergeWorkSessions(workSessionIDs []int64) (*WorkSession, error) {
+	var ws *WorkSession
+	err := se.exclusive(func() (err error) {
+		ws, err = se.sessionMgr.MergeWorkSessions(workSessionIDs)
+		return err
+	})
+	return ws, err
+}
+
+// GetWorkSessionActivity returns a work session with its activity blocks,
+// meetings and knowledge cards.
+func (se *StorageEngine) GetWorkSessionActivity(workSessionID int64) (*WorkSessionActivity, error) {
+	ws, err := se.sessionMgr.GetWorkSession(workSessionID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := se.sessionMgr.GetByID(int64(ws.SessionID))
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &WorkSessionActivity{WorkSession: *ws, Blocks: []AppBlock{}, Meetings: []Meeting{}}
+
+	// Blocks and meetings on a boundary count toward the work session they start in
+	blocks, err := se.sessionMgr.getBlocksOverlapping(int64(session.ID), ws.StartTime, ws.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if block.StartTime.Before(ws.StartTime) {
+			continue
+		}
+		block.SessionDate = session.Date
+		activity.Blocks = append(activity.Blocks, block)
+	}
+
+	meetings, err := se.sessionMgr.GetMeetings(int64(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range meetings {
+		if !m.StartTime.Before(ws.StartTime) && m.StartTime.Before(ws.EndTime) {
+			activity.Meetings = append(activity.Meetings, m)
+		}
+	}
+
+	activity.KnowledgeCards, err = se.GetKnowledgeCardsByWorkSession(workSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// GetWorkSessionChats retrieves the chat messages about a work session.
+func (se *StorageEngine) GetWorkSessionChats(workSessionID int64) ([]ChatMessage, error) {
+	return se.sessionMgr.GetWorkSessionChats(workSessionID)
+}
+
+// Tag operations
+
+// CreateTag creates a new tag.
+func (se *StorageEngine) CreateTag(tag *Tag) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.CreateTag(tag)
+	})
+}
+
+// GetTag retrieves a tag by ID.
+func (se *StorageEngine) GetTag(tagID int64) (*Tag, error) {
+	return se.sessionMgr.GetTag(tagID)
+}
+
+// ListTags returns all tags ordered by name.
+func (se *StorageEngine) ListTags() ([]Tag, error) {
+	return se.sessionMgr.ListTags()
+}
+
+// UpdateTag renames a tag or changes its color.
+func (se *StorageEngine) UpdateTag(tag *Tag) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.UpdateTag(tag)
+	})
+}
+
+// DeleteTag deletes a tag and removes it from every item.
+func (se *StorageEngine) DeleteTag(tagID int64) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.DeleteTag(tagID)
+	})
+}
+
+// TagItem attaches a tag to a session, activity block or knowledge card,
+// creating the tag if needed.
+func (se *StorageEngine) TagItem(target TagTarget, itemID int64, name string) (*Tag, error) {
+	var tag *Tag
+	err := se.exclusive(func() (err error) {
+		tag, err = se.sessionMgr.TagItem(target, itemID, name)
+		return err
+	})
+	return tag, err
+}
+
+// UntagItem removes a tag from an item.
+func (se *StorageEngine) UntagItem(target TagTarget, itemID, tagID int64) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.UntagItem(target, itemID, tagID)
+	})
+}
+
+// GetItemTags returns the tags attached to an item.
+func (se *StorageEngine) GetItemTags(target TagTarget, itemID int64) ([]Tag, error) {
+	return se.sessionMgr.GetItemTags(target, itemID)
+}
+
+// CreateTagRule creates an auto-tag rule.
+func (se *StorageEngine) CreateTagRule(rule *TagRule) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.CreateTagRule(rule)
+	})
+}
+
+// ListTagRules returns all auto-tag rules.
+func (se *StorageEngine) ListTagRules() ([]TagRule, error) {
+	return se.sessionMgr.ListTagRules()
+}
+
+// DeleteTagRule deletes an auto-tag rule.
+func (se *StorageEngine) DeleteTagRule(ruleID int64) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.DeleteTagRule(ruleID)
+	})
+}
+
+// Revision operations
+
+// GetRevisions returns the revisions of a session or knowledge card, newest
+// first.
+func (se *StorageEngine) GetRevisions(entity RevisionEntity, id int64) ([]Revision, error) {
+	return se.sessionMgr.GetRevisions(entity, id)
+}
+
+// RestoreRevision undoes a revision and every later revision of its item.
+func (se *StorageEngine) RestoreRevision(revisionID int64) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.RestoreRevision(revisionID)
+	})
+}
+
+// PruneRevisions deletes revisions past the configured age and per-item
+// count limits. Returns the number of revisions deleted.
+func (se *StorageEngine) PruneRevisions() (int, error) {
+	maxAge := time.Duration(se.config.RevisionRetentionDays) * 24 * time.Hour
+	var n int
+	err := se.exclusive(func() (err error) {
+		n, err = se.sessionMgr.PruneRevisions(maxAge, se.config.MaxRevisionsPerEntity)
+		return err
+	})
+	return n, err
+}
+
+// Job operations
+
+// GetJobStates returns the persisted schedule state of every job.
+func (se *StorageEngine) GetJobStates() ([]JobState, error) {
+	return se.sessionMgr.GetJobStates()
+}
+
+// SaveJobSchedule records a job's schedule and next run.
+func (se *StorageEngine) SaveJobSchedule(name, schedule string, nextRunAt time.Time) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.SaveJobSchedule(name, schedule, nextRunAt)
+	})
+}
+
+// StartJobRun records the start of a job run, failing with a conflict if
+// the job is already running.
+func (se *StorageEngine) StartJobRun(job string, trigger JobTrigger) (*JobRun, error) {
+	var run *JobRun
+	err := se.exclusive(func() (err error) {
+		run, err = se.sessionMgr.StartJobRun(job, trigger)
+		return err
+	})
+	return run, err
+}
+
+// FinishJobRun records the outcome of a job run.
+func (se *StorageEngine) FinishJobRun(run *JobRun) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.FinishJobRun(run)
+	})
+}
+
+// FailInterruptedJobRuns marks runs left running by a previous process as failed.
+func (se *StorageEngine) FailInterruptedJobRuns() (int, error) {
+	var n int
+	err := se.exclusive(func() (err error) {
+		n, err = se.sessionMgr.FailInterruptedJobRuns()
+		return err
+	})
+	return n, err
+}
+
+// GetJobRuns returns the most recent runs of a job, or of every job when
+// job is empty.
+func (se *StorageEngine) GetJobRuns(job string, limit int) ([]JobRun, error) {
+	return se.sessionMgr.GetJobRuns(job, limit)
+}
+
+// PruneJobRuns keeps only the newest runs of a job.
+func (se *StorageEngine) PruneJobRuns(job string, keep int) (int, error) {
+	var n int
+	err := se.exclusive(func() (err error) {
+		n, err = se.sessionMgr.PruneJobRuns(job, keep)
+		return err
+	})
+	return n, err
+}
+
+// Maintenance operations
+
+// ApplyRetentionPolicy deletes or archives sessions past the retention
+// period and cleans up files and edit history.
+func (se *StorageEngine) ApplyRetentionPolicy() (*RetentionResult, error) {
+	return NewRetentionManager(se.config, se).ApplyRetentionPolicy()
+}
+
+// PreviewRetentionPolicy returns what ApplyRetentionPolicy would delete,
+// archive and compress, without changing anything.
+func (se *StorageEngine) PreviewRetentionPolicy() (*RetentionPlan, error) {
+	return NewRetentionManager(se.config, se).PlanRetention()
+}
+
+// Purge erases everything matching a term, app, domain or time range from
+// the database, its indexes, the vector store and files, and optionally
+// from backups.
+func (se *StorageEngine) Purge(req PurgeRequest) (*PurgeReport, error) {
+	var report *PurgeReport
+	err := se.exclusive(func() (err error) {
+		report, err = NewPurgeManager(se.config, se).Purge(req)
+		return err
+	})
+	return report, err
+}
+
+// PreviewPurge returns what Purge would erase, without changing anything.
+func (se *StorageEngine) PreviewPurge(req PurgeRequest) (*PurgeReport, error) {
+	return NewPurgeManager(se.config, se).PlanPurge(req)
+}
+
+// CleanupOldBackups removes backup snapshots outside the retention policy.
+func (se *StorageEngine) CleanupOldBackups() error {
+	return NewBackupManager(se.config, se).CleanupOldBackups()
+}
+
+// Vacuum rebuilds the database file to reclaim free space.
+func (se *StorageEngine) Vacuum() error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.Vacuum()
+	})
+}
+
+// DeleteOldNotifications deletes notifications older than olderThan.
+func (se *StorageEngine) DeleteOldNotifications(olderThan time.Duration) (int64, error) {
+	var n int64
+	err := se.exclusive(func() (err error) {
+		n, err = se.sessionMgr.DeleteOldNotifications(olderThan)
+		return err
+	})
+	return n, err
+}
+
+// Import state operations
+
+// GetImportWatermark returns the saved high-water mark for an import source.
+func (se *StorageEngine) GetImportWatermark(source string) (string, error) {
+	return se.sessionMgr.GetImportWatermark(source)
+}
+
+// SetImportWatermark saves the high-water mark for an import source.
+func (se *StorageEngine) SetImportWatermark(source, mark string) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.SetImportWatermark(source, mark)
+	})
+}
+
+// BeginImport records the start of an import run and returns its ID.
+func (se *StorageEngine) BeginImport(importer, source string) (int64, error) {
+	var id int64
+	err := se.exclusive(func() (err error) {
+		id, err = se.sessionMgr.BeginImport(importer, source)
+		return err
+	})
+	return id, err
+}
+
+// FinishImport marks an import run as completed or failed and stores its stats.
+func (se *StorageEngine) FinishImport(importID int64, status, statsJSON string) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.FinishImport(importID, status, statsJSON)
+	})
+}
+
+// AddImportRecord links an entity created by an import run to that run.
+func (se *StorageEngine) AddImportRecord(importID int64, importer, entityType string, entityID int64, externalKey string) error {
+	return se.exclusive(func() error {
+		return se.sessionMgr.AddImportRecord(importID, importer, entityType, entityID, externalKey)
+	})
+}
+
+// HasImportedKey reports whether an importer already imported the given external key.
+func (se *StorageEngine) HasImportedKey(importer, externalKey string) (bool, error) {
+	return se.sessionMgr.HasImportedKey(importer, externalKey)
+}
+
+// ListImports returns import runs, newest first.
+func (se *StorageEngine) ListImports(limit int) ([]ImportRun, error) {
+	return se.sessionMgr.ListImports(limit)
+}
+
+// UndoImport removes everything an import run created and drops the
+// embeddings of any sessions that were deleted as a result.
+func (se *StorageEngine) UndoImport(importID int64) (*ImportUndoResult, error) {
+	var result *ImportUndoResult
+	err := se.exclusive(func() (err error) {
+		result, err = se.sessionMgr.UndoImport(importID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range result.SessionsDeleted {
+		if err := se.vectorMgr.DeleteEmbedding(id); err != nil {
+			// Log error but continue - vector might not exist
+		}
+	}
+
+	return result, nil
 }
 
 // Notification operations
 
 // AddNotification adds a notification.
 func (se *StorageEngine) AddNotification(notif *Notification) error {
-	return se.sessionMgr.AddNotification(notif)
+	return se.write(func(tx *sql.Tx) error {
+		return se.sessionMgr.addNotification(tx, notif)
+	})
+}
+
+// write runs fn in the writer's current batch. See WriteCoordinator.Do.
+func (se *StorageEngine) write(fn func(tx *sql.Tx) error) error {
+	se.writeMu.RLock()
+	defer se.writeMu.RUnlock()
+	return se.writer.Do(fn)
+}
+
+// writeSession runs fn in the writer's current batch with the ID of the
+// session for date. The session is looked up under the same lock as the
+// write, so capture can't see the store being replaced in between.
+func (se *StorageEngine) writeSession(date string, fn func(tx *sql.Tx, sessionID int64) error) error {
+	se.writeMu.RLock()
+	defer se.writeMu.RUnlock()
+	session, err := se.sessionMgr.Get(date)
+	if err != nil {
+		return err
+	}
+	return se.writer.Do(func(tx *sql.Tx) error {
+		return fn(tx, int64(session.ID))
+	})
+}
+
+// exclusive runs fn alone on the writer. See WriteCoordinator.Exclusive;
+// fn must not call the engine's exported methods, which would wait for a
+// restore queued behind it.
+func (se *StorageEngine) exclusive(fn func() error) error {
+	se.writeMu.RLock()
+	defer se.writeMu.RUnlock()
+	return se.writer.Exclusive(fn)
+}
+
+// WriteStats returns counts of the writes committed through the engine's
+// writer.
+func (se *StorageEngine) WriteStats() WriteStats {
+	se.writeMu.RLock()
+	defer se.writeMu.RUnlock()
+	if se.writer == nil {
+		return WriteStats{}
+	}
+	return se.writer.Stats()
 }
 
 // GetNotifications retrieves notifications.
@@ -279,54 +1182,150 @@ func (se *StorageEngine) GetNotifications(limit int) ([]Notification, error) {
 
 // MarkNotificationsRead marks notifications as read.
 func (se *StorageEngine) MarkNotificationsRead(ids []string) error {
-	return se.sessionMgr.MarkNotificationsRead(ids)
+	return se.exclusive(func() error {
+		return se.sessionMgr.MarkNotificationsRead(ids)
+	})
 }
 
 // File operations
 
 // SaveScreenshot saves a screenshot file and returns the file path.
 func (se *StorageEngine) SaveScreenshot(sessionDate, appName, filename string, data []byte) (string, error) {
-	return se.fileMgr.SaveFile(sessionDate, appName, filename, data)
+	var path string
+	err := se.exclusive(func() (err error) {
+		path, err = se.fileMgr.SaveFile(sessionDate, appName, filename, data)
+		return err
+	})
+	return path, err
 }
 
-// GetScreenshotPath returns the path to a screenshot file.
+// GetScreenshotPath returns the path to a screenshot file in its current
+// storage tier.
 func (se *StorageEngine) GetScreenshotPath(sessionDate, appName, filename string) string {
 	return se.fileMgr.GetFilePath(sessionDate, appName, filename)
 }
 
-// Backup creates a backup of all storage components.
-func (se *StorageEngine) Backup() error {
-	// Create backup directory with timestamp
-	timestamp := time.Now().Format("20060102-150405")
-	backupDir := filepath.Join(se.config.DataDir, "backups", timestamp)
+// GetThumbnailPath returns the path to a screenshot's thumbnail.
+func (se *StorageEngine) GetThumbnailPath(sessionDate, appName, filename string) string {
+	return se.fileMgr.GetThumbnailPath(sessionDate, appName, filename)
+}
 
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return NewStorageError(ErrFileSystem, "failed to create backup directory", err)
-	}
+// GetFileStats returns file storage statistics, including screenshot
+// bytes per storage tier.
+func (se *StorageEngine) GetFileStats() (*StorageStats, error) {
+	return se.fileMgr.GetStorageStats()
+}
 
-	// Backup SQLite database using VACUUM INTO
-	dbBackupPath := filepath.Join(backupDir, "waddle.db")
-	_, err := se.sessionMgr.DB().Exec("VACUUM INTO ?", dbBackupPath)
+// ListScreenshots returns the full paths of a session's screenshots,
+// including the latest screenshot of each app but not thumbnails.
+func (se *StorageEngine) ListScreenshots(sessionDate string) ([]string, error) {
+	files, err := se.fileMgr.ListSessionFiles(sessionDate)
 	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to backup database", err)
+		return nil, err
 	}
 
-	// TODO: Backup vector database and files
-	// This would involve copying the LanceDB directory and files directory
+	var screenshots []string
+	for _, file := range files {
+		if se.fileMgr.ScreenshotTierOf(file) == ScreenshotTierThumbnail {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".png", ".jpg", ".jpeg", ".webp":
+			screenshots = append(screenshots, filepath.Join(se.fileMgr.GetBaseDir(), file))
+		}
+	}
+	return screenshots, nil
+}
 
-	return nil
+// OpenScreenshot opens a screenshot by a path from ListScreenshots or
+// GetScreenshotPath, decrypting it as it is read.
+func (se *StorageEngine) OpenScreenshot(path string) (io.ReadCloser, error) {
+	return se.fileMgr.OpenFile(path)
+}
+
+// ReadFile reads and decrypts a file by its path relative to the files
+// directory.
+func (se *StorageEngine) ReadFile(relPath string) ([]byte, error) {
+	return se.fileMgr.ReadFile(relPath)
 }
 
-// Restore restores from a backup.
-func (se *StorageEngine) Restore(backupPath string) error {
-	// TODO: Implement restore functionality
-	// This would involve:
-	// 1. Validating backup integrity
-	// 2. Stopping current operations
-	// 3. Replacing current data with backup
-	// 4. Reinitializing components
+// StatScreenshot returns the size, content hash and modification time of
+// a screenshot by a path from ListScreenshots or GetScreenshotPath.
+func (se *StorageEngine) StatScreenshot(path string) (*FileRef, error) {
+	return se.fileMgr.StatFile(path)
+}
+
+// LinkScreenshot links a saved screenshot to the activity block it was
+// captured for, so it can be found from the block.
+func (se *StorageEngine) LinkScreenshot(sessionDate, appName, filename string, blockID int64) error {
+	return se.exclusive(func() error {
+		return se.fileMgr.LinkFile(se.fileMgr.GetFilePath(sessionDate, appName, filename), blockID)
+	})
+}
 
-	return NewStorageError(ErrNotImplemented, "restore not yet implemented", nil)
+// GetBlockScreenshots returns the files linked to an activity block.
+func (se *StorageEngine) GetBlockScreenshots(blockID int64) ([]FileRef, error) {
+	return se.sessionMgr.GetBlockFileRefs(blockID)
+}
+
+// CollectGarbage deletes screenshot blobs no file has referenced for
+// DefaultBlobGracePeriod. Returns the number of blobs deleted and the
+// bytes freed.
+func (se *StorageEngine) CollectGarbage() (int, int64, error) {
+	var blobs int
+	var freed int64
+	err := se.exclusive(func() (err error) {
+		blobs, freed, err = se.fileMgr.CollectGarbage(DefaultBlobGracePeriod)
+		return err
+	})
+	return blobs, freed, err
+}
+
+// Backup creates an incremental snapshot of all storage components.
+func (se *StorageEngine) Backup() error {
+	_, err := NewBackupManager(se.config, se).CreateBackup()
+	return err
+}
+
+// Restore restores from a backup snapshot. Backups from another machine,
+// or made before the vault was lost, need their recovery key. Writes wait
+// until the restored store is open, but reads during a restore can fail, so
+// callers stop capture and background work first.
+func (se *StorageEngine) Restore(backupPath string, opts RestoreOptions) error {
+	return NewBackupManager(se.config, se).Restore(backupPath, opts)
+}
+
+// SetupRecovery sets up recovery of the master key under a passphrase and
+// writes the recovery key to the backup directory, replacing any earlier
+// one. The key is rewrapped whenever the master key changes.
+func (se *StorageEngine) SetupRecovery(passphrase string) (*RecoveryKey, error) {
+	if _, err := se.encryptionMgr.EnableRecovery(passphrase); err != nil {
+		return nil, err
+	}
+	return NewBackupManager(se.config, se).writeRecoveryKey()
+}
+
+// GetRecoveryKey returns the recovery key for the current master key, or a
+// not found error if recovery is not set up.
+func (se *StorageEngine) GetRecoveryKey() (*RecoveryKey, error) {
+	return se.encryptionMgr.RecoveryKey()
+}
+
+// ExportBundle writes a portable export bundle that can be imported on
+// another machine.
+func (se *StorageEngine) ExportBundle(path string, opts BundleExportOptions) (*BundleExportResult, error) {
+	return NewBundleManager(se.config, se).Export(path, opts)
+}
+
+// ImportBundle merges an export bundle into the store, re-encrypting its data
+// under this store's key.
+func (se *StorageEngine) ImportBundle(path string, opts BundleImportOptions) (*BundleImportResult, error) {
+	var result *BundleImportResult
+	err := se.exclusive(func() (err error) {
+		result, err = NewBundleManager(se.config, se).Import(path, opts)
+		return err
+	})
+	return result, err
 }
 
 // HealthCheck performs a health check on all storage components.
@@ -405,21 +1404,41 @@ func (se *StorageEngine) GetPendingSessionsCount() (int, error) {
 }
 
 // UpdateSessionSynthesis updates the synthesis-related fields of a session.
+// The session is tagged by the auto-tag rules matching its entities.
 func (se *StorageEngine) UpdateSessionSynthesis(sessionID types.SessionID, entitiesJSON, synthesisStatus, aiSummary, aiBullets string) error {
-	return se.sessionMgr.UpdateSessionSynthesis(int64(sessionID), entitiesJSON, synthesisStatus, aiSummary, aiBullets)
+	return se.exclusive(func() error {
+		if err := se.sessionMgr.UpdateSessionSynthesis(int64(sessionID), entitiesJSON, synthesisStatus, aiSummary, aiBullets); err != nil {
+			return err
+		}
+		_, err := se.sessionMgr.ApplyTagRules(TagTargetSession, int64(sessionID), entitiesJSON)
+		return err
+	})
 }
 
 // Knowledge Card operations
 
-// CreateKnowledgeCard creates a new knowledge card for a session.
+// CreateKnowledgeCard creates a new knowledge card for a session and tags it
+// by the auto-tag rules matching its entities.
 func (se *StorageEngine) CreateKnowledgeCard(card *KnowledgeCard) error {
+	return se.exclusive(func() error {
+		return se.createKnowledgeCard(card)
+	})
+}
+
+// createKnowledgeCard inserts and tags a knowledge card on the writer.
+func (se *StorageEngine) createKnowledgeCard(card *KnowledgeCard) error {
 	card.CreatedAt = time.Now()
 	card.UpdatedAt = time.Now()
 
+	var workSessionRef interface{}
+	if card.WorkSessionID != 0 {
+		workSessionRef = int64(card.WorkSessionID)
+	}
+
 	result, err := se.sessionMgr.DB().Exec(`
-		INSERT INTO knowledge_cards (session_id, title, bullets, entities, status, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, card.SessionID, card.Title, card.Bullets, card.Entities, card.Status, card.CreatedAt, card.UpdatedAt)
+		INSERT INTO knowledge_cards (session_id, work_session_id, title, bullets, entities, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, card.SessionID, workSessionRef, card.Title, card.Bullets, card.Entities, card.Status, card.CreatedAt, card.UpdatedAt)
 
 	if err != nil {
 		return NewStorageError(ErrDatabase, "failed to create knowledge card", err)
@@ -431,6 +1450,11 @@ func (se *StorageEngine) CreateKnowledgeCard(card *KnowledgeCard) error {
 	}
 
 	card.ID = types.ElementID(id)
+
+	// Tag the card from its entities
+	if _, err := se.sessionMgr.ApplyTagRules(TagTargetCard, id, card.Entities); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -441,7 +1465,7 @@ func (se *StorageEngine) GetKnowledgeCards(status string, limit int) ([]Knowledg
 
 	if status != "" {
 		query = `
-			SELECT id, session_id, title, bullets, entities, status, created_at, updated_at
+			SELECT id, session_id, work_session_id, title, bullets, entities, status, created_at, updated_at
 			FROM knowledge_cards 
 			WHERE status = ?
 			ORDER BY created_at DESC
@@ -450,7 +1474,7 @@ func (se *StorageEngine) GetKnowledgeCards(status string, limit int) ([]Knowledg
 		args = []interface{}{status, limit}
 	} else {
 		query = `
-			SELECT id, session_id, title, bullets, entities, status, created_at, updated_at
+			SELECT id, session_id, work_session_id, title, bullets, entities, status, created_at, updated_at
 			FROM knowledge_cards 
 			ORDER BY created_at DESC
 			LIMIT ?
@@ -464,24 +1488,13 @@ func (se *StorageEngine) GetKnowledgeCards(status string, limit int) ([]Knowledg
 	}
 	defer rows.Close()
 
-	var cards []KnowledgeCard
-	for rows.Next() {
-		var card KnowledgeCard
-		err := rows.Scan(&card.ID, &card.SessionID, &card.Title, &card.Bullets,
-			&card.Entities, &card.Status, &card.CreatedAt, &card.UpdatedAt)
-		if err != nil {
-			return nil, NewStorageError(ErrDatabase, "failed to scan knowledge card", err)
-		}
-		cards = append(cards, card)
-	}
-
-	return cards, nil
+	return scanKnowledgeCards(rows)
 }
 
 // GetKnowledgeCardsBySession retrieves knowledge cards for a specific session.
 func (se *StorageEngine) GetKnowledgeCardsBySession(sessionID types.SessionID) ([]KnowledgeCard, error) {
 	rows, err := se.sessionMgr.DB().Query(`
-		SELECT id, session_id, title, bullets, entities, status, created_at, updated_at
+		SELECT id, session_id, work_session_id, title, bullets, entities, status, created_at, updated_at
 		FROM knowledge_cards 
 		WHERE session_id = ?
 		ORDER BY created_at DESC
@@ -492,33 +1505,70 @@ func (se *StorageEngine) GetKnowledgeCardsBySession(sessionID types.SessionID) (
 	}
 	defer rows.Close()
 
+	return scanKnowledgeCards(rows)
+}
+
+// GetKnowledgeCardsByWorkSession retrieves knowledge cards for a work session.
+func (se *StorageEngine) GetKnowledgeCardsByWorkSession(workSessionID int64) ([]KnowledgeCard, error) {
+	rows, err := se.sessionMgr.DB().Query(`
+		SELECT id, session_id, work_session_id, title, bullets, entities, status, created_at, updated_at
+		FROM knowledge_cards
+		WHERE work_session_id = ?
+		ORDER BY created_at DESC
+	`, workSessionID)
+
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to query knowledge cards by work session", err)
+	}
+	defer rows.Close()
+
+	return scanKnowledgeCards(rows)
+}
+
+// scanKnowledgeCards scans knowledge card rows.
+func scanKnowledgeCards(rows *sql.Rows) ([]KnowledgeCard, error) {
 	var cards []KnowledgeCard
 	for rows.Next() {
 		var card KnowledgeCard
-		err := rows.Scan(&card.ID, &card.SessionID, &card.Title, &card.Bullets,
+		var workSessionID sql.NullInt64
+		err := rows.Scan(&card.ID, &card.SessionID, &workSessionID, &card.Title, &card.Bullets,
 			&card.Entities, &card.Status, &card.CreatedAt, &card.UpdatedAt)
 		if err != nil {
 			return nil, NewStorageError(ErrDatabase, "failed to scan knowledge card", err)
 		}
+		card.WorkSessionID = types.ElementID(workSessionID.Int64)
 		cards = append(cards, card)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating knowledge cards", err)
+	}
+
 	return cards, nil
 }
 
-// UpdateKnowledgeCard updates an existing knowledge card.
+// UpdateKnowledgeCard updates an existing knowledge card as an edit by the
+// user.
 func (se *StorageEngine) UpdateKnowledgeCard(card *KnowledgeCard) error {
-	card.UpdatedAt = time.Now()
-
-	_, err := se.sessionMgr.DB().Exec(`
-		UPDATE knowledge_cards 
-		SET title = ?, bullets = ?, entities = ?, status = ?, updated_at = ?
-		WHERE id = ?
-	`, card.Title, card.Bullets, card.Entities, card.Status, card.UpdatedAt, card.ID)
+	return se.UpdateKnowledgeCardAs(card, RevisionActorUser)
+}
 
-	if err != nil {
-		return NewStorageError(ErrDatabase, "failed to update knowledge card", err)
-	}
+// UpdateKnowledgeCardAs updates an existing knowledge card, recording the
+// change as a revision by actor.
+func (se *StorageEngine) UpdateKnowledgeCardAs(card *KnowledgeCard, actor RevisionActor) error {
+	card.UpdatedAt = time.Now()
 
-	return nil
+	return se.exclusive(func() error {
+		return se.sessionMgr.updateWithRevision(RevisionEntityCard, int64(card.ID), actor, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				UPDATE knowledge_cards 
+				SET title = ?, bullets = ?, entities = ?, status = ?, updated_at = ?
+				WHERE id = ?
+			`, card.Title, card.Bullets, card.Entities, card.Status, card.UpdatedAt, card.ID)
+			if err != nil {
+				return NewStorageError(ErrDatabase, "failed to update knowledge card", err)
+			}
+			return nil
+		})
+	})
 }
@@ -107,6 +107,32 @@ func TestStorageEngineBasicOperations(t *testing.T) {
 			t.Error("Expected total > 0")
 		}
 	})
+
+	t.Run("Writes go through the writer", func(t *testing.T) {
+		before := se.WriteStats()
+
+		session, err := se.CreateSession("2025-01-22")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		session.CustomTitle = "Tagged"
+		if err := se.UpdateSession(session); err != nil {
+			t.Fatalf("Failed to update session: %v", err)
+		}
+		if _, err := se.TagItem(TagTargetSession, int64(session.ID), "work"); err != nil {
+			t.Fatalf("Failed to tag session: %v", err)
+		}
+		if err := se.AddNote("2025-01-22", &ManualNote{Content: "note"}); err != nil {
+			t.Fatalf("Failed to add note: %v", err)
+		}
+		if err := se.DeleteSession("2025-01-22"); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+
+		if stats := se.WriteStats(); stats.Writes != before.Writes+5 {
+			t.Errorf("Expected 5 more writes, got %+v", stats)
+		}
+	})
 }
 
 // TestPropertyCascadeDeleteCompleteness is Property Test 10: Cascade Delete Completeness
@@ -220,7 +246,7 @@ func TestPropertyCascadeDeleteCompleteness(t *testing.T) {
 
 			// Check if file exists
 			filePath := se.GetScreenshotPath(data.Date, data.AppName, data.FileName)
-			if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			if _, err := se.StatScreenshot(filePath); err != nil {
 				t.Logf("File should exist before deletion")
 				return false
 			}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// tagLink describes the link table joining tags to one kind of item.
+type tagLink struct {
+	table  string // Link table
+	column string // Item column in the link table
+	items  string // Table the items live in
+}
+
+var tagLinks = map[TagTarget]tagLink{
+	TagTargetSession: {table: "session_tags", column: "session_id", items: "sessions"},
+	TagTargetBlock:   {table: "block_tags", column: "block_id", items: "activity_blocks"},
+	TagTargetCard:    {table: "card_tags", column: "card_id", items: "knowledge_cards"},
+}
+
+func getTagLink(target TagTarget) (tagLink, error) {
+	link, ok := tagLinks[target]
+	if !ok {
+		return tagLink{}, NewStorageError(ErrValidation, "unknown tag target "+string(target), nil)
+	}
+	return link, nil
+}
+
+// normalizeTagName trims a tag name and rejects empty ones.
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", NewStorageError(ErrValidation, "tag name is required", nil)
+	}
+	return name, nil
+}
+
+// CreateTag creates a new tag. Names are unique regardless of case.
+func (sm *SessionManager) CreateTag(tag *Tag) error {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+	tag.CreatedAt = time.Now()
+
+	result, err := sm.db.Exec(`INSERT INTO tags (name, color, created_at) VALUES (?, ?, ?)`,
+		tag.Name, tag.Color, tag.CreatedAt)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return NewStorageError(ErrConflict, "tag already exists", err)
+		}
+		return NewStorageError(ErrDatabase, "failed to create tag", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get tag ID", err)
+	}
+	tag.ID = types.ElementID(id)
+	return nil
+}
+
+// GetTag retrieves a tag by ID.
+func (sm *SessionManager) GetTag(id int64) (*Tag, error) {
+	var tag Tag
+	err := sm.db.QueryRow(`SELECT id, name, color, created_at FROM tags WHERE id = ?`, id).
+		Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "tag not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get tag", err)
+	}
+	return &tag, nil
+}
+
+// ListTags returns all tags ordered by name.
+func (sm *SessionManager) ListTags() ([]Tag, error) {
+	rows, err := sm.db.Query(`SELECT id, name, color, created_at FROM tags ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to list tags", err)
+	}
+	defer rows.Close()
+	return scanTags(rows)
+}
+
+// UpdateTag renames a tag or changes its color.
+func (sm *SessionManager) UpdateTag(tag *Tag) error {
+	if tag.ID == 0 {
+		return NewStorageError(ErrValidation, "tag ID is required for update", nil)
+	}
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+
+	result, err := sm.db.Exec(`UPDATE tags SET name = ?, color = ? WHERE id = ?`, tag.Name, tag.Color, int64(tag.ID))
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return NewStorageError(ErrConflict, "tag already exists", err)
+		}
+		return NewStorageError(ErrDatabase, "failed to update tag", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "tag not found", nil)
+	}
+	return nil
+}
+
+// DeleteTag deletes a tag and removes it from every item.
+func (sm *SessionManager) DeleteTag(id int64) error {
+	result, err := sm.db.Exec(`DELETE FROM tags WHERE id = ?`, id)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to delete tag", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "tag not found", nil)
+	}
+	return nil
+}
+
+// TagItem attaches the tag called name to an item, creating the tag if it
+// does not exist yet. Tagging an item twice is a no-op.
+func (sm *SessionManager) TagItem(target TagTarget, itemID int64, name string) (*Tag, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin tagging", err)
+	}
+	defer tx.Rollback()
+
+	tag, err := tagItem(tx, target, itemID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit tagging", err)
+	}
+	return tag, nil
+}
+
+func tagItem(tx *sql.Tx, target TagTarget, itemID int64, name string) (*Tag, error) {
+	link, err := getTagLink(target)
+	if err != nil {
+		return nil, err
+	}
+	name, err = normalizeTagName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM `+link.items+` WHERE id = ?`, itemID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, string(target)+" not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to look up tagged item", err)
+	}
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name, color, created_at) VALUES (?, '', ?)`, name, time.Now()); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to create tag", err)
+	}
+	var tag Tag
+	err = tx.QueryRow(`SELECT id, name, color, created_at FROM tags WHERE name = ?`, name).
+		Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get tag", err)
+	}
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO `+link.table+` (`+link.column+`, tag_id) VALUES (?, ?)`,
+		itemID, int64(tag.ID)); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to tag item", err)
+	}
+	return &tag, nil
+}
+
+// UntagItem removes a tag from an item.
+func (sm *SessionManager) UntagItem(target TagTarget, itemID, tagID int64) error {
+	link, err := getTagLink(target)
+	if err != nil {
+		return err
+	}
+
+	result, err := sm.db.Exec(`DELETE FROM `+link.table+` WHERE `+link.column+` = ? AND tag_id = ?`, itemID, tagID)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to untag item", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "item does not have this tag", nil)
+	}
+	return nil
+}
+
+// GetItemTags returns the tags attached to an item, ordered by name.
+func (sm *SessionManager) GetItemTags(target TagTarget, itemID int64) ([]Tag, error) {
+	link, err := getTagLink(target)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := sm.db.Query(`
+		SELECT t.id, t.name, t.color, t.created_at
+		FROM tags t
+		JOIN `+link.table+` l ON l.tag_id = t.id
+		WHERE l.`+link.column+` = ?
+		ORDER BY t.name COLLATE NOCASE
+	`, itemID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get item tags", err)
+	}
+	defer rows.Close()
+	return scanTags(rows)
+}
+
+func scanTags(rows *sql.Rows) ([]Tag, error) {
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan tag", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating tags", err)
+	}
+	return tags, nil
+}
+
+// taggedSessionsFilter returns a SQL condition on sessionColumn that holds
+// for sessions carrying every one of tags, whether on the session itself,
+// on one of its activity blocks or on one of its knowledge cards.
+func taggedSessionsFilter(sessionColumn string, tags []string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, name := range tags {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		conds = append(conds, sessionColumn+` IN (
+			SELECT st.session_id FROM session_tags st JOIN tags t ON t.id = st.tag_id WHERE t.name = ?
+			UNION
+			SELECT aa.session_id FROM block_tags bt
+			JOIN tags t ON t.id = bt.tag_id
+			JOIN activity_blocks ab ON ab.id = bt.block_id
+			JOIN app_activities aa ON aa.id = ab.app_activity_id
+			WHERE t.name = ?
+			UNION
+			SELECT kc.session_id FROM card_tags ct
+			JOIN tags t ON t.id = ct.tag_id
+			JOIN knowledge_cards kc ON kc.id = ct.card_id
+			WHERE t.name = ?)`)
+		args = append(args, name, name, name)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// CreateTagRule creates an auto-tag rule. The pattern must be a valid
+// regular expression.
+func (sm *SessionManager) CreateTagRule(rule *TagRule) error {
+	if rule.Pattern == "" {
+		return NewStorageError(ErrValidation, "tag rule pattern is required", nil)
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		return NewStorageError(ErrValidation, "invalid tag rule pattern", err)
+	}
+	if strings.TrimSpace(rule.Tag) == "" {
+		return NewStorageError(ErrValidation, "tag rule tag is required", nil)
+	}
+	rule.CreatedAt = time.Now()
+
+	result, err := sm.db.Exec(`INSERT INTO tag_rules (entity_type, pattern, tag, created_at) VALUES (?, ?, ?, ?)`,
+		string(rule.EntityType), rule.Pattern, rule.Tag, rule.CreatedAt)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to create tag rule", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to get tag rule ID", err)
+	}
+	rule.ID = types.ElementID(id)
+	return nil
+}
+
+// ListTagRules returns all auto-tag rules in creation order.
+func (sm *SessionManager) ListTagRules() ([]TagRule, error) {
+	rows, err := sm.db.Query(`SELECT id, entity_type, pattern, tag, created_at FROM tag_rules ORDER BY id`)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to list tag rules", err)
+	}
+	defer rows.Close()
+
+	rules := []TagRule{}
+	for rows.Next() {
+		var rule TagRule
+		if err := rows.Scan(&rule.ID, &rule.EntityType, &rule.Pattern, &rule.Tag, &rule.CreatedAt); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan tag rule", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating tag rules", err)
+	}
+	return rules, nil
+}
+
+// DeleteTagRule deletes an auto-tag rule. Tags it already applied are kept.
+func (sm *SessionManager) DeleteTagRule(id int64) error {
+	result, err := sm.db.Exec(`DELETE FROM tag_rules WHERE id = ?`, id)
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to delete tag rule", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "tag rule not found", nil)
+	}
+	return nil
+}
+
+// ApplyTagRules tags an item from its extracted entities (a JSON array of
+// Entity) using the auto-tag rules, and returns the tags it applied.
+func (sm *SessionManager) ApplyTagRules(target TagTarget, itemID int64, entitiesJSON string) ([]Tag, error) {
+	if entitiesJSON == "" {
+		return nil, nil
+	}
+	rules, err := sm.ListTagRules()
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	var entities []Entity
+	if err := json.Unmarshal([]byte(entitiesJSON), &entities); err != nil {
+		return nil, NewStorageError(ErrValidation, "failed to parse entities", err)
+	}
+	names := matchTagRules(rules, entities)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin tagging", err)
+	}
+	defer tx.Rollback()
+
+	var applied []Tag
+	for _, name := range names {
+		tag, err := tagItem(tx, target, itemID, name)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, *tag)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit tagging", err)
+	}
+	return applied, nil
+}
+
+// matchTagRules returns the distinct tag names the rules produce for entities.
+func matchTagRules(rules []TagRule, entities []Entity) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			continue // Rules are validated on creation
+		}
+		for _, entity := range entities {
+			if rule.EntityType != "" && entity.Type != rule.EntityType {
+				continue
+			}
+			match := re.FindStringSubmatchIndex(entity.Value)
+			if match == nil {
+				continue
+			}
+			name := strings.TrimSpace(string(re.ExpandString(nil, rule.Tag, entity.Value, match)))
+			if name != "" && !seen[strings.ToLower(name)] {
+				seen[strings.ToLower(name)] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
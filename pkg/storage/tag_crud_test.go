@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTags tests tag CRUD, tagging items, search filters and auto-tag rules.
+func TestTags(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	client := &Session{Date: "2025-05-01", CustomTitle: "invoice review"}
+	internal := &Session{Date: "2025-05-02", CustomTitle: "invoice cleanup"}
+	for _, s := range []*Session{client, internal} {
+		if err := sm.Create(s); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	t.Run("Create and rename", func(t *testing.T) {
+		tag := &Tag{Name: "  Acme ", Color: "#ff0000"}
+		if err := sm.CreateTag(tag); err != nil {
+			t.Fatalf("Failed to create tag: %v", err)
+		}
+		if tag.Name != "Acme" {
+			t.Errorf("Expected trimmed name, got %q", tag.Name)
+		}
+		if err := sm.CreateTag(&Tag{Name: "acme"}); !IsConflict(err) {
+			t.Errorf("Expected conflict for duplicate name, got %v", err)
+		}
+		if err := sm.CreateTag(&Tag{Name: " "}); !IsValidation(err) {
+			t.Errorf("Expected validation error for empty name, got %v", err)
+		}
+
+		tag.Name = "client:acme"
+		if err := sm.UpdateTag(tag); err != nil {
+			t.Fatalf("Failed to rename tag: %v", err)
+		}
+		got, err := sm.GetTag(int64(tag.ID))
+		if err != nil || got.Name != "client:acme" || got.Color != "#ff0000" {
+			t.Errorf("Unexpected tag after rename: %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("Tag and untag items", func(t *testing.T) {
+		block := &ActivityBlock{
+			BlockID:   "10-00",
+			StartTime: time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2025, 5, 2, 10, 5, 0, 0, time.UTC),
+		}
+		if err := sm.AddBlock(int64(internal.ID), "Code", block); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+
+		// Tagging by name reuses the existing tag regardless of case
+		tag, err := sm.TagItem(TagTargetSession, int64(client.ID), "CLIENT:ACME")
+		if err != nil {
+			t.Fatalf("Failed to tag session: %v", err)
+		}
+		if tag.Name != "client:acme" {
+			t.Errorf("Expected existing tag, got %+v", tag)
+		}
+		if _, err := sm.TagItem(TagTargetSession, int64(client.ID), "client:acme"); err != nil {
+			t.Errorf("Expected tagging twice to be a no-op, got %v", err)
+		}
+		if _, err := sm.TagItem(TagTargetBlock, int64(block.ID), "billable"); err != nil {
+			t.Fatalf("Failed to tag block: %v", err)
+		}
+
+		if _, err := sm.TagItem(TagTargetCard, 9999, "billable"); !IsNotFound(err) {
+			t.Errorf("Expected not found for missing card, got %v", err)
+		}
+		if _, err := sm.TagItem("note", int64(client.ID), "billable"); !IsValidation(err) {
+			t.Errorf("Expected validation error for unknown target, got %v", err)
+		}
+
+		tags, err := sm.GetItemTags(TagTargetBlock, int64(block.ID))
+		if err != nil || len(tags) != 1 || tags[0].Name != "billable" {
+			t.Fatalf("Unexpected block tags: %+v (%v)", tags, err)
+		}
+		if err := sm.UntagItem(TagTargetBlock, int64(block.ID), int64(tags[0].ID)); err != nil {
+			t.Fatalf("Failed to untag block: %v", err)
+		}
+		if err := sm.UntagItem(TagTargetBlock, int64(block.ID), int64(tags[0].ID)); !IsNotFound(err) {
+			t.Errorf("Expected not found for removed tag, got %v", err)
+		}
+		if _, err := sm.TagItem(TagTargetBlock, int64(block.ID), "billable"); err != nil {
+			t.Fatalf("Failed to re-tag block: %v", err)
+		}
+	})
+
+	t.Run("Search filters by tag", func(t *testing.T) {
+		all, err := sm.Search("invoice", 1, 10)
+		if err != nil || len(all) != 2 {
+			t.Fatalf("Expected 2 unfiltered results, got %d (%v)", len(all), err)
+		}
+
+		results, err := sm.Search("invoice", 1, 10, "client:acme")
+		if err != nil || len(results) != 1 || results[0].Session.ID != client.ID {
+			t.Errorf("Expected only the tagged session, got %+v (%v)", results, err)
+		}
+
+		// A tag on a block counts for its session
+		results, err = sm.Search("invoice", 1, 10, "billable")
+		if err != nil || len(results) != 1 || results[0].Session.ID != internal.ID {
+			t.Errorf("Expected the session with the tagged block, got %+v (%v)", results, err)
+		}
+
+		// Several tags must all be present
+		results, err = sm.Search("invoice", 1, 10, "client:acme", "billable")
+		if err != nil || len(results) != 0 {
+			t.Errorf("Expected no session with both tags, got %+v (%v)", results, err)
+		}
+	})
+
+	t.Run("Auto-tag rules", func(t *testing.T) {
+		if err := sm.CreateTagRule(&TagRule{Pattern: "("}); !IsValidation(err) {
+			t.Errorf("Expected validation error for invalid pattern, got %v", err)
+		}
+		rule := &TagRule{EntityType: "jira_ticket", Pattern: `^([A-Z]+)-\d+$`, Tag: "jira:$1"}
+		if err := sm.CreateTagRule(rule); err != nil {
+			t.Fatalf("Failed to create rule: %v", err)
+		}
+
+		entities := `[{"value":"ACME-12","type":"jira_ticket"},{"value":"ACME-40","type":"jira_ticket"},{"value":"#ACME-1","type":"hashtag"}]`
+		applied, err := sm.ApplyTagRules(TagTargetSession, int64(internal.ID), entities)
+		if err != nil {
+			t.Fatalf("Failed to apply rules: %v", err)
+		}
+		if len(applied) != 1 || applied[0].Name != "jira:ACME" {
+			t.Errorf("Expected one jira:ACME tag, got %+v", applied)
+		}
+
+		if err := sm.DeleteTagRule(int64(rule.ID)); err != nil {
+			t.Fatalf("Failed to delete rule: %v", err)
+		}
+		tags, err := sm.GetItemTags(TagTargetSession, int64(internal.ID))
+		if err != nil || len(tags) != 1 {
+			t.Errorf("Expected applied tag to stay after deleting the rule, got %+v (%v)", tags, err)
+		}
+	})
+
+	t.Run("Deleting a tag removes it from items", func(t *testing.T) {
+		tags, err := sm.ListTags()
+		if err != nil {
+			t.Fatalf("Failed to list tags: %v", err)
+		}
+		for _, tag := range tags {
+			if err := sm.DeleteTag(int64(tag.ID)); err != nil {
+				t.Fatalf("Failed to delete tag: %v", err)
+			}
+		}
+		got, err := sm.GetItemTags(TagTargetSession, int64(client.ID))
+		if err != nil || len(got) != 0 {
+			t.Errorf("Expected no tags left, got %+v (%v)", got, err)
+		}
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -28,15 +29,17 @@ const (
 	DefaultEmbedQueueSize = 1000
 	// MaxEmbedRetries is the maximum number of retries for embedding generation.
 	MaxEmbedRetries = 3
-	// CollectionName is the name of the embeddings collection.
+	// CollectionName is the name of the embeddings collection in chromem-go
+	// databases, which are imported into the vector store on open.
 	CollectionName = "session_embeddings"
 )
 
-// VectorManager manages vector embeddings using chromem-go (pure Go vector DB).
+// VectorManager manages vector embeddings in an on-disk store indexed by an
+// HNSW graph for approximate nearest-neighbour search.
 // It uses Ollama for embedding generation with the nomic-embed-text model.
 type VectorManager struct {
-	db           *chromem.DB
-	collection   *chromem.Collection
+	store        *vectorStore
+	indexConfig  *VectorIndexConfig
 	ollamaURL    string
 	modelVersion string
 	dataDir      string
@@ -53,6 +56,8 @@ type VectorManagerConfig struct {
 	OllamaURL    string // Ollama API URL (default: http://localhost:11434)
 	ModelVersion string // Embedding model version (default: nomic-embed-text)
 	QueueSize    int    // Async embedding queue size (default: 1000)
+
+	Index *VectorIndexConfig // Nearest-neighbour index tuning (default: DefaultVectorIndexConfig())
 }
 
 // DefaultVectorManagerConfig returns a VectorManagerConfig with default values.
@@ -62,6 +67,7 @@ func DefaultVectorManagerConfig(dataDir string) *VectorManagerConfig {
 		OllamaURL:    DefaultOllamaURL,
 		ModelVersion: DefaultEmbeddingModel,
 		QueueSize:    DefaultEmbedQueueSize,
+		Index:        DefaultVectorIndexConfig(),
 	}
 }
 
@@ -90,6 +96,7 @@ func NewVectorManager(config *VectorManagerConfig) (*VectorManager, error) {
 		ollamaURL:    config.OllamaURL,
 		modelVersion: config.ModelVersion,
 		dataDir:      config.DataDir,
+		indexConfig:  config.Index.withDefaults(),
 		embedQueue:   make(chan EmbedRequest, config.QueueSize),
 		stopChan:     make(chan struct{}),
 		httpClient: &http.Client{
@@ -105,7 +112,8 @@ func NewVectorManager(config *VectorManagerConfig) (*VectorManager, error) {
 	return vm, nil
 }
 
-// initialize sets up the chromem-go database and collection.
+// initialize opens the vector store, importing the embeddings of the
+// chromem-go store used before it if there is one.
 func (vm *VectorManager) initialize() error {
 	// Create the vectors directory
 	vectorsDir := filepath.Join(vm.dataDir, "vectors")
@@ -113,29 +121,64 @@ func (vm *VectorManager) initialize() error {
 		return NewStorageError(ErrFileSystem, "failed to create vectors directory", err)
 	}
 
-	// Create persistent chromem-go database
-	dbPath := filepath.Join(vectorsDir, "chromem")
-	db, err := chromem.NewPersistentDB(dbPath, false)
+	store, err := openVectorStore(filepath.Join(vectorsDir, vectorIndexDir), EmbeddingDimensions, vm.indexConfig)
 	if err != nil {
-		return NewStorageError(ErrVector, "failed to create vector database", err)
+		return err
 	}
-	vm.db = db
+	vm.store = store
 
-	// Create or get the embeddings collection
-	// We use a custom embedding function that calls Ollama
-	embeddingFunc := vm.createEmbeddingFunc()
-	collection, err := db.GetOrCreateCollection(CollectionName, nil, embeddingFunc)
-	if err != nil {
-		return NewStorageError(ErrVector, "failed to create embeddings collection", err)
+	if err := vm.importChromem(filepath.Join(vectorsDir, "chromem")); err != nil {
+		store.close()
+		return err
 	}
-	vm.collection = collection
 
 	return nil
 }
 
-// createEmbeddingFunc creates an embedding function using Ollama.
-func (vm *VectorManager) createEmbeddingFunc() chromem.EmbeddingFunc {
-	return chromem.NewEmbeddingFuncOllama(vm.modelVersion, vm.ollamaURL)
+// importChromem moves the embeddings of a chromem-go database into the
+// store and removes the database.
+func (vm *VectorManager) importChromem(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	db, err := chromem.NewPersistentDB(path, false)
+	if err != nil {
+		return NewStorageError(ErrVector, "failed to open chromem-go vector database", err)
+	}
+	if collection := db.GetCollection(CollectionName, nil); collection != nil && collection.Count() > 0 {
+		// chromem-go can't list documents, but a query for all of them returns them
+		probe := make([]float32, EmbeddingDimensions)
+		for i := range probe {
+			probe[i] = 1
+		}
+		docs, err := collection.QueryEmbedding(context.Background(), probe, collection.Count(), nil, nil)
+		if err != nil {
+			return NewStorageError(ErrVector, "failed to read chromem-go embeddings", err)
+		}
+		for _, doc := range docs {
+			key, ok := parseVectorDocID(doc.ID)
+			sessionID, err := strconv.ParseInt(doc.Metadata["session_id"], 10, 64)
+			if !ok || err != nil || len(doc.Embedding) != EmbeddingDimensions {
+				continue
+			}
+			modelVersion := doc.Metadata["model_version"]
+			if modelVersion == "" {
+				modelVersion = vm.modelVersion
+			}
+			if err := vm.store.put(key, sessionID, modelVersion, doc.Embedding); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := vm.store.flush(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to remove chromem-go vector database", err)
+	}
+	return nil
 }
 
 // GenerateEmbedding generates an embedding vector for the given text using Ollama.
@@ -224,26 +267,8 @@ func (vm *VectorManager) StoreEmbedding(sessionID int64, embedding []float32) er
 			nil)
 	}
 
-	// Create document ID from session ID
-	docID := fmt.Sprintf("session_%d", sessionID)
-
-	// Create metadata with model version and timestamps
-	metadata := map[string]string{
-		"session_id":    fmt.Sprintf("%d", sessionID),
-		"model_version": vm.modelVersion,
-		"created_at":    time.Now().UTC().Format(time.RFC3339),
-		"updated_at":    time.Now().UTC().Format(time.RFC3339),
-	}
-
-	// Add document with pre-computed embedding
-	ctx := context.Background()
-	err := vm.collection.Add(ctx,
-		[]string{docID},
-		[][]float32{embedding},
-		[]map[string]string{metadata},
-		[]string{""}, // Empty content since we're storing pre-computed embeddings
-	)
-	if err != nil {
+	key := vectorKey{kind: vectorKindSession, id: sessionID}
+	if err := vm.store.put(key, sessionID, vm.modelVersion, embedding); err != nil {
 		return NewStorageError(ErrVector, "failed to store embedding", err)
 	}
 
@@ -252,6 +277,13 @@ func (vm *VectorManager) StoreEmbedding(sessionID int64, embedding []float32) er
 
 // UpdateEmbedding updates an existing embedding for a session.
 func (vm *VectorManager) UpdateEmbedding(sessionID int64, embedding []float32) error {
+	// Storing replaces the earlier embedding in place
+	return vm.StoreEmbedding(sessionID, embedding)
+}
+
+// DeleteEmbedding removes an embedding for a session. Its vector is
+// overwritten on disk.
+func (vm *VectorManager) DeleteEmbedding(sessionID int64) error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
@@ -259,63 +291,66 @@ func (vm *VectorManager) UpdateEmbedding(sessionID int64, embedding []float32) e
 		return NewStorageError(ErrValidation, "session ID must be positive", nil)
 	}
 
-	if len(embedding) != EmbeddingDimensions {
-		return NewStorageError(ErrValidation,
-			fmt.Sprintf("embedding must have %d dimensions, got %d", EmbeddingDimensions, len(embedding)),
-			nil)
+	if err := vm.store.remove(vectorKey{kind: vectorKindSession, id: sessionID}); err != nil {
+		return NewStorageError(ErrVector, "failed to delete embedding", err)
 	}
 
-	docID := fmt.Sprintf("session_%d", sessionID)
-	ctx := context.Background()
+	return nil
+}
 
-	// Delete existing embedding first
-	err := vm.collection.Delete(ctx, nil, nil, docID)
-	if err != nil {
-		// Ignore not found errors - we'll just add the new one
+// StoreNoteEmbedding stores an embedding for a note. Search results for it
+// point at the note's session.
+func (vm *VectorManager) StoreNoteEmbedding(noteID, sessionID int64, embedding []float32) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if noteID <= 0 || sessionID <= 0 {
+		return NewStorageError(ErrValidation, "note and session IDs must be positive", nil)
 	}
 
-	// Create metadata with model version and timestamps
-	metadata := map[string]string{
-		"session_id":    fmt.Sprintf("%d", sessionID),
-		"model_version": vm.modelVersion,
-		"updated_at":    time.Now().UTC().Format(time.RFC3339),
+	if len(embedding) != EmbeddingDimensions {
+		return NewStorageError(ErrValidation,
+			fmt.Sprintf("embedding must have %d dimensions, got %d", EmbeddingDimensions, len(embedding)),
+			nil)
 	}
 
-	// Add new embedding
-	err = vm.collection.Add(ctx,
-		[]string{docID},
-		[][]float32{embedding},
-		[]map[string]string{metadata},
-		[]string{""},
-	)
-	if err != nil {
-		return NewStorageError(ErrVector, "failed to update embedding", err)
+	// Replaces any earlier embedding of the note
+	key := vectorKey{kind: vectorKindNote, id: noteID}
+	if err := vm.store.put(key, sessionID, vm.modelVersion, embedding); err != nil {
+		return NewStorageError(ErrVector, "failed to store note embedding", err)
 	}
 
 	return nil
 }
 
-// DeleteEmbedding removes an embedding for a session.
-func (vm *VectorManager) DeleteEmbedding(sessionID int64) error {
+// DeleteNoteEmbedding removes the embedding for a note.
+func (vm *VectorManager) DeleteNoteEmbedding(noteID int64) error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
-	if sessionID <= 0 {
-		return NewStorageError(ErrValidation, "session ID must be positive", nil)
+	if err := vm.store.remove(vectorKey{kind: vectorKindNote, id: noteID}); err != nil {
+		return NewStorageError(ErrVector, "failed to delete note embedding", err)
 	}
+	return nil
+}
 
-	docID := fmt.Sprintf("session_%d", sessionID)
-	ctx := context.Background()
+// DeleteSessionNoteEmbeddings removes the embeddings of all notes of a session.
+func (vm *VectorManager) DeleteSessionNoteEmbeddings(sessionID int64) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
 
-	err := vm.collection.Delete(ctx, nil, nil, docID)
+	err := vm.store.removeWhere(func(doc *vectorDoc) bool {
+		return doc.key.kind == vectorKindNote && doc.sessionID == sessionID
+	})
 	if err != nil {
-		return NewStorageError(ErrVector, "failed to delete embedding", err)
+		return NewStorageError(ErrVector, "failed to delete note embeddings", err)
 	}
-
 	return nil
 }
 
 // Search performs semantic search and returns the top-k most similar sessions.
+// Results are approximate once there are more embeddings than the index's
+// exact threshold; EfSearch trades latency for recall.
 func (vm *VectorManager) Search(queryEmbedding []float32, topK int) ([]VectorSearchResult, error) {
 	vm.mu.RLock()
 	defer vm.mu.RUnlock()
@@ -330,33 +365,32 @@ func (vm *VectorManager) Search(queryEmbedding []float32, topK int) ([]VectorSea
 		return nil, NewStorageError(ErrValidation, "topK must be positive", nil)
 	}
 
-	ctx := context.Background()
-	results, err := vm.collection.QueryEmbedding(ctx, queryEmbedding, topK, nil, nil)
-	if err != nil {
-		return nil, NewStorageError(ErrVector, "failed to search embeddings", err)
-	}
-
-	// Convert to VectorSearchResult
-	searchResults := make([]VectorSearchResult, 0, len(results))
-	for _, r := range results {
-		// Parse session ID from metadata
-		sessionIDStr, ok := r.Metadata["session_id"]
-		if !ok {
-			continue
-		}
-		var sessionID int64
-		fmt.Sscanf(sessionIDStr, "%d", &sessionID)
-
-		modelVersion := r.Metadata["model_version"]
+	return toVectorSearchResults(vm.store.search(queryEmbedding, topK, vm.indexConfig.EfSearch)), nil
+}
 
-		searchResults = append(searchResults, VectorSearchResult{
-			SessionID:    types.SessionID(sessionID),
-			Score:        r.Similarity,
-			ModelVersion: modelVersion,
+// toVectorSearchResults converts store matches to search results.
+func toVectorSearchResults(matches []vectorMatch) []VectorSearchResult {
+	results := make([]VectorSearchResult, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, VectorSearchResult{
+			SessionID:    types.SessionID(m.doc.sessionID),
+			Score:        m.score,
+			ModelVersion: m.doc.modelVersion,
 		})
 	}
+	return results
+}
 
-	return searchResults, nil
+// SetEfSearch changes how many candidates searches consider. Higher values
+// find more of the true nearest neighbours but take longer.
+func (vm *VectorManager) SetEfSearch(ef int) error {
+	if ef <= 0 {
+		return NewStorageError(ErrValidation, "ef must be positive", nil)
+	}
+	vm.mu.Lock()
+	vm.indexConfig.EfSearch = ef
+	vm.mu.Unlock()
+	return nil
 }
 
 // QueueEmbedding adds an embedding request to the async queue.
@@ -377,6 +411,24 @@ func (vm *VectorManager) QueueEmbedding(sessionID int64, text string) error {
 	}
 }
 
+// QueueNoteEmbedding adds a note embedding request to the async queue.
+func (vm *VectorManager) QueueNoteEmbedding(noteID, sessionID int64, text string) error {
+	if noteID <= 0 || sessionID <= 0 {
+		return NewStorageError(ErrValidation, "note and session IDs must be positive", nil)
+	}
+
+	if text == "" {
+		return NewStorageError(ErrValidation, "text cannot be empty", nil)
+	}
+
+	select {
+	case vm.embedQueue <- EmbedRequest{SessionID: sessionID, NoteID: noteID, Text: text}:
+		return nil
+	default:
+		return NewStorageError(ErrVector, "embedding queue is full", nil)
+	}
+}
+
 // ProcessQueue starts processing the async embedding queue.
 func (vm *VectorManager) ProcessQueue() error {
 	vm.wg.Add(1)
@@ -405,7 +457,11 @@ func (vm *VectorManager) processEmbedRequest(req EmbedRequest) {
 			continue
 		}
 
-		err = vm.StoreEmbedding(req.SessionID, embedding)
+		if req.NoteID != 0 {
+			err = vm.StoreNoteEmbedding(req.NoteID, req.SessionID, embedding)
+		} else {
+			err = vm.StoreEmbedding(req.SessionID, embedding)
+		}
 		if err != nil {
 			lastErr = err
 			continue
@@ -441,16 +497,24 @@ func (vm *VectorManager) GetEmbedding(sessionID int64) ([]float32, string, error
 		return nil, "", NewStorageError(ErrValidation, "session ID must be positive", nil)
 	}
 
-	docID := fmt.Sprintf("session_%d", sessionID)
-	ctx := context.Background()
-
-	doc, err := vm.collection.GetByID(ctx, docID)
-	if err != nil {
-		return nil, "", NewStorageError(ErrNotFound, "embedding not found", err)
+	doc := vm.store.docs[vectorKey{kind: vectorKindSession, id: sessionID}]
+	if doc == nil {
+		return nil, "", NewStorageError(ErrNotFound, "embedding not found", nil)
 	}
 
-	modelVersion := doc.Metadata["model_version"]
-	return doc.Embedding, modelVersion, nil
+	return append([]float32(nil), doc.vec...), doc.modelVersion, nil
+}
+
+// GetNoteEmbedding retrieves the embedding for a note.
+func (vm *VectorManager) GetNoteEmbedding(noteID int64) ([]float32, string, error) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	doc := vm.store.docs[vectorKey{kind: vectorKindNote, id: noteID}]
+	if doc == nil {
+		return nil, "", NewStorageError(ErrNotFound, "embedding not found", nil)
+	}
+	return append([]float32(nil), doc.vec...), doc.modelVersion, nil
 }
 
 // HasEmbedding checks if an embedding exists for a session.
@@ -463,21 +527,15 @@ func (vm *VectorManager) HasEmbedding(sessionID int64) bool {
 func (vm *VectorManager) Count() int {
 	vm.mu.RLock()
 	defer vm.mu.RUnlock()
-	return vm.collection.Count()
+	return vm.store.count()
 }
 
-// Flush ensures all pending embeddings are persisted to disk.
+// Flush unlinks deleted embeddings from the index, saves the index and
+// syncs the vectors to disk.
 func (vm *VectorManager) Flush() error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
-	
-	// chromem-go automatically persists data, but we can force a sync
-	// by accessing the collection (which triggers persistence)
-	if vm.collection != nil {
-		// Get collection count to trigger persistence
-		_ = vm.collection.Count()
-	}
-	return nil
+	return vm.store.flush()
 }
 
 // Close shuts down the VectorManager and releases resources.
@@ -486,10 +544,9 @@ func (vm *VectorManager) Close() error {
 	close(vm.stopChan)
 	vm.wg.Wait()
 
-	// Close the database (chromem-go handles persistence)
-	// Note: chromem-go doesn't have an explicit Close method,
-	// but persistence is handled automatically
-	return nil
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.store.close()
 }
 
 // IsOllamaAvailable checks if Ollama is available and the model is loaded.
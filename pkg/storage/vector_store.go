@@ -0,0 +1,556 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// vectorIndexDir holds the vector segments and graph, relative to the
+	// vectors directory.
+	vectorIndexDir = "index"
+	// hnswGraphFile is the saved HNSW graph in the index directory.
+	hnswGraphFile = "graph.hnsw"
+
+	// Segment files start with a header, followed by fixed-size slots of a
+	// slot header and the vector, so vectors are written, replaced and
+	// erased in place.
+	vectorSegmentHeaderSize = 32
+	vectorSlotHeaderSize    = 128
+	vectorSlotModelSize     = 64
+)
+
+// vectorSegmentMagic starts a vector segment file.
+var vectorSegmentMagic = [8]byte{'W', 'V', 'S', 'E', 'G', '0', '0', '1'}
+
+// vectorDoc is an embedding in the vector store and where it lives.
+type vectorDoc struct {
+	key          vectorKey
+	sessionID    int64
+	modelVersion string
+	updatedAt    int64 // Unix nanoseconds, increasing with every write
+	vec          []float32
+	segment      *vectorSegment
+	slot         int
+	node         uint32
+}
+
+// vectorSegment is an open segment file and the slots in use.
+type vectorSegment struct {
+	num      int
+	path     string
+	file     *os.File
+	capacity int
+	used     []bool // Up to the highest slot written
+	live     int
+}
+
+// vectorSegments stores vectors in segment files of fixed-size slots.
+type vectorSegments struct {
+	dir      string
+	dim      int
+	capacity int
+	segments []*vectorSegment
+}
+
+// slotSize returns the size of a slot in bytes.
+func (s *vectorSegments) slotSize() int {
+	return vectorSlotHeaderSize + 4*s.dim
+}
+
+// openVectorSegments opens the segment files in dir and returns the
+// vectors in them. Slots failing their checksum, such as one torn by a
+// crash while being written, are treated as empty.
+func openVectorSegments(dir string, dim, capacity int) (*vectorSegments, []*vectorDoc, error) {
+	s := &vectorSegments{dir: dir, dim: dim, capacity: capacity}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "segment-*.vec"))
+	if err != nil {
+		return nil, nil, NewStorageError(ErrFileSystem, "failed to list vector segments", err)
+	}
+	sort.Strings(paths)
+
+	le := binary.LittleEndian
+	var docs []*vectorDoc
+	for _, path := range paths {
+		var num int
+		if _, err := fmt.Sscanf(filepath.Base(path), "segment-%06d.vec", &num); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			s.close()
+			return nil, nil, NewStorageError(ErrFileSystem, "failed to read vector segment", err)
+		}
+		if len(data) < vectorSegmentHeaderSize || [8]byte(data[:8]) != vectorSegmentMagic {
+			s.close()
+			return nil, nil, NewStorageError(ErrVector, fmt.Sprintf("vector segment %s is corrupt", filepath.Base(path)), nil)
+		}
+		if got := int(le.Uint32(data[8:])); got != dim {
+			s.close()
+			return nil, nil, NewStorageError(ErrVector, fmt.Sprintf("vector segment %s has %d dimensions, expected %d", filepath.Base(path), got, dim), nil)
+		}
+		file, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			s.close()
+			return nil, nil, NewStorageError(ErrFileSystem, "failed to open vector segment", err)
+		}
+
+		segment := &vectorSegment{num: num, path: path, file: file, capacity: int(le.Uint32(data[12:]))}
+		size := s.slotSize()
+		for off := vectorSegmentHeaderSize; off+size <= len(data) && len(segment.used) < segment.capacity; off += size {
+			doc := s.decode(data[off : off+size])
+			segment.used = append(segment.used, doc != nil)
+			if doc != nil {
+				doc.segment, doc.slot = segment, len(segment.used)-1
+				segment.live++
+				docs = append(docs, doc)
+			}
+		}
+		s.segments = append(s.segments, segment)
+	}
+
+	// A document is only ever in one slot, but keep the newest if not
+	latest := make(map[vectorKey]*vectorDoc, len(docs))
+	kept := docs[:0]
+	for _, doc := range docs {
+		if prev := latest[doc.key]; prev != nil {
+			stale := doc
+			if doc.updatedAt > prev.updatedAt {
+				stale = prev
+				latest[doc.key] = doc
+			}
+			if err := s.erase(stale); err != nil {
+				s.close()
+				return nil, nil, err
+			}
+			continue
+		}
+		latest[doc.key] = doc
+	}
+	for _, doc := range docs {
+		if latest[doc.key] == doc {
+			kept = append(kept, doc)
+		}
+	}
+
+	return s, kept, nil
+}
+
+// decode returns the document in a slot, or nil if it's empty or invalid.
+func (s *vectorSegments) decode(slot []byte) *vectorDoc {
+	le := binary.LittleEndian
+	if slot[0] != 1 {
+		return nil
+	}
+	crc := crc32.ChecksumIEEE(slot[:vectorSlotHeaderSize-4])
+	crc = crc32.Update(crc, crc32.IEEETable, slot[vectorSlotHeaderSize:])
+	if crc != le.Uint32(slot[vectorSlotHeaderSize-4:]) {
+		return nil
+	}
+
+	modelLen := min(int(slot[26]), vectorSlotModelSize)
+	doc := &vectorDoc{
+		key:          vectorKey{kind: slot[1], id: int64(le.Uint64(slot[2:]))},
+		sessionID:    int64(le.Uint64(slot[10:])),
+		updatedAt:    int64(le.Uint64(slot[18:])),
+		modelVersion: string(slot[27 : 27+modelLen]),
+		vec:          make([]float32, s.dim),
+	}
+	for i := range doc.vec {
+		doc.vec[i] = math.Float32frombits(le.Uint32(slot[vectorSlotHeaderSize+4*i:]))
+	}
+	return doc
+}
+
+// encode returns the slot for a document.
+func (s *vectorSegments) encode(doc *vectorDoc) []byte {
+	le := binary.LittleEndian
+	slot := make([]byte, s.slotSize())
+	slot[0] = 1
+	slot[1] = doc.key.kind
+	le.PutUint64(slot[2:], uint64(doc.key.id))
+	le.PutUint64(slot[10:], uint64(doc.sessionID))
+	le.PutUint64(slot[18:], uint64(doc.updatedAt))
+	slot[26] = byte(copy(slot[27:27+vectorSlotModelSize], doc.modelVersion))
+	for i, v := range doc.vec {
+		le.PutUint32(slot[vectorSlotHeaderSize+4*i:], math.Float32bits(v))
+	}
+	crc := crc32.ChecksumIEEE(slot[:vectorSlotHeaderSize-4])
+	crc = crc32.Update(crc, crc32.IEEETable, slot[vectorSlotHeaderSize:])
+	le.PutUint32(slot[vectorSlotHeaderSize-4:], crc)
+	return slot
+}
+
+// write stores a document in its slot, or in a free one if it has none.
+func (s *vectorSegments) write(doc *vectorDoc) error {
+	if len(doc.modelVersion) > vectorSlotModelSize {
+		return NewStorageError(ErrValidation, fmt.Sprintf("model version must be at most %d bytes", vectorSlotModelSize), nil)
+	}
+
+	if doc.segment == nil {
+		if err := s.allocate(doc); err != nil {
+			return err
+		}
+	}
+	off := int64(vectorSegmentHeaderSize + doc.slot*s.slotSize())
+	if _, err := doc.segment.file.WriteAt(s.encode(doc), off); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to write vector", err)
+	}
+	return nil
+}
+
+// allocate assigns a document the first free slot, starting a segment
+// when all are full.
+func (s *vectorSegments) allocate(doc *vectorDoc) error {
+	var segment *vectorSegment
+	slot := -1
+	for _, seg := range s.segments {
+		if seg.live == seg.capacity {
+			continue
+		}
+		segment = seg
+		for i, used := range seg.used {
+			if !used {
+				slot = i
+				break
+			}
+		}
+		if slot < 0 {
+			slot = len(seg.used)
+			seg.used = append(seg.used, false)
+		}
+		break
+	}
+
+	if segment == nil {
+		num := 1
+		if n := len(s.segments); n > 0 {
+			num = s.segments[n-1].num + 1
+		}
+		path := filepath.Join(s.dir, fmt.Sprintf("segment-%06d.vec", num))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return NewStorageError(ErrFileSystem, "failed to create vector segment", err)
+		}
+		header := make([]byte, vectorSegmentHeaderSize)
+		copy(header, vectorSegmentMagic[:])
+		binary.LittleEndian.PutUint32(header[8:], uint32(s.dim))
+		binary.LittleEndian.PutUint32(header[12:], uint32(s.capacity))
+		if _, err := file.Write(header); err != nil {
+			file.Close()
+			os.Remove(path)
+			return NewStorageError(ErrFileSystem, "failed to write vector segment header", err)
+		}
+		segment = &vectorSegment{num: num, path: path, file: file, capacity: s.capacity}
+		s.segments = append(s.segments, segment)
+		slot = 0
+		segment.used = append(segment.used, false)
+	}
+
+	segment.used[slot] = true
+	segment.live++
+	doc.segment, doc.slot = segment, slot
+	return nil
+}
+
+// erase overwrites a document's slot with zeros, so its vector is gone
+// from disk, and frees it. Empty trailing slots are truncated and empty
+// segments removed.
+func (s *vectorSegments) erase(doc *vectorDoc) error {
+	segment := doc.segment
+	off := int64(vectorSegmentHeaderSize + doc.slot*s.slotSize())
+	if _, err := segment.file.WriteAt(make([]byte, s.slotSize()), off); err != nil {
+		return NewStorageError(ErrFileSystem, "failed to erase vector", err)
+	}
+	segment.used[doc.slot] = false
+	segment.live--
+	doc.segment = nil
+
+	if segment.live == 0 {
+		segment.file.Close()
+		if err := os.Remove(segment.path); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to remove empty vector segment", err)
+		}
+		for i, seg := range s.segments {
+			if seg == segment {
+				s.segments = append(s.segments[:i], s.segments[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+
+	n := len(segment.used)
+	for n > 0 && !segment.used[n-1] {
+		n--
+	}
+	if n < len(segment.used) {
+		segment.used = segment.used[:n]
+		if err := segment.file.Truncate(int64(vectorSegmentHeaderSize + n*s.slotSize())); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to truncate vector segment", err)
+		}
+	}
+	return nil
+}
+
+// sync flushes the segment files to disk.
+func (s *vectorSegments) sync() error {
+	for _, segment := range s.segments {
+		if err := segment.file.Sync(); err != nil {
+			return NewStorageError(ErrFileSystem, "failed to sync vector segment", err)
+		}
+	}
+	return nil
+}
+
+// close closes the segment files.
+func (s *vectorSegments) close() {
+	for _, segment := range s.segments {
+		segment.file.Close()
+	}
+}
+
+// vectorMatch is a document and its similarity to a query.
+type vectorMatch struct {
+	doc   *vectorDoc
+	score float32
+}
+
+// vectorStore keeps unit-length embeddings in segment files and indexes
+// them with an HNSW graph, saved alongside on flush. A graph missing or
+// behind the segments, such as after a crash, is brought up to date when
+// the store is opened.
+type vectorStore struct {
+	dir      string
+	config   *VectorIndexConfig
+	segments *vectorSegments
+	index    *hnswIndex
+	docs     map[vectorKey]*vectorDoc
+	dirty    bool // The graph changed since it was saved
+}
+
+// openVectorStore opens the store in dir, creating it if needed.
+func openVectorStore(dir string, dim int, config *VectorIndexConfig) (*vectorStore, error) {
+	config = config.withDefaults()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, NewStorageError(ErrFileSystem, "failed to create vector index directory", err)
+	}
+	segments, docs, err := openVectorSegments(dir, dim, config.SegmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &vectorStore{
+		dir:      dir,
+		config:   config,
+		segments: segments,
+		docs:     make(map[vectorKey]*vectorDoc, len(docs)),
+	}
+	for _, doc := range docs {
+		s.docs[doc.key] = doc
+	}
+
+	indexed := make(map[vectorKey]uint32, len(docs))
+	if data, err := os.ReadFile(filepath.Join(dir, hnswGraphFile)); err == nil {
+		index, err := readHNSWIndex(data, config, func(key vectorKey, stamp int64, id uint32) ([]float32, bool) {
+			doc := s.docs[key]
+			if _, dup := indexed[key]; dup || doc == nil || doc.updatedAt != stamp {
+				s.dirty = true
+				return nil, false
+			}
+			indexed[key] = id
+			return doc.vec, true
+		})
+		if err == nil {
+			s.index = index
+		}
+	}
+	if s.index == nil {
+		s.index = newHNSWIndex(config)
+		clear(indexed)
+		s.dirty = true
+	}
+
+	for _, doc := range docs {
+		if id, ok := indexed[doc.key]; ok {
+			doc.node = id
+			continue
+		}
+		doc.node = s.index.insert(doc.key, doc.updatedAt, doc.vec)
+		s.dirty = true
+	}
+	return s, nil
+}
+
+// normalizeVector returns a unit-length copy of v, or a copy of it if
+// it's zero.
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	scale := float32(1)
+	if sum > 0 {
+		scale = float32(1 / math.Sqrt(sum))
+	}
+	for i, x := range v {
+		out[i] = x * scale
+	}
+	return out
+}
+
+// put stores an embedding, replacing any earlier one for the key.
+func (s *vectorStore) put(key vectorKey, sessionID int64, modelVersion string, embedding []float32) error {
+	if len(embedding) != s.segments.dim {
+		return NewStorageError(ErrValidation, fmt.Sprintf("embedding must have %d dimensions, got %d", s.segments.dim, len(embedding)), nil)
+	}
+
+	prev := s.docs[key]
+	doc := &vectorDoc{
+		key:          key,
+		sessionID:    sessionID,
+		modelVersion: modelVersion,
+		updatedAt:    time.Now().UnixNano(),
+		vec:          normalizeVector(embedding),
+	}
+	if prev != nil {
+		doc.segment, doc.slot = prev.segment, prev.slot
+		doc.updatedAt = max(doc.updatedAt, prev.updatedAt+1)
+	}
+	if err := s.segments.write(doc); err != nil {
+		return err
+	}
+
+	if prev != nil {
+		s.index.remove(prev.node)
+	}
+	doc.node = s.index.insert(key, doc.updatedAt, doc.vec)
+	s.docs[key] = doc
+	s.dirty = true
+	return nil
+}
+
+// remove erases the embedding for a key, if there is one.
+func (s *vectorStore) remove(key vectorKey) error {
+	doc := s.docs[key]
+	if doc == nil {
+		return nil
+	}
+	if err := s.segments.erase(doc); err != nil {
+		return err
+	}
+	s.index.remove(doc.node)
+	delete(s.docs, key)
+	s.dirty = true
+	return nil
+}
+
+// removeWhere erases the embeddings of the documents matching.
+func (s *vectorStore) removeWhere(match func(doc *vectorDoc) bool) error {
+	for key, doc := range s.docs {
+		if match(doc) {
+			if err := s.remove(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// search returns up to k documents most similar to the query, walking the
+// graph with ef candidates, or comparing with every document while there
+// are no more than the exact threshold.
+func (s *vectorStore) search(query []float32, k, ef int) []vectorMatch {
+	query = normalizeVector(query)
+	var matches []hnswMatch
+	if s.index.live() <= s.config.ExactThreshold {
+		matches = s.index.searchExact(query, k)
+	} else {
+		matches = s.index.search(query, k, ef)
+	}
+	return s.resolve(matches)
+}
+
+// searchExact returns the k documents most similar to the query.
+func (s *vectorStore) searchExact(query []float32, k int) []vectorMatch {
+	return s.resolve(s.index.searchExact(normalizeVector(query), k))
+}
+
+// resolve returns the documents of graph matches.
+func (s *vectorStore) resolve(matches []hnswMatch) []vectorMatch {
+	results := make([]vectorMatch, 0, len(matches))
+	for _, m := range matches {
+		if doc := s.docs[s.index.nodes[m.id].key]; doc != nil {
+			results = append(results, vectorMatch{doc: doc, score: m.score})
+		}
+	}
+	return results
+}
+
+// count returns the number of documents.
+func (s *vectorStore) count() int {
+	return len(s.docs)
+}
+
+// flush unlinks deleted nodes from the graph, saves it if it changed and
+// syncs the segments to disk.
+func (s *vectorStore) flush() error {
+	s.index.repair()
+	if s.dirty {
+		path := filepath.Join(s.dir, hnswGraphFile)
+		tmp := path + ".tmp"
+		file, err := os.Create(tmp)
+		if err != nil {
+			return NewStorageError(ErrFileSystem, "failed to create vector graph", err)
+		}
+		err = s.index.writeTo(file)
+		if err == nil {
+			err = file.Sync()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return NewStorageError(ErrFileSystem, "failed to save vector graph", err)
+		}
+		s.dirty = false
+	}
+	return s.segments.sync()
+}
+
+// close flushes the store and closes its files.
+func (s *vectorStore) close() error {
+	err := s.flush()
+	s.segments.close()
+	return err
+}
+
+// parseVectorDocID parses a document ID such as "session_12" or "note_3"
+// into its key.
+func parseVectorDocID(docID string) (vectorKey, bool) {
+	kind, id, _ := strings.Cut(docID, "_")
+	var key vectorKey
+	switch kind {
+	case "session":
+		key.kind = vectorKindSession
+	case "note":
+		key.kind = vectorKindNote
+	default:
+		return key, false
+	}
+	_, err := fmt.Sscanf(id, "%d", &key.id)
+	return key, err == nil
+}
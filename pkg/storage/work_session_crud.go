@@ -0,0 +1,461 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"waddle/pkg/types"
+)
+
+// Work session boundary kinds.
+const (
+	BoundaryIdle   = "idle"   // Started after an idle gap
+	BoundaryManual = "manual" // Started at a boundary set by the user
+)
+
+// DefaultSessionIdleGap is the idle time after which activity starts a new
+// work session.
+const DefaultSessionIdleGap = 30 * time.Minute
+
+// workSessionColumns is the column list shared by work session queries, in scanWorkSession order.
+const workSessionColumns = `id, session_id, start_time, end_time, boundary, title, synthesis_status, created_at, updated_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWorkSession reads a work session selected with workSessionColumns.
+func scanWorkSession(row rowScanner) (*WorkSession, error) {
+	var ws WorkSession
+	var title sql.NullString
+	err := row.Scan(
+		&ws.ID,
+		&ws.SessionID,
+		&ws.StartTime,
+		&ws.EndTime,
+		&ws.Boundary,
+		&title,
+		&ws.SynthesisStatus,
+		&ws.CreatedAt,
+		&ws.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ws.Title = title.String
+	return &ws, nil
+}
+
+// GetWorkSessions returns a session's work sessions in start time order.
+func (sm *SessionManager) GetWorkSessions(sessionID int64) ([]WorkSession, error) {
+	return getWorkSessions(sm.db, sessionID)
+}
+
+// GetWorkSession retrieves a work session by ID.
+func (sm *SessionManager) GetWorkSession(id int64) (*WorkSession, error) {
+	return getWorkSession(sm.db, id)
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func getWorkSessions(q queryer, sessionID int64) ([]WorkSession, error) {
+	rows, err := q.Query(`SELECT `+workSessionColumns+` FROM work_sessions WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get work sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []WorkSession{}
+	for rows.Next() {
+		ws, err := scanWorkSession(rows)
+		if err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan work session", err)
+		}
+		sessions = append(sessions, *ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating work sessions", err)
+	}
+
+	// Timestamps are stored as text, so order them as instants
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartTime.Before(sessions[j].StartTime) })
+	return sessions, nil
+}
+
+func getWorkSession(q queryer, id int64) (*WorkSession, error) {
+	ws, err := scanWorkSession(q.QueryRow(`SELECT `+workSessionColumns+` FROM work_sessions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, NewStorageError(ErrNotFound, "work session not found", nil)
+	}
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get work session", err)
+	}
+	return ws, nil
+}
+
+// UpdateWorkSession updates a work session's title and synthesis status.
+func (sm *SessionManager) UpdateWorkSession(ws *WorkSession) error {
+	if ws.ID == 0 {
+		return NewStorageError(ErrValidation, "work session ID is required for update", nil)
+	}
+	if ws.SynthesisStatus == "" {
+		ws.SynthesisStatus = "pending"
+	}
+	ws.UpdatedAt = time.Now()
+
+	result, err := sm.db.Exec(`
+		UPDATE work_sessions SET title = ?, synthesis_status = ?, updated_at = ? WHERE id = ?
+	`, ws.Title, ws.SynthesisStatus, ws.UpdatedAt, int64(ws.ID))
+	if err != nil {
+		return NewStorageError(ErrDatabase, "failed to update work session", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NewStorageError(ErrNotFound, "work session not found", nil)
+	}
+	return nil
+}
+
+// SegmentWorkSessions assigns the session's activity blocks to work sessions
+// and returns them in start time order. Blocks already covered by a work
+// session stay where they are; other blocks extend a neighbouring work
+// session that ended or starts within idleGap, or else start a new one.
+// Existing boundaries are never moved past each other, so manual splits and
+// merges survive re-segmentation. Work sessions left without any block are
+// removed, and changed ones are marked for synthesis.
+func (sm *SessionManager) SegmentWorkSessions(sessionID int64, idleGap time.Duration) ([]WorkSession, error) {
+	if idleGap <= 0 {
+		idleGap = DefaultSessionIdleGap
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin segmentation", err)
+	}
+	defer tx.Rollback()
+
+	spans, err := getBlockSpans(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := getWorkSessions(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*WorkSession, len(existing))
+	for i := range existing {
+		segments[i] = &existing[i]
+	}
+	changed := make(map[*WorkSession]bool)
+	used := make(map[*WorkSession]bool)
+
+	for _, span := range spans {
+		ws, isChanged := assignSpan(&segments, span, idleGap, sessionID)
+		used[ws] = true
+		if isChanged {
+			changed[ws] = true
+		}
+	}
+
+	now := time.Now()
+	result := make([]WorkSession, 0, len(segments))
+	for _, ws := range segments {
+		switch {
+		case !used[ws]:
+			if ws.ID != 0 {
+				if _, err := tx.Exec("DELETE FROM work_sessions WHERE id = ?", int64(ws.ID)); err != nil {
+					return nil, NewStorageError(ErrDatabase, "failed to remove empty work session", err)
+				}
+			}
+			continue
+		case ws.ID == 0:
+			ws.CreatedAt, ws.UpdatedAt = now, now
+			res, err := tx.Exec(`
+				INSERT INTO work_sessions (session_id, start_time, end_time, boundary, title, synthesis_status, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, sessionID, ws.StartTime, ws.EndTime, ws.Boundary, ws.Title, ws.SynthesisStatus, now, now)
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to insert work session", err)
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to get last insert id", err)
+			}
+			ws.ID = types.ElementID(id)
+		case changed[ws]:
+			ws.SynthesisStatus = "pending"
+			ws.UpdatedAt = now
+			_, err := tx.Exec(`
+				UPDATE work_sessions SET start_time = ?, end_time = ?, synthesis_status = ?, updated_at = ? WHERE id = ?
+			`, ws.StartTime, ws.EndTime, ws.SynthesisStatus, now, int64(ws.ID))
+			if err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to update work session", err)
+			}
+		}
+		result = append(result, *ws)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit segmentation", err)
+	}
+
+	return result, nil
+}
+
+// timeSpan is the start and end of an activity block.
+type timeSpan struct {
+	start, end time.Time
+}
+
+// getBlockSpans returns the time spans of a session's activity blocks in start order.
+func getBlockSpans(q queryer, sessionID int64) ([]timeSpan, error) {
+	rows, err := q.Query(`
+		SELECT ab.start_time, ab.end_time
+		FROM activity_blocks ab
+		JOIN app_activities aa ON ab.app_activity_id = aa.id
+		WHERE aa.session_id = ?
+	`, sessionID)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get blocks", err)
+	}
+	defer rows.Close()
+
+	var spans []timeSpan
+	for rows.Next() {
+		var s timeSpan
+		if err := rows.Scan(&s.start, &s.end); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to scan block", err)
+		}
+		if s.end.Before(s.start) {
+			s.end = s.start
+		}
+		spans = append(spans, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "error iterating blocks", err)
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+	return spans, nil
+}
+
+// assignSpan places a block span into the sorted segments, growing or
+// inserting a segment as needed. It returns the segment that now holds the
+// span and whether that segment's range changed.
+func assignSpan(segments *[]*WorkSession, span timeSpan, idleGap time.Duration, sessionID int64) (*WorkSession, bool) {
+	segs := *segments
+
+	// Blocks overlapping a segment belong to it; grow it up to its neighbours
+	for i, ws := range segs {
+		if span.start.After(ws.EndTime) || span.end.Before(ws.StartTime) {
+			continue
+		}
+		grew := false
+		end := span.end
+		if i+1 < len(segs) && end.After(segs[i+1].StartTime) {
+			end = segs[i+1].StartTime
+		}
+		if end.After(ws.EndTime) {
+			ws.EndTime = end
+			grew = true
+		}
+		start := span.start
+		if i > 0 && start.Before(segs[i-1].EndTime) {
+			start = segs[i-1].EndTime
+		}
+		if start.Before(ws.StartTime) {
+			ws.StartTime = start
+			grew = true
+		}
+		return ws, grew
+	}
+
+	// Otherwise the span sits in a gap between segments (or outside them all)
+	pos := sort.Search(len(segs), func(i int) bool { return segs[i].StartTime.After(span.end) })
+	if pos > 0 && span.start.Sub(segs[pos-1].EndTime) <= idleGap {
+		segs[pos-1].EndTime = span.end
+		return segs[pos-1], true
+	}
+	if pos < len(segs) && segs[pos].StartTime.Sub(span.end) <= idleGap {
+		segs[pos].StartTime = span.start
+		return segs[pos], true
+	}
+
+	ws := &WorkSession{
+		SessionID:       types.SessionID(sessionID),
+		StartTime:       span.start,
+		EndTime:         span.end,
+		Boundary:        BoundaryIdle,
+		SynthesisStatus: "pending",
+	}
+	segs = append(segs, nil)
+	copy(segs[pos+1:], segs[pos:])
+	segs[pos] = ws
+	*segments = segs
+	return ws, true
+}
+
+// SplitWorkSession splits a work session at the given time. The original
+// keeps everything before at; the returned new work session starts at at
+// with a manual boundary. Knowledge cards of the original no longer match
+// its range and are removed so synthesis regenerates them.
+func (sm *SessionManager) SplitWorkSession(id int64, at time.Time) (*WorkSession, error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin split", err)
+	}
+	defer tx.Rollback()
+
+	ws, err := getWorkSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !at.After(ws.StartTime) || !at.Before(ws.EndTime) {
+		return nil, NewStorageError(ErrValidation, "split time must fall within the work session", nil)
+	}
+
+	now := time.Now()
+	second := &WorkSession{
+		SessionID:       ws.SessionID,
+		StartTime:       at,
+		EndTime:         ws.EndTime,
+		Boundary:        BoundaryManual,
+		SynthesisStatus: "pending",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE work_sessions SET end_time = ?, synthesis_status = 'pending', updated_at = ? WHERE id = ?
+	`, at, now, id); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to update work session", err)
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO work_sessions (session_id, start_time, end_time, boundary, title, synthesis_status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, int64(second.SessionID), second.StartTime, second.EndTime, second.Boundary, "", second.SynthesisStatus, now, now)
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to insert work session", err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to get last insert id", err)
+	}
+	second.ID = types.ElementID(newID)
+
+	if err := resynthesize(tx, int64(ws.SessionID), []int64{id}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit split", err)
+	}
+
+	return second, nil
+}
+
+// MergeWorkSessions merges adjacent work sessions of the same day into the
+// earliest of them, which is returned. Chats move to the merged work
+// session; knowledge cards are removed so synthesis regenerates them.
+func (sm *SessionManager) MergeWorkSessions(ids []int64) (*WorkSession, error) {
+	if len(ids) < 2 {
+		return nil, NewStorageError(ErrValidation, "at least two work sessions are required to merge", nil)
+	}
+
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin merge", err)
+	}
+	defer tx.Rollback()
+
+	first, err := getWorkSession(tx, ids[0])
+	if err != nil {
+		return nil, err
+	}
+	siblings, err := getWorkSessions(tx, int64(first.SessionID))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	// The selection must be a contiguous run of the day's work sessions
+	lo, hi := -1, -1
+	for i, ws := range siblings {
+		if wanted[int64(ws.ID)] {
+			if lo == -1 {
+				lo = i
+			}
+			hi = i
+		}
+	}
+	if lo == -1 || hi-lo+1 != len(wanted) {
+		return nil, NewStorageError(ErrValidation, "work sessions must be adjacent and from the same day", nil)
+	}
+
+	merged := siblings[lo]
+	for _, ws := range siblings[lo+1 : hi+1] {
+		if ws.EndTime.After(merged.EndTime) {
+			merged.EndTime = ws.EndTime
+		}
+	}
+
+	others := make([]interface{}, 0, hi-lo)
+	placeholders := make([]string, 0, hi-lo)
+	for _, ws := range siblings[lo+1 : hi+1] {
+		others = append(others, int64(ws.ID))
+		placeholders = append(placeholders, "?")
+	}
+	in := "(" + strings.Join(placeholders, ",") + ")"
+
+	now := time.Now()
+	merged.SynthesisStatus = "pending"
+	merged.UpdatedAt = now
+
+	if err := resynthesize(tx, int64(merged.SessionID), ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE chats SET work_session_id = ? WHERE work_session_id IN `+in,
+		append([]interface{}{int64(merged.ID)}, others...)...); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to move chats", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM work_sessions WHERE id IN `+in, others...); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to remove merged work sessions", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE work_sessions SET end_time = ?, synthesis_status = ?, updated_at = ? WHERE id = ?
+	`, merged.EndTime, merged.SynthesisStatus, now, int64(merged.ID)); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to update work session", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit merge", err)
+	}
+
+	return &merged, nil
+}
+
+// resynthesize drops the knowledge cards of changed work sessions and marks
+// their day for synthesis.
+func resynthesize(tx *sql.Tx, sessionID int64, workSessionIDs []int64) error {
+	for _, id := range workSessionIDs {
+		if _, err := tx.Exec("DELETE FROM knowledge_cards WHERE work_session_id = ?", id); err != nil {
+			return NewStorageError(ErrDatabase, "failed to remove stale knowledge cards", err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE sessions SET synthesis_status = 'pending' WHERE id = ?", sessionID); err != nil {
+		return NewStorageError(ErrDatabase, "failed to mark session for synthesis", err)
+	}
+	return nil
+}
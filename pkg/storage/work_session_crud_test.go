@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkSessions tests idle-gap segmentation and split/merge of work sessions.
+func TestWorkSessions(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := &Session{Date: "2025-04-07"}
+	if err := sm.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sessionID := int64(session.ID)
+
+	base := time.Date(2025, 4, 7, 9, 0, 0, 0, time.UTC)
+	addBlock := func(app string, start, end time.Duration) {
+		t.Helper()
+		block := &ActivityBlock{
+			BlockID:      base.Add(start).Format("15-04"),
+			StartTime:    base.Add(start),
+			EndTime:      base.Add(end),
+			MicroSummary: app,
+		}
+		if err := sm.AddBlock(sessionID, app, block); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	// Morning: 09:00-10:00 with a short break, then a long gap until 13:00
+	addBlock("Code", 0, 25*time.Minute)
+	addBlock("Browser", 35*time.Minute, time.Hour)
+	addBlock("Code", 4*time.Hour, 5*time.Hour)
+
+	var workSessions []WorkSession
+	t.Run("Idle gaps split the day", func(t *testing.T) {
+		var err error
+		workSessions, err = sm.SegmentWorkSessions(sessionID, 30*time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to segment: %v", err)
+		}
+		if len(workSessions) != 2 {
+			t.Fatalf("Expected 2 work sessions, got %+v", workSessions)
+		}
+		if !workSessions[0].StartTime.Equal(base) || !workSessions[0].EndTime.Equal(base.Add(time.Hour)) {
+			t.Errorf("Unexpected first work session: %v-%v", workSessions[0].StartTime, workSessions[0].EndTime)
+		}
+		if workSessions[1].Boundary != BoundaryIdle || workSessions[1].SynthesisStatus != "pending" {
+			t.Errorf("Unexpected second work session: %+v", workSessions[1])
+		}
+
+		// Re-segmenting is stable
+		again, err := sm.SegmentWorkSessions(sessionID, 30*time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to re-segment: %v", err)
+		}
+		if len(again) != 2 || again[0].ID != workSessions[0].ID || again[1].ID != workSessions[1].ID {
+			t.Errorf("Expected the same work sessions, got %+v", again)
+		}
+	})
+
+	t.Run("New activity extends the last work session", func(t *testing.T) {
+		addBlock("Terminal", 5*time.Hour+10*time.Minute, 5*time.Hour+20*time.Minute)
+		got, err := sm.SegmentWorkSessions(sessionID, 30*time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to segment: %v", err)
+		}
+		if len(got) != 2 || !got[1].EndTime.Equal(base.Add(5*time.Hour+20*time.Minute)) {
+			t.Errorf("Expected the afternoon session to grow, got %+v", got)
+		}
+	})
+
+	t.Run("Split and merge", func(t *testing.T) {
+		chat := &ChatMessage{Role: ChatRoleUser, Content: "what did I do?", WorkSessionID: workSessions[0].ID}
+		if err := sm.AddChat(sessionID, chat); err != nil {
+			t.Fatalf("Failed to add chat: %v", err)
+		}
+
+		if _, err := sm.SplitWorkSession(int64(workSessions[0].ID), base.Add(2*time.Hour)); !IsValidation(err) {
+			t.Errorf("Expected validation error for split outside range, got %v", err)
+		}
+
+		second, err := sm.SplitWorkSession(int64(workSessions[0].ID), base.Add(30*time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to split: %v", err)
+		}
+		if second.Boundary != BoundaryManual || !second.EndTime.Equal(base.Add(time.Hour)) {
+			t.Errorf("Unexpected split result: %+v", second)
+		}
+
+		// The manual boundary survives re-segmentation
+		got, err := sm.SegmentWorkSessions(sessionID, 30*time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to segment: %v", err)
+		}
+		if len(got) != 3 || got[1].ID != second.ID {
+			t.Fatalf("Expected 3 work sessions after split, got %+v", got)
+		}
+
+		if _, err := sm.MergeWorkSessions([]int64{int64(got[0].ID), int64(got[2].ID)}); !IsValidation(err) {
+			t.Errorf("Expected validation error for non-adjacent merge, got %v", err)
+		}
+
+		merged, err := sm.MergeWorkSessions([]int64{int64(got[1].ID), int64(got[0].ID)})
+		if err != nil {
+			t.Fatalf("Failed to merge: %v", err)
+		}
+		if merged.ID != got[0].ID || !merged.EndTime.Equal(base.Add(time.Hour)) {
+			t.Errorf("Unexpected merge result: %+v", merged)
+		}
+		if _, err := sm.GetWorkSession(int64(second.ID)); !IsNotFound(err) {
+			t.Errorf("Expected merged-away work session to be gone, got %v", err)
+		}
+
+		chats, err := sm.GetWorkSessionChats(int64(merged.ID))
+		if err != nil || len(chats) != 1 {
+			t.Errorf("Expected the chat to stay with the merged work session, got %v (%v)", chats, err)
+		}
+	})
+
+	t.Run("Date-keyed session is unchanged", func(t *testing.T) {
+		got, err := sm.Get("2025-04-07")
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if got.ID != session.ID || got.SynthesisStatus != "pending" {
+			t.Errorf("Unexpected day session: %+v", got)
+		}
+		chats, err := sm.GetChats(sessionID)
+		if err != nil || len(chats) != 1 || chats[0].WorkSessionID == 0 {
+			t.Errorf("Expected day chats to include work session chats, got %+v (%v)", chats, err)
+		}
+	})
+}
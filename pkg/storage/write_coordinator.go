@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default write coordinator settings.
+const (
+	DefaultWriteBatchSize  = 64
+	DefaultWriteBatchDelay = 0
+	DefaultWriteRetries    = 4
+	DefaultWriteBackoff    = 20 * time.Millisecond
+	DefaultWriteQueueSize  = 1024
+)
+
+// ErrWriteCoordinatorClosed is returned for writes submitted after Close.
+var ErrWriteCoordinatorClosed = NewStorageError(ErrDatabase, "write coordinator is closed", nil)
+
+// WriteCoordinatorConfig holds configuration for a WriteCoordinator.
+type WriteCoordinatorConfig struct {
+	MaxBatchSize  int           // Writes grouped into one transaction (default: 64)
+	MaxBatchDelay time.Duration // How long a batch waits to fill up (default: 0, take only queued writes)
+	MaxRetries    int           // Retries of a write that failed transiently (default: 4)
+	RetryBackoff  time.Duration // Delay before the first retry, doubled for each one after (default: 20ms)
+	QueueSize     int           // Writes waiting for the writer before callers block (default: 1024)
+}
+
+// DefaultWriteCoordinatorConfig returns a WriteCoordinatorConfig with default values.
+func DefaultWriteCoordinatorConfig() *WriteCoordinatorConfig {
+	return &WriteCoordinatorConfig{
+		MaxBatchSize:  DefaultWriteBatchSize,
+		MaxBatchDelay: DefaultWriteBatchDelay,
+		MaxRetries:    DefaultWriteRetries,
+		RetryBackoff:  DefaultWriteBackoff,
+		QueueSize:     DefaultWriteQueueSize,
+	}
+}
+
+// WriteStats counts the work done by a WriteCoordinator.
+type WriteStats struct {
+	Writes  int64 `json:"writes"`  // Writes committed
+	Failed  int64 `json:"failed"`  // Writes that returned an error
+	Batches int64 `json:"batches"` // Transactions committed
+	Retries int64 `json:"retries"` // Batches retried after a transient failure
+}
+
+// WriteCoordinator funnels writes through a single goroutine, which groups
+// them into transactions of up to MaxBatchSize writes or MaxBatchDelay of
+// waiting, so concurrent writers share one commit instead of each waiting
+// on SQLite's lock and an fsync of their own. Writes queued while a batch
+// commits make up the next one, so batches grow with load even without a
+// delay.
+//
+// Each write runs in a savepoint, so one failing write is rolled back alone
+// and its error returned to its caller while the rest of the batch commits.
+// Writes that fail because SQLite was busy or a disk write failed are
+// retried with backoff. IsRetryable marks every database error retryable,
+// including constraint violations that fail the same way each time, so
+// other errors are returned at once.
+//
+// Writes that can't run in a shared transaction, because they open their
+// own or also touch files or the vector store, go through Exclusive, which
+// runs them alone between batches. Routing every write through one
+// coordinator keeps writers from queueing on the database connection behind
+// a long write and from interleaving with a batch.
+type WriteCoordinator struct {
+	sm     *SessionManager
+	config *WriteCoordinatorConfig
+	ops    chan *writeOp
+	done   chan struct{}
+
+	mu     sync.RWMutex // Held for reading while submitting, for writing to close
+	closed bool
+
+	writes  atomic.Int64
+	failed  atomic.Int64
+	batches atomic.Int64
+	retries atomic.Int64
+}
+
+// writeOp is a write waiting for the writer and the channel its result is
+// delivered on. Exactly one of fn and exclusive is set.
+type writeOp struct {
+	fn        func(tx *sql.Tx) error
+	exclusive func() error
+	result    chan error
+}
+
+// NewWriteCoordinator creates a WriteCoordinator for the session manager's
+// database and starts its writer goroutine.
+func NewWriteCoordinator(config *WriteCoordinatorConfig, sm *SessionManager) *WriteCoordinator {
+	if config == nil {
+		config = DefaultWriteCoordinatorConfig()
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = DefaultWriteBatchSize
+	}
+	if config.QueueSize < 0 {
+		config.QueueSize = 0
+	}
+
+	wc := &WriteCoordinator{
+		sm:     sm,
+		config: config,
+		ops:    make(chan *writeOp, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go wc.run()
+	return wc
+}
+
+// Do runs fn in the writer's current transaction and returns its result
+// once the transaction has committed. fn must use only tx: the database has
+// a single connection, which tx holds.
+func (wc *WriteCoordinator) Do(fn func(tx *sql.Tx) error) error {
+	return <-wc.Submit(fn)
+}
+
+// Submit queues fn like Do without waiting. The returned channel receives
+// fn's result once its transaction has committed.
+func (wc *WriteCoordinator) Submit(fn func(tx *sql.Tx) error) <-chan error {
+	return wc.submit(&writeOp{fn: fn, result: make(chan error, 1)})
+}
+
+// Exclusive runs fn on the writer between batches, with no other write in
+// progress, and returns its result. fn writes through the session manager
+// as usual and may open transactions of its own, but must not call back
+// into the coordinator: the writer waits for fn to return. Exclusive writes
+// aren't retried, since fn may have committed part of its work.
+func (wc *WriteCoordinator) Exclusive(fn func() error) error {
+	return <-wc.submit(&writeOp{exclusive: fn, result: make(chan error, 1)})
+}
+
+// submit queues op for the writer, failing it at once after Close.
+func (wc *WriteCoordinator) submit(op *writeOp) <-chan error {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	if wc.closed {
+		op.result <- ErrWriteCoordinatorClosed
+		return op.result
+	}
+	wc.ops <- op
+	return op.result
+}
+
+// Stats returns counts of the writes, batches and retries so far.
+func (wc *WriteCoordinator) Stats() WriteStats {
+	return WriteStats{
+		Writes:  wc.writes.Load(),
+		Failed:  wc.failed.Load(),
+		Batches: wc.batches.Load(),
+		Retries: wc.retries.Load(),
+	}
+}
+
+// Close stops accepting writes and waits for queued ones to be committed.
+func (wc *WriteCoordinator) Close() error {
+	wc.mu.Lock()
+	if !wc.closed {
+		wc.closed = true
+		close(wc.ops)
+	}
+	wc.mu.Unlock()
+
+	<-wc.done
+	return nil
+}
+
+// run is the writer goroutine. It collects queued writes into batches, and
+// runs exclusive writes between them, until the queue is closed and drained.
+func (wc *WriteCoordinator) run() {
+	defer close(wc.done)
+
+	var next *writeOp
+	for {
+		op := next
+		if op == nil {
+			var ok bool
+			if op, ok = <-wc.ops; !ok {
+				return
+			}
+		}
+
+		if op.exclusive != nil {
+			next = nil
+			wc.deliver(op, op.exclusive())
+			continue
+		}
+		var batch []*writeOp
+		batch, next = wc.collect(op)
+		wc.commit(batch)
+	}
+}
+
+// collect gathers the writes queued behind first into a batch. With a
+// MaxBatchDelay it waits that long for the batch to fill; without one it
+// takes only the writes already queued. An exclusive write ends the batch
+// and is returned to run after it.
+func (wc *WriteCoordinator) collect(first *writeOp) ([]*writeOp, *writeOp) {
+	batch := []*writeOp{first}
+
+	var timeout <-chan time.Time
+	if wc.config.MaxBatchDelay > 0 {
+		timer := time.NewTimer(wc.config.MaxBatchDelay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch) < wc.config.MaxBatchSize {
+		var op *writeOp
+		var ok bool
+		if timeout == nil {
+			select {
+			case op, ok = <-wc.ops:
+			default:
+				return batch, nil
+			}
+		} else {
+			select {
+			case op, ok = <-wc.ops:
+			case <-timeout:
+				return batch, nil
+			}
+		}
+		if !ok {
+			return batch, nil
+		}
+		if op.exclusive != nil {
+			return batch, op
+		}
+		batch = append(batch, op)
+	}
+	return batch, nil
+}
+
+// commit applies a batch, retrying the writes that failed transiently with
+// backoff, and delivers each write's result.
+func (wc *WriteCoordinator) commit(batch []*writeOp) {
+	pending := batch
+	backoff := wc.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		results, err := wc.apply(pending)
+		if err != nil {
+			// The whole transaction failed, so every write is retried
+			results = make([]error, len(pending))
+			for i := range results {
+				results[i] = err
+			}
+		} else {
+			wc.batches.Add(1)
+		}
+
+		var retry []*writeOp
+		for i, op := range pending {
+			if results[i] != nil && isTransientWriteError(results[i]) && attempt < wc.config.MaxRetries {
+				retry = append(retry, op)
+				continue
+			}
+			wc.deliver(op, results[i])
+		}
+		if len(retry) == 0 {
+			return
+		}
+
+		wc.retries.Add(1)
+		time.Sleep(backoff)
+		backoff *= 2
+		pending = retry
+	}
+}
+
+// apply runs ops in one transaction, each in its own savepoint, and returns
+// each op's error. A non-nil error means the transaction itself failed and
+// nothing was committed.
+func (wc *WriteCoordinator) apply(ops []*writeOp) ([]error, error) {
+	tx, err := wc.sm.db.Begin()
+	if err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to begin write batch", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]error, len(ops))
+	for i, op := range ops {
+		if _, err := tx.Exec("SAVEPOINT write_op"); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to create savepoint", err)
+		}
+		if results[i] = op.fn(tx); results[i] != nil {
+			if _, err := tx.Exec("ROLLBACK TO write_op"); err != nil {
+				return nil, NewStorageError(ErrDatabase, "failed to roll back write", err)
+			}
+		}
+		if _, err := tx.Exec("RELEASE write_op"); err != nil {
+			return nil, NewStorageError(ErrDatabase, "failed to release savepoint", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewStorageError(ErrDatabase, "failed to commit write batch", err)
+	}
+	return results, nil
+}
+
+// deliver sends a write's result to its caller.
+func (wc *WriteCoordinator) deliver(op *writeOp, err error) {
+	if err != nil {
+		wc.failed.Add(1)
+	} else {
+		wc.writes.Add(1)
+	}
+	op.result <- err
+}
+
+// isTransientWriteError reports whether a write failed because SQLite was
+// busy or locked or a disk write failed, so retrying it may succeed.
+func isTransientWriteError(err error) bool {
+	if !IsRetryable(err) {
+		return false
+	}
+	errStr := err.Error()
+	return contains(errStr, "SQLITE_BUSY") || contains(errStr, "SQLITE_LOCKED") ||
+		contains(errStr, "database is locked") || contains(errStr, "database table is locked") ||
+		contains(errStr, "SQLITE_IOERR") || contains(errStr, "disk I/O error")
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWriteCoordinator tests batching concurrent writes, isolating a failing
+// write from its batch, retrying transient failures, running exclusive writes
+// in order and flushing on Close.
+func TestWriteCoordinator(t *testing.T) {
+	sm, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := &Session{Date: "2025-05-01"}
+	if err := sm.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sessionID := int64(session.ID)
+
+	config := DefaultWriteCoordinatorConfig()
+	config.MaxBatchDelay = 20 * time.Millisecond
+	config.RetryBackoff = time.Millisecond
+	wc := NewWriteCoordinator(config, sm)
+	defer wc.Close()
+
+	t.Run("Concurrent writes share transactions", func(t *testing.T) {
+		const writers = 100
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				start := time.Date(2025, 5, 1, 9, 0, 0, 0, time.Local).Add(time.Duration(i) * time.Minute)
+				block := &ActivityBlock{BlockID: fmt.Sprintf("block-%d", i), StartTime: start, EndTime: start.Add(time.Minute), OCRText: "text"}
+				errs <- wc.Do(func(tx *sql.Tx) error {
+					return sm.addBlock(tx, sessionID, "Editor", block)
+				})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Failed to add block: %v", err)
+			}
+		}
+
+		blocks, err := sm.GetBlocks(sessionID, "Editor")
+		if err != nil || len(blocks) != writers || blocks[0].OCRText != "text" {
+			t.Fatalf("Expected %d readable blocks, got %d (%v)", writers, len(blocks), err)
+		}
+		if stats := wc.Stats(); stats.Writes != writers || stats.Batches >= writers {
+			t.Errorf("Expected %d writes in fewer batches, got %+v", writers, stats)
+		}
+	})
+
+	t.Run("A failing write is rolled back alone", func(t *testing.T) {
+		first := wc.Submit(func(tx *sql.Tx) error {
+			return sm.addNotification(tx, &Notification{ID: "n1", Type: "info", Title: "First"})
+		})
+		failing := wc.Submit(func(tx *sql.Tx) error {
+			if err := sm.addNotification(tx, &Notification{ID: "n2", Type: "info", Title: "Second"}); err != nil {
+				return err
+			}
+			return NewStorageError(ErrValidation, "rejected", nil)
+		})
+		last := wc.Submit(func(tx *sql.Tx) error {
+			return sm.addChat(tx, sessionID, &ChatMessage{Role: ChatRoleUser, Content: "Hello"})
+		})
+
+		if err := <-first; err != nil {
+			t.Errorf("Expected the first write to commit, got %v", err)
+		}
+		if err := <-failing; !IsValidation(err) {
+			t.Errorf("Expected the failing write's own error, got %v", err)
+		}
+		if err := <-last; err != nil {
+			t.Errorf("Expected the last write to commit, got %v", err)
+		}
+
+		notifications, _ := sm.GetNotifications(10)
+		if len(notifications) != 1 || notifications[0].ID != "n1" {
+			t.Errorf("Expected only the first notification, got %+v", notifications)
+		}
+		if chats, _ := sm.GetChats(sessionID); len(chats) != 1 || chats[0].Content != "Hello" {
+			t.Errorf("Expected the chat committed, got %+v", chats)
+		}
+	})
+
+	t.Run("Transient failures are retried", func(t *testing.T) {
+		busy := errors.New("database is locked (5) (SQLITE_BUSY)")
+		calls := 0
+		err := wc.Do(func(tx *sql.Tx) error {
+			calls++
+			if calls < 3 {
+				return NewStorageError(ErrDatabase, "failed to add notification", busy)
+			}
+			return sm.addNotification(tx, &Notification{ID: "n3", Type: "info", Title: "Third"})
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("Expected success on the third attempt, got %d attempts (%v)", calls, err)
+		}
+
+		calls = 0
+		err = wc.Do(func(tx *sql.Tx) error {
+			calls++
+			return NewStorageError(ErrDatabase, "failed to add block", errors.New("FOREIGN KEY constraint failed"))
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("Expected a constraint failure returned at once, got %d attempts (%v)", calls, err)
+		}
+
+		calls = 0
+		err = wc.Do(func(tx *sql.Tx) error {
+			calls++
+			return NewStorageError(ErrDatabase, "failed to add block", busy)
+		})
+		if !IsRetryable(err) || calls != config.MaxRetries+1 {
+			t.Errorf("Expected to give up after %d retries, got %d attempts (%v)", config.MaxRetries, calls, err)
+		}
+		if stats := wc.Stats(); stats.Retries == 0 || stats.Failed != 3 {
+			t.Errorf("Expected retries and 3 failed writes counted, got %+v", stats)
+		}
+	})
+
+	t.Run("Exclusive writes run alone after queued writes", func(t *testing.T) {
+		before := wc.Stats()
+		release := make(chan struct{})
+		queued := wc.Submit(func(tx *sql.Tx) error {
+			<-release
+			return sm.addNotification(tx, &Notification{ID: "n4", Type: "info", Title: "Fourth"})
+		})
+
+		exclusive := make(chan error, 1)
+		go func() {
+			exclusive <- wc.Exclusive(func() error {
+				// Uses the database connection a batch would hold
+				return sm.MarkNotificationsRead([]string{"n4"})
+			})
+		}()
+		close(release)
+
+		if err := <-queued; err != nil {
+			t.Fatalf("Failed to add notification: %v", err)
+		}
+		select {
+		case err := <-exclusive:
+			if err != nil {
+				t.Fatalf("Failed to mark notification read: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the exclusive write to run")
+		}
+
+		notifications, err := sm.GetNotifications(100)
+		if err != nil {
+			t.Fatalf("Failed to get notifications: %v", err)
+		}
+		for _, n := range notifications {
+			if n.ID == "n4" && !n.Read {
+				t.Error("Expected the exclusive write to run after the queued one")
+			}
+		}
+		if stats := wc.Stats(); stats.Writes != before.Writes+2 {
+			t.Errorf("Expected 2 more writes, got %+v", stats)
+		}
+	})
+
+	t.Run("Close flushes queued writes", func(t *testing.T) {
+		var results []<-chan error
+		for i := 0; i < 10; i++ {
+			id := fmt.Sprintf("queued-%d", i)
+			results = append(results, wc.Submit(func(tx *sql.Tx) error {
+				return sm.addNotification(tx, &Notification{ID: id, Type: "info", Title: id})
+			}))
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		for _, result := range results {
+			if err := <-result; err != nil {
+				t.Errorf("Expected queued writes committed, got %v", err)
+			}
+		}
+		if notifications, _ := sm.GetNotifications(100); len(notifications) != 13 {
+			t.Errorf("Expected 13 notifications, got %d", len(notifications))
+		}
+		if err := wc.Do(func(tx *sql.Tx) error { return nil }); err != ErrWriteCoordinatorClosed {
+			t.Errorf("Expected writes after Close refused, got %v", err)
+		}
+	})
+}
+
+// setupWriteBenchmark creates a session manager with one session for the
+// write benchmarks.
+func setupWriteBenchmark(b *testing.B) (*SessionManager, int64, func()) {
+	tempDir, err := os.MkdirTemp("", "waddle_bench_*")
+	if err != nil {
+		b.Fatalf("Failed to create temp directory: %v", err)
+	}
+
+	em := NewEncryptionManager(tempDir)
+	if err := em.InitializeKey(); err != nil {
+		b.Fatalf("Failed to initialize encryption: %v", err)
+	}
+
+	sm := NewSessionManager(tempDir, em)
+	if err := sm.Initialize(); err != nil {
+		b.Fatalf("Failed to initialize session manager: %v", err)
+	}
+
+	session := &Session{Date: "2026-04-18"}
+	if err := sm.Create(session); err != nil {
+		b.Fatalf("Failed to create session: %v", err)
+	}
+
+	cleanup := func() {
+		sm.Close()
+		os.RemoveAll(tempDir)
+	}
+	return sm, int64(session.ID), cleanup
+}
+
+// benchmarkBlock returns a distinct activity block for the nth write.
+func benchmarkBlock(n int64) *ActivityBlock {
+	now := time.Now()
+	return &ActivityBlock{
+		BlockID:       fmt.Sprintf("block-%d", n),
+		StartTime:     now,
+		EndTime:       now.Add(time.Minute),
+		OCRText:       "test text",
+		MicroSummary:  "test summary",
+		CaptureSource: "benchmark",
+	}
+}
+
+// BenchmarkAddBlockDirect measures concurrent block writes that each run as
+// their own statement.
+func BenchmarkAddBlockDirect(b *testing.B) {
+	sm, sessionID, cleanup := setupWriteBenchmark(b)
+	defer cleanup()
+
+	var n atomic.Int64
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := sm.AddBlock(sessionID, "bench_app", benchmarkBlock(n.Add(1))); err != nil {
+				b.Errorf("Failed to add block: %v", err)
+			}
+		}
+	})
+}
+
+// BenchmarkAddBlockCoordinated measures the same writes batched by a
+// WriteCoordinator.
+func BenchmarkAddBlockCoordinated(b *testing.B) {
+	sm, sessionID, cleanup := setupWriteBenchmark(b)
+	defer cleanup()
+
+	wc := NewWriteCoordinator(DefaultWriteCoordinatorConfig(), sm)
+	defer wc.Close()
+
+	var n atomic.Int64
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			block := benchmarkBlock(n.Add(1))
+			err := wc.Do(func(tx *sql.Tx) error {
+				return sm.addBlock(tx, sessionID, "bench_app", block)
+			})
+			if err != nil {
+				b.Errorf("Failed to add block: %v", err)
+			}
+		}
+	})
+	b.ReportMetric(float64(wc.Stats().Batches), "batches")
+}
@@ -19,6 +19,7 @@ type Worker struct {
 	ollama     *ai.OllamaClient
 	extractor  *Extractor
 	processing atomic.Bool
+	paused     atomic.Bool
 	pending    atomic.Int64
 	quit       chan struct{}
 	wg         sync.WaitGroup
@@ -48,6 +49,12 @@ func (w *Worker) Close() error {
 	return nil
 }
 
+// SetPaused pauses or resumes background processing, as in incognito mode.
+// ProcessNext still works when called directly.
+func (w *Worker) SetPaused(paused bool) {
+	w.paused.Store(paused)
+}
+
 // PendingCount returns number of sessions awaiting synthesis
 func (w *Worker) PendingCount() int64 {
 	return w.pending.Load()
@@ -65,6 +72,9 @@ func (w *Worker) processLoop() {
 		case <-w.quit:
 			return
 		case <-ticker.C:
+			if w.paused.Load() {
+				continue
+			}
 			if err := w.ProcessNext(); err != nil {
 				log.Printf("Synthesis processing error: %v", err)
 			}
@@ -79,19 +89,17 @@ func (w *Worker) ProcessNext() error {
 	}
 	defer w.processing.Store(false)
 
-	// Get oldest pending session
-	sessions, _, err := w.storage.ListSessions(1, 100)
-	if err != nil {
-		return fmt.Errorf("failed to list sessions: %w", err)
-	}
-
+	// Get oldest pending session with captured text
 	var pendingSession *storage.Session
-	for _, session := range sessions {
-		// Check if synthesis is pending using the synthesis_status field
-		if session.SynthesisStatus == "pending" && session.ExtractedText != "" {
-			pendingSession = &session
-			break
+	err := w.storage.IterateSessions(storage.SessionQuery{SynthesisStatus: "pending"}, func(session storage.Session) error {
+		if session.ExtractedText == "" {
+			return nil
 		}
+		pendingSession = &session
+		return storage.ErrStopIteration
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
 	}
 
 	if pendingSession == nil {
@@ -99,21 +107,145 @@ func (w *Worker) ProcessNext() error {
 		return nil // No pending sessions
 	}
 
+	// Meetings give the summary structure that captured text alone lacks
+	text := pendingSession.ExtractedText
+	meetings, err := w.storage.GetMeetings(pendingSession.Date)
+	if err != nil {
+		return fmt.Errorf("failed to get meetings: %w", err)
+	}
+	if len(meetings) > 0 {
+		text = MeetingContext(meetings) + "\n" + text
+	}
+
+	// Days that span several work sessions get a card per work session
+	workSessions, err := w.storage.SegmentSession(pendingSession.Date)
+	if err != nil {
+		return fmt.Errorf("failed to segment session: %w", err)
+	}
+	if len(workSessions) > 1 {
+		return w.processWorkSessions(pendingSession, workSessions)
+	}
+
+	summary, bulletsJSON, entitiesJSON, err := w.synthesize(text)
+	if err != nil {
+		return err
+	}
+
+	// Create knowledge card
+	knowledgeCard := &storage.KnowledgeCard{
+		SessionID: pendingSession.ID,
+		Title:     fmt.Sprintf("Session %s", pendingSession.Date),
+		Bullets:   string(bulletsJSON),
+		Entities:  string(entitiesJSON),
+		Status:    "completed",
+	}
+	if len(workSessions) == 1 {
+		knowledgeCard.WorkSessionID = workSessions[0].ID
+	}
+
+	if err := w.storage.CreateKnowledgeCard(knowledgeCard); err != nil {
+		return fmt.Errorf("failed to create knowledge card: %w", err)
+	}
+
+	if len(workSessions) == 1 {
+		workSessions[0].SynthesisStatus = "completed"
+		if err := w.storage.UpdateWorkSession(&workSessions[0]); err != nil {
+			return fmt.Errorf("failed to update work session: %w", err)
+		}
+	}
+
+	// Update session with synthesis results
+	pendingSession.CustomSummary = summary
+	pendingSession.SynthesisStatus = "completed"
+	
+	if err := w.storage.UpdateSessionAs(pendingSession, storage.RevisionActorSynthesis); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	log.Printf("Synthesized session: %s (Knowledge Card ID: %d)", pendingSession.Date, knowledgeCard.ID)
+	return nil
+}
+
+// processWorkSessions creates a knowledge card for each work session of the
+// day that is pending synthesis, built from the blocks and meetings within
+// it. The day's summary combines the work session summaries.
+func (w *Worker) processWorkSessions(session *storage.Session, workSessions []storage.WorkSession) error {
+	var daySummary strings.Builder
+	for i := range workSessions {
+		ws := &workSessions[i]
+		activity, err := w.storage.GetWorkSessionActivity(int64(ws.ID))
+		if err != nil {
+			return fmt.Errorf("failed to get work session activity: %w", err)
+		}
+
+		span := fmt.Sprintf("%s-%s", ws.StartTime.Local().Format("15:04"), ws.EndTime.Local().Format("15:04"))
+		if ws.SynthesisStatus == "completed" && len(activity.KnowledgeCards) > 0 {
+			daySummary.WriteString(span + "\n" + bulletText(activity.KnowledgeCards[0].Bullets) + "\n")
+			continue
+		}
+
+		text := WorkSessionContext(activity)
+		if text == "" {
+			continue
+		}
+
+		summary, bulletsJSON, entitiesJSON, err := w.synthesize(text)
+		if err != nil {
+			return err
+		}
+
+		title := ws.Title
+		if title == "" {
+			title = fmt.Sprintf("Session %s %s", session.Date, span)
+		}
+		card := &storage.KnowledgeCard{
+			SessionID:     session.ID,
+			WorkSessionID: ws.ID,
+			Title:         title,
+			Bullets:       string(bulletsJSON),
+			Entities:      string(entitiesJSON),
+			Status:        "completed",
+		}
+		if err := w.storage.CreateKnowledgeCard(card); err != nil {
+			return fmt.Errorf("failed to create knowledge card: %w", err)
+		}
+
+		ws.SynthesisStatus = "completed"
+		if err := w.storage.UpdateWorkSession(ws); err != nil {
+			return fmt.Errorf("failed to update work session: %w", err)
+		}
+
+		daySummary.WriteString(span + "\n" + summary + "\n")
+	}
+
+	session.CustomSummary = strings.TrimSpace(daySummary.String())
+	session.SynthesisStatus = "completed"
+	if err := w.storage.UpdateSessionAs(session, storage.RevisionActorSynthesis); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	log.Printf("Synthesized session: %s (%d work sessions)", session.Date, len(workSessions))
+	return nil
+}
+
+// synthesize generates the 3-bullet summary and extracts entities from text,
+// returning the raw summary with the bullets and entities as JSON.
+func (w *Worker) synthesize(text string) (string, []byte, []byte, error) {
 	// Generate 3-bullet summary
-	summary, err := w.generate3BulletSummary(pendingSession.ExtractedText)
+	summary, err := w.generate3BulletSummary(text)
 	if err != nil {
-		return fmt.Errorf("failed to generate summary: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
 	// Extract entities
-	entities := w.extractor.Extract(pendingSession.ExtractedText)
-	
+	entities := w.extractor.Extract(text)
+
 	// Convert entities to JSON
 	entitiesJSON, err := json.Marshal(entities)
 	if err != nil {
-		return fmt.Errorf("failed to marshal entities: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to marshal entities: %w", err)
 	}
-	
+
 	// Convert summary to bullet points array
 	bullets := strings.Split(summary, "\n")
 	var cleanBullets []string
@@ -123,7 +255,7 @@ func (w *Worker) ProcessNext() error {
 			cleanBullets = append(cleanBullets, bullet)
 		}
 	}
-	
+
 	// Ensure exactly 3 bullets
 	for len(cleanBullets) < 3 {
 		cleanBullets = append(cleanBullets, "• Additional activity")
@@ -131,35 +263,63 @@ func (w *Worker) ProcessNext() error {
 	if len(cleanBullets) > 3 {
 		cleanBullets = cleanBullets[:3]
 	}
-	
+
 	bulletsJSON, err := json.Marshal(cleanBullets)
 	if err != nil {
-		return fmt.Errorf("failed to marshal bullets: %w", err)
-	}
-	
-	// Create knowledge card
-	knowledgeCard := &storage.KnowledgeCard{
-		SessionID: pendingSession.ID,
-		Title:     fmt.Sprintf("Session %s", pendingSession.Date),
-		Bullets:   string(bulletsJSON),
-		Entities:  string(entitiesJSON),
-		Status:    "completed",
+		return "", nil, nil, fmt.Errorf("failed to marshal bullets: %w", err)
 	}
-	
-	if err := w.storage.CreateKnowledgeCard(knowledgeCard); err != nil {
-		return fmt.Errorf("failed to create knowledge card: %w", err)
+
+	return summary, bulletsJSON, entitiesJSON, nil
+}
+
+// bulletText joins a card's JSON bullet array into lines.
+func bulletText(bulletsJSON string) string {
+	var bullets []string
+	if err := json.Unmarshal([]byte(bulletsJSON), &bullets); err != nil {
+		return ""
 	}
+	return strings.Join(bullets, "\n")
+}
 
-	// Update session with synthesis results
-	pendingSession.CustomSummary = summary
-	pendingSession.SynthesisStatus = "completed"
-	
-	if err := w.storage.UpdateSession(pendingSession); err != nil {
-		return fmt.Errorf("failed to update session: %w", err)
+// WorkSessionContext formats a work session's meetings and activity blocks
+// as plain text for synthesis prompts and chat context. It returns "" if
+// nothing was recorded.
+func WorkSessionContext(activity *storage.WorkSessionActivity) string {
+	var b strings.Builder
+	if len(activity.Meetings) > 0 {
+		b.WriteString(MeetingContext(activity.Meetings))
+	}
+	for _, block := range activity.Blocks {
+		text := block.MicroSummary
+		if block.OCRText != "" {
+			text = block.OCRText
+		}
+		if text == "" {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("[%s] %s: %s\n", block.StartTime.Local().Format("15:04"), block.AppName, text))
 	}
+	return b.String()
+}
 
-	log.Printf("Synthesized session: %s (Knowledge Card ID: %d)", pendingSession.Date, knowledgeCard.ID)
-	return nil
+// MeetingContext formats a session's meetings, with their attendees, as
+// plain text for synthesis prompts and chat context.
+func MeetingContext(meetings []storage.Meeting) string {
+	var b strings.Builder
+	b.WriteString("Meetings:\n")
+	for _, m := range meetings {
+		if m.AllDay {
+			b.WriteString(fmt.Sprintf("- All day: %s", m.Title))
+		} else {
+			b.WriteString(fmt.Sprintf("- %s-%s: %s",
+				m.StartTime.Local().Format("15:04"), m.EndTime.Local().Format("15:04"), m.Title))
+		}
+		if len(m.Attendees) > 0 {
+			b.WriteString(fmt.Sprintf(" (with %s)", strings.Join(m.Attendees, ", ")))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
 // generate3BulletSummary creates exactly 3 bullet points
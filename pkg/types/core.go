@@ -78,6 +78,12 @@ type Session struct {
 	CreatedAt       time.Time `json:"createdAt"`
 	UpdatedAt       time.Time `json:"updatedAt"`
 
+	// When the session day starts and ends (after the day rollover hour),
+	// and the IANA zone the date was computed in
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	TimeZone  string    `json:"timeZone"`
+
 	// Synthesis columns
 	EntitiesJSON     string `json:"entitiesJson"`    // JSON array of extracted entities
 	SynthesisStatus  string `json:"synthesisStatus"` // "pending", "completed", "failed"
@@ -119,11 +125,13 @@ type ActivityBlock struct {
 
 // ChatMessage represents a chat message in a session.
 type ChatMessage struct {
-	ID        ElementID `json:"id" ts_type:"string"`
-	SessionID SessionID `json:"sessionId" ts_type:"string"`
-	Role      string    `json:"role"`    // "user" or "assistant"
-	Content   string    `json:"content"` // Encrypted in DB
-	Timestamp time.Time `json:"timestamp"`
+	ID            ElementID `json:"id" ts_type:"string"`
+	SessionID     SessionID `json:"sessionId" ts_type:"string"`
+	// WorkSessionID is 0 when the chat is about the whole day
+	WorkSessionID ElementID `json:"workSessionId,omitempty" ts_type:"string"`
+	Role          string    `json:"role"`    // "user" or "assistant"
+	Content       string    `json:"content"` // Encrypted in DB
+	Timestamp     time.Time `json:"timestamp"`
 }
 
 // ChatRole constants for validation.
@@ -150,25 +158,225 @@ type Notification struct {
 	Metadata   string    `json:"metadata,omitempty"` // JSON string
 }
 
-// ManualNote represents a user-created note within a session.
+// ManualNote represents a user-created note within a session. Content is
+// Markdown and is encrypted at rest.
 type ManualNote struct {
 	ID        ElementID `json:"id" ts_type:"string"`
 	SessionID SessionID `json:"sessionId" ts_type:"string"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Links are the activity blocks and time ranges the note refers to
+	Links []NoteLink `json:"links,omitempty"`
+}
+
+// NoteLink is a backlink from a note to an activity block or, when BlockID
+// is 0, to the time range [StartTime, EndTime).
+type NoteLink struct {
+	BlockID   ElementID `json:"blockId,omitempty" ts_type:"string"`
+	StartTime time.Time `json:"startTime,omitempty"`
+	EndTime   time.Time `json:"endTime,omitempty"`
+}
+
+// NoteRevision is an earlier version of a note's content, saved when the
+// note is edited.
+type NoteRevision struct {
+	ID        ElementID `json:"id" ts_type:"string"`
+	NoteID    ElementID `json:"noteId" ts_type:"string"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // KnowledgeCard represents an AI-generated summary card for a session.
 type KnowledgeCard struct {
+	ID            ElementID `json:"id" ts_type:"string"`
+	SessionID     SessionID `json:"sessionId" ts_type:"string"`
+	// WorkSessionID is 0 when the card covers the whole day
+	WorkSessionID ElementID `json:"workSessionId,omitempty" ts_type:"string"`
+	Title         string    `json:"title"`
+	Bullets       string    `json:"bullets"`  // JSON array of 3 bullet points
+	Entities      string    `json:"entities"` // JSON array of extracted entities
+	Status        string    `json:"status"`   // "pending", "completed", "failed"
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// RevisionEntity names the kind of item a revision belongs to.
+type RevisionEntity string
+
+const (
+	RevisionEntitySession RevisionEntity = "session"
+	RevisionEntityCard    RevisionEntity = "card"
+)
+
+// RevisionActor names who made the change recorded by a revision.
+type RevisionActor string
+
+const (
+	RevisionActorUser      RevisionActor = "user"
+	RevisionActorSynthesis RevisionActor = "synthesis"
+	RevisionActorImport    RevisionActor = "import"
+)
+
+// FieldChange is the value of a field before and after a change.
+type FieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Revision records one change to the user-visible fields of a session or
+// knowledge card, keyed by column name.
+type Revision struct {
+	ID         ElementID              `json:"id" ts_type:"string"`
+	EntityType RevisionEntity         `json:"entityType"`
+	EntityID   ElementID              `json:"entityId" ts_type:"string"`
+	Actor      RevisionActor          `json:"actor"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// JobRunStatus is the state of a scheduled job run.
+type JobRunStatus string
+
+const (
+	JobRunRunning   JobRunStatus = "running"
+	JobRunSucceeded JobRunStatus = "succeeded"
+	JobRunFailed    JobRunStatus = "failed"
+)
+
+// JobTrigger names what started a job run.
+type JobTrigger string
+
+const (
+	JobTriggerSchedule JobTrigger = "schedule"
+	JobTriggerCatchUp  JobTrigger = "catch-up" // A run missed while the machine was off or asleep
+	JobTriggerManual   JobTrigger = "manual"
+)
+
+// JobRun is one run of a scheduled maintenance job.
+type JobRun struct {
+	ID         ElementID    `json:"id" ts_type:"string"`
+	Job        string       `json:"job"`
+	Trigger    JobTrigger   `json:"trigger"`
+	Status     JobRunStatus `json:"status"`
+	Message    string       `json:"message,omitempty"` // Summary of what the run did
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+// JobState is the persisted schedule state of a job, kept across restarts
+// so runs missed while the app was closed can be caught up.
+type JobState struct {
+	Name       string       `json:"name"`
+	Schedule   string       `json:"schedule"`
+	NextRunAt  time.Time    `json:"nextRunAt"`
+	LastRunAt  *time.Time   `json:"lastRunAt,omitempty"`
+	LastStatus JobRunStatus `json:"lastStatus,omitempty"`
+	LastError  string       `json:"lastError,omitempty"`
+}
+
+// RetentionTarget is the kind of data a retention rule expires.
+type RetentionTarget string
+
+const (
+	RetentionTargetActivity    RetentionTarget = "activity"    // An app's activity in a session, or whole sessions
+	RetentionTargetScreenshots RetentionTarget = "screenshots" // Screenshot files only; OCR text and summaries are kept
+)
+
+// RetentionRule overrides how long matching data is kept. Rules are checked
+// in order and the first match applies; data no rule matches is kept for the
+// configured retention period.
+type RetentionRule struct {
+	Apps     []string        `json:"apps,omitempty"`   // App name patterns such as "slack*", case-insensitive; empty matches any app
+	Tags     []string        `json:"tags,omitempty"`   // Session tags, any of which matches; "*" matches any tagged session
+	Target   RetentionTarget `json:"target,omitempty"` // Default: activity
+	KeepDays int             `json:"keepDays"`         // 0 keeps matching data forever
+}
+
+// ScreenshotTier is a storage tier screenshots move into as they age. A
+// screenshot is re-encoded as JPEG, downscaled to MaxWidth, once it is
+// AfterDays old.
+type ScreenshotTier struct {
+	Name      string `json:"name"`
+	AfterDays int    `json:"afterDays"`
+	MaxWidth  int    `json:"maxWidth"` // 0 keeps the original width
+	Quality   int    `json:"quality"`  // JPEG quality, 1-100
+}
+
+// WorkSession is a stretch of work within a day's session. A day is split
+// into work sessions at idle gaps and at boundaries set by the user; the
+// day's Session remains the aggregate view over all of them.
+type WorkSession struct {
+	ID              ElementID `json:"id" ts_type:"string"`
+	SessionID       SessionID `json:"sessionId" ts_type:"string"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	Boundary        string    `json:"boundary"` // How the start was set: "idle" or "manual"
+	Title           string    `json:"title"`
+	SynthesisStatus string    `json:"synthesisStatus"` // "pending", "completed", "failed"
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Tag is a user label that can be attached to sessions, activity blocks and
+// knowledge cards. Names are unique regardless of case.
+type Tag struct {
 	ID        ElementID `json:"id" ts_type:"string"`
-	SessionID SessionID `json:"sessionId" ts_type:"string"`
-	Title     string    `json:"title"`
-	Bullets   string    `json:"bullets"`  // JSON array of 3 bullet points
-	Entities  string    `json:"entities"` // JSON array of extracted entities
-	Status    string    `json:"status"`   // "pending", "completed", "failed"
+	Name      string    `json:"name"`
+	Color     string    `json:"color"` // Hex color for display, may be empty
 	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TagTarget names the kind of item a tag is attached to.
+type TagTarget string
+
+const (
+	TagTargetSession TagTarget = "session"
+	TagTargetBlock   TagTarget = "block"
+	TagTargetCard    TagTarget = "card"
+)
+
+// TagRule tags items automatically from their extracted entities. An entity
+// of EntityType (any type when empty) whose value matches Pattern gets the
+// tag named by Tag, which may refer to submatches as $1 or ${name}; for
+// example pattern `^(ACME)-\d+$` with tag "client:$1".
+type TagRule struct {
+	ID         ElementID  `json:"id" ts_type:"string"`
+	EntityType EntityType `json:"entityType"`
+	Pattern    string     `json:"pattern"`
+	Tag        string     `json:"tag"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// BrowserVisit represents a single page visit imported from a browser history database.
+type BrowserVisit struct {
+	ID              ElementID `json:"id" ts_type:"string"`
+	SessionID       SessionID `json:"sessionId" ts_type:"string"`
+	ActivityBlockID ElementID `json:"activityBlockId,omitempty" ts_type:"string"` // 0 if no block covers the visit
+	Browser         string    `json:"browser"`                                    // "chromium", "firefox"
+	URL             string    `json:"url"`
+	Title           string    `json:"title"`
+	VisitedAt       time.Time `json:"visitedAt"`
+}
+
+// Meeting represents one occurrence of a calendar event imported from an
+// iCalendar file. Recurring events are stored as one Meeting per occurrence.
+type Meeting struct {
+	ID           ElementID `json:"id" ts_type:"string"`
+	SessionID    SessionID `json:"sessionId" ts_type:"string"`
+	Source       string    `json:"source"` // Calendar file the event came from
+	UID          string    `json:"uid"`
+	RecurrenceID time.Time `json:"recurrenceId"` // Originally scheduled start; differs from StartTime if the occurrence was moved
+	Title        string    `json:"title"`
+	Location     string    `json:"location,omitempty"`
+	Organizer    string    `json:"organizer,omitempty"`
+	Attendees    []string  `json:"attendees"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	AllDay       bool      `json:"allDay"`
+	TimeZone     string    `json:"timeZone,omitempty"` // IANA zone of the event, if it had one
 }
 
 // SearchResult represents a search result from full-text or semantic search.